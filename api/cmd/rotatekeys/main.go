@@ -0,0 +1,62 @@
+// Command rotatekeys re-encrypts the final context, trace and steps of stored
+// executions with the current key in ENCRYPTION_KEYS, including executions
+// stored before encryption was enabled. Once it reports no executions left,
+// keys other than the current one can be removed from ENCRYPTION_KEYS.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/fieldcrypt"
+	"workflow-code-test/api/services/workflow"
+)
+
+func main() {
+	batch := flag.Int("batch", 100, "executions re-encrypted per round")
+	flag.Parse()
+
+	if err := run(context.Background(), *batch); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, batch int) error {
+	spec, ok := os.LookupEnv("ENCRYPTION_KEYS")
+	if !ok {
+		return fmt.Errorf("ENCRYPTION_KEYS is not set")
+	}
+	keys, err := fieldcrypt.ParseKeyring(spec, os.Getenv("ENCRYPTION_KEY_ID"))
+	if err != nil {
+		return fmt.Errorf("invalid ENCRYPTION_KEYS: %w", err)
+	}
+
+	pool, err := db.Connect(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	if err := db.Migrate(ctx, pool); err != nil {
+		return err
+	}
+
+	repo := workflow.NewPostgresRepository(pool).WithKeyring(keys)
+	total := 0
+	for {
+		n, err := repo.RotateKeys(ctx, batch)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		total += n
+		fmt.Printf("re-encrypted %d executions\n", total)
+	}
+	fmt.Printf("done: %d executions re-encrypted with key %s\n", total, keys.Current())
+	return nil
+}
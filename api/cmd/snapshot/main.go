@@ -0,0 +1,113 @@
+// Command snapshot downloads an execution snapshot from one API instance and
+// loads it into another, usually a local one started with DEV_MODE=true, to
+// debug the execution offline:
+//
+//	go run ./cmd/snapshot download -api https://staging.example.com/api/v1 -o run.tar.gz <executionId>
+//	go run ./cmd/snapshot load [-replace] run.tar.gz
+//
+// Start the local API with VCR_MODE=replay to have the recorded responses
+// served back.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "download":
+		err = download(os.Args[2:])
+	case "load":
+		err = load(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: snapshot download [-api url] [-o file] <executionId>")
+	fmt.Fprintln(os.Stderr, "       snapshot load [-api url] [-replace] <file>")
+	os.Exit(2)
+}
+
+var client = &http.Client{Timeout: time.Minute}
+
+func download(args []string) error {
+	flags := flag.NewFlagSet("download", flag.ExitOnError)
+	api := flags.String("api", "http://localhost:8080/api/v1", "base URL of the API to download from")
+	out := flags.String("o", "", "archive to write, execution-<id>.tar.gz by default")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+	id := flags.Arg(0)
+	if *out == "" {
+		*out = "execution-" + id + ".tar.gz"
+	}
+
+	resp, err := client.Get(strings.TrimSuffix(*api, "/") + "/executions/" + id + "/snapshot")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	if err := os.WriteFile(*out, body, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s (%d bytes)\n", *out, len(body))
+	return nil
+}
+
+func load(args []string) error {
+	flags := flag.NewFlagSet("load", flag.ExitOnError)
+	api := flags.String("api", "http://localhost:8080/api/v1", "base URL of the API to load into, in dev mode")
+	replace := flags.Bool("replace", false, "replace the workflow if it already exists")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+	archive, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(*api, "/") + "/dev/snapshots"
+	if *replace {
+		url += "?replace=true"
+	}
+	resp, err := client.Post(url, "application/gzip", bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("load failed: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	fmt.Println(string(bytes.TrimSpace(body)))
+	return nil
+}
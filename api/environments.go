@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+
+	"workflow-code-test/api/pkg/email"
+	"workflow-code-test/api/pkg/engine"
+	nodehandlers "workflow-code-test/api/pkg/engine/handlers"
+	"workflow-code-test/api/pkg/incidents"
+	"workflow-code-test/api/pkg/issues"
+	"workflow-code-test/api/pkg/mqtt"
+	"workflow-code-test/api/pkg/saga"
+	"workflow-code-test/api/pkg/sandbox"
+	"workflow-code-test/api/pkg/sheets"
+	"workflow-code-test/api/pkg/weather"
+)
+
+// environmentsFile is the format of the file named by ENVIRONMENTS_FILE.
+type environmentsFile struct {
+	Environments map[string]environmentConfig `yaml:"environments"`
+}
+
+// environmentConfig describes the services one environment's runs call.
+type environmentConfig struct {
+	Weather struct {
+		// Provider is tried first; defaults to WEATHER_PROVIDER.
+		Provider     string `yaml:"provider"`
+		OpenMeteoURL string `yaml:"openMeteoURL"`
+		MetNoURL     string `yaml:"metNoURL"`
+	} `yaml:"weather"`
+
+	// Sandbox serves the environment's integrations from fakes, like
+	// INTEGRATION_SANDBOX does for the whole process.
+	Sandbox            bool     `yaml:"sandbox"`
+	SandboxTemperature *float64 `yaml:"sandboxTemperature"`
+	SandboxFixtures    string   `yaml:"sandboxFixtures"`
+}
+
+// loadEnvironments reads the environments in path and registers their
+// handlers on registry. Environments share the city catalog, the email
+// outbox, the distribution lists and the Open-Meteo API key of the process. It returns the environment names, sorted.
+func loadEnvironments(path string, registry *engine.Registry, weatherProvider string, httpClient *http.Client, quota *weather.Quota, cities weather.Catalog, outbox *email.Outbox, lists email.Lists) ([]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file environmentsFile
+	if err := yaml.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	names := slices.Sorted(maps.Keys(file.Environments))
+	for _, name := range names {
+		if name == "" || name == engine.VariantDefault || name == nodehandlers.VariantSandbox {
+			return nil, fmt.Errorf("%s: environment name %q is reserved", path, name)
+		}
+		deps, err := file.Environments[name].dependencies(weatherProvider, httpClient, quota)
+		if err != nil {
+			return nil, fmt.Errorf("%s: environment %s: %w", path, name, err)
+		}
+		deps.Cities = cities
+		deps.Email, deps.Outbox = email.NewRecordingClient(outbox), outbox
+		deps.Lists = lists
+		nodehandlers.RegisterEnvironment(registry, name, deps)
+	}
+	return names, nil
+}
+
+// dependencies builds the clients of the environment. Sandboxed environments
+// never use the API key of quota.
+func (c environmentConfig) dependencies(weatherProvider string, httpClient *http.Client, quota *weather.Quota) (nodehandlers.Dependencies, error) {
+	deps := nodehandlers.Dependencies{Sandbox: c.Sandbox}
+	if c.Weather.Provider != "" {
+		weatherProvider = c.Weather.Provider
+	}
+
+	if c.Sandbox {
+		deps.Jira = issues.NewMockClient(nodehandlers.TrackerJira)
+		deps.GitHub = issues.NewMockClient(nodehandlers.TrackerGitHub)
+		deps.PagerDuty = incidents.NewMockClient(nodehandlers.ProviderPagerDuty)
+		deps.Opsgenie = incidents.NewMockClient(nodehandlers.ProviderOpsgenie)
+		deps.Sheets = sheets.NewMockClient()
+		deps.MQTT = mqtt.NewMockPublisher()
+		deps.Saga = saga.NewMockClient()
+		if c.SandboxFixtures == "" {
+			temperature := sandbox.DefaultTemperature
+			if c.SandboxTemperature != nil {
+				temperature = *c.SandboxTemperature
+			}
+			deps.Weather = sandbox.NewWeatherClient(temperature)
+			return deps, nil
+		}
+		httpClient = &http.Client{Transport: &sandbox.Transport{Dir: c.SandboxFixtures}}
+	}
+
+	openMeteo, metNo := weather.NewOpenMeteoClient(), weather.NewMetNoClient()
+	if httpClient != nil {
+		openMeteo.HTTPClient = httpClient
+		metNo.HTTPClient = httpClient
+	}
+	if c.Weather.OpenMeteoURL != "" {
+		openMeteo.BaseURL = c.Weather.OpenMeteoURL
+	}
+	if c.Weather.MetNoURL != "" {
+		metNo.BaseURL = c.Weather.MetNoURL
+	}
+	var openMeteoClient weather.Client = openMeteo
+	if quota != nil && !c.Sandbox {
+		openMeteoClient = quota.Wrap(openMeteo)
+	}
+	failover, ok := weather.NewFailover(
+		weather.Provider{Name: weather.ProviderOpenMeteo, Client: openMeteoClient},
+		weather.Provider{Name: weather.ProviderMetNo, Client: metNo},
+	).Prefer(weatherProvider)
+	if !ok {
+		return deps, fmt.Errorf("unknown weather provider %q", weatherProvider)
+	}
+	deps.Weather = failover
+	return deps, nil
+}
@@ -0,0 +1,49 @@
+// k6 scenario for the synchronous execute endpoint. Run with `make loadtest`
+// against a running API, e.g. STORAGE=memory INTEGRATION_SANDBOX=true so the
+// numbers measure the API rather than Open-Meteo.
+import http from 'k6/http';
+import { check } from 'k6';
+
+const BASE_URL = __ENV.BASE_URL || 'http://localhost:8080/api/v1';
+const WORKFLOW_ID = __ENV.WORKFLOW_ID || '550e8400-e29b-41d4-a716-446655440000';
+
+export const options = {
+  scenarios: {
+    execute: {
+      executor: 'ramping-arrival-rate',
+      startRate: 10,
+      timeUnit: '1s',
+      preAllocatedVUs: 50,
+      stages: [
+        { target: 50, duration: '30s' },
+        { target: 50, duration: '1m' },
+        { target: 0, duration: '10s' },
+      ],
+    },
+  },
+  thresholds: {
+    http_req_failed: ['rate<0.01'],
+    http_req_duration: ['p(95)<250'],
+  },
+};
+
+const cities = ['Sydney', 'Melbourne', 'Brisbane', 'Perth', 'Adelaide'];
+
+export default function () {
+  const body = JSON.stringify({
+    formData: {
+      name: 'Load Test',
+      email: 'loadtest@example.com',
+      city: cities[Math.floor(Math.random() * cities.length)],
+    },
+    condition: { operator: 'greater_than', threshold: 25 },
+  });
+
+  const res = http.post(`${BASE_URL}/workflows/${WORKFLOW_ID}/execute`, body, {
+    headers: { 'Content-Type': 'application/json' },
+  });
+  check(res, {
+    'status is 200': (r) => r.status === 200,
+    'execution completed': (r) => r.json('status') === 'completed',
+  });
+}
@@ -2,17 +2,41 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5/pgxpool"
 
+	"workflow-code-test/api/pkg/callback"
 	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/dedupe"
+	"workflow-code-test/api/pkg/durable"
+	"workflow-code-test/api/pkg/email"
+	"workflow-code-test/api/pkg/engine"
+	nodehandlers "workflow-code-test/api/pkg/engine/handlers"
+	"workflow-code-test/api/pkg/faults"
+	"workflow-code-test/api/pkg/fieldcrypt"
+	"workflow-code-test/api/pkg/incidents"
+	"workflow-code-test/api/pkg/issues"
+	"workflow-code-test/api/pkg/mqtt"
+	"workflow-code-test/api/pkg/saga"
+	"workflow-code-test/api/pkg/sandbox"
+	"workflow-code-test/api/pkg/sharelink"
+	"workflow-code-test/api/pkg/sheets"
+	"workflow-code-test/api/pkg/sqlquery"
+	"workflow-code-test/api/pkg/statestore"
+	"workflow-code-test/api/pkg/vcr"
+	"workflow-code-test/api/pkg/weather"
 	"workflow-code-test/api/services/workflow"
 )
 
@@ -23,30 +47,319 @@ func main() {
 	})
 	slog.SetDefault(slog.New(logHandler))
 
-	dbURL, ok := os.LookupEnv("DATABASE_URL")
-	if !ok {
-		slog.Error("DATABASE_URL is not set")
-		return
-	}
+	var (
+		pool    *pgxpool.Pool
+		repoOpt []workflow.Option
+		err     error
+	)
+	if os.Getenv("STORAGE") == "memory" {
+		slog.Warn("STORAGE=memory, workflows and executions are lost on restart")
+		repoOpt = append(repoOpt, workflow.WithRepository(workflow.NewMemoryRepository()))
+	} else {
+		dbURL, ok := os.LookupEnv("DATABASE_URL")
+		if !ok {
+			slog.Error("DATABASE_URL is not set")
+			return
+		}
 
-	pool, err := db.Connect(ctx, dbURL)
-	if err != nil {
-		slog.Error("Failed to connect to database", "error", err)
-		return
+		pool, err = db.Connect(ctx, dbURL)
+		if err != nil {
+			slog.Error("Failed to connect to database", "error", err)
+			return
+		}
+		defer pool.Close()
+
+		if err := db.Migrate(ctx, pool); err != nil {
+			slog.Error("Failed to migrate database", "error", err)
+			return
+		}
+
+		if spec, ok := os.LookupEnv("ENCRYPTION_KEYS"); ok {
+			keys, err := fieldcrypt.ParseKeyring(spec, os.Getenv("ENCRYPTION_KEY_ID"))
+			if err != nil {
+				slog.Error("Invalid ENCRYPTION_KEYS", "error", err)
+				return
+			}
+			slog.Info("Encrypting execution state and traces", "key", keys.Current())
+			repoOpt = append(repoOpt, workflow.WithRepository(workflow.NewPostgresRepository(pool).WithKeyring(keys)))
+		}
 	}
-	defer pool.Close()
 
 	// setup router
 	mainRouter := mux.NewRouter()
 
 	apiRouter := mainRouter.PathPrefix("/api/v1").Subrouter()
 
-	workflowService, err := workflow.NewService(pool)
+	weatherProvider := os.Getenv("WEATHER_PROVIDER")
+	if weatherProvider == "" {
+		weatherProvider = weather.ProviderOpenMeteo
+	}
+	// In dev mode the emails nodes "send" can be read back from the outbox.
+	var outbox *email.Outbox
+	if os.Getenv("DEV_MODE") == "true" {
+		outbox = email.NewOutbox(email.DefaultOutboxSize)
+		slog.Warn("DEV_MODE enabled, sent emails are kept in memory and listed at /api/v1/dev/outbox")
+	}
+	deps := nodehandlers.Dependencies{Email: email.NewRecordingClient(outbox), Outbox: outbox}
+	var httpClient *http.Client
+	// fixtures also lists the responses of each execution, for its snapshot.
+	var fixtures *vcr.Transport
+	// The sandbox has no geocoder: cities are added with their coordinates.
+	var geocoder weather.Geocoder
+	// weatherQuota counts Open-Meteo calls against the API key's quota, when
+	// there is a key.
+	var weatherQuota *weather.Quota
+	if deps.Sandbox = os.Getenv("INTEGRATION_SANDBOX") == "true"; deps.Sandbox {
+		if deps.Weather, err = sandboxWeather(weatherProvider); err != nil {
+			slog.Error("Invalid integration sandbox config", "error", err)
+			return
+		}
+		slog.Warn("Integration sandbox enabled, outbound node calls are served by fakes")
+	} else {
+		if mode, ok := os.LookupEnv("VCR_MODE"); ok {
+			dir := os.Getenv("VCR_DIR")
+			if dir == "" {
+				dir = "fixtures/vcr"
+			}
+			transport, err := vcr.NewTransport(vcr.Mode(mode), dir)
+			if err != nil {
+				slog.Error("Invalid VCR_MODE", "error", err)
+				return
+			}
+			httpClient = &http.Client{Transport: transport, Timeout: 10 * time.Second}
+			fixtures = transport
+			slog.Warn("Outbound HTTP is recorded or replayed", "mode", mode, "dir", transport.Dir)
+		}
+		if weatherQuota, err = openMeteoQuota(pool); err != nil {
+			slog.Error("Invalid Open-Meteo API key config", "error", err)
+			return
+		}
+		if deps.Weather, err = weather.NewDefaultFailover(weatherProvider, httpClient, weatherQuota); err != nil {
+			slog.Error("Invalid WEATHER_PROVIDER", "error", err)
+			return
+		}
+		openMeteoGeocoder := weather.NewOpenMeteoGeocoder()
+		if httpClient != nil {
+			openMeteoGeocoder.HTTPClient = httpClient
+		}
+		geocoder = openMeteoGeocoder
+		if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+			deps.Email = email.NewSMTPClient(addr, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+			if webURL := os.Getenv("SMTP_WEB_URL"); webURL != "" {
+				slog.Info("Emails are delivered over SMTP", "addr", addr, "inbox", webURL)
+			} else {
+				slog.Info("Emails are delivered over SMTP", "addr", addr)
+			}
+		}
+		deps.Jira, deps.GitHub = issueClients(httpClient)
+		deps.PagerDuty, deps.Opsgenie = incidentClients(httpClient)
+		deps.Saga = saga.NewHTTPClient()
+		if httpClient != nil {
+			deps.Saga = &saga.HTTPClient{HTTPClient: httpClient}
+		}
+		if path, ok := os.LookupEnv("GOOGLE_SHEETS_CREDENTIALS_FILE"); ok {
+			client, err := sheets.LoadServiceAccount(path)
+			if err != nil {
+				slog.Error("Invalid GOOGLE_SHEETS_CREDENTIALS_FILE", "error", err)
+				return
+			}
+			if httpClient != nil {
+				client.HTTPClient = httpClient
+			}
+			deps.Sheets = client
+		}
+	}
+
+	mqttClient, err := mqttBroker()
+	if err != nil {
+		slog.Error("Invalid MQTT_BROKER_URL", "error", err)
+		return
+	}
+	if mqttClient != nil && !deps.Sandbox {
+		deps.MQTT = mqttClient
+	}
+
+	deps.Cities = weather.NewMemoryCatalog(weather.DefaultCities...)
+	deps.Lists = email.NewMemoryLists()
+	if pool != nil {
+		deps.Lists = email.NewPostgresLists(pool)
+		deps.Dedupe = dedupe.NewPostgresStore(pool)
+		deps.State = statestore.NewPostgresStore(pool)
+		deps.Cities = weather.NewCachedCatalog(weather.NewPostgresCatalog(pool), weather.DefaultCatalogTTL)
+	}
+	if path, ok := os.LookupEnv("QUERIES_FILE"); ok {
+		if pool == nil {
+			slog.Error("QUERIES_FILE needs PostgreSQL storage")
+			return
+		}
+		catalog, err := sqlquery.LoadFile(path, pool)
+		if err != nil {
+			slog.Error("Invalid QUERIES_FILE", "error", err)
+			return
+		}
+		deps.Queries = catalog
+		slog.Info("Loaded SQL queries", "count", catalog.Len())
+	}
+
+	registry := engine.NewRegistry()
+	nodehandlers.RegisterDefaults(registry, deps)
+
+	var environments []string
+	if path, ok := os.LookupEnv("ENVIRONMENTS_FILE"); ok {
+		if environments, err = loadEnvironments(path, registry, weatherProvider, httpClient, weatherQuota, deps.Cities, outbox, deps.Lists); err != nil {
+			slog.Error("Invalid ENVIRONMENTS_FILE", "error", err)
+			return
+		}
+		slog.Info("Loaded execution environments", "environments", environments)
+	}
+
+	var shareSigner *sharelink.Signer
+	if key, ok := os.LookupEnv("SHARE_LINK_SECRET"); ok {
+		shareSigner = sharelink.NewSigner([]byte(key))
+	} else {
+		slog.Warn("SHARE_LINK_SECRET is not set, execution share links will not survive restarts")
+		if shareSigner, err = sharelink.NewRandomSigner(); err != nil {
+			slog.Error("Failed to create share link signer", "error", err)
+			return
+		}
+	}
+
+	timeouts := workflow.DefaultTimeouts
+	if timeouts.Default, err = durationEnv("REQUEST_TIMEOUT", timeouts.Default); err != nil {
+		slog.Error("Invalid REQUEST_TIMEOUT", "error", err)
+		return
+	}
+	if timeouts.Execute, err = durationEnv("EXECUTE_TIMEOUT", timeouts.Execute); err != nil {
+		slog.Error("Invalid EXECUTE_TIMEOUT", "error", err)
+		return
+	}
+
+	workers, err := poolOptions()
+	if err != nil {
+		slog.Error("Invalid worker pool config", "error", err)
+		return
+	}
+	events := engine.NewEventBus()
+	inProcess := engine.NewExecutor(registry).WithPool(workers).WithEvents(events)
+	if path, ok := os.LookupEnv("FAULTS_FILE"); ok {
+		if os.Getenv("DEV_MODE") != "true" {
+			slog.Error("FAULTS_FILE needs DEV_MODE=true")
+			return
+		}
+		config, err := faults.LoadFile(path)
+		if err != nil {
+			slog.Error("Invalid FAULTS_FILE", "error", err)
+			return
+		}
+		inProcess.Use(faults.NewInjector(config).Middleware)
+		slog.Warn("Fault injection enabled, nodes fail and slow down at random", "nodeTypes", slices.Sorted(maps.Keys(config.NodeTypes)), "seed", config.Seed)
+	}
+	slog.Info("Async worker pool", "min", workers.MinWorkers, "max", workers.MaxWorkers, "idleTimeout", workers.IdleTimeout)
+	var executor engine.Engine = inProcess
+	switch backend := os.Getenv("EXECUTION_BACKEND"); backend {
+	case "", "memory":
+	case "durable":
+		if pool == nil {
+			slog.Error("EXECUTION_BACKEND=durable needs PostgreSQL storage")
+			return
+		}
+		executor = durable.New(inProcess, durable.NewPostgresStore(pool))
+	default:
+		slog.Error("Invalid EXECUTION_BACKEND, expected memory or durable", "backend", backend)
+		return
+	}
+
+	workflowService, err := workflow.NewService(pool, executor, append(repoOpt,
+		workflow.WithDispatcher(callback.NewDispatcher()),
+		workflow.WithShareLinks(shareSigner, os.Getenv("PUBLIC_URL")),
+		workflow.WithTimeouts(timeouts),
+		workflow.WithHandlerVariants(registry.Variants()),
+		workflow.WithHandlerVersions(registry.HandlerVersions()),
+		workflow.WithOutputSchemas(registry.OutputSchemas()),
+		workflow.WithEnvironments(environments),
+		workflow.WithCities(deps.Cities),
+		workflow.WithDistributionLists(deps.Lists),
+		workflow.WithGeocoder(geocoder),
+		workflow.WithOutbox(outbox),
+		workflow.WithFixtures(fixtures),
+		workflow.WithDevMode(os.Getenv("DEV_MODE") == "true"),
+		workflow.WithWeatherUsage(weatherUsage(weatherQuota)),
+		workflow.WithEventBus(events),
+	)...)
 	if err != nil {
 		slog.Error("Failed to create workflow service", "error", err)
 		return
 	}
 
+	warm, err := intEnv("WARM_GRAPHS", workflow.DefaultWarmGraphs)
+	if err == nil && warm < 0 {
+		err = fmt.Errorf("WARM_GRAPHS can't be negative")
+	}
+	if err != nil {
+		slog.Error("Invalid WARM_GRAPHS", "error", err)
+		return
+	}
+	if n, err := workflowService.WarmGraphs(ctx, warm); err != nil {
+		slog.Error("Failed to compile workflows", "error", err)
+	} else {
+		slog.Info("Compiled workflows", "count", n)
+	}
+
+	if n, err := workflowService.ResumeExecutions(ctx); err != nil {
+		slog.Error("Failed to resume executions", "error", err)
+	} else if n > 0 {
+		slog.Info("Resumed interrupted executions", "count", n)
+	}
+
+	supervise := engine.DefaultSuperviseOptions
+	if supervise.Interval, err = durationEnv("WORKER_HEARTBEAT_INTERVAL", supervise.Interval); err != nil {
+		slog.Error("Invalid WORKER_HEARTBEAT_INTERVAL", "error", err)
+		return
+	}
+	if supervise.StaleAfter, err = durationEnv("WORKER_STALE_AFTER", supervise.StaleAfter); err != nil {
+		slog.Error("Invalid WORKER_STALE_AFTER", "error", err)
+		return
+	}
+	if supervise.Interval <= 0 || supervise.StaleAfter <= supervise.Interval {
+		slog.Error("WORKER_STALE_AFTER must be longer than a positive WORKER_HEARTBEAT_INTERVAL",
+			"interval", supervise.Interval, "staleAfter", supervise.StaleAfter)
+		return
+	}
+	supervise.Requeue = os.Getenv("REQUEUE_STALLED_RUNS") == "true"
+
+	superviseCtx, stopSupervising := context.WithCancel(ctx)
+	defer stopSupervising()
+	if workflowService.SuperviseExecutions(superviseCtx, supervise) {
+		slog.Info("Supervising async runs", "interval", supervise.Interval,
+			"staleAfter", supervise.StaleAfter, "requeue", supervise.Requeue)
+	}
+
+	timers := workflow.DefaultTimerOptions
+	if timers.Interval, err = durationEnv("TIMER_POLL_INTERVAL", timers.Interval); err != nil || timers.Interval <= 0 {
+		slog.Error("Invalid TIMER_POLL_INTERVAL, expected a positive duration", "error", err)
+		return
+	}
+	go workflowService.RunTimers(superviseCtx, timers)
+
+	if path, ok := os.LookupEnv("MQTT_TRIGGERS_FILE"); ok {
+		if mqttClient == nil {
+			slog.Error("MQTT_TRIGGERS_FILE needs MQTT_BROKER_URL")
+			return
+		}
+		triggers, err := workflow.LoadMQTTTriggers(path)
+		if err == nil {
+			err = workflowService.SubscribeMQTT(mqttClient, triggers)
+		}
+		if err != nil {
+			slog.Error("Invalid MQTT_TRIGGERS_FILE", "error", err)
+			return
+		}
+		slog.Info("Loaded MQTT triggers", "count", len(triggers))
+	}
+	if mqttClient != nil {
+		go mqttClient.Run(superviseCtx)
+	}
+
 	workflowService.LoadRoutes(apiRouter)
 
 	corsHandler := handlers.CORS(
@@ -88,3 +401,166 @@ func main() {
 		}
 	}
 }
+
+// issueClients returns the Jira and GitHub clients configured by JIRA_URL,
+// JIRA_EMAIL and JIRA_API_TOKEN and by GITHUB_TOKEN. Trackers that aren't
+// configured are left nil so issue nodes only log their issues.
+func issueClients(httpClient *http.Client) (jira, github issues.Client) {
+	if url, token := os.Getenv("JIRA_URL"), os.Getenv("JIRA_API_TOKEN"); url != "" && token != "" {
+		c := issues.NewJiraClient(url, os.Getenv("JIRA_EMAIL"), token)
+		if httpClient != nil {
+			c.HTTPClient = httpClient
+		}
+		jira = c
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		c := issues.NewGitHubClient(token)
+		if url := os.Getenv("GITHUB_API_URL"); url != "" {
+			c.BaseURL = url
+		}
+		if httpClient != nil {
+			c.HTTPClient = httpClient
+		}
+		github = c
+	}
+	return jira, github
+}
+
+// incidentClients returns the PagerDuty and Opsgenie clients configured by
+// PAGERDUTY_ROUTING_KEY and by OPSGENIE_API_KEY, which are expected to come
+// from the deployment's secrets. Providers that aren't configured are left
+// nil so incident nodes only log their incidents.
+func incidentClients(httpClient *http.Client) (pagerDuty, opsgenie incidents.Client) {
+	if key := os.Getenv("PAGERDUTY_ROUTING_KEY"); key != "" {
+		c := incidents.NewPagerDutyClient(key)
+		if httpClient != nil {
+			c.HTTPClient = httpClient
+		}
+		pagerDuty = c
+	}
+	if key := os.Getenv("OPSGENIE_API_KEY"); key != "" {
+		c := incidents.NewOpsgenieClient(key)
+		if url := os.Getenv("OPSGENIE_API_URL"); url != "" {
+			c.BaseURL = url
+		}
+		if httpClient != nil {
+			c.HTTPClient = httpClient
+		}
+		opsgenie = c
+	}
+	return pagerDuty, opsgenie
+}
+
+// openMeteoQuota returns the Open-Meteo API key set by OPEN_METEO_API_KEY
+// and its OPEN_METEO_DAILY_QUOTA, counting calls in the database when there is
+// one. It returns nil without a key.
+func openMeteoQuota(pool *pgxpool.Pool) (*weather.Quota, error) {
+	key := os.Getenv("OPEN_METEO_API_KEY")
+	if key == "" {
+		return nil, nil
+	}
+	quota, err := intEnv("OPEN_METEO_DAILY_QUOTA", 0)
+	if err != nil {
+		return nil, err
+	}
+	if quota < 0 {
+		return nil, fmt.Errorf("OPEN_METEO_DAILY_QUOTA must not be negative")
+	}
+	var store weather.UsageStore = weather.NewMemoryUsage()
+	if pool != nil {
+		store = weather.NewPostgresUsage(pool)
+	}
+	slog.Info("Open-Meteo calls use the commercial API", "keyId", weather.KeyID(key), "dailyQuota", quota)
+	return &weather.Quota{APIKey: key, DailyQuota: quota, Store: store}, nil
+}
+
+// weatherUsage returns where quota counts calls, if there is a quota.
+func weatherUsage(quota *weather.Quota) weather.UsageStore {
+	if quota == nil {
+		return nil
+	}
+	return quota.Store
+}
+
+// durationEnv parses an environment variable such as "30s", returning def when
+// it is not set.
+func durationEnv(key string, def time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// intEnv returns the integer value of the environment variable key, or def
+// if it isn't set.
+func intEnv(key string, def int) (int, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q is not an integer", key, v)
+	}
+	return n, nil
+}
+
+// poolOptions returns the sizing of the async worker pool set by WORKERS_MIN,
+// WORKERS_MAX and WORKER_IDLE_TIMEOUT.
+func poolOptions() (engine.PoolOptions, error) {
+	opts := engine.DefaultPoolOptions
+	var err error
+	if opts.MinWorkers, err = intEnv("WORKERS_MIN", opts.MinWorkers); err != nil {
+		return opts, err
+	}
+	if opts.MaxWorkers, err = intEnv("WORKERS_MAX", opts.MaxWorkers); err != nil {
+		return opts, err
+	}
+	if opts.IdleTimeout, err = durationEnv("WORKER_IDLE_TIMEOUT", opts.IdleTimeout); err != nil {
+		return opts, fmt.Errorf("WORKER_IDLE_TIMEOUT: %w", err)
+	}
+	switch {
+	case opts.MinWorkers < 0 || opts.MaxWorkers < 0:
+		return opts, fmt.Errorf("WORKERS_MIN and WORKERS_MAX can't be negative")
+	case opts.MaxWorkers > 0 && opts.MinWorkers > opts.MaxWorkers:
+		return opts, fmt.Errorf("WORKERS_MIN (%d) is above WORKERS_MAX (%d)", opts.MinWorkers, opts.MaxWorkers)
+	case opts.IdleTimeout <= 0:
+		return opts, fmt.Errorf("WORKER_IDLE_TIMEOUT must be positive")
+	}
+	return opts, nil
+}
+
+// mqttBroker returns the client of the broker at MQTT_BROKER_URL,
+// authenticated with MQTT_USERNAME and MQTT_PASSWORD, or nil if it isn't set.
+func mqttBroker() (*mqtt.Client, error) {
+	broker := os.Getenv("MQTT_BROKER_URL")
+	if broker == "" {
+		return nil, nil
+	}
+	return mqtt.NewClient(mqtt.Options{
+		Broker:   broker,
+		ClientID: os.Getenv("MQTT_CLIENT_ID"),
+		Username: os.Getenv("MQTT_USERNAME"),
+		Password: os.Getenv("MQTT_PASSWORD"),
+	})
+}
+
+// sandboxWeather returns the weather client used in the integration sandbox:
+// the real providers replaying fixture files from SANDBOX_FIXTURES when set,
+// otherwise a fixed SANDBOX_TEMPERATURE.
+func sandboxWeather(provider string) (weather.Client, error) {
+	if dir := os.Getenv("SANDBOX_FIXTURES"); dir != "" {
+		return weather.NewDefaultFailover(provider, &http.Client{Transport: &sandbox.Transport{Dir: dir}}, nil)
+	}
+
+	temperature := sandbox.DefaultTemperature
+	if v, ok := os.LookupEnv("SANDBOX_TEMPERATURE"); ok {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("SANDBOX_TEMPERATURE: %w", err)
+		}
+		temperature = t
+	}
+	return sandbox.NewWeatherClient(temperature), nil
+}
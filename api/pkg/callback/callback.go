@@ -0,0 +1,111 @@
+package callback
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Lifecycle events delivered to hooks.
+const (
+	EventStarted   = "started"
+	EventCompleted = "completed"
+	EventFailed    = "failed"
+
+	// EventAnomaly is sent when a step took far longer or shorter than usual.
+	EventAnomaly = "anomaly"
+)
+
+// Events lists every event a hook can subscribe to.
+var Events = []string{EventStarted, EventCompleted, EventFailed, EventAnomaly}
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body,
+// keyed with the hook secret.
+const SignatureHeader = "X-Workflow-Signature"
+
+// Target is a URL an event is delivered to.
+type Target struct {
+	URL    string
+	Secret string
+}
+
+// Event is the JSON payload posted to hook URLs.
+type Event struct {
+	Event       string    `json:"event"`
+	WorkflowID  string    `json:"workflowId"`
+	ExecutionID string    `json:"executionId"`
+	Status      string    `json:"status,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Dispatcher posts lifecycle events to hook URLs in the background.
+type Dispatcher struct {
+	client *http.Client
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Dispatch delivers event to every target without blocking the caller.
+// Delivery failures are logged.
+func (d *Dispatcher) Dispatch(event Event, targets []Target) {
+	if len(targets) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Failed to encode callback event", "error", err)
+		return
+	}
+
+	for _, t := range targets {
+		go func(t Target) {
+			if err := d.deliver(t, body); err != nil {
+				slog.Warn("Callback delivery failed", "url", t.URL, "event", event.Event,
+					"executionId", event.ExecutionID, "error", err)
+			}
+		}(t)
+	}
+}
+
+func (d *Dispatcher) deliver(t Target, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(t.Secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the signature sent in SignatureHeader for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
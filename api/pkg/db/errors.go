@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Error categories returned by Classify. Repositories wrap driver errors with
+// them so callers can react without depending on pgx.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrConstraint = errors.New("constraint violation")
+)
+
+// PostgreSQL error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	codeUniqueViolation      = "23505"
+	codeForeignKeyViolation  = "23503"
+	codeNotNullViolation     = "23502"
+	codeCheckViolation       = "23514"
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+)
+
+// Classify wraps a database error with one of the error categories above. The
+// original error stays in the chain. Errors that don't fit a category are
+// returned unchanged.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case codeUniqueViolation:
+		return fmt.Errorf("%w (%s): %w", ErrConflict, pgErr.ConstraintName, err)
+	case codeForeignKeyViolation, codeNotNullViolation, codeCheckViolation:
+		return fmt.Errorf("%w (%s): %w", ErrConstraint, pgErr.ConstraintName, err)
+	}
+	return err
+}
+
+// IsRetryable reports whether the transaction that produced err can be retried
+// as a whole.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == codeSerializationFailure || pgErr.Code == codeDeadlockDetected
+}
+
+const (
+	maxTxAttempts  = 3
+	txRetryBackoff = 50 * time.Millisecond
+)
+
+// InTx runs fn in a transaction, retrying the whole transaction on
+// serialization failures and deadlocks. The returned error is classified.
+func InTx(ctx context.Context, pool *pgxpool.Pool, fn func(tx pgx.Tx) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = pgx.BeginFunc(ctx, pool, fn)
+		if err == nil || !IsRetryable(err) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * txRetryBackoff):
+		}
+	}
+	return Classify(err)
+}
@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS workflows (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        TEXT NOT NULL,
+    version     INTEGER NOT NULL DEFAULT 1,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS nodes (
+    workflow_id UUID NOT NULL REFERENCES workflows (id) ON DELETE CASCADE,
+    node_id     TEXT NOT NULL,
+    type        TEXT NOT NULL,
+    label       TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    x_pos       DOUBLE PRECISION NOT NULL DEFAULT 0,
+    y_pos       DOUBLE PRECISION NOT NULL DEFAULT 0,
+    metadata    JSONB NOT NULL DEFAULT '{}',
+    PRIMARY KEY (workflow_id, node_id)
+);
+
+CREATE TABLE IF NOT EXISTS edges (
+    workflow_id   UUID NOT NULL REFERENCES workflows (id) ON DELETE CASCADE,
+    edge_id       TEXT NOT NULL,
+    source        TEXT NOT NULL,
+    target        TEXT NOT NULL,
+    source_handle TEXT,
+    edge_props    JSONB NOT NULL DEFAULT '{}',
+    PRIMARY KEY (workflow_id, edge_id),
+    FOREIGN KEY (workflow_id, source) REFERENCES nodes (workflow_id, node_id) ON DELETE CASCADE,
+    FOREIGN KEY (workflow_id, target) REFERENCES nodes (workflow_id, node_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS executions (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workflow_id     UUID NOT NULL REFERENCES workflows (id),
+    status          TEXT NOT NULL,
+    executed_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    input           JSONB NOT NULL DEFAULT '{}',
+    final_context   JSONB NOT NULL DEFAULT '{}',
+    execution_trace JSONB NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX IF NOT EXISTS executions_workflow_id_idx ON executions (workflow_id, executed_at DESC);
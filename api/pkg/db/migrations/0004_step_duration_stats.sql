@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS step_duration_stats (
+    workflow_id UUID NOT NULL REFERENCES workflows (id) ON DELETE CASCADE,
+    node_id     TEXT NOT NULL,
+    samples     BIGINT NOT NULL DEFAULT 0,
+    mean_ms     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    m2          DOUBLE PRECISION NOT NULL DEFAULT 0,
+    min_ms      BIGINT NOT NULL DEFAULT 0,
+    max_ms      BIGINT NOT NULL DEFAULT 0,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (workflow_id, node_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
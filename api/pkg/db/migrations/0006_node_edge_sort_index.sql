@@ -0,0 +1,21 @@
+-- Nodes and edges are returned in sort_index order so responses are stable
+-- between calls. Existing nodes are numbered left to right by their canvas
+-- position, existing edges by id.
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS sort_index INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE edges ADD COLUMN IF NOT EXISTS sort_index INTEGER NOT NULL DEFAULT 0;
+
+UPDATE nodes n
+SET sort_index = o.idx
+FROM (
+    SELECT workflow_id, node_id, row_number() OVER (PARTITION BY workflow_id ORDER BY x_pos, y_pos, node_id) - 1 AS idx
+    FROM nodes
+) o
+WHERE n.workflow_id = o.workflow_id AND n.node_id = o.node_id;
+
+UPDATE edges e
+SET sort_index = o.idx
+FROM (
+    SELECT workflow_id, edge_id, row_number() OVER (PARTITION BY workflow_id ORDER BY edge_id) - 1 AS idx
+    FROM edges
+) o
+WHERE e.workflow_id = o.workflow_id AND e.edge_id = o.edge_id;
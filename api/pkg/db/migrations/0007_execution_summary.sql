@@ -0,0 +1,3 @@
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS triggered_by TEXT NOT NULL DEFAULT 'api';
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS workflow_version INTEGER;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS failed_node_type TEXT;
@@ -0,0 +1,19 @@
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS started_at TIMESTAMPTZ;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS finished_at TIMESTAMPTZ;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS duration_ms BIGINT;
+
+-- Older executions only have executed_at and the per-step durations in the
+-- trace; derive the timing from those.
+UPDATE executions
+SET started_at = executed_at,
+    duration_ms = (SELECT COALESCE(SUM((step->>'durationMs')::bigint), 0)
+                   FROM jsonb_array_elements(execution_trace) AS step)
+WHERE started_at IS NULL;
+
+UPDATE executions
+SET finished_at = started_at + duration_ms * INTERVAL '1 millisecond'
+WHERE finished_at IS NULL;
+
+ALTER TABLE executions ALTER COLUMN started_at SET NOT NULL;
+ALTER TABLE executions ALTER COLUMN finished_at SET NOT NULL;
+ALTER TABLE executions ALTER COLUMN duration_ms SET NOT NULL;
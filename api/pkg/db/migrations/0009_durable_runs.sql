@@ -0,0 +1,12 @@
+-- Progress of async runs on the durable execution backend. A row exists while
+-- the run is in progress and is removed once it finishes.
+CREATE TABLE IF NOT EXISTS durable_runs (
+    execution_id UUID PRIMARY KEY,
+    labels       JSONB NOT NULL DEFAULT '{}',
+    nodes        JSONB NOT NULL,
+    edges        JSONB NOT NULL,
+    input        JSONB NOT NULL DEFAULT '{}',
+    checkpoint   JSONB,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
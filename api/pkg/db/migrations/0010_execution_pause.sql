@@ -0,0 +1,4 @@
+-- Paused executions keep the checkpoint to resume from and a description of
+-- the input they are waiting for.
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS checkpoint JSONB;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS pending_input JSONB;
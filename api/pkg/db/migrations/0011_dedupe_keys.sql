@@ -0,0 +1,5 @@
+-- Keys claimed by dedupe nodes, kept until they expire.
+CREATE TABLE IF NOT EXISTS dedupe_keys (
+    key        TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Metadata defaults nodes inherit, keyed by node type ("*" for all nodes).
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS defaults JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,2 @@
+-- Nodes placed inside a group frame reference it by node id.
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS parent_id TEXT;
@@ -0,0 +1,16 @@
+-- One row per step so long traces can be paged and filtered without decoding
+-- execution_trace, which still holds the full trace for resuming.
+CREATE TABLE IF NOT EXISTS execution_steps (
+    execution_id UUID NOT NULL REFERENCES executions (id) ON DELETE CASCADE,
+    seq          INTEGER NOT NULL,
+    node_id      TEXT NOT NULL,
+    node_type    TEXT NOT NULL,
+    status       TEXT NOT NULL,
+    step         JSONB NOT NULL,
+    PRIMARY KEY (execution_id, seq)
+);
+
+INSERT INTO execution_steps (execution_id, seq, node_id, node_type, status, step)
+SELECT e.id, t.ord - 1, t.step->>'nodeId', t.step->>'type', t.step->>'status', t.step
+FROM executions e, jsonb_array_elements(e.execution_trace) WITH ORDINALITY AS t(step, ord)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+-- Workers heartbeat the durable runs they execute. A run whose heartbeat went
+-- stale is marked stalled until a worker takes it over.
+ALTER TABLE durable_runs ADD COLUMN IF NOT EXISTS worker_id TEXT;
+ALTER TABLE durable_runs ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMPTZ;
+ALTER TABLE durable_runs ADD COLUMN IF NOT EXISTS stalled_at TIMESTAMPTZ;
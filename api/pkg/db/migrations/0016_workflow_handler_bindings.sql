@@ -0,0 +1,8 @@
+-- Per-workflow choice of handler variant for a node type, e.g. the sandbox
+-- email handler for one workflow only.
+CREATE TABLE IF NOT EXISTS workflow_handler_bindings (
+    workflow_id UUID NOT NULL REFERENCES workflows (id) ON DELETE CASCADE,
+    node_type   TEXT NOT NULL,
+    variant     TEXT NOT NULL,
+    PRIMARY KEY (workflow_id, node_type)
+);
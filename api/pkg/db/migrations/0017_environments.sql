@@ -0,0 +1,4 @@
+-- The environment a workflow runs in unless an execution picks another, and
+-- the environment each execution ran in. NULL means the process defaults.
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS environment TEXT;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS environment TEXT;
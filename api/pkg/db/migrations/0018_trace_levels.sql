@@ -0,0 +1,4 @@
+-- How much of each execution's trace is stored: full, summary or errors-only.
+-- NULL means full.
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS trace_level TEXT;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS trace_level TEXT;
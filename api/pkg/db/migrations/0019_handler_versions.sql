@@ -0,0 +1,3 @@
+-- Major handler version each node type of a workflow is pinned to, e.g.
+-- {"email": 1}. NULL pins nothing.
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS handler_versions JSONB;
@@ -0,0 +1,13 @@
+-- Counters of counter nodes. NULL expires_at never expires.
+CREATE TABLE IF NOT EXISTS state_counters (
+    key        TEXT PRIMARY KEY,
+    value      BIGINT NOT NULL,
+    expires_at TIMESTAMPTZ
+);
+
+-- Values stored by kvstore nodes.
+CREATE TABLE IF NOT EXISTS state_values (
+    key        TEXT PRIMARY KEY,
+    value      JSONB NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS webhook_receivers (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workflow_id  UUID NOT NULL REFERENCES workflows (id) ON DELETE CASCADE,
+    content_type TEXT NOT NULL DEFAULT '',
+    mappings     JSONB NOT NULL DEFAULT '{}',
+    secret       TEXT NOT NULL DEFAULT '',
+    enabled      BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_receivers_workflow_idx ON webhook_receivers (workflow_id);
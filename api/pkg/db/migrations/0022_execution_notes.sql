@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS execution_notes (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    execution_id UUID NOT NULL REFERENCES executions (id) ON DELETE CASCADE,
+    author       TEXT NOT NULL,
+    body         TEXT NOT NULL,
+    resolution   TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS execution_notes_execution_idx ON execution_notes (execution_id, created_at);
+
+-- The manual resolution status last set by a note, NULL while open.
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS resolution TEXT;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS resolved_by TEXT;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMPTZ;
@@ -0,0 +1,35 @@
+-- Sample saga: book a room, notify the guest, then confirm the booking. If
+-- notifying or confirming fails the reservation is cancelled.
+INSERT INTO workflows (id, name) VALUES
+    ('7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37', 'Room Booking Saga')
+ON CONFLICT (id) DO NOTHING;
+
+INSERT INTO nodes (workflow_id, node_id, type, label, description, x_pos, y_pos, metadata, sort_index) VALUES
+    ('7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37', 'start', 'start', 'Start', 'Begin room booking', -160, 300,
+     '{"hasHandles": {"source": true, "target": false}}', 0),
+    ('7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37', 'form', 'form', 'Booking Request', 'Collect guest name, email and room', 152, 304,
+     '{"hasHandles": {"source": true, "target": true}, "inputFields": ["name", "email", "room"], "outputVariables": ["name", "email", "room"]}', 1),
+    ('7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37', 'reserve', 'saga_reserve', 'Reserve Room', 'Hold room {{room}}', 460, 304,
+     '{"hasHandles": {"source": true, "target": true}, "url": "https://bookings.example.com/reservations", "inputVariables": ["name", "room"], "outputVariables": ["reservationId"], "compensateWith": "cancel"}', 2),
+    ('7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37', 'notify', 'email', 'Notify Guest', 'Tell {{name}} the room is held', 794, 304,
+     '{"hasHandles": {"source": true, "target": true}, "inputVariables": ["name", "room", "reservationId"], "emailTemplate": {"subject": "Room {{room}} is held for you", "body": "Hi {{name}}, room {{room}} is held under booking {{reservationId}}."}, "outputVariables": ["emailSent"]}', 3),
+    ('7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37', 'confirm', 'saga_confirm', 'Confirm Booking', 'Confirm booking {{reservationId}}', 1096, 304,
+     '{"hasHandles": {"source": true, "target": true}, "url": "https://bookings.example.com/reservations/{{reservationId}}/confirm"}', 4),
+    ('7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37', 'cancel', 'saga_cancel', 'Cancel Booking', 'Release booking {{reservationId}}', 460, 520,
+     '{"hasHandles": {"source": false, "target": false}, "url": "https://bookings.example.com/reservations/{{reservationId}}"}', 5),
+    ('7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37', 'end', 'end', 'Complete', 'Room booked', 1360, 302,
+     '{"hasHandles": {"source": false, "target": true}}', 6)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO edges (workflow_id, edge_id, source, target, source_handle, edge_props, sort_index) VALUES
+    ('7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37', 'e1', 'start', 'form', NULL,
+     '{"type": "smoothstep", "animated": true, "label": "Initialize"}', 0),
+    ('7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37', 'e2', 'form', 'reserve', NULL,
+     '{"type": "smoothstep", "animated": true, "label": "Submit Request"}', 1),
+    ('7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37', 'e3', 'reserve', 'notify', NULL,
+     '{"type": "smoothstep", "animated": true, "label": "Room Held"}', 2),
+    ('7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37', 'e4', 'notify', 'confirm', NULL,
+     '{"type": "smoothstep", "animated": true, "label": "Guest Notified"}', 3),
+    ('7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37', 'e5', 'confirm', 'end', NULL,
+     '{"type": "smoothstep", "animated": true, "label": "Booked"}', 4)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,21 @@
+-- Cities the integration node can look up. Names are unique ignoring case.
+CREATE TABLE IF NOT EXISTS cities (
+    name       TEXT PRIMARY KEY,
+    lat        DOUBLE PRECISION NOT NULL CHECK (lat BETWEEN -90 AND 90),
+    lon        DOUBLE PRECISION NOT NULL CHECK (lon BETWEEN -180 AND 180),
+    timezone   TEXT NOT NULL DEFAULT '',
+    enabled    BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS cities_lower_name_idx ON cities (lower(name));
+
+-- The cities that used to be compiled into the API.
+INSERT INTO cities (name, lat, lon, timezone) VALUES
+    ('Sydney', -33.8688, 151.2093, 'Australia/Sydney'),
+    ('Melbourne', -37.8136, 144.9631, 'Australia/Melbourne'),
+    ('Brisbane', -27.4698, 153.0251, 'Australia/Brisbane'),
+    ('Perth', -31.9505, 115.8605, 'Australia/Perth'),
+    ('Adelaide', -34.9285, 138.6007, 'Australia/Adelaide')
+ON CONFLICT DO NOTHING;
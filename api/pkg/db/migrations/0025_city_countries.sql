@@ -0,0 +1,20 @@
+-- Cities are told apart by country, e.g. Melbourne, AU and Melbourne, US, and
+-- may carry the geocoder's id of the place. '' is a city without a country.
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS country TEXT NOT NULL DEFAULT '';
+ALTER TABLE cities ADD COLUMN IF NOT EXISTS place_id TEXT NOT NULL DEFAULT '';
+
+UPDATE cities SET country = 'AU', place_id = v.place_id
+FROM (VALUES
+    ('Sydney', 'geonames:2147714'),
+    ('Melbourne', 'geonames:2158177'),
+    ('Brisbane', 'geonames:2174003'),
+    ('Perth', 'geonames:2063523'),
+    ('Adelaide', 'geonames:2078025')
+) AS v (name, place_id)
+WHERE cities.name = v.name AND cities.country = '';
+
+ALTER TABLE cities DROP CONSTRAINT IF EXISTS cities_pkey;
+DROP INDEX IF EXISTS cities_lower_name_idx;
+ALTER TABLE cities ADD CONSTRAINT cities_pkey PRIMARY KEY (name, country);
+CREATE UNIQUE INDEX IF NOT EXISTS cities_lower_name_country_idx ON cities (lower(name), country);
+CREATE UNIQUE INDEX IF NOT EXISTS cities_place_id_idx ON cities (place_id) WHERE place_id <> '';
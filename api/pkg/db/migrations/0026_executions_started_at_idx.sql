@@ -0,0 +1,2 @@
+-- Execution rates scan the executions of all workflows by start time.
+CREATE INDEX IF NOT EXISTS executions_started_at_idx ON executions (started_at);
@@ -0,0 +1,8 @@
+-- Named groups of addresses email nodes can send to.
+CREATE TABLE IF NOT EXISTS distribution_lists (
+    name        TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    addresses   TEXT[] NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
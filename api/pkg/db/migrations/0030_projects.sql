@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS projects (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name       TEXT NOT NULL UNIQUE,
+    team       TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Workflows outside any project have no project_id.
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS project_id UUID REFERENCES projects (id);
+
+CREATE INDEX IF NOT EXISTS workflows_project_idx ON workflows (project_id);
+
+-- Transfers outlive the projects they name, so those are not foreign keys.
+CREATE TABLE IF NOT EXISTS workflow_transfers (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workflow_id     UUID NOT NULL REFERENCES workflows (id) ON DELETE CASCADE,
+    from_project_id UUID,
+    to_project_id   UUID NOT NULL,
+    author          TEXT NOT NULL,
+    reason          TEXT NOT NULL DEFAULT '',
+    transferred_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS workflow_transfers_from_idx ON workflow_transfers (from_project_id, transferred_at);
+CREATE INDEX IF NOT EXISTS workflow_transfers_to_idx ON workflow_transfers (to_project_id, transferred_at);
@@ -0,0 +1,11 @@
+-- Calls made with each weather API key per UTC day. Keys are identified by a
+-- hash prefix, never stored themselves.
+CREATE TABLE IF NOT EXISTS weather_api_usage (
+    provider TEXT    NOT NULL,
+    key_id   TEXT    NOT NULL,
+    day      DATE    NOT NULL,
+    calls    INTEGER NOT NULL DEFAULT 0,
+    rejected INTEGER NOT NULL DEFAULT 0,
+    quota    INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (provider, key_id, day)
+);
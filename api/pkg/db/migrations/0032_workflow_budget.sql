@@ -0,0 +1,3 @@
+-- What each execution of a workflow may consume, e.g.
+-- {"notifications": 10, "onExceeded": "skip"}. NULL limits nothing.
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS budget JSONB;
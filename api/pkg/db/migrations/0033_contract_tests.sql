@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS contract_tests (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workflow_id UUID NOT NULL REFERENCES workflows (id) ON DELETE CASCADE,
+    name        TEXT NOT NULL,
+    form_data   JSONB NOT NULL,
+    condition   JSONB,
+    temperature DOUBLE PRECISION,
+    expect      JSONB NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (workflow_id, name)
+);
@@ -0,0 +1,2 @@
+-- The CSS style the editor draws a node with, part of the workflow's layout.
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS style JSONB NOT NULL DEFAULT '{}';
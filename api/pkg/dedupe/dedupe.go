@@ -0,0 +1,80 @@
+// Package dedupe remembers keys for a limited time so repeated events, such as
+// the same alert to the same person on the same day, can be detected.
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"workflow-code-test/api/pkg/db"
+)
+
+// Store records claimed keys.
+type Store interface {
+	// Claim records key for ttl. It reports false if the key was already
+	// claimed and hasn't expired yet.
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// MemoryStore keeps keys in process.
+type MemoryStore struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{expires: make(map[string]time.Time), now: time.Now}
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if exp, ok := s.expires[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	for k, exp := range s.expires {
+		if !now.Before(exp) {
+			delete(s.expires, k)
+		}
+	}
+	s.expires[key] = now.Add(ttl)
+	return true, nil
+}
+
+// PostgresStore keeps keys in the dedupe_keys table so they are shared by all
+// API instances and survive restarts.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+func (s *PostgresStore) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	// An expired key is claimed again by the conflict clause; a live one
+	// leaves the row untouched and returns nothing.
+	var claimed string
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO dedupe_keys (key, expires_at)
+		VALUES ($1, now() + make_interval(secs => $2))
+		ON CONFLICT (key) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		WHERE dedupe_keys.expires_at <= now()
+		RETURNING key`, key, ttl.Seconds(),
+	).Scan(&claimed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, db.Classify(err)
+	}
+	return true, nil
+}
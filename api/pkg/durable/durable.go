@@ -0,0 +1,286 @@
+// Package durable provides an execution backend whose async runs survive
+// process restarts. Progress is checkpointed to PostgreSQL after every node;
+// on startup Recover continues each unfinished run from its last checkpoint.
+// A node that was running when the process stopped is run again, so handlers
+// with side effects see at-least-once semantics.
+//
+// Each process is a worker that heartbeats the runs it executes while
+// Supervise is running. Runs whose heartbeat goes stale, e.g. because their
+// worker crashed, are marked stalled and can be requeued on another worker.
+package durable
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/engine"
+)
+
+// Engine implements engine.Engine. Synchronous runs are delegated to the
+// in-process executor unchanged; only ExecuteAsync runs are persisted.
+type Engine struct {
+	executor *engine.Executor
+	store    Store
+	workerID string
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+}
+
+var (
+	_ engine.Engine     = (*Engine)(nil)
+	_ engine.Recoverer  = (*Engine)(nil)
+	_ engine.Supervisor = (*Engine)(nil)
+	_ engine.Queued     = (*Engine)(nil)
+)
+
+func New(executor *engine.Executor, store Store) *Engine {
+	return &Engine{
+		executor: executor,
+		store:    store,
+		workerID: defaultWorkerID(),
+		running:  make(map[string]context.CancelFunc),
+	}
+}
+
+// defaultWorkerID identifies this process as host-pid.
+func defaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// WorkerID returns the id this engine heartbeats its runs with.
+func (e *Engine) WorkerID() string {
+	return e.workerID
+}
+
+func (e *Engine) Execute(ctx context.Context, g *engine.Graph, input map[string]any) (*engine.Execution, error) {
+	return e.executor.Execute(ctx, g, input)
+}
+
+func (e *Engine) Resume(ctx context.Context, g *engine.Graph, input map[string]any, cp engine.Checkpoint) (*engine.Execution, error) {
+	return e.executor.Resume(ctx, g, input, cp)
+}
+
+func (e *Engine) Validate(g *engine.Graph) error {
+	return e.executor.Validate(g)
+}
+
+func (e *Engine) Compile(g *engine.Graph) (*engine.Graph, error) {
+	return e.executor.Compile(g)
+}
+
+// QueueStats reports the queue and workers of the executor's pool, which
+// runs this worker's async runs.
+func (e *Engine) QueueStats() engine.QueueStats {
+	return e.executor.QueueStats()
+}
+
+// ExecuteAsync stores the graph snapshot and input before starting the run so
+// it can be recovered even if the process stops before the first checkpoint.
+func (e *Engine) ExecuteAsync(ctx context.Context, executionID string, g *engine.Graph, input map[string]any) (<-chan engine.AsyncResult, error) {
+	if err := e.executor.Validate(g); err != nil {
+		return nil, err
+	}
+
+	run := &Run{
+		ExecutionID: executionID,
+		Labels:      engine.Labels(ctx),
+		Nodes:       make([]engine.Node, 0, len(g.Nodes())),
+		Edges:       g.Edges(),
+		Input:       input,
+		WorkerID:    e.workerID,
+	}
+	for _, n := range g.Nodes() {
+		run.Nodes = append(run.Nodes, *n)
+	}
+	if err := e.store.Create(ctx, run); err != nil {
+		return nil, fmt.Errorf("failed to persist run: %w", err)
+	}
+	return e.start(context.WithoutCancel(ctx), run, g)
+}
+
+// Recover resumes every run left in the store, e.g. by a crash or restart.
+func (e *Engine) Recover(ctx context.Context) ([]engine.RecoveredRun, error) {
+	runs, err := e.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list durable runs: %w", err)
+	}
+
+	var recovered []engine.RecoveredRun
+	for _, run := range runs {
+		r, err := e.restart(ctx, run)
+		if err != nil {
+			slog.Error("Failed to resume durable run", "executionId", run.ExecutionID, "error", err)
+			continue
+		}
+		slog.Info("Resumed durable run", "executionId", run.ExecutionID)
+		recovered = append(recovered, r)
+	}
+	return recovered, nil
+}
+
+// restart continues a stored run from its last checkpoint. Runs whose graph
+// no longer builds are dropped.
+func (e *Engine) restart(ctx context.Context, run *Run) (engine.RecoveredRun, error) {
+	g, err := engine.NewGraph(run.Nodes, run.Edges)
+	if err != nil {
+		e.delete(ctx, run.ExecutionID)
+		return engine.RecoveredRun{}, fmt.Errorf("dropped run with invalid graph: %w", err)
+	}
+	results, err := e.start(engine.WithLabels(context.WithoutCancel(ctx), run.Labels), run, g)
+	if err != nil {
+		return engine.RecoveredRun{}, err
+	}
+	return engine.RecoveredRun{
+		ExecutionID: run.ExecutionID,
+		Labels:      run.Labels,
+		Input:       run.Input,
+		Results:     results,
+	}, nil
+}
+
+// Supervise heartbeats the runs of this worker every opts.Interval and marks
+// runs whose heartbeat is older than opts.StaleAfter as stalled. With
+// opts.Requeue stalled runs are restarted here.
+func (e *Engine) Supervise(ctx context.Context, opts engine.SuperviseOptions, requeued func(engine.RecoveredRun)) {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if ids := e.runningIDs(); len(ids) > 0 {
+			if err := e.store.Heartbeat(ctx, e.workerID, ids); err != nil {
+				slog.Error("Failed to heartbeat durable runs", "workerId", e.workerID, "error", err)
+			}
+		}
+
+		stalled, err := e.store.MarkStalled(ctx, opts.StaleAfter)
+		if err != nil {
+			slog.Error("Failed to check for stalled durable runs", "error", err)
+			continue
+		}
+		for _, id := range stalled {
+			slog.Warn("Durable run stalled", "executionId", id, "staleAfter", opts.StaleAfter)
+			if !opts.Requeue {
+				continue
+			}
+			r, err := e.Requeue(ctx, id)
+			if err != nil {
+				slog.Error("Failed to requeue stalled durable run", "executionId", id, "error", err)
+				continue
+			}
+			slog.Info("Requeued stalled durable run", "executionId", id, "workerId", e.workerID)
+			requeued(r)
+		}
+	}
+}
+
+// Requeue takes over a stalled run and continues it from its last checkpoint
+// on this worker.
+func (e *Engine) Requeue(ctx context.Context, executionID string) (engine.RecoveredRun, error) {
+	run, err := e.store.Claim(ctx, executionID, e.workerID)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return engine.RecoveredRun{}, fmt.Errorf("%w: %s", engine.ErrExecutionNotRunning, executionID)
+	case errors.Is(err, db.ErrConflict):
+		return engine.RecoveredRun{}, fmt.Errorf("%w: %s is not stalled", engine.ErrExecutionRunning, executionID)
+	case err != nil:
+		return engine.RecoveredRun{}, fmt.Errorf("failed to claim durable run: %w", err)
+	}
+	return e.restart(ctx, run)
+}
+
+// Runs lists the runs in progress on every worker.
+func (e *Engine) Runs(ctx context.Context) ([]engine.RunInfo, error) {
+	runs, err := e.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list durable runs: %w", err)
+	}
+	out := make([]engine.RunInfo, 0, len(runs))
+	for _, run := range runs {
+		out = append(out, engine.RunInfo{
+			ExecutionID: run.ExecutionID,
+			Labels:      run.Labels,
+			WorkerID:    run.WorkerID,
+			CreatedAt:   run.CreatedAt,
+			HeartbeatAt: run.HeartbeatAt,
+			StalledAt:   run.StalledAt,
+		})
+	}
+	return out, nil
+}
+
+func (e *Engine) runningIDs() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ids := make([]string, 0, len(e.running))
+	for id := range e.running {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (e *Engine) start(ctx context.Context, run *Run, g *engine.Graph) (<-chan engine.AsyncResult, error) {
+	runCtx, cancel := context.WithCancel(ctx)
+
+	e.mu.Lock()
+	if _, exists := e.running[run.ExecutionID]; exists {
+		e.mu.Unlock()
+		cancel()
+		return nil, fmt.Errorf("%w: %s", engine.ErrExecutionRunning, run.ExecutionID)
+	}
+	e.running[run.ExecutionID] = cancel
+	e.mu.Unlock()
+
+	save := func(cp engine.Checkpoint) error {
+		// Checkpoints must be written even while the run is being cancelled.
+		return e.store.SaveCheckpoint(context.WithoutCancel(runCtx), run.ExecutionID, cp)
+	}
+
+	results := make(chan engine.AsyncResult, 1)
+	e.executor.Pool().Submit(func() {
+		defer close(results)
+		defer func() {
+			e.mu.Lock()
+			delete(e.running, run.ExecutionID)
+			e.mu.Unlock()
+			cancel()
+		}()
+
+		exec, err := e.executor.ExecuteFrom(runCtx, g, run.Input, run.Checkpoint, save)
+		e.delete(context.WithoutCancel(runCtx), run.ExecutionID)
+		results <- engine.AsyncResult{Execution: exec, Err: err}
+	})
+	return results, nil
+}
+
+func (e *Engine) Cancel(executionID string) error {
+	e.mu.Lock()
+	cancel, ok := e.running[executionID]
+	e.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", engine.ErrExecutionNotRunning, executionID)
+	}
+	cancel()
+	return nil
+}
+
+func (e *Engine) delete(ctx context.Context, executionID string) {
+	if err := e.store.Delete(ctx, executionID); err != nil {
+		slog.Error("Failed to delete durable run", "executionId", executionID, "error", err)
+	}
+}
@@ -0,0 +1,181 @@
+package durable
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/engine"
+)
+
+// Run is the persisted state of an async run: the graph snapshot it executes,
+// its input and the last checkpoint. Checkpoint is nil until the first node
+// has finished.
+type Run struct {
+	ExecutionID string
+	Labels      map[string]string
+	Nodes       []engine.Node
+	Edges       []engine.Edge
+	Input       map[string]any
+	Checkpoint  *engine.Checkpoint
+
+	// WorkerID is the worker executing the run and HeartbeatAt the last time
+	// it reported; StalledAt is set once that heartbeat went stale.
+	WorkerID    string
+	CreatedAt   time.Time
+	HeartbeatAt *time.Time
+	StalledAt   *time.Time
+}
+
+// Store persists runs between checkpoints.
+type Store interface {
+	Create(ctx context.Context, run *Run) error
+	SaveCheckpoint(ctx context.Context, executionID string, cp engine.Checkpoint) error
+	Delete(ctx context.Context, executionID string) error
+	List(ctx context.Context) ([]*Run, error)
+
+	// Heartbeat records that workerID is still executing the given runs.
+	Heartbeat(ctx context.Context, workerID string, executionIDs []string) error
+	// MarkStalled flags the runs whose last heartbeat is older than
+	// staleAfter and returns their ids.
+	MarkStalled(ctx context.Context, staleAfter time.Duration) ([]string, error)
+	// Claim hands a stalled run over to workerID. It fails with
+	// db.ErrNotFound for unknown runs and db.ErrConflict for runs that
+	// aren't stalled.
+	Claim(ctx context.Context, executionID, workerID string) (*Run, error)
+}
+
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+func (s *PostgresStore) Create(ctx context.Context, run *Run) error {
+	labels := run.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	input := run.Input
+	if input == nil {
+		input = map[string]any{}
+	}
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO durable_runs (execution_id, labels, nodes, edges, input, worker_id, heartbeat_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), now())`,
+		run.ExecutionID, labels, run.Nodes, run.Edges, input, run.WorkerID)
+	return db.Classify(err)
+}
+
+func (s *PostgresStore) SaveCheckpoint(ctx context.Context, executionID string, cp engine.Checkpoint) error {
+	raw, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	tag, err := s.pool.Exec(ctx,
+		"UPDATE durable_runs SET checkpoint = $2, updated_at = now() WHERE execution_id = $1", executionID, raw)
+	if err != nil {
+		return db.Classify(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return db.Classify(pgx.ErrNoRows)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, executionID string) error {
+	_, err := s.pool.Exec(ctx, "DELETE FROM durable_runs WHERE execution_id = $1", executionID)
+	return db.Classify(err)
+}
+
+const runColumns = `execution_id, labels, nodes, edges, input, checkpoint,
+	COALESCE(worker_id, ''), created_at, heartbeat_at, stalled_at`
+
+func scanRun(row pgx.Row) (*Run, error) {
+	var (
+		run Run
+		cp  []byte
+	)
+	err := row.Scan(&run.ExecutionID, &run.Labels, &run.Nodes, &run.Edges, &run.Input, &cp,
+		&run.WorkerID, &run.CreatedAt, &run.HeartbeatAt, &run.StalledAt)
+	if err != nil {
+		return nil, err
+	}
+	if cp != nil {
+		run.Checkpoint = &engine.Checkpoint{}
+		if err := json.Unmarshal(cp, run.Checkpoint); err != nil {
+			return nil, fmt.Errorf("failed to decode checkpoint of %s: %w", run.ExecutionID, err)
+		}
+	}
+	return &run, nil
+}
+
+func (s *PostgresStore) List(ctx context.Context) ([]*Run, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+runColumns+` FROM durable_runs ORDER BY created_at`)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	runs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Run, error) {
+		return scanRun(row)
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return runs, nil
+}
+
+func (s *PostgresStore) Heartbeat(ctx context.Context, workerID string, executionIDs []string) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE durable_runs
+		SET worker_id = $1, heartbeat_at = now(), stalled_at = NULL
+		WHERE execution_id = ANY($2)`, workerID, executionIDs)
+	return db.Classify(err)
+}
+
+func (s *PostgresStore) MarkStalled(ctx context.Context, staleAfter time.Duration) ([]string, error) {
+	// Heartbeats are stamped by the database clock, so staleness is judged by
+	// it too.
+	rows, err := s.pool.Query(ctx, `
+		UPDATE durable_runs
+		SET stalled_at = now()
+		WHERE stalled_at IS NULL AND COALESCE(heartbeat_at, created_at) < now() - make_interval(secs => $1)
+		RETURNING execution_id`, staleAfter.Seconds())
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return ids, nil
+}
+
+func (s *PostgresStore) Claim(ctx context.Context, executionID, workerID string) (*Run, error) {
+	run, err := scanRun(s.pool.QueryRow(ctx, `
+		UPDATE durable_runs
+		SET worker_id = $2, heartbeat_at = now(), stalled_at = NULL
+		WHERE execution_id = $1 AND stalled_at IS NOT NULL
+		RETURNING `+runColumns, executionID, workerID))
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return run, db.Classify(err)
+	}
+
+	var exists bool
+	if err := s.pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM durable_runs WHERE execution_id = $1)`, executionID).Scan(&exists); err != nil {
+		return nil, db.Classify(err)
+	}
+	if !exists {
+		return nil, db.Classify(pgx.ErrNoRows)
+	}
+	return nil, fmt.Errorf("%w: run %s is not stalled", db.ErrConflict, executionID)
+}
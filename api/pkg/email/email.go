@@ -0,0 +1,76 @@
+package email
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// Message is an email ready to be delivered.
+type Message struct {
+	To        string    `json:"to"`
+	From      string    `json:"from"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+	Timestamp time.Time `json:"timestamp"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a file sent along with an email. Its content is left out of
+// its JSON form, which only gives its size.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+func (a Attachment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Filename    string `json:"filename"`
+		ContentType string `json:"contentType"`
+		Size        int    `json:"size"`
+	}{a.Filename, a.ContentType, len(a.Content)})
+}
+
+// Client delivers emails and returns the provider's message id.
+type Client interface {
+	Send(ctx context.Context, msg Message) (string, error)
+}
+
+// MockClient logs emails instead of sending them, and records them in its
+// Outbox if it has one.
+type MockClient struct {
+	Outbox *Outbox
+}
+
+func NewMockClient() *MockClient {
+	return &MockClient{}
+}
+
+// NewRecordingClient returns a MockClient recording emails in outbox. A nil
+// outbox records nothing.
+func NewRecordingClient(outbox *Outbox) *MockClient {
+	return &MockClient{Outbox: outbox}
+}
+
+func (c *MockClient) Send(ctx context.Context, msg Message) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := "msg_" + hex.EncodeToString(b)
+
+	slog.Info("Mock email sent", "messageId", id, "to", msg.To, "subject", msg.Subject, "attachments", len(msg.Attachments))
+	if c.Outbox != nil {
+		c.Outbox.record(id, msg)
+	}
+	return id, nil
+}
@@ -0,0 +1,303 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"workflow-code-test/api/pkg/db"
+)
+
+// MaxListAddresses bounds the addresses of a distribution list.
+const MaxListAddresses = 500
+
+// DistributionList is a named group of addresses email nodes can send to.
+type DistributionList struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Addresses   []string  `json:"addresses"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+var listName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Validate checks that the list has a name of lowercase letters, digits,
+// dashes and underscores and between one and MaxListAddresses valid
+// addresses, and normalizes the addresses to their plain form without
+// duplicates.
+func (l *DistributionList) Validate() error {
+	if !listName.MatchString(l.Name) {
+		return fmt.Errorf("name %q must be up to 64 lowercase letters, digits, dashes and underscores", l.Name)
+	}
+	if len(l.Addresses) == 0 {
+		return errors.New("addresses must not be empty")
+	}
+	if len(l.Addresses) > MaxListAddresses {
+		return fmt.Errorf("at most %d addresses are allowed", MaxListAddresses)
+	}
+	addresses := make([]string, 0, len(l.Addresses))
+	for _, a := range l.Addresses {
+		parsed, err := mail.ParseAddress(a)
+		if err != nil {
+			return fmt.Errorf("invalid address %q", a)
+		}
+		addresses = append(addresses, parsed.Address)
+	}
+	l.Addresses = UniqueAddresses(addresses)
+	return nil
+}
+
+// UniqueAddresses returns addresses without the ones that repeat an earlier
+// one ignoring case, in order.
+func UniqueAddresses(addresses []string) []string {
+	seen := make(map[string]bool, len(addresses))
+	out := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		key := strings.ToLower(a)
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// Lists keeps the distribution lists email nodes send to, by name. Missing
+// lists are reported as db.ErrNotFound and duplicates as db.ErrConflict.
+type Lists interface {
+	// ListLists returns every list, sorted by name.
+	ListLists(ctx context.Context) ([]DistributionList, error)
+	GetList(ctx context.Context, name string) (DistributionList, error)
+	CreateList(ctx context.Context, list *DistributionList) error
+	// UpdateList replaces the description and addresses of the list of the
+	// same name.
+	UpdateList(ctx context.Context, list *DistributionList) error
+	DeleteList(ctx context.Context, name string) error
+	// Redact calls redact on every list, which changes it in place and
+	// reports whether it did, stores the lists changed and returns their
+	// number, e.g. to erase a person from all of them.
+	Redact(ctx context.Context, redact func(list *DistributionList) bool) (int, error)
+}
+
+func listNotFound(name string) error {
+	return fmt.Errorf("%w: distribution list %q", db.ErrNotFound, name)
+}
+
+// MemoryLists keeps distribution lists in process.
+type MemoryLists struct {
+	mu    sync.RWMutex
+	lists map[string]DistributionList
+}
+
+func NewMemoryLists() *MemoryLists {
+	return &MemoryLists{lists: make(map[string]DistributionList)}
+}
+
+func (m *MemoryLists) ListLists(ctx context.Context) ([]DistributionList, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	lists := make([]DistributionList, 0, len(m.lists))
+	for _, name := range slices.Sorted(maps.Keys(m.lists)) {
+		lists = append(lists, copyList(m.lists[name]))
+	}
+	return lists, nil
+}
+
+func (m *MemoryLists) GetList(ctx context.Context, name string) (DistributionList, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list, ok := m.lists[name]
+	if !ok {
+		return DistributionList{}, listNotFound(name)
+	}
+	return copyList(list), nil
+}
+
+func (m *MemoryLists) CreateList(ctx context.Context, list *DistributionList) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.lists[list.Name]; ok {
+		return fmt.Errorf("%w: distribution list %q already exists", db.ErrConflict, list.Name)
+	}
+	now := time.Now().UTC()
+	list.CreatedAt, list.UpdatedAt = now, now
+	m.lists[list.Name] = copyList(*list)
+	return nil
+}
+
+func (m *MemoryLists) UpdateList(ctx context.Context, list *DistributionList) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.lists[list.Name]
+	if !ok {
+		return listNotFound(list.Name)
+	}
+	list.CreatedAt, list.UpdatedAt = existing.CreatedAt, time.Now().UTC()
+	m.lists[list.Name] = copyList(*list)
+	return nil
+}
+
+func (m *MemoryLists) DeleteList(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.lists[name]; !ok {
+		return listNotFound(name)
+	}
+	delete(m.lists, name)
+	return nil
+}
+
+func (m *MemoryLists) Redact(ctx context.Context, redact func(list *DistributionList) bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for name, list := range m.lists {
+		list = copyList(list)
+		if redact(&list) {
+			list.UpdatedAt = time.Now().UTC()
+			m.lists[name] = list
+			n++
+		}
+	}
+	return n, nil
+}
+
+func copyList(list DistributionList) DistributionList {
+	list.Addresses = slices.Clone(list.Addresses)
+	return list
+}
+
+// PostgresLists keeps distribution lists in the distribution_lists table.
+type PostgresLists struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresLists(pool *pgxpool.Pool) *PostgresLists {
+	return &PostgresLists{pool: pool}
+}
+
+const listColumns = "name, description, addresses, created_at, updated_at"
+
+func scanList(row pgx.CollectableRow) (DistributionList, error) {
+	var list DistributionList
+	err := row.Scan(&list.Name, &list.Description, &list.Addresses, &list.CreatedAt, &list.UpdatedAt)
+	return list, err
+}
+
+func (p *PostgresLists) ListLists(ctx context.Context) ([]DistributionList, error) {
+	rows, err := p.pool.Query(ctx, "SELECT "+listColumns+" FROM distribution_lists ORDER BY name")
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	lists, err := pgx.CollectRows(rows, scanList)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return lists, nil
+}
+
+func (p *PostgresLists) GetList(ctx context.Context, name string) (DistributionList, error) {
+	rows, err := p.pool.Query(ctx, "SELECT "+listColumns+" FROM distribution_lists WHERE name = $1", name)
+	if err != nil {
+		return DistributionList{}, db.Classify(err)
+	}
+	list, err := pgx.CollectExactlyOneRow(rows, scanList)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DistributionList{}, listNotFound(name)
+	}
+	if err != nil {
+		return DistributionList{}, db.Classify(err)
+	}
+	return list, nil
+}
+
+func (p *PostgresLists) CreateList(ctx context.Context, list *DistributionList) error {
+	rows, err := p.pool.Query(ctx, `
+		INSERT INTO distribution_lists (name, description, addresses)
+		VALUES ($1, $2, $3)
+		RETURNING `+listColumns,
+		list.Name, list.Description, list.Addresses)
+	if err != nil {
+		return db.Classify(err)
+	}
+	created, err := pgx.CollectExactlyOneRow(rows, scanList)
+	if err != nil {
+		return db.Classify(err)
+	}
+	*list = created
+	return nil
+}
+
+func (p *PostgresLists) UpdateList(ctx context.Context, list *DistributionList) error {
+	rows, err := p.pool.Query(ctx, `
+		UPDATE distribution_lists SET description = $2, addresses = $3, updated_at = now()
+		WHERE name = $1
+		RETURNING `+listColumns,
+		list.Name, list.Description, list.Addresses)
+	if err != nil {
+		return db.Classify(err)
+	}
+	updated, err := pgx.CollectExactlyOneRow(rows, scanList)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return listNotFound(list.Name)
+	}
+	if err != nil {
+		return db.Classify(err)
+	}
+	*list = updated
+	return nil
+}
+
+func (p *PostgresLists) DeleteList(ctx context.Context, name string) error {
+	tag, err := p.pool.Exec(ctx, "DELETE FROM distribution_lists WHERE name = $1", name)
+	if err != nil {
+		return db.Classify(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return listNotFound(name)
+	}
+	return nil
+}
+
+func (p *PostgresLists) Redact(ctx context.Context, redact func(list *DistributionList) bool) (int, error) {
+	n := 0
+	err := db.InTx(ctx, p.pool, func(tx pgx.Tx) error {
+		n = 0
+		rows, err := tx.Query(ctx, "SELECT "+listColumns+" FROM distribution_lists ORDER BY name FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		lists, err := pgx.CollectRows(rows, scanList)
+		if err != nil {
+			return err
+		}
+		for _, list := range lists {
+			if !redact(&list) {
+				continue
+			}
+			_, err := tx.Exec(ctx, `
+				UPDATE distribution_lists SET description = $2, addresses = $3, updated_at = now()
+				WHERE name = $1`, list.Name, list.Description, list.Addresses)
+			if err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, db.Classify(err)
+	}
+	return n, nil
+}
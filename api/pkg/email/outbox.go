@@ -0,0 +1,63 @@
+package email
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultOutboxSize is how many emails an Outbox keeps unless told otherwise.
+const DefaultOutboxSize = 200
+
+// SentMessage is an email recorded by an Outbox.
+type SentMessage struct {
+	ID string `json:"id"`
+	Message
+	SentAt time.Time `json:"sentAt"`
+}
+
+// Outbox keeps the latest emails "sent" by mock clients in memory, so they
+// can be looked at during local development. Older emails are dropped once it
+// holds size of them.
+type Outbox struct {
+	size int
+
+	mu   sync.Mutex
+	sent []SentMessage
+}
+
+func NewOutbox(size int) *Outbox {
+	return &Outbox{size: size}
+}
+
+func (o *Outbox) record(id string, msg Message) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sent = append(o.sent, SentMessage{ID: id, Message: msg, SentAt: time.Now().UTC()})
+	if len(o.sent) > o.size {
+		o.sent = slices.Delete(o.sent, 0, len(o.sent)-o.size)
+	}
+}
+
+// Redact calls redact on every recorded email, which changes it in place and
+// reports whether it did, and returns the number of emails changed.
+func (o *Outbox) Redact(redact func(msg *Message) bool) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := 0
+	for i := range o.sent {
+		if redact(&o.sent[i].Message) {
+			n++
+		}
+	}
+	return n
+}
+
+// List returns the recorded emails, newest first.
+func (o *Outbox) List() []SentMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	sent := slices.Clone(o.sent)
+	slices.Reverse(sent)
+	return sent
+}
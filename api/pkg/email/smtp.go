@@ -0,0 +1,173 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+// SMTPClient delivers emails to an SMTP server, such as a MailHog or Mailpit
+// container during development. STARTTLS is used when the server offers it,
+// and the client authenticates when Username is set.
+type SMTPClient struct {
+	// Addr is the server's host:port.
+	Addr     string
+	Username string
+	Password string
+
+	// Timeout, if set, bounds connecting and delivering one email when the
+	// context has no earlier deadline.
+	Timeout time.Duration
+}
+
+func NewSMTPClient(addr, username, password string) *SMTPClient {
+	return &SMTPClient{Addr: addr, Username: username, Password: password, Timeout: 10 * time.Second}
+}
+
+func (c *SMTPClient) Send(ctx context.Context, msg Message) (string, error) {
+	host, _, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid SMTP address %q: %w", c.Addr, err)
+	}
+	id, err := messageID(host)
+	if err != nil {
+		return "", err
+	}
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	// Closing the connection interrupts a server that stalls mid-session.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return "", c.fail(ctx, "failed to start SMTP session", err)
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return "", c.fail(ctx, "failed to start TLS", err)
+		}
+	}
+	if c.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.Username, c.Password, host)); err != nil {
+			return "", c.fail(ctx, "failed to authenticate to SMTP server", err)
+		}
+	}
+
+	if err := client.Mail(msg.From); err != nil {
+		return "", c.fail(ctx, "SMTP server rejected the sender", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return "", c.fail(ctx, "SMTP server rejected the recipient", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return "", c.fail(ctx, "failed to send email", err)
+	}
+	if _, err := w.Write(formatMessage(msg, id)); err != nil {
+		return "", c.fail(ctx, "failed to send email", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", c.fail(ctx, "SMTP server rejected the email", err)
+	}
+	client.Quit()
+	return id, nil
+}
+
+// fail reports err, or the context's error if the session was cut short by
+// it.
+func (c *SMTPClient) fail(ctx context.Context, action string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%s: %w", action, ctxErr)
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
+
+// messageID returns a unique Message-ID for an email sent through host.
+func messageID(host string) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "<" + hex.EncodeToString(b) + "@" + host + ">", nil
+}
+
+// formatMessage renders msg as a plain text MIME message, or a
+// multipart/mixed one with its attachments after the text.
+func formatMessage(msg Message, id string) []byte {
+	var b bytes.Buffer
+	date := msg.Timestamp
+	if date.IsZero() {
+		date = time.Now()
+	}
+	fmt.Fprintf(&b, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: %s\r\n", id)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	if len(msg.Attachments) == 0 {
+		b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		qp := quotedprintable.NewWriter(&b)
+		qp.Write([]byte(msg.Body))
+		qp.Close()
+		return b.Bytes()
+	}
+
+	mw := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mw.Boundary())
+	part, _ := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	qp := quotedprintable.NewWriter(part)
+	qp.Write([]byte(msg.Body))
+	qp.Close()
+	for _, a := range msg.Attachments {
+		part, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		writeBase64Lines(part, a.Content)
+	}
+	mw.Close()
+	return b.Bytes()
+}
+
+// writeBase64Lines writes content base64 encoded in lines of 76 characters,
+// as RFC 2045 requires.
+func writeBase64Lines(w io.Writer, content []byte) {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
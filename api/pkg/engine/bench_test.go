@@ -0,0 +1,163 @@
+package engine_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// benchSizes are the node counts of the synthetic graphs, up to a large one.
+var benchSizes = []int{10, 100, 1000}
+
+// scenario builds the nodes and edges of one synthetic graph.
+type scenario struct {
+	name  string
+	build func(size int) ([]engine.Node, []engine.Edge)
+}
+
+var scenarios = []scenario{
+	{"chain", chain},
+	{"fanout", fanout},
+	{"parallel", parallel},
+	{"diamonds", diamonds},
+}
+
+// chain is start -> n0 -> n1 -> ... -> end.
+func chain(size int) ([]engine.Node, []engine.Edge) {
+	nodes := []engine.Node{{ID: "start", Type: engine.NodeTypeStart}}
+	var edges []engine.Edge
+	prev := "start"
+	for i := range size {
+		id := "n" + strconv.Itoa(i)
+		nodes = append(nodes, engine.Node{ID: id, Type: nodeTypeNoop, Description: "step {{i}}"})
+		edges = append(edges, engine.Edge{ID: "e" + id, Source: prev, Target: id})
+		prev = id
+	}
+	nodes = append(nodes, engine.Node{ID: "end", Type: engine.NodeTypeEnd})
+	edges = append(edges, engine.Edge{ID: "e-end", Source: prev, Target: "end"})
+	return nodes, edges
+}
+
+// fanout is a start node with size branches; the run follows the last one, so
+// branch selection has to scan every outgoing edge.
+func fanout(size int) ([]engine.Node, []engine.Edge) {
+	nodes := []engine.Node{
+		{ID: "start", Type: engine.NodeTypeStart},
+		{ID: "router", Type: nodeTypeNoop, Metadata: map[string]any{"branch": "b" + strconv.Itoa(size-1)}},
+		{ID: "end", Type: engine.NodeTypeEnd},
+	}
+	edges := []engine.Edge{{ID: "e-router", Source: "start", Target: "router"}}
+	for i := range size {
+		id := "n" + strconv.Itoa(i)
+		nodes = append(nodes, engine.Node{ID: id, Type: nodeTypeNoop})
+		edges = append(edges,
+			engine.Edge{ID: "e" + id, Source: "router", Target: id, SourceHandle: "b" + strconv.Itoa(i)},
+			engine.Edge{ID: "e" + id + "-end", Source: id, Target: "end"},
+		)
+	}
+	return nodes, edges
+}
+
+// parallel is a start node with size parallel branches, each a single node,
+// joined at one merge node.
+func parallel(size int) ([]engine.Node, []engine.Edge) {
+	nodes := []engine.Node{
+		{ID: "start", Type: engine.NodeTypeStart},
+		{ID: "join", Type: engine.NodeTypeMerge},
+		{ID: "end", Type: engine.NodeTypeEnd},
+	}
+	edges := []engine.Edge{{ID: "e-end", Source: "join", Target: "end"}}
+	for i := range size {
+		id := "n" + strconv.Itoa(i)
+		nodes = append(nodes, engine.Node{ID: id, Type: nodeTypeNoop})
+		edges = append(edges,
+			engine.Edge{ID: "e" + id, Source: "start", Target: id},
+			engine.Edge{ID: "e" + id + "-join", Source: id, Target: "join"},
+		)
+	}
+	return nodes, edges
+}
+
+// diamonds chains size/2 diamonds (a -> b, a -> c, b -> d, c -> d), which
+// stresses the acyclicity and join checks with shared descendants. Each
+// diamond runs its two sides as parallel branches joined at the merge node d.
+func diamonds(size int) ([]engine.Node, []engine.Edge) {
+	nodes := []engine.Node{{ID: "start", Type: engine.NodeTypeStart}}
+	var edges []engine.Edge
+	prev := "start"
+	for i := range max(size/2, 1) {
+		p := strconv.Itoa(i)
+		left, right, join := "l"+p, "r"+p, "j"+p
+		nodes = append(nodes,
+			engine.Node{ID: left, Type: nodeTypeNoop},
+			engine.Node{ID: right, Type: nodeTypeNoop},
+			engine.Node{ID: join, Type: engine.NodeTypeMerge},
+		)
+		edges = append(edges,
+			engine.Edge{ID: "el" + p, Source: prev, Target: left},
+			engine.Edge{ID: "er" + p, Source: prev, Target: right},
+			engine.Edge{ID: "ejl" + p, Source: left, Target: join},
+			engine.Edge{ID: "ejr" + p, Source: right, Target: join},
+		)
+		prev = join
+	}
+	nodes = append(nodes, engine.Node{ID: "end", Type: engine.NodeTypeEnd})
+	edges = append(edges, engine.Edge{ID: "e-end", Source: prev, Target: "end"})
+	return nodes, edges
+}
+
+// benchNoop writes one state variable and follows the branch named in its
+// metadata.
+func benchNoop(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	ec.State["i"] = node.ID
+	branch, _ := node.String("branch")
+	return &engine.NodeResult{Output: map[string]any{"id": node.ID}, Branch: branch}, nil
+}
+
+// BenchmarkBuildGraph measures building and checking the synthetic graphs.
+// Baseline numbers are kept in loadtest/BASELINE.md.
+func BenchmarkBuildGraph(b *testing.B) {
+	for _, sc := range scenarios {
+		for _, size := range benchSizes {
+			nodes, edges := sc.build(size)
+			b.Run(sc.name+"/"+strconv.Itoa(size), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					if _, err := engine.NewGraph(nodes, edges); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkExecute measures runs of the synthetic graphs with a no-op
+// handler, so only the executor's own work is counted.
+func BenchmarkExecute(b *testing.B) {
+	registry := engine.NewRegistry()
+	registry.Register(engine.NodeTypeStart, engine.HandlerFunc(benchNoop))
+	registry.Register(engine.NodeTypeEnd, engine.HandlerFunc(benchNoop))
+	registry.Register(engine.NodeTypeMerge, engine.HandlerFunc(benchNoop))
+	registry.Register(nodeTypeNoop, engine.HandlerFunc(benchNoop))
+	executor := engine.NewExecutor(registry)
+
+	for _, sc := range scenarios {
+		for _, size := range benchSizes {
+			g, err := engine.NewGraph(sc.build(size))
+			if err != nil {
+				b.Fatalf("%s/%d: %v", sc.name, size, err)
+			}
+			b.Run(sc.name+"/"+strconv.Itoa(size), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					if _, err := executor.Execute(context.Background(), g, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Resource is something runs consume that a Budget can cap.
+type Resource string
+
+const (
+	// ResourceExternalCalls counts calls to external services, e.g. weather
+	// APIs and issue trackers.
+	ResourceExternalCalls Resource = "externalCalls"
+	// ResourceNotifications counts messages sent to people, e.g. emails
+	// and pages.
+	ResourceNotifications Resource = "notifications"
+)
+
+// Resources lists the resources a Budget can cap.
+var Resources = []Resource{ResourceExternalCalls, ResourceNotifications}
+
+// Budget caps what one run may consume. A resource without a limit, or with
+// a limit of 0, is unlimited.
+type Budget struct {
+	Limits map[Resource]int
+	// Skip makes the executor skip the nodes that would exceed the budget
+	// instead of failing the run.
+	Skip bool
+}
+
+// Budget labels carry a run's budget, so durable engines restore it with the
+// run: "budget.notifications": "10" limits a resource, and
+// "budget.onExceeded": "skip" skips nodes that would exceed it.
+const (
+	budgetLabelPrefix     = "budget."
+	budgetLabelOnExceeded = budgetLabelPrefix + "onExceeded"
+	budgetSkip            = "skip"
+)
+
+// BudgetLabels returns the labels carrying b.
+func BudgetLabels(b Budget) map[string]string {
+	labels := make(map[string]string, len(b.Limits)+1)
+	for resource, limit := range b.Limits {
+		if limit > 0 {
+			labels[budgetLabelPrefix+string(resource)] = strconv.Itoa(limit)
+		}
+	}
+	if b.Skip {
+		labels[budgetLabelOnExceeded] = budgetSkip
+	}
+	return labels
+}
+
+// BudgetFromLabels returns the budget among labels. Malformed limits are
+// ignored.
+func BudgetFromLabels(labels map[string]string) Budget {
+	var b Budget
+	for k, v := range labels {
+		name, ok := strings.CutPrefix(k, budgetLabelPrefix)
+		switch {
+		case !ok:
+		case k == budgetLabelOnExceeded:
+			b.Skip = v == budgetSkip
+		default:
+			if limit, err := strconv.Atoi(v); err == nil && limit > 0 {
+				if b.Limits == nil {
+					b.Limits = make(map[Resource]int)
+				}
+				b.Limits[Resource(name)] = limit
+			}
+		}
+	}
+	return b
+}
+
+// meter tracks what a run consumed against its budget. Copies of an
+// ExecutionContext share it.
+type meter struct {
+	budget Budget
+
+	mu    sync.Mutex
+	spent map[Resource]int
+}
+
+func newMeter(b Budget, spent map[Resource]int) *meter {
+	m := &meter{budget: b, spent: maps.Clone(spent)}
+	if m.spent == nil {
+		m.spent = make(map[Resource]int)
+	}
+	return m
+}
+
+// Spend records that the node about to run consumes n of resource. Handlers
+// call it before the side effect, e.g. with the number of recipients before
+// sending an email. It fails with ErrBudgetExceeded, consuming nothing, if
+// the run's budget has no room for n more; the executor then fails or skips
+// the node.
+func (ec *ExecutionContext) Spend(resource Resource, n int) error {
+	m := ec.budget
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if limit := m.budget.Limits[resource]; limit > 0 && m.spent[resource]+n > limit {
+		return fmt.Errorf("%w: %d more %s would exceed the limit of %d, %d used",
+			ErrBudgetExceeded, n, resource, limit, m.spent[resource])
+	}
+	m.spent[resource] += n
+	return nil
+}
+
+// Spent returns what the run consumed so far, e.g. to carry it in a
+// checkpoint.
+func (ec *ExecutionContext) Spent() map[Resource]int {
+	m := ec.budget
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.spent) == 0 {
+		return nil
+	}
+	return maps.Clone(m.spent)
+}
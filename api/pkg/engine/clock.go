@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Clock tells the time. Runs read it through ExecutionContext.Clock, so tests
+// and replays can fix the timestamps of a trace.
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator makes unique ids, e.g. for executions.
+type IDGenerator interface {
+	NewID() string
+}
+
+// SystemClock is the wall clock, in UTC.
+var SystemClock Clock = systemClock{}
+
+// RandomIDs generates random UUIDs.
+var RandomIDs IDGenerator = randomIDs{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now().UTC() }
+
+type randomIDs struct{}
+
+func (randomIDs) NewID() string { return uuid.NewString() }
+
+// ManualClock is a Clock that only moves when told to. Every call to Now
+// advances it by Step, so consecutive timestamps stay ordered.
+type ManualClock struct {
+	Step time.Duration
+
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewManualClock(start time.Time, step time.Duration) *ManualClock {
+	return &ManualClock{Step: step, now: start.UTC()}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.Step)
+	return now
+}
+
+// Set moves the clock to t.
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t.UTC()
+}
+
+// SequentialIDs generates the same UUIDs in the same order every time: the
+// SHA-1 based UUIDs of 1, 2, 3 and so on in Namespace.
+type SequentialIDs struct {
+	Namespace uuid.UUID
+
+	mu sync.Mutex
+	n  int
+}
+
+func (g *SequentialIDs) NewID() string {
+	g.mu.Lock()
+	g.n++
+	n := g.n
+	g.mu.Unlock()
+	return uuid.NewSHA1(g.Namespace, []byte(strconv.Itoa(n))).String()
+}
+
+type clockKey struct{}
+
+// WithClock makes the runs started with ctx, and their handlers, read the
+// time from c instead of SystemClock.
+func WithClock(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+// ClockFrom returns the clock attached with WithClock, or SystemClock.
+func ClockFrom(ctx context.Context) Clock {
+	if c, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return c
+	}
+	return SystemClock
+}
+
+type idsKey struct{}
+
+// WithIDGenerator makes the handlers of the runs started with ctx generate
+// ids with g instead of RandomIDs.
+func WithIDGenerator(ctx context.Context, g IDGenerator) context.Context {
+	return context.WithValue(ctx, idsKey{}, g)
+}
+
+// IDGeneratorFrom returns the generator attached with WithIDGenerator, or
+// RandomIDs.
+func IDGeneratorFrom(ctx context.Context) IDGenerator {
+	if g, ok := ctx.Value(idsKey{}).(IDGenerator); ok {
+		return g
+	}
+	return RandomIDs
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+)
+
+// Compiler is implemented by handlers that prepare a node once, ahead of its
+// runs, e.g. by parsing its expressions. Compile errors make the graph
+// invalid, so broken metadata is reported when a workflow is published rather
+// than when it first runs.
+type Compiler interface {
+	Compile(node *Node) (any, error)
+}
+
+// WithCompiler adds a Compiler to a handler, e.g. a HandlerFunc.
+func WithCompiler(h NodeHandler, compile func(node *Node) (any, error)) NodeHandler {
+	return compilingHandler{NodeHandler: h, compile: compile}
+}
+
+type compilingHandler struct {
+	NodeHandler
+	compile func(node *Node) (any, error)
+}
+
+func (h compilingHandler) Compile(node *Node) (any, error) {
+	return h.compile(node)
+}
+
+// Compiled returns what the node's handler prepared for it when the graph was
+// compiled, or nil. Handlers fall back to reading the metadata without it.
+func (n *Node) Compiled() any {
+	return n.compiled
+}
+
+// renderDescription renders the node's description template with vars.
+func (n *Node) renderDescription(vars map[string]any) string {
+	if n.description != nil {
+		return n.description.Render(vars)
+	}
+	return RenderTemplate(n.Description, vars)
+}
+
+// Compile validates the graph like Validate and returns a copy whose nodes
+// carry what their handlers prepared for them, along with their parsed
+// description templates. The copy can be run any number of times,
+// concurrently. Nodes whose handler is swapped for a variant by Bind keep the
+// default handler's preparation; handlers must check what they get.
+func (r *Registry) Compile(g *Graph) (*Graph, error) {
+	if err := r.Validate(g); err != nil {
+		return nil, err
+	}
+
+	compiled := &Graph{
+		nodes:    make(map[string]*Node, len(g.nodes)),
+		order:    g.order,
+		edges:    g.edges,
+		outgoing: maps.Clone(g.outgoing),
+		start:    g.start,
+	}
+	for id, n := range g.nodes {
+		c := *n
+		c.description = CompileTemplate(n.Description)
+		if !n.Disabled() {
+			h, _ := r.Get(n.Type)
+			if compiler, ok := h.(Compiler); ok {
+				artifact, err := compiler.Compile(n)
+				if err != nil {
+					return nil, fmt.Errorf("node %s: %w: %v", n.ID, ErrInvalidNode, err)
+				}
+				c.compiled = artifact
+			}
+		}
+		compiled.nodes[id] = &c
+	}
+	return compiled, nil
+}
+
+// Compile prepares the graph for running, see Registry.Compile.
+func (e *Executor) Compile(g *Graph) (*Graph, error) {
+	return e.registry.Compile(g)
+}
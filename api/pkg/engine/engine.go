@@ -0,0 +1,239 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Engine runs workflow graphs. Executor is the in-process implementation;
+// alternative backends (e.g. a queue- or Temporal-backed engine) implement the
+// same interface so they can be plugged in behind the workflow service.
+type Engine interface {
+	// Execute runs the graph to completion and returns its trace.
+	Execute(ctx context.Context, g *Graph, input map[string]any) (*Execution, error)
+
+	// ExecuteAsync starts the graph under the given execution id and returns
+	// immediately. The result is delivered on the returned channel, which is
+	// closed afterwards. The run is not cancelled with ctx; use Cancel.
+	ExecuteAsync(ctx context.Context, executionID string, g *Graph, input map[string]any) (<-chan AsyncResult, error)
+
+	// Resume continues a paused run from its checkpoint, with cp.Resume holding
+	// the submitted data.
+	Resume(ctx context.Context, g *Graph, input map[string]any, cp Checkpoint) (*Execution, error)
+
+	// Cancel stops a run started with ExecuteAsync. It returns
+	// ErrExecutionNotRunning if no such run is in progress.
+	Cancel(executionID string) error
+
+	// Validate checks that every node of the graph can be executed.
+	Validate(g *Graph) error
+
+	// Compile validates the graph and returns a copy prepared for running
+	// many times, see Registry.Compile.
+	Compile(g *Graph) (*Graph, error)
+}
+
+// AsyncResult is the outcome of a run started with ExecuteAsync.
+type AsyncResult struct {
+	Execution *Execution
+	Err       error
+}
+
+// Recoverer is implemented by engines whose async runs survive a restart.
+// Recover resumes the runs that were in progress when the process stopped.
+type Recoverer interface {
+	Recover(ctx context.Context) ([]RecoveredRun, error)
+}
+
+// RecoveredRun is an async run resumed by a Recoverer.
+type RecoveredRun struct {
+	ExecutionID string
+	Labels      map[string]string
+	Input       map[string]any
+	Results     <-chan AsyncResult
+}
+
+// Supervisor is implemented by engines whose async runs may be picked up by
+// any of several workers. Workers heartbeat the runs they execute, so runs
+// left behind by a crashed worker can be detected and taken over.
+type Supervisor interface {
+	// Supervise heartbeats this worker's runs and marks runs whose heartbeat
+	// is older than opts.StaleAfter as stalled, until ctx is done. With
+	// opts.Requeue stalled runs are restarted on this worker and passed to
+	// requeued.
+	Supervise(ctx context.Context, opts SuperviseOptions, requeued func(RecoveredRun))
+
+	// Runs lists the async runs in progress on any worker.
+	Runs(ctx context.Context) ([]RunInfo, error)
+
+	// Requeue restarts a stalled run on this worker. It returns
+	// ErrExecutionNotRunning for unknown runs and ErrExecutionRunning for runs
+	// that aren't stalled.
+	Requeue(ctx context.Context, executionID string) (RecoveredRun, error)
+}
+
+// SuperviseOptions configure Supervisor.Supervise.
+type SuperviseOptions struct {
+	// Interval is how often runs are heartbeated and checked.
+	Interval time.Duration
+	// StaleAfter is how old a heartbeat may get before the run is stalled.
+	StaleAfter time.Duration
+	// Requeue restarts stalled runs automatically.
+	Requeue bool
+}
+
+// DefaultSuperviseOptions heartbeat every 10s and stall runs after a minute
+// without one.
+var DefaultSuperviseOptions = SuperviseOptions{Interval: 10 * time.Second, StaleAfter: time.Minute}
+
+// RunInfo describes an async run in progress. StalledAt is set once the
+// worker running it stopped heartbeating.
+type RunInfo struct {
+	ExecutionID string
+	Labels      map[string]string
+	WorkerID    string
+	CreatedAt   time.Time
+	HeartbeatAt *time.Time
+	StalledAt   *time.Time
+}
+
+// LabelWorkflowID is the label holding the id of the workflow a run belongs
+// to. Handlers use it to scope data they keep across runs.
+const LabelWorkflowID = "workflowId"
+
+// bindingLabelPrefix marks the labels that bind a node type to a handler
+// variant for one run, e.g. "handler.email": "sandbox". Carrying bindings as
+// labels lets durable engines restore them with the run.
+const bindingLabelPrefix = "handler."
+
+// BindingLabel returns the label binding nodeType to a handler variant.
+func BindingLabel(nodeType string) string {
+	return bindingLabelPrefix + nodeType
+}
+
+// Bindings returns the handler bindings among the labels of ctx, keyed by
+// node type.
+func Bindings(ctx context.Context) map[string]string {
+	return BindingsFromLabels(Labels(ctx))
+}
+
+// BindingsFromLabels returns the handler bindings among labels, keyed by node
+// type.
+func BindingsFromLabels(labels map[string]string) map[string]string {
+	var bindings map[string]string
+	for k, v := range labels {
+		if nodeType, ok := strings.CutPrefix(k, bindingLabelPrefix); ok {
+			if bindings == nil {
+				bindings = make(map[string]string)
+			}
+			bindings[nodeType] = v
+		}
+	}
+	return bindings
+}
+
+type labelsKey struct{}
+
+// WithLabels attaches labels to the runs started with ctx. Durable engines
+// persist them so callers can tell recovered runs apart, e.g. by workflow id.
+func WithLabels(ctx context.Context, labels map[string]string) context.Context {
+	return context.WithValue(ctx, labelsKey{}, labels)
+}
+
+// Labels returns the labels attached with WithLabels.
+func Labels(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(labelsKey{}).(map[string]string)
+	return labels
+}
+
+type startedKey struct{}
+
+// WithStarted makes the runs started with ctx call started when they begin,
+// before their first node runs. Async runs begin once a worker picks them up,
+// so callers can tell queued runs from running ones.
+func WithStarted(ctx context.Context, started func(startedAt time.Time)) context.Context {
+	return context.WithValue(ctx, startedKey{}, started)
+}
+
+// notifyStarted calls the function attached with WithStarted, if any.
+func notifyStarted(ctx context.Context, startedAt time.Time) {
+	if started, ok := ctx.Value(startedKey{}).(func(time.Time)); ok {
+		started(startedAt)
+	}
+}
+
+type stepObserverKey struct{}
+
+// WithStepObserver makes the runs started with ctx call observe with each
+// step as it is added to the trace, along with its index in it. Resumed runs
+// continue the indices of their checkpoint. observe runs on the run's
+// goroutine, so it must not block.
+func WithStepObserver(ctx context.Context, observe func(index int, step ExecutionStep)) context.Context {
+	return context.WithValue(ctx, stepObserverKey{}, observe)
+}
+
+// notifyStep calls the function attached with WithStepObserver, if any.
+func notifyStep(ctx context.Context, index int, step ExecutionStep) {
+	if observe, ok := ctx.Value(stepObserverKey{}).(func(int, ExecutionStep)); ok {
+		observe(index, step)
+	}
+}
+
+var (
+	_ Engine = (*Executor)(nil)
+	_ Queued = (*Executor)(nil)
+)
+
+// ExecuteAsync runs the graph on the executor's pool, waiting in its queue
+// while every worker is busy. The run keeps the values of ctx but not its
+// cancellation or deadline.
+func (e *Executor) ExecuteAsync(ctx context.Context, executionID string, g *Graph, input map[string]any) (<-chan AsyncResult, error) {
+	if err := e.registry.Validate(g); err != nil {
+		return nil, err
+	}
+
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	e.mu.Lock()
+	if _, exists := e.running[executionID]; exists {
+		e.mu.Unlock()
+		cancel()
+		return nil, fmt.Errorf("%w: %s", ErrExecutionRunning, executionID)
+	}
+	e.running[executionID] = cancel
+	e.mu.Unlock()
+
+	results := make(chan AsyncResult, 1)
+	e.pool.Submit(func() {
+		defer close(results)
+		defer func() {
+			e.mu.Lock()
+			delete(e.running, executionID)
+			e.mu.Unlock()
+			cancel()
+		}()
+
+		exec, err := e.Execute(runCtx, g, input)
+		results <- AsyncResult{Execution: exec, Err: err}
+	})
+	return results, nil
+}
+
+func (e *Executor) Resume(ctx context.Context, g *Graph, input map[string]any, cp Checkpoint) (*Execution, error) {
+	return e.ExecuteFrom(ctx, g, input, &cp, nil)
+}
+
+// Cancel stops a run started with ExecuteAsync. The node running at the time
+// finishes or observes the cancelled context; no further nodes are started.
+func (e *Executor) Cancel(executionID string) error {
+	e.mu.Lock()
+	cancel, ok := e.running[executionID]
+	e.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrExecutionNotRunning, executionID)
+	}
+	cancel()
+	return nil
+}
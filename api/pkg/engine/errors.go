@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned by graph construction and execution. Callers should
+// match them with errors.Is since they are usually wrapped with more context.
+var (
+	ErrUnknownNodeType     = errors.New("unknown node type")
+	ErrUnknownVariant      = errors.New("unknown handler variant")
+	ErrHandlerVersion      = errors.New("no handler of the pinned version")
+	ErrCycle               = errors.New("workflow graph contains a cycle not passing through a loop node")
+	ErrNoStartNode         = errors.New("workflow has no start node")
+	ErrMultipleStartNodes  = errors.New("workflow has more than one start node")
+	ErrDuplicateNode       = errors.New("duplicate node id")
+	ErrDanglingEdge        = errors.New("edge references an unknown node")
+	ErrInvalidCompensation = errors.New("invalid compensation")
+	ErrNoMatchingBranch    = errors.New("no outgoing edge matches branch")
+	ErrBranchesNotJoined   = errors.New("parallel branches reach different merge nodes")
+	ErrBranchesMeet        = errors.New("parallel branches meet at a node that is not a merge node")
+	ErrInvalidInput        = errors.New("invalid input")
+	ErrInvalidNode         = errors.New("invalid node metadata")
+	ErrBudgetExceeded      = errors.New("execution budget exceeded")
+	ErrNodeTimeout         = errors.New("node timed out")
+	ErrLoopLimit           = errors.New("loop iteration limit reached")
+
+	ErrExecutionRunning    = errors.New("execution is already running")
+	ErrExecutionNotRunning = errors.New("execution is not running")
+)
+
+// NodeExecutionError is returned when a node handler fails while the workflow is
+// running. It records which node failed so callers can report it.
+type NodeExecutionError struct {
+	NodeID   string
+	NodeType string
+	Err      error
+}
+
+func (e *NodeExecutionError) Error() string {
+	return fmt.Sprintf("node %q (%s) failed: %v", e.NodeID, e.NodeType, e.Err)
+}
+
+func (e *NodeExecutionError) Unwrap() error {
+	return e.Err
+}
+
+// IsGraphError reports whether err was caused by an invalid workflow definition
+// rather than by a failure while running it.
+func IsGraphError(err error) bool {
+	return errors.Is(err, ErrUnknownNodeType) ||
+		errors.Is(err, ErrUnknownVariant) ||
+		errors.Is(err, ErrHandlerVersion) ||
+		errors.Is(err, ErrCycle) ||
+		errors.Is(err, ErrNoStartNode) ||
+		errors.Is(err, ErrMultipleStartNodes) ||
+		errors.Is(err, ErrDuplicateNode) ||
+		errors.Is(err, ErrDanglingEdge) ||
+		errors.Is(err, ErrInvalidCompensation) ||
+		errors.Is(err, ErrInvalidNode) ||
+		errors.Is(err, ErrNoMatchingBranch) ||
+		errors.Is(err, ErrBranchesNotJoined) ||
+		errors.Is(err, ErrBranchesMeet)
+}
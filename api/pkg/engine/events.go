@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LabelExecutionID is the label holding the id a run is recorded under. Node
+// events carry it.
+const LabelExecutionID = "executionId"
+
+// NodeState is the state of a node in a NodeEvent.
+type NodeState string
+
+const (
+	// NodeStarted is published when a node's handler starts; disabled and
+	// memoized nodes skip it, and so do nodes on parallel branches, whose
+	// other events are published once the branches joined.
+	NodeStarted   NodeState = "started"
+	NodeCompleted NodeState = NodeState(StepStatusCompleted)
+	NodeFailed    NodeState = NodeState(StepStatusFailed)
+	NodeSkipped   NodeState = NodeState(StepStatusSkipped)
+	NodeWaiting   NodeState = NodeState(StepStatusWaiting)
+	NodeTimedOut  NodeState = NodeState(StepStatusTimeout)
+)
+
+// NodeEvent reports a node of a run changing state. ExecutionID and
+// WorkflowID come from the run's labels.
+type NodeEvent struct {
+	ExecutionID string    `json:"executionId,omitempty"`
+	WorkflowID  string    `json:"workflowId,omitempty"`
+	NodeID      string    `json:"nodeId"`
+	NodeType    string    `json:"nodeType"`
+	State       NodeState `json:"state"`
+	// Index is the position of the node's step in the trace.
+	Index        int       `json:"index"`
+	Compensation bool      `json:"compensation,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	At           time.Time `json:"at"`
+}
+
+// EventBus fans the node events of an executor's runs out to subscribers.
+// Publishing never blocks the run: a subscriber whose buffer is full misses
+// the event.
+type EventBus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives the events published after it was made on C, until
+// it is closed.
+type Subscription struct {
+	C <-chan NodeEvent
+
+	bus     *EventBus
+	c       chan NodeEvent
+	dropped atomic.Int64
+}
+
+// Subscribe returns a subscription buffering up to buffer events.
+func (b *EventBus) Subscribe(buffer int) *Subscription {
+	c := make(chan NodeEvent, buffer)
+	sub := &Subscription{C: c, bus: b, c: c}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// Close stops the subscription and closes C.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subs[s]; ok {
+		delete(s.bus.subs, s)
+		close(s.c)
+	}
+}
+
+// Dropped returns the number of events the subscription missed because its
+// buffer was full.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Publish hands e to every subscriber with room for it.
+func (b *EventBus) Publish(e NodeEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		select {
+		case sub.c <- e:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// WithEvents makes the executor publish the node events of its runs on bus.
+// It must be called before any run starts.
+func (e *Executor) WithEvents(bus *EventBus) *Executor {
+	e.events = bus
+	return e
+}
+
+// publish reports the state of the node of step, the index-th of the trace,
+// on the run's event bus.
+func (ec *ExecutionContext) publish(state NodeState, index int, step ExecutionStep) {
+	if ec.events == nil || ec.branch != "" {
+		return
+	}
+	at := step.FinishedAt
+	if state == NodeStarted {
+		at = step.StartedAt
+	}
+	labels := Labels(ec.Ctx)
+	ec.events.Publish(NodeEvent{
+		ExecutionID:  labels[LabelExecutionID],
+		WorkflowID:   labels[LabelWorkflowID],
+		NodeID:       step.NodeID,
+		NodeType:     step.NodeType,
+		State:        state,
+		Index:        index,
+		Compensation: step.Compensation,
+		Error:        step.Error,
+		At:           at,
+	})
+}
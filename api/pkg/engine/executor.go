@@ -0,0 +1,669 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StepStatus is the outcome of a single node execution.
+type StepStatus string
+
+const (
+	StepStatusCompleted StepStatus = "completed"
+	StepStatusFailed    StepStatus = "failed"
+	StepStatusWaiting   StepStatus = "waiting"
+	StepStatusSkipped   StepStatus = "skipped"
+
+	// StepStatusTimeout marks a node that failed because its handler ran
+	// past the node's timeout.
+	StepStatusTimeout StepStatus = "timeout"
+)
+
+// Failed reports whether the step failed, including by timing out.
+func (s StepStatus) Failed() bool {
+	return s == StepStatusFailed || s == StepStatusTimeout
+}
+
+// ExecutionStatus is the outcome of a whole workflow run.
+type ExecutionStatus string
+
+const (
+	ExecutionStatusCompleted ExecutionStatus = "completed"
+	ExecutionStatusFailed    ExecutionStatus = "failed"
+	ExecutionStatusPaused    ExecutionStatus = "paused"
+
+	// ExecutionStatusInterrupted ends a run stopped because its context was
+	// cancelled or hit its deadline, rather than by a node failing.
+	ExecutionStatusInterrupted ExecutionStatus = "interrupted"
+)
+
+// ExecutionStep records the execution of one node.
+type ExecutionStep struct {
+	NodeID      string
+	NodeType    string
+	Label       string
+	Description string
+	Status      StepStatus
+	Output      map[string]any
+	Error       string
+	StartedAt   time.Time
+	FinishedAt  time.Time
+
+	// Memoized is set when the result was reused from an earlier visit of the
+	// same node in this run instead of calling the handler again.
+	Memoized bool
+
+	// Compensation is set on the steps of compensation nodes, run to undo
+	// completed nodes after the run failed.
+	Compensation bool
+
+	// Attempts is how often the node's handler was called, more than once
+	// when the node's RetryPolicy retried it. Nodes whose handler didn't run
+	// have none.
+	Attempts int
+
+	// ParallelBranch identifies the parallel branch the step ran on by the
+	// id of the edge that started it, e.g. "e4", prefixed with those of the
+	// branches it is nested in, e.g. "e2/e4". It is empty for steps outside
+	// of parallel branches.
+	ParallelBranch string
+
+	// RateLimited is how long the node waited for its RateLimit before its
+	// handler was called, over all attempts.
+	RateLimited time.Duration
+
+	// Iteration is the iteration of the innermost loop the step ran in, nil
+	// outside of loops. The steps of a loop node belong to the loop around
+	// it, if any.
+	Iteration *Iteration
+}
+
+// Execution is the trace of a workflow run.
+type Execution struct {
+	Status     ExecutionStatus
+	Steps      []ExecutionStep
+	State      map[string]any
+	StartedAt  time.Time
+	FinishedAt time.Time
+
+	// Await and Checkpoint are set when the run is paused. Passing Checkpoint,
+	// with Resume filled in, to ExecuteFrom continues the run.
+	Await      *Await
+	Checkpoint *Checkpoint
+
+	// compensations are the compensation nodes registered by the nodes
+	// completed so far, in the order they completed.
+	compensations []string
+}
+
+// Executor walks a Graph from its start node, running each node with the
+// handler registered for its type. Async runs execute on a Pool sized by
+// DefaultPoolOptions unless WithPool says otherwise. The rate limits of nodes
+// are shared by all runs of an executor.
+type Executor struct {
+	registry   *Registry
+	pool       *Pool
+	middleware []Middleware
+	events     *EventBus
+	limiter    *rateLimiter
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+}
+
+func NewExecutor(registry *Registry) *Executor {
+	return &Executor{
+		registry: registry,
+		pool:     NewPool(DefaultPoolOptions),
+		limiter:  newRateLimiter(),
+		running:  make(map[string]context.CancelFunc),
+	}
+}
+
+// WithPool makes the executor run async runs on a pool sized by opts. It must
+// be called before any run starts.
+func (e *Executor) WithPool(opts PoolOptions) *Executor {
+	e.pool = NewPool(opts)
+	return e
+}
+
+// Pool returns the pool async runs execute on.
+func (e *Executor) Pool() *Pool {
+	return e.pool
+}
+
+// QueueStats reports the queue and workers of the executor's pool.
+func (e *Executor) QueueStats() QueueStats {
+	return e.pool.Stats()
+}
+
+// Execute runs the graph to completion. When a node fails the returned
+// Execution holds the trace up to and including the failed step, and the error
+// is a *NodeExecutionError. Definition problems discovered before any node runs
+// are returned with a nil Execution. A run paused by a node returns with status
+// ExecutionStatusPaused and a nil error.
+func (e *Executor) Execute(ctx context.Context, g *Graph, input map[string]any) (*Execution, error) {
+	return e.ExecuteFrom(ctx, g, input, nil, nil)
+}
+
+// Checkpoint is the progress of a run between two nodes. Durable backends
+// persist it so a run can continue after a restart.
+type Checkpoint struct {
+	// NextNodeID is the node to run next.
+	NextNodeID string          `json:"nextNodeId"`
+	State      map[string]any  `json:"state"`
+	Steps      []ExecutionStep `json:"steps"`
+	StartedAt  time.Time       `json:"startedAt"`
+
+	// Resume is handed to the next node as ExecutionContext.Resume.
+	Resume map[string]any `json:"resume,omitempty"`
+
+	// Compensations are the compensation nodes registered by the nodes
+	// completed so far, in the order they completed.
+	Compensations []string `json:"compensations,omitempty"`
+
+	// Spent is what the run consumed of its budget so far.
+	Spent map[Resource]int `json:"spent,omitempty"`
+
+	// Loops are the loops the run is in, outermost first, and Iterations
+	// counts its visits of loop nodes so far.
+	Loops      []Loop `json:"loops,omitempty"`
+	Iterations int    `json:"iterations,omitempty"`
+}
+
+// CompensationTimeout bounds each compensation node run after a failure.
+// Compensations run even when the run itself was cancelled or timed out.
+const CompensationTimeout = 30 * time.Second
+
+// ExecuteFrom runs the graph like Execute, starting from cp when it is not nil.
+// After every node that leads to another one, save is called with the new
+// checkpoint; an error from save stops the run with that error.
+//
+// When the run fails, the compensations of the nodes completed so far run in
+// reverse order, see Node.Compensation. Their steps are added to the trace
+// and the run still fails with the original error.
+//
+// A node that completes without choosing a branch but has several outgoing
+// edges starts a parallel branch per edge. The branches run concurrently and
+// join at a merge node, whose step follows theirs in the trace. Checkpoints
+// are only saved outside of parallel branches, and nodes on them can't pause
+// the run.
+//
+// The context is checked before every node, and handlers pass it to every
+// outbound call, so a cancelled run stops within the node it is running. It
+// then ends with ExecutionStatusInterrupted and the context's error.
+func (e *Executor) ExecuteFrom(ctx context.Context, g *Graph, input map[string]any, cp *Checkpoint, save func(Checkpoint) error) (*Execution, error) {
+	registry, err := e.registry.Pin(Pins(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if registry, err = registry.Bind(Bindings(ctx)); err != nil {
+		return nil, err
+	}
+	if err := registry.Validate(g); err != nil {
+		return nil, err
+	}
+	registry = registry.wrap(e.middleware)
+
+	ec := &ExecutionContext{
+		Ctx:   ctx,
+		Input: input,
+		State: make(map[string]any),
+		memo:  make(map[string]*memoEntry),
+		Clock: ClockFrom(ctx),
+		IDs:   IDGeneratorFrom(ctx),
+
+		iterations: new(atomic.Int64),
+		events:     e.events,
+		limiter:    e.limiter,
+	}
+	var spent map[Resource]int
+	exec := &Execution{
+		Status:    ExecutionStatusCompleted,
+		StartedAt: ec.Clock.Now(),
+	}
+
+	node := g.Start()
+	if cp != nil {
+		var ok bool
+		if node, ok = g.Node(cp.NextNodeID); !ok {
+			return nil, fmt.Errorf("%w: checkpoint node %s", ErrDanglingEdge, cp.NextNodeID)
+		}
+		if cp.State != nil {
+			ec.State = cp.State
+		}
+		ec.Resume = cp.Resume
+		exec.compensations = cp.Compensations
+		spent = cp.Spent
+		ec.loops = cp.Loops
+		ec.iterations.Store(int64(cp.Iterations))
+		exec.Steps = cp.Steps
+		exec.StartedAt = cp.StartedAt
+	}
+	ec.budget = newMeter(BudgetFromLabels(Labels(ctx)), spent)
+	exec.State = ec.State
+	notifyStarted(ctx, exec.StartedAt)
+
+	if _, err := exec.walk(&run{registry: registry, g: g, save: save}, ec, node); err != nil {
+		return exec.fail(registry, g, ec, exec.compensations, err)
+	}
+	if exec.Status != ExecutionStatusPaused {
+		exec.FinishedAt = ec.Clock.Now()
+	}
+	return exec, nil
+}
+
+// run is what the walks of a run, on its main path and on parallel
+// branches, have in common.
+type run struct {
+	registry *Registry
+	g        *Graph
+	save     func(Checkpoint) error
+}
+
+// walk runs the nodes from node on, following their edges, until the run
+// ends, pauses or fails. On a parallel branch it also stops at the first
+// merge node it reaches, which it returns without running it.
+func (exec *Execution) walk(r *run, ec *ExecutionContext, node *Node) (*Node, error) {
+	// joined is set while node is the merge node parallel branches just
+	// joined at, which the walk runs itself.
+	joined := false
+	for node != nil {
+		if ec.branch != "" && node.Type == NodeTypeMerge && !joined {
+			return node, nil
+		}
+		if node.ID == ec.loopEnd {
+			return node, nil
+		}
+		joined = false
+
+		ec.Steps = exec.Steps
+		var (
+			step       ExecutionStep
+			result     *NodeResult
+			iterations []ExecutionStep
+			err        error
+		)
+		if opts := node.loopOptions(); node.Type == NodeTypeLoop && opts != nil && opts.Parallel && !node.Disabled() {
+			step, result, iterations, err = exec.iterate(r, ec, node, opts)
+		} else {
+			step, result, err = runNode(r.registry, ec, node)
+		}
+		ec.Resume = nil
+		if err == nil && result.Await != nil && ec.branch != "" {
+			// A checkpoint can only resume a run at one node.
+			err = &NodeExecutionError{NodeID: node.ID, NodeType: node.Type,
+				Err: fmt.Errorf("%w: nodes on parallel branches can't pause the run", ErrInvalidNode)}
+			step.Status = StepStatusFailed
+			step.Error = err.Error()
+		} else if err == nil && result.Await != nil {
+			// The node runs again on resume, so the checkpoint leaves out its
+			// waiting step.
+			exec.Checkpoint = &Checkpoint{
+				NextNodeID: node.ID,
+				State:      ec.State,
+				Steps:      slices.Clone(exec.Steps),
+				StartedAt:  exec.StartedAt,
+
+				Compensations: slices.Clone(exec.compensations),
+				Spent:         ec.Spent(),
+				Loops:         slices.Clone(ec.loops),
+				Iterations:    ec.runIterations(),
+			}
+			step.Status = StepStatusWaiting
+			exec.record(ec, step)
+			exec.Status = ExecutionStatusPaused
+			exec.Await = result.Await
+			exec.FinishedAt = ec.Clock.Now()
+			return nil, nil
+		}
+
+		exec.record(ec, step)
+		for _, s := range iterations {
+			exec.record(ec, s)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c := node.Compensation(); c != "" && step.Status == StepStatusCompleted {
+			exec.compensations = append(exec.compensations, c)
+		}
+
+		if node.Type == NodeTypeEnd || result.Stop {
+			return nil, nil
+		}
+
+		var next *Node
+		if step.Status == StepStatusCompleted && result.Branch == "" && r.g.FansOut(node.ID) {
+			next, err = exec.parallel(r, ec, node, r.g.Outgoing(node.ID))
+			joined = next != nil
+		} else {
+			next, err = nextNode(r.g, node, result.Branch)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if next != nil && r.save != nil && ec.branch == "" {
+			err := r.save(Checkpoint{
+				NextNodeID:    next.ID,
+				State:         ec.State,
+				Steps:         exec.Steps,
+				StartedAt:     exec.StartedAt,
+				Compensations: exec.compensations,
+				Spent:         ec.Spent(),
+				Loops:         ec.loops,
+				Iterations:    ec.runIterations(),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to save checkpoint: %w", err)
+			}
+		}
+		node = next
+	}
+	return nil, nil
+}
+
+// parallel runs a branch per edge leaving node concurrently, each until it
+// ends or reaches a merge node, and returns the merge node they joined at,
+// or nil if they all ended. Each branch works on its own copy of the state;
+// once all are done their steps, state changes and compensations are added
+// to the run's branch by branch, in edge order, so the trace doesn't depend
+// on which branch finished first. When a branch fails the others are
+// cancelled and the run fails with its error.
+func (exec *Execution) parallel(r *run, ec *ExecutionContext, node *Node, edges []Edge) (*Node, error) {
+	ctx, cancel := context.WithCancelCause(ec.Ctx)
+	defer cancel(nil)
+
+	type branch struct {
+		id   string
+		ec   *ExecutionContext
+		exec *Execution
+		join *Node
+		err  error
+	}
+	branches := make([]*branch, len(edges))
+	var (
+		wg     sync.WaitGroup
+		once   sync.Once
+		failed *branch
+	)
+	for i, e := range edges {
+		id := e.ID
+		if ec.branch != "" {
+			id = ec.branch + "/" + e.ID
+		}
+		b := &branch{id: id, ec: ec.fork(ctx, id)}
+		b.exec = &Execution{Steps: slices.Clone(exec.Steps), State: b.ec.State}
+		branches[i] = b
+		target, _ := r.g.Node(e.Target)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.join, b.err = b.exec.walk(r, b.ec, target)
+			if b.err != nil {
+				once.Do(func() {
+					failed = b
+					cancel(fmt.Errorf("%w: parallel branch %s failed", context.Canceled, b.id))
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	before := len(exec.Steps)
+	forked := maps.Clone(ec.State)
+	var join *Node
+	for _, b := range branches {
+		for _, step := range b.exec.Steps[before:] {
+			if step.ParallelBranch == "" {
+				step.ParallelBranch = b.id
+			}
+			exec.record(ec, step)
+		}
+		maps.Copy(ec.State, stateChanges(forked, b.exec.State))
+		for id, entry := range b.ec.memo {
+			if _, ok := ec.memo[id]; !ok {
+				ec.memo[id] = entry
+			}
+		}
+		exec.compensations = append(exec.compensations, b.exec.compensations...)
+		switch {
+		case b.join == nil:
+		case join == nil:
+			join = b.join
+		case join != b.join && failed == nil:
+			failed = &branch{err: &NodeExecutionError{NodeID: node.ID, NodeType: node.Type,
+				Err: fmt.Errorf("%w: %s and %s", ErrBranchesNotJoined, join.ID, b.join.ID)}}
+		}
+	}
+	if failed != nil {
+		return nil, failed.err
+	}
+	return join, nil
+}
+
+// fail ends a failed run with err, after running the compensations
+// registered so far, latest first. A compensation that fails is recorded in
+// the trace and the others still run.
+func (exec *Execution) fail(registry *Registry, g *Graph, ec *ExecutionContext, compensations []string, err error) (*Execution, error) {
+	for _, id := range slices.Backward(compensations) {
+		node, _ := g.Node(id)
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ec.Ctx), CompensationTimeout)
+		cec := *ec
+		cec.Ctx = ctx
+		cec.Steps = exec.Steps
+		step, _, _ := runNode(registry, &cec, node)
+		cancel()
+		step.Compensation = true
+		step.Iteration = nil
+		exec.record(ec, step)
+	}
+	exec.Status = ExecutionStatusFailed
+	if ctxErr := ec.Ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+		exec.Status = ExecutionStatusInterrupted
+	}
+	exec.FinishedAt = ec.Clock.Now()
+	return exec, err
+}
+
+// record appends step to the trace, passes it to the observer attached to
+// the run's context with WithStepObserver and publishes the node's new state.
+func (exec *Execution) record(ec *ExecutionContext, step ExecutionStep) {
+	exec.Steps = append(exec.Steps, step)
+	if ec.branch != "" {
+		// Steps of parallel branches are reported once the branches joined,
+		// when their index in the trace is known.
+		return
+	}
+	notifyStep(ec.Ctx, len(exec.Steps)-1, step)
+	ec.publish(NodeState(step.Status), len(exec.Steps)-1, step)
+}
+
+func runNode(registry *Registry, ec *ExecutionContext, node *Node) (ExecutionStep, *NodeResult, error) {
+	step := ExecutionStep{
+		NodeID:      node.ID,
+		NodeType:    node.Type,
+		Label:       node.Label,
+		Description: node.Description,
+		StartedAt:   ec.Clock.Now(),
+		Iteration:   ec.iteration(node),
+	}
+
+	fail := func(err error) (ExecutionStep, *NodeResult, error) {
+		step.Status = StepStatusFailed
+		if errors.Is(err, ErrNodeTimeout) {
+			step.Status = StepStatusTimeout
+		}
+		step.Error = err.Error()
+		if class := ErrorClass(err); class != "" {
+			step.Output = map[string]any{"errorClass": string(class)}
+		}
+		step.FinishedAt = ec.Clock.Now()
+		return step, nil, &NodeExecutionError{NodeID: node.ID, NodeType: node.Type, Err: err}
+	}
+
+	if ec.Ctx.Err() != nil {
+		return fail(context.Cause(ec.Ctx))
+	}
+
+	// Disabled nodes pass the run on along their first outgoing edge.
+	if node.Disabled() {
+		step.Status = StepStatusSkipped
+		step.FinishedAt = ec.Clock.Now()
+		return step, &NodeResult{}, nil
+	}
+
+	if entry, ok := ec.memo[node.ID]; ok {
+		for k, v := range entry.stateChanges {
+			ec.State[k] = v
+		}
+		step.Status = StepStatusCompleted
+		step.Description = node.renderDescription(ec.State)
+		step.Output = entry.result.Output
+		step.Memoized = true
+		step.FinishedAt = ec.Clock.Now()
+		return step, entry.result, nil
+	}
+
+	handler, err := registry.Get(node.Type)
+	if err != nil {
+		return fail(err)
+	}
+
+	var before map[string]any
+	if node.Memoizable() {
+		before = maps.Clone(ec.State)
+	}
+
+	// The node's retry policy, timeout and rate limit were checked when the
+	// graph was built.
+	policy, _ := node.RetryPolicy()
+	timeout, _ := node.Timeout()
+	limit, _ := node.RateLimit()
+	ec.publish(NodeStarted, len(ec.Steps), step)
+	var result *NodeResult
+	for {
+		if limit != nil && ec.limiter != nil {
+			var waited time.Duration
+			waited, err = ec.limiter.wait(ec.Ctx, ec.Clock, rateLimitKey(node, limit, ec.State), limit.MaxPerMinute)
+			step.RateLimited += waited
+			if err != nil {
+				break
+			}
+		}
+		step.Attempts++
+		result, err = callHandler(handler, ec, node, timeout)
+		if err == nil || step.Attempts >= policy.MaxAttempts || !policy.retryable(ec.Ctx, err) {
+			break
+		}
+		if waitErr := policy.wait(ec.Ctx, step.Attempts); waitErr != nil {
+			err = waitErr
+			break
+		}
+	}
+	if errors.Is(err, ErrBudgetExceeded) && ec.budget != nil && ec.budget.budget.Skip {
+		// Like disabled nodes, skipped ones pass the run on along their
+		// first outgoing edge.
+		step.Status = StepStatusSkipped
+		step.Error = err.Error()
+		step.FinishedAt = ec.Clock.Now()
+		return step, &NodeResult{}, nil
+	}
+	if err != nil && step.Attempts > 1 {
+		err = fmt.Errorf("%w (after %d attempts)", err, step.Attempts)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if result == nil {
+		result = &NodeResult{}
+	}
+
+	if node.Memoizable() && result.Await == nil {
+		ec.memo[node.ID] = &memoEntry{result: result, stateChanges: stateChanges(before, ec.State)}
+	}
+
+	step.Status = StepStatusCompleted
+	step.Description = node.renderDescription(ec.State)
+	step.Output = result.Output
+	step.FinishedAt = ec.Clock.Now()
+	return step, result, nil
+}
+
+// callHandler runs handler on node. With a timeout the handler gets a
+// context ending after it, and a handler that fails once it has ended
+// returns ErrNodeTimeout. Handlers must honour the context for this to stop
+// them, as the outbound calls of the built-in ones do.
+func callHandler(handler NodeHandler, ec *ExecutionContext, node *Node, timeout time.Duration) (*NodeResult, error) {
+	if timeout <= 0 {
+		return handler.Execute(ec, node)
+	}
+	parent := ec.Ctx
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	ec.Ctx = ctx
+	defer func() { ec.Ctx = parent }()
+
+	result, err := handler.Execute(ec, node)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil {
+		return nil, fmt.Errorf("%w after %s", ErrNodeTimeout, timeout)
+	}
+	return result, err
+}
+
+// nextNode picks the edge to follow after node. If branch is set only edges with
+// a matching source handle are considered. A node without outgoing edges ends
+// the run.
+func nextNode(g *Graph, node *Node, branch string) (*Node, error) {
+	edges := g.Outgoing(node.ID)
+	if branch == "" {
+		if len(edges) == 0 {
+			return nil, nil
+		}
+		target, _ := g.Node(edges[0].Target)
+		return target, nil
+	}
+
+	for _, edge := range edges {
+		if edge.SourceHandle == branch {
+			target, _ := g.Node(edge.Target)
+			return target, nil
+		}
+	}
+	return nil, &NodeExecutionError{
+		NodeID:   node.ID,
+		NodeType: node.Type,
+		Err:      fmt.Errorf("%w: %q", ErrNoMatchingBranch, branch),
+	}
+}
+
+// Validate checks that every node of the graph can be executed.
+func (e *Executor) Validate(g *Graph) error {
+	return e.registry.Validate(g)
+}
+
+// memoEntry is the cached outcome of a memoizable node: its result and the
+// state variables it set, which are applied again when the result is reused.
+type memoEntry struct {
+	result       *NodeResult
+	stateChanges map[string]any
+}
+
+// stateChanges returns the variables of after that are new or different from
+// before.
+func stateChanges(before, after map[string]any) map[string]any {
+	changes := make(map[string]any)
+	for k, v := range after {
+		if old, ok := before[k]; !ok || !reflect.DeepEqual(old, v) {
+			changes[k] = v
+		}
+	}
+	return changes
+}
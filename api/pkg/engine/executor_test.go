@@ -0,0 +1,218 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/engine/handlers"
+)
+
+// cancelBound is how soon a cancelled run must return.
+const cancelBound = time.Second
+
+const (
+	nodeTypeBlock = "block"
+	nodeTypeCount = "count"
+)
+
+// blockingRegistry registers a block handler that signals started and then
+// waits for its context, or for release when it ignores its context, and a
+// count handler that counts its calls.
+func blockingRegistry(started chan<- string, release <-chan struct{}, ignoreCtx bool, calls *atomic.Int64) *engine.Registry {
+	r := engine.NewRegistry()
+	r.Register(engine.NodeTypeStart, engine.HandlerFunc(handlers.Start))
+	r.Register(engine.NodeTypeEnd, engine.HandlerFunc(handlers.End))
+	r.Register(engine.NodeTypeMerge, engine.HandlerFunc(handlers.Merge))
+	r.Register(nodeTypeBlock, engine.HandlerFunc(func(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+		started <- node.ID
+		if ignoreCtx {
+			<-release
+			return &engine.NodeResult{}, nil
+		}
+		<-ec.Ctx.Done()
+		return nil, ec.Ctx.Err()
+	}))
+	r.Register(nodeTypeCount, engine.HandlerFunc(func(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+		calls.Add(1)
+		return &engine.NodeResult{}, nil
+	}))
+	return r
+}
+
+// execute runs g in the background and returns a channel receiving its
+// execution and error.
+func execute(ctx context.Context, executor *engine.Executor, g *engine.Graph) <-chan runResult {
+	done := make(chan runResult, 1)
+	go func() {
+		exec, err := executor.Execute(ctx, g, nil)
+		done <- runResult{exec, err}
+	}()
+	return done
+}
+
+type runResult struct {
+	exec *engine.Execution
+	err  error
+}
+
+// await returns the result of a run that must end within cancelBound.
+func await(t *testing.T, done <-chan runResult) runResult {
+	t.Helper()
+	select {
+	case res := <-done:
+		return res
+	case <-time.After(cancelBound):
+		t.Fatalf("cancelled run did not return within %s", cancelBound)
+		return runResult{}
+	}
+}
+
+// checkInterrupted verifies that a cancelled run ended interrupted with the
+// context's error, with steps for the nodes in path.
+func checkInterrupted(t *testing.T, res runResult, path ...string) {
+	t.Helper()
+	if !errors.Is(res.err, context.Canceled) {
+		t.Errorf("run error = %v, want context.Canceled", res.err)
+	}
+	var nodeErr *engine.NodeExecutionError
+	if !errors.As(res.err, &nodeErr) {
+		t.Errorf("run error %v is not a node error", res.err)
+	}
+	if res.exec == nil {
+		t.Fatal("cancelled run returned no execution")
+	}
+	if res.exec.Status != engine.ExecutionStatusInterrupted {
+		t.Errorf("status = %s, want %s", res.exec.Status, engine.ExecutionStatusInterrupted)
+	}
+	if res.exec.FinishedAt.IsZero() {
+		t.Error("interrupted run has no finish time")
+	}
+	var got []string
+	for _, step := range res.exec.Steps {
+		got = append(got, step.NodeID)
+	}
+	if !slices.Equal(got, path) {
+		t.Errorf("steps = %v, want %v", got, path)
+	}
+	if last := res.exec.Steps[len(res.exec.Steps)-1]; last.Status != engine.StepStatusFailed {
+		t.Errorf("last step %s has status %s, want failed", last.NodeID, last.Status)
+	}
+}
+
+// line builds start -> nodes... -> end.
+func line(t *testing.T, nodes ...engine.Node) *engine.Graph {
+	t.Helper()
+	all := append([]engine.Node{{ID: "start", Type: engine.NodeTypeStart}}, nodes...)
+	all = append(all, engine.Node{ID: "end", Type: engine.NodeTypeEnd})
+	var edges []engine.Edge
+	for i := 1; i < len(all); i++ {
+		edges = append(edges, engine.Edge{ID: "e" + all[i].ID, Source: all[i-1].ID, Target: all[i].ID})
+	}
+	g, err := engine.NewGraph(all, edges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestExecuteCancelledMidRun(t *testing.T) {
+	started := make(chan string, 1)
+	var calls atomic.Int64
+	executor := engine.NewExecutor(blockingRegistry(started, nil, false, &calls))
+	g := line(t, engine.Node{ID: "block", Type: nodeTypeBlock}, engine.Node{ID: "after", Type: nodeTypeCount})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := execute(ctx, executor, g)
+	<-started
+	cancel()
+
+	res := await(t, done)
+	checkInterrupted(t, res, "start", "block")
+	if n := calls.Load(); n != 0 {
+		t.Errorf("node after the cancellation ran %d times", n)
+	}
+}
+
+func TestExecuteCancelledHandlerIgnoringContext(t *testing.T) {
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	var calls atomic.Int64
+	executor := engine.NewExecutor(blockingRegistry(started, release, true, &calls))
+	g := line(t, engine.Node{ID: "block", Type: nodeTypeBlock}, engine.Node{ID: "after", Type: nodeTypeCount})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := execute(ctx, executor, g)
+	<-started
+	cancel()
+	close(release)
+
+	// The node running when the run was cancelled completes; the next one
+	// fails without calling its handler.
+	res := await(t, done)
+	checkInterrupted(t, res, "start", "block", "after")
+	if res.exec.Steps[1].Status != engine.StepStatusCompleted {
+		t.Errorf("block step has status %s, want completed", res.exec.Steps[1].Status)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("node after the cancellation ran %d times", n)
+	}
+}
+
+func TestExecuteCancelledParallelBranches(t *testing.T) {
+	started := make(chan string, 2)
+	var calls atomic.Int64
+	executor := engine.NewExecutor(blockingRegistry(started, nil, false, &calls))
+	g, err := engine.NewGraph([]engine.Node{
+		{ID: "start", Type: engine.NodeTypeStart},
+		{ID: "left", Type: nodeTypeBlock},
+		{ID: "right", Type: nodeTypeBlock},
+		{ID: "join", Type: engine.NodeTypeMerge},
+		{ID: "after", Type: nodeTypeCount},
+		{ID: "end", Type: engine.NodeTypeEnd},
+	}, []engine.Edge{
+		{ID: "e1", Source: "start", Target: "left"},
+		{ID: "e2", Source: "start", Target: "right"},
+		{ID: "e3", Source: "left", Target: "join"},
+		{ID: "e4", Source: "right", Target: "join"},
+		{ID: "e5", Source: "join", Target: "after"},
+		{ID: "e6", Source: "after", Target: "end"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := execute(ctx, executor, g)
+	<-started
+	<-started
+	cancel()
+
+	res := await(t, done)
+	checkInterrupted(t, res, "start", "left", "right")
+	if n := calls.Load(); n != 0 {
+		t.Errorf("node after the join ran %d times", n)
+	}
+}
+
+func TestExecuteCancelledBeforeStart(t *testing.T) {
+	var calls atomic.Int64
+	executor := engine.NewExecutor(blockingRegistry(nil, nil, false, &calls))
+	g := line(t, engine.Node{ID: "after", Type: nodeTypeCount})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	res := await(t, execute(ctx, executor, g))
+	checkInterrupted(t, res, "start")
+	if n := calls.Load(); n != 0 {
+		t.Errorf("node of a cancelled run ran %d times", n)
+	}
+}
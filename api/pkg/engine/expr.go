@@ -0,0 +1,234 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EvalNumber evaluates an arithmetic expression such as "acc + item * 2".
+// It supports numbers, + - * / %, unary minus, parentheses and identifiers,
+// which are looked up in vars. Dotted identifiers (e.g. "item.temp") walk
+// nested objects.
+func EvalNumber(expr string, vars map[string]any) (float64, error) {
+	e, err := CompileExpr(expr)
+	if err != nil {
+		return 0, err
+	}
+	return e.Eval(vars)
+}
+
+// Expr is a parsed arithmetic expression, see EvalNumber. It can be evaluated
+// any number of times, concurrently.
+type Expr struct {
+	src  string
+	eval exprFunc
+}
+
+// exprFunc evaluates one parsed subexpression.
+type exprFunc func(vars map[string]any) (float64, error)
+
+// CompileExpr parses an expression for EvalNumber once. Syntax errors are
+// reported here; unknown variables only when the expression is evaluated.
+func CompileExpr(expr string) (*Expr, error) {
+	p := &exprParser{src: expr}
+	p.next()
+	eval, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("unexpected %q in expression %q", p.tok, expr)
+	}
+	return &Expr{src: expr, eval: eval}, nil
+}
+
+// Eval evaluates the expression with identifiers looked up in vars.
+func (e *Expr) Eval(vars map[string]any) (float64, error) {
+	return e.eval(vars)
+}
+
+// String returns the expression's source.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Lookup resolves a dotted path such as "weather.current.temp" in vars.
+func Lookup(vars map[string]any, path string) (any, bool) {
+	var cur any = vars
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// exprParser is a recursive descent parser that builds an exprFunc.
+type exprParser struct {
+	src string
+	pos int
+	tok string
+}
+
+// next advances to the next token; tok is empty at the end of the input.
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		p.tok = ""
+		return
+	}
+
+	start := p.pos
+	c := rune(p.src[p.pos])
+	switch {
+	case unicode.IsDigit(c) || c == '.':
+		for p.pos < len(p.src) && (unicode.IsDigit(rune(p.src[p.pos])) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+	case unicode.IsLetter(c) || c == '_':
+		for p.pos < len(p.src) {
+			r := rune(p.src[p.pos])
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' {
+				break
+			}
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+// binary combines two operands with op, evaluating both before calling it.
+func binary(left, right exprFunc, op func(l, r float64) (float64, error)) exprFunc {
+	return func(vars map[string]any) (float64, error) {
+		l, err := left(vars)
+		if err != nil {
+			return 0, err
+		}
+		r, err := right(vars)
+		if err != nil {
+			return 0, err
+		}
+		return op(l, r)
+	}
+}
+
+func (p *exprParser) parseSum() (exprFunc, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "+" || p.tok == "-" {
+		op := p.tok
+		p.next()
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binary(left, right, func(l, r float64) (float64, error) {
+			if op == "+" {
+				return l + r, nil
+			}
+			return l - r, nil
+		})
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseProduct() (exprFunc, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	src := p.src
+	for p.tok == "*" || p.tok == "/" || p.tok == "%" {
+		op := p.tok
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary(left, right, func(l, r float64) (float64, error) {
+			switch op {
+			case "*":
+				return l * r, nil
+			case "/":
+				if r == 0 {
+					return 0, fmt.Errorf("division by zero in expression %q", src)
+				}
+				return l / r, nil
+			default:
+				if r == 0 {
+					return 0, fmt.Errorf("division by zero in expression %q", src)
+				}
+				return math.Mod(l, r), nil
+			}
+		})
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprFunc, error) {
+	if p.tok == "-" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(vars map[string]any) (float64, error) {
+			v, err := operand(vars)
+			return -v, err
+		}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprFunc, error) {
+	tok, src := p.tok, p.src
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression %q", src)
+	case tok == "(":
+		p.next()
+		inner, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("missing ) in expression %q", src)
+		}
+		p.next()
+		return inner, nil
+	case unicode.IsDigit(rune(tok[0])) || tok[0] == '.':
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in expression %q", tok, src)
+		}
+		p.next()
+		return func(map[string]any) (float64, error) { return v, nil }, nil
+	case unicode.IsLetter(rune(tok[0])) || tok[0] == '_':
+		p.next()
+		return func(vars map[string]any) (float64, error) {
+			raw, ok := Lookup(vars, tok)
+			if !ok {
+				return 0, fmt.Errorf("unknown variable %q in expression %q", tok, src)
+			}
+			v, err := ToFloat(raw)
+			if err != nil {
+				return 0, fmt.Errorf("variable %s: %w", tok, err)
+			}
+			return v, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q in expression %q", tok, src)
+}
@@ -0,0 +1,389 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/engine/handlers"
+)
+
+const (
+	nodeTypeNoop  = "noop"
+	nodeTypeSetup = "setup"
+	nodeTypeFail  = "fail"
+
+	// nodeTypeCancel cancels the context of the run it is part of, like a
+	// client going away while the node runs.
+	nodeTypeCancel = "cancel"
+
+	// runTimeout bounds a single execution; exceeding it means the executor
+	// didn't terminate.
+	runTimeout = 2 * time.Second
+)
+
+var (
+	operators = []string{"greater_than", "less_than", "equals", "greater_than_or_equal", "less_than_or_equal"}
+	handles   = []string{"", "", "true", "false", "other", handlers.LoopBody, handlers.LoopDone}
+)
+
+// FuzzExecutor runs the engine against graphs generated from a seed and
+// checks invariants that must hold for any input: building never panics,
+// runs terminate, every step references a node of the graph and follows an
+// edge from an earlier step, condition nodes take the branch matching their
+// verdict, a run whose context is cancelled starts no further node and ends
+// interrupted, steps carry every output key their handler returned, and runs
+// with parallel branches record the same trace every time. Run it with
+// `make fuzz`.
+func FuzzExecutor(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed, uint8(20))
+	}
+	executor := engine.NewExecutor(fuzzRegistry())
+	f.Fuzz(func(t *testing.T, seed uint64, maxNodes uint8) {
+		if err := checkRun(executor, seed, min(max(int(maxNodes), 1), 32)); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// fuzzSeeds generate, with up to 20 nodes, invalid graphs (1, 3), failing
+// runs (2, 10), cancelled runs (46, 151), custom outputs (66, 84), loops
+// (88, 171), parallel branches joined at merge nodes (1340, 1425) and a
+// condition taking a branch (7854).
+var fuzzSeeds = []uint64{1, 2, 3, 10, 46, 66, 84, 88, 151, 171, 1340, 1425, 7854}
+
+func fuzzRegistry() *engine.Registry {
+	r := engine.NewRegistry()
+	r.Register(engine.NodeTypeStart, engine.HandlerFunc(handlers.Start))
+	r.Register(engine.NodeTypeEnd, engine.HandlerFunc(handlers.End))
+	r.Register(engine.NodeTypeMerge, engine.HandlerFunc(handlers.Merge))
+	r.Register(engine.NodeTypeLoop, engine.HandlerFunc(handlers.Loop))
+	r.Register("condition", engine.HandlerFunc(handlers.Condition))
+	// Noop nodes output what their metadata holds, like a custom handler with
+	// keys no built-in node type has.
+	r.Register(nodeTypeNoop, engine.HandlerFunc(func(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+		output, _ := node.Metadata["output"].(map[string]any)
+		return &engine.NodeResult{Output: maps.Clone(output)}, nil
+	}))
+	r.Register(nodeTypeSetup, engine.HandlerFunc(func(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+		ec.State["temperature"] = node.Metadata["temperature"]
+		return &engine.NodeResult{}, nil
+	}))
+	r.Register(nodeTypeFail, engine.HandlerFunc(func(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+		return nil, errors.New("injected failure")
+	}))
+	r.Register(nodeTypeCancel, engine.HandlerFunc(func(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+		ec.Ctx.Value(cancelKey{}).(context.CancelFunc)()
+		return &engine.NodeResult{}, nil
+	}))
+	return r
+}
+
+// cancelKey holds the function cancelling a run in its context.
+type cancelKey struct{}
+
+// randomGraph generates nodes and edges that may or may not form a valid graph.
+func randomGraph(rng *rand.Rand, maxNodes int) ([]engine.Node, []engine.Edge) {
+	types := []string{nodeTypeNoop, nodeTypeNoop, nodeTypeSetup, "condition", engine.NodeTypeEnd, engine.NodeTypeMerge, engine.NodeTypeLoop, nodeTypeFail, nodeTypeCancel}
+
+	count := 1 + rng.IntN(maxNodes)
+	nodes := make([]engine.Node, 0, count)
+	for i := range count {
+		n := engine.Node{ID: "n" + strconv.Itoa(i), Type: types[rng.IntN(len(types))]}
+		switch {
+		case i == 0 || rng.IntN(50) == 0:
+			// Usually exactly one start node, occasionally several.
+			n.Type = engine.NodeTypeStart
+		case rng.IntN(100) == 0:
+			// Occasional duplicate id.
+			n.ID = "n" + strconv.Itoa(rng.IntN(i))
+		}
+		switch n.Type {
+		case nodeTypeNoop:
+			if rng.IntN(2) == 0 {
+				n.Metadata = map[string]any{"output": randomOutput(rng)}
+			}
+		case nodeTypeSetup:
+			n.Metadata = map[string]any{"temperature": float64(rng.IntN(80) - 20)}
+		case "condition":
+			n.Metadata = map[string]any{
+				"operator":  operators[rng.IntN(len(operators))],
+				"threshold": float64(rng.IntN(80) - 20),
+			}
+		case engine.NodeTypeLoop:
+			n.Metadata = map[string]any{"maxIterations": float64(1 + rng.IntN(3))}
+		}
+		nodes = append(nodes, n)
+	}
+
+	edgeCount := rng.IntN(count * 2)
+	edges := make([]engine.Edge, 0, edgeCount)
+	for i := range edgeCount {
+		source, target := rng.IntN(count), rng.IntN(count)
+		if rng.IntN(10) > 0 && source > target {
+			// Mostly forward edges so a good share of graphs is acyclic.
+			source, target = target, source
+		}
+		e := engine.Edge{
+			ID:           "e" + strconv.Itoa(i),
+			Source:       "n" + strconv.Itoa(source),
+			Target:       "n" + strconv.Itoa(target),
+			SourceHandle: handles[rng.IntN(len(handles))],
+		}
+		if rng.IntN(100) == 0 {
+			e.Target = "missing"
+		}
+		edges = append(edges, e)
+	}
+	return nodes, edges
+}
+
+// outputKeys are keys of custom handler outputs, which the engine mustn't
+// know about.
+var outputKeys = []string{"smsContent", "flood", "riverLevel", "alerts", "x-custom"}
+
+// randomOutput returns an output with some of outputKeys, holding scalars,
+// lists and nested objects.
+func randomOutput(rng *rand.Rand) map[string]any {
+	output := make(map[string]any)
+	for _, key := range outputKeys {
+		switch rng.IntN(4) {
+		case 0:
+			output[key] = "value " + strconv.Itoa(rng.IntN(100))
+		case 1:
+			output[key] = []any{float64(rng.IntN(10)), true, nil}
+		case 2:
+			output[key] = map[string]any{"level": float64(rng.IntN(10)), "unit": "m"}
+		}
+	}
+	return output
+}
+
+// checkRun generates the graph for seed and verifies the invariants.
+func checkRun(executor *engine.Executor, seed uint64, maxNodes int) error {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	nodes, edges := randomGraph(rng, maxNodes)
+
+	g, err := engine.NewGraph(nodes, edges)
+	if err != nil {
+		if !engine.IsGraphError(err) {
+			return fmt.Errorf("NewGraph returned a non-graph error: %w", err)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+	defer cancel()
+	ctx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	exec, err := executor.Execute(context.WithValue(ctx, cancelKey{}, cancelRun), g, nil)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("execution did not terminate within %s", runTimeout)
+	}
+	if exec == nil {
+		if err == nil {
+			return errors.New("nil execution without an error")
+		}
+		return nil
+	}
+	if err != nil {
+		var nodeErr *engine.NodeExecutionError
+		if !errors.As(err, &nodeErr) {
+			return fmt.Errorf("run failed with a non-node error: %w", err)
+		}
+		want := engine.ExecutionStatusFailed
+		if errors.Is(err, context.Canceled) {
+			want = engine.ExecutionStatusInterrupted
+		}
+		if exec.Status != want {
+			return fmt.Errorf("run failed with %v has status %s", err, exec.Status)
+		}
+	}
+
+	if err := checkCancellation(exec, err); err != nil {
+		return err
+	}
+	if err := checkSteps(g, exec); err != nil {
+		return err
+	}
+	if err == nil && slices.ContainsFunc(exec.Steps, func(s engine.ExecutionStep) bool { return s.ParallelBranch != "" }) &&
+		!slices.ContainsFunc(exec.Steps, func(s engine.ExecutionStep) bool { return s.NodeType == nodeTypeCancel }) {
+		return checkDeterministic(executor, g, exec)
+	}
+	return nil
+}
+
+// checkDeterministic runs g again and verifies that the trace lists the same
+// steps in the same order, however its parallel branches were scheduled.
+func checkDeterministic(executor *engine.Executor, g *engine.Graph, first *engine.Execution) error {
+	ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+	defer cancel()
+	again, err := executor.Execute(ctx, g, nil)
+	if err != nil {
+		return fmt.Errorf("second run failed: %w", err)
+	}
+	key := func(s engine.ExecutionStep) string { return s.ParallelBranch + "/" + s.NodeID }
+	want, got := make([]string, len(first.Steps)), make([]string, len(again.Steps))
+	for i, s := range first.Steps {
+		want[i] = key(s)
+	}
+	for i, s := range again.Steps {
+		got[i] = key(s)
+	}
+	if !slices.Equal(want, got) {
+		return fmt.Errorf("second run recorded steps %v, the first %v", got, want)
+	}
+	return nil
+}
+
+// checkCancellation verifies that a run stops at the first node after its
+// context is cancelled: that node fails without running and the run ends
+// interrupted. Parallel branches other than the cancelling node's may have
+// run further before they noticed.
+func checkCancellation(exec *engine.Execution, runErr error) error {
+	i := slices.IndexFunc(exec.Steps, func(s engine.ExecutionStep) bool { return s.NodeType == nodeTypeCancel })
+	if i < 0 {
+		return nil
+	}
+	var after []engine.ExecutionStep
+	for _, step := range exec.Steps[i+1:] {
+		if step.ParallelBranch == exec.Steps[i].ParallelBranch {
+			after = append(after, step)
+		}
+	}
+	if len(after) == 0 {
+		return nil
+	}
+	if len(after) > 1 {
+		return fmt.Errorf("%d steps ran after the run was cancelled", len(after))
+	}
+	if step := after[0]; step.Status != engine.StepStatusFailed {
+		return fmt.Errorf("step %s after the cancellation has status %s", step.NodeID, step.Status)
+	}
+	if !errors.Is(runErr, context.Canceled) || exec.Status != engine.ExecutionStatusInterrupted {
+		return fmt.Errorf("cancelled run has status %s and error %v", exec.Status, runErr)
+	}
+	return nil
+}
+
+// checkSteps verifies the trace of a run against the graph.
+func checkSteps(g *engine.Graph, exec *engine.Execution) error {
+	if len(exec.Steps) == 0 {
+		return errors.New("execution has no steps")
+	}
+	if exec.Steps[0].NodeID != g.Start().ID {
+		return fmt.Errorf("first step %s is not the start node", exec.Steps[0].NodeID)
+	}
+	// Parallel branches only meet at merge nodes, which run once, so only
+	// loop bodies run nodes again.
+	parallel := slices.ContainsFunc(exec.Steps, func(s engine.ExecutionStep) bool { return s.ParallelBranch != "" })
+	loops := slices.ContainsFunc(exec.Steps, func(s engine.ExecutionStep) bool { return s.NodeType == engine.NodeTypeLoop })
+	if !loops {
+		ran := make(map[string]bool, len(exec.Steps))
+		for i, step := range exec.Steps {
+			if ran[step.NodeID] {
+				return fmt.Errorf("step %d runs node %s again outside of a loop", i, step.NodeID)
+			}
+			ran[step.NodeID] = true
+		}
+	}
+
+	for i, step := range exec.Steps {
+		if _, ok := g.Node(step.NodeID); !ok {
+			return fmt.Errorf("step %d references unknown node %s", i, step.NodeID)
+		}
+		if step.Status.Failed() && slices.ContainsFunc(exec.Steps[i+1:], func(s engine.ExecutionStep) bool {
+			return s.ParallelBranch == step.ParallelBranch
+		}) {
+			return fmt.Errorf("step %d failed but its branch continued", i)
+		}
+		if err := checkOutput(g, step); err != nil {
+			return fmt.Errorf("step %d: %w", i, err)
+		}
+		if i == 0 {
+			continue
+		}
+
+		// Scan backwards: in long loops the step followed is usually the
+		// one before.
+		follows := false
+		for _, prev := range slices.Backward(exec.Steps[:i]) {
+			if follows = followsEdge(g, prev, step.NodeID, parallel); follows {
+				break
+			}
+		}
+		if !follows {
+			return fmt.Errorf("step %d (%s) does not follow an edge from an earlier step", i, step.NodeID)
+		}
+	}
+	return nil
+}
+
+// checkOutput verifies that a completed noop step carries the output its node
+// was given, key for key.
+func checkOutput(g *engine.Graph, step engine.ExecutionStep) error {
+	if step.NodeType != nodeTypeNoop || step.Status != engine.StepStatusCompleted {
+		return nil
+	}
+	node, _ := g.Node(step.NodeID)
+	want, _ := node.Metadata["output"].(map[string]any)
+	for key, v := range want {
+		got, ok := step.Output[key]
+		if !ok {
+			return fmt.Errorf("output %q of node %s was dropped", key, step.NodeID)
+		}
+		if !reflect.DeepEqual(got, v) {
+			return fmt.Errorf("output %q of node %s is %v, want %v", key, step.NodeID, got, v)
+		}
+	}
+	if len(step.Output) != len(want) {
+		return fmt.Errorf("node %s output %d keys, the step has %d", step.NodeID, len(want), len(step.Output))
+	}
+	return nil
+}
+
+// followsEdge reports whether the executor may go from the node of step to
+// target. Condition nodes follow the edge with the handle of their verdict,
+// loop nodes the one of their body until they're done; other nodes their
+// first edge, or, when they fan out, any.
+func followsEdge(g *engine.Graph, step engine.ExecutionStep, target string, parallel bool) bool {
+	edges := g.Outgoing(step.NodeID)
+	var branch string
+	switch step.NodeType {
+	case "condition":
+		met, ok := step.Output["conditionMet"].(bool)
+		if !ok {
+			return false
+		}
+		branch = strconv.FormatBool(met)
+	case engine.NodeTypeLoop:
+		done, ok := step.Output["done"].(bool)
+		if !ok {
+			return false
+		}
+		branch = handlers.LoopBody
+		if done {
+			branch = handlers.LoopDone
+		}
+	default:
+		if parallel && step.Status == engine.StepStatusCompleted && g.FansOut(step.NodeID) {
+			return slices.ContainsFunc(edges, func(e engine.Edge) bool { return e.Target == target })
+		}
+		return len(edges) > 0 && edges[0].Target == target
+	}
+	for _, e := range edges {
+		if e.SourceHandle == branch {
+			return e.Target == target
+		}
+	}
+	return false
+}
@@ -0,0 +1,352 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Node types with special meaning to the executor.
+const (
+	NodeTypeStart = "start"
+	NodeTypeEnd   = "end"
+
+	// NodeTypeMerge joins the parallel branches started by a fan-out node,
+	// see Graph.FansOut.
+	NodeTypeMerge = "merge"
+
+	// NodeTypeLoop repeats the nodes on its "body" branch, which lead back
+	// to it, before taking its "done" branch. Cycles must pass through one.
+	NodeTypeLoop = "loop"
+)
+
+// Node is a single executable step of a workflow.
+type Node struct {
+	ID          string
+	Type        string
+	Label       string
+	Description string
+	Metadata    map[string]any
+
+	// Set by Registry.Compile.
+	compiled    any
+	description *Template
+}
+
+// Edge connects two nodes. SourceHandle selects the branch of the source node
+// the edge belongs to (e.g. "true"/"false" for condition nodes).
+type Edge struct {
+	ID           string
+	Source       string
+	Target       string
+	SourceHandle string
+}
+
+// Graph is a validated, immutable view of a workflow definition.
+type Graph struct {
+	nodes    map[string]*Node
+	order    []string
+	edges    []Edge
+	outgoing map[string][]Edge
+	start    string
+
+	// finished numbers the nodes in the order checkAcyclic's search finished
+	// them. A node reachable from another one without passing a loop node
+	// finishes before it.
+	finished map[string]int
+}
+
+// NewGraph builds a Graph from nodes and edges. It checks that there is exactly
+// one start node, that edges and compensations only reference known nodes,
+// that retry policies, timeouts and rate limits are valid, that every cycle
+// passes through a loop node and that parallel branches only meet at merge
+// nodes.
+func NewGraph(nodes []Node, edges []Edge) (*Graph, error) {
+	g := &Graph{
+		nodes:    make(map[string]*Node, len(nodes)),
+		outgoing: make(map[string][]Edge),
+	}
+
+	for i := range nodes {
+		n := nodes[i]
+		if _, exists := g.nodes[n.ID]; exists {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateNode, n.ID)
+		}
+		if n.Type == NodeTypeStart {
+			if g.start != "" {
+				return nil, fmt.Errorf("%w: %s and %s", ErrMultipleStartNodes, g.start, n.ID)
+			}
+			g.start = n.ID
+		}
+		g.nodes[n.ID] = &n
+		g.order = append(g.order, n.ID)
+	}
+
+	if g.start == "" {
+		return nil, ErrNoStartNode
+	}
+
+	for _, e := range edges {
+		if _, ok := g.nodes[e.Source]; !ok {
+			return nil, fmt.Errorf("%w: edge %s source %s", ErrDanglingEdge, e.ID, e.Source)
+		}
+		if _, ok := g.nodes[e.Target]; !ok {
+			return nil, fmt.Errorf("%w: edge %s target %s", ErrDanglingEdge, e.ID, e.Target)
+		}
+		g.outgoing[e.Source] = append(g.outgoing[e.Source], e)
+		g.edges = append(g.edges, e)
+	}
+
+	for _, id := range g.order {
+		n := g.nodes[id]
+		if c := n.Compensation(); c != "" {
+			if _, ok := g.nodes[c]; !ok {
+				return nil, fmt.Errorf("%w: node %s compensates with unknown node %s", ErrInvalidCompensation, n.ID, c)
+			}
+			if c == n.ID {
+				return nil, fmt.Errorf("%w: node %s compensates with itself", ErrInvalidCompensation, n.ID)
+			}
+		}
+		if _, err := n.RetryPolicy(); err != nil {
+			return nil, fmt.Errorf("node %s: %w: %v", n.ID, ErrInvalidNode, err)
+		}
+		if _, err := n.Timeout(); err != nil {
+			return nil, fmt.Errorf("node %s: %w: %v", n.ID, ErrInvalidNode, err)
+		}
+		if _, err := n.RateLimit(); err != nil {
+			return nil, fmt.Errorf("node %s: %w: %v", n.ID, ErrInvalidNode, err)
+		}
+	}
+
+	if err := g.checkAcyclic(); err != nil {
+		return nil, err
+	}
+	if err := g.checkJoins(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// Start returns the start node.
+func (g *Graph) Start() *Node {
+	return g.nodes[g.start]
+}
+
+// Node returns the node with the given id.
+func (g *Graph) Node(id string) (*Node, bool) {
+	n, ok := g.nodes[id]
+	return n, ok
+}
+
+// Nodes returns all nodes in definition order.
+func (g *Graph) Nodes() []*Node {
+	nodes := make([]*Node, 0, len(g.order))
+	for _, id := range g.order {
+		nodes = append(nodes, g.nodes[id])
+	}
+	return nodes
+}
+
+// Edges returns all edges in definition order.
+func (g *Graph) Edges() []Edge {
+	return g.edges
+}
+
+// Outgoing returns the edges leaving the given node in definition order.
+func (g *Graph) Outgoing(id string) []Edge {
+	return g.outgoing[id]
+}
+
+// FansOut reports whether node id starts a parallel branch per outgoing edge
+// when it completes: it has several outgoing edges and none of them belongs
+// to a branch the node picks, like the "true" and "false" ones of a
+// condition.
+func (g *Graph) FansOut(id string) bool {
+	edges := g.outgoing[id]
+	return len(edges) > 1 && !slices.ContainsFunc(edges, func(e Edge) bool { return e.SourceHandle != "" })
+}
+
+// checkAcyclic runs a depth-first search over the whole graph and returns
+// ErrCycle if a back edge is found. The edges leaving loop nodes are left
+// out, so only cycles through a loop node are allowed.
+func (g *Graph) checkAcyclic() error {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(g.nodes))
+	g.finished = make(map[string]int, len(g.nodes))
+
+	var visit func(id string) error
+	visit = func(id string) error {
+		state[id] = visiting
+		if g.nodes[id].Type == NodeTypeLoop {
+			state[id] = done
+			g.finished[id] = len(g.finished)
+			return nil
+		}
+		for _, e := range g.outgoing[id] {
+			switch state[e.Target] {
+			case visiting:
+				return fmt.Errorf("%w: %s -> %s", ErrCycle, id, e.Target)
+			case unvisited:
+				if err := visit(e.Target); err != nil {
+					return err
+				}
+			}
+		}
+		state[id] = done
+		g.finished[id] = len(g.finished)
+		return nil
+	}
+
+	for _, id := range g.order {
+		if state[id] == unvisited {
+			if err := visit(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkJoins returns ErrBranchesMeet if two parallel branches of a fan-out
+// node, or a branch and the nodes after the merge node they join at, can
+// reach the same node other than a merge node, which would then run more
+// than once.
+func (g *Graph) checkJoins() error {
+	branches := make(map[string]*branchReach)
+	for _, id := range g.order {
+		if !g.FansOut(id) {
+			continue
+		}
+		if _, _, err := g.fanOut(id, branches); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// branchReach is what a parallel branch may run: its nodes, the merge nodes
+// it stops at and whether branches inside it meet.
+type branchReach struct {
+	nodes []string
+	joins []string
+	err   error
+}
+
+// reach returns what a parallel branch starting at node id may run, taking
+// every edge a node may follow, the way Execution.walk goes: a nested fan-out
+// runs its branches and goes on from the merge node they join at. Results
+// are cached in branches; a branch reached again while it is being computed,
+// through a loop, counts as empty there.
+func (g *Graph) reach(id string, branches map[string]*branchReach) *branchReach {
+	if b, ok := branches[id]; ok {
+		return b
+	}
+	b := &branchReach{}
+	branches[id] = b
+
+	seen := make(map[string]bool)
+	var visit func(id string, joined bool)
+	visit = func(id string, joined bool) {
+		if seen[id] || b.err != nil {
+			return
+		}
+		n := g.nodes[id]
+		if n.Type == NodeTypeMerge && !joined {
+			if !slices.Contains(b.joins, id) {
+				b.joins = append(b.joins, id)
+			}
+			return
+		}
+		seen[id] = true
+		b.nodes = append(b.nodes, id)
+		if n.Type == NodeTypeEnd {
+			return
+		}
+		if !g.FansOut(id) {
+			for _, e := range g.outgoing[id] {
+				visit(e.Target, false)
+			}
+			return
+		}
+		nodes, joins, err := g.fanOut(id, branches)
+		if err != nil {
+			b.err = err
+			return
+		}
+		for _, n := range nodes {
+			if !seen[n] {
+				seen[n] = true
+				b.nodes = append(b.nodes, n)
+			}
+		}
+		for _, join := range joins {
+			visit(join, true)
+		}
+	}
+	visit(id, false)
+	return b
+}
+
+// fanOut returns the nodes the parallel branches of the fan-out node id may
+// run and the merge nodes they join at, or ErrBranchesMeet if two branches,
+// or a branch and the nodes after a merge node, can reach the same node.
+func (g *Graph) fanOut(id string, branches map[string]*branchReach) (nodes, joins []string, err error) {
+	owner := make(map[string]string)
+	first := len(g.nodes)
+	for _, e := range g.outgoing[id] {
+		b := g.reach(e.Target, branches)
+		if b.err != nil {
+			return nil, nil, b.err
+		}
+		for _, n := range b.nodes {
+			if other, ok := owner[n]; ok {
+				return nil, nil, fmt.Errorf("%w: branches %s and %s of node %s both reach %s", ErrBranchesMeet, other, e.ID, id, n)
+			}
+			owner[n] = e.ID
+			nodes = append(nodes, n)
+			first = min(first, g.finished[n])
+		}
+		for _, join := range b.joins {
+			if !slices.Contains(joins, join) {
+				joins = append(joins, join)
+			}
+		}
+	}
+	for _, join := range joins {
+		for _, n := range g.reachable(join, first) {
+			if branch, ok := owner[n]; ok {
+				return nil, nil, fmt.Errorf("%w: branch %s of node %s reaches %s, which also runs after merge node %s",
+					ErrBranchesMeet, branch, id, n, join)
+			}
+		}
+	}
+	return nodes, joins, nil
+}
+
+// reachable returns the nodes reachable from node id, id included, up to
+// the loop nodes on the way: past them the run is in another iteration. It
+// leaves out the nodes finished before first, see Graph.finished, which can
+// only reach nodes finished even earlier.
+func (g *Graph) reachable(id string, first int) []string {
+	if g.finished[id] < first {
+		return nil
+	}
+	seen := map[string]bool{id: true}
+	nodes := []string{id}
+	for i := 0; i < len(nodes); i++ {
+		if g.nodes[nodes[i]].Type == NodeTypeLoop {
+			continue
+		}
+		for _, e := range g.outgoing[nodes[i]] {
+			if !seen[e.Target] && g.finished[e.Target] >= first {
+				seen[e.Target] = true
+				nodes = append(nodes, e.Target)
+			}
+		}
+	}
+	return nodes
+}
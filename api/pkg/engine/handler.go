@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// ExecutionContext carries the state shared by all nodes of a single run.
+type ExecutionContext struct {
+	Ctx context.Context
+
+	// Input is the raw payload the execution was triggered with.
+	Input map[string]any
+
+	// State holds the variables produced by nodes so far, keyed by name.
+	State map[string]any
+
+	// Resume holds the data submitted to continue a paused run. It is only set
+	// while the node that paused the run executes again.
+	Resume map[string]any
+
+	// Steps are the steps of the run so far, oldest first, e.g. to report on
+	// them. Handlers must not modify them.
+	Steps []ExecutionStep
+
+	// Clock and IDs are where handlers get the time and new ids from, so
+	// tests and replays can control them; see WithClock and
+	// WithIDGenerator.
+	Clock Clock
+	IDs   IDGenerator
+
+	// memo caches results of memoizable nodes by node id.
+	memo map[string]*memoEntry
+
+	// budget tracks what the run consumed against its budget, see Spend.
+	budget *meter
+
+	// events is where the run's node events are published, if anywhere.
+	events *EventBus
+
+	// limiter enforces the rate limits of nodes across the executor's runs.
+	limiter *rateLimiter
+
+	// loops are the loops the run is in, outermost first, and iterations
+	// counts the visits of loop nodes, shared by parallel branches.
+	loops      []Loop
+	iterations *atomic.Int64
+
+	// loopEnd is the parallel loop node whose iteration the context runs;
+	// the iteration ends when its walk gets back to it.
+	loopEnd string
+
+	// branch identifies the parallel branch the context belongs to, see
+	// ExecutionStep.ParallelBranch, and is empty on the run's main path.
+	branch string
+}
+
+// fork returns the context of the parallel branch branch. It shares the
+// run's clock, ids, budget and loop visits, but gets copies of the state,
+// memoized results and loops so branches don't race on them.
+func (ec *ExecutionContext) fork(ctx context.Context, branch string) *ExecutionContext {
+	b := *ec
+	b.Ctx = ctx
+	b.State = maps.Clone(ec.State)
+	b.Resume = nil
+	b.memo = maps.Clone(ec.memo)
+	b.loops = slices.Clone(ec.loops)
+	b.branch = branch
+	return &b
+}
+
+// NodeResult is what a handler returns after running a node.
+type NodeResult struct {
+	// Output is recorded in the execution trace for the node.
+	Output map[string]any
+
+	// Branch selects the outgoing edge by its source handle. Leave empty to
+	// follow the node's only outgoing edge.
+	Branch string
+
+	// Stop ends the run successfully after this node, without following any
+	// outgoing edge.
+	Stop bool
+
+	// Await pauses the run at this node until more input is supplied. The node
+	// runs again with ExecutionContext.Resume set when the run is resumed.
+	Await *Await
+}
+
+// Await describes what a paused run is waiting for.
+type Await struct {
+	// Kind names what is awaited, e.g. "input".
+	Kind string `json:"kind"`
+
+	// Details is shown to whoever resumes the run, e.g. a field schema.
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// NodeHandler executes nodes of a single type.
+type NodeHandler interface {
+	Execute(ec *ExecutionContext, node *Node) (*NodeResult, error)
+}
+
+// HandlerFunc adapts a plain function to a NodeHandler.
+type HandlerFunc func(ec *ExecutionContext, node *Node) (*NodeResult, error)
+
+func (f HandlerFunc) Execute(ec *ExecutionContext, node *Node) (*NodeResult, error) {
+	return f(ec, node)
+}
+
+// Registry maps node types to their handlers. A node type may also have named
+// variants, alternative handlers a workflow can bind the type to instead,
+// e.g. a sandboxed email handler, and handlers of older major versions that
+// workflows can pin the type to.
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]NodeHandler
+	variants map[string]map[string]NodeHandler
+	versions map[string]map[int]NodeHandler
+}
+
+// VariantDefault names the handler registered with Register. Binding a type to
+// it is the same as not binding it.
+const VariantDefault = "default"
+
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers: make(map[string]NodeHandler),
+		variants: make(map[string]map[string]NodeHandler),
+		versions: make(map[string]map[int]NodeHandler),
+	}
+}
+
+// RegisterVariant adds or replaces a named variant of a node type's handler.
+func (r *Registry) RegisterVariant(nodeType, name string, h NodeHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.variants[nodeType] == nil {
+		r.variants[nodeType] = make(map[string]NodeHandler)
+	}
+	r.variants[nodeType][name] = h
+}
+
+// Variants returns the variant names of each node type that has any, sorted,
+// not counting VariantDefault.
+func (r *Registry) Variants() map[string][]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string][]string, len(r.variants))
+	for nodeType, vs := range r.variants {
+		out[nodeType] = slices.Sorted(maps.Keys(vs))
+	}
+	return out
+}
+
+// Bind returns a registry that serves each node type in bindings with the
+// named variant; other types keep their handlers. It fails with
+// ErrUnknownVariant if a variant isn't registered.
+func (r *Registry) Bind(bindings map[string]string) (*Registry, error) {
+	if len(bindings) == 0 {
+		return r, nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	bound := &Registry{handlers: maps.Clone(r.handlers), variants: r.variants, versions: r.versions}
+	for nodeType, name := range bindings {
+		if name == VariantDefault {
+			continue
+		}
+		h, ok := r.variants[nodeType][name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s for node type %s", ErrUnknownVariant, name, nodeType)
+		}
+		bound.handlers[nodeType] = h
+	}
+	return bound, nil
+}
+
+// Register adds or replaces the handler for a node type. A handler of another
+// major version than the one it replaces (see Versioned) leaves the old one
+// available to workflows pinned to it. It panics if the handler declares an
+// invalid version.
+func (r *Registry) Register(nodeType string, h NodeHandler) {
+	major, err := MajorVersion(HandlerVersion(h))
+	if err != nil {
+		panic(fmt.Sprintf("register %s handler: %v", nodeType, err))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[nodeType] = h
+	if r.versions[nodeType] == nil {
+		r.versions[nodeType] = make(map[int]NodeHandler)
+	}
+	r.versions[nodeType][major] = h
+}
+
+// Get returns the handler for a node type.
+func (r *Registry) Get(nodeType string) (NodeHandler, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.handlers[nodeType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNodeType, nodeType)
+	}
+	return h, nil
+}
+
+// Validate checks that every node of the graph has a registered handler.
+// Disabled nodes never run and are not checked.
+func (r *Registry) Validate(g *Graph) error {
+	for _, n := range g.Nodes() {
+		if n.Disabled() {
+			continue
+		}
+		if _, err := r.Get(n.Type); err != nil {
+			return fmt.Errorf("node %s: %w", n.ID, err)
+		}
+	}
+	return nil
+}
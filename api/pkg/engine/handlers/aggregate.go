@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// Aggregate operations.
+var aggregateOperations = []string{"sum", "avg", "min", "max", "count", "concat", "expression"}
+
+// Aggregate reduces the list held by the state variable named in the node's
+// inputVariables to a single value stored under its outputVariables, e.g. the
+// highest of the temperatures collected for several cities. The "operation"
+// metadata is one of sum, avg, min, max, count, concat or expression. With
+// "field", list items are objects and the field is read from each. An
+// expression is evaluated for every item with acc (starting at "initial"),
+// item and index, and its result becomes the next acc.
+func Aggregate(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	inputs, outputs := node.Strings("inputVariables"), node.Strings("outputVariables")
+	if len(inputs) == 0 || len(outputs) == 0 {
+		return nil, fmt.Errorf("%w: aggregate needs inputVariables and outputVariables", engine.ErrInvalidInput)
+	}
+	operation, _ := node.String("operation")
+	if !slices.Contains(aggregateOperations, operation) {
+		return nil, fmt.Errorf("%w: unsupported aggregate operation %q", engine.ErrInvalidInput, operation)
+	}
+
+	raw, ok := ec.State[inputs[0]]
+	if !ok {
+		return nil, fmt.Errorf("variable %s is not set", inputs[0])
+	}
+	list, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("variable %s is not a list", inputs[0])
+	}
+
+	items := list
+	if field, ok := node.String("field"); ok && field != "" {
+		items = make([]any, 0, len(list))
+		for i, item := range list {
+			obj, _ := item.(map[string]any)
+			v, ok := engine.Lookup(obj, field)
+			if !ok {
+				return nil, fmt.Errorf("item %d of %s has no field %s", i, inputs[0], field)
+			}
+			items = append(items, v)
+		}
+	}
+
+	result, err := aggregate(node, operation, items)
+	if err != nil {
+		return nil, err
+	}
+
+	ec.State[outputs[0]] = result
+	return &engine.NodeResult{
+		Output: map[string]any{
+			"operation": operation,
+			"count":     len(items),
+			"result":    result,
+		},
+	}, nil
+}
+
+// CompileAggregate parses the node's expression when its operation is
+// "expression".
+func CompileAggregate(node *engine.Node) (any, error) {
+	operation, _ := node.String("operation")
+	expr, _ := node.String("expression")
+	if operation != "expression" || expr == "" {
+		return nil, nil
+	}
+	return engine.CompileExpr(expr)
+}
+
+func aggregate(node *engine.Node, operation string, items []any) (any, error) {
+	switch operation {
+	case "count":
+		return len(items), nil
+	case "concat":
+		separator, ok := node.String("separator")
+		if !ok {
+			separator = ", "
+		}
+		parts := make([]string, 0, len(items))
+		for _, item := range items {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, separator), nil
+	case "expression":
+		return reduceExpression(node, items)
+	}
+
+	numbers := make([]float64, 0, len(items))
+	for i, item := range items {
+		f, err := engine.ToFloat(item)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		numbers = append(numbers, f)
+	}
+
+	var sum float64
+	for _, f := range numbers {
+		sum += f
+	}
+	if operation == "sum" {
+		return sum, nil
+	}
+	if len(numbers) == 0 {
+		return nil, fmt.Errorf("cannot compute %s of an empty list", operation)
+	}
+	switch operation {
+	case "avg":
+		return sum / float64(len(numbers)), nil
+	case "min":
+		return slices.Min(numbers), nil
+	default:
+		return slices.Max(numbers), nil
+	}
+}
+
+func reduceExpression(node *engine.Node, items []any) (any, error) {
+	expr, _ := node.String("expression")
+	if expr == "" {
+		return nil, fmt.Errorf("%w: aggregate expression is required", engine.ErrInvalidInput)
+	}
+
+	var acc float64
+	if initial, ok := node.Metadata["initial"]; ok {
+		var err error
+		if acc, err = engine.ToFloat(initial); err != nil {
+			return nil, fmt.Errorf("%w: initial: %v", engine.ErrInvalidInput, err)
+		}
+	}
+
+	compiled, _ := node.Compiled().(*engine.Expr)
+	if compiled == nil {
+		var err error
+		if compiled, err = engine.CompileExpr(expr); err != nil {
+			return nil, fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+		}
+	}
+
+	for i, item := range items {
+		v, err := compiled.Eval(map[string]any{"acc": acc, "item": item, "index": i})
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		acc = v
+	}
+	return acc, nil
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/jsonpath"
+)
+
+// Classify labels the text at the state path in its "variable" metadata, e.g.
+// a support ticket received by webhook, with one of its "categories":
+//
+//	[{"name": "billing", "keywords": ["invoice", "refund"], "patterns": ["\\$\\d+"]}]
+//
+// Each keyword (a word or phrase, matched case-insensitively on word
+// boundaries) and regular expression match scores a point; the category with
+// the most points wins, the first listed on a tie. Text matching none gets the
+// "default" category, "other" unless set. "preset": "sentiment" uses built-in
+// positive and negative word lists instead, defaulting to neutral. The label
+// goes to the first outputVariables entry, or "category". With
+// "onClassified": "branch" the node follows the edge named after the label.
+func Classify(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	c, _ := node.Compiled().(*classifier)
+	if c == nil {
+		var err error
+		if c, err = compileClassifier(node); err != nil {
+			return nil, fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+		}
+	}
+	onClassified, _ := node.String("onClassified")
+	if onClassified != "" && onClassified != "continue" && onClassified != "branch" {
+		return nil, fmt.Errorf("%w: onClassified must be continue or branch", engine.ErrInvalidInput)
+	}
+
+	value, err := c.path.Get(ec.State)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not available: %w", c.variable, err)
+	}
+	text, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s must be text, got %T", engine.ErrInvalidInput, c.variable, value)
+	}
+
+	label, scores, matches := c.classify(text)
+	ec.State[stateOutput(node, "category")] = label
+	result := &engine.NodeResult{Output: map[string]any{
+		"category": label,
+		"scores":   scores,
+		"matches":  matches,
+	}}
+	if onClassified == "branch" {
+		result.Branch = label
+	}
+	return result, nil
+}
+
+// CompileClassify parses the node's variable path and categories.
+func CompileClassify(node *engine.Node) (any, error) {
+	return compileClassifier(node)
+}
+
+// DefaultCategory labels text that matches no category.
+const DefaultCategory = "other"
+
+type category struct {
+	name     string
+	keywords [][]string
+	patterns []*regexp.Regexp
+}
+
+type classifier struct {
+	variable   string
+	path       *jsonpath.Path
+	categories []category
+	fallback   string
+}
+
+// sentimentCategories back "preset": "sentiment".
+var sentimentCategories = map[string][]any{
+	"positive": {"thanks", "thank you", "great", "love", "excellent", "happy", "awesome", "perfect", "resolved", "helpful"},
+	"negative": {"angry", "terrible", "awful", "broken", "refund", "cancel", "disappointed", "worst", "unacceptable", "not working"},
+}
+
+func compileClassifier(node *engine.Node) (*classifier, error) {
+	variable, _ := node.String("variable")
+	if variable == "" {
+		return nil, fmt.Errorf("classify needs a variable")
+	}
+	path, err := jsonpath.Parse(variable)
+	if err != nil {
+		return nil, fmt.Errorf("variable: %w", err)
+	}
+	c := &classifier{variable: variable, path: path, fallback: DefaultCategory}
+
+	raw, _ := node.Metadata["categories"].([]any)
+	switch preset, _ := node.String("preset"); preset {
+	case "":
+	case "sentiment":
+		if raw != nil {
+			return nil, fmt.Errorf("preset and categories can't be combined")
+		}
+		c.fallback = "neutral"
+		for _, name := range []string{"positive", "negative"} {
+			raw = append(raw, map[string]any{"name": name, "keywords": sentimentCategories[name]})
+		}
+	default:
+		return nil, fmt.Errorf("unknown preset %q", preset)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("classify needs categories")
+	}
+	if s, ok := node.String("default"); ok && s != "" {
+		c.fallback = s
+	}
+
+	seen := map[string]bool{c.fallback: true}
+	for i, r := range raw {
+		m, _ := r.(map[string]any)
+		name, _ := m["name"].(string)
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("categories[%d]: name is empty or used twice", i)
+		}
+		seen[name] = true
+		cat := category{name: name}
+		keywords, _ := m["keywords"].([]any)
+		for _, k := range keywords {
+			s, _ := k.(string)
+			if words := classifyWords(s); len(words) > 0 {
+				cat.keywords = append(cat.keywords, words)
+			}
+		}
+		patterns, _ := m["patterns"].([]any)
+		for _, p := range patterns {
+			s, _ := p.(string)
+			re, err := regexp.Compile("(?i)" + s)
+			if err != nil {
+				return nil, fmt.Errorf("categories[%d].patterns: %w", i, err)
+			}
+			cat.patterns = append(cat.patterns, re)
+		}
+		if len(cat.keywords) == 0 && len(cat.patterns) == 0 {
+			return nil, fmt.Errorf("categories[%d]: %s needs keywords or patterns", i, name)
+		}
+		c.categories = append(c.categories, cat)
+	}
+	return c, nil
+}
+
+// ClassifyLabels returns the labels a classify node can give: its categories,
+// then its default.
+func ClassifyLabels(node *engine.Node) ([]string, error) {
+	c, err := compileClassifier(node)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(c.categories)+1)
+	for _, cat := range c.categories {
+		out = append(out, cat.name)
+	}
+	return append(out, c.fallback), nil
+}
+
+func (c *classifier) classify(text string) (string, map[string]any, []any) {
+	words := classifyWords(text)
+	label, best := c.fallback, 0
+	scores := make(map[string]any, len(c.categories))
+	matches := []any{}
+	for _, cat := range c.categories {
+		score := 0
+		for _, kw := range cat.keywords {
+			if n := countPhrase(words, kw); n > 0 {
+				score += n
+				matches = append(matches, strings.Join(kw, " "))
+			}
+		}
+		for _, re := range cat.patterns {
+			for _, m := range re.FindAllString(text, -1) {
+				score++
+				matches = append(matches, m)
+			}
+		}
+		scores[cat.name] = score
+		if score > best {
+			label, best = cat.name, score
+		}
+	}
+	return label, scores, matches
+}
+
+// classifyWords splits s into lower-case words.
+func classifyWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+}
+
+// countPhrase counts the occurrences of phrase in words.
+func countPhrase(words, phrase []string) int {
+	n := 0
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		match := true
+		for j, w := range phrase {
+			if words[i+j] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/jsonpath"
+)
+
+var operatorSymbols = map[string]string{
+	"greater_than":          ">",
+	"less_than":             "<",
+	"equals":                "=",
+	"greater_than_or_equal": ">=",
+	"less_than_or_equal":    "<=",
+}
+
+var operatorWords = map[string]string{
+	"greater_than":          "greater than",
+	"less_than":             "less than",
+	"equals":                "equal to",
+	"greater_than_or_equal": "greater than or equal to",
+	"less_than_or_equal":    "less than or equal to",
+}
+
+// Condition compares the temperature in state against the operator and
+// threshold supplied with the execution and follows the "true" or "false"
+// branch accordingly. When the execution doesn't supply them, the node's own
+// operator and threshold metadata is used. A "variable" metadata JSONPath,
+// e.g. "$.weather.current.temp", compares that state value instead of the
+// temperature.
+func Condition(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	params, _ := ec.Input["condition"].(map[string]any)
+	if params == nil {
+		if _, ok := node.Metadata["operator"]; ok {
+			params = node.Metadata
+		}
+	}
+	if params == nil {
+		return nil, fmt.Errorf("%w: condition is required", engine.ErrInvalidInput)
+	}
+
+	operator, _ := params["operator"].(string)
+	if _, ok := operatorSymbols[operator]; !ok {
+		return nil, fmt.Errorf("%w: unsupported operator %q", engine.ErrInvalidInput, operator)
+	}
+
+	threshold, err := engine.ToFloat(params["threshold"])
+	if err != nil {
+		return nil, fmt.Errorf("%w: threshold: %v", engine.ErrInvalidInput, err)
+	}
+
+	var value any = ec.State["temperature"]
+	variable, _ := node.String("variable")
+	if variable != "" {
+		path, _ := node.Compiled().(*jsonpath.Path)
+		if path == nil {
+			if path, err = jsonpath.Parse(variable); err != nil {
+				return nil, fmt.Errorf("%s is not available: %w", variable, err)
+			}
+		}
+		if value, err = path.Get(ec.State); err != nil {
+			return nil, fmt.Errorf("%s is not available: %w", variable, err)
+		}
+	}
+	actual, err := engine.ToFloat(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not available: %w", cmp.Or(variable, "temperature"), err)
+	}
+
+	met := Compare(actual, operator, threshold)
+
+	ec.State["conditionMet"] = met
+	ec.State["operator"] = operator
+	ec.State["threshold"] = threshold
+
+	verdict := "condition met"
+	if !met {
+		verdict = "condition not met"
+	}
+
+	return &engine.NodeResult{
+		Output: map[string]any{
+			"conditionMet": met,
+			"threshold":    threshold,
+			"operator":     operator,
+			"actualValue":  actual,
+			"message":      conditionMessage(variable, actual, operator, threshold, verdict),
+		},
+		Branch: strconv.FormatBool(met),
+	}, nil
+}
+
+// CompileCondition parses the node's variable path, if it has one.
+func CompileCondition(node *engine.Node) (any, error) {
+	variable, _ := node.String("variable")
+	if variable == "" {
+		return nil, nil
+	}
+	path, err := jsonpath.Parse(variable)
+	if err != nil {
+		return nil, fmt.Errorf("variable: %w", err)
+	}
+	return path, nil
+}
+
+func conditionMessage(variable string, actual float64, operator string, threshold float64, verdict string) string {
+	if variable == "" {
+		return fmt.Sprintf("Temperature %s°C is %s %s°C - %s",
+			formatNumber(actual), operatorWords[operator], formatNumber(threshold), verdict)
+	}
+	return fmt.Sprintf("%s is %s, %s %s - %s",
+		variable, formatNumber(actual), operatorWords[operator], formatNumber(threshold), verdict)
+}
+
+// IsOperator reports whether operator is supported by condition nodes.
+func IsOperator(operator string) bool {
+	_, ok := operatorSymbols[operator]
+	return ok
+}
+
+// Compare evaluates "actual operator threshold".
+func Compare(actual float64, operator string, threshold float64) bool {
+	switch operator {
+	case "greater_than":
+		return actual > threshold
+	case "less_than":
+		return actual < threshold
+	case "equals":
+		return actual == threshold
+	case "greater_than_or_equal":
+		return actual >= threshold
+	case "less_than_or_equal":
+		return actual <= threshold
+	}
+	return false
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
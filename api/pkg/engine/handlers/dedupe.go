@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"workflow-code-test/api/pkg/dedupe"
+	"workflow-code-test/api/pkg/engine"
+)
+
+const defaultDedupeTTL = 24 * time.Hour
+
+// Dedupe stops repeated runs for the same key, e.g. the same alert to the same
+// person twice in a day. Its "key" metadata is a template such as
+// "{{email}}-{{date}}", where date is today's UTC date unless the state sets
+// it. The key is remembered for "ttl" (a Go duration, default 24h). A key seen
+// before ends the run, or with "onDuplicate": "branch" follows the
+// "duplicate" edge; new keys follow the "unique" edge in that mode.
+type Dedupe struct {
+	store dedupe.Store
+}
+
+func NewDedupe(store dedupe.Store) *Dedupe {
+	return &Dedupe{store: store}
+}
+
+// Compile parses the node's key template.
+func (h *Dedupe) Compile(node *engine.Node) (any, error) {
+	tmpl, _ := node.String("key")
+	return engine.CompileTemplate(tmpl), nil
+}
+
+func (h *Dedupe) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	tmpl, _ := node.String("key")
+	if tmpl == "" {
+		return nil, fmt.Errorf("%w: dedupe needs a key", engine.ErrInvalidInput)
+	}
+	ttl := defaultDedupeTTL
+	if raw, ok := node.String("ttl"); ok {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: ttl must be a positive duration such as 24h", engine.ErrInvalidInput)
+		}
+		ttl = d
+	}
+	onDuplicate, _ := node.String("onDuplicate")
+	if onDuplicate != "" && onDuplicate != "end" && onDuplicate != "branch" {
+		return nil, fmt.Errorf("%w: onDuplicate must be end or branch", engine.ErrInvalidInput)
+	}
+
+	vars := maps.Clone(ec.State)
+	if _, ok := vars["date"]; !ok {
+		vars["date"] = ec.Clock.Now().Format(time.DateOnly)
+	}
+	compiled, _ := node.Compiled().(*engine.Template)
+	if compiled == nil {
+		compiled = engine.CompileTemplate(tmpl)
+	}
+	key := compiled.Render(vars)
+	if strings.Contains(key, "{{") {
+		return nil, fmt.Errorf("key %q references variables that are not set", key)
+	}
+
+	// Keys are scoped to the node so separate workflows don't collide.
+	scoped := node.ID + ":" + key
+	if wf := engine.Labels(ec.Ctx)[engine.LabelWorkflowID]; wf != "" {
+		scoped = wf + ":" + scoped
+	}
+	claimed, err := h.store.Claim(ec.Ctx, scoped, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("dedupe store: %w", err)
+	}
+
+	result := &engine.NodeResult{
+		Output: map[string]any{"key": key, "duplicate": !claimed},
+	}
+	switch {
+	case onDuplicate == "branch" && claimed:
+		result.Branch = "unique"
+	case onDuplicate == "branch":
+		result.Branch = "duplicate"
+	case !claimed:
+		result.Stop = true
+	}
+	return result, nil
+}
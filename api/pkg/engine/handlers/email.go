@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/email"
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/report"
+)
+
+const alertSender = "weather-alerts@example.com"
+
+const (
+	// emailBatchSize is how many recipients an email node sends to at once.
+	emailBatchSize = 10
+	// maxEmailRecipients bounds the recipients of one email node.
+	maxEmailRecipients = 1000
+)
+
+// Email renders the node's email template with the execution state and sends
+// it to the address collected by the form, in the "email" variable.
+// "recipients" names another state variable holding an address or a list of
+// them, and "distributionList" adds the addresses of a distribution list; with
+// a list, the "email" variable is only read if recipients names it. Each
+// recipient gets their own email, sent emailBatchSize at a time, and their own
+// entry in the step's deliveries. The node fails if no email could be sent.
+//
+// "attachReport" ("json" or "html") attaches a report of the steps run so
+// far, see package report.
+type Email struct {
+	client email.Client
+	lists  email.Lists
+}
+
+// NewEmail returns an email handler sending with client. lists may be nil if
+// nodes don't use distribution lists.
+func NewEmail(client email.Client, lists email.Lists) *Email {
+	return &Email{client: client, lists: lists}
+}
+
+// emailTemplate is the parsed emailTemplate metadata of a node, with the
+// format of the report it attaches, if any.
+type emailTemplate struct {
+	subject, body *engine.Template
+	report        string
+}
+
+// emailDelivery is the outcome of sending to one recipient.
+type emailDelivery struct {
+	To        string `json:"to"`
+	Status    string `json:"status"`
+	MessageID string `json:"messageId,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Compile parses the node's subject and body templates and checks its report
+// format.
+func (h *Email) Compile(node *engine.Node) (any, error) {
+	return compileEmail(node)
+}
+
+func compileEmail(node *engine.Node) (emailTemplate, error) {
+	tmpl := node.Map("emailTemplate")
+	subject, _ := tmpl["subject"].(string)
+	body, _ := tmpl["body"].(string)
+	format, _ := node.String("attachReport")
+	if format != "" && format != report.FormatJSON && format != report.FormatHTML {
+		return emailTemplate{}, fmt.Errorf("attachReport must be %q or %q, got %q", report.FormatJSON, report.FormatHTML, format)
+	}
+	return emailTemplate{subject: engine.CompileTemplate(subject), body: engine.CompileTemplate(body), report: format}, nil
+}
+
+// EmailRecipientsVariable returns the state variable an email node with the
+// given metadata reads its recipients from, or "" if it only sends to a
+// distribution list.
+func EmailRecipientsVariable(metadata map[string]any) string {
+	if variable, _ := metadata["recipients"].(string); variable != "" {
+		return variable
+	}
+	if list, _ := metadata["distributionList"].(string); list != "" {
+		return ""
+	}
+	return "email"
+}
+
+// recipients returns the addresses the node sends to, without duplicates.
+func (h *Email) recipients(ec *engine.ExecutionContext, node *engine.Node) ([]string, error) {
+	var to []string
+	if variable := EmailRecipientsVariable(node.Metadata); variable != "" {
+		switch v := ec.State[variable].(type) {
+		case string:
+			if v != "" {
+				to = append(to, v)
+			}
+		case []string:
+			to = append(to, v...)
+		case []any:
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%w: %s must hold email addresses, got %T", engine.ErrInvalidInput, variable, item)
+				}
+				to = append(to, s)
+			}
+		}
+	}
+
+	if name, _ := node.String("distributionList"); name != "" {
+		if h.lists == nil {
+			return nil, fmt.Errorf("%w: distribution lists are not available", engine.ErrInvalidInput)
+		}
+		list, err := h.lists.GetList(ec.Ctx, name)
+		if errors.Is(err, db.ErrNotFound) {
+			return nil, fmt.Errorf("%w: unknown distribution list %q", engine.ErrInvalidInput, name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load distribution list %q: %w", name, err)
+		}
+		to = append(to, list.Addresses...)
+	}
+
+	to = email.UniqueAddresses(to)
+	if len(to) == 0 {
+		return nil, fmt.Errorf("%w: no recipient email address in state", engine.ErrInvalidInput)
+	}
+	if len(to) > maxEmailRecipients {
+		return nil, fmt.Errorf("%w: %d recipients, at most %d are allowed", engine.ErrInvalidInput, len(to), maxEmailRecipients)
+	}
+	return to, nil
+}
+
+func (h *Email) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	recipients, err := h.recipients(ec, node)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, ok := node.Compiled().(emailTemplate)
+	if !ok {
+		if tmpl, err = compileEmail(node); err != nil {
+			return nil, fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+		}
+	}
+
+	msg := email.Message{
+		To:        strings.Join(recipients, ", "),
+		From:      alertSender,
+		Subject:   tmpl.subject.Render(ec.State),
+		Body:      tmpl.body.Render(ec.State),
+		Timestamp: ec.Clock.Now(),
+	}
+	if tmpl.report != "" {
+		filename, contentType, content, err := report.New(ec.Steps, msg.Timestamp).Render(tmpl.report)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render execution report: %w", err)
+		}
+		msg.Attachments = []email.Attachment{{Filename: filename, ContentType: contentType, Content: content}}
+	}
+
+	if err := ec.Spend(engine.ResourceNotifications, len(recipients)); err != nil {
+		return nil, err
+	}
+	deliveries := make([]emailDelivery, len(recipients))
+	errs := make([]error, len(recipients))
+	for start := 0; start < len(recipients); start += emailBatchSize {
+		var wg sync.WaitGroup
+		for i := start; i < min(start+emailBatchSize, len(recipients)); i++ {
+			wg.Go(func() {
+				m := msg
+				m.To = recipients[i]
+				id, err := h.client.Send(ec.Ctx, m)
+				if err != nil {
+					deliveries[i] = emailDelivery{To: m.To, Status: "failed", Error: err.Error()}
+					errs[i] = err
+					return
+				}
+				deliveries[i] = emailDelivery{To: m.To, Status: "sent", MessageID: id}
+			})
+		}
+		wg.Wait()
+		if err := ec.Ctx.Err(); err != nil {
+			return nil, fmt.Errorf("failed to send email: %w", err)
+		}
+	}
+
+	var messageID string
+	sent := 0
+	for _, d := range deliveries {
+		if d.Status != "sent" {
+			continue
+		}
+		if sent == 0 {
+			messageID = d.MessageID
+		}
+		sent++
+	}
+	if sent == 0 {
+		return nil, fmt.Errorf("failed to send email: %w", errs[0])
+	}
+	status := "sent"
+	if sent < len(deliveries) {
+		status = "partial"
+	}
+
+	ec.State["emailSent"] = true
+
+	return &engine.NodeResult{Output: map[string]any{
+		"emailDraft":     msg,
+		"deliveryStatus": status,
+		"messageId":      messageID,
+		"emailSent":      true,
+		"recipients":     recipients,
+		"deliveries":     deliveries,
+	}}, nil
+}
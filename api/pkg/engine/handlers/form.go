@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/weather"
+)
+
+// Form copies the submitted form fields listed in the node's inputFields into
+// the execution state. With "mode": "wizard" the node instead pauses the run
+// and asks for the fields described in its "fields" metadata.
+//
+// City fields must name an enabled city of the catalog, see
+// weather.ResolveCity; a "country" field submitted alongside picks among
+// cities of the same name. The field is stored as the city's name, and its
+// resolved coordinates are stored with it under LocationVariable so later
+// nodes don't depend on the catalog.
+type Form struct {
+	cities weather.Catalog
+}
+
+func NewForm(cities weather.Catalog) *Form {
+	return &Form{cities: cities}
+}
+
+func (h *Form) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	if mode, _ := node.String("mode"); mode == "wizard" {
+		return h.wizardStep(ec, node)
+	}
+
+	formData, _ := ec.Input["formData"].(map[string]any)
+	if formData == nil {
+		return nil, fmt.Errorf("%w: formData is required", engine.ErrInvalidInput)
+	}
+
+	country, _ := formData["country"].(string)
+	output := make(map[string]any)
+	var location map[string]any
+	for _, field := range node.Strings("inputFields") {
+		value, _ := formData[field].(string)
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, fmt.Errorf("%w: %s is required", engine.ErrInvalidInput, field)
+		}
+		value, city, err := h.checkField(ec, field, value, country)
+		if err != nil {
+			return nil, err
+		}
+		output[field] = value
+		if city != nil {
+			location = cityLocation(*city)
+			output[LocationVariable] = location
+		}
+	}
+
+	for _, name := range node.Strings("outputVariables") {
+		if v, ok := output[name]; ok {
+			ec.State[name] = v
+			if name == "city" && location != nil {
+				ec.State[LocationVariable] = location
+			}
+		}
+	}
+
+	return &engine.NodeResult{Output: output}, nil
+}
+
+// LocationVariable is the state variable form nodes store the resolved
+// location of a city field in, as {"city", "country", "lat", "lon",
+// "timezone", "placeId"}. Integration nodes use it instead of looking the city
+// up again.
+const LocationVariable = "location"
+
+func cityLocation(city weather.City) map[string]any {
+	return map[string]any{
+		"city":     city.Name,
+		"country":  city.Country,
+		"lat":      city.Lat,
+		"lon":      city.Lon,
+		"timezone": city.Timezone,
+		"placeId":  city.PlaceID,
+	}
+}
+
+// errCityLookup fails validations for which the city catalog couldn't be read.
+var errCityLookup = errors.New("failed to look up city")
+
+// checkField validates a submitted field and returns the value to store. City
+// fields yield the name of the city they resolve to, which is returned too.
+func (h *Form) checkField(ec *engine.ExecutionContext, field, value, country string) (string, *weather.City, error) {
+	switch field {
+	case "email":
+		if _, err := mail.ParseAddress(value); err != nil {
+			return "", nil, fmt.Errorf("%w: %q is not a valid email address", engine.ErrInvalidInput, value)
+		}
+	case "city":
+		city, ok, err := weather.ResolveCity(ec.Ctx, h.cities, value, strings.TrimSpace(country))
+		if errors.Is(err, weather.ErrAmbiguousCity) {
+			return "", nil, fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: %w", errCityLookup, err)
+		}
+		if !ok {
+			return "", nil, fmt.Errorf("%w: unsupported city %q", engine.ErrInvalidInput, value)
+		}
+		return city.Name, &city, nil
+	}
+	return value, nil, nil
+}
+
+// wizardField describes one field requested by a wizard form step.
+type wizardField struct {
+	Name     string `json:"name"`
+	Label    string `json:"label,omitempty"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+}
+
+// Field types accepted by wizard steps.
+var wizardFieldTypes = []string{"text", "email", "number", "city"}
+
+func wizardFields(node *engine.Node) ([]wizardField, error) {
+	raw, _ := node.Metadata["fields"].([]any)
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("%w: wizard form needs fields", engine.ErrInvalidInput)
+	}
+	fields := make([]wizardField, 0, len(raw))
+	for _, r := range raw {
+		m, _ := r.(map[string]any)
+		f := wizardField{Type: "text"}
+		f.Name, _ = m["name"].(string)
+		f.Label, _ = m["label"].(string)
+		f.Required, _ = m["required"].(bool)
+		if t, ok := m["type"].(string); ok && t != "" {
+			f.Type = t
+		}
+		if f.Name == "" || !slices.Contains(wizardFieldTypes, f.Type) {
+			return nil, fmt.Errorf("%w: invalid wizard field %v", engine.ErrInvalidInput, r)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// wizardStep pauses the run until input for the node's fields is submitted.
+// Invalid submissions pause it again with the validation errors.
+func (h *Form) wizardStep(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	fields, err := wizardFields(node)
+	if err != nil {
+		return nil, err
+	}
+	if ec.Resume == nil {
+		return &engine.NodeResult{Await: wizardAwait(node, fields, nil)}, nil
+	}
+
+	country, _ := ec.Resume["country"].(string)
+	output := make(map[string]any)
+	errs := make(map[string]string)
+	for _, f := range fields {
+		value, city, err := h.wizardValue(ec, f, ec.Resume[f.Name], country)
+		if errors.Is(err, errCityLookup) {
+			return nil, err
+		}
+		if err != nil {
+			errs[f.Name] = err.Error()
+			continue
+		}
+		if value != nil {
+			output[f.Name] = value
+		}
+		if city != nil {
+			output[LocationVariable] = cityLocation(*city)
+		}
+	}
+	if len(errs) > 0 {
+		return &engine.NodeResult{Await: wizardAwait(node, fields, errs)}, nil
+	}
+
+	for name, v := range output {
+		ec.State[name] = v
+	}
+	return &engine.NodeResult{Output: output}, nil
+}
+
+func wizardAwait(node *engine.Node, fields []wizardField, errs map[string]string) *engine.Await {
+	details := map[string]any{"title": node.Label, "fields": fields}
+	if len(errs) > 0 {
+		details["errors"] = errs
+	}
+	return &engine.Await{Kind: "input", Details: details}
+}
+
+// wizardValue validates a submitted value against its field. Missing optional
+// fields yield nil; city fields also yield the city they resolve to.
+func (h *Form) wizardValue(ec *engine.ExecutionContext, f wizardField, raw any, country string) (any, *weather.City, error) {
+	s, isString := raw.(string)
+	if raw == nil || (isString && strings.TrimSpace(s) == "") {
+		if f.Required {
+			return nil, nil, fmt.Errorf("%s is required", f.Name)
+		}
+		return nil, nil, nil
+	}
+
+	switch f.Type {
+	case "number":
+		n, err := engine.ToFloat(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		return n, nil, nil
+	case "email", "city":
+		if !isString {
+			return nil, nil, fmt.Errorf("%s must be a string", f.Name)
+		}
+		value, city, err := h.checkField(ec, f.Type, strings.TrimSpace(s), country)
+		if err != nil {
+			if !errors.Is(err, engine.ErrInvalidInput) {
+				return nil, nil, err
+			}
+			return nil, nil, errors.New(strings.TrimPrefix(err.Error(), engine.ErrInvalidInput.Error()+": "))
+		}
+		return value, city, nil
+	default:
+		if !isString {
+			return nil, nil, fmt.Errorf("%s must be a string", f.Name)
+		}
+		return strings.TrimSpace(s), nil, nil
+	}
+}
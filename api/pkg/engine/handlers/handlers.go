@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"maps"
+
+	"workflow-code-test/api/pkg/dedupe"
+	"workflow-code-test/api/pkg/email"
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/incidents"
+	"workflow-code-test/api/pkg/issues"
+	"workflow-code-test/api/pkg/mqtt"
+	"workflow-code-test/api/pkg/saga"
+	"workflow-code-test/api/pkg/sandbox"
+	"workflow-code-test/api/pkg/sheets"
+	"workflow-code-test/api/pkg/sqlquery"
+	"workflow-code-test/api/pkg/statestore"
+	"workflow-code-test/api/pkg/weather"
+)
+
+// Dependencies are the external clients used by the built-in handlers.
+type Dependencies struct {
+	Weather weather.Client
+	Email   email.Client
+
+	// Cities are the cities form and integration nodes accept. Defaults to
+	// an in-process catalog of weather.DefaultCities.
+	Cities weather.Catalog
+
+	// Lists are the distribution lists email nodes can send to. Defaults to
+	// an empty in-process store.
+	Lists email.Lists
+
+	// Jira and GitHub file the issues of jira_issue and github_issue nodes.
+	// Default to clients that only log the issues.
+	Jira   issues.Client
+	GitHub issues.Client
+
+	// PagerDuty and Opsgenie raise the incidents of pagerduty_incident and
+	// opsgenie_incident nodes. Default to clients that only log the incidents.
+	PagerDuty incidents.Client
+	Opsgenie  incidents.Client
+
+	// Sheets appends the rows of sheets_append nodes. Defaults to a client
+	// that only logs the rows.
+	Sheets sheets.Client
+
+	// MQTT publishes the messages of mqtt_publish nodes. Defaults to a
+	// publisher that only logs the messages.
+	MQTT mqtt.Publisher
+
+	// Saga calls the services behind saga_reserve, saga_confirm and
+	// saga_cancel nodes. Defaults to a client that only logs the calls.
+	Saga saga.Client
+
+	// Dedupe keeps the keys claimed by dedupe nodes. Defaults to an in-process
+	// store.
+	Dedupe dedupe.Store
+
+	// State keeps the counters and values of counter and kvstore nodes.
+	// Defaults to an in-process store.
+	State statestore.Store
+
+	// Queries are the read-only SQL queries query nodes can run. Without
+	// them the query node type isn't registered.
+	Queries sqlquery.Runner
+
+	// Outbox records the emails sent through the mock clients the handlers
+	// create themselves, such as the sandbox variant's. Nil records nothing.
+	Outbox *email.Outbox
+
+	// Sandbox marks the clients as deterministic fakes. Steps of nodes that
+	// call out then report "sandbox": true in their output.
+	Sandbox bool
+}
+
+// RegisterDefaults registers the handlers for all built-in node types.
+func RegisterDefaults(r *engine.Registry, deps Dependencies) {
+	if deps.Cities == nil {
+		deps.Cities = weather.NewMemoryCatalog(weather.DefaultCities...)
+	}
+	if deps.Dedupe == nil {
+		deps.Dedupe = dedupe.NewMemoryStore()
+	}
+	if deps.Jira == nil {
+		deps.Jira = issues.NewMockClient(TrackerJira)
+	}
+	if deps.GitHub == nil {
+		deps.GitHub = issues.NewMockClient(TrackerGitHub)
+	}
+	if deps.PagerDuty == nil {
+		deps.PagerDuty = incidents.NewMockClient(ProviderPagerDuty)
+	}
+	if deps.Opsgenie == nil {
+		deps.Opsgenie = incidents.NewMockClient(ProviderOpsgenie)
+	}
+	if deps.Sheets == nil {
+		deps.Sheets = sheets.NewMockClient()
+	}
+	if deps.MQTT == nil {
+		deps.MQTT = mqtt.NewMockPublisher()
+	}
+	if deps.Saga == nil {
+		deps.Saga = saga.NewMockClient()
+	}
+	if deps.Lists == nil {
+		deps.Lists = email.NewMemoryLists()
+	}
+	if deps.State == nil {
+		deps.State = statestore.NewMemoryStore()
+	}
+	describe := func(nodeType string, h engine.NodeHandler, schema map[string]any) {
+		r.Register(nodeType, engine.WithOutputSchema(h, schema))
+	}
+	describe(engine.NodeTypeStart, engine.HandlerFunc(Start), startOutput)
+	describe(engine.NodeTypeEnd, engine.HandlerFunc(End), endOutput)
+	describe(engine.NodeTypeMerge, engine.HandlerFunc(Merge), mergeOutput)
+	describe(engine.NodeTypeLoop, engine.WithCompiler(engine.HandlerFunc(Loop), CompileLoop), loopOutput)
+	describe("form", NewForm(deps.Cities), formOutput)
+	describe("integration", outbound(NewIntegration(deps.Weather, deps.Cities), deps.Sandbox), integrationOutput())
+	describe("condition", engine.WithCompiler(engine.HandlerFunc(Condition), CompileCondition), conditionOutput)
+	describe("email", outbound(NewEmail(deps.Email, deps.Lists), deps.Sandbox), emailOutput())
+	describe("aggregate", engine.WithCompiler(engine.HandlerFunc(Aggregate), CompileAggregate), aggregateOutput)
+	describe("transform", engine.WithCompiler(engine.HandlerFunc(Transform), CompileTransform), transformOutput)
+	describe("classify", engine.WithCompiler(engine.HandlerFunc(Classify), CompileClassify), classifyOutput)
+	describe("validate", engine.HandlerFunc(Validate), validateOutput)
+	describe("dedupe", NewDedupe(deps.Dedupe), dedupeOutput)
+	describe("jira_issue", outbound(NewIssue(TrackerJira, deps.Jira), deps.Sandbox), issueOutput())
+	describe("github_issue", outbound(NewIssue(TrackerGitHub, deps.GitHub), deps.Sandbox), issueOutput())
+	describe("pagerduty_incident", outbound(NewIncident(ProviderPagerDuty, deps.PagerDuty), deps.Sandbox), incidentOutput())
+	describe("opsgenie_incident", outbound(NewIncident(ProviderOpsgenie, deps.Opsgenie), deps.Sandbox), incidentOutput())
+	describe("sheets_append", outbound(NewSheetsAppend(deps.Sheets), deps.Sandbox), sheetsOutput())
+	describe("mqtt_publish", outbound(NewMQTTPublish(deps.MQTT), deps.Sandbox), mqttOutput())
+	for _, kind := range []string{SagaReserve, SagaConfirm, SagaCancel} {
+		describe(kind, outbound(NewSagaStep(kind, deps.Saga), deps.Sandbox), sagaOutput())
+	}
+	describe("counter", NewCounter(deps.State), counterOutput)
+	describe("kvstore", NewKVStore(deps.State), kvstoreOutput)
+	if deps.Queries != nil {
+		describe("query", NewQuery(deps.Queries), queryOutput)
+	}
+	describe("wait_until", outbound(NewWaitUntil(deps.Weather, deps.Cities), deps.Sandbox), waitUntilOutput())
+
+	// Workflows can bind the outbound node types to sandboxed handlers
+	// while the rest of the deployment calls the real services.
+	r.RegisterVariant("integration", VariantSandbox,
+		outbound(NewIntegration(sandbox.NewWeatherClient(sandbox.DefaultTemperature), deps.Cities), true))
+	r.RegisterVariant("email", VariantSandbox, outbound(NewEmail(email.NewRecordingClient(deps.Outbox), deps.Lists), true))
+	r.RegisterVariant("wait_until", VariantSandbox,
+		outbound(NewWaitUntil(sandbox.NewWeatherClient(sandbox.DefaultTemperature), deps.Cities), true))
+	r.RegisterVariant("jira_issue", VariantSandbox, outbound(NewIssue(TrackerJira, issues.NewMockClient(TrackerJira)), true))
+	r.RegisterVariant("github_issue", VariantSandbox,
+		outbound(NewIssue(TrackerGitHub, issues.NewMockClient(TrackerGitHub)), true))
+	r.RegisterVariant("pagerduty_incident", VariantSandbox,
+		outbound(NewIncident(ProviderPagerDuty, incidents.NewMockClient(ProviderPagerDuty)), true))
+	r.RegisterVariant("opsgenie_incident", VariantSandbox,
+		outbound(NewIncident(ProviderOpsgenie, incidents.NewMockClient(ProviderOpsgenie)), true))
+	r.RegisterVariant("sheets_append", VariantSandbox, outbound(NewSheetsAppend(sheets.NewMockClient()), true))
+	r.RegisterVariant("mqtt_publish", VariantSandbox, outbound(NewMQTTPublish(mqtt.NewMockPublisher()), true))
+	for _, kind := range []string{SagaReserve, SagaConfirm, SagaCancel} {
+		r.RegisterVariant(kind, VariantSandbox, outbound(NewSagaStep(kind, saga.NewMockClient()), true))
+	}
+}
+
+// Trackers issue nodes file issues in.
+const (
+	TrackerJira   = "jira"
+	TrackerGitHub = "github"
+)
+
+// On-call providers incident nodes raise incidents with.
+const (
+	ProviderPagerDuty = "pagerduty"
+	ProviderOpsgenie  = "opsgenie"
+)
+
+// VariantSandbox names the handler variants backed by deterministic fakes.
+const VariantSandbox = "sandbox"
+
+// RegisterEnvironment registers the handlers of the node types that call out
+// as variants named after an environment, built with that environment's
+// clients. Runs in the environment bind those node types to the variants.
+func RegisterEnvironment(r *engine.Registry, name string, deps Dependencies) {
+	if deps.Cities == nil {
+		deps.Cities = weather.NewMemoryCatalog(weather.DefaultCities...)
+	}
+	r.RegisterVariant("integration", name, outbound(NewIntegration(deps.Weather, deps.Cities), deps.Sandbox))
+	r.RegisterVariant("email", name, outbound(NewEmail(deps.Email, deps.Lists), deps.Sandbox))
+	r.RegisterVariant("wait_until", name, outbound(NewWaitUntil(deps.Weather, deps.Cities), deps.Sandbox))
+	if deps.Jira != nil {
+		r.RegisterVariant("jira_issue", name, outbound(NewIssue(TrackerJira, deps.Jira), deps.Sandbox))
+	}
+	if deps.GitHub != nil {
+		r.RegisterVariant("github_issue", name, outbound(NewIssue(TrackerGitHub, deps.GitHub), deps.Sandbox))
+	}
+	if deps.PagerDuty != nil {
+		r.RegisterVariant("pagerduty_incident", name, outbound(NewIncident(ProviderPagerDuty, deps.PagerDuty), deps.Sandbox))
+	}
+	if deps.Opsgenie != nil {
+		r.RegisterVariant("opsgenie_incident", name, outbound(NewIncident(ProviderOpsgenie, deps.Opsgenie), deps.Sandbox))
+	}
+	if deps.Sheets != nil {
+		r.RegisterVariant("sheets_append", name, outbound(NewSheetsAppend(deps.Sheets), deps.Sandbox))
+	}
+	if deps.MQTT != nil {
+		r.RegisterVariant("mqtt_publish", name, outbound(NewMQTTPublish(deps.MQTT), deps.Sandbox))
+	}
+	if deps.Saga != nil {
+		for _, kind := range []string{SagaReserve, SagaConfirm, SagaCancel} {
+			r.RegisterVariant(kind, name, outbound(NewSagaStep(kind, deps.Saga), deps.Sandbox))
+		}
+	}
+}
+
+// outbound marks the output of a handler that calls an external service when
+// running in the integration sandbox.
+func outbound(h engine.NodeHandler, sandbox bool) engine.NodeHandler {
+	if !sandbox {
+		return h
+	}
+	marked := engine.HandlerFunc(func(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+		result, err := h.Execute(ec, node)
+		if err != nil || result == nil {
+			return result, err
+		}
+		if result.Output == nil {
+			result.Output = map[string]any{}
+		}
+		result.Output["sandbox"] = true
+		return result, nil
+	})
+	if c, ok := h.(engine.Compiler); ok {
+		return engine.WithCompiler(marked, c.Compile)
+	}
+	return marked
+}
+
+// Start marks the beginning of a run. It copies the variables a webhook
+// receiver mapped from its payload into the state.
+func Start(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	variables, _ := ec.Input["variables"].(map[string]any)
+	if len(variables) == 0 {
+		return &engine.NodeResult{}, nil
+	}
+	maps.Copy(ec.State, variables)
+	return &engine.NodeResult{Output: map[string]any{"variables": variables}}, nil
+}
+
+// End marks the end of a run.
+func End(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	return &engine.NodeResult{}, nil
+}
+
+// Merge joins parallel branches; the executor waits for all of them before
+// running it.
+func Merge(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	return &engine.NodeResult{}, nil
+}
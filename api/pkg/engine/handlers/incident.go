@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/incidents"
+)
+
+// Incident raises an incident with an on-call provider, e.g. to page someone
+// when a condition trips. Its "summary", "dedupKey" and "source" metadata are
+// templates rendered from state; triggers with the same dedup key, e.g.
+// "temperature-{{city}}", add to one open incident rather than paging again.
+// "severity" is critical, error, warning or info and defaults to error. The
+// routing key is part of the deployment's configuration, never the workflow.
+// The incident's dedup key is stored in the incidentKey variable.
+type Incident struct {
+	provider string
+	client   incidents.Client
+}
+
+func NewIncident(provider string, client incidents.Client) *Incident {
+	return &Incident{provider: provider, client: client}
+}
+
+// incidentTemplate is the parsed metadata of a node.
+type incidentTemplate struct {
+	summary, dedupKey, source *engine.Template
+	severity                  string
+}
+
+// DefaultSeverity is the severity of incidents whose node doesn't set one.
+const DefaultSeverity = incidents.SeverityError
+
+// Compile parses the node's templates and checks its severity.
+func (h *Incident) Compile(node *engine.Node) (any, error) {
+	return compileIncident(node)
+}
+
+func compileIncident(node *engine.Node) (incidentTemplate, error) {
+	summary, _ := node.String("summary")
+	dedupKey, _ := node.String("dedupKey")
+	source, _ := node.String("source")
+	severity, _ := node.String("severity")
+	if severity == "" {
+		severity = DefaultSeverity
+	}
+	if !incidents.ValidSeverity(severity) {
+		return incidentTemplate{}, fmt.Errorf("severity must be critical, error, warning or info")
+	}
+	return incidentTemplate{
+		summary:  engine.CompileTemplate(summary),
+		dedupKey: engine.CompileTemplate(dedupKey),
+		source:   engine.CompileTemplate(source),
+		severity: severity,
+	}, nil
+}
+
+func (h *Incident) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	tmpl, ok := node.Compiled().(incidentTemplate)
+	if !ok {
+		var err error
+		if tmpl, err = compileIncident(node); err != nil {
+			return nil, fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+		}
+	}
+	incident := incidents.Incident{
+		Summary:  tmpl.summary.Render(ec.State),
+		Severity: tmpl.severity,
+		DedupKey: tmpl.dedupKey.Render(ec.State),
+		Source:   tmpl.source.Render(ec.State),
+		Details:  map[string]any{"nodeId": node.ID},
+	}
+	if incident.Summary == "" {
+		return nil, fmt.Errorf("%w: %s needs a summary", engine.ErrInvalidInput, node.Type)
+	}
+
+	// Incidents page whoever is on call.
+	if err := ec.Spend(engine.ResourceNotifications, 1); err != nil {
+		return nil, err
+	}
+	triggered, err := h.client.Trigger(ec.Ctx, incident)
+	if err != nil {
+		return nil, fmt.Errorf("failed to trigger %s incident: %w", h.provider, err)
+	}
+
+	ec.State["incidentKey"] = triggered.DedupKey
+
+	return &engine.NodeResult{Output: map[string]any{
+		"provider":    h.provider,
+		"incident":    incident,
+		"incidentKey": triggered.DedupKey,
+	}}, nil
+}
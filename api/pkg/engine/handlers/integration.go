@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/weather"
+)
+
+// Integration fetches the current temperature for the city in state. A
+// "location" object ({"city", "lat", "lon"}) in the node metadata pins the node
+// to a fixed site instead, and an "options" list of the same objects overrides
+// the coordinates of the cities it names; other cities are looked up in the
+// catalog. When the client is a
+// *weather.Failover, a "provider" metadata key picks the provider tried first.
+type Integration struct {
+	client weather.Client
+	cities weather.Catalog
+}
+
+func NewIntegration(client weather.Client, cities weather.Catalog) *Integration {
+	return &Integration{client: client, cities: cities}
+}
+
+func (h *Integration) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	city, err := h.resolveLocation(ec, node)
+	if err != nil {
+		return nil, err
+	}
+
+	client := h.client
+	if name, ok := node.String("provider"); ok && name != "" {
+		failover, isFailover := client.(*weather.Failover)
+		if !isFailover {
+			return nil, fmt.Errorf("%w: weather provider selection is not available", engine.ErrInvalidInput)
+		}
+		if client, ok = failover.Prefer(name); !ok {
+			return nil, fmt.Errorf("%w: unknown weather provider %q", engine.ErrInvalidInput, name)
+		}
+	}
+
+	if err := ec.Spend(engine.ResourceExternalCalls, 1); err != nil {
+		return nil, err
+	}
+	temperature, err := client.CurrentTemperature(ec.Ctx, city.Lat, city.Lon)
+	if err != nil {
+		return nil, err
+	}
+
+	ec.State["temperature"] = temperature
+	for _, name := range node.Strings("outputVariables") {
+		if name != "temperature" {
+			ec.State[name] = temperature
+		}
+	}
+
+	output := map[string]any{"temperature": temperature, "location": city.Name}
+	if city.Country != "" {
+		output["country"] = city.Country
+	}
+	return &engine.NodeResult{Output: output}, nil
+}
+
+// resolveLocation picks the coordinates to query: the node's fixed location if
+// configured, otherwise the city in state, looked up in the node's options
+// before the location a form node resolved it to and the city catalog.
+func (h *Integration) resolveLocation(ec *engine.ExecutionContext, node *engine.Node) (weather.City, error) {
+	if raw := node.Map("location"); raw != nil {
+		city, err := parseCity(raw)
+		if err != nil {
+			return weather.City{}, fmt.Errorf("invalid location metadata: %w", err)
+		}
+		return city, nil
+	}
+
+	cityVar := "city"
+	if inputs := node.Strings("inputVariables"); len(inputs) > 0 {
+		cityVar = inputs[0]
+	}
+	name, _ := ec.State[cityVar].(string)
+
+	if options, ok := node.Metadata["options"].([]any); ok {
+		for _, o := range options {
+			raw, _ := o.(map[string]any)
+			city, err := parseCity(raw)
+			if err == nil && strings.EqualFold(city.Name, strings.TrimSpace(name)) {
+				return city, nil
+			}
+		}
+	}
+
+	if raw, ok := ec.State[LocationVariable].(map[string]any); ok {
+		city, err := parseCity(raw)
+		if err == nil && strings.EqualFold(city.Name, strings.TrimSpace(name)) {
+			return city, nil
+		}
+	}
+
+	country, _ := ec.State["country"].(string)
+	city, ok, err := weather.ResolveCity(ec.Ctx, h.cities, name, country)
+	if errors.Is(err, weather.ErrAmbiguousCity) {
+		return weather.City{}, fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+	}
+	if err != nil {
+		return weather.City{}, fmt.Errorf("failed to look up city: %w", err)
+	}
+	if !ok {
+		return weather.City{}, fmt.Errorf("%w: unsupported city %q", engine.ErrInvalidInput, name)
+	}
+	return city, nil
+}
+
+// parseCity reads a {"city", "lat", "lon"} object from node metadata or state,
+// optionally with the "country", "timezone" and "placeId" of the place.
+func parseCity(raw map[string]any) (weather.City, error) {
+	lat, err := engine.ToFloat(raw["lat"])
+	if err != nil {
+		return weather.City{}, fmt.Errorf("lat: %w", err)
+	}
+	lon, err := engine.ToFloat(raw["lon"])
+	if err != nil {
+		return weather.City{}, fmt.Errorf("lon: %w", err)
+	}
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return weather.City{}, fmt.Errorf("coordinates %v,%v out of range", lat, lon)
+	}
+	name, _ := raw["city"].(string)
+	if name == "" {
+		name = fmt.Sprintf("%.4f,%.4f", lat, lon)
+	}
+	city := weather.City{Name: name, Lat: lat, Lon: lon, Enabled: true}
+	city.Country, _ = raw["country"].(string)
+	city.Timezone, _ = raw["timezone"].(string)
+	city.PlaceID, _ = raw["placeId"].(string)
+	return city, nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"fmt"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/issues"
+)
+
+// Issue files an issue in a tracker, e.g. to turn an alert into a ticket. Its
+// "project" metadata is the Jira project key or the GitHub repository as
+// "owner/repo"; "title" and "body" are templates rendered from state, and
+// "labels" and, for Jira, "issueType" are passed on. The created issue's key
+// and URL are stored in the issueKey and issueUrl variables.
+type Issue struct {
+	tracker string
+	client  issues.Client
+}
+
+func NewIssue(tracker string, client issues.Client) *Issue {
+	return &Issue{tracker: tracker, client: client}
+}
+
+// issueTemplate is the parsed title and body metadata of a node.
+type issueTemplate struct {
+	title, body *engine.Template
+}
+
+// Compile parses the node's title and body templates.
+func (h *Issue) Compile(node *engine.Node) (any, error) {
+	return compileIssue(node), nil
+}
+
+func compileIssue(node *engine.Node) issueTemplate {
+	title, _ := node.String("title")
+	body, _ := node.String("body")
+	return issueTemplate{title: engine.CompileTemplate(title), body: engine.CompileTemplate(body)}
+}
+
+func (h *Issue) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	project, _ := node.String("project")
+	if project == "" {
+		return nil, fmt.Errorf("%w: %s needs a project", engine.ErrInvalidInput, node.Type)
+	}
+	tmpl, ok := node.Compiled().(issueTemplate)
+	if !ok {
+		tmpl = compileIssue(node)
+	}
+	issue := issues.Issue{
+		Project: project,
+		Title:   tmpl.title.Render(ec.State),
+		Body:    tmpl.body.Render(ec.State),
+		Labels:  node.Strings("labels"),
+	}
+	issue.Type, _ = node.String("issueType")
+	if issue.Title == "" {
+		return nil, fmt.Errorf("%w: %s needs a title", engine.ErrInvalidInput, node.Type)
+	}
+
+	if err := ec.Spend(engine.ResourceExternalCalls, 1); err != nil {
+		return nil, err
+	}
+	created, err := h.client.Create(ec.Ctx, issue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s issue: %w", h.tracker, err)
+	}
+
+	ec.State["issueKey"] = created.Key
+	ec.State["issueUrl"] = created.URL
+
+	return &engine.NodeResult{Output: map[string]any{
+		"tracker":  h.tracker,
+		"issue":    issue,
+		"issueKey": created.Key,
+		"issueUrl": created.URL,
+	}}, nil
+}
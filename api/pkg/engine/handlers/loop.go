@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"fmt"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// Loop branches.
+const (
+	LoopBody = engine.LoopBody
+	LoopDone = engine.LoopDone
+)
+
+// Loop repeats the nodes on its "body" branch, which lead back to it, up to
+// "maxIterations" times, or once per item of its "items" list, and then
+// takes its "done" branch. While the body runs, the loop state variable
+// holds the loop's id, the index of the iteration, from zero, and its item;
+// the one of the loop around it, if any, is restored when it's done. With
+// "collect" the values the iterations left in that variable end up in
+// order in the loop's first outputVariables entry, or "results". Loops in
+// "parallel" mode are run by the executor itself, see engine.LoopOptions.
+func Loop(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	opts, ok := node.Compiled().(*engine.LoopOptions)
+	if !ok {
+		v, err := CompileLoop(node)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+		}
+		opts = v.(*engine.LoopOptions)
+	}
+
+	l, done, err := ec.NextIteration(node, opts)
+	if err != nil {
+		return nil, err
+	}
+	if done {
+		output := map[string]any{"iterations": l.Index, "done": true}
+		if opts.Collect != "" {
+			output["results"] = ec.State[opts.Results]
+		}
+		return &engine.NodeResult{Output: output, Branch: LoopDone}, nil
+	}
+	return &engine.NodeResult{
+		Output: map[string]any{"index": l.Index, "done": false},
+		Branch: LoopBody,
+	}, nil
+}
+
+// CompileLoop checks the node's loop options.
+func CompileLoop(node *engine.Node) (any, error) {
+	opts, err := node.LoopOptions()
+	if err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
@@ -0,0 +1,198 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/engine/handlers"
+)
+
+// squarer squares the item of the current loop iteration into "square",
+// tracking how many iterations it runs at once. Later items finish sooner,
+// so parallel iterations complete out of order. The item in failOn fails.
+type squarer struct {
+	mu      sync.Mutex
+	running int
+	peak    int
+	failOn  float64
+}
+
+func (s *squarer) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	loop, _ := ec.State[engine.LoopVariable].(map[string]any)
+	item, _ := loop["item"].(float64)
+	s.mu.Lock()
+	s.running++
+	s.peak = max(s.peak, s.running)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running--
+		s.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(time.Duration(10-item) * time.Millisecond):
+	case <-ec.Ctx.Done():
+		return nil, context.Cause(ec.Ctx)
+	}
+	if item == s.failOn {
+		return nil, fmt.Errorf("%w: can't square %v", engine.ErrInvalidInput, item)
+	}
+	ec.State["square"] = item * item
+	return &engine.NodeResult{Output: map[string]any{"square": item * item}}, nil
+}
+
+// runSquares loops over the numbers 1 to 5 with the loop metadata in
+// metadata, squaring each.
+func runSquares(t *testing.T, s *squarer, metadata map[string]any) (*engine.Execution, error) {
+	t.Helper()
+	metadata["items"] = "numbers"
+	metadata["collect"] = "square"
+	metadata["outputVariables"] = []any{"squares"}
+	nodes := []engine.Node{
+		{ID: "start", Type: engine.NodeTypeStart},
+		{ID: "repeat", Type: engine.NodeTypeLoop, Metadata: metadata},
+		{ID: "square", Type: "square"},
+		{ID: "end", Type: engine.NodeTypeEnd},
+	}
+	edges := []engine.Edge{
+		{ID: "e1", Source: "start", Target: "repeat"},
+		{ID: "e2", Source: "repeat", Target: "square", SourceHandle: handlers.LoopBody},
+		{ID: "e3", Source: "square", Target: "repeat"},
+		{ID: "e4", Source: "repeat", Target: "end", SourceHandle: handlers.LoopDone},
+	}
+	g, err := engine.NewGraph(nodes, edges)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := engine.NewRegistry()
+	handlers.RegisterDefaults(registry, handlers.Dependencies{})
+	registry.Register("square", s)
+	input := map[string]any{"variables": map[string]any{"numbers": []any{1.0, 2.0, 3.0, 4.0, 5.0}}}
+	return engine.NewExecutor(registry).Execute(context.Background(), g, input)
+}
+
+// iterationsOf returns "node" for each step outside of loops and
+// "node[index]" for those in an iteration.
+func iterationsOf(exec *engine.Execution) []string {
+	var steps []string
+	for _, s := range exec.Steps {
+		if s.Iteration == nil {
+			steps = append(steps, s.NodeID)
+			continue
+		}
+		steps = append(steps, fmt.Sprintf("%s[%d]", s.NodeID, s.Iteration.Index))
+	}
+	return steps
+}
+
+func TestLoopSequential(t *testing.T) {
+	s := &squarer{}
+	exec, err := runSquares(t, s, map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []any{1.0, 4.0, 9.0, 16.0, 25.0}
+	if got := exec.State["squares"]; !slices.Equal(got.([]any), want) {
+		t.Errorf("squares = %v, want %v", got, want)
+	}
+	if s.peak != 1 {
+		t.Errorf("%d iterations ran at once, want 1", s.peak)
+	}
+	steps := []string{"start", "repeat", "square[0]", "repeat", "square[1]", "repeat", "square[2]",
+		"repeat", "square[3]", "repeat", "square[4]", "repeat", "end"}
+	if got := iterationsOf(exec); !slices.Equal(got, steps) {
+		t.Errorf("steps = %v, want %v", got, steps)
+	}
+	if _, ok := exec.State[engine.LoopVariable]; ok {
+		t.Error("loop variable still set after the loop")
+	}
+}
+
+func TestLoopParallel(t *testing.T) {
+	s := &squarer{}
+	exec, err := runSquares(t, s, map[string]any{"mode": "parallel", "maxParallelism": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Later items finish first, but the results keep the order of the items.
+	want := []any{1.0, 4.0, 9.0, 16.0, 25.0}
+	if got := exec.State["squares"]; !slices.Equal(got.([]any), want) {
+		t.Errorf("squares = %v, want %v", got, want)
+	}
+	if s.peak > 2 {
+		t.Errorf("%d iterations ran at once, want at most 2", s.peak)
+	}
+
+	// The loop runs once, and the steps of its iterations follow it in
+	// iteration order.
+	steps := []string{"start", "repeat", "square[0]", "square[1]", "square[2]", "square[3]", "square[4]", "end"}
+	if got := iterationsOf(exec); !slices.Equal(got, steps) {
+		t.Errorf("steps = %v, want %v", got, steps)
+	}
+	for _, step := range exec.Steps {
+		if step.NodeID != "square" {
+			continue
+		}
+		if want := fmt.Sprintf("repeat[%d]", step.Iteration.Index); step.ParallelBranch != want {
+			t.Errorf("iteration %d ran on parallel branch %q, want %q", step.Iteration.Index, step.ParallelBranch, want)
+		}
+	}
+	if out := exec.Steps[1].Output; out["iterations"] != 5 || out["done"] != true {
+		t.Errorf("loop output = %v, want 5 iterations done", out)
+	}
+	if _, ok := exec.State[engine.LoopVariable]; ok {
+		t.Error("loop variable still set after the loop")
+	}
+}
+
+func TestLoopParallelIterationFails(t *testing.T) {
+	s := &squarer{failOn: 3}
+	exec, err := runSquares(t, s, map[string]any{"mode": "parallel"})
+
+	var nodeErr *engine.NodeExecutionError
+	if !errors.As(err, &nodeErr) || nodeErr.NodeID != "square" || !errors.Is(err, engine.ErrInvalidInput) {
+		t.Fatalf("error = %v, want the failed iteration's", err)
+	}
+	if exec.Status != engine.ExecutionStatusFailed {
+		t.Errorf("status = %s, want failed", exec.Status)
+	}
+	if loop := exec.Steps[1]; loop.NodeID != "repeat" || loop.Status != engine.StepStatusFailed {
+		t.Errorf("loop step = %s %s, want repeat failed", loop.NodeID, loop.Status)
+	}
+	if _, ok := exec.State["squares"]; ok {
+		t.Error("results stored for a failed loop")
+	}
+}
+
+func TestLoopOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]any
+		want     string
+	}{
+		{"no limit", map[string]any{}, "loop needs maxIterations or items"},
+		{"items not a name", map[string]any{"items": 3}, "items must be the name of a variable"},
+		{"unknown mode", map[string]any{"items": "cities", "mode": "batched"}, "mode must be sequential or parallel, not batched"},
+		{"parallelism without parallel mode", map[string]any{"items": "cities", "maxParallelism": 2}, "maxParallelism needs mode parallel"},
+		{"parallelism not an integer", map[string]any{"items": "cities", "mode": "parallel", "maxParallelism": 1.5}, "maxParallelism must be an integer from 1 to 1000"},
+		{"collect not a name", map[string]any{"maxIterations": 2, "collect": true}, "collect must be the name of a variable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &engine.Node{ID: "repeat", Type: engine.NodeTypeLoop, Metadata: tt.metadata}
+			if _, err := handlers.CompileLoop(node); err == nil || err.Error() != tt.want {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/mqtt"
+)
+
+// MQTTPublish publishes a message to an MQTT broker, e.g. to switch a device
+// or feed a dashboard. Its "topic" and "payload" metadata are templates
+// rendered from state; without a payload the message is a JSON object of the
+// state variables listed in inputVariables. "qos" is 0 or 1, and "retain"
+// asks the broker to keep the message for future subscribers.
+type MQTTPublish struct {
+	publisher mqtt.Publisher
+}
+
+func NewMQTTPublish(publisher mqtt.Publisher) *MQTTPublish {
+	return &MQTTPublish{publisher: publisher}
+}
+
+// mqttTemplate is the parsed topic and payload metadata of a node.
+type mqttTemplate struct {
+	topic, payload *engine.Template
+	qos            byte
+}
+
+// Compile parses the node's templates and checks its QoS.
+func (h *MQTTPublish) Compile(node *engine.Node) (any, error) {
+	return compileMQTT(node)
+}
+
+func compileMQTT(node *engine.Node) (mqttTemplate, error) {
+	topic, _ := node.String("topic")
+	payload, _ := node.String("payload")
+	t := mqttTemplate{topic: engine.CompileTemplate(topic), payload: engine.CompileTemplate(payload)}
+	if raw, ok := node.Metadata["qos"]; ok {
+		qos, err := engine.ToFloat(raw)
+		if err != nil || (qos != 0 && qos != 1) {
+			return t, fmt.Errorf("qos must be 0 or 1")
+		}
+		t.qos = byte(qos)
+	}
+	return t, nil
+}
+
+func (h *MQTTPublish) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	tmpl, ok := node.Compiled().(mqttTemplate)
+	if !ok {
+		var err error
+		if tmpl, err = compileMQTT(node); err != nil {
+			return nil, fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+		}
+	}
+	topic := tmpl.topic.Render(ec.State)
+	if topic == "" {
+		return nil, fmt.Errorf("%w: mqtt_publish needs a topic", engine.ErrInvalidInput)
+	}
+	payload := []byte(tmpl.payload.Render(ec.State))
+	if _, ok := node.String("payload"); !ok {
+		fields := make(map[string]any)
+		for _, name := range node.Strings("inputVariables") {
+			fields[name] = ec.State[name]
+		}
+		var err error
+		if payload, err = json.Marshal(fields); err != nil {
+			return nil, fmt.Errorf("failed to encode message: %w", err)
+		}
+	}
+	retain, _ := node.Metadata["retain"].(bool)
+
+	if err := ec.Spend(engine.ResourceExternalCalls, 1); err != nil {
+		return nil, err
+	}
+	if err := h.publisher.Publish(ec.Ctx, topic, payload, tmpl.qos, retain); err != nil {
+		return nil, fmt.Errorf("failed to publish MQTT message: %w", err)
+	}
+
+	return &engine.NodeResult{Output: map[string]any{
+		"topic":   topic,
+		"payload": string(payload),
+		"qos":     tmpl.qos,
+		"retain":  retain,
+	}}, nil
+}
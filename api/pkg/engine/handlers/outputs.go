@@ -0,0 +1,227 @@
+package handlers
+
+// The output schemas of the built-in node types, in JSON Schema. Objects list
+// every member their handler may output; additionalProperties is only
+// allowed where the members depend on the node, as with form fields and
+// transform mappings.
+
+var (
+	stringSchema  = map[string]any{"type": "string"}
+	numberSchema  = map[string]any{"type": "number"}
+	integerSchema = map[string]any{"type": "integer"}
+	booleanSchema = map[string]any{"type": "boolean"}
+	anySchema     = map[string]any{}
+)
+
+// objectSchema returns the schema of an object with only the given members.
+func objectSchema(properties map[string]any, required ...string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// openObjectSchema returns the schema of an object that may have members
+// besides the given ones.
+func openObjectSchema(properties map[string]any) map[string]any {
+	return map[string]any{"type": "object", "properties": properties, "additionalProperties": true}
+}
+
+func arraySchema(items map[string]any) map[string]any {
+	return map[string]any{"type": "array", "items": items}
+}
+
+// outboundOutput adds the sandbox flag outbound handlers set in the sandbox
+// to the schema of their output.
+func outboundOutput(schema map[string]any) map[string]any {
+	properties := schema["properties"].(map[string]any)
+	properties["sandbox"] = booleanSchema
+	return schema
+}
+
+// locationSchema is the shape of LocationVariable.
+var locationSchema = objectSchema(map[string]any{
+	"city":     stringSchema,
+	"country":  stringSchema,
+	"lat":      numberSchema,
+	"lon":      numberSchema,
+	"timezone": stringSchema,
+	"placeId":  stringSchema,
+}, "city", "lat", "lon")
+
+var startOutput = objectSchema(map[string]any{"variables": openObjectSchema(map[string]any{})})
+
+var endOutput = objectSchema(map[string]any{})
+
+var mergeOutput = objectSchema(map[string]any{})
+
+// loopOutput has the index of the iteration starting, or the number of
+// iterations once done, with the values collected from them.
+var loopOutput = objectSchema(map[string]any{
+	"index":      integerSchema,
+	"iterations": integerSchema,
+	"done":       booleanSchema,
+	"results":    arraySchema(anySchema),
+}, "done")
+
+// formOutput has a member per submitted field.
+var formOutput = openObjectSchema(map[string]any{LocationVariable: locationSchema})
+
+func integrationOutput() map[string]any {
+	return outboundOutput(objectSchema(map[string]any{
+		"temperature": numberSchema,
+		"location":    stringSchema,
+		"country":     stringSchema,
+	}, "temperature", "location"))
+}
+
+var conditionOutput = objectSchema(map[string]any{
+	"conditionMet": booleanSchema,
+	"threshold":    numberSchema,
+	"operator":     stringSchema,
+	"actualValue":  numberSchema,
+	"message":      stringSchema,
+}, "conditionMet", "threshold", "operator", "actualValue", "message")
+
+func emailOutput() map[string]any {
+	return outboundOutput(objectSchema(map[string]any{
+		"emailDraft": objectSchema(map[string]any{
+			"to":        stringSchema,
+			"from":      stringSchema,
+			"subject":   stringSchema,
+			"body":      stringSchema,
+			"timestamp": map[string]any{"type": "string", "format": "date-time"},
+			"attachments": arraySchema(objectSchema(map[string]any{
+				"filename":    stringSchema,
+				"contentType": stringSchema,
+				"size":        integerSchema,
+			}, "filename", "contentType", "size")),
+		}),
+		"deliveryStatus": map[string]any{"type": "string", "enum": []any{"sent", "partial"}},
+		"messageId":      stringSchema,
+		"emailSent":      booleanSchema,
+		"recipients":     arraySchema(stringSchema),
+		"deliveries": arraySchema(objectSchema(map[string]any{
+			"to":        stringSchema,
+			"status":    map[string]any{"type": "string", "enum": []any{"sent", "failed"}},
+			"messageId": stringSchema,
+			"error":     stringSchema,
+		}, "to", "status")),
+	}, "emailDraft", "deliveryStatus", "messageId", "emailSent", "recipients", "deliveries"))
+}
+
+var aggregateOutput = objectSchema(map[string]any{
+	"operation": stringSchema,
+	"count":     integerSchema,
+	"result":    anySchema,
+}, "operation", "count", "result")
+
+// transformOutput has a member per mapping.
+var transformOutput = openObjectSchema(map[string]any{})
+
+var classifyOutput = objectSchema(map[string]any{
+	"category": stringSchema,
+	"scores":   map[string]any{"type": "object", "additionalProperties": numberSchema},
+	"matches":  anySchema,
+}, "category")
+
+var validateOutput = objectSchema(map[string]any{
+	"valid": booleanSchema,
+	"errors": arraySchema(objectSchema(map[string]any{
+		"path":    stringSchema,
+		"message": stringSchema,
+	})),
+}, "valid")
+
+var dedupeOutput = objectSchema(map[string]any{
+	"key":       stringSchema,
+	"duplicate": booleanSchema,
+}, "key", "duplicate")
+
+func issueOutput() map[string]any {
+	return outboundOutput(objectSchema(map[string]any{
+		"tracker": stringSchema,
+		"issue": objectSchema(map[string]any{
+			"project": stringSchema,
+			"title":   stringSchema,
+			"body":    stringSchema,
+			"labels":  arraySchema(stringSchema),
+			"type":    stringSchema,
+		}),
+		"issueKey": stringSchema,
+		"issueUrl": stringSchema,
+	}, "tracker", "issue", "issueKey", "issueUrl"))
+}
+
+func incidentOutput() map[string]any {
+	return outboundOutput(objectSchema(map[string]any{
+		"provider": stringSchema,
+		"incident": objectSchema(map[string]any{
+			"summary":  stringSchema,
+			"severity": stringSchema,
+			"dedupKey": stringSchema,
+			"source":   stringSchema,
+			"details":  openObjectSchema(map[string]any{}),
+		}),
+		"incidentKey": stringSchema,
+	}, "provider", "incident", "incidentKey"))
+}
+
+func sheetsOutput() map[string]any {
+	return outboundOutput(objectSchema(map[string]any{
+		"spreadsheetId": stringSchema,
+		"row":           arraySchema(stringSchema),
+		"updatedRange":  stringSchema,
+	}, "spreadsheetId", "row", "updatedRange"))
+}
+
+func mqttOutput() map[string]any {
+	return outboundOutput(objectSchema(map[string]any{
+		"topic":   stringSchema,
+		"payload": stringSchema,
+		"qos":     integerSchema,
+		"retain":  booleanSchema,
+	}, "topic", "payload", "qos", "retain"))
+}
+
+// sagaOutput has a reservationId for saga_reserve nodes only.
+func sagaOutput() map[string]any {
+	return outboundOutput(objectSchema(map[string]any{
+		"method":        stringSchema,
+		"url":           stringSchema,
+		"status":        integerSchema,
+		"response":      anySchema,
+		"reservationId": anySchema,
+	}, "method", "url", "status"))
+}
+
+var counterOutput = objectSchema(map[string]any{
+	"name":  stringSchema,
+	"value": integerSchema,
+}, "name", "value")
+
+// kvstoreOutput has found for "get" operations only.
+var kvstoreOutput = objectSchema(map[string]any{
+	"key":   stringSchema,
+	"value": anySchema,
+	"found": booleanSchema,
+}, "key", "value")
+
+var queryOutput = objectSchema(map[string]any{
+	"query":     stringSchema,
+	"rowCount":  integerSchema,
+	"truncated": booleanSchema,
+}, "query", "rowCount", "truncated")
+
+func waitUntilOutput() map[string]any {
+	return outboundOutput(objectSchema(map[string]any{
+		"conditionMet": booleanSchema,
+		"threshold":    numberSchema,
+		"operator":     stringSchema,
+		"actualValue":  numberSchema,
+		"polls":        integerSchema,
+		"deadline":     map[string]any{"type": "string", "format": "date-time"},
+		"message":      stringSchema,
+	}, "conditionMet", "threshold", "operator", "actualValue", "polls", "deadline"))
+}
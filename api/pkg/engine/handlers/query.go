@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/jsonpath"
+	"workflow-code-test/api/pkg/sqlquery"
+)
+
+// Query runs one of the read-only queries administrators registered, named
+// by its "query" metadata. Each query parameter is taken from the state value
+// at the JSONPath the node's "params" map gives for it, or from the state
+// variable of the same name. The rows go to the first outputVariables entry,
+// or "rows", and the "mappings" metadata copies columns of the first row into
+// state variables, e.g. {"customerTier": "tier"}. When there are no rows the
+// run continues, or ends at the node with "onEmpty": "end", or with
+// "onEmpty": "branch" follows the "empty" edge; rows then follow "found".
+type Query struct {
+	queries sqlquery.Runner
+}
+
+func NewQuery(queries sqlquery.Runner) *Query {
+	return &Query{queries: queries}
+}
+
+// queryParams maps query parameters to the state paths they are read from.
+type queryParams map[string]*jsonpath.Path
+
+// Compile checks that the node's query exists and parses its parameter
+// paths.
+func (h *Query) Compile(node *engine.Node) (any, error) {
+	return h.compile(node)
+}
+
+func (h *Query) compile(node *engine.Node) (queryParams, error) {
+	name, _ := node.String("query")
+	q, ok := h.queries.Query(name)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", sqlquery.ErrUnknownQuery, name)
+	}
+	raw := node.Map("params")
+	params := make(queryParams, len(q.Params))
+	for _, p := range q.Params {
+		expr, _ := raw[p].(string)
+		if expr == "" {
+			expr = "$." + p
+		}
+		path, err := jsonpath.Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("params.%s: %w", p, err)
+		}
+		params[p] = path
+	}
+	for p := range raw {
+		if !slices.Contains(q.Params, p) {
+			return nil, fmt.Errorf("params.%s: query %s has no such parameter", p, name)
+		}
+	}
+	for v, column := range node.Map("mappings") {
+		if s, ok := column.(string); !ok || s == "" {
+			return nil, fmt.Errorf("mappings.%s must name a column", v)
+		}
+	}
+	return params, nil
+}
+
+func (h *Query) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	onEmpty, _ := node.String("onEmpty")
+	if onEmpty != "" && onEmpty != "continue" && onEmpty != "end" && onEmpty != "branch" {
+		return nil, fmt.Errorf("%w: onEmpty must be continue, end or branch", engine.ErrInvalidInput)
+	}
+	params, _ := node.Compiled().(queryParams)
+	if params == nil {
+		var err error
+		if params, err = h.compile(node); err != nil {
+			return nil, fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+		}
+	}
+
+	args := make(map[string]any, len(params))
+	for p, path := range params {
+		v, err := path.Get(ec.State)
+		if err != nil {
+			return nil, fmt.Errorf("%w: query parameter %s: %v", engine.ErrInvalidInput, p, err)
+		}
+		args[p] = v
+	}
+	name, _ := node.String("query")
+	result, err := h.queries.Run(ec.Ctx, name, args)
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %w", name, err)
+	}
+
+	ec.State[stateOutput(node, "rows")] = result.Rows
+	if len(result.Rows) > 0 {
+		for v, column := range node.Map("mappings") {
+			ec.State[v] = result.Rows[0][column.(string)]
+		}
+	}
+
+	out := &engine.NodeResult{Output: map[string]any{
+		"query":     name,
+		"rowCount":  len(result.Rows),
+		"truncated": result.Truncated,
+	}}
+	switch {
+	case onEmpty == "branch" && len(result.Rows) > 0:
+		out.Branch = "found"
+	case onEmpty == "branch":
+		out.Branch = "empty"
+	case onEmpty == "end" && len(result.Rows) == 0:
+		out.Stop = true
+	}
+	return out, nil
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/jsonpath"
+	"workflow-code-test/api/pkg/saga"
+)
+
+// Node types of the steps of a saga. A reserve node books a resource and
+// usually names a cancel node in "compensateWith", which the executor runs if
+// the workflow fails afterwards; a confirm node makes the booking final.
+const (
+	SagaReserve = "saga_reserve"
+	SagaConfirm = "saga_confirm"
+	SagaCancel  = "saga_cancel"
+)
+
+// defaultReservationVariable holds the id of a reservation unless the reserve
+// node names another variable in its outputVariables.
+const defaultReservationVariable = "reservationId"
+
+// SagaStep calls a saga participant over HTTP. Its "url" and "body" metadata
+// are templates rendered from state; without a body, reserve and confirm
+// nodes send a JSON object of the state variables listed in inputVariables.
+// "method" defaults to POST, and to DELETE for cancel nodes. Reserve nodes
+// store the id found at "idPath" (default $.id) of the response in their
+// first output variable, reservationId by default.
+type SagaStep struct {
+	kind   string
+	client saga.Client
+}
+
+func NewSagaStep(kind string, client saga.Client) *SagaStep {
+	return &SagaStep{kind: kind, client: client}
+}
+
+// sagaTemplate is the parsed metadata of a saga node.
+type sagaTemplate struct {
+	method    string
+	url, body *engine.Template
+	idPath    *jsonpath.Path
+}
+
+var sagaMethods = []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// Compile parses the node's templates and checks its method and id path.
+func (h *SagaStep) Compile(node *engine.Node) (any, error) {
+	return h.compile(node)
+}
+
+func (h *SagaStep) compile(node *engine.Node) (sagaTemplate, error) {
+	url, _ := node.String("url")
+	body, _ := node.String("body")
+	t := sagaTemplate{method: http.MethodPost, url: engine.CompileTemplate(url), body: engine.CompileTemplate(body)}
+	if h.kind == SagaCancel {
+		t.method = http.MethodDelete
+	}
+	if method, ok := node.String("method"); ok && method != "" {
+		t.method = strings.ToUpper(method)
+		if !slices.Contains(sagaMethods, t.method) {
+			return t, fmt.Errorf("method must be one of %v", sagaMethods)
+		}
+	}
+	if h.kind == SagaReserve {
+		expr, _ := node.String("idPath")
+		if expr == "" {
+			expr = "$.id"
+		}
+		var err error
+		if t.idPath, err = jsonpath.Parse(expr); err != nil {
+			return t, fmt.Errorf("idPath: %v", err)
+		}
+	}
+	return t, nil
+}
+
+func (h *SagaStep) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	tmpl, ok := node.Compiled().(sagaTemplate)
+	if !ok {
+		var err error
+		if tmpl, err = h.compile(node); err != nil {
+			return nil, fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+		}
+	}
+	req := saga.Request{Method: tmpl.method, URL: tmpl.url.Render(ec.State)}
+	if req.URL == "" {
+		return nil, fmt.Errorf("%w: %s needs a url", engine.ErrInvalidInput, h.kind)
+	}
+	if _, ok := node.String("body"); ok {
+		req.Body = []byte(tmpl.body.Render(ec.State))
+	} else if inputs := node.Strings("inputVariables"); len(inputs) > 0 && h.kind != SagaCancel {
+		fields := make(map[string]any, len(inputs))
+		for _, name := range inputs {
+			fields[name] = ec.State[name]
+		}
+		var err error
+		if req.Body, err = json.Marshal(fields); err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	// Cancelling undoes a reservation, so it runs whatever the budget.
+	if h.kind != SagaCancel {
+		if err := ec.Spend(engine.ResourceExternalCalls, 1); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := h.client.Do(ec.Ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", h.kind, req.URL, err)
+	}
+
+	output := map[string]any{
+		"method":   req.Method,
+		"url":      req.URL,
+		"status":   resp.Status,
+		"response": resp.Body,
+	}
+	if h.kind == SagaReserve {
+		id, err := tmpl.idPath.Get(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("reservation id not found at %s: %v", tmpl.idPath, err)
+		}
+		variable := defaultReservationVariable
+		if outputs := node.Strings("outputVariables"); len(outputs) > 0 {
+			variable = outputs[0]
+		}
+		ec.State[variable] = id
+		output["reservationId"] = id
+	}
+	return &engine.NodeResult{Output: output}, nil
+}
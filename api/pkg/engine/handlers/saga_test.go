@@ -0,0 +1,212 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"workflow-code-test/api/pkg/email"
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/engine/handlers"
+	"workflow-code-test/api/pkg/saga"
+)
+
+// participant is a saga participant recording the calls it gets. Calls to
+// the paths in failing are answered with a 500.
+type participant struct {
+	mu      sync.Mutex
+	calls   []string
+	failing []string
+}
+
+func (p *participant) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.calls = append(p.calls, r.Method+" "+r.URL.Path)
+	fail := slices.Contains(p.failing, r.URL.Path)
+	p.mu.Unlock()
+	if fail {
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// The reservation id is the resource reserved, e.g. "room".
+	resource, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	w.Write([]byte(`{"id": "` + resource + `-1", "status": "ok"}`))
+}
+
+// bookingSaga reserves a room and a car, each cancelled when a later node
+// fails, notifies the guest and confirms both bookings, like the Room
+// Booking Saga seed workflow with a second reservation.
+func bookingSaga(t *testing.T, url string) *engine.Graph {
+	t.Helper()
+	nodes := []engine.Node{
+		{ID: "start", Type: engine.NodeTypeStart},
+		{ID: "form", Type: "form", Metadata: map[string]any{
+			"inputFields":     []any{"name", "email", "room"},
+			"outputVariables": []any{"name", "email", "room"},
+		}},
+		{ID: "reserve-room", Type: handlers.SagaReserve, Metadata: map[string]any{
+			"url":             url + "/room",
+			"inputVariables":  []any{"name", "room"},
+			"outputVariables": []any{"roomId"},
+			"compensateWith":  "cancel-room",
+		}},
+		{ID: "reserve-car", Type: handlers.SagaReserve, Metadata: map[string]any{
+			"url":             url + "/car",
+			"inputVariables":  []any{"name"},
+			"outputVariables": []any{"carId"},
+			"compensateWith":  "cancel-car",
+		}},
+		{ID: "notify", Type: "email", Metadata: map[string]any{
+			"inputVariables": []any{"name", "room", "roomId"},
+			"emailTemplate": map[string]any{
+				"subject": "Room {{room}} is held for you",
+				"body":    "Hi {{name}}, room {{room}} is held under booking {{roomId}}.",
+			},
+		}},
+		{ID: "confirm-room", Type: handlers.SagaConfirm, Metadata: map[string]any{"url": url + "/room/{{roomId}}/confirm"}},
+		{ID: "confirm-car", Type: handlers.SagaConfirm, Metadata: map[string]any{"url": url + "/car/{{carId}}/confirm"}},
+		{ID: "cancel-room", Type: handlers.SagaCancel, Metadata: map[string]any{"url": url + "/room/{{roomId}}"}},
+		{ID: "cancel-car", Type: handlers.SagaCancel, Metadata: map[string]any{"url": url + "/car/{{carId}}"}},
+		{ID: "end", Type: engine.NodeTypeEnd},
+	}
+	path := []string{"start", "form", "reserve-room", "reserve-car", "notify", "confirm-room", "confirm-car", "end"}
+	var edges []engine.Edge
+	for i := 1; i < len(path); i++ {
+		edges = append(edges, engine.Edge{ID: "e" + path[i], Source: path[i-1], Target: path[i]})
+	}
+	g, err := engine.NewGraph(nodes, edges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// runSaga runs the booking saga against p and returns the run's execution
+// and error.
+func runSaga(t *testing.T, p *participant) (*engine.Execution, error) {
+	t.Helper()
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+
+	registry := engine.NewRegistry()
+	handlers.RegisterDefaults(registry, handlers.Dependencies{
+		Email: email.NewRecordingClient(nil),
+		Saga:  saga.NewHTTPClient(),
+	})
+	input := map[string]any{"formData": map[string]any{"name": "Jo", "email": "jo@example.com", "room": "12"}}
+	return engine.NewExecutor(registry).Execute(context.Background(), bookingSaga(t, srv.URL), input)
+}
+
+// stepsOf returns "node:status" for each step, with a "+" before the node of
+// compensation steps.
+func stepsOf(exec *engine.Execution) []string {
+	var steps []string
+	for _, s := range exec.Steps {
+		id := s.NodeID
+		if s.Compensation {
+			id = "+" + id
+		}
+		steps = append(steps, id+":"+string(s.Status))
+	}
+	return steps
+}
+
+func TestSagaCompleted(t *testing.T) {
+	p := &participant{}
+	exec, err := runSaga(t, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"POST /room", "POST /car", "POST /room/room-1/confirm", "POST /car/car-1/confirm"}
+	if !slices.Equal(p.calls, want) {
+		t.Errorf("calls = %v, want %v", p.calls, want)
+	}
+	if slices.ContainsFunc(exec.Steps, func(s engine.ExecutionStep) bool { return s.Compensation }) {
+		t.Errorf("completed saga ran compensations: %v", stepsOf(exec))
+	}
+}
+
+func TestSagaCompensatesInReverseOrder(t *testing.T) {
+	p := &participant{failing: []string{"/car/car-1/confirm"}}
+	exec, err := runSaga(t, p)
+
+	var nodeErr *engine.NodeExecutionError
+	if !errors.As(err, &nodeErr) || nodeErr.NodeID != "confirm-car" {
+		t.Fatalf("run error = %v, want the failure of confirm-car", err)
+	}
+	if exec.Status != engine.ExecutionStatusFailed {
+		t.Errorf("status = %s, want failed", exec.Status)
+	}
+
+	// The car was reserved last, so it is cancelled first.
+	wantCalls := []string{
+		"POST /room", "POST /car", "POST /room/room-1/confirm", "POST /car/car-1/confirm",
+		"DELETE /car/car-1", "DELETE /room/room-1",
+	}
+	if !slices.Equal(p.calls, wantCalls) {
+		t.Errorf("calls = %v, want %v", p.calls, wantCalls)
+	}
+	wantSteps := []string{
+		"start:completed", "form:completed", "reserve-room:completed", "reserve-car:completed",
+		"notify:completed", "confirm-room:completed", "confirm-car:failed",
+		"+cancel-car:completed", "+cancel-room:completed",
+	}
+	if got := stepsOf(exec); !slices.Equal(got, wantSteps) {
+		t.Errorf("steps = %v, want %v", got, wantSteps)
+	}
+}
+
+func TestSagaCompensatesOnlyCompletedReservations(t *testing.T) {
+	p := &participant{failing: []string{"/car"}}
+	exec, err := runSaga(t, p)
+	if err == nil {
+		t.Fatal("run succeeded, want the failure of reserve-car")
+	}
+
+	// The car reservation failed, so only the room is cancelled.
+	wantSteps := []string{
+		"start:completed", "form:completed", "reserve-room:completed", "reserve-car:failed",
+		"+cancel-room:completed",
+	}
+	if got := stepsOf(exec); !slices.Equal(got, wantSteps) {
+		t.Errorf("steps = %v, want %v", got, wantSteps)
+	}
+	if got := p.calls[len(p.calls)-1]; got != "DELETE /room/room-1" {
+		t.Errorf("last call = %s, want the room cancellation", got)
+	}
+}
+
+func TestSagaReportsFailedCompensation(t *testing.T) {
+	p := &participant{failing: []string{"/room/room-1/confirm", "/car/car-1"}}
+	exec, err := runSaga(t, p)
+
+	// The run fails with the original error, not the compensation's.
+	var nodeErr *engine.NodeExecutionError
+	if !errors.As(err, &nodeErr) || nodeErr.NodeID != "confirm-room" {
+		t.Fatalf("run error = %v, want the failure of confirm-room", err)
+	}
+
+	// Cancelling the car fails; the room is still cancelled after it.
+	wantSteps := []string{
+		"start:completed", "form:completed", "reserve-room:completed", "reserve-car:completed",
+		"notify:completed", "confirm-room:failed",
+		"+cancel-car:failed", "+cancel-room:completed",
+	}
+	if got := stepsOf(exec); !slices.Equal(got, wantSteps) {
+		t.Fatalf("steps = %v, want %v", got, wantSteps)
+	}
+	failed := exec.Steps[6]
+	if !strings.Contains(failed.Error, "status 500") {
+		t.Errorf("failed compensation error = %q, want the participant's status", failed.Error)
+	}
+	if got := p.calls[len(p.calls)-1]; got != "DELETE /room/room-1" {
+		t.Errorf("last call = %s, want the room cancellation", got)
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"fmt"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/sheets"
+)
+
+// SheetsAppend appends a row to a Google Sheet. Its "spreadsheetId" metadata
+// names the spreadsheet and "range" the sheet or table, e.g. "Alerts" or
+// "Alerts!A:D". "columns" lists the row's cells as templates rendered from
+// state, e.g. ["{{name}}", "{{city}}", "{{temperature}}"].
+type SheetsAppend struct {
+	client sheets.Client
+}
+
+func NewSheetsAppend(client sheets.Client) *SheetsAppend {
+	return &SheetsAppend{client: client}
+}
+
+// Compile parses the node's column templates.
+func (h *SheetsAppend) Compile(node *engine.Node) (any, error) {
+	return compileColumns(node), nil
+}
+
+func compileColumns(node *engine.Node) []*engine.Template {
+	columns := node.Strings("columns")
+	out := make([]*engine.Template, len(columns))
+	for i, c := range columns {
+		out[i] = engine.CompileTemplate(c)
+	}
+	return out
+}
+
+func (h *SheetsAppend) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	spreadsheetID, _ := node.String("spreadsheetId")
+	rng, _ := node.String("range")
+	if spreadsheetID == "" || rng == "" {
+		return nil, fmt.Errorf("%w: sheets_append needs a spreadsheetId and a range", engine.ErrInvalidInput)
+	}
+	columns, ok := node.Compiled().([]*engine.Template)
+	if !ok {
+		columns = compileColumns(node)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%w: sheets_append needs columns", engine.ErrInvalidInput)
+	}
+
+	row := make([]any, len(columns))
+	for i, c := range columns {
+		row[i] = c.Render(ec.State)
+	}
+	if err := ec.Spend(engine.ResourceExternalCalls, 1); err != nil {
+		return nil, err
+	}
+	appended, err := h.client.Append(ec.Ctx, spreadsheetID, rng, row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to append sheet row: %w", err)
+	}
+
+	return &engine.NodeResult{Output: map[string]any{
+		"spreadsheetId": spreadsheetID,
+		"row":           row,
+		"updatedRange":  appended.Range,
+	}}, nil
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/jsonpath"
+	"workflow-code-test/api/pkg/statestore"
+)
+
+// Scopes of counters and stored values.
+const (
+	// ScopeWorkflow shares state between the runs of one workflow.
+	ScopeWorkflow = "workflow"
+	// ScopeTenant shares state between every workflow of the deployment.
+	ScopeTenant = "tenant"
+)
+
+// Counter increments or reads a counter that persists across runs. Its
+// "name" metadata is a template such as "alerts-{{email}}". With the default
+// "operation": "increment" the counter grows by "by" (default 1); "read"
+// leaves it alone. A "ttl" (a Go duration) resets the counter that long after
+// its first increment, e.g. to count alerts per hour. The value is stored in
+// the first outputVariables entry, or "count".
+type Counter struct {
+	store statestore.Store
+}
+
+func NewCounter(store statestore.Store) *Counter {
+	return &Counter{store: store}
+}
+
+// Compile parses the node's name template.
+func (h *Counter) Compile(node *engine.Node) (any, error) {
+	if _, err := stateScope(node); err != nil {
+		return nil, err
+	}
+	tmpl, _ := node.String("name")
+	return engine.CompileTemplate(tmpl), nil
+}
+
+func (h *Counter) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	operation, _ := node.String("operation")
+	if operation != "" && operation != "increment" && operation != "read" {
+		return nil, fmt.Errorf("%w: operation must be increment or read", engine.ErrInvalidInput)
+	}
+	by := int64(1)
+	if raw, ok := node.Metadata["by"]; ok {
+		f, err := engine.ToFloat(raw)
+		if err != nil || f != float64(int64(f)) {
+			return nil, fmt.Errorf("%w: by must be an integer", engine.ErrInvalidInput)
+		}
+		by = int64(f)
+	}
+	var ttl time.Duration
+	if raw, ok := node.String("ttl"); ok {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: ttl must be a positive duration such as 1h", engine.ErrInvalidInput)
+		}
+		ttl = d
+	}
+
+	name, key, err := stateKey(ec, node, "name")
+	if err != nil {
+		return nil, err
+	}
+	var value int64
+	if operation == "read" {
+		value, err = h.store.Counter(ec.Ctx, key)
+	} else {
+		value, err = h.store.Increment(ec.Ctx, key, by, ttl)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("state store: %w", err)
+	}
+
+	ec.State[stateOutput(node, "count")] = value
+	return &engine.NodeResult{Output: map[string]any{"name": name, "value": value}}, nil
+}
+
+// KVStore gets or sets a value that persists across runs. Its "key" metadata
+// is a template such as "last-alert-{{city}}". With the default
+// "operation": "get" the stored value, or the node's "default" if there is
+// none, is put in the first outputVariables entry, or "value". "set" stores
+// the state value at the "variable" JSONPath, or the node's literal "value".
+type KVStore struct {
+	store statestore.Store
+}
+
+func NewKVStore(store statestore.Store) *KVStore {
+	return &KVStore{store: store}
+}
+
+// Compile parses the node's key template.
+func (h *KVStore) Compile(node *engine.Node) (any, error) {
+	if _, err := stateScope(node); err != nil {
+		return nil, err
+	}
+	if variable, _ := node.String("variable"); variable != "" {
+		if _, err := jsonpath.Parse(variable); err != nil {
+			return nil, fmt.Errorf("variable: %w", err)
+		}
+	}
+	tmpl, _ := node.String("key")
+	return engine.CompileTemplate(tmpl), nil
+}
+
+func (h *KVStore) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	operation, _ := node.String("operation")
+	if operation != "" && operation != "get" && operation != "set" {
+		return nil, fmt.Errorf("%w: operation must be get or set", engine.ErrInvalidInput)
+	}
+	name, key, err := stateKey(ec, node, "key")
+	if err != nil {
+		return nil, err
+	}
+
+	if operation == "set" {
+		value, ok := node.Metadata["value"]
+		if variable, _ := node.String("variable"); variable != "" {
+			path, err := jsonpath.Parse(variable)
+			if err == nil {
+				value, err = path.Get(ec.State)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s is not available: %w", variable, err)
+			}
+		} else if !ok {
+			return nil, fmt.Errorf("%w: set needs a variable or a value", engine.ErrInvalidInput)
+		}
+		if err := h.store.Set(ec.Ctx, key, value); err != nil {
+			return nil, fmt.Errorf("state store: %w", err)
+		}
+		return &engine.NodeResult{Output: map[string]any{"key": name, "value": value}}, nil
+	}
+
+	value, found, err := h.store.Get(ec.Ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("state store: %w", err)
+	}
+	if !found {
+		value = node.Metadata["default"]
+	}
+	ec.State[stateOutput(node, "value")] = value
+	return &engine.NodeResult{Output: map[string]any{"key": name, "value": value, "found": found}}, nil
+}
+
+// stateScope reads the "scope" metadata of a counter or kvstore node.
+func stateScope(node *engine.Node) (string, error) {
+	scope, _ := node.String("scope")
+	switch scope {
+	case "", ScopeWorkflow:
+		return ScopeWorkflow, nil
+	case ScopeTenant:
+		return ScopeTenant, nil
+	}
+	return "", fmt.Errorf("scope must be %s or %s", ScopeWorkflow, ScopeTenant)
+}
+
+// stateKey renders the name template in the node's metadata field and
+// returns it along with the store key it is scoped to.
+func stateKey(ec *engine.ExecutionContext, node *engine.Node, field string) (name, key string, err error) {
+	scope, err := stateScope(node)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+	}
+	tmpl, _ := node.String(field)
+	if tmpl == "" {
+		return "", "", fmt.Errorf("%w: %s %s is required", engine.ErrInvalidInput, node.Type, field)
+	}
+	compiled, _ := node.Compiled().(*engine.Template)
+	if compiled == nil {
+		compiled = engine.CompileTemplate(tmpl)
+	}
+	name = compiled.Render(ec.State)
+	if strings.Contains(name, "{{") {
+		return "", "", fmt.Errorf("%s %q references variables that are not set", field, name)
+	}
+
+	if scope == ScopeTenant {
+		return name, ScopeTenant + ":" + name, nil
+	}
+	workflowID := engine.Labels(ec.Ctx)[engine.LabelWorkflowID]
+	if workflowID == "" {
+		return "", "", fmt.Errorf("%w: workflow-scoped state needs a workflow id", engine.ErrInvalidInput)
+	}
+	return name, ScopeWorkflow + ":" + workflowID + ":" + name, nil
+}
+
+// stateOutput returns the state variable a node's result goes to.
+func stateOutput(node *engine.Node, fallback string) string {
+	if outputs := node.Strings("outputVariables"); len(outputs) > 0 {
+		return outputs[0]
+	}
+	return fallback
+}
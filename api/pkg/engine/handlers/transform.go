@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/jsonpath"
+)
+
+// Transform copies deep fields into flat state variables. Its "mappings"
+// metadata maps variable names to JSONPath expressions, evaluated against the
+// state variable named by "source" or, without one, the whole state:
+//
+//	{"source": "weather", "mappings": {"temperature": "$.current.temperature_2m"}}
+//
+// A path with wildcards or recursive descent yields the list of matches.
+func Transform(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	mappings := node.Map("mappings")
+	if len(mappings) == 0 {
+		return nil, fmt.Errorf("%w: transform needs mappings", engine.ErrInvalidInput)
+	}
+
+	var doc any = ec.State
+	if source, ok := node.String("source"); ok && source != "" {
+		v, ok := ec.State[source]
+		if !ok {
+			return nil, fmt.Errorf("variable %s is not set", source)
+		}
+		doc = v
+	}
+
+	paths, ok := node.Compiled().(transformPaths)
+	if !ok {
+		var err error
+		if paths, err = compileTransform(node); err != nil {
+			return nil, fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+		}
+	}
+
+	output := make(map[string]any, len(mappings))
+	for _, name := range slices.Sorted(maps.Keys(mappings)) {
+		v, err := paths[name].Get(doc)
+		if err != nil {
+			return nil, fmt.Errorf("mapping for %s: %w", name, err)
+		}
+		output[name] = v
+	}
+
+	for name, v := range output {
+		ec.State[name] = v
+	}
+	return &engine.NodeResult{Output: output}, nil
+}
+
+// transformPaths are the parsed paths of a transform node by variable name.
+type transformPaths map[string]*jsonpath.Path
+
+// CompileTransform parses the JSONPath of every mapping of the node.
+func CompileTransform(node *engine.Node) (any, error) {
+	return compileTransform(node)
+}
+
+func compileTransform(node *engine.Node) (transformPaths, error) {
+	mappings := node.Map("mappings")
+	paths := make(transformPaths, len(mappings))
+	for _, name := range slices.Sorted(maps.Keys(mappings)) {
+		expr, ok := mappings[name].(string)
+		if !ok {
+			return nil, fmt.Errorf("mapping for %s must be a JSONPath string", name)
+		}
+		path, err := jsonpath.Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("mapping for %s: %v", name, err)
+		}
+		paths[name] = path
+	}
+	return paths, nil
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/jsonschema"
+)
+
+// Validate checks state against the JSON Schema in the node's "schema"
+// metadata. The schema describes an object holding the variables listed in
+// inputVariables, or the whole state without them. By default an invalid
+// state fails the run. With "onInvalid": "branch" the node instead follows its
+// "valid" or "invalid" edge and stores the problems in the validationErrors
+// variable.
+func Validate(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	schema := node.Map("schema")
+	if schema == nil {
+		return nil, fmt.Errorf("%w: validate needs a schema", engine.ErrInvalidInput)
+	}
+	onInvalid, _ := node.String("onInvalid")
+	if onInvalid != "" && onInvalid != "fail" && onInvalid != "branch" {
+		return nil, fmt.Errorf("%w: onInvalid must be fail or branch", engine.ErrInvalidInput)
+	}
+
+	doc := ec.State
+	if vars := node.Strings("inputVariables"); len(vars) > 0 {
+		doc = make(map[string]any, len(vars))
+		for _, name := range vars {
+			if v, ok := ec.State[name]; ok {
+				doc[name] = v
+			}
+		}
+	}
+
+	errs, err := jsonschema.Validate(schema, doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+	}
+
+	// State only holds plain JSON values, so errors are stored as objects.
+	problems := make([]any, 0, len(errs))
+	for _, e := range errs {
+		problems = append(problems, map[string]any{"path": e.Path, "message": e.Message})
+	}
+	output := map[string]any{"valid": len(errs) == 0}
+	if len(errs) > 0 {
+		output["errors"] = problems
+	}
+
+	if onInvalid != "branch" {
+		if len(errs) > 0 {
+			msgs := make([]string, 0, len(errs))
+			for _, e := range errs {
+				msgs = append(msgs, e.String())
+			}
+			return nil, fmt.Errorf("validation failed: %s", strings.Join(msgs, "; "))
+		}
+		return &engine.NodeResult{Output: output}, nil
+	}
+
+	if len(errs) > 0 {
+		ec.State["validationErrors"] = problems
+		return &engine.NodeResult{Output: output, Branch: "invalid"}, nil
+	}
+	delete(ec.State, "validationErrors")
+	return &engine.NodeResult{Output: output, Branch: "valid"}, nil
+}
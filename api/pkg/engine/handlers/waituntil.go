@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"cmp"
+	"fmt"
+	"time"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/jsonpath"
+	"workflow-code-test/api/pkg/weather"
+)
+
+// AwaitTimer is the Await kind of runs paused until the time in the
+// "resumeAt" detail, formatted as RFC 3339. The details are handed back to
+// the node as ExecutionContext.Resume when the timer fires.
+const AwaitTimer = "timer"
+
+// Defaults of wait_until nodes without interval or maxWait metadata.
+const (
+	DefaultWaitInterval = 5 * time.Minute
+	DefaultMaxWait      = time.Hour
+)
+
+// WaitUntil polls the current temperature, like an integration node, until
+// it compares to the node's operator and threshold, then follows the
+// "success" branch. Between polls the run is paused on a timer for the
+// node's "interval"; once "maxWait" has passed since the first poll without
+// the condition being met it follows the "timeout" branch. Both are Go
+// durations such as "10m". A "variable" metadata JSONPath compares that
+// state value instead of the temperature.
+type WaitUntil struct {
+	integration *Integration
+}
+
+func NewWaitUntil(client weather.Client, cities weather.Catalog) *WaitUntil {
+	return &WaitUntil{integration: NewIntegration(client, cities)}
+}
+
+func (h *WaitUntil) Execute(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+	operator, _ := node.String("operator")
+	if !IsOperator(operator) {
+		return nil, fmt.Errorf("%w: unsupported operator %q", engine.ErrInvalidInput, operator)
+	}
+	threshold, err := engine.ToFloat(node.Metadata["threshold"])
+	if err != nil {
+		return nil, fmt.Errorf("%w: threshold: %v", engine.ErrInvalidInput, err)
+	}
+	interval, maxWait, err := waitDurations(node)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", engine.ErrInvalidInput, err)
+	}
+
+	now := ec.Clock.Now()
+	deadline, polls := now.Add(maxWait), 0
+	if ec.Resume != nil {
+		if t, err := time.Parse(time.RFC3339Nano, fmt.Sprint(ec.Resume["deadline"])); err == nil {
+			deadline = t
+		}
+		if n, err := engine.ToFloat(ec.Resume["polls"]); err == nil {
+			polls = int(n)
+		}
+	}
+
+	if _, err := h.integration.Execute(ec, node); err != nil {
+		return nil, err
+	}
+	polls++
+
+	var value any = ec.State["temperature"]
+	variable, _ := node.String("variable")
+	if variable != "" {
+		path, _ := node.Compiled().(*jsonpath.Path)
+		if path == nil {
+			if path, err = jsonpath.Parse(variable); err != nil {
+				return nil, fmt.Errorf("%s is not available: %w", variable, err)
+			}
+		}
+		if value, err = path.Get(ec.State); err != nil {
+			return nil, fmt.Errorf("%s is not available: %w", variable, err)
+		}
+	}
+	actual, err := engine.ToFloat(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not available: %w", cmp.Or(variable, "temperature"), err)
+	}
+	met := Compare(actual, operator, threshold)
+
+	output := map[string]any{
+		"conditionMet": met,
+		"threshold":    threshold,
+		"operator":     operator,
+		"actualValue":  actual,
+		"polls":        polls,
+		"deadline":     deadline.Format(time.RFC3339Nano),
+	}
+	switch {
+	case met:
+		ec.State["conditionMet"] = true
+		output["message"] = conditionMessage(variable, actual, operator, threshold, "condition met")
+		return &engine.NodeResult{Output: output, Branch: "success"}, nil
+	case !now.Before(deadline):
+		ec.State["conditionMet"] = false
+		output["message"] = fmt.Sprintf("%s after %d polls", conditionMessage(variable, actual, operator, threshold, "timed out"), polls)
+		return &engine.NodeResult{Output: output, Branch: "timeout"}, nil
+	}
+
+	// The last poll happens at the deadline, however the interval falls.
+	resumeAt := now.Add(interval)
+	if resumeAt.After(deadline) {
+		resumeAt = deadline
+	}
+	return &engine.NodeResult{Output: output, Await: &engine.Await{Kind: AwaitTimer, Details: map[string]any{
+		"resumeAt":  resumeAt.Format(time.RFC3339Nano),
+		"deadline":  deadline.Format(time.RFC3339Nano),
+		"polls":     polls,
+		"lastValue": actual,
+	}}}, nil
+}
+
+// Compile parses the node's variable path, if it has one.
+func (h *WaitUntil) Compile(node *engine.Node) (any, error) {
+	if _, _, err := waitDurations(node); err != nil {
+		return nil, err
+	}
+	return CompileCondition(node)
+}
+
+// waitDurations reads the interval and maxWait metadata of a wait_until node.
+func waitDurations(node *engine.Node) (interval, maxWait time.Duration, err error) {
+	interval, maxWait = DefaultWaitInterval, DefaultMaxWait
+	if s, ok := node.String("interval"); ok && s != "" {
+		if interval, err = time.ParseDuration(s); err != nil || interval <= 0 {
+			return 0, 0, fmt.Errorf("interval %q is not a positive duration", s)
+		}
+	}
+	if s, ok := node.String("maxWait"); ok && s != "" {
+		if maxWait, err = time.ParseDuration(s); err != nil || maxWait <= 0 {
+			return 0, 0, fmt.Errorf("maxWait %q is not a positive duration", s)
+		}
+	}
+	return interval, maxWait, nil
+}
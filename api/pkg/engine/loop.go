@@ -0,0 +1,431 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// MaxLoopIterations caps the maxIterations of a loop node.
+	MaxLoopIterations = 1000
+	// MaxRunIterations caps the visits of all loop nodes of a run together,
+	// so nested loops, and workflows that keep entering a loop anew after
+	// it's done, still end.
+	MaxRunIterations = 10 * MaxLoopIterations
+	// DefaultLoopParallelism is how many iterations of a parallel loop run
+	// at once when it doesn't set maxParallelism.
+	DefaultLoopParallelism = 4
+)
+
+// Loop branches.
+const (
+	LoopBody = "body"
+	LoopDone = "done"
+)
+
+// LoopVariable is the state variable holding the current iteration of the
+// innermost loop, so templates and conditions of the loop body can read it,
+// e.g. {{loop.index}} or "$.loop.index".
+const LoopVariable = "loop"
+
+// LoopOptions say how a loop node iterates. They are read from the node's
+// metadata:
+//
+//	"items": "cities", "mode": "parallel", "maxParallelism": 2, "collect": "temperature"
+//
+// Without items the loop runs maxIterations times; with items, the name of
+// a list variable, it runs once per item, at most maxIterations times, and
+// the loop variable holds the item too. Iterations run one after another
+// unless mode is "parallel", which runs up to maxParallelism of them at once
+// on copies of the state, like parallel branches. Collect names a variable
+// the body sets; its value after each iteration is collected, in iteration
+// order, into the loop's first outputVariables entry, or "results".
+type LoopOptions struct {
+	MaxIterations  int
+	Items          string
+	Parallel       bool
+	MaxParallelism int
+	Collect        string
+	Results        string
+}
+
+// LoopOptions returns the options of a loop node.
+func (n *Node) LoopOptions() (*LoopOptions, error) {
+	o := &LoopOptions{MaxIterations: MaxLoopIterations, MaxParallelism: DefaultLoopParallelism, Results: "results"}
+	if v, ok := n.Metadata["items"]; ok {
+		if o.Items, ok = v.(string); !ok || o.Items == "" {
+			return nil, errors.New("items must be the name of a variable")
+		}
+	}
+	if v, ok := n.Metadata["maxIterations"]; ok {
+		f, err := ToFloat(v)
+		if err != nil || f != math.Trunc(f) || f < 1 || f > MaxLoopIterations {
+			return nil, fmt.Errorf("maxIterations must be an integer from 1 to %d", MaxLoopIterations)
+		}
+		o.MaxIterations = int(f)
+	} else if o.Items == "" {
+		return nil, errors.New("loop needs maxIterations or items")
+	}
+	switch mode := n.Metadata["mode"]; mode {
+	case nil, "sequential":
+	case "parallel":
+		o.Parallel = true
+	default:
+		return nil, fmt.Errorf("mode must be sequential or parallel, not %v", mode)
+	}
+	if v, ok := n.Metadata["maxParallelism"]; ok {
+		f, err := ToFloat(v)
+		if err != nil || f != math.Trunc(f) || f < 1 || f > MaxLoopIterations {
+			return nil, fmt.Errorf("maxParallelism must be an integer from 1 to %d", MaxLoopIterations)
+		}
+		if !o.Parallel {
+			return nil, errors.New("maxParallelism needs mode parallel")
+		}
+		o.MaxParallelism = int(f)
+	}
+	if v, ok := n.Metadata["collect"]; ok {
+		if o.Collect, ok = v.(string); !ok || o.Collect == "" {
+			return nil, errors.New("collect must be the name of a variable")
+		}
+	}
+	if out := n.Strings("outputVariables"); len(out) > 0 {
+		o.Results = out[0]
+	}
+	return o, nil
+}
+
+// loopOptions returns the options of a loop node as compiled, or nil if
+// they are invalid, which its handler reports.
+func (n *Node) loopOptions() *LoopOptions {
+	if o, ok := n.compiled.(*LoopOptions); ok {
+		return o
+	}
+	o, _ := n.LoopOptions()
+	return o
+}
+
+// Loop is an iteration of a loop node.
+type Loop struct {
+	NodeID string `json:"nodeId"`
+	// Index counts the iterations from zero.
+	Index int `json:"index"`
+	// Item is the item of the iteration of a loop over items.
+	Item any `json:"item,omitempty"`
+	// Items are the items of a loop over items, read when it started.
+	Items []any `json:"items,omitempty"`
+	// Results are the values collected from the iterations so far.
+	Results []any `json:"results,omitempty"`
+}
+
+// Iteration identifies an iteration of a loop node in the trace.
+type Iteration struct {
+	NodeID string `json:"nodeId"`
+	Index  int    `json:"index"`
+}
+
+// Loop returns the current iteration of the innermost loop the run is in.
+func (ec *ExecutionContext) Loop() (Loop, bool) {
+	if len(ec.loops) == 0 {
+		return Loop{}, false
+	}
+	return ec.loops[len(ec.loops)-1], true
+}
+
+// Iterate counts a visit of the loop node id and returns the iteration it
+// starts: the first one if the run isn't in that loop, the next one if it
+// is. Loops nested in it that the run left without finishing end. It fails
+// with ErrLoopLimit once the run visited loop nodes MaxRunIterations times.
+func (ec *ExecutionContext) Iterate(nodeID string) (Loop, error) {
+	if err := ec.countVisits(1); err != nil {
+		return Loop{}, err
+	}
+	l := Loop{NodeID: nodeID}
+	if i := ec.loopIndex(nodeID); i >= 0 {
+		l = ec.loops[i]
+		l.Index++
+		ec.loops = ec.loops[:i]
+	}
+	ec.loops = append(ec.loops, l)
+	ec.setLoopVariable()
+	return l, nil
+}
+
+// NextIteration is Iterate for a loop node with opts: it reads the items
+// when the loop starts, collects the value of opts.Collect the previous
+// iteration left and sets the item of the iteration it starts. Once the
+// loop ran all its iterations it ends the loop, stores the collected values
+// in opts.Results and reports done, with the Index of the returned Loop
+// being the number of iterations.
+func (ec *ExecutionContext) NextIteration(node *Node, opts *LoopOptions) (Loop, bool, error) {
+	l, err := ec.Iterate(node.ID)
+	if err != nil {
+		return Loop{}, false, err
+	}
+	if l.Index == 0 && opts.Items != "" {
+		if l.Items, err = loopItems(ec.State, opts); err != nil {
+			ec.EndLoop(node.ID)
+			return Loop{}, false, err
+		}
+	}
+	if l.Index > 0 && opts.Collect != "" {
+		l.Results = append(slices.Clip(l.Results), ec.State[opts.Collect])
+	}
+	n := opts.MaxIterations
+	if opts.Items != "" {
+		n = min(n, len(l.Items))
+	}
+	if l.Index >= n {
+		ec.EndLoop(node.ID)
+		if opts.Collect != "" {
+			ec.State[opts.Results] = append([]any{}, l.Results...)
+		}
+		return l, true, nil
+	}
+	if opts.Items != "" {
+		l.Item = l.Items[l.Index]
+	}
+	ec.loops[len(ec.loops)-1] = l
+	ec.setLoopVariable()
+	return l, false, nil
+}
+
+// loopItems returns the items a loop with opts iterates over.
+func loopItems(state map[string]any, opts *LoopOptions) ([]any, error) {
+	v := reflect.ValueOf(state[opts.Items])
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%w: items variable %s is not a list", ErrInvalidInput, opts.Items)
+	}
+	items := make([]any, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// EndLoop leaves the loop node id and the loops nested in it, so the loop
+// around it, if any, is the current one again.
+func (ec *ExecutionContext) EndLoop(nodeID string) {
+	if i := ec.loopIndex(nodeID); i >= 0 {
+		ec.loops = ec.loops[:i]
+		ec.setLoopVariable()
+	}
+}
+
+func (ec *ExecutionContext) loopIndex(nodeID string) int {
+	return slices.IndexFunc(ec.loops, func(l Loop) bool { return l.NodeID == nodeID })
+}
+
+// iteration returns the iteration of the innermost loop around node, for
+// its step. A loop node's own steps belong to the loop around it.
+func (ec *ExecutionContext) iteration(node *Node) *Iteration {
+	loops := ec.loops
+	if i := ec.loopIndex(node.ID); i >= 0 {
+		loops = loops[:i]
+	}
+	if len(loops) == 0 {
+		return nil
+	}
+	l := loops[len(loops)-1]
+	return &Iteration{NodeID: l.NodeID, Index: l.Index}
+}
+
+// setLoopVariable mirrors the current iteration into the state.
+func (ec *ExecutionContext) setLoopVariable() {
+	l, ok := ec.Loop()
+	if !ok {
+		delete(ec.State, LoopVariable)
+		return
+	}
+	v := map[string]any{"nodeId": l.NodeID, "index": l.Index}
+	if l.Items != nil {
+		v["item"] = l.Item
+	}
+	ec.State[LoopVariable] = v
+}
+
+// countVisits counts n visits of loop nodes, failing with ErrLoopLimit once
+// the run made more than MaxRunIterations.
+func (ec *ExecutionContext) countVisits(n int) error {
+	if ec.iterations == nil {
+		ec.iterations = new(atomic.Int64)
+	}
+	if ec.iterations.Add(int64(n)) > MaxRunIterations {
+		return fmt.Errorf("%w: the run visited loop nodes %d times", ErrLoopLimit, MaxRunIterations)
+	}
+	return nil
+}
+
+// runIterations returns the visits of loop nodes the run counted so far.
+func (ec *ExecutionContext) runIterations() int {
+	if ec.iterations == nil {
+		return 0
+	}
+	return int(ec.iterations.Load())
+}
+
+// iterate runs a parallel loop node: its iterations run concurrently, up to
+// opts.MaxParallelism at a time, each on its own copy of the state from the
+// loop's body branch until it leads back to the loop node or ends. It
+// returns the loop's step and result, done once all iterations are, and the
+// steps of the iterations to record after it. Like those of parallel
+// branches they follow iteration by iteration, whichever finished first,
+// and the state changes, compensations and collected values of the
+// iterations are applied in that order too. When an iteration fails the
+// others are cancelled and the loop fails with its error.
+func (exec *Execution) iterate(r *run, ec *ExecutionContext, node *Node, opts *LoopOptions) (ExecutionStep, *NodeResult, []ExecutionStep, error) {
+	step := ExecutionStep{
+		NodeID:      node.ID,
+		NodeType:    node.Type,
+		Label:       node.Label,
+		Description: node.Description,
+		StartedAt:   ec.Clock.Now(),
+		Iteration:   ec.iteration(node),
+	}
+	fail := func(err error, steps []ExecutionStep) (ExecutionStep, *NodeResult, []ExecutionStep, error) {
+		var nodeErr *NodeExecutionError
+		if !errors.As(err, &nodeErr) {
+			err = &NodeExecutionError{NodeID: node.ID, NodeType: node.Type, Err: err}
+		}
+		step.Status = StepStatusFailed
+		step.Error = err.Error()
+		step.FinishedAt = ec.Clock.Now()
+		return step, nil, steps, err
+	}
+	if ec.Ctx.Err() != nil {
+		return fail(context.Cause(ec.Ctx), nil)
+	}
+	ec.publish(NodeStarted, len(ec.Steps), step)
+
+	n := opts.MaxIterations
+	var items []any
+	if opts.Items != "" {
+		var err error
+		if items, err = loopItems(ec.State, opts); err != nil {
+			return fail(err, nil)
+		}
+		n = min(n, len(items))
+	}
+	// The loop node counts as visited once per iteration and once more for
+	// being done, as in a sequential loop.
+	if err := ec.countVisits(n + 1); err != nil {
+		return fail(err, nil)
+	}
+	var body *Node
+	for _, e := range r.g.Outgoing(node.ID) {
+		if e.SourceHandle == LoopBody {
+			body, _ = r.g.Node(e.Target)
+			break
+		}
+	}
+	if body == nil && n > 0 {
+		return fail(fmt.Errorf("%w: %q", ErrNoMatchingBranch, LoopBody), nil)
+	}
+
+	ctx, cancel := context.WithCancelCause(ec.Ctx)
+	defer cancel(nil)
+
+	type iteration struct {
+		id   string
+		ec   *ExecutionContext
+		exec *Execution
+		err  error
+	}
+	iterations := make([]*iteration, n)
+	var (
+		wg     sync.WaitGroup
+		next   atomic.Int64
+		once   sync.Once
+		failed *iteration
+	)
+	for range min(n, opts.MaxParallelism) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				i := int(next.Add(1) - 1)
+				if i >= n {
+					return
+				}
+				id := fmt.Sprintf("%s[%d]", node.ID, i)
+				if ec.branch != "" {
+					id = ec.branch + "/" + id
+				}
+				it := &iteration{id: id, ec: ec.fork(ctx, id)}
+				l := Loop{NodeID: node.ID, Index: i, Items: items}
+				if items != nil {
+					l.Item = items[i]
+				}
+				if j := it.ec.loopIndex(node.ID); j >= 0 {
+					it.ec.loops = it.ec.loops[:j]
+				}
+				it.ec.loops = append(it.ec.loops, l)
+				it.ec.loopEnd = node.ID
+				it.ec.setLoopVariable()
+				it.exec = &Execution{Steps: slices.Clone(exec.Steps), State: it.ec.State}
+				iterations[i] = it
+
+				end, err := it.exec.walk(r, it.ec, body)
+				if err == nil && end != nil && end.ID != node.ID {
+					err = &NodeExecutionError{NodeID: end.ID, NodeType: end.Type,
+						Err: fmt.Errorf("%w: iteration %d of loop %s reached a merge node its branches didn't fan out to", ErrInvalidNode, i, node.ID)}
+				}
+				if err != nil {
+					it.err = err
+					once.Do(func() {
+						failed = it
+						cancel(fmt.Errorf("%w: iteration %d of loop %s failed", context.Canceled, i, node.ID))
+					})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	before := len(exec.Steps)
+	forked := maps.Clone(ec.State)
+	var steps []ExecutionStep
+	results := []any{}
+	for _, it := range iterations {
+		if it == nil {
+			continue
+		}
+		for _, s := range it.exec.Steps[before:] {
+			if s.ParallelBranch == "" {
+				s.ParallelBranch = it.id
+			}
+			steps = append(steps, s)
+		}
+		maps.Copy(ec.State, stateChanges(forked, it.exec.State))
+		for id, entry := range it.ec.memo {
+			if _, ok := ec.memo[id]; !ok {
+				ec.memo[id] = entry
+			}
+		}
+		exec.compensations = append(exec.compensations, it.exec.compensations...)
+		if opts.Collect != "" {
+			results = append(results, it.exec.State[opts.Collect])
+		}
+	}
+	ec.setLoopVariable()
+	if failed != nil {
+		return fail(failed.err, steps)
+	}
+
+	output := map[string]any{"iterations": n, "done": true}
+	if opts.Collect != "" {
+		ec.State[opts.Results] = results
+		output["results"] = results
+	}
+	step.Status = StepStatusCompleted
+	step.Description = node.renderDescription(ec.State)
+	step.Output = output
+	step.FinishedAt = ec.Clock.Now()
+	return step, &NodeResult{Output: output, Branch: LoopDone}, steps, nil
+}
@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// String returns the string value of a metadata key.
+func (n *Node) String(key string) (string, bool) {
+	v, ok := n.Metadata[key].(string)
+	return v, ok
+}
+
+// Strings returns a metadata key holding a list of strings.
+func (n *Node) Strings(key string) []string {
+	raw, ok := n.Metadata[key].([]any)
+	if !ok {
+		if s, ok := n.Metadata[key].([]string); ok {
+			return s
+		}
+		return nil
+	}
+	out := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Map returns a metadata key holding a JSON object.
+func (n *Node) Map(key string) map[string]any {
+	m, _ := n.Metadata[key].(map[string]any)
+	return m
+}
+
+// Memoizable reports whether the node's metadata sets "memoize": true. The
+// executor then runs the node at most once per execution and reuses the first
+// result when the node is visited again, e.g. inside a loop.
+func (n *Node) Memoizable() bool {
+	v, _ := n.Metadata["memoize"].(bool)
+	return v
+}
+
+// Disabled reports whether the node's metadata sets "disabled": true. The
+// executor then skips the node without running its handler.
+func (n *Node) Disabled() bool {
+	v, _ := n.Metadata["disabled"].(bool)
+	return v
+}
+
+// Compensation returns the id of the node named by the node's
+// "compensateWith" metadata, which undoes the node's effect, e.g. cancels the
+// booking it made. If the run fails after the node completed, the executor
+// runs the compensation.
+func (n *Node) Compensation() string {
+	v, _ := n.Metadata["compensateWith"].(string)
+	return v
+}
+
+// MaxNodeTimeout caps the "timeoutMs" of a node.
+const MaxNodeTimeout = time.Hour
+
+// Timeout returns the time the node's handler may take, from its
+// "timeoutMs" metadata, or zero for no limit besides the run's own. A
+// handler still running after it fails the node with ErrNodeTimeout; with a
+// retry policy every attempt gets the full timeout.
+func (n *Node) Timeout() (time.Duration, error) {
+	v, ok := n.Metadata["timeoutMs"]
+	if !ok {
+		return 0, nil
+	}
+	f, err := ToFloat(v)
+	if err != nil || f != math.Trunc(f) || f < 1 || f > float64(MaxNodeTimeout/time.Millisecond) {
+		return 0, fmt.Errorf("timeoutMs must be an integer from 1 to %d", MaxNodeTimeout/time.Millisecond)
+	}
+	return time.Duration(f) * time.Millisecond, nil
+}
+
+// ToFloat converts numeric values decoded from JSON or entered as strings.
+func ToFloat(v any) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", n)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("%v is not a number", v)
+	}
+}
+
+var templateVar = regexp.MustCompile(`{{\s*([\w.]+)\s*}}`)
+
+// RenderTemplate replaces {{name}} placeholders with values from vars. Names
+// with dots reach into objects, e.g. {{loop.index}}, unless vars holds the
+// whole name. Unknown placeholders are left untouched.
+func RenderTemplate(tmpl string, vars map[string]any) string {
+	return CompileTemplate(tmpl).Render(vars)
+}
+
+// Template is a text with {{name}} placeholders, split up once so it can be
+// rendered any number of times, concurrently, without matching it again.
+type Template struct {
+	// text holds the literal text around the placeholders: text[i] comes
+	// before placeholder i and the last element after the last one.
+	text         []string
+	names        []string
+	placeholders []string
+}
+
+// CompileTemplate splits tmpl for RenderTemplate.
+func CompileTemplate(tmpl string) *Template {
+	t := &Template{}
+	last := 0
+	for _, m := range templateVar.FindAllStringSubmatchIndex(tmpl, -1) {
+		t.text = append(t.text, tmpl[last:m[0]])
+		t.names = append(t.names, tmpl[m[2]:m[3]])
+		t.placeholders = append(t.placeholders, tmpl[m[0]:m[1]])
+		last = m[1]
+	}
+	t.text = append(t.text, tmpl[last:])
+	return t
+}
+
+// Render replaces the placeholders with values from vars, like
+// RenderTemplate.
+func (t *Template) Render(vars map[string]any) string {
+	if len(t.names) == 0 {
+		return t.text[0]
+	}
+	var b strings.Builder
+	for i, name := range t.names {
+		b.WriteString(t.text[i])
+		if v, ok := lookupVar(vars, name); ok {
+			fmt.Fprint(&b, v)
+		} else {
+			b.WriteString(t.placeholders[i])
+		}
+	}
+	b.WriteString(t.text[len(t.names)])
+	return b.String()
+}
+
+func lookupVar(vars map[string]any, name string) (any, bool) {
+	if v, ok := vars[name]; ok {
+		return v, true
+	}
+	head, rest, ok := strings.Cut(name, ".")
+	if !ok {
+		return nil, false
+	}
+	obj, ok := vars[head].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	return lookupVar(obj, rest)
+}
+
+// TemplateVariables returns the state variables the {{name}} placeholders in
+// tmpl read, the part of dotted names before the first dot.
+func TemplateVariables(tmpl string) []string {
+	var names []string
+	for _, m := range templateVar.FindAllStringSubmatch(tmpl, -1) {
+		head, _, _ := strings.Cut(m[1], ".")
+		names = append(names, head)
+	}
+	return names
+}
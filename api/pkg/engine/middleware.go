@@ -0,0 +1,34 @@
+package engine
+
+import "slices"
+
+// Middleware wraps the handlers of the nodes an executor runs, e.g. to log
+// them or inject faults. It is given the node type the handler serves.
+type Middleware func(nodeType string, next NodeHandler) NodeHandler
+
+// Use makes the executor run every node through mw, the first one given
+// outermost. It must be called before any run starts. Compiling graphs is not
+// affected.
+func (e *Executor) Use(mw ...Middleware) *Executor {
+	e.middleware = append(e.middleware, mw...)
+	return e
+}
+
+// wrap returns a registry serving every node type with its handler wrapped
+// in middleware.
+func (r *Registry) wrap(middleware []Middleware) *Registry {
+	if len(middleware) == 0 {
+		return r
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wrapped := &Registry{handlers: make(map[string]NodeHandler, len(r.handlers)), variants: r.variants, versions: r.versions}
+	for nodeType, h := range r.handlers {
+		for _, mw := range slices.Backward(middleware) {
+			h = mw(nodeType, h)
+		}
+		wrapped.handlers[nodeType] = h
+	}
+	return wrapped
+}
@@ -0,0 +1,60 @@
+package engine
+
+import "maps"
+
+// OutputDescriber is implemented by handlers that declare the shape of the
+// Output of their results as a JSON Schema object, so clients and workflow
+// checks don't have to guess it from sample runs.
+type OutputDescriber interface {
+	OutputSchema() map[string]any
+}
+
+// WithOutputSchema declares the output schema of a handler, e.g. a
+// HandlerFunc.
+func WithOutputSchema(h NodeHandler, schema map[string]any) NodeHandler {
+	return describedHandler{NodeHandler: h, schema: schema}
+}
+
+type describedHandler struct {
+	NodeHandler
+	schema map[string]any
+}
+
+func (h describedHandler) OutputSchema() map[string]any {
+	return h.schema
+}
+
+// Version forwards to the wrapped handler.
+func (h describedHandler) Version() string {
+	return HandlerVersion(h.NodeHandler)
+}
+
+// Compile forwards to the wrapped handler, if it compiles nodes.
+func (h describedHandler) Compile(node *Node) (any, error) {
+	if c, ok := h.NodeHandler.(Compiler); ok {
+		return c.Compile(node)
+	}
+	return nil, nil
+}
+
+// HandlerOutputSchema returns the output schema a handler declares, or nil.
+func HandlerOutputSchema(h NodeHandler) map[string]any {
+	if d, ok := h.(OutputDescriber); ok {
+		return d.OutputSchema()
+	}
+	return nil
+}
+
+// OutputSchemas returns the output schema of each node type whose handler
+// declares one. Variants are expected to output the same shape.
+func (r *Registry) OutputSchemas() map[string]map[string]any {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]map[string]any)
+	for nodeType, h := range r.handlers {
+		if schema := HandlerOutputSchema(h); schema != nil {
+			out[nodeType] = maps.Clone(schema)
+		}
+	}
+	return out
+}
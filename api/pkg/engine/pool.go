@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// PoolOptions size the worker pool async runs execute on.
+type PoolOptions struct {
+	// MinWorkers are kept running while there is nothing to do.
+	MinWorkers int
+	// MaxWorkers bounds the runs executing at once; runs submitted while
+	// every worker is busy wait in a queue. Zero means no bound.
+	MaxWorkers int
+	// IdleTimeout is how long workers beyond MinWorkers wait for a run before
+	// they exit.
+	IdleTimeout time.Duration
+}
+
+// DefaultPoolOptions run up to 32 async runs at once and scale down to no
+// workers after a minute without runs.
+var DefaultPoolOptions = PoolOptions{MaxWorkers: 32, IdleTimeout: time.Minute}
+
+// throughputWindow is the period worker throughput is measured over.
+const throughputWindow = time.Minute
+
+// QueueStats describe the queue and workers of a Pool.
+type QueueStats struct {
+	MinWorkers int
+	MaxWorkers int
+	// Workers are the workers running, BusyWorkers those executing a run.
+	Workers     int
+	BusyWorkers int
+	// Pending is the number of runs waiting for a worker and
+	// OldestPendingAge how long the first of them has been waiting.
+	Pending          int
+	OldestPendingAge time.Duration
+	// Completed counts the runs finished since the pool was created.
+	Completed uint64
+	// WorkerStats lists the running workers by id.
+	WorkerStats []WorkerStats
+}
+
+// WorkerStats describe one worker of a Pool.
+type WorkerStats struct {
+	ID   int
+	Busy bool
+	// Completed counts the runs the worker finished, RecentCompleted those
+	// finished within the last minute.
+	Completed       uint64
+	RecentCompleted int
+	StartedAt       time.Time
+}
+
+// Queued is implemented by engines that execute async runs on a worker pool.
+type Queued interface {
+	QueueStats() QueueStats
+}
+
+// Pool executes submitted runs on a number of workers that grows with the
+// queue up to MaxWorkers and shrinks back to MinWorkers when idle. Runs start
+// in the order they were submitted.
+type Pool struct {
+	opts PoolOptions
+
+	mu        sync.Mutex
+	queue     []pendingRun
+	idle      []*worker
+	workers   map[int]*worker
+	nextID    int
+	completed uint64
+}
+
+type pendingRun struct {
+	run         func()
+	submittedAt time.Time
+}
+
+type worker struct {
+	id        int
+	runs      chan func()
+	busy      bool
+	completed uint64
+	recent    []time.Time
+	startedAt time.Time
+	idleSince time.Time
+}
+
+func NewPool(opts PoolOptions) *Pool {
+	p := &Pool{opts: opts, workers: make(map[int]*worker)}
+	p.mu.Lock()
+	for range opts.MinWorkers {
+		p.idle = append(p.idle, p.spawn(nil))
+	}
+	p.mu.Unlock()
+	return p
+}
+
+// Options returns the sizing of the pool.
+func (p *Pool) Options() PoolOptions {
+	return p.opts
+}
+
+// Submit executes run on an idle worker, a new one if the pool may grow, or
+// queues it until a worker is free.
+func (p *Pool) Submit(run func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n := len(p.idle); n > 0 {
+		w := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		w.busy = true
+		w.runs <- run
+		return
+	}
+	if p.opts.MaxWorkers == 0 || len(p.workers) < p.opts.MaxWorkers {
+		p.spawn(run)
+		return
+	}
+	p.queue = append(p.queue, pendingRun{run: run, submittedAt: time.Now()})
+}
+
+// spawn starts a worker, executing run first if it is not nil. p.mu must be
+// held.
+func (p *Pool) spawn(run func()) *worker {
+	p.nextID++
+	w := &worker{id: p.nextID, runs: make(chan func(), 1), busy: run != nil, startedAt: time.Now().UTC()}
+	p.workers[w.id] = w
+	if run != nil {
+		w.runs <- run
+	}
+	go p.work(w)
+	return w
+}
+
+// work executes the runs handed to w until the pool retires it.
+func (p *Pool) work(w *worker) {
+	for run := range w.runs {
+		run()
+		if next, ok := p.finished(w); ok {
+			w.runs <- next
+		}
+	}
+}
+
+// finished records a run w completed and returns the next queued run for it,
+// or parks w among the idle workers.
+func (p *Pool) finished(w *worker) (func(), bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	p.completed++
+	w.completed++
+	w.recent = append(pruneBefore(w.recent, now.Add(-throughputWindow)), now)
+
+	if len(p.queue) > 0 {
+		next := p.queue[0].run
+		p.queue = slices.Delete(p.queue, 0, 1)
+		return next, true
+	}
+	w.busy = false
+	w.idleSince = now
+	p.idle = append(p.idle, w)
+	if p.opts.IdleTimeout > 0 {
+		time.AfterFunc(p.opts.IdleTimeout, func() { p.retire(w) })
+	}
+	return nil, false
+}
+
+// retire stops w if it has been idle for IdleTimeout and the pool has more
+// than MinWorkers.
+func (p *Pool) retire(w *worker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := slices.Index(p.idle, w)
+	if i < 0 || time.Since(w.idleSince) < p.opts.IdleTimeout || len(p.workers) <= p.opts.MinWorkers {
+		return
+	}
+	p.idle = slices.Delete(p.idle, i, i+1)
+	delete(p.workers, w.id)
+	close(w.runs)
+}
+
+// Stats returns the current state of the queue and workers.
+func (p *Pool) Stats() QueueStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	stats := QueueStats{
+		MinWorkers:  p.opts.MinWorkers,
+		MaxWorkers:  p.opts.MaxWorkers,
+		Workers:     len(p.workers),
+		BusyWorkers: len(p.workers) - len(p.idle),
+		Pending:     len(p.queue),
+		Completed:   p.completed,
+	}
+	if len(p.queue) > 0 {
+		stats.OldestPendingAge = now.Sub(p.queue[0].submittedAt)
+	}
+	for _, w := range p.workers {
+		w.recent = pruneBefore(w.recent, now.Add(-throughputWindow))
+		stats.WorkerStats = append(stats.WorkerStats, WorkerStats{
+			ID:              w.id,
+			Busy:            w.busy,
+			Completed:       w.completed,
+			RecentCompleted: len(w.recent),
+			StartedAt:       w.startedAt,
+		})
+	}
+	slices.SortFunc(stats.WorkerStats, func(a, b WorkerStats) int { return a.ID - b.ID })
+	return stats
+}
+
+// pruneBefore drops the times before t from the sorted times.
+func pruneBefore(times []time.Time, t time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(t) {
+		i++
+	}
+	return times[i:]
+}
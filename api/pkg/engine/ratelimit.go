@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// MaxRatePerMinute caps RateLimit.MaxPerMinute.
+const MaxRatePerMinute = 60000
+
+// RateLimit caps how often the handler of a node is called, across all runs
+// of the executor. It is read from the node's "rateLimit" metadata:
+//
+//	"rateLimit": {"maxPerMinute": 10, "key": "{{city}}"}
+//
+// The key template is rendered with the run's state, so e.g. a weather node
+// is limited per city; nodes of the same type with the same key share a
+// limit, and without a key all nodes of the type do. A node over its limit
+// waits until the oldest call of the last minute under its key ages out.
+// Ages are read from the run's Clock, so under a ManualClock a node over its
+// limit waits until the clock is moved on or its context ends.
+type RateLimit struct {
+	MaxPerMinute int
+	Key          string
+}
+
+// RateLimit returns the node's rate limit, or nil if it has none.
+func (n *Node) RateLimit() (*RateLimit, error) {
+	raw, ok := n.Metadata["rateLimit"]
+	if !ok {
+		return nil, nil
+	}
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, errors.New("rateLimit must be an object")
+	}
+	f, err := ToFloat(m["maxPerMinute"])
+	if err != nil || f != math.Trunc(f) || f < 1 || f > MaxRatePerMinute {
+		return nil, fmt.Errorf("rateLimit.maxPerMinute must be an integer from 1 to %d", MaxRatePerMinute)
+	}
+	l := &RateLimit{MaxPerMinute: int(f)}
+	if key, ok := m["key"]; ok {
+		if l.Key, ok = key.(string); !ok {
+			return nil, errors.New("rateLimit.key must be a string")
+		}
+	}
+	return l, nil
+}
+
+// rateLimiter enforces the rate limits of nodes. It keeps the times of the
+// calls of the last minute per key.
+type rateLimiter struct {
+	mu    sync.Mutex
+	calls map[string][]time.Time
+	swept time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{calls: make(map[string][]time.Time)}
+}
+
+// wait blocks until another call under key fits into limit per minute and
+// records it. Calls are timed with clock, the run's clock. It returns how
+// long it waited, along with the cause of the context ending if it did
+// first.
+func (l *rateLimiter) wait(ctx context.Context, clock Clock, key string, limit int) (time.Duration, error) {
+	var start time.Time
+	for {
+		l.mu.Lock()
+		now := clock.Now()
+		if start.IsZero() {
+			start = now
+		}
+		l.sweep(now)
+		calls := recent(l.calls[key], now)
+		if len(calls) < limit {
+			l.calls[key] = append(calls, now)
+			l.mu.Unlock()
+			return now.Sub(start), nil
+		}
+		l.calls[key] = calls
+		delay := calls[len(calls)-limit].Add(time.Minute).Sub(now)
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return clock.Now().Sub(start), context.Cause(ctx)
+		case <-timer.C:
+		}
+	}
+}
+
+// sweep drops the keys without calls in the last minute, at most once a
+// minute, so keys rendered from e.g. cities don't pile up.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for key, calls := range l.calls {
+		if len(recent(calls, now)) == 0 {
+			delete(l.calls, key)
+		}
+	}
+}
+
+// recent returns the calls of the minute before now.
+func recent(calls []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(calls) && now.Sub(calls[i]) >= time.Minute {
+		i++
+	}
+	return calls[i:]
+}
+
+// rateLimitKey returns the key the calls of node are limited under.
+func rateLimitKey(node *Node, l *RateLimit, state map[string]any) string {
+	if l.Key == "" {
+		return node.Type
+	}
+	return node.Type + "/" + RenderTemplate(l.Key, state)
+}
@@ -0,0 +1,64 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+func TestRateLimitUsesRunClock(t *testing.T) {
+	var calls atomic.Int64
+	executor := engine.NewExecutor(blockingRegistry(nil, nil, false, &calls))
+	g := line(t, engine.Node{ID: "limited", Type: nodeTypeCount, Metadata: map[string]any{
+		"rateLimit": map[string]any{"maxPerMinute": 1},
+	}})
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	clock := engine.NewManualClock(start, time.Millisecond)
+	ctx := engine.WithClock(context.Background(), clock)
+
+	limited := func(exec *engine.Execution) engine.ExecutionStep {
+		t.Helper()
+		for _, step := range exec.Steps {
+			if step.NodeID == "limited" {
+				return step
+			}
+		}
+		t.Fatal("run has no step for the limited node")
+		return engine.ExecutionStep{}
+	}
+
+	if _, err := executor.Execute(ctx, g, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A minute later by the run's clock the first call has aged out, so the
+	// second run doesn't wait, however little wall time passed.
+	clock.Set(start.Add(time.Minute + time.Second))
+	exec, err := executor.Execute(ctx, g, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waited := limited(exec).RateLimited; waited != 0 {
+		t.Errorf("run a minute later waited %s, want no wait", waited)
+	}
+
+	// Half a minute after that the limit is reached again, so the run waits
+	// until its deadline.
+	clock.Set(start.Add(90 * time.Second))
+	deadline, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	exec, err = executor.Execute(deadline, g, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("run over the limit: error = %v, want the deadline", err)
+	}
+	if waited := limited(exec).RateLimited; waited <= 0 || waited >= time.Second {
+		t.Errorf("run over the limit waited %s by the run's clock, want a few steps of it", waited)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("limited node ran %d times, want 2", n)
+	}
+}
@@ -0,0 +1,191 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"workflow-code-test/api/pkg/errclass"
+)
+
+// Backoff strategies of a RetryPolicy.
+const (
+	// BackoffExponential doubles the delay after every failed attempt. It is
+	// the default.
+	BackoffExponential = "exponential"
+	// BackoffFixed waits the same delay between all attempts.
+	BackoffFixed = "fixed"
+)
+
+const (
+	// MaxRetryAttempts caps RetryPolicy.MaxAttempts, so a node can't hold
+	// its run for long.
+	MaxRetryAttempts = 10
+
+	DefaultRetryDelay    = time.Second
+	DefaultMaxRetryDelay = 30 * time.Second
+)
+
+// RetryPolicy says how often the executor calls the handler of a failing
+// node before the node fails. It is read from the node's "retry" metadata:
+//
+//	"retry": {"maxAttempts": 3, "backoff": "exponential", "delayMs": 500,
+//	          "maxDelayMs": 5000, "retryableErrors": ["timeout", "status 503"]}
+//
+// Permanent errors (see ErrorClass) are never retried, nor is any error once
+// the run's context ended. Without retryableErrors every other error is
+// retried; otherwise only those whose message contains one of them, ignoring
+// case, are.
+type RetryPolicy struct {
+	MaxAttempts     int
+	Backoff         string
+	Delay           time.Duration
+	MaxDelay        time.Duration
+	RetryableErrors []string
+}
+
+// RetryPolicy returns the node's retry policy. Nodes without "retry"
+// metadata are attempted once.
+func (n *Node) RetryPolicy() (RetryPolicy, error) {
+	p := RetryPolicy{
+		MaxAttempts: 1,
+		Backoff:     BackoffExponential,
+		Delay:       DefaultRetryDelay,
+		MaxDelay:    DefaultMaxRetryDelay,
+	}
+	raw, ok := n.Metadata["retry"]
+	if !ok {
+		return p, nil
+	}
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return p, errors.New("retry must be an object")
+	}
+
+	integer := func(key string, min, max int) (int, bool, error) {
+		v, ok := m[key]
+		if !ok {
+			return 0, false, nil
+		}
+		f, err := ToFloat(v)
+		if err != nil || f != math.Trunc(f) || f < float64(min) || f > float64(max) {
+			return 0, false, fmt.Errorf("retry.%s must be an integer from %d to %d", key, min, max)
+		}
+		return int(f), true, nil
+	}
+	if v, ok, err := integer("maxAttempts", 1, MaxRetryAttempts); err != nil {
+		return p, err
+	} else if ok {
+		p.MaxAttempts = v
+	}
+	if v, ok, err := integer("delayMs", 0, int(time.Hour/time.Millisecond)); err != nil {
+		return p, err
+	} else if ok {
+		p.Delay = time.Duration(v) * time.Millisecond
+	}
+	if v, ok, err := integer("maxDelayMs", 0, int(time.Hour/time.Millisecond)); err != nil {
+		return p, err
+	} else if ok {
+		p.MaxDelay = time.Duration(v) * time.Millisecond
+	}
+	if p.MaxDelay < p.Delay {
+		p.MaxDelay = p.Delay
+	}
+
+	if v, ok := m["backoff"]; ok {
+		s, _ := v.(string)
+		if s != BackoffExponential && s != BackoffFixed {
+			return p, fmt.Errorf("retry.backoff must be %q or %q", BackoffExponential, BackoffFixed)
+		}
+		p.Backoff = s
+	}
+
+	if v, ok := m["retryableErrors"]; ok {
+		var list []any
+		switch v := v.(type) {
+		case []any:
+			list = v
+		case []string:
+			for _, s := range v {
+				list = append(list, s)
+			}
+		}
+		for _, e := range list {
+			s, _ := e.(string)
+			if strings.TrimSpace(s) == "" {
+				return p, errors.New("retry.retryableErrors must be a list of non-empty strings")
+			}
+			p.RetryableErrors = append(p.RetryableErrors, strings.ToLower(s))
+		}
+		if len(p.RetryableErrors) == 0 {
+			return p, errors.New("retry.retryableErrors must be a non-empty list of strings")
+		}
+	}
+	return p, nil
+}
+
+// ErrorClass classifies the error a node failed with. Errors no attempt can
+// get past, invalid input or metadata and an exceeded budget, are permanent,
+// and timeouts transient. Otherwise it is the class the client that made an
+// outbound call gave its error, or "" if it gave none. Failed steps output
+// it as "errorClass".
+func ErrorClass(err error) errclass.Class {
+	switch {
+	case errors.Is(err, ErrInvalidInput),
+		errors.Is(err, ErrInvalidNode),
+		errors.Is(err, ErrBudgetExceeded),
+		errors.Is(err, ErrLoopLimit):
+		return errclass.Permanent
+	}
+	if class := errclass.Of(err); class != "" {
+		return class
+	}
+	if errors.Is(err, ErrNodeTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return errclass.Transient
+	}
+	return ""
+}
+
+// retryable reports whether another attempt may succeed after err.
+func (p RetryPolicy) retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || ErrorClass(err) == errclass.Permanent {
+		return false
+	}
+	if len(p.RetryableErrors) == 0 {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range p.RetryableErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait after the attempt-th attempt failed.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Delay
+	if p.Backoff == BackoffExponential {
+		for i := 1; i < attempt && d < p.MaxDelay; i++ {
+			d *= 2
+		}
+	}
+	return min(d, p.MaxDelay)
+}
+
+// wait sleeps before the attempt after the attempt-th, unless ctx ends
+// first.
+func (p RetryPolicy) wait(ctx context.Context, attempt int) error {
+	t := time.NewTimer(p.delay(attempt))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Versioned is implemented by handlers that declare the semantic version of
+// their behaviour, e.g. "2.1.0". A handler that changes incompatibly, say by
+// requiring new metadata, gets a new major version, and workflows pinned to
+// the old one keep running the old handler. Handlers that don't implement it
+// are DefaultHandlerVersion.
+type Versioned interface {
+	Version() string
+}
+
+// DefaultHandlerVersion is the version of handlers that don't declare one.
+const DefaultHandlerVersion = "1.0.0"
+
+// WithVersion declares the version of a handler, e.g. a HandlerFunc.
+func WithVersion(h NodeHandler, version string) NodeHandler {
+	return versionedHandler{NodeHandler: h, version: version}
+}
+
+type versionedHandler struct {
+	NodeHandler
+	version string
+}
+
+func (h versionedHandler) Version() string {
+	return h.version
+}
+
+// Compile forwards to the wrapped handler, if it compiles nodes.
+func (h versionedHandler) Compile(node *Node) (any, error) {
+	if c, ok := h.NodeHandler.(Compiler); ok {
+		return c.Compile(node)
+	}
+	return nil, nil
+}
+
+// HandlerVersion returns the version a handler declares.
+func HandlerVersion(h NodeHandler) string {
+	if v, ok := h.(Versioned); ok {
+		return v.Version()
+	}
+	return DefaultHandlerVersion
+}
+
+// MajorVersion returns the major version of a semantic version such as
+// "2.1.0" or "2".
+func MajorVersion(version string) (int, error) {
+	major, _, _ := strings.Cut(strings.TrimPrefix(version, "v"), ".")
+	n, err := strconv.Atoi(major)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid handler version %q", version)
+	}
+	return n, nil
+}
+
+// HandlerVersions returns the versions registered for each node type, ordered
+// by major version. The handler Get returns is the one registered last.
+func (r *Registry) HandlerVersions() map[string][]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string][]string, len(r.versions))
+	for nodeType, byMajor := range r.versions {
+		for _, major := range slices.Sorted(maps.Keys(byMajor)) {
+			out[nodeType] = append(out[nodeType], HandlerVersion(byMajor[major]))
+		}
+	}
+	return out
+}
+
+// Pin returns a registry that serves each node type in pins with the handler
+// of that major version; other types keep their handlers. It fails with
+// ErrHandlerVersion if no such handler is registered. Pin before Bind: node
+// types bound to a variant run the variant whatever their pin.
+func (r *Registry) Pin(pins map[string]int) (*Registry, error) {
+	if len(pins) == 0 {
+		return r, nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pinned := &Registry{handlers: maps.Clone(r.handlers), variants: r.variants, versions: r.versions}
+	for nodeType, major := range pins {
+		h, ok := r.versions[nodeType][major]
+		if !ok {
+			return nil, fmt.Errorf("%w: node type %s has no version %d handler", ErrHandlerVersion, nodeType, major)
+		}
+		pinned.handlers[nodeType] = h
+	}
+	return pinned, nil
+}
+
+// pinLabelPrefix marks the labels that pin a node type to a handler major
+// version for one run, e.g. "handlerVersion.email": "1".
+const pinLabelPrefix = "handlerVersion."
+
+// PinLabel returns the label pinning nodeType to a handler major version.
+func PinLabel(nodeType string) string {
+	return pinLabelPrefix + nodeType
+}
+
+// Pins returns the handler version pins among the labels of ctx, keyed by
+// node type.
+func Pins(ctx context.Context) map[string]int {
+	return PinsFromLabels(Labels(ctx))
+}
+
+// PinsFromLabels returns the handler version pins among labels, keyed by node
+// type. Labels that aren't a number are ignored.
+func PinsFromLabels(labels map[string]string) map[string]int {
+	var pins map[string]int
+	for k, v := range labels {
+		nodeType, ok := strings.CutPrefix(k, pinLabelPrefix)
+		if !ok {
+			continue
+		}
+		major, err := strconv.Atoi(v)
+		if err != nil {
+			continue
+		}
+		if pins == nil {
+			pins = make(map[string]int)
+		}
+		pins[nodeType] = major
+	}
+	return pins
+}
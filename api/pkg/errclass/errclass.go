@@ -0,0 +1,94 @@
+// Package errclass classifies the errors of calls to external services as
+// transient, which may go away if the call is made again, or permanent, so
+// the engine only retries calls that can succeed.
+package errclass
+
+import "net/http"
+
+// Class is the classification of an error.
+type Class string
+
+const (
+	// Transient errors come from timeouts, failed connections and 5xx, 408
+	// and 429 responses.
+	Transient Class = "transient"
+	// Permanent errors come from the other 4xx responses: the request would
+	// fail again unchanged.
+	Permanent Class = "permanent"
+)
+
+// Error is an error classified by the client that made the call.
+type Error struct {
+	Class Class
+	// StatusCode is the HTTP status of the response, or zero if there was
+	// none.
+	StatusCode int
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Call classifies err, the error of making an HTTP request, e.g. of
+// http.Client.Do, as transient: no response came back.
+func Call(err error) error {
+	return &Error{Class: Transient, Err: err}
+}
+
+// Status classifies err, the error of an unexpected HTTP response status, by
+// that status.
+func Status(code int, err error) error {
+	return &Error{Class: ForStatus(code), StatusCode: code, Err: err}
+}
+
+// ForStatus returns the class of an unexpected HTTP response status.
+func ForStatus(code int) Class {
+	switch {
+	case code >= 500, code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+		return Transient
+	case code >= 400:
+		return Permanent
+	}
+	// Redirects that weren't followed and other odd statuses may well be
+	// answered differently later.
+	return Transient
+}
+
+// Of returns the class of err: transient if any classified error in its tree
+// is, e.g. when one of several failover providers timed out, permanent if
+// it holds only permanent ones, and "" if err wasn't classified.
+func Of(err error) Class {
+	var class Class
+	var transient func(err error) bool
+	transient = func(err error) bool {
+		if e, ok := err.(*Error); ok {
+			if e.Class == Transient {
+				return true
+			}
+			class = Permanent
+			return false
+		}
+		switch u := err.(type) {
+		case interface{ Unwrap() error }:
+			if next := u.Unwrap(); next != nil {
+				return transient(next)
+			}
+		case interface{ Unwrap() []error }:
+			for _, next := range u.Unwrap() {
+				if transient(next) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if err != nil && transient(err) {
+		return Transient
+	}
+	return class
+}
@@ -0,0 +1,165 @@
+// Package faults injects errors and latency into node handlers, so retry
+// policies, error paths and timeouts can be exercised in development and
+// staging without breaking the services workflows call.
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// ErrInjected is wrapped by every error an Injector makes a node fail with.
+var ErrInjected = errors.New("injected fault")
+
+// Error codes a Rule can fail nodes with.
+const (
+	// CodeFailure fails the node like an outbound call that errored.
+	CodeFailure = "failure"
+	// CodeInvalidInput fails the node as if its input was invalid, see
+	// engine.ErrInvalidInput.
+	CodeInvalidInput = "invalid_input"
+	// CodeTimeout fails the node as if its context hit its deadline.
+	CodeTimeout = "timeout"
+)
+
+var codes = []string{CodeFailure, CodeInvalidInput, CodeTimeout}
+
+// AnyNodeType is the key of the rule applied to node types without their own,
+// other than start and end.
+const AnyNodeType = "*"
+
+// Rule is the faults injected into the nodes of one type.
+type Rule struct {
+	// ErrorRate is the probability, from 0 to 1, that a node fails instead
+	// of running.
+	ErrorRate float64 `yaml:"errorRate"`
+	// Errors are the codes failures pick from at random. Defaults to
+	// CodeFailure.
+	Errors []string `yaml:"errors"`
+	// Latency is added before the node runs, or fails; LatencyJitter adds
+	// up to that much more at random.
+	Latency       time.Duration `yaml:"latency"`
+	LatencyJitter time.Duration `yaml:"latencyJitter"`
+}
+
+// Config is the format of a fault injection file.
+type Config struct {
+	// Seed makes the faults injected into a sequence of nodes repeatable.
+	Seed uint64 `yaml:"seed"`
+	// NodeTypes holds the rule of each node type, or AnyNodeType.
+	NodeTypes map[string]Rule `yaml:"nodeTypes"`
+}
+
+// LoadFile reads the Config in the YAML file at path.
+func LoadFile(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := yaml.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Validate checks the rates, latencies and error codes of the rules.
+func (c *Config) Validate() error {
+	for nodeType, r := range c.NodeTypes {
+		if r.ErrorRate < 0 || r.ErrorRate > 1 {
+			return fmt.Errorf("node type %s: errorRate must be between 0 and 1", nodeType)
+		}
+		if r.Latency < 0 || r.LatencyJitter < 0 {
+			return fmt.Errorf("node type %s: latency must not be negative", nodeType)
+		}
+		for _, code := range r.Errors {
+			if !slices.Contains(codes, code) {
+				return fmt.Errorf("node type %s: unknown error code %q, expected one of %v", nodeType, code, codes)
+			}
+		}
+	}
+	return nil
+}
+
+// Injector applies the rules of a Config to node handlers. Faults are drawn
+// from one random sequence seeded by Config.Seed, so the same nodes run in
+// the same order get the same faults; concurrent runs interleave their draws.
+type Injector struct {
+	rules map[string]Rule
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func NewInjector(c *Config) *Injector {
+	return &Injector{rules: c.NodeTypes, rng: rand.New(rand.NewPCG(c.Seed, c.Seed))}
+}
+
+// fault is what is injected into one node run.
+type fault struct {
+	delay time.Duration
+	code  string
+}
+
+// draw picks the fault of the next node run under rule.
+func (i *Injector) draw(rule Rule) fault {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	f := fault{delay: rule.Latency}
+	if rule.LatencyJitter > 0 {
+		f.delay += time.Duration(i.rng.Int64N(int64(rule.LatencyJitter) + 1))
+	}
+	if rule.ErrorRate > 0 && i.rng.Float64() < rule.ErrorRate {
+		f.code = CodeFailure
+		if len(rule.Errors) > 0 {
+			f.code = rule.Errors[i.rng.IntN(len(rule.Errors))]
+		}
+	}
+	return f
+}
+
+// Middleware injects faults into the handlers of the node types that have a
+// rule, see engine.Executor.Use.
+func (i *Injector) Middleware(nodeType string, next engine.NodeHandler) engine.NodeHandler {
+	rule, ok := i.rules[nodeType]
+	if !ok && nodeType != engine.NodeTypeStart && nodeType != engine.NodeTypeEnd {
+		rule, ok = i.rules[AnyNodeType]
+	}
+	if !ok {
+		return next
+	}
+	return engine.HandlerFunc(func(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+		f := i.draw(rule)
+		if f.delay > 0 {
+			timer := time.NewTimer(f.delay)
+			select {
+			case <-timer.C:
+			case <-ec.Ctx.Done():
+				timer.Stop()
+				return nil, ec.Ctx.Err()
+			}
+		}
+		switch f.code {
+		case CodeFailure:
+			return nil, fmt.Errorf("%w: %s node failed", ErrInjected, nodeType)
+		case CodeInvalidInput:
+			return nil, fmt.Errorf("%w: %w", ErrInjected, engine.ErrInvalidInput)
+		case CodeTimeout:
+			return nil, fmt.Errorf("%w: %w", ErrInjected, context.DeadlineExceeded)
+		}
+		return next.Execute(ec, node)
+	})
+}
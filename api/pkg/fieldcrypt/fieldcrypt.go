@@ -0,0 +1,148 @@
+// Package fieldcrypt encrypts JSON column values with AES-256-GCM. Encrypted
+// values are themselves JSON objects, so they fit the same JSONB columns as
+// the plaintext they replace and both can be read side by side.
+package fieldcrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Algorithm identifies the encryption of an envelope.
+const Algorithm = "aes-256-gcm"
+
+var (
+	ErrUnknownKey = errors.New("value is encrypted with an unknown key")
+	ErrDecrypt    = errors.New("failed to decrypt value")
+)
+
+// envelope is the stored form of an encrypted value.
+type envelope struct {
+	Alg string `json:"$enc"`
+	KID string `json:"kid"`
+	// CT is the nonce followed by the ciphertext.
+	CT string `json:"ct"`
+}
+
+// Keyring holds the keys values may be encrypted with and the one new values
+// are encrypted with. A nil Keyring leaves values in plaintext.
+type Keyring struct {
+	aeads   map[string]cipher.AEAD
+	current string
+}
+
+// NewKeyring returns a keyring of 32-byte keys by id that encrypts with the
+// key named current.
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("no key %q", current)
+	}
+	k := &Keyring{aeads: make(map[string]cipher.AEAD, len(keys)), current: current}
+	for id, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q is %d bytes, want 32", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if k.aeads[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// ParseKeyring parses a list of base64 keys by id such as
+// "2025-01:<base64>,2026-01:<base64>". New values are encrypted with the key
+// named current, or with the last one listed if current is empty.
+func ParseKeyring(spec, current string) (*Keyring, error) {
+	keys := make(map[string][]byte)
+	last := ""
+	for _, item := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("key %q is not of the form <id>:<base64>", item)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		keys[id], last = key, id
+	}
+	if current == "" {
+		current = last
+	}
+	return NewKeyring(current, keys)
+}
+
+// Current returns the id of the key new values are encrypted with.
+func (k *Keyring) Current() string {
+	if k == nil {
+		return ""
+	}
+	return k.current
+}
+
+// Seal encrypts a JSON value with the current key. aad binds the result to
+// where it is stored, e.g. a table, column and row id; Open must be given the
+// same aad. A nil keyring returns plaintext unchanged.
+func (k *Keyring) Seal(plaintext, aad []byte) ([]byte, error) {
+	if k == nil {
+		return plaintext, nil
+	}
+	aead := k.aeads[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	ct := aead.Seal(nonce, nonce, plaintext, aad)
+	return json.Marshal(envelope{Alg: Algorithm, KID: k.current, CT: base64.StdEncoding.EncodeToString(ct)})
+}
+
+// Open returns the plaintext of a value produced by Seal. Values that aren't
+// encrypted are returned unchanged.
+func (k *Keyring) Open(data, aad []byte) ([]byte, error) {
+	env, ok := parseEnvelope(data)
+	if !ok {
+		return data, nil
+	}
+	var aead cipher.AEAD
+	if k != nil {
+		aead = k.aeads[env.KID]
+	}
+	if aead == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, env.KID)
+	}
+	ct, err := base64.StdEncoding.DecodeString(env.CT)
+	if err != nil || len(ct) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, ct[:aead.NonceSize()], ct[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// KeyID returns the id of the key data is encrypted with, or false if it is
+// plaintext.
+func KeyID(data []byte) (string, bool) {
+	env, ok := parseEnvelope(data)
+	return env.KID, ok
+}
+
+func parseEnvelope(data []byte) (envelope, bool) {
+	var env envelope
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) || json.Unmarshal(data, &env) != nil {
+		return envelope{}, false
+	}
+	return env, env.Alg == Algorithm && env.KID != "" && env.CT != ""
+}
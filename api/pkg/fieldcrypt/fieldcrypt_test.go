@@ -0,0 +1,209 @@
+package fieldcrypt_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"workflow-code-test/api/pkg/fieldcrypt"
+)
+
+func key(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func mustKeyring(t *testing.T, current string, keys map[string][]byte) *fieldcrypt.Keyring {
+	t.Helper()
+	k, err := fieldcrypt.NewKeyring(current, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+const (
+	plaintext = `{"email":"jo@example.com"}`
+	aad       = "executions.input:exec-1"
+)
+
+func TestSealOpen(t *testing.T) {
+	k := mustKeyring(t, "k1", map[string][]byte{"k1": key(1)})
+	sealed, err := k.Seal([]byte(plaintext), []byte(aad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("jo@example.com")) {
+		t.Fatalf("sealed value contains the plaintext: %s", sealed)
+	}
+	if !json.Valid(sealed) {
+		t.Errorf("sealed value is not JSON: %s", sealed)
+	}
+	if kid, ok := fieldcrypt.KeyID(sealed); !ok || kid != "k1" {
+		t.Errorf("fieldcrypt.KeyID() = %q, %v; want k1, true", kid, ok)
+	}
+
+	opened, err := k.Open(sealed, []byte(aad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(opened) != plaintext {
+		t.Errorf("Open() = %s, want %s", opened, plaintext)
+	}
+
+	// Every seal uses a fresh nonce.
+	again, err := k.Seal([]byte(plaintext), []byte(aad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Error("sealing twice gave the same ciphertext")
+	}
+}
+
+func TestOpenPlaintext(t *testing.T) {
+	k := mustKeyring(t, "k1", map[string][]byte{"k1": key(1)})
+	for _, data := range []string{plaintext, `[1, 2]`, `"text"`, `{"$enc":"rot13","kid":"k1","ct":"x"}`} {
+		opened, err := k.Open([]byte(data), []byte(aad))
+		if err != nil || string(opened) != data {
+			t.Errorf("Open(%s) = %s, %v; want it unchanged", data, opened, err)
+		}
+	}
+
+	// A nil keyring neither seals nor opens.
+	var none *fieldcrypt.Keyring
+	sealed, err := none.Seal([]byte(plaintext), nil)
+	if err != nil || string(sealed) != plaintext {
+		t.Errorf("nil keyring Seal() = %s, %v; want plaintext", sealed, err)
+	}
+	encrypted, err := k.Seal([]byte(plaintext), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := none.Open(encrypted, nil); !errors.Is(err, fieldcrypt.ErrUnknownKey) {
+		t.Errorf("nil keyring Open() error = %v, want fieldcrypt.ErrUnknownKey", err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old := mustKeyring(t, "2025", map[string][]byte{"2025": key(1)})
+	sealed, err := old.Seal([]byte(plaintext), []byte(aad))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After rotation values sealed with the old key still open, and new
+	// values use the new key.
+	rotated := mustKeyring(t, "2026", map[string][]byte{"2025": key(1), "2026": key(2)})
+	opened, err := rotated.Open(sealed, []byte(aad))
+	if err != nil || string(opened) != plaintext {
+		t.Errorf("Open() after rotation = %s, %v; want the plaintext", opened, err)
+	}
+	resealed, err := rotated.Seal(opened, []byte(aad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid, _ := fieldcrypt.KeyID(resealed); kid != "2026" {
+		t.Errorf("resealed with key %q, want 2026", kid)
+	}
+
+	// Once the old key is dropped, its values can't be opened.
+	retired := mustKeyring(t, "2026", map[string][]byte{"2026": key(2)})
+	if _, err := retired.Open(sealed, []byte(aad)); !errors.Is(err, fieldcrypt.ErrUnknownKey) {
+		t.Errorf("Open() with the key retired: error = %v, want fieldcrypt.ErrUnknownKey", err)
+	}
+	if _, err := retired.Open(resealed, []byte(aad)); err != nil {
+		t.Errorf("Open() of a value sealed with the current key: %v", err)
+	}
+
+	// A different key under the old id doesn't open it either.
+	replaced := mustKeyring(t, "2025", map[string][]byte{"2025": key(3)})
+	if _, err := replaced.Open(sealed, []byte(aad)); !errors.Is(err, fieldcrypt.ErrDecrypt) {
+		t.Errorf("Open() with a replaced key: error = %v, want fieldcrypt.ErrDecrypt", err)
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	k := mustKeyring(t, "k1", map[string][]byte{"k1": key(1)})
+	sealed, err := k.Seal([]byte(plaintext), []byte(aad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env map[string]string
+	if err := json.Unmarshal(sealed, &env); err != nil {
+		t.Fatal(err)
+	}
+	ct, err := base64.StdEncoding.DecodeString(env["ct"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withCT := func(ct string) []byte {
+		data, err := json.Marshal(map[string]string{"$enc": env["$enc"], "kid": env["kid"], "ct": ct})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	flip := func(i int) []byte {
+		c := bytes.Clone(ct)
+		c[i] ^= 1
+		return withCT(base64.StdEncoding.EncodeToString(c))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		aad  string
+		want error
+	}{
+		{"flipped nonce bit", flip(0), aad, fieldcrypt.ErrDecrypt},
+		{"flipped ciphertext bit", flip(len(ct) / 2), aad, fieldcrypt.ErrDecrypt},
+		{"flipped tag bit", flip(len(ct) - 1), aad, fieldcrypt.ErrDecrypt},
+		{"truncated", withCT(base64.StdEncoding.EncodeToString(ct[:8])), aad, fieldcrypt.ErrDecrypt},
+		{"not base64", withCT("%%%"), aad, fieldcrypt.ErrDecrypt},
+		{"wrong row", sealed, "executions.input:exec-2", fieldcrypt.ErrDecrypt},
+		{"wrong column", sealed, strings.Replace(aad, "input", "final_context", 1), fieldcrypt.ErrDecrypt},
+		{"no aad", sealed, "", fieldcrypt.ErrDecrypt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := k.Open(tt.data, []byte(tt.aad)); !errors.Is(err, tt.want) {
+				t.Errorf("Open() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	k1 := base64.StdEncoding.EncodeToString(key(1))
+	k2 := base64.StdEncoding.EncodeToString(key(2))
+
+	k, err := fieldcrypt.ParseKeyring("a:"+k1+", b:"+k2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Current() != "b" {
+		t.Errorf("Current() = %q, want the last key listed", k.Current())
+	}
+	if k, err = fieldcrypt.ParseKeyring("a:"+k1+",b:"+k2, "a"); err != nil || k.Current() != "a" {
+		t.Errorf("fieldcrypt.ParseKeyring() with current a = %v, %v", k.Current(), err)
+	}
+
+	for _, spec := range []string{
+		"",
+		"a",
+		":" + k1,
+		"a:not base64",
+		"a:" + base64.StdEncoding.EncodeToString(key(1)[:16]),
+	} {
+		if _, err := fieldcrypt.ParseKeyring(spec, ""); err == nil {
+			t.Errorf("fieldcrypt.ParseKeyring(%q) succeeded, want an error", spec)
+		}
+	}
+	if _, err := fieldcrypt.ParseKeyring("a:"+k1, "b"); err == nil {
+		t.Error("fieldcrypt.ParseKeyring() with an unknown current key succeeded")
+	}
+}
@@ -0,0 +1,96 @@
+// Package inboundmail reads the emails that inbound parse webhooks post, e.g.
+// SendGrid Inbound Parse, Mailgun routes or Postmark inbound streams, into one
+// shape.
+package inboundmail
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+// Message is an inbound email.
+type Message struct {
+	// From is the sender's address, e.g. "ada@example.com", and FromName
+	// their display name, if any.
+	From     string `json:"from"`
+	FromName string `json:"fromName"`
+	To       string `json:"to"`
+	Subject  string `json:"subject"`
+	// Text is the plain text body, HTML the HTML one; either may be empty.
+	Text string `json:"text"`
+	HTML string `json:"html"`
+}
+
+// ErrNotEmail is returned for payloads that don't look like any provider's
+// inbound email.
+var ErrNotEmail = errors.New("payload is not an inbound email")
+
+// Parse reads the decoded payload of an inbound parse webhook, recognising
+// the provider by its field names.
+func Parse(doc any) (Message, error) {
+	fields, ok := doc.(map[string]any)
+	if !ok {
+		return Message{}, ErrNotEmail
+	}
+	get := func(keys ...string) string {
+		for _, k := range keys {
+			if s, ok := fields[k].(string); ok && s != "" {
+				return s
+			}
+		}
+		return ""
+	}
+
+	var m Message
+	switch {
+	case fields["FromFull"] != nil || fields["TextBody"] != nil:
+		// Postmark posts JSON with capitalised fields.
+		m = Message{From: get("From"), To: get("To"), Subject: get("Subject"), Text: get("TextBody"), HTML: get("HtmlBody")}
+		if full, ok := fields["FromFull"].(map[string]any); ok {
+			m.From, _ = full["Email"].(string)
+			m.FromName, _ = full["Name"].(string)
+		}
+	case fields["body-plain"] != nil || fields["sender"] != nil:
+		// Mailgun posts the envelope sender and recipient, and the body
+		// with and without quoted replies and signatures.
+		m = Message{From: get("from", "sender"), To: get("recipient", "To"), Subject: get("subject", "Subject"),
+			Text: get("stripped-text", "body-plain"), HTML: get("stripped-html", "body-html")}
+	case fields["from"] != nil && (fields["text"] != nil || fields["html"] != nil || fields["subject"] != nil):
+		// SendGrid posts the headers and the parsed bodies.
+		m = Message{From: get("from"), To: get("to"), Subject: get("subject"), Text: get("text"), HTML: get("html")}
+	default:
+		return Message{}, ErrNotEmail
+	}
+
+	// From headers usually carry a display name: "Ada <ada@example.com>".
+	if addr, err := mail.ParseAddress(m.From); err == nil {
+		m.From = addr.Address
+		if m.FromName == "" {
+			m.FromName = addr.Name
+		}
+	}
+	if addrs, err := mail.ParseAddressList(m.To); err == nil {
+		to := make([]string, len(addrs))
+		for i, a := range addrs {
+			to[i] = a.Address
+		}
+		m.To = strings.Join(to, ", ")
+	}
+	if m.From == "" {
+		return Message{}, ErrNotEmail
+	}
+	return m, nil
+}
+
+// Document returns the message as the object receiver mappings address.
+func (m Message) Document() map[string]any {
+	return map[string]any{
+		"from":     m.From,
+		"fromName": m.FromName,
+		"to":       m.To,
+		"subject":  m.Subject,
+		"text":     m.Text,
+		"html":     m.HTML,
+	}
+}
@@ -0,0 +1,211 @@
+// Package incidents raises incidents in PagerDuty and Opsgenie, e.g. to page
+// the on-call engineer when a condition trips.
+package incidents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"workflow-code-test/api/pkg/errclass"
+)
+
+// Severities of an incident, from most to least urgent.
+const (
+	SeverityCritical = "critical"
+	SeverityError    = "error"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// ValidSeverity reports whether s is one of the severities.
+func ValidSeverity(s string) bool {
+	switch s {
+	case SeverityCritical, SeverityError, SeverityWarning, SeverityInfo:
+		return true
+	}
+	return false
+}
+
+// Incident is an incident ready to be raised.
+type Incident struct {
+	Summary  string `json:"summary"`
+	Severity string `json:"severity"`
+	// DedupKey groups repeated triggers into one open incident.
+	DedupKey string `json:"dedupKey"`
+	// Source names what is affected, e.g. a host or city.
+	Source  string         `json:"source,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Triggered identifies a raised incident by its dedup key, which the provider
+// assigns when the incident didn't have one.
+type Triggered struct {
+	DedupKey string `json:"dedupKey"`
+}
+
+// Client raises incidents with an on-call provider.
+type Client interface {
+	Trigger(ctx context.Context, incident Incident) (Triggered, error)
+}
+
+// MockClient logs incidents instead of raising them.
+type MockClient struct {
+	// Provider names the provider in logs, e.g. "pagerduty".
+	Provider string
+}
+
+func NewMockClient(provider string) *MockClient {
+	return &MockClient{Provider: provider}
+}
+
+func (c *MockClient) Trigger(ctx context.Context, incident Incident) (Triggered, error) {
+	if err := ctx.Err(); err != nil {
+		return Triggered{}, err
+	}
+	slog.Info("Mock incident triggered", "provider", c.Provider, "severity", incident.Severity,
+		"dedupKey", incident.DedupKey, "summary", incident.Summary)
+	return Triggered{DedupKey: incident.DedupKey}, nil
+}
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyClient triggers incidents through the PagerDuty Events API v2,
+// routed to the service whose integration RoutingKey it holds.
+type PagerDutyClient struct {
+	URL        string
+	RoutingKey string
+	HTTPClient *http.Client
+}
+
+func NewPagerDutyClient(routingKey string) *PagerDutyClient {
+	return &PagerDutyClient{
+		URL:        pagerDutyEventsURL,
+		RoutingKey: routingKey,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *PagerDutyClient) Trigger(ctx context.Context, incident Incident) (Triggered, error) {
+	source := incident.Source
+	if source == "" {
+		source = "workflow"
+	}
+	payload := map[string]any{
+		"routing_key":  c.RoutingKey,
+		"event_action": "trigger",
+		"payload": map[string]any{
+			"summary":        incident.Summary,
+			"severity":       incident.Severity,
+			"source":         source,
+			"custom_details": incident.Details,
+		},
+	}
+	if incident.DedupKey != "" {
+		payload["dedup_key"] = incident.DedupKey
+	}
+
+	var body struct {
+		DedupKey string `json:"dedup_key"`
+	}
+	if err := postJSON(ctx, c.HTTPClient, c.URL, payload, &body, func(*http.Request) {}); err != nil {
+		return Triggered{}, fmt.Errorf("PagerDuty: %w", err)
+	}
+	return Triggered{DedupKey: body.DedupKey}, nil
+}
+
+const opsgenieBaseURL = "https://api.opsgenie.com"
+
+// opsgeniePriorities maps severities to Opsgenie alert priorities.
+var opsgeniePriorities = map[string]string{
+	SeverityCritical: "P1",
+	SeverityError:    "P2",
+	SeverityWarning:  "P3",
+	SeverityInfo:     "P5",
+}
+
+// OpsgenieClient creates alerts through the Opsgenie Alert API with the
+// APIKey of an API integration, which decides the team they are routed to.
+// Accounts in the EU instance set BaseURL to https://api.eu.opsgenie.com.
+type OpsgenieClient struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+func NewOpsgenieClient(apiKey string) *OpsgenieClient {
+	return &OpsgenieClient{
+		BaseURL:    opsgenieBaseURL,
+		APIKey:     apiKey,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *OpsgenieClient) Trigger(ctx context.Context, incident Incident) (Triggered, error) {
+	payload := map[string]any{
+		"message":  incident.Summary,
+		"priority": opsgeniePriorities[incident.Severity],
+	}
+	if incident.DedupKey != "" {
+		payload["alias"] = incident.DedupKey
+	}
+	if incident.Source != "" {
+		payload["source"] = incident.Source
+	}
+	if len(incident.Details) > 0 {
+		// Opsgenie only takes string details.
+		details := make(map[string]string, len(incident.Details))
+		for k, v := range incident.Details {
+			details[k] = fmt.Sprint(v)
+		}
+		payload["details"] = details
+	}
+
+	// Alerts are created asynchronously; the response only acknowledges the
+	// request, so the alias is the key to refer to the alert by.
+	var body struct {
+		RequestID string `json:"requestId"`
+	}
+	err := postJSON(ctx, c.HTTPClient, strings.TrimSuffix(c.BaseURL, "/")+"/v2/alerts", payload, &body, func(req *http.Request) {
+		req.Header.Set("Authorization", "GenieKey "+c.APIKey)
+	})
+	if err != nil {
+		return Triggered{}, fmt.Errorf("Opsgenie: %w", err)
+	}
+	return Triggered{DedupKey: incident.DedupKey}, nil
+}
+
+// postJSON posts payload to url and decodes a 2xx response into out.
+func postJSON(ctx context.Context, client *http.Client, url string, payload, out any, auth func(*http.Request)) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	auth(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errclass.Call(fmt.Errorf("failed to call API: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errclass.Status(resp.StatusCode, fmt.Errorf("API returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
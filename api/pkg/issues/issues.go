@@ -0,0 +1,186 @@
+// Package issues files issues in Jira and GitHub, e.g. to turn an alert into a
+// ticket.
+package issues
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"workflow-code-test/api/pkg/errclass"
+)
+
+// Issue is an issue ready to be filed.
+type Issue struct {
+	// Project is the Jira project key, e.g. "OPS", or the GitHub repository as
+	// "owner/repo".
+	Project string   `json:"project"`
+	Title   string   `json:"title"`
+	Body    string   `json:"body"`
+	Labels  []string `json:"labels,omitempty"`
+	// Type is the Jira issue type, e.g. "Task". GitHub ignores it.
+	Type string `json:"type,omitempty"`
+}
+
+// Created identifies a filed issue: its key, e.g. "OPS-12" or
+// "owner/repo#12", and the URL people open it at.
+type Created struct {
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+// Client files issues in a tracker.
+type Client interface {
+	Create(ctx context.Context, issue Issue) (Created, error)
+}
+
+// MockClient logs issues instead of filing them.
+type MockClient struct {
+	// Tracker names the tracker in logs and fake URLs, e.g. "jira".
+	Tracker string
+}
+
+func NewMockClient(tracker string) *MockClient {
+	return &MockClient{Tracker: tracker}
+}
+
+func (c *MockClient) Create(ctx context.Context, issue Issue) (Created, error) {
+	if err := ctx.Err(); err != nil {
+		return Created{}, err
+	}
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return Created{}, err
+	}
+	key := issue.Project + "-" + hex.EncodeToString(b)
+	created := Created{Key: key, URL: "https://" + c.Tracker + ".example.com/issues/" + key}
+
+	slog.Info("Mock issue created", "tracker", c.Tracker, "key", key, "title", issue.Title)
+	return created, nil
+}
+
+const githubBaseURL = "https://api.github.com"
+
+// GitHubClient files issues through the GitHub REST API.
+type GitHubClient struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewGitHubClient(token string) *GitHubClient {
+	return &GitHubClient{
+		BaseURL:    githubBaseURL,
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *GitHubClient) Create(ctx context.Context, issue Issue) (Created, error) {
+	owner, repo, ok := strings.Cut(issue.Project, "/")
+	if !ok || owner == "" || repo == "" {
+		return Created{}, fmt.Errorf("GitHub repository %q is not of the form owner/repo", issue.Project)
+	}
+	payload := map[string]any{"title": issue.Title, "body": issue.Body}
+	if len(issue.Labels) > 0 {
+		payload["labels"] = issue.Labels
+	}
+
+	var body struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	err := postJSON(ctx, c.HTTPClient, c.BaseURL+"/repos/"+owner+"/"+repo+"/issues", payload, &body, func(req *http.Request) {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	})
+	if err != nil {
+		return Created{}, fmt.Errorf("GitHub: %w", err)
+	}
+	return Created{Key: fmt.Sprintf("%s#%d", issue.Project, body.Number), URL: body.HTMLURL}, nil
+}
+
+// DefaultJiraIssueType is used for issues that don't name a type.
+const DefaultJiraIssueType = "Task"
+
+// JiraClient files issues through the Jira Cloud REST API of the site at
+// BaseURL, e.g. https://example.atlassian.net, with an API token.
+type JiraClient struct {
+	BaseURL    string
+	Email      string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewJiraClient(baseURL, email, token string) *JiraClient {
+	return &JiraClient{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Email:      email,
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *JiraClient) Create(ctx context.Context, issue Issue) (Created, error) {
+	issueType := issue.Type
+	if issueType == "" {
+		issueType = DefaultJiraIssueType
+	}
+	fields := map[string]any{
+		"project":     map[string]string{"key": issue.Project},
+		"summary":     issue.Title,
+		"description": issue.Body,
+		"issuetype":   map[string]string{"name": issueType},
+	}
+	if len(issue.Labels) > 0 {
+		fields["labels"] = issue.Labels
+	}
+
+	var body struct {
+		Key string `json:"key"`
+	}
+	err := postJSON(ctx, c.HTTPClient, c.BaseURL+"/rest/api/2/issue", map[string]any{"fields": fields}, &body, func(req *http.Request) {
+		req.SetBasicAuth(c.Email, c.Token)
+	})
+	if err != nil {
+		return Created{}, fmt.Errorf("Jira: %w", err)
+	}
+	return Created{Key: body.Key, URL: c.BaseURL + "/browse/" + body.Key}, nil
+}
+
+// postJSON posts payload to url and decodes a 2xx response into out.
+func postJSON(ctx context.Context, client *http.Client, url string, payload, out any, auth func(*http.Request)) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	auth(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errclass.Call(fmt.Errorf("failed to call API: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errclass.Status(resp.StatusCode, fmt.Errorf("API returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
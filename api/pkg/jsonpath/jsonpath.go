@@ -0,0 +1,243 @@
+// Package jsonpath extracts values from decoded JSON documents with a subset of
+// JSONPath: the root $, child members (.name or ['name']), array indexes
+// ([0], [-1]), wildcards (.* or [*]) and recursive descent (..name).
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrSyntax  = errors.New("invalid JSONPath")
+	ErrNoMatch = errors.New("JSONPath matched nothing")
+)
+
+type segmentKind int
+
+const (
+	segmentMember segmentKind = iota
+	segmentIndex
+	segmentWildcard
+	segmentDescend
+)
+
+type segment struct {
+	kind  segmentKind
+	name  string
+	index int
+}
+
+// Path is a parsed JSONPath expression.
+type Path struct {
+	src      string
+	segments []segment
+}
+
+// Parse parses a JSONPath expression. The leading $ may be omitted, so
+// "weather.temp" is the same as "$.weather.temp".
+func Parse(expr string) (*Path, error) {
+	src := strings.TrimSpace(expr)
+	rest := strings.TrimPrefix(src, "$")
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+
+	p := &Path{src: src}
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			name, n := memberName(rest[2:])
+			if name == "" {
+				return nil, fmt.Errorf("%w: %q: .. needs a member name", ErrSyntax, expr)
+			}
+			p.segments = append(p.segments, segment{kind: segmentDescend, name: name})
+			rest = rest[2+n:]
+		case strings.HasPrefix(rest, ".*"):
+			p.segments = append(p.segments, segment{kind: segmentWildcard})
+			rest = rest[2:]
+		case rest[0] == '.':
+			name, n := memberName(rest[1:])
+			if name == "" {
+				return nil, fmt.Errorf("%w: %q: empty member name", ErrSyntax, expr)
+			}
+			p.segments = append(p.segments, segment{kind: segmentMember, name: name})
+			rest = rest[1+n:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: %q: missing ]", ErrSyntax, expr)
+			}
+			seg, err := bracket(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q: %v", ErrSyntax, expr, err)
+			}
+			p.segments = append(p.segments, seg)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("%w: %q: unexpected %q", ErrSyntax, expr, rest[:1])
+		}
+	}
+	return p, nil
+}
+
+// memberName returns the member name at the start of s and its length.
+func memberName(s string) (string, int) {
+	n := strings.IndexAny(s, ".[")
+	if n < 0 {
+		n = len(s)
+	}
+	return s[:n], n
+}
+
+func bracket(inner string) (segment, error) {
+	inner = strings.TrimSpace(inner)
+	switch {
+	case inner == "*":
+		return segment{kind: segmentWildcard}, nil
+	case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+		return segment{kind: segmentMember, name: inner[1 : len(inner)-1]}, nil
+	}
+	i, err := strconv.Atoi(inner)
+	if err != nil {
+		return segment{}, fmt.Errorf("unsupported selector [%s]", inner)
+	}
+	return segment{kind: segmentIndex, index: i}, nil
+}
+
+// String returns the expression the path was parsed from.
+func (p *Path) String() string {
+	return p.src
+}
+
+// Definite reports whether the path selects at most one value, i.e. it has no
+// wildcards or recursive descent.
+func (p *Path) Definite() bool {
+	for _, s := range p.segments {
+		if s.kind == segmentWildcard || s.kind == segmentDescend {
+			return false
+		}
+	}
+	return true
+}
+
+// All returns every value the path selects in doc, in document order. Object
+// members are visited in key order so results are stable.
+func (p *Path) All(doc any) []any {
+	nodes := []any{doc}
+	for _, s := range p.segments {
+		var next []any
+		for _, n := range nodes {
+			next = s.apply(n, next)
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// Get returns the value selected by a definite path, or the list of matches
+// for a path with wildcards or recursive descent. It fails with ErrNoMatch
+// when a definite path selects nothing.
+func (p *Path) Get(doc any) (any, error) {
+	matches := p.All(doc)
+	if !p.Definite() {
+		if matches == nil {
+			matches = []any{}
+		}
+		return matches, nil
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoMatch, p.src)
+	}
+	return matches[0], nil
+}
+
+// Get parses expr and applies it to doc.
+func Get(doc any, expr string) (any, error) {
+	p, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Get(doc)
+}
+
+func (s segment) apply(n any, out []any) []any {
+	switch s.kind {
+	case segmentMember:
+		if m, ok := n.(map[string]any); ok {
+			if v, ok := m[s.name]; ok {
+				out = append(out, v)
+			}
+		}
+	case segmentIndex:
+		if list, ok := n.([]any); ok {
+			i := s.index
+			if i < 0 {
+				i += len(list)
+			}
+			if i >= 0 && i < len(list) {
+				out = append(out, list[i])
+			}
+		}
+	case segmentWildcard:
+		out = append(out, children(n)...)
+	case segmentDescend:
+		out = descend(n, s.name, out)
+	}
+	return out
+}
+
+// children returns the elements of a list or the member values of an object.
+func children(n any) []any {
+	switch v := n.(type) {
+	case []any:
+		return v
+	case map[string]any:
+		out := make([]any, 0, len(v))
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			out = append(out, v[k])
+		}
+		return out
+	}
+	return nil
+}
+
+// descend collects the values of every member called name at any depth.
+func descend(n any, name string, out []any) []any {
+	if m, ok := n.(map[string]any); ok {
+		if v, ok := m[name]; ok {
+			out = append(out, v)
+		}
+	}
+	for _, c := range children(n) {
+		out = descend(c, name, out)
+	}
+	return out
+}
+
+// Head returns the first member name of the path, e.g. "weather" for
+// "$.weather.current.temp", or "" when the path doesn't start with a member.
+func (p *Path) Head() string {
+	if len(p.segments) == 0 || p.segments[0].kind != segmentMember {
+		return ""
+	}
+	return p.segments[0].name
+}
+
+// Members returns the member names the path starts with, e.g. ["weather",
+// "current", "temp"] for "$.weather.current.temp" or ["items"] for
+// "$.items[0].name".
+func (p *Path) Members() []string {
+	var names []string
+	for _, s := range p.segments {
+		if s.kind != segmentMember {
+			break
+		}
+		names = append(names, s.name)
+	}
+	return names
+}
@@ -0,0 +1,134 @@
+package jsonpath_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"workflow-code-test/api/pkg/jsonpath"
+)
+
+// doc is a decoded weather response.
+var doc = map[string]any{
+	"city": "Sydney",
+	"weather": map[string]any{
+		"current": map[string]any{"temp": 28.5, "wind": 12.0},
+		"hourly": []any{
+			map[string]any{"hour": 9.0, "temp": 24.0},
+			map[string]any{"hour": 12.0, "temp": 27.0},
+			map[string]any{"hour": 15.0, "temp": 29.0},
+		},
+	},
+	"odd key": "quoted",
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		expr string
+		want any
+	}{
+		{"$", doc},
+		{"$.city", "Sydney"},
+		{"city", "Sydney"},
+		{"weather.current.temp", 28.5},
+		{"$['weather']['current']['wind']", 12.0},
+		{`$["odd key"]`, "quoted"},
+		{"$.weather.hourly[0].temp", 24.0},
+		{"$.weather.hourly[-1].hour", 15.0},
+		{" $.city ", "Sydney"},
+		// Paths with wildcards or recursive descent return every match, in
+		// document order with object members in key order.
+		{"$.weather.hourly[*].temp", []any{24.0, 27.0, 29.0}},
+		{"$.weather.current.*", []any{28.5, 12.0}},
+		{"$..temp", []any{28.5, 24.0, 27.0, 29.0}},
+		{"$..rain", []any{}},
+		{"$.weather.hourly[5].*", []any{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := jsonpath.Get(doc, tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetNoMatch(t *testing.T) {
+	for _, expr := range []string{
+		"$.town",
+		"$.weather.current.temp.value",
+		"$.city[0]",
+		"$.weather.hourly.temp",
+		// Indexes out of range, counting from either end.
+		"$.weather.hourly[3]",
+		"$.weather.hourly[99].temp",
+		"$.weather.hourly[-4]",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			if got, err := jsonpath.Get(doc, expr); !errors.Is(err, jsonpath.ErrNoMatch) {
+				t.Errorf("Get() = %v, %v; want ErrNoMatch", got, err)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"$.",
+		"$.weather.",
+		"$..",
+		"$..[0]",
+		"$.hourly[0",
+		"$.hourly[]",
+		"$.hourly[1:2]",
+		"$.hourly[?(@.temp)]",
+		"$.hourly[one]",
+		"$.hourly['temp\"]",
+		"$.hourly[0]x",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			if p, err := jsonpath.Parse(expr); !errors.Is(err, jsonpath.ErrSyntax) {
+				t.Errorf("Parse() = %v, %v; want ErrSyntax", p, err)
+			}
+			if _, err := jsonpath.Get(doc, expr); !errors.Is(err, jsonpath.ErrSyntax) {
+				t.Errorf("Get() error = %v, want ErrSyntax", err)
+			}
+		})
+	}
+}
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		expr     string
+		definite bool
+		head     string
+	}{
+		{"$", true, ""},
+		{"$.weather.current.temp", true, "weather"},
+		{"weather.hourly[0]", true, "weather"},
+		{"$[0].city", true, ""},
+		{"$.weather.hourly[*].temp", false, "weather"},
+		{"$..temp", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p, err := jsonpath.Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.String() != tt.expr {
+				t.Errorf("String() = %q, want %q", p.String(), tt.expr)
+			}
+			if p.Definite() != tt.definite {
+				t.Errorf("Definite() = %v, want %v", p.Definite(), tt.definite)
+			}
+			if p.Head() != tt.head {
+				t.Errorf("Head() = %q, want %q", p.Head(), tt.head)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+// Package jsonschema validates decoded JSON values against the commonly used
+// subset of JSON Schema: type, enum, const, properties, required,
+// additionalProperties, items, minItems/maxItems, minLength/maxLength,
+// pattern, format (email, date-time, date, uuid), minimum/maximum and
+// exclusiveMinimum/exclusiveMaximum. Other keywords are ignored.
+package jsonschema
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidSchema is returned when the schema itself can't be applied, e.g.
+// because a pattern is not a valid regular expression.
+var ErrInvalidSchema = errors.New("invalid schema")
+
+// Error is one way in which a value doesn't match the schema.
+type Error struct {
+	// Path locates the offending value, e.g. "$.city" or "$.items[2]".
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e Error) String() string {
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks v against schema and returns every violation found. It
+// fails only if the schema is invalid.
+func Validate(schema map[string]any, v any) ([]Error, error) {
+	var errs []Error
+	if err := validate(schema, v, "$", &errs); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func validate(schema map[string]any, v any, path string, errs *[]Error) error {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, Error{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if types := typeList(schema["type"]); len(types) > 0 {
+		if !slices.ContainsFunc(types, func(t string) bool { return hasType(v, t) }) {
+			fail("expected %s, got %s", joinTypes(types), typeOf(v))
+			return nil
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		if !slices.ContainsFunc(enum, func(e any) bool { return equal(e, v) }) {
+			fail("must be one of %v", enum)
+		}
+	}
+	if c, ok := schema["const"]; ok && !equal(c, v) {
+		fail("must be %v", c)
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		return validateObject(schema, val, path, errs)
+	case []any:
+		return validateArray(schema, val, path, errs)
+	case string:
+		return validateString(schema, val, fail)
+	default:
+		if n, ok := number(v); ok {
+			validateNumber(schema, n, fail)
+		}
+	}
+	return nil
+}
+
+func validateObject(schema map[string]any, obj map[string]any, path string, errs *[]Error) error {
+	for _, name := range stringList(schema["required"]) {
+		if _, ok := obj[name]; !ok {
+			*errs = append(*errs, Error{Path: path + "." + name, Message: "is required"})
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]any)
+	for _, name := range slices.Sorted(maps.Keys(obj)) {
+		sub, ok := props[name].(map[string]any)
+		if !ok {
+			if allowed, ok := schema["additionalProperties"].(bool); ok && !allowed {
+				*errs = append(*errs, Error{Path: path + "." + name, Message: "is not allowed"})
+			}
+			continue
+		}
+		if err := validate(sub, obj[name], path+"."+name, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateArray(schema map[string]any, list []any, path string, errs *[]Error) error {
+	if n, ok := intKeyword(schema, "minItems"); ok && len(list) < n {
+		*errs = append(*errs, Error{Path: path, Message: fmt.Sprintf("must have at least %d items", n)})
+	}
+	if n, ok := intKeyword(schema, "maxItems"); ok && len(list) > n {
+		*errs = append(*errs, Error{Path: path, Message: fmt.Sprintf("must have at most %d items", n)})
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		for i, item := range list {
+			if err := validate(items, item, path+"["+strconv.Itoa(i)+"]", errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateString(schema map[string]any, s string, fail func(string, ...any)) error {
+	length := utf8.RuneCountInString(s)
+	if n, ok := intKeyword(schema, "minLength"); ok && length < n {
+		fail("must be at least %d characters", n)
+	}
+	if n, ok := intKeyword(schema, "maxLength"); ok && length > n {
+		fail("must be at most %d characters", n)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%w: pattern %q: %v", ErrInvalidSchema, pattern, err)
+		}
+		if !re.MatchString(s) {
+			fail("must match %s", pattern)
+		}
+	}
+	if format, ok := schema["format"].(string); ok && !matchesFormat(format, s) {
+		fail("must be a valid %s", format)
+	}
+	return nil
+}
+
+func validateNumber(schema map[string]any, n float64, fail func(string, ...any)) {
+	if min, ok := number(schema["minimum"]); ok && n < min {
+		fail("must be >= %v", min)
+	}
+	if max, ok := number(schema["maximum"]); ok && n > max {
+		fail("must be <= %v", max)
+	}
+	if min, ok := number(schema["exclusiveMinimum"]); ok && n <= min {
+		fail("must be > %v", min)
+	}
+	if max, ok := number(schema["exclusiveMaximum"]); ok && n >= max {
+		fail("must be < %v", max)
+	}
+}
+
+// matchesFormat checks the formats this package knows; unknown formats pass.
+func matchesFormat(format, s string) bool {
+	switch format {
+	case "email":
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Address == s
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, s)
+		return err == nil
+	case "uuid":
+		return uuid.Validate(s) == nil
+	}
+	return true
+}
+
+func hasType(v any, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := number(v)
+		return ok && n == float64(int64(n))
+	case "number":
+		_, ok := number(v)
+		return ok
+	}
+	return typeOf(v) == t
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	if _, ok := number(v); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// equal compares JSON values, treating all numeric types alike.
+func equal(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func intKeyword(schema map[string]any, key string) (int, bool) {
+	n, ok := number(schema[key])
+	return int(n), ok
+}
+
+func typeList(v any) []string {
+	if s, ok := v.(string); ok {
+		return []string{s}
+	}
+	return stringList(v)
+}
+
+func stringList(v any) []string {
+	raw, _ := v.([]any)
+	out := make([]string, 0, len(raw))
+	for _, r := range raw {
+		if s, ok := r.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func joinTypes(types []string) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return fmt.Sprintf("one of %v", types)
+}
@@ -0,0 +1,173 @@
+package jsonschema_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"workflow-code-test/api/pkg/jsonschema"
+)
+
+// alertSchema is the kind of schema validate nodes check form data against.
+var alertSchema = map[string]any{
+	"type":     "object",
+	"required": []any{"name", "email", "city"},
+	"properties": map[string]any{
+		"name":  map[string]any{"type": "string", "minLength": 1.0, "maxLength": 20.0},
+		"email": map[string]any{"type": "string", "format": "email"},
+		"city":  map[string]any{"enum": []any{"Sydney", "Melbourne", "Brisbane"}},
+		"age":   map[string]any{"type": "integer", "minimum": 18.0, "exclusiveMaximum": 130.0},
+		"alert": map[string]any{
+			"type":                 "object",
+			"required":             []any{"threshold"},
+			"additionalProperties": false,
+			"properties": map[string]any{
+				"threshold": map[string]any{"type": "number", "minimum": -50.0, "maximum": 60.0},
+				"operator":  map[string]any{"enum": []any{"greater_than", "less_than"}},
+				"channels": map[string]any{
+					"type":     "array",
+					"minItems": 1.0,
+					"maxItems": 2.0,
+					"items":    map[string]any{"type": "string", "pattern": "^(email|sms)$"},
+				},
+			},
+		},
+		"nickname": map[string]any{"type": []any{"string", "null"}},
+		"version":  map[string]any{"const": 2.0},
+	},
+}
+
+// valid returns a value matching alertSchema with changes applied.
+func valid(changes map[string]any) map[string]any {
+	v := map[string]any{
+		"name":  "Jo",
+		"email": "jo@example.com",
+		"city":  "Sydney",
+		"age":   30.0,
+		"alert": map[string]any{
+			"threshold": 25.0,
+			"operator":  "greater_than",
+			"channels":  []any{"email", "sms"},
+		},
+		"nickname": nil,
+		"version":  2,
+	}
+	for k, c := range changes {
+		if c == nil {
+			delete(v, k)
+		} else {
+			v[k] = c
+		}
+	}
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  []string
+	}{
+		{"valid", valid(nil), nil},
+		{"optional fields missing", valid(map[string]any{"age": nil, "alert": nil, "nickname": nil, "version": nil}), nil},
+
+		// Required fields.
+		{"missing field", valid(map[string]any{"email": nil}), []string{"$.email: is required"}},
+		{"missing fields", map[string]any{"city": "Sydney"}, []string{"$.name: is required", "$.email: is required"}},
+		{"missing nested field", valid(map[string]any{"alert": map[string]any{}}), []string{"$.alert.threshold: is required"}},
+
+		// Type mismatches.
+		{"not an object", []any{"Jo"}, []string{"$: expected object, got array"}},
+		{"string for number", valid(map[string]any{"age": "30"}), []string{"$.age: expected integer, got string"}},
+		{"fraction for integer", valid(map[string]any{"age": 30.5}), []string{"$.age: expected integer, got number"}},
+		{"number for string", valid(map[string]any{"name": 7.0}), []string{"$.name: expected string, got number"}},
+		{"bool for union", valid(map[string]any{"nickname": true}), []string{"$.nickname: expected one of [string null], got boolean"}},
+		{"object for array", valid(map[string]any{"alert": map[string]any{"threshold": 1.0, "channels": map[string]any{}}}),
+			[]string{"$.alert.channels: expected array, got object"}},
+
+		// Nested objects and arrays.
+		{"nested range", valid(map[string]any{"alert": map[string]any{"threshold": 75.0}}), []string{"$.alert.threshold: must be <= 60"}},
+		{"nested unknown field", valid(map[string]any{"alert": map[string]any{"threshold": 25.0, "repeat": true}}),
+			[]string{"$.alert.repeat: is not allowed"}},
+		{"item pattern", valid(map[string]any{"alert": map[string]any{"threshold": 25.0, "channels": []any{"email", "fax"}}}),
+			[]string{"$.alert.channels[1]: must match ^(email|sms)$"}},
+		{"too few items", valid(map[string]any{"alert": map[string]any{"threshold": 25.0, "channels": []any{}}}),
+			[]string{"$.alert.channels: must have at least 1 items"}},
+		{"too many items", valid(map[string]any{"alert": map[string]any{"threshold": 25.0, "channels": []any{"sms", "sms", "sms"}}}),
+			[]string{"$.alert.channels: must have at most 2 items"}},
+
+		// Enums and consts.
+		{"not in enum", valid(map[string]any{"city": "Perth"}), []string{"$.city: must be one of [Sydney Melbourne Brisbane]"}},
+		{"enum is case sensitive", valid(map[string]any{"city": "sydney"}), []string{"$.city: must be one of [Sydney Melbourne Brisbane]"}},
+		{"nested enum", valid(map[string]any{"alert": map[string]any{"threshold": 25.0, "operator": "equals"}}),
+			[]string{"$.alert.operator: must be one of [greater_than less_than]"}},
+		{"const", valid(map[string]any{"version": 1}), []string{"$.version: must be 2"}},
+
+		// Strings and numbers.
+		{"empty name", valid(map[string]any{"name": ""}), []string{"$.name: must be at least 1 characters"}},
+		{"long name", valid(map[string]any{"name": "Joanna Maria Josephine"}), []string{"$.name: must be at most 20 characters"}},
+		{"bad email", valid(map[string]any{"email": "Jo <jo@example.com>"}), []string{"$.email: must be a valid email"}},
+		{"under minimum", valid(map[string]any{"age": 17}), []string{"$.age: must be >= 18"}},
+		{"at exclusive maximum", valid(map[string]any{"age": 130}), []string{"$.age: must be < 130"}},
+
+		// Every violation is reported.
+		{"several", valid(map[string]any{"name": nil, "city": "Perth", "age": 12.0}), []string{
+			"$.name: is required", "$.age: must be >= 18", "$.city: must be one of [Sydney Melbourne Brisbane]",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, err := jsonschema.Validate(alertSchema, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		value  string
+		valid  bool
+	}{
+		{"email", "jo@example.com", true},
+		{"email", "jo@", false},
+		{"date-time", "2026-03-01T09:30:00+11:00", true},
+		{"date-time", "2026-03-01 09:30", false},
+		{"date", "2026-03-01", true},
+		{"date", "2026-13-01", false},
+		{"uuid", "550e8400-e29b-41d4-a716-446655440000", true},
+		{"uuid", "550e8400", false},
+		{"hostname", "anything goes", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+"/"+tt.value, func(t *testing.T) {
+			errs, err := jsonschema.Validate(map[string]any{"format": tt.format}, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(errs) == 0; got != tt.valid {
+				t.Errorf("valid = %v, want %v (errors %v)", got, tt.valid, errs)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidSchema(t *testing.T) {
+	schema := map[string]any{"type": "string", "pattern": "(unclosed"}
+	if _, err := jsonschema.Validate(schema, "text"); !errors.Is(err, jsonschema.ErrInvalidSchema) {
+		t.Errorf("Validate() error = %v, want ErrInvalidSchema", err)
+	}
+	// The pattern is only compiled for strings.
+	if errs, err := jsonschema.Validate(map[string]any{"pattern": "(unclosed"}, 1.0); err != nil || errs != nil {
+		t.Errorf("Validate() of a number = %v, %v; want no errors", errs, err)
+	}
+}
@@ -0,0 +1,532 @@
+// Package mqtt is a small MQTT 3.1.1 client: enough to subscribe to sensor
+// topics and publish messages with QoS 0 or 1 over TCP or TLS, reconnecting
+// when the broker goes away.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a message received on a subscribed topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// Handler processes the messages of a subscription. Handlers run one at a
+// time, in the order messages arrive.
+type Handler func(Message)
+
+// Publisher publishes messages.
+type Publisher interface {
+	// Publish sends payload to topic with QoS 0 or 1, waiting for the broker
+	// to acknowledge QoS 1 messages. Retained messages are kept by the broker
+	// for future subscribers.
+	Publish(ctx context.Context, topic string, payload []byte, qos byte, retain bool) error
+}
+
+// MockPublisher logs messages instead of publishing them.
+type MockPublisher struct{}
+
+func NewMockPublisher() *MockPublisher {
+	return &MockPublisher{}
+}
+
+func (p *MockPublisher) Publish(ctx context.Context, topic string, payload []byte, qos byte, retain bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	slog.Info("Mock MQTT message published", "topic", topic, "bytes", len(payload), "qos", qos, "retain", retain)
+	return nil
+}
+
+// Options configure a Client.
+type Options struct {
+	// Broker is the broker URL: tcp://host:1883 or, for TLS, ssl://host:8883.
+	// The mqtt and mqtts schemes are accepted too.
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// KeepAlive is the longest the connection stays silent; defaults to 30s.
+	KeepAlive time.Duration
+}
+
+// DefaultKeepAlive is used when Options.KeepAlive is zero.
+const DefaultKeepAlive = 30 * time.Second
+
+// ErrNotConnected is returned by Publish while the client is not connected.
+var ErrNotConnected = errors.New("mqtt: not connected")
+
+// Packet types.
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+type subscription struct {
+	qos     byte
+	handler Handler
+}
+
+// Client is a connection to a broker, kept open by Run.
+type Client struct {
+	opts    Options
+	network string
+	address string
+	useTLS  bool
+
+	mu       sync.Mutex
+	subs     map[string]subscription
+	conn     net.Conn
+	nextID   uint16
+	inflight map[uint16]chan error
+
+	// writeMu serializes writes to conn.
+	writeMu sync.Mutex
+}
+
+// NewClient checks the options and returns a client that connects once Run
+// is called.
+func NewClient(opts Options) (*Client, error) {
+	u, err := url.Parse(opts.Broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("mqtt: broker %q is not a URL like tcp://host:1883", opts.Broker)
+	}
+	c := &Client{opts: opts, network: "tcp", address: u.Host, subs: make(map[string]subscription),
+		inflight: make(map[uint16]chan error)}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		if u.Port() == "" {
+			c.address = net.JoinHostPort(u.Hostname(), "1883")
+		}
+	case "ssl", "tls", "mqtts":
+		c.useTLS = true
+		if u.Port() == "" {
+			c.address = net.JoinHostPort(u.Hostname(), "8883")
+		}
+	default:
+		return nil, fmt.Errorf("mqtt: unsupported broker scheme %q", u.Scheme)
+	}
+	if c.opts.KeepAlive <= 0 {
+		c.opts.KeepAlive = DefaultKeepAlive
+	}
+	if c.opts.ClientID == "" {
+		c.opts.ClientID = fmt.Sprintf("workflow-%d", time.Now().UnixNano())
+	}
+	return c, nil
+}
+
+// Subscribe registers handler for the messages on topics matching filter,
+// which may hold the + and # wildcards. It takes effect on the next
+// connection, or at once when connected.
+func (c *Client) Subscribe(filter string, qos byte, handler Handler) error {
+	if err := validFilter(filter); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.subs[filter] = subscription{qos: min(qos, 1), handler: handler}
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		return c.subscribe(conn, map[string]byte{filter: min(qos, 1)})
+	}
+	return nil
+}
+
+// Run keeps the client connected until ctx is done, reconnecting with
+// backoff, and dispatches the messages of its subscriptions.
+func (c *Client) Run(ctx context.Context) {
+	messages := make(chan Message, 64)
+	go c.dispatch(ctx, messages)
+
+	backoff := time.Second
+	for ctx.Err() == nil {
+		started := time.Now()
+		err := c.session(ctx, messages)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		slog.Warn("MQTT connection lost, reconnecting", "broker", c.opts.Broker, "error", err, "in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+func (c *Client) dispatch(ctx context.Context, messages <-chan Message) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-messages:
+			c.mu.Lock()
+			var handlers []Handler
+			for filter, s := range c.subs {
+				if Match(filter, m.Topic) {
+					handlers = append(handlers, s.handler)
+				}
+			}
+			c.mu.Unlock()
+			for _, h := range handlers {
+				h(m)
+			}
+		}
+	}
+}
+
+// session runs one connection until it fails or ctx is done.
+func (c *Client) session(ctx context.Context, messages chan<- Message) error {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if c.useTLS {
+		host, _, _ := net.SplitHostPort(c.address)
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}).DialContext(ctx, c.network, c.address)
+	} else {
+		conn, err = dialer.DialContext(ctx, c.network, c.address)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	if err := c.connect(conn, r); err != nil {
+		return err
+	}
+	slog.Info("MQTT connected", "broker", c.opts.Broker)
+
+	c.mu.Lock()
+	c.conn = conn
+	filters := make(map[string]byte, len(c.subs))
+	for f, s := range c.subs {
+		filters[f] = s.qos
+	}
+	c.mu.Unlock()
+	defer c.disconnected()
+
+	if len(filters) > 0 {
+		if err := c.subscribe(conn, filters); err != nil {
+			return err
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go c.keepAlive(ctx, conn, done)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(c.opts.KeepAlive * 3 / 2))
+		kind, flags, body, err := readPacket(r)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case packetPublish:
+			m, id, err := parsePublish(flags, body)
+			if err != nil {
+				return err
+			}
+			if flags>>1&3 == 1 {
+				if err := c.write(conn, packetPuback<<4, id16(id)); err != nil {
+					return err
+				}
+			}
+			select {
+			case messages <- m:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case packetPuback, packetSuback:
+			if len(body) < 2 {
+				return errors.New("mqtt: short acknowledgement")
+			}
+			var ackErr error
+			if kind == packetSuback && len(body) > 2 && body[len(body)-1] == 0x80 {
+				ackErr = errors.New("mqtt: broker refused the subscription")
+			}
+			c.ack(binary.BigEndian.Uint16(body), ackErr)
+		case packetPingresp:
+		default:
+			return fmt.Errorf("mqtt: unexpected packet type %d", kind)
+		}
+	}
+}
+
+func (c *Client) connect(conn net.Conn, r *bufio.Reader) error {
+	var flags byte = 0x02 // clean session
+	payload := appendString(nil, c.opts.ClientID)
+	if c.opts.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, c.opts.Username)
+		if c.opts.Password != "" {
+			flags |= 0x40
+			payload = appendString(payload, c.opts.Password)
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(c.opts.KeepAlive/time.Second))
+	body = append(body, payload...)
+	if err := c.write(conn, packetConnect<<4, body); err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	kind, _, ack, err := readPacket(r)
+	if err != nil {
+		return err
+	}
+	if kind != packetConnack || len(ack) < 2 {
+		return errors.New("mqtt: broker did not acknowledge the connection")
+	}
+	if ack[1] != 0 {
+		return fmt.Errorf("mqtt: broker refused the connection, code %d", ack[1])
+	}
+	return nil
+}
+
+func (c *Client) subscribe(conn net.Conn, filters map[string]byte) error {
+	id, acked := c.await()
+	body := id16(id)
+	for f, qos := range filters {
+		body = append(appendString(body, f), qos)
+	}
+	if err := c.write(conn, packetSubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+	// Acknowledgements arrive through the read loop, which may not run yet
+	// on connect; don't wait for them.
+	go func() {
+		select {
+		case err := <-acked:
+			if err != nil {
+				slog.Error("MQTT subscription failed", "error", err)
+			}
+		case <-time.After(c.opts.KeepAlive):
+		}
+	}()
+	return nil
+}
+
+func (c *Client) keepAlive(ctx context.Context, conn net.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(c.opts.KeepAlive * 3 / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.write(conn, packetDisconnect<<4, nil)
+			conn.Close()
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := c.write(conn, packetPingreq<<4, nil); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) disconnected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn = nil
+	for id, ch := range c.inflight {
+		ch <- ErrNotConnected
+		delete(c.inflight, id)
+	}
+}
+
+// await reserves a packet id and returns the channel its acknowledgement is
+// delivered on.
+func (c *Client) await() (uint16, chan error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	ch := make(chan error, 1)
+	c.inflight[c.nextID] = ch
+	return c.nextID, ch
+}
+
+func (c *Client) ack(id uint16, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ch, ok := c.inflight[id]; ok {
+		ch <- err
+		delete(c.inflight, id)
+	}
+}
+
+func (c *Client) Publish(ctx context.Context, topic string, payload []byte, qos byte, retain bool) error {
+	if topic == "" || strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("mqtt: %q is not a topic to publish to", topic)
+	}
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	header := byte(packetPublish << 4)
+	if retain {
+		header |= 0x01
+	}
+	body := appendString(nil, topic)
+	var acked chan error
+	if qos > 0 {
+		var id uint16
+		id, acked = c.await()
+		header |= 0x02
+		body = append(body, id16(id)...)
+	}
+	body = append(body, payload...)
+	if err := c.write(conn, header, body); err != nil {
+		return err
+	}
+	if acked == nil {
+		return nil
+	}
+	select {
+	case err := <-acked:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) write(conn net.Conn, header byte, body []byte) error {
+	packet := append([]byte{header}, appendLength(nil, len(body))...)
+	packet = append(packet, body...)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := conn.Write(packet)
+	return err
+}
+
+// Match reports whether topic matches filter, in which + matches one level
+// and a trailing # any number of levels.
+func Match(filter, topic string) bool {
+	fs, ts := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) || (f != "+" && f != ts[i]) {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
+
+func validFilter(filter string) error {
+	levels := strings.Split(filter, "/")
+	for i, l := range levels {
+		if filter == "" || (strings.Contains(l, "#") && (l != "#" || i != len(levels)-1)) ||
+			(strings.Contains(l, "+") && l != "+") {
+			return fmt.Errorf("mqtt: invalid topic filter %q", filter)
+		}
+	}
+	return nil
+}
+
+func readPacket(r *bufio.Reader) (kind, flags byte, body []byte, err error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	length, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, 0, nil, errors.New("mqtt: malformed packet length")
+		}
+	}
+	body = make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return first >> 4, first & 0x0f, body, nil
+}
+
+func parsePublish(flags byte, body []byte) (Message, uint16, error) {
+	if len(body) < 2 {
+		return Message{}, 0, errors.New("mqtt: short publish packet")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return Message{}, 0, errors.New("mqtt: short publish packet")
+	}
+	m := Message{Topic: string(body[2 : 2+n])}
+	rest := body[2+n:]
+	var id uint16
+	if flags>>1&3 > 0 {
+		if len(rest) < 2 {
+			return Message{}, 0, errors.New("mqtt: short publish packet")
+		}
+		id, rest = binary.BigEndian.Uint16(rest), rest[2:]
+	}
+	m.Payload = rest
+	return m, id, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func appendLength(b []byte, n int) []byte {
+	for {
+		d := byte(n % 128)
+		if n /= 128; n > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func id16(id uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, id)
+}
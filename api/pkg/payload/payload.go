@@ -0,0 +1,171 @@
+// Package payload decodes the bodies providers post to webhooks into the
+// generic shapes JSON decodes to, so JSONPath expressions can address them
+// whatever their content type.
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"strings"
+)
+
+// Content types Decode understands.
+const (
+	JSON = "json"
+	Form = "form"
+	XML  = "xml"
+)
+
+// ContentTypes lists the content types Decode understands.
+var ContentTypes = []string{JSON, Form, XML}
+
+// ErrUnsupported is returned for media types Decode has no decoder for.
+var ErrUnsupported = errors.New("unsupported content type")
+
+// Kind maps a Content-Type header to one of the content types, e.g.
+// "application/x-www-form-urlencoded; charset=utf-8" or "multipart/form-data"
+// to Form.
+func Kind(header string) (string, error) {
+	media, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "", fmt.Errorf("%w %q", ErrUnsupported, header)
+	}
+	switch {
+	case media == "application/json" || strings.HasSuffix(media, "+json"):
+		return JSON, nil
+	case media == "application/x-www-form-urlencoded" || media == "multipart/form-data":
+		return Form, nil
+	case media == "application/xml" || media == "text/xml" || strings.HasSuffix(media, "+xml"):
+		return XML, nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnsupported, media)
+}
+
+// Decode decodes body of the given content type; header is the Content-Type
+// it was sent with, which carries the boundary of multipart forms. Form fields
+// become members holding a string, or an array of strings when repeated;
+// uploaded files are left out. An XML document becomes an object with its
+// root element as only member; see decodeXML.
+func Decode(kind, header string, body []byte) (any, error) {
+	switch kind {
+	case JSON:
+		var doc any
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		return doc, nil
+	case Form:
+		values, err := decodeForm(header, body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid form body: %w", err)
+		}
+		doc := make(map[string]any, len(values))
+		for k, vs := range values {
+			if len(vs) == 1 {
+				doc[k] = vs[0]
+				continue
+			}
+			list := make([]any, len(vs))
+			for i, v := range vs {
+				list[i] = v
+			}
+			doc[k] = list
+		}
+		return doc, nil
+	case XML:
+		return decodeXML(body)
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnsupported, kind)
+}
+
+func decodeForm(header string, body []byte) (url.Values, error) {
+	media, params, _ := mime.ParseMediaType(header)
+	if media != "multipart/form-data" {
+		return url.ParseQuery(string(body))
+	}
+	form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	defer form.RemoveAll()
+	return form.Value, nil
+}
+
+// xmlElement collects an element's attributes, children and text while
+// decoding.
+type xmlElement struct {
+	name     string
+	members  map[string]any
+	children map[string]int
+	text     strings.Builder
+}
+
+// decodeXML converts an XML document to objects: an element with neither
+// attributes nor child elements becomes its trimmed text, others an object of
+// its attributes, prefixed "@", and child elements by local name. Repeated
+// children become arrays, and the text of mixed elements is kept as "#text".
+func decodeXML(body []byte) (any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	var stack []*xmlElement
+	var root any
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			el := &xmlElement{name: t.Name.Local, members: make(map[string]any), children: make(map[string]int)}
+			for _, a := range t.Attr {
+				el.members["@"+a.Name.Local] = a.Value
+			}
+			stack = append(stack, el)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		case xml.EndElement:
+			el := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			value := el.value()
+			if len(stack) == 0 {
+				root = map[string]any{el.name: value}
+				continue
+			}
+			parent := stack[len(stack)-1]
+			switch parent.children[el.name]++; parent.children[el.name] {
+			case 1:
+				parent.members[el.name] = value
+			case 2:
+				parent.members[el.name] = []any{parent.members[el.name], value}
+			default:
+				parent.members[el.name] = append(parent.members[el.name].([]any), value)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("invalid XML: no root element")
+	}
+	return root, nil
+}
+
+func (el *xmlElement) value() any {
+	text := strings.TrimSpace(el.text.String())
+	if len(el.members) == 0 {
+		return text
+	}
+	if text != "" {
+		el.members["#text"] = text
+	}
+	return el.members
+}
@@ -0,0 +1,122 @@
+// Package report renders the steps of a run as an execution report, in JSON
+// or as an HTML page, e.g. to attach to the email that tells stakeholders a
+// workflow finished.
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"time"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// Formats reports can be rendered in.
+const (
+	FormatJSON = "json"
+	FormatHTML = "html"
+)
+
+// Report summarizes the steps of a run so far.
+type Report struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	StartedAt   time.Time `json:"startedAt,omitzero"`
+	Status      string    `json:"status"`
+	Steps       []Step    `json:"steps"`
+}
+
+// Step is one step of a Report, shaped like the steps of the executions
+// API.
+type Step struct {
+	NodeID       string         `json:"nodeId"`
+	Type         string         `json:"type"`
+	Label        string         `json:"label"`
+	Description  string         `json:"description"`
+	Status       string         `json:"status"`
+	Output       map[string]any `json:"output,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	StartedAt    time.Time      `json:"startedAt"`
+	DurationMs   int64          `json:"durationMs"`
+	Compensation bool           `json:"compensation,omitempty"`
+}
+
+// New reports on steps. Its status is "failed" if a step failed and
+// "completed" otherwise.
+func New(steps []engine.ExecutionStep, now time.Time) *Report {
+	r := &Report{GeneratedAt: now, Status: string(engine.ExecutionStatusCompleted), Steps: make([]Step, len(steps))}
+	for i, s := range steps {
+		r.Steps[i] = Step{
+			NodeID:       s.NodeID,
+			Type:         s.NodeType,
+			Label:        s.Label,
+			Description:  s.Description,
+			Status:       string(s.Status),
+			Output:       s.Output,
+			Error:        s.Error,
+			StartedAt:    s.StartedAt,
+			DurationMs:   s.FinishedAt.Sub(s.StartedAt).Milliseconds(),
+			Compensation: s.Compensation,
+		}
+		if s.Status.Failed() {
+			r.Status = string(engine.ExecutionStatusFailed)
+		}
+	}
+	if len(steps) > 0 {
+		r.StartedAt = steps[0].StartedAt
+	}
+	return r
+}
+
+// Render returns the report in format, with the file name and content type
+// to attach it under.
+func (r *Report) Render(format string) (filename, contentType string, content []byte, err error) {
+	switch format {
+	case FormatJSON:
+		content, err = json.MarshalIndent(r, "", "  ")
+		return "execution-report.json", "application/json", content, err
+	case FormatHTML:
+		var b bytes.Buffer
+		err = page.Execute(&b, r)
+		return "execution-report.html", "text/html; charset=utf-8", b.Bytes(), err
+	}
+	return "", "", nil, fmt.Errorf("unknown report format %q", format)
+}
+
+var page = template.Must(template.New("report").Funcs(template.FuncMap{
+	"json": func(v any) string {
+		b, _ := json.MarshalIndent(v, "", "  ")
+		return string(b)
+	},
+	"time": func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Execution report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ccc; padding: 0.4em; text-align: left; vertical-align: top; }
+pre { margin: 0; white-space: pre-wrap; }
+.failed { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Execution report</h1>
+<p>Status: <strong class="{{.Status}}">{{.Status}}</strong>{{if not .StartedAt.IsZero}}, started {{time .StartedAt}}{{end}}, generated {{time .GeneratedAt}}.</p>
+<table>
+<tr><th>#</th><th>Node</th><th>Type</th><th>Status</th><th>Duration</th><th>Output</th></tr>
+{{range $i, $s := .Steps}}<tr>
+<td>{{$i}}</td>
+<td>{{$s.NodeID}}{{if $s.Label}} ({{$s.Label}}){{end}}{{if $s.Description}}<br>{{$s.Description}}{{end}}</td>
+<td>{{$s.Type}}{{if $s.Compensation}} (compensation){{end}}</td>
+<td class="{{$s.Status}}">{{$s.Status}}{{if $s.Error}}<br>{{$s.Error}}{{end}}</td>
+<td>{{$s.DurationMs}} ms</td>
+<td>{{if $s.Output}}<pre>{{json $s.Output}}</pre>{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,109 @@
+// Package saga calls the HTTP endpoints of the services taking part in a
+// saga: reserving a resource, then confirming the reservation or cancelling it
+// when a later step fails.
+package saga
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"workflow-code-test/api/pkg/errclass"
+)
+
+// Request is a call to a saga participant. Body, when set, is sent as JSON.
+type Request struct {
+	Method string
+	URL    string
+	Body   []byte
+}
+
+// Response is the answer of a participant. Body is the decoded JSON of the
+// response, or its text if it isn't JSON.
+type Response struct {
+	Status int
+	Body   any
+}
+
+// Client calls saga participants. Responses with a non-2xx status are
+// returned as errors.
+type Client interface {
+	Do(ctx context.Context, req Request) (Response, error)
+}
+
+// maxResponseSize limits the size of the responses read.
+const maxResponseSize = 1 << 20
+
+// HTTPClient calls participants over HTTP.
+type HTTPClient struct {
+	HTTPClient *http.Client
+}
+
+func NewHTTPClient() *HTTPClient {
+	return &HTTPClient{HTTPClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (c *HTTPClient) Do(ctx context.Context, r Request) (Response, error) {
+	var body io.Reader
+	if r.Body != nil {
+		body = bytes.NewReader(r.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, r.URL, body)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return Response{}, errclass.Call(fmt.Errorf("failed to call service: %w", err))
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg := raw[:min(len(raw), 512)]
+		return Response{}, errclass.Status(resp.StatusCode,
+			fmt.Errorf("service returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg)))
+	}
+
+	out := Response{Status: resp.StatusCode}
+	if len(bytes.TrimSpace(raw)) > 0 && json.Unmarshal(raw, &out.Body) != nil {
+		out.Body = string(raw)
+	}
+	return out, nil
+}
+
+// MockClient logs calls instead of making them. Every call is answered like
+// a reservation, with a fresh id: {"id": "rsv-…", "status": "ok"}.
+type MockClient struct{}
+
+func NewMockClient() *MockClient {
+	return &MockClient{}
+}
+
+func (c *MockClient) Do(ctx context.Context, r Request) (Response, error) {
+	if err := ctx.Err(); err != nil {
+		return Response{}, err
+	}
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return Response{}, err
+	}
+
+	slog.Info("Mock saga call", "method", r.Method, "url", r.URL, "bytes", len(r.Body))
+	return Response{Status: http.StatusOK, Body: map[string]any{"id": "rsv-" + hex.EncodeToString(b), "status": "ok"}}, nil
+}
@@ -0,0 +1,83 @@
+// Package sandbox serves outbound integration calls from deterministic fakes so
+// staging environments and demos run without internet access.
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultTemperature is reported by the sandbox weather client when no other
+// value is configured.
+const DefaultTemperature = 25.0
+
+// WeatherClient always reports the same temperature.
+type WeatherClient struct {
+	Temperature float64
+}
+
+func NewWeatherClient(temperature float64) *WeatherClient {
+	return &WeatherClient{Temperature: temperature}
+}
+
+func (c *WeatherClient) CurrentTemperature(ctx context.Context, lat, lon float64) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if t, ok := ctx.Value(temperatureKey{}).(float64); ok {
+		return t, nil
+	}
+	return c.Temperature, nil
+}
+
+type temperatureKey struct{}
+
+// WithTemperature makes sandbox weather clients report temperature for the
+// calls made with ctx instead of their own, e.g. to simulate a run at a
+// given temperature.
+func WithTemperature(ctx context.Context, temperature float64) context.Context {
+	return context.WithValue(ctx, temperatureKey{}, temperature)
+}
+
+// Transport is an http.RoundTripper that answers every request with a fixture
+// file instead of calling the network. A request for
+// https://api.open-meteo.com/v1/forecast?... is served from
+// <Dir>/api.open-meteo.com/v1/forecast.json; the query string is ignored.
+type Transport struct {
+	Dir string
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := FixturePath(t.Dir, req)
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: no fixture for %s %s: %w", req.Method, req.URL.Host+req.URL.Path, err)
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// FixturePath returns the file Transport reads for req.
+func FixturePath(dir string, req *http.Request) string {
+	p := strings.Trim(req.URL.Path, "/")
+	if p == "" {
+		p = "index"
+	}
+	return filepath.Join(dir, req.URL.Host, filepath.FromSlash(p)+".json")
+}
@@ -0,0 +1,67 @@
+package sharelink_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"workflow-code-test/api/pkg/sharelink"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour)
+	signer := sharelink.NewSigner([]byte("secret"))
+	sig := signer.Sign("exec-1", expires)
+
+	tampered := []byte(sig)
+	tampered[0] ^= 1
+
+	tests := []struct {
+		name      string
+		signer    *sharelink.Signer
+		id        string
+		expires   int64
+		signature string
+		now       time.Time
+		want      error
+	}{
+		{"valid", signer, "exec-1", expires.Unix(), sig, now, nil},
+		{"valid at expiry", signer, "exec-1", expires.Unix(), sig, expires, nil},
+		{"expired", signer, "exec-1", expires.Unix(), sig, expires.Add(time.Second), sharelink.ErrExpired},
+		{"tampered signature", signer, "exec-1", expires.Unix(), string(tampered), now, sharelink.ErrInvalidSignature},
+		{"signature not base64", signer, "exec-1", expires.Unix(), "not*base64", now, sharelink.ErrInvalidSignature},
+		{"other id", signer, "exec-2", expires.Unix(), sig, now, sharelink.ErrInvalidSignature},
+		{"extended expiry", signer, "exec-1", expires.Add(24 * time.Hour).Unix(), sig, now, sharelink.ErrInvalidSignature},
+		{"wrong secret", sharelink.NewSigner([]byte("other secret")), "exec-1", expires.Unix(), sig, now, sharelink.ErrInvalidSignature},
+		// A bad signature is reported even once the link has expired.
+		{"expired wrong secret", sharelink.NewSigner([]byte("other secret")), "exec-1", expires.Unix(), sig, expires.Add(time.Hour), sharelink.ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.signer.Verify(tt.id, tt.expires, tt.signature, tt.now)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRandomSigners(t *testing.T) {
+	a, err := sharelink.NewRandomSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := sharelink.NewRandomSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour)
+	sig := a.Sign("exec-1", expires)
+	if err := a.Verify("exec-1", expires.Unix(), sig, time.Now()); err != nil {
+		t.Errorf("signer rejects its own link: %v", err)
+	}
+	if err := b.Verify("exec-1", expires.Unix(), sig, time.Now()); !errors.Is(err, sharelink.ErrInvalidSignature) {
+		t.Errorf("another random signer accepts the link: %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+// Package sheets appends rows to Google Sheets with a service account.
+package sheets
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"workflow-code-test/api/pkg/errclass"
+)
+
+// Appended describes the row written by Append.
+type Appended struct {
+	// Range is the A1 range the row was written to, e.g. "Alerts!A12:D12".
+	Range string `json:"range"`
+}
+
+// Client appends rows to spreadsheets.
+type Client interface {
+	// Append adds a row of values after the table in rng of the spreadsheet,
+	// e.g. "Alerts" or "Alerts!A:D". Values are parsed as if typed into the
+	// sheet, so numbers and dates keep their type.
+	Append(ctx context.Context, spreadsheetID, rng string, values []any) (Appended, error)
+}
+
+// MockClient logs rows instead of writing them.
+type MockClient struct{}
+
+func NewMockClient() *MockClient {
+	return &MockClient{}
+}
+
+func (c *MockClient) Append(ctx context.Context, spreadsheetID, rng string, values []any) (Appended, error) {
+	if err := ctx.Err(); err != nil {
+		return Appended{}, err
+	}
+	slog.Info("Mock sheet row appended", "spreadsheetId", spreadsheetID, "range", rng, "values", len(values))
+	return Appended{Range: rng}, nil
+}
+
+const (
+	sheetsBaseURL = "https://sheets.googleapis.com/v4/spreadsheets"
+	sheetsScope   = "https://www.googleapis.com/auth/spreadsheets"
+)
+
+// ServiceAccount is the part of a Google service account key file used to
+// authenticate.
+type ServiceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// GoogleClient appends rows through the Sheets API, authenticating as a
+// service account. The sheets must be shared with the account's email.
+type GoogleClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	account ServiceAccount
+	key     *rsa.PrivateKey
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// LoadServiceAccount reads a service account key file, as downloaded from
+// the Google Cloud console.
+func LoadServiceAccount(path string) (*GoogleClient, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var account ServiceAccount
+	if err := json.Unmarshal(raw, &account); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c, err := NewGoogleClient(account)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+func NewGoogleClient(account ServiceAccount) (*GoogleClient, error) {
+	if account.ClientEmail == "" || account.TokenURI == "" {
+		return nil, errors.New("service account needs client_email and token_uri")
+	}
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("service account private_key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("service account private_key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("service account private_key is not an RSA key")
+	}
+	return &GoogleClient{
+		BaseURL:    sheetsBaseURL,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		account:    account,
+		key:        key,
+	}, nil
+}
+
+func (c *GoogleClient) Append(ctx context.Context, spreadsheetID, rng string, values []any) (Appended, error) {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return Appended{}, fmt.Errorf("failed to authenticate to Google: %w", err)
+	}
+
+	raw, err := json.Marshal(map[string]any{"values": [][]any{values}})
+	if err != nil {
+		return Appended{}, err
+	}
+	u := c.BaseURL + "/" + url.PathEscape(spreadsheetID) + "/values/" + url.PathEscape(rng) +
+		":append?valueInputOption=USER_ENTERED&insertDataOption=INSERT_ROWS"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(raw))
+	if err != nil {
+		return Appended{}, fmt.Errorf("failed to build sheets request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return Appended{}, errclass.Call(fmt.Errorf("failed to call sheets API: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return Appended{}, errclass.Status(resp.StatusCode,
+			fmt.Errorf("sheets API returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg)))
+	}
+
+	var body struct {
+		Updates struct {
+			UpdatedRange string `json:"updatedRange"`
+		} `json:"updates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Appended{}, fmt.Errorf("failed to decode sheets response: %w", err)
+	}
+	return Appended{Range: body.Updates.UpdatedRange}, nil
+}
+
+// accessToken returns an OAuth token for the service account, exchanging a
+// signed JWT for a new one shortly before the current one expires.
+func (c *GoogleClient) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.token != "" && now.Add(time.Minute).Before(c.expires) {
+		return c.token, nil
+	}
+
+	assertion, err := c.signJWT(now)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", errclass.Call(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errclass.Status(resp.StatusCode, fmt.Errorf("token endpoint returned status %d", resp.StatusCode))
+	}
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	c.token, c.expires = body.AccessToken, now.Add(time.Duration(body.ExpiresIn)*time.Second)
+	return c.token, nil
+}
+
+// signJWT returns the RS256-signed assertion requesting the Sheets scope.
+func (c *GoogleClient) signJWT(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": c.account.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss":   c.account.ClientEmail,
+		"scope": sheetsScope,
+		"aud":   c.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
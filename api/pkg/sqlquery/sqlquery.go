@@ -0,0 +1,192 @@
+// Package sqlquery runs named, read-only SQL queries defined by administrators,
+// so workflows can read data already in the database without writing SQL.
+package sqlquery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gopkg.in/yaml.v3"
+
+	"workflow-code-test/api/pkg/db"
+)
+
+// Defaults of queries that don't set their limits.
+const (
+	DefaultMaxRows = 100
+	DefaultTimeout = 5 * time.Second
+)
+
+var ErrUnknownQuery = errors.New("unknown query")
+
+// Query is a named SQL statement. Its parameters are bound to $1, $2, ... in
+// the order they are listed.
+type Query struct {
+	SQL     string        `yaml:"sql"`
+	Params  []string      `yaml:"params"`
+	MaxRows int           `yaml:"maxRows"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// file is the format of a query catalog file.
+type file struct {
+	Queries map[string]Query `yaml:"queries"`
+}
+
+// Result is the rows a query returned, decoded as JSON values.
+type Result struct {
+	Rows []map[string]any
+	// Truncated is set when the query had more than MaxRows rows.
+	Truncated bool
+}
+
+// Runner runs named queries.
+type Runner interface {
+	// Query returns the query named name.
+	Query(name string) (Query, bool)
+	// Run executes the query named name with the parameter values in args.
+	Run(ctx context.Context, name string, args map[string]any) (*Result, error)
+}
+
+// Catalog runs the queries it was loaded with against a database. Each one
+// runs in a read-only transaction, so a query can't change data even if its
+// SQL tries to.
+type Catalog struct {
+	pool    *pgxpool.Pool
+	queries map[string]Query
+}
+
+var (
+	readStatement = regexp.MustCompile(`(?is)^\s*(select|with)\b`)
+	placeholder   = regexp.MustCompile(`\$(\d+)`)
+)
+
+// NewCatalog checks queries and returns a catalog running them on pool.
+func NewCatalog(pool *pgxpool.Pool, queries map[string]Query) (*Catalog, error) {
+	c := &Catalog{pool: pool, queries: make(map[string]Query, len(queries))}
+	for name, q := range queries {
+		if name == "" {
+			return nil, errors.New("query name is empty")
+		}
+		q.SQL = strings.TrimSuffix(strings.TrimSpace(q.SQL), ";")
+		if !readStatement.MatchString(q.SQL) || strings.Contains(q.SQL, ";") {
+			return nil, fmt.Errorf("query %s: must be a single SELECT statement", name)
+		}
+		for _, m := range placeholder.FindAllStringSubmatch(q.SQL, -1) {
+			if i, err := strconv.Atoi(m[1]); err != nil || i < 1 || i > len(q.Params) {
+				return nil, fmt.Errorf("query %s: %s has no parameter, %d are listed", name, m[0], len(q.Params))
+			}
+		}
+		if q.MaxRows == 0 {
+			q.MaxRows = DefaultMaxRows
+		}
+		if q.Timeout == 0 {
+			q.Timeout = DefaultTimeout
+		}
+		if q.MaxRows < 0 || q.Timeout < 0 {
+			return nil, fmt.Errorf("query %s: maxRows and timeout must be positive", name)
+		}
+		c.queries[name] = q
+	}
+	return c, nil
+}
+
+// LoadFile reads a YAML catalog such as
+//
+//	queries:
+//	  customer_by_email:
+//	    sql: SELECT name, tier FROM customers WHERE email = $1
+//	    params: [email]
+//	    maxRows: 1
+func LoadFile(path string, pool *pgxpool.Pool) (*Catalog, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := yaml.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c, err := NewCatalog(pool, f.Queries)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *Catalog) Query(name string) (Query, bool) {
+	q, ok := c.queries[name]
+	return q, ok
+}
+
+// Len returns the number of queries in the catalog.
+func (c *Catalog) Len() int {
+	return len(c.queries)
+}
+
+// Run binds missing parameters to NULL.
+func (c *Catalog) Run(ctx context.Context, name string, args map[string]any) (*Result, error) {
+	q, ok := c.queries[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownQuery, name)
+	}
+	values := make([]any, len(q.Params))
+	for i, p := range q.Params {
+		values[i] = args[p]
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, q.Timeout)
+	defer cancel()
+	var result Result
+	err := pgx.BeginTxFunc(ctx, c.pool, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, q.SQL, values...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		fields := rows.FieldDescriptions()
+		for rows.Next() {
+			if len(result.Rows) == q.MaxRows {
+				result.Truncated = true
+				break
+			}
+			vals, err := rows.Values()
+			if err != nil {
+				return err
+			}
+			row := make(map[string]any, len(fields))
+			for i, f := range fields {
+				row[f.Name] = vals[i]
+			}
+			result.Rows = append(result.Rows, row)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	// Rows hold driver types such as numerics and timestamps; state only
+	// holds JSON values.
+	raw, err := json.Marshal(result.Rows)
+	if err != nil {
+		return nil, err
+	}
+	result.Rows = nil
+	if err := json.Unmarshal(raw, &result.Rows); err != nil {
+		return nil, err
+	}
+	if result.Rows == nil {
+		result.Rows = []map[string]any{}
+	}
+	return &result, nil
+}
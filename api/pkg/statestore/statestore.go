@@ -0,0 +1,175 @@
+// Package statestore keeps counters and named values that outlive a single
+// execution, so workflows can count events or remember data across runs.
+package statestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"workflow-code-test/api/pkg/db"
+)
+
+// Store holds counters and values by key.
+type Store interface {
+	// Increment adds delta to a counter and returns its new value. A counter
+	// that doesn't exist or has expired starts from 0; with a positive ttl it
+	// expires that long after it started.
+	Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Counter returns the value of a counter, 0 if it doesn't exist or has
+	// expired.
+	Counter(ctx context.Context, key string) (int64, error)
+
+	// Get returns the value stored under key. It reports false if there is
+	// none.
+	Get(ctx context.Context, key string) (any, bool, error)
+	// Set stores a JSON value under key, replacing any previous one.
+	Set(ctx context.Context, key string, value any) error
+}
+
+type counter struct {
+	value   int64
+	expires time.Time
+}
+
+func (c counter) live(now time.Time) bool {
+	return c.expires.IsZero() || now.Before(c.expires)
+}
+
+// MemoryStore keeps counters and values in process.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]counter
+	values   map[string][]byte
+	now      func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]counter), values: make(map[string][]byte), now: time.Now}
+}
+
+func (s *MemoryStore) Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	c, ok := s.counters[key]
+	if !ok || !c.live(now) {
+		c = counter{}
+		if ttl > 0 {
+			c.expires = now.Add(ttl)
+		}
+	}
+	c.value += delta
+	s.counters[key] = c
+	return c.value, nil
+}
+
+func (s *MemoryStore) Counter(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.counters[key]; ok && c.live(s.now()) {
+		return c.value, nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (any, bool, error) {
+	s.mu.Lock()
+	raw, ok := s.values[key]
+	s.mu.Unlock()
+	if !ok {
+		return nil, false, nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, value any) error {
+	// Values are kept encoded so callers can't mutate them.
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = raw
+	return nil
+}
+
+// PostgresStore keeps counters and values in the state_counters and
+// state_values tables so they are shared by all API instances and survive
+// restarts.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+func (s *PostgresStore) Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	// An expired counter starts over from the inserted row.
+	var value int64
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO state_counters (key, value, expires_at)
+		VALUES ($1, $2, CASE WHEN $3 > 0 THEN now() + make_interval(secs => $3) END)
+		ON CONFLICT (key) DO UPDATE SET
+			value = CASE WHEN state_counters.expires_at <= now() THEN EXCLUDED.value
+				ELSE state_counters.value + EXCLUDED.value END,
+			expires_at = CASE WHEN state_counters.expires_at <= now() THEN EXCLUDED.expires_at
+				ELSE state_counters.expires_at END
+		RETURNING value`, key, delta, ttl.Seconds(),
+	).Scan(&value)
+	if err != nil {
+		return 0, db.Classify(err)
+	}
+	return value, nil
+}
+
+func (s *PostgresStore) Counter(ctx context.Context, key string) (int64, error) {
+	var value int64
+	err := s.pool.QueryRow(ctx, `
+		SELECT value FROM state_counters
+		WHERE key = $1 AND (expires_at IS NULL OR expires_at > now())`, key,
+	).Scan(&value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, db.Classify(err)
+	}
+	return value, nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (any, bool, error) {
+	var v any
+	err := s.pool.QueryRow(ctx, `SELECT value FROM state_values WHERE key = $1`, key).Scan(&v)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, db.Classify(err)
+	}
+	return v, true, nil
+}
+
+func (s *PostgresStore) Set(ctx context.Context, key string, value any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx, `
+		INSERT INTO state_values (key, value, updated_at)
+		VALUES ($1, $2, now())
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = EXCLUDED.updated_at`, key, raw)
+	return db.Classify(err)
+}
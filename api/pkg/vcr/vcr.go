@@ -0,0 +1,316 @@
+// Package vcr records outbound HTTP responses to fixture files and replays them
+// deterministically, so integration nodes can be tested end to end without
+// depending on live APIs.
+package vcr
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Mode selects whether a Transport talks to the network.
+type Mode string
+
+const (
+	// ModeRecord forwards requests and saves every response to a fixture.
+	ModeRecord Mode = "record"
+	// ModeReplay serves responses from fixtures and never calls the network.
+	ModeReplay Mode = "replay"
+)
+
+// ErrNoFixture is returned in replay mode for requests that were never
+// recorded.
+var ErrNoFixture = errors.New("vcr: no recorded fixture")
+
+// Fixture is the on-disk form of one recorded exchange.
+type Fixture struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// Transport is an http.RoundTripper that records or replays exchanges in Dir.
+// Fixtures are keyed by the request signature: method, URL with its query
+// parameters sorted and secret ones left out, and body.
+type Transport struct {
+	Mode Mode
+	Dir  string
+
+	// Next performs real requests in record mode. Defaults to
+	// http.DefaultTransport.
+	Next http.RoundTripper
+
+	// mu serializes updates of cassettes.
+	mu sync.Mutex
+}
+
+func NewTransport(mode Mode, dir string) (*Transport, error) {
+	if mode != ModeRecord && mode != ModeReplay {
+		return nil, fmt.Errorf("vcr: unknown mode %q, expected %q or %q", mode, ModeRecord, ModeReplay)
+	}
+	return &Transport{Mode: mode, Dir: dir}, nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("vcr: failed to read request body: %w", err)
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	name := fixtureName(req, body)
+	path := filepath.Join(t.Dir, name)
+
+	var resp *http.Response
+	var err error
+	if t.Mode == ModeReplay {
+		resp, err = t.replay(req, path)
+	} else {
+		resp, err = t.record(req, body, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cassette, ok := req.Context().Value(cassetteKey{}).(string); ok {
+		if err := t.addToCassette(cassette, name); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (t *Transport) replay(req *http.Request, path string) (*http.Response, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w for %s %s", ErrNoFixture, req.Method, req.URL.Redacted())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("vcr: failed to read fixture: %w", err)
+	}
+
+	var f Fixture
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("vcr: failed to decode fixture %s: %w", path, err)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Response.StatusCode, http.StatusText(f.Response.StatusCode)),
+		StatusCode:    f.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Response.Header,
+		Body:          io.NopCloser(strings.NewReader(f.Response.Body)),
+		ContentLength: int64(len(f.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *Transport) record(req *http.Request, body []byte, path string) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("vcr: failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	f := Fixture{
+		Request:  RecordedRequest{Method: req.Method, URL: scrub(req.URL).String(), Body: string(body)},
+		Response: RecordedResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: string(respBody)},
+	}
+	raw, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("vcr: failed to encode fixture: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("vcr: failed to create fixture dir: %w", err)
+	}
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		return nil, fmt.Errorf("vcr: failed to write fixture: %w", err)
+	}
+	return resp, nil
+}
+
+// fixtureName derives the fixture file for a request from its host and a hash
+// of its signature.
+func fixtureName(req *http.Request, body []byte) string {
+	u := scrub(req.URL)
+	u.Fragment = ""
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", req.Method, u.String())
+	h.Write(body)
+	return fmt.Sprintf("%s-%s.json", req.URL.Hostname(), hex.EncodeToString(h.Sum(nil))[:16])
+}
+
+// secretParams are query parameters holding credentials, e.g. Open-Meteo's
+// API key. They are left out of fixtures and their signatures, so fixtures
+// can be shared and replayed with another key.
+var secretParams = []string{"apikey"}
+
+// scrub returns a copy of u without secret parameters and with the others
+// sorted.
+func scrub(u *url.URL) *url.URL {
+	scrubbed := *u
+	q := u.Query()
+	for _, p := range secretParams {
+		q.Del(p)
+	}
+	scrubbed.RawQuery = q.Encode()
+	return &scrubbed
+}
+
+type cassetteKey struct{}
+
+// WithCassette makes the requests sent with ctx list their fixtures in the
+// cassette called name, e.g. after the execution that sent them, so they can
+// be read back together with Transport.Cassette.
+func WithCassette(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, cassetteKey{}, name)
+}
+
+// cassettePath returns the file listing the fixtures of the cassette name.
+func (t *Transport) cassettePath(name string) (string, error) {
+	if name == "" || filepath.Base(name) != name {
+		return "", fmt.Errorf("vcr: invalid cassette name %q", name)
+	}
+	return filepath.Join(t.Dir, "cassettes", name+".json"), nil
+}
+
+// readCassette returns the fixture names listed in the cassette at path.
+func readCassette(path string) ([]string, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("vcr: failed to read cassette: %w", err)
+	}
+	var names []string
+	if err := json.Unmarshal(raw, &names); err != nil {
+		return nil, fmt.Errorf("vcr: failed to decode cassette %s: %w", path, err)
+	}
+	return names, nil
+}
+
+func (t *Transport) addToCassette(cassette string, fixtures ...string) error {
+	path, err := t.cassettePath(cassette)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names, err := readCassette(path)
+	if err != nil {
+		return err
+	}
+	for _, name := range fixtures {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	raw, err := json.Marshal(names)
+	if err != nil {
+		return fmt.Errorf("vcr: failed to encode cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("vcr: failed to create cassette dir: %w", err)
+	}
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		return fmt.Errorf("vcr: failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// Cassette returns the fixtures listed in the cassette name, keyed by file
+// name. A cassette nothing was recorded to is empty.
+func (t *Transport) Cassette(name string) (map[string][]byte, error) {
+	path, err := t.cassettePath(name)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	names, err := readCassette(path)
+	t.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	fixtures := make(map[string][]byte, len(names))
+	for _, n := range names {
+		raw, err := os.ReadFile(filepath.Join(t.Dir, n))
+		if errors.Is(err, os.ErrNotExist) {
+			continue // deleted since
+		}
+		if err != nil {
+			return nil, fmt.Errorf("vcr: failed to read fixture: %w", err)
+		}
+		fixtures[n] = raw
+	}
+	return fixtures, nil
+}
+
+// AddCassette stores fixtures, keyed by file name as Cassette returns them,
+// and lists them in the cassette name. A fixture replaces the one of the
+// same name, which answers the same request.
+func (t *Transport) AddCassette(name string, fixtures map[string][]byte) error {
+	if _, err := t.cassettePath(name); err != nil {
+		return err
+	}
+	for n, raw := range fixtures {
+		if filepath.Base(n) != n || filepath.Ext(n) != ".json" {
+			return fmt.Errorf("vcr: invalid fixture name %q", n)
+		}
+		var f Fixture
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return fmt.Errorf("vcr: failed to decode fixture %s: %w", n, err)
+		}
+	}
+
+	if err := os.MkdirAll(t.Dir, 0o755); err != nil {
+		return fmt.Errorf("vcr: failed to create fixture dir: %w", err)
+	}
+	for n, raw := range fixtures {
+		if err := os.WriteFile(filepath.Join(t.Dir, n), raw, 0o644); err != nil {
+			return fmt.Errorf("vcr: failed to write fixture: %w", err)
+		}
+	}
+	return t.addToCassette(name, slices.Sorted(maps.Keys(fixtures))...)
+}
@@ -0,0 +1,373 @@
+package weather
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"workflow-code-test/api/pkg/db"
+)
+
+// Catalog keeps the cities the integration node can look up. A city is
+// identified by its name, matched ignoring case and surrounding space, and its
+// country. Missing cities are reported as db.ErrNotFound and duplicates as
+// db.ErrConflict.
+type Catalog interface {
+	// ListCities returns every city, disabled ones included, sorted by name
+	// and country.
+	ListCities(ctx context.Context) ([]City, error)
+	GetCity(ctx context.Context, name, country string) (City, error)
+	CreateCity(ctx context.Context, city City) error
+	// UpdateCity replaces the city of the same name and country.
+	UpdateCity(ctx context.Context, city City) error
+	DeleteCity(ctx context.Context, name, country string) error
+}
+
+// ErrAmbiguousCity is returned by ResolveCity for a name that cities in
+// several countries have.
+var ErrAmbiguousCity = errors.New("ambiguous city")
+
+// ResolveCity finds the enabled city of the catalog a user named. query is a
+// city name, optionally followed by a comma and a country code
+// ("Melbourne, US"), or a place ID ("geonames:4163971"). country, if set,
+// picks among cities of the same name when query has no code. It reports
+// false if no city matches.
+func ResolveCity(ctx context.Context, catalog Catalog, query, country string) (City, bool, error) {
+	cities, err := catalog.ListCities(ctx)
+	if err != nil {
+		return City{}, false, err
+	}
+	matches := MatchCities(cities, query, country)
+	matches = slices.DeleteFunc(matches, func(c City) bool { return !c.Enabled })
+	switch len(matches) {
+	case 0:
+		return City{}, false, nil
+	case 1:
+		return matches[0], true, nil
+	}
+	names := make([]string, len(matches))
+	for i, c := range matches {
+		names[i] = c.String()
+	}
+	return City{}, false, fmt.Errorf("%w %q: one of %s", ErrAmbiguousCity, query, strings.Join(names, "; "))
+}
+
+// MatchCities returns the cities a query names, as described for ResolveCity,
+// whether enabled or not.
+func MatchCities(cities []City, query, country string) []City {
+	query = strings.TrimSpace(query)
+	if isPlaceID(query) {
+		return slices.DeleteFunc(slices.Clone(cities), func(c City) bool { return !strings.EqualFold(c.PlaceID, query) })
+	}
+	name := query
+	if i := strings.LastIndex(query, ","); i >= 0 && isCountryCode(strings.TrimSpace(query[i+1:])) {
+		name, country = query[:i], strings.TrimSpace(query[i+1:])
+	}
+	return slices.DeleteFunc(slices.Clone(cities), func(c City) bool {
+		return cityKey(c.Name) != cityKey(name) || (country != "" && !strings.EqualFold(c.Country, country))
+	})
+}
+
+// isPlaceID reports whether s looks like a place ID, a geocoder name and an
+// id separated by a colon.
+func isPlaceID(s string) bool {
+	source, id, ok := strings.Cut(s, ":")
+	return ok && source != "" && id != "" && !strings.ContainsAny(source, " ,")
+}
+
+func isCountryCode(s string) bool {
+	return len(s) == 2 && strings.Trim(strings.ToUpper(s), "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == ""
+}
+
+// Validate checks that the city has a name, coordinates in range and, if set,
+// a two-letter country code and a known time zone.
+func (c City) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("name is required")
+	}
+	if strings.Contains(c.Name, ",") || isPlaceID(c.Name) {
+		return fmt.Errorf("name %q must not contain a comma or look like a place ID", c.Name)
+	}
+	if c.Country != "" && !isCountryCode(c.Country) {
+		return fmt.Errorf("country %q must be an ISO 3166-1 alpha-2 code, e.g. AU", c.Country)
+	}
+	if c.PlaceID != "" && !isPlaceID(c.PlaceID) {
+		return fmt.Errorf("placeId %q must look like source:id, e.g. geonames:2158177", c.PlaceID)
+	}
+	if c.Lat < -90 || c.Lat > 90 || c.Lon < -180 || c.Lon > 180 {
+		return fmt.Errorf("coordinates %v,%v out of range", c.Lat, c.Lon)
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", c.Timezone)
+		}
+	}
+	return nil
+}
+
+func cityKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// catalogKey identifies a city in a catalog.
+func catalogKey(name, country string) string {
+	return cityKey(name) + "," + strings.ToUpper(country)
+}
+
+func sortCities(cities []City) {
+	slices.SortFunc(cities, func(a, b City) int {
+		return cmp.Or(strings.Compare(cityKey(a.Name), cityKey(b.Name)), strings.Compare(a.Country, b.Country))
+	})
+}
+
+// notFound reports a missing city.
+func notFound(name, country string) error {
+	return fmt.Errorf("%w: city %q", db.ErrNotFound, City{Name: name, Country: country}.String())
+}
+
+// MemoryCatalog keeps cities in process.
+type MemoryCatalog struct {
+	mu     sync.RWMutex
+	cities map[string]City
+}
+
+// NewMemoryCatalog returns a catalog of the given cities.
+func NewMemoryCatalog(cities ...City) *MemoryCatalog {
+	c := &MemoryCatalog{cities: make(map[string]City, len(cities))}
+	for _, city := range cities {
+		c.cities[catalogKey(city.Name, city.Country)] = city
+	}
+	return c
+}
+
+func (c *MemoryCatalog) ListCities(ctx context.Context) ([]City, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cities := slices.Collect(maps.Values(c.cities))
+	sortCities(cities)
+	return cities, nil
+}
+
+func (c *MemoryCatalog) GetCity(ctx context.Context, name, country string) (City, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	city, ok := c.cities[catalogKey(name, country)]
+	if !ok {
+		return City{}, notFound(name, country)
+	}
+	return city, nil
+}
+
+func (c *MemoryCatalog) CreateCity(ctx context.Context, city City) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := catalogKey(city.Name, city.Country)
+	if _, ok := c.cities[key]; ok {
+		return fmt.Errorf("%w: city %q already exists", db.ErrConflict, city.String())
+	}
+	for _, other := range c.cities {
+		if city.PlaceID != "" && strings.EqualFold(other.PlaceID, city.PlaceID) {
+			return fmt.Errorf("%w: place %s is already %q", db.ErrConflict, city.PlaceID, other.String())
+		}
+	}
+	c.cities[key] = city
+	return nil
+}
+
+func (c *MemoryCatalog) UpdateCity(ctx context.Context, city City) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := catalogKey(city.Name, city.Country)
+	if _, ok := c.cities[key]; !ok {
+		return notFound(city.Name, city.Country)
+	}
+	for k, other := range c.cities {
+		if k != key && city.PlaceID != "" && strings.EqualFold(other.PlaceID, city.PlaceID) {
+			return fmt.Errorf("%w: place %s is already %q", db.ErrConflict, city.PlaceID, other.String())
+		}
+	}
+	c.cities[key] = city
+	return nil
+}
+
+func (c *MemoryCatalog) DeleteCity(ctx context.Context, name, country string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := catalogKey(name, country)
+	if _, ok := c.cities[key]; !ok {
+		return notFound(name, country)
+	}
+	delete(c.cities, key)
+	return nil
+}
+
+// PostgresCatalog keeps cities in the cities table, so operators can add
+// them without a deploy.
+type PostgresCatalog struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresCatalog(pool *pgxpool.Pool) *PostgresCatalog {
+	return &PostgresCatalog{pool: pool}
+}
+
+func (c *PostgresCatalog) ListCities(ctx context.Context) ([]City, error) {
+	rows, err := c.pool.Query(ctx, `
+		SELECT name, country, lat, lon, timezone, place_id, enabled FROM cities ORDER BY lower(name), country`)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	cities, err := pgx.CollectRows(rows, scanCity)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return cities, nil
+}
+
+func scanCity(row pgx.CollectableRow) (City, error) {
+	var city City
+	err := row.Scan(&city.Name, &city.Country, &city.Lat, &city.Lon, &city.Timezone, &city.PlaceID, &city.Enabled)
+	return city, err
+}
+
+func (c *PostgresCatalog) GetCity(ctx context.Context, name, country string) (City, error) {
+	rows, err := c.pool.Query(ctx, `
+		SELECT name, country, lat, lon, timezone, place_id, enabled FROM cities
+		WHERE lower(name) = $1 AND country = $2`, cityKey(name), strings.ToUpper(country))
+	if err != nil {
+		return City{}, db.Classify(err)
+	}
+	city, err := pgx.CollectExactlyOneRow(rows, scanCity)
+	if err != nil {
+		return City{}, db.Classify(err)
+	}
+	return city, nil
+}
+
+func (c *PostgresCatalog) CreateCity(ctx context.Context, city City) error {
+	_, err := c.pool.Exec(ctx, `
+		INSERT INTO cities (name, country, lat, lon, timezone, place_id, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		strings.TrimSpace(city.Name), strings.ToUpper(city.Country), city.Lat, city.Lon, city.Timezone, city.PlaceID, city.Enabled)
+	return db.Classify(err)
+}
+
+func (c *PostgresCatalog) UpdateCity(ctx context.Context, city City) error {
+	tag, err := c.pool.Exec(ctx, `
+		UPDATE cities SET name = $3, lat = $4, lon = $5, timezone = $6, place_id = $7, enabled = $8, updated_at = now()
+		WHERE lower(name) = $1 AND country = $2`,
+		cityKey(city.Name), strings.ToUpper(city.Country), strings.TrimSpace(city.Name),
+		city.Lat, city.Lon, city.Timezone, city.PlaceID, city.Enabled)
+	if err != nil {
+		return db.Classify(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound(city.Name, city.Country)
+	}
+	return nil
+}
+
+func (c *PostgresCatalog) DeleteCity(ctx context.Context, name, country string) error {
+	tag, err := c.pool.Exec(ctx, `DELETE FROM cities WHERE lower(name) = $1 AND country = $2`,
+		cityKey(name), strings.ToUpper(country))
+	if err != nil {
+		return db.Classify(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound(name, country)
+	}
+	return nil
+}
+
+// DefaultCatalogTTL is how long a CachedCatalog serves cities before it
+// reloads them.
+const DefaultCatalogTTL = 30 * time.Second
+
+// CachedCatalog serves the cities of another catalog from memory, reloading
+// them once they are older than its ttl. Changes made through it take effect
+// at once; changes made by other API instances within the ttl.
+type CachedCatalog struct {
+	next Catalog
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu       sync.Mutex
+	cities   map[string]City
+	loadedAt time.Time
+}
+
+func NewCachedCatalog(next Catalog, ttl time.Duration) *CachedCatalog {
+	return &CachedCatalog{next: next, ttl: ttl, now: time.Now}
+}
+
+// load returns the cached cities, reloading them if they are stale.
+func (c *CachedCatalog) load(ctx context.Context) (map[string]City, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cities != nil && c.now().Sub(c.loadedAt) < c.ttl {
+		return c.cities, nil
+	}
+	list, err := c.next.ListCities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.cities = make(map[string]City, len(list))
+	for _, city := range list {
+		c.cities[catalogKey(city.Name, city.Country)] = city
+	}
+	c.loadedAt = c.now()
+	return c.cities, nil
+}
+
+// invalidate drops the cache after a change.
+func (c *CachedCatalog) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cities = nil
+}
+
+func (c *CachedCatalog) ListCities(ctx context.Context) ([]City, error) {
+	cities, err := c.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := slices.Collect(maps.Values(cities))
+	sortCities(list)
+	return list, nil
+}
+
+func (c *CachedCatalog) GetCity(ctx context.Context, name, country string) (City, error) {
+	cities, err := c.load(ctx)
+	if err != nil {
+		return City{}, err
+	}
+	city, ok := cities[catalogKey(name, country)]
+	if !ok {
+		return City{}, notFound(name, country)
+	}
+	return city, nil
+}
+
+func (c *CachedCatalog) CreateCity(ctx context.Context, city City) error {
+	defer c.invalidate()
+	return c.next.CreateCity(ctx, city)
+}
+
+func (c *CachedCatalog) UpdateCity(ctx context.Context, city City) error {
+	defer c.invalidate()
+	return c.next.UpdateCity(ctx, city)
+}
+
+func (c *CachedCatalog) DeleteCity(ctx context.Context, name, country string) error {
+	defer c.invalidate()
+	return c.next.DeleteCity(ctx, name, country)
+}
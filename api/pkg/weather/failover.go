@@ -0,0 +1,98 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+)
+
+// Names of the built-in providers.
+const (
+	ProviderOpenMeteo = "open-meteo"
+	ProviderMetNo     = "met-no"
+)
+
+// Provider is a named weather client.
+type Provider struct {
+	Name   string
+	Client Client
+}
+
+// Failover asks its providers in order and returns the first successful
+// answer, so an outage of one provider doesn't stop alerting workflows.
+type Failover struct {
+	providers []Provider
+}
+
+func NewFailover(providers ...Provider) *Failover {
+	return &Failover{providers: providers}
+}
+
+// NewDefaultFailover uses the named provider first and falls back to the
+// other built-in one. A non-nil httpClient replaces the providers' default
+// HTTP client, and a non-nil quota has Open-Meteo called with its API key.
+func NewDefaultFailover(primary string, httpClient *http.Client, quota *Quota) (*Failover, error) {
+	openMeteo, metNo := NewOpenMeteoClient(), NewMetNoClient()
+	if httpClient != nil {
+		openMeteo.HTTPClient = httpClient
+		metNo.HTTPClient = httpClient
+	}
+	var openMeteoClient Client = openMeteo
+	if quota != nil {
+		openMeteoClient = quota.Wrap(openMeteo)
+	}
+	all := []Provider{
+		{Name: ProviderOpenMeteo, Client: openMeteoClient},
+		{Name: ProviderMetNo, Client: metNo},
+	}
+	f, ok := NewFailover(all...).Prefer(primary)
+	if !ok {
+		return nil, fmt.Errorf("unknown weather provider %q", primary)
+	}
+	return f, nil
+}
+
+// Prefer returns a copy of f that tries the named provider first. It reports
+// false if f has no provider of that name.
+func (f *Failover) Prefer(name string) (*Failover, bool) {
+	i := slices.IndexFunc(f.providers, func(p Provider) bool { return p.Name == name })
+	if i < 0 {
+		return nil, false
+	}
+	providers := make([]Provider, 0, len(f.providers))
+	providers = append(providers, f.providers[i])
+	providers = append(providers, f.providers[:i]...)
+	providers = append(providers, f.providers[i+1:]...)
+	return &Failover{providers: providers}, true
+}
+
+// Names returns the provider names in the order they are tried.
+func (f *Failover) Names() []string {
+	names := make([]string, len(f.providers))
+	for i, p := range f.providers {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func (f *Failover) CurrentTemperature(ctx context.Context, lat, lon float64) (float64, error) {
+	var errs []error
+	for _, p := range f.providers {
+		temperature, err := p.Client.CurrentTemperature(ctx, lat, lon)
+		if err == nil {
+			return temperature, nil
+		}
+		if ctx.Err() != nil {
+			return 0, err
+		}
+		slog.Warn("Weather provider failed, trying next", "provider", p.Name, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+	}
+	if len(errs) == 0 {
+		return 0, errors.New("no weather providers configured")
+	}
+	return 0, errors.Join(errs...)
+}
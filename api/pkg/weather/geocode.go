@@ -0,0 +1,90 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"workflow-code-test/api/pkg/errclass"
+)
+
+const geocodingBaseURL = "https://geocoding-api.open-meteo.com/v1/search"
+
+// Geocoder finds places by name.
+type Geocoder interface {
+	// Search returns the places called name, best match first, optionally
+	// only those in the country with the given ISO code. The cities returned
+	// are disabled until added to a catalog.
+	Search(ctx context.Context, name, country string) ([]City, error)
+}
+
+// OpenMeteoGeocoder talks to the Open-Meteo geocoding API, which returns
+// GeoNames places. Their place IDs are "geonames:<id>".
+type OpenMeteoGeocoder struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+func NewOpenMeteoGeocoder() *OpenMeteoGeocoder {
+	return &OpenMeteoGeocoder{
+		BaseURL:    geocodingBaseURL,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type geocodingResponse struct {
+	Results []struct {
+		ID          int64   `json:"id"`
+		Name        string  `json:"name"`
+		Latitude    float64 `json:"latitude"`
+		Longitude   float64 `json:"longitude"`
+		CountryCode string  `json:"country_code"`
+		Timezone    string  `json:"timezone"`
+	} `json:"results"`
+}
+
+func (g *OpenMeteoGeocoder) Search(ctx context.Context, name, country string) ([]City, error) {
+	q := url.Values{}
+	q.Set("name", strings.TrimSpace(name))
+	q.Set("count", "10")
+	if country != "" {
+		q.Set("countryCode", strings.ToUpper(country))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.BaseURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build geocoding request: %w", err)
+	}
+
+	resp, err := g.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errclass.Call(fmt.Errorf("failed to call geocoding API: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errclass.Status(resp.StatusCode, fmt.Errorf("geocoding API returned status %d", resp.StatusCode))
+	}
+
+	var body geocodingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode geocoding response: %w", err)
+	}
+	cities := make([]City, 0, len(body.Results))
+	for _, r := range body.Results {
+		cities = append(cities, City{
+			Name:     r.Name,
+			Country:  r.CountryCode,
+			Lat:      r.Latitude,
+			Lon:      r.Longitude,
+			Timezone: r.Timezone,
+			PlaceID:  "geonames:" + strconv.FormatInt(r.ID, 10),
+		})
+	}
+	return cities, nil
+}
@@ -0,0 +1,84 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"workflow-code-test/api/pkg/errclass"
+)
+
+const (
+	metNoBaseURL = "https://api.met.no/weatherapi/locationforecast/2.0/compact"
+
+	// met.no rejects requests without an identifying User-Agent.
+	metNoUserAgent = "workflow-code-test/1.0 github.com/Checkbox-Technology-Pty-Ltd/workflow-go-challenge"
+)
+
+// MetNoClient talks to the Norwegian Meteorological Institute's
+// Locationforecast API.
+type MetNoClient struct {
+	BaseURL    string
+	UserAgent  string
+	HTTPClient *http.Client
+}
+
+func NewMetNoClient() *MetNoClient {
+	return &MetNoClient{
+		BaseURL:    metNoBaseURL,
+		UserAgent:  metNoUserAgent,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type locationforecastResponse struct {
+	Properties struct {
+		Timeseries []struct {
+			Data struct {
+				Instant struct {
+					Details struct {
+						AirTemperature *float64 `json:"air_temperature"`
+					} `json:"details"`
+				} `json:"instant"`
+			} `json:"data"`
+		} `json:"timeseries"`
+	} `json:"properties"`
+}
+
+func (c *MetNoClient) CurrentTemperature(ctx context.Context, lat, lon float64) (float64, error) {
+	// met.no asks clients to use at most four decimals so responses cache well.
+	q := url.Values{}
+	q.Set("lat", strconv.FormatFloat(lat, 'f', 4, 64))
+	q.Set("lon", strconv.FormatFloat(lon, 'f', 4, 64))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build weather request: %w", err)
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, errclass.Call(fmt.Errorf("failed to call weather API: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, errclass.Status(resp.StatusCode, fmt.Errorf("weather API returned status %d", resp.StatusCode))
+	}
+
+	var body locationforecastResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("failed to decode weather response: %w", err)
+	}
+	series := body.Properties.Timeseries
+	if len(series) == 0 || series[0].Data.Instant.Details.AirTemperature == nil {
+		return 0, fmt.Errorf("weather response has no current air temperature")
+	}
+
+	return *series[0].Data.Instant.Details.AirTemperature, nil
+}
@@ -0,0 +1,257 @@
+package weather
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/errclass"
+)
+
+// ErrQuotaExhausted is returned for calls an API key has no daily quota left
+// for and no cached value can answer.
+var ErrQuotaExhausted = errors.New("API key quota exhausted")
+
+// DefaultMaxStale is how old the cached temperatures a QuotaClient serves
+// once its quota is exhausted may be.
+const DefaultMaxStale = 3 * time.Hour
+
+// dayLayout formats the UTC days usage is counted by.
+const dayLayout = time.DateOnly
+
+// KeyID identifies an API key in usage records and logs without revealing
+// it: the first 12 hex digits of its SHA-256.
+func KeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
+
+// KeyUsage is the number of calls made with an API key on one UTC day.
+// Rejected counts the calls refused once the quota was exhausted, whether or
+// not a cached value answered them.
+type KeyUsage struct {
+	Provider string `json:"provider"`
+	KeyID    string `json:"keyId"`
+	Day      string `json:"day"`
+	Calls    int    `json:"calls"`
+	Rejected int    `json:"rejected"`
+	// Quota is the daily quota in force when the key was last used that
+	// day; 0 means none.
+	Quota int `json:"quota,omitempty"`
+}
+
+// UsageStore counts the calls made with API keys per UTC day, so quotas hold
+// across restarts and API instances.
+type UsageStore interface {
+	// Reserve counts a call with the key on day unless quota calls were
+	// already counted; a quota of 0 never runs out. It reports whether the
+	// call was counted, and counts it as rejected otherwise.
+	Reserve(ctx context.Context, provider, keyID, day string, quota int) (bool, error)
+	// Usage returns the counts of every key from the day since on, newest
+	// day first.
+	Usage(ctx context.Context, since string) ([]KeyUsage, error)
+}
+
+// Quota is an Open-Meteo API key, the daily quota of its plan and where its
+// calls are counted.
+type Quota struct {
+	APIKey     string
+	DailyQuota int
+	Store      UsageStore
+}
+
+// Wrap sets the key on c and counts its calls against the quota.
+func (q *Quota) Wrap(c *OpenMeteoClient) *QuotaClient {
+	c.UseAPIKey(q.APIKey)
+	return NewQuotaClient(ProviderOpenMeteo, c, KeyID(q.APIKey), q.DailyQuota, q.Store)
+}
+
+// QuotaClient counts the calls another client makes with an API key and
+// stops calling it once the key's daily quota is exhausted. Until the next
+// UTC day it answers from the temperatures it fetched last, for up to
+// MaxStale, and fails with ErrQuotaExhausted for places it has none for, so a
+// Failover moves on to the next provider.
+type QuotaClient struct {
+	next     Client
+	provider string
+	keyID    string
+	quota    int
+	store    UsageStore
+
+	MaxStale time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	readings map[[2]float64]reading
+}
+
+// reading is a temperature fetched at some time.
+type reading struct {
+	temperature float64
+	at          time.Time
+}
+
+func NewQuotaClient(provider string, next Client, keyID string, quota int, store UsageStore) *QuotaClient {
+	return &QuotaClient{
+		next:     next,
+		provider: provider,
+		keyID:    keyID,
+		quota:    quota,
+		store:    store,
+		MaxStale: DefaultMaxStale,
+		now:      time.Now,
+		readings: make(map[[2]float64]reading),
+	}
+}
+
+func (c *QuotaClient) CurrentTemperature(ctx context.Context, lat, lon float64) (float64, error) {
+	now := c.now().UTC()
+	ok, err := c.store.Reserve(ctx, c.provider, c.keyID, now.Format(dayLayout), c.quota)
+	if err != nil {
+		// Losing count of a call beats failing the workflow over it.
+		slog.Warn("Failed to count weather API call", "provider", c.provider, "keyId", c.keyID, "error", err)
+	} else if !ok {
+		return c.cached(lat, lon, now)
+	}
+
+	temperature, err := c.next.CurrentTemperature(ctx, lat, lon)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.readings[[2]float64{lat, lon}] = reading{temperature: temperature, at: now}
+	c.mu.Unlock()
+	return temperature, nil
+}
+
+// cached answers a call the quota has no room for.
+func (c *QuotaClient) cached(lat, lon float64, now time.Time) (float64, error) {
+	c.mu.Lock()
+	r, ok := c.readings[[2]float64{lat, lon}]
+	c.mu.Unlock()
+	if !ok || now.Sub(r.at) > c.MaxStale {
+		// Retrying won't help before the quota resets.
+		return 0, &errclass.Error{Class: errclass.Permanent,
+			Err: fmt.Errorf("%w: key %s used its %d calls for today", ErrQuotaExhausted, c.keyID, c.quota)}
+	}
+	slog.Info("Weather API quota exhausted, serving cached temperature",
+		"provider", c.provider, "keyId", c.keyID, "age", now.Sub(r.at).Round(time.Second))
+	return r.temperature, nil
+}
+
+// MemoryUsage counts calls in process, so quotas restart with it.
+type MemoryUsage struct {
+	mu     sync.Mutex
+	counts map[[3]string]*KeyUsage
+}
+
+func NewMemoryUsage() *MemoryUsage {
+	return &MemoryUsage{counts: make(map[[3]string]*KeyUsage)}
+}
+
+func (u *MemoryUsage) Reserve(ctx context.Context, provider, keyID, day string, quota int) (bool, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	key := [3]string{provider, keyID, day}
+	usage, ok := u.counts[key]
+	if !ok {
+		usage = &KeyUsage{Provider: provider, KeyID: keyID, Day: day}
+		u.counts[key] = usage
+	}
+	usage.Quota = quota
+	if quota > 0 && usage.Calls >= quota {
+		usage.Rejected++
+		return false, nil
+	}
+	usage.Calls++
+	return true, nil
+}
+
+func (u *MemoryUsage) Usage(ctx context.Context, since string) ([]KeyUsage, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	usage := []KeyUsage{}
+	for _, k := range u.counts {
+		if k.Day >= since {
+			usage = append(usage, *k)
+		}
+	}
+	sortUsage(usage)
+	return usage, nil
+}
+
+func sortUsage(usage []KeyUsage) {
+	slices.SortFunc(usage, func(a, b KeyUsage) int {
+		return cmp.Or(strings.Compare(b.Day, a.Day), strings.Compare(a.Provider, b.Provider),
+			strings.Compare(a.KeyID, b.KeyID))
+	})
+}
+
+// PostgresUsage counts calls in the weather_api_usage table, shared by every
+// API instance.
+type PostgresUsage struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresUsage(pool *pgxpool.Pool) *PostgresUsage {
+	return &PostgresUsage{pool: pool}
+}
+
+func (u *PostgresUsage) Reserve(ctx context.Context, provider, keyID, day string, quota int) (bool, error) {
+	// The upsert only counts the call while the quota has room; otherwise
+	// it returns no row.
+	rows, err := u.pool.Query(ctx, `
+		INSERT INTO weather_api_usage AS u (provider, key_id, day, calls, quota)
+		VALUES ($1, $2, $3::text::date, 1, $4)
+		ON CONFLICT (provider, key_id, day) DO UPDATE SET calls = u.calls + 1, quota = EXCLUDED.quota
+		WHERE EXCLUDED.quota = 0 OR u.calls < EXCLUDED.quota
+		RETURNING calls`, provider, keyID, day, quota)
+	if err != nil {
+		return false, db.Classify(err)
+	}
+	counted, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return false, db.Classify(err)
+	}
+	if len(counted) > 0 {
+		return true, nil
+	}
+	_, err = u.pool.Exec(ctx, `
+		UPDATE weather_api_usage SET rejected = rejected + 1, quota = $4
+		WHERE provider = $1 AND key_id = $2 AND day = $3::text::date`, provider, keyID, day, quota)
+	if err != nil {
+		// The quota is exhausted whether or not the rejection is counted.
+		slog.Warn("Failed to count rejected weather API call", "provider", provider, "keyId", keyID, "error", err)
+	}
+	return false, nil
+}
+
+func (u *PostgresUsage) Usage(ctx context.Context, since string) ([]KeyUsage, error) {
+	rows, err := u.pool.Query(ctx, `
+		SELECT provider, key_id, to_char(day, 'YYYY-MM-DD'), calls, rejected, quota FROM weather_api_usage
+		WHERE day >= $1::text::date ORDER BY day DESC, provider, key_id`, since)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	usage, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (KeyUsage, error) {
+		var k KeyUsage
+		err := row.Scan(&k.Provider, &k.KeyID, &k.Day, &k.Calls, &k.Rejected, &k.Quota)
+		return k, err
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return usage, nil
+}
@@ -0,0 +1,128 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"workflow-code-test/api/pkg/errclass"
+)
+
+const defaultBaseURL = "https://api.open-meteo.com/v1/forecast"
+
+// customerBaseURL serves Open-Meteo's commercial tier, which needs an API key.
+const customerBaseURL = "https://customer-api.open-meteo.com/v1/forecast"
+
+// City is a location supported by the weather integration. Disabled cities
+// stay in the catalog but can't be looked up.
+type City struct {
+	Name string `json:"name"`
+	// Country is the ISO 3166-1 alpha-2 code of the city's country, e.g.
+	// "AU". It tells apart cities of the same name.
+	Country string  `json:"country,omitempty"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	// Timezone is the IANA name of the city's time zone, e.g.
+	// "Australia/Sydney".
+	Timezone string `json:"timezone,omitempty"`
+	// PlaceID identifies the city with the geocoder it was found with, e.g.
+	// "geonames:2158177".
+	PlaceID string `json:"placeId,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+// String returns the name and country of the city, e.g. "Melbourne, AU",
+// which is also accepted by ResolveCity.
+func (c City) String() string {
+	if c.Country == "" {
+		return c.Name
+	}
+	return c.Name + ", " + c.Country
+}
+
+// DefaultCities seed catalogs that don't keep their cities in the database.
+var DefaultCities = []City{
+	{Name: "Sydney", Country: "AU", Lat: -33.8688, Lon: 151.2093, Timezone: "Australia/Sydney", PlaceID: "geonames:2147714", Enabled: true},
+	{Name: "Melbourne", Country: "AU", Lat: -37.8136, Lon: 144.9631, Timezone: "Australia/Melbourne", PlaceID: "geonames:2158177", Enabled: true},
+	{Name: "Brisbane", Country: "AU", Lat: -27.4698, Lon: 153.0251, Timezone: "Australia/Brisbane", PlaceID: "geonames:2174003", Enabled: true},
+	{Name: "Perth", Country: "AU", Lat: -31.9505, Lon: 115.8605, Timezone: "Australia/Perth", PlaceID: "geonames:2063523", Enabled: true},
+	{Name: "Adelaide", Country: "AU", Lat: -34.9285, Lon: 138.6007, Timezone: "Australia/Adelaide", PlaceID: "geonames:2078025", Enabled: true},
+}
+
+// Plausible range of air temperatures in °C, used to spot conditions that can
+// never (or always) be met.
+const (
+	MinPlausibleTemperature = -90.0
+	MaxPlausibleTemperature = 60.0
+)
+
+// Client fetches current weather conditions.
+type Client interface {
+	CurrentTemperature(ctx context.Context, lat, lon float64) (float64, error)
+}
+
+// OpenMeteoClient talks to the Open-Meteo forecast API. With an APIKey it
+// calls the commercial tier.
+type OpenMeteoClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	APIKey     string
+}
+
+func NewOpenMeteoClient() *OpenMeteoClient {
+	return &OpenMeteoClient{
+		BaseURL:    defaultBaseURL,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// UseAPIKey sends key with every call and, unless BaseURL was changed, moves
+// the client to the commercial tier's host.
+func (c *OpenMeteoClient) UseAPIKey(key string) {
+	c.APIKey = key
+	if c.BaseURL == defaultBaseURL {
+		c.BaseURL = customerBaseURL
+	}
+}
+
+type forecastResponse struct {
+	CurrentWeather struct {
+		Temperature float64 `json:"temperature"`
+	} `json:"current_weather"`
+}
+
+func (c *OpenMeteoClient) CurrentTemperature(ctx context.Context, lat, lon float64) (float64, error) {
+	q := url.Values{}
+	q.Set("latitude", strconv.FormatFloat(lat, 'f', -1, 64))
+	q.Set("longitude", strconv.FormatFloat(lon, 'f', -1, 64))
+	q.Set("current_weather", "true")
+	if c.APIKey != "" {
+		q.Set("apikey", c.APIKey)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build weather request: %w", err)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, errclass.Call(fmt.Errorf("failed to call weather API: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, errclass.Status(resp.StatusCode, fmt.Errorf("weather API returned status %d", resp.StatusCode))
+	}
+
+	var body forecastResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("failed to decode weather response: %w", err)
+	}
+
+	return body.CurrentWeather.Temperature, nil
+}
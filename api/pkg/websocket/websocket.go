@@ -0,0 +1,265 @@
+// Package websocket is a small RFC 6455 server: enough to accept connections
+// from browsers and exchange text messages with them. Extensions and
+// subprotocols aren't supported.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxMessageSize caps the messages read from clients.
+const MaxMessageSize = 64 << 10
+
+// ErrClosed is returned by ReadMessage once the client closed the connection.
+var ErrClosed = errors.New("websocket: connection closed")
+
+// acceptGUID is appended to the client's key to compute Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Frame opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close status codes.
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseTooLarge      = 1009
+)
+
+// writeTimeout bounds every frame written, so a stalled client can't block
+// its writers for long.
+const writeTimeout = 10 * time.Second
+
+// Conn is an upgraded connection. ReadMessage must be called from one
+// goroutine; the write methods may be called from any.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	// writeMu serializes writes to conn.
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// Upgrade completes the opening handshake of a WebSocket request and takes
+// over its connection. On failure it has answered the request with an
+// error.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != http.MethodGet:
+		return nil, handshakeError(w, http.StatusMethodNotAllowed, "websocket: method must be GET")
+	case !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket"):
+		return nil, handshakeError(w, http.StatusBadRequest, "websocket: not a websocket handshake")
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, handshakeError(w, http.StatusUpgradeRequired, "websocket: unsupported version")
+	case key == "":
+		return nil, handshakeError(w, http.StatusBadRequest, "websocket: missing Sec-WebSocket-Key")
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, handshakeError(w, http.StatusInternalServerError, "websocket: connection can't be taken over")
+	}
+	// Handlers may have set deadlines on the request's connection.
+	conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	if _, err := brw.WriteString(resp); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{conn: conn, br: brw.Reader}, nil
+}
+
+func handshakeError(w http.ResponseWriter, status int, msg string) error {
+	http.Error(w, msg, status)
+	return errors.New(msg)
+}
+
+// headerContains reports whether one of the comma-separated values of header
+// is token, ignoring case.
+func headerContains(h http.Header, header, token string) bool {
+	for _, v := range h.Values(header) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message, answering pings
+// along the way. It returns ErrClosed once the client closes the
+// connection; the connection must be closed with Close afterwards either
+// way.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var msg []byte
+	started := false
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+		case opPong:
+		case opClose:
+			c.writeClose(CloseNormal, "")
+			return nil, ErrClosed
+		case opText, opBinary, opContinuation:
+			if (op == opContinuation) != started {
+				c.writeClose(CloseProtocolError, "unexpected continuation")
+				return nil, fmt.Errorf("websocket: unexpected frame opcode %d", op)
+			}
+			if len(msg)+len(payload) > MaxMessageSize {
+				c.writeClose(CloseTooLarge, "message too large")
+				return nil, fmt.Errorf("websocket: message larger than %d bytes", MaxMessageSize)
+			}
+			msg, started = append(msg, payload...), true
+			if fin {
+				return msg, nil
+			}
+		default:
+			c.writeClose(CloseProtocolError, "unknown opcode")
+			return nil, fmt.Errorf("websocket: unknown opcode %d", op)
+		}
+	}
+}
+
+// readFrame reads one frame, unmasking its payload. Clients must mask every
+// frame.
+func (c *Conn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = head[0]&0x80 != 0, head[0]&0x0F
+	if head[0]&0x70 != 0 || head[1]&0x80 == 0 {
+		c.writeClose(CloseProtocolError, "")
+		return false, 0, nil, errors.New("websocket: reserved bits set or frame not masked")
+	}
+
+	size := uint64(head[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if size > MaxMessageSize {
+		c.writeClose(CloseTooLarge, "message too large")
+		return false, 0, nil, fmt.Errorf("websocket: frame larger than %d bytes", MaxMessageSize)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// WriteMessage sends data as a text message.
+func (c *Conn) WriteMessage(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// Ping sends a ping the client answers with a pong, e.g. to keep proxies
+// from closing an idle connection.
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// writeFrame sends an unmasked, unfragmented frame, as servers do.
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+
+	head := make([]byte, 2, 10)
+	head[0] = 0x80 | op
+	switch n := len(payload); {
+	case n < 126:
+		head[1] = byte(n)
+	case n <= 0xFFFF:
+		head[1] = 126
+		head = binary.BigEndian.AppendUint16(head, uint16(n))
+	default:
+		head[1] = 127
+		head = binary.BigEndian.AppendUint64(head, uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := (&net.Buffers{head, payload}).WriteTo(c.conn)
+	if op == opClose {
+		c.closed = true
+	}
+	return err
+}
+
+// writeClose starts the closing handshake with code and reason.
+func (c *Conn) writeClose(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	return c.writeFrame(opClose, append(payload, reason...))
+}
+
+// CloseWith sends a close frame with code and reason and closes the
+// connection.
+func (c *Conn) CloseWith(code int, reason string) error {
+	c.writeClose(code, reason)
+	return c.conn.Close()
+}
+
+// Close closes the connection, telling the client it is going away unless
+// the closing handshake already happened.
+func (c *Conn) Close() error {
+	return c.CloseWith(CloseGoingAway, "")
+}
@@ -0,0 +1,131 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// Statuses of async runs in progress.
+const (
+	RunStatusRunning = "running"
+	RunStatusStalled = "stalled"
+)
+
+// RunStatus describes an async run that hasn't finished yet, as returned by
+// GET /admin/runs.
+type RunStatus struct {
+	ExecutionID string     `json:"executionId"`
+	WorkflowID  string     `json:"workflowId,omitempty"`
+	Status      string     `json:"status"`
+	WorkerID    string     `json:"workerId,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	HeartbeatAt *time.Time `json:"heartbeatAt,omitempty"`
+	StalledAt   *time.Time `json:"stalledAt,omitempty"`
+}
+
+// SuperviseExecutions heartbeats the async runs of this process and watches
+// for runs whose worker stopped heartbeating, if the engine supports it. Runs
+// requeued here are recorded once they finish. It reports whether the engine
+// is supervised; supervision stops with ctx.
+func (s *Service) SuperviseExecutions(ctx context.Context, opts engine.SuperviseOptions) bool {
+	supervisor, ok := s.executor.(engine.Supervisor)
+	if !ok {
+		return false
+	}
+	go supervisor.Supervise(ctx, opts, func(r engine.RecoveredRun) {
+		go s.awaitRun(context.WithoutCancel(ctx), runFromLabels(r.ExecutionID, r.Labels, r.Input), r.Results)
+	})
+	return true
+}
+
+// HandleListRuns lists the async runs in progress, optionally filtered by the
+// status query parameter (running or stalled).
+func (s *Service) HandleListRuns(w http.ResponseWriter, r *http.Request) {
+	supervisor, ok := s.executor.(engine.Supervisor)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "not_supported", "the execution backend does not track async runs")
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && status != RunStatusRunning && status != RunStatusStalled {
+		writeError(w, http.StatusBadRequest, "invalid_status",
+			fmt.Sprintf("status must be %q or %q", RunStatusRunning, RunStatusStalled))
+		return
+	}
+
+	runs, err := supervisor.Runs(r.Context())
+	if err != nil {
+		writeStoreError(w, err, "list runs")
+		return
+	}
+	out := make([]RunStatus, 0, len(runs))
+	for _, run := range runs {
+		if rs := runStatus(run); status == "" || rs.Status == status {
+			out = append(out, rs)
+		}
+	}
+	respond(w, http.StatusOK, out)
+}
+
+func runStatus(run engine.RunInfo) RunStatus {
+	rs := RunStatus{
+		ExecutionID: run.ExecutionID,
+		WorkflowID:  run.Labels[labelWorkflowID],
+		Status:      RunStatusRunning,
+		WorkerID:    run.WorkerID,
+		CreatedAt:   run.CreatedAt,
+		HeartbeatAt: run.HeartbeatAt,
+		StalledAt:   run.StalledAt,
+	}
+	if run.StalledAt != nil {
+		rs.Status = RunStatusStalled
+	}
+	return rs
+}
+
+// HandleRequeueRun takes over a stalled run on this process. It continues from
+// its last checkpoint and is recorded once it finishes.
+func (s *Service) HandleRequeueRun(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	supervisor, ok := s.executor.(engine.Supervisor)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "not_supported", "the execution backend does not track async runs")
+		return
+	}
+
+	run, err := supervisor.Requeue(r.Context(), id)
+	switch {
+	case errors.Is(err, engine.ErrExecutionNotRunning):
+		writeError(w, http.StatusNotFound, "not_found", "no run in progress with this id")
+		return
+	case errors.Is(err, engine.ErrExecutionRunning):
+		writeError(w, http.StatusConflict, "not_stalled", "the run is not stalled")
+		return
+	case err != nil:
+		slog.Error("Failed to requeue run", "executionId", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to requeue run")
+		return
+	}
+
+	go s.awaitRun(context.WithoutCancel(r.Context()), runFromLabels(run.ExecutionID, run.Labels, run.Input), run.Results)
+
+	// Describe the run as stored now that this worker owns it; it may
+	// already have finished.
+	resp := RunStatus{ExecutionID: id, WorkflowID: run.Labels[labelWorkflowID], Status: RunStatusRunning}
+	if runs, err := supervisor.Runs(r.Context()); err == nil {
+		for _, info := range runs {
+			if info.ExecutionID == id {
+				resp = runStatus(info)
+			}
+		}
+	}
+	respond(w, http.StatusAccepted, resp)
+}
@@ -0,0 +1,152 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+
+	"workflow-code-test/api/pkg/callback"
+	"workflow-code-test/api/pkg/engine"
+)
+
+const (
+	// baselineWindow caps the sample count used when updating a baseline so
+	// that it follows the recent behaviour of a node instead of its whole
+	// history.
+	baselineWindow = 100
+
+	// baselineMinSamples is how many runs a node needs before its steps are
+	// checked for anomalies.
+	baselineMinSamples = 10
+
+	// anomalySigmas is how many standard deviations from the mean a step
+	// duration has to be to be flagged.
+	anomalySigmas = 3.0
+)
+
+// StepBaseline holds rolling duration statistics for one node of a workflow,
+// updated with Welford's online algorithm.
+type StepBaseline struct {
+	NodeID  string  `json:"nodeId"`
+	Samples int64   `json:"samples"`
+	MeanMs  float64 `json:"meanMs"`
+	M2      float64 `json:"-"`
+	MinMs   int64   `json:"minMs"`
+	MaxMs   int64   `json:"maxMs"`
+}
+
+// StdDevMs returns the sample standard deviation of the durations.
+func (b *StepBaseline) StdDevMs() float64 {
+	if b.Samples < 2 {
+		return 0
+	}
+	return math.Sqrt(b.M2 / float64(b.Samples-1))
+}
+
+// Add folds a new duration into the baseline.
+func (b *StepBaseline) Add(ms int64) {
+	if b.Samples == 0 || ms < b.MinMs {
+		b.MinMs = ms
+	}
+	if b.Samples == 0 || ms > b.MaxMs {
+		b.MaxMs = ms
+	}
+
+	if b.Samples >= baselineWindow {
+		// Shrink the baseline to baselineWindow-1 samples with the same mean
+		// and variance so new durations keep a weight of 1/baselineWindow.
+		b.M2 = b.M2 / float64(b.Samples-1) * float64(baselineWindow-2)
+		b.Samples = baselineWindow - 1
+	}
+
+	n := b.Samples + 1
+	delta := float64(ms) - b.MeanMs
+	b.MeanMs += delta / float64(n)
+	b.M2 += delta * (float64(ms) - b.MeanMs)
+	b.Samples = n
+}
+
+// StepAnomaly marks a step whose duration is far from the node's baseline.
+type StepAnomaly struct {
+	Direction string  `json:"direction"`
+	Sigmas    float64 `json:"sigmas"`
+	MeanMs    float64 `json:"meanMs"`
+	StdDevMs  float64 `json:"stdDevMs"`
+	MinMs     int64   `json:"minMs"`
+	MaxMs     int64   `json:"maxMs"`
+}
+
+// check returns an anomaly if ms deviates more than anomalySigmas standard
+// deviations from the baseline.
+func (b *StepBaseline) check(ms int64) *StepAnomaly {
+	if b.Samples < baselineMinSamples {
+		return nil
+	}
+	stddev := b.StdDevMs()
+	if stddev == 0 {
+		return nil
+	}
+
+	sigmas := (float64(ms) - b.MeanMs) / stddev
+	if math.Abs(sigmas) <= anomalySigmas {
+		return nil
+	}
+
+	direction := "slow"
+	if sigmas < 0 {
+		direction = "fast"
+	}
+	return &StepAnomaly{
+		Direction: direction,
+		Sigmas:    math.Round(sigmas*100) / 100,
+		MeanMs:    math.Round(b.MeanMs*100) / 100,
+		StdDevMs:  math.Round(stddev*100) / 100,
+		MinMs:     b.MinMs,
+		MaxMs:     b.MaxMs,
+	}
+}
+
+// flagAnomalies compares the completed steps of an execution against the
+// stored baselines, marks outliers in the trace and then folds the new
+// durations into the baselines. Statistics are best effort: failures are
+// logged and never fail the execution.
+func (s *Service) flagAnomalies(ctx context.Context, workflowID, executionID string, steps []ExecutionStep) {
+	baselines, err := s.repo.GetStepBaselines(ctx, workflowID)
+	if err != nil {
+		slog.Error("Failed to load step baselines", "workflowId", workflowID, "error", err)
+		return
+	}
+
+	durations := make(map[string]int64)
+	for i := range steps {
+		step := &steps[i]
+		if step.Status != string(engine.StepStatusCompleted) {
+			continue
+		}
+		durations[step.NodeID] = int64(step.DurationMs)
+
+		b, ok := baselines[step.NodeID]
+		if !ok {
+			continue
+		}
+		step.Anomaly = b.check(int64(step.DurationMs))
+		if step.Anomaly != nil {
+			slog.Warn("Step duration anomaly", "workflowId", workflowID, "executionId", executionID,
+				"nodeId", step.NodeID, "durationMs", step.DurationMs, "meanMs", step.Anomaly.MeanMs,
+				"sigmas", step.Anomaly.Sigmas)
+			s.notifyHooks(ctx, callback.Event{
+				Event:       callback.EventAnomaly,
+				WorkflowID:  workflowID,
+				ExecutionID: executionID,
+				Error: fmt.Sprintf("step %s took %dms, %.1fσ from its mean of %.0fms",
+					step.NodeID, step.DurationMs, step.Anomaly.Sigmas, step.Anomaly.MeanMs),
+				Timestamp: s.clock.Now(),
+			})
+		}
+	}
+
+	if err := s.repo.RecordStepDurations(ctx, workflowID, durations); err != nil {
+		slog.Error("Failed to update step baselines", "workflowId", workflowID, "error", err)
+	}
+}
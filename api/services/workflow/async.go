@@ -0,0 +1,131 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"workflow-code-test/api/pkg/callback"
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/engine"
+)
+
+// Execution modes of POST /workflows/{id}/execute.
+const (
+	ExecutionModeSync  = "sync"
+	ExecutionModeAsync = "async"
+)
+
+// Statuses of async executions that haven't finished yet. Once they finish
+// they get one of the engine's statuses, like synchronous ones.
+const (
+	ExecutionStatusQueued  = "queued"
+	ExecutionStatusRunning = "running"
+)
+
+// unfinished reports whether an execution with status may still change.
+func unfinished(status string) bool {
+	return status == string(engine.ExecutionStatusPaused) || status == ExecutionStatusQueued ||
+		status == ExecutionStatusRunning
+}
+
+// AsyncExecutionResponse is the 202 response of an async execution. The
+// execution is polled from StatusURL until its status is no longer queued or
+// running.
+type AsyncExecutionResponse struct {
+	ExecutionID string `json:"executionId"`
+	WorkflowID  string `json:"workflowId"`
+	Status      string `json:"status"`
+	StatusURL   string `json:"statusUrl"`
+}
+
+// enqueueWorkflow records a queued execution of the workflow and hands it to
+// the engine's worker pool, answering 202 without waiting for it.
+func (s *Service) enqueueWorkflow(w http.ResponseWriter, r *http.Request, id string, req *ExecuteRequest) {
+	run, graph, apiErr := s.prepareRun(r.Context(), id, req, nil)
+	if apiErr != nil {
+		apiErr.write(w)
+		return
+	}
+	run.Queued = true
+
+	now := s.clock.Now()
+	record := &ExecutionRecord{
+		ID:              run.ID,
+		WorkflowID:      run.WorkflowID,
+		Status:          ExecutionStatusQueued,
+		ExecutedAt:      now,
+		Input:           run.Input,
+		Steps:           []ExecutionStep{},
+		TriggeredBy:     run.TriggeredBy,
+		WorkflowVersion: run.WorkflowVersion,
+		Environment:     run.Environment,
+		TraceLevel:      run.TraceLevel,
+		StartedAt:       now,
+	}
+	if err := s.repo.CreateExecution(r.Context(), record); err != nil {
+		writeStoreError(w, err, "save execution")
+		return
+	}
+
+	// The run outlives the request, so its bookkeeping doesn't use the
+	// request's deadline.
+	ctx := context.WithoutCancel(r.Context())
+	feed := s.feeds.open(run, ExecutionStatusQueued, nil)
+	started := func(startedAt time.Time) {
+		feed.setStatus(ExecutionStatusRunning)
+		s.markRunning(ctx, run, startedAt)
+	}
+	runCtx := engine.WithStarted(s.runContext(feed.observe(ctx), run), started)
+	results, err := s.executor.ExecuteAsync(runCtx, run.ID, graph, run.Input)
+	if err != nil {
+		s.failExecution(ctx, run, err)
+		engineError(err).write(w)
+		return
+	}
+	go s.awaitRun(ctx, run, results)
+
+	w.Header().Set("Location", "/api/v1/executions/"+run.ID)
+	respond(w, http.StatusAccepted, AsyncExecutionResponse{
+		ExecutionID: run.ID,
+		WorkflowID:  run.WorkflowID,
+		Status:      ExecutionStatusQueued,
+		StatusURL:   s.publicURL + "/api/v1/executions/" + run.ID,
+	})
+}
+
+// markRunning records that a worker started a queued run and notifies the
+// workflow's hooks.
+func (s *Service) markRunning(ctx context.Context, run executionRun, startedAt time.Time) {
+	if err := s.repo.MarkExecutionRunning(ctx, run.ID, startedAt); err != nil && !errors.Is(err, db.ErrConflict) {
+		slog.Error("Failed to mark async execution running", "id", run.WorkflowID, "executionId", run.ID, "error", err)
+	}
+	s.notifyHooks(ctx, callback.Event{
+		Event:       callback.EventStarted,
+		WorkflowID:  run.WorkflowID,
+		ExecutionID: run.ID,
+		Timestamp:   startedAt,
+	})
+}
+
+// failExecution records a queued run that failed before its first node, e.g.
+// because the engine rejected it.
+func (s *Service) failExecution(ctx context.Context, run executionRun, runErr error) {
+	slog.Error("Async workflow execution failed before it started",
+		"id", run.WorkflowID, "executionId", run.ID, "error", runErr)
+	s.notifyFailed(ctx, run, runErr)
+
+	now := s.clock.Now()
+	record := &ExecutionRecord{
+		ID:         run.ID,
+		Status:     string(engine.ExecutionStatusFailed),
+		Steps:      []ExecutionStep{},
+		FinishedAt: now,
+	}
+	if err := s.repo.UpdateExecution(ctx, record); err != nil {
+		slog.Error("Failed to save async execution", "id", run.WorkflowID, "executionId", run.ID, "error", err)
+	}
+	s.feeds.finish(run.ID, record.Status)
+}
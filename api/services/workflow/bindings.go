@@ -0,0 +1,109 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// HandlerBindings are the handler variants a workflow's node types run with
+// instead of the default handlers, keyed by node type.
+type HandlerBindings struct {
+	WorkflowID string            `json:"workflowId"`
+	Bindings   map[string]string `json:"bindings"`
+
+	// Available lists the variants each node type can be bound to.
+	Available map[string][]string `json:"available"`
+}
+
+// BindingsRequest is the body of PUT /workflows/{id}/bindings. It replaces
+// all bindings of the workflow.
+type BindingsRequest struct {
+	Bindings map[string]string `json:"bindings"`
+}
+
+// WithHandlerVariants sets the handler variants workflows may bind node types
+// to, as returned by engine.Registry.Variants.
+func WithHandlerVariants(variants map[string][]string) Option {
+	return func(s *Service) {
+		s.variants = variants
+	}
+}
+
+func (s *Service) HandleGetBindings(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := s.repo.GetWorkflow(r.Context(), id); err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+	bindings, err := s.repo.GetHandlerBindings(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load handler bindings")
+		return
+	}
+	respond(w, http.StatusOK, s.handlerBindings(id, bindings))
+}
+
+// HandlePutBindings replaces the handler bindings of a workflow. Binding a
+// node type to "default" removes its binding.
+func (s *Service) HandlePutBindings(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req BindingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return
+	}
+
+	bindings := make(map[string]string, len(req.Bindings))
+	var problems []FieldError
+	for _, nodeType := range slices.Sorted(maps.Keys(req.Bindings)) {
+		variant := req.Bindings[nodeType]
+		switch available := s.variants[nodeType]; {
+		case variant == engine.VariantDefault:
+		case !slices.Contains(available, variant):
+			msg := fmt.Sprintf("unknown variant %q", variant)
+			if len(available) > 0 {
+				msg += "; available: " + strings.Join(available, ", ")
+			}
+			problems = append(problems, FieldError{Field: "bindings." + nodeType, Message: msg})
+		default:
+			bindings[nodeType] = variant
+		}
+	}
+	if len(problems) > 0 {
+		respond(w, http.StatusUnprocessableEntity, ErrorResponse{
+			Code:    "invalid_bindings",
+			Message: "bindings name unknown handler variants",
+			Details: problems,
+		})
+		return
+	}
+
+	if _, err := s.repo.GetWorkflow(r.Context(), id); err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+	if err := s.repo.SetHandlerBindings(r.Context(), id, bindings); err != nil {
+		writeStoreError(w, err, "save handler bindings")
+		return
+	}
+	respond(w, http.StatusOK, s.handlerBindings(id, bindings))
+}
+
+func (s *Service) handlerBindings(workflowID string, bindings map[string]string) HandlerBindings {
+	available := s.variants
+	if available == nil {
+		available = map[string][]string{}
+	}
+	if bindings == nil {
+		bindings = map[string]string{}
+	}
+	return HandlerBindings{WorkflowID: workflowID, Bindings: bindings, Available: available}
+}
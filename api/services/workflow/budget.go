@@ -0,0 +1,66 @@
+package workflow
+
+import (
+	"fmt"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// What happens to a node that would exceed its execution's budget.
+const (
+	// BudgetFail fails the node and with it the execution. It is the
+	// default.
+	BudgetFail = "fail"
+	// BudgetSkip skips the node and carries on along its first outgoing
+	// edge.
+	BudgetSkip = "skip"
+)
+
+// Budget caps what one execution of a workflow may consume, so that e.g. a
+// misconfigured workflow can't send hundreds of emails. ExternalCalls counts
+// calls to external services, such as weather lookups and issues filed;
+// Notifications counts messages sent to people, one per email recipient or
+// incident raised. A limit of 0 is unlimited.
+type Budget struct {
+	ExternalCalls int    `json:"externalCalls,omitempty" yaml:"externalCalls,omitempty"`
+	Notifications int    `json:"notifications,omitempty" yaml:"notifications,omitempty"`
+	OnExceeded    string `json:"onExceeded,omitempty" yaml:"onExceeded,omitempty"`
+}
+
+func checkBudget(b *Budget) string {
+	switch {
+	case b == nil:
+		return ""
+	case b.ExternalCalls < 0 || b.Notifications < 0:
+		return "budget limits must not be negative"
+	case b.OnExceeded != "" && b.OnExceeded != BudgetFail && b.OnExceeded != BudgetSkip:
+		return fmt.Sprintf("budget.onExceeded must be %q or %q", BudgetFail, BudgetSkip)
+	}
+	return ""
+}
+
+// normalizeBudget drops the defaults from a checked budget, and the budget
+// itself when it limits nothing.
+func normalizeBudget(b *Budget) *Budget {
+	if b == nil || b.ExternalCalls == 0 && b.Notifications == 0 {
+		return nil
+	}
+	if b.OnExceeded == BudgetFail {
+		b.OnExceeded = ""
+	}
+	return b
+}
+
+// engineBudget returns the budget the engine enforces for b.
+func (b *Budget) engineBudget() engine.Budget {
+	if b == nil {
+		return engine.Budget{}
+	}
+	return engine.Budget{
+		Limits: map[engine.Resource]int{
+			engine.ResourceExternalCalls: b.ExternalCalls,
+			engine.ResourceNotifications: b.Notifications,
+		},
+		Skip: b.OnExceeded == BudgetSkip,
+	}
+}
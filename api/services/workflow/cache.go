@@ -0,0 +1,263 @@
+package workflow
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultResponseTTL is how long a MemoryResponseCache serves a response
+// before the handler runs again. Writes through this process invalidate
+// responses at once; the ttl bounds how stale they get after writes made by
+// other API instances.
+const DefaultResponseTTL = time.Minute
+
+// CachedResponse is a successful GET response body in one media type.
+type CachedResponse struct {
+	ETag string
+	Body []byte
+}
+
+// ResponseCache stores GET responses by resource key and media type, so
+// polling clients don't reload unchanged resources from the repository. An
+// implementation backed by a shared store such as Redis lets API instances
+// see each other's invalidations.
+//
+// A response is rendered from what the repository held when its request
+// started, so one rendered before a write can be ready after the write
+// invalidated its key. Generation and the generation passed to Put let the
+// cache drop such responses: Put must not store a response if key was
+// invalidated since Generation returned gen.
+type ResponseCache interface {
+	Get(ctx context.Context, key, mediaType string) (CachedResponse, bool)
+	Generation(ctx context.Context, key string) uint64
+	Put(ctx context.Context, key, mediaType string, gen uint64, resp CachedResponse)
+	// Invalidate drops the responses for key in every media type.
+	Invalidate(ctx context.Context, key string)
+}
+
+// MemoryResponseCache is a ResponseCache local to the process. Expired
+// responses are dropped when read and, for keys no longer read, by a sweep
+// at most once per ttl.
+type MemoryResponseCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]*memoryKey
+	// generation counts the invalidations. forgotten is the generation of
+	// the latest invalidation of the keys swept since, which Put assumes
+	// for keys it doesn't know.
+	generation uint64
+	forgotten  uint64
+	swept      time.Time
+}
+
+type memoryKey struct {
+	// invalidated is the generation of the key's last invalidation.
+	invalidated uint64
+	responses   map[string]memoryResponse
+}
+
+type memoryResponse struct {
+	CachedResponse
+	storedAt time.Time
+}
+
+func NewMemoryResponseCache(ttl time.Duration) *MemoryResponseCache {
+	return &MemoryResponseCache{ttl: ttl, now: time.Now, keys: make(map[string]*memoryKey)}
+}
+
+func (c *MemoryResponseCache) Get(_ context.Context, key, mediaType string) (CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k, ok := c.keys[key]
+	if !ok {
+		return CachedResponse{}, false
+	}
+	resp, ok := k.responses[mediaType]
+	if !ok {
+		return CachedResponse{}, false
+	}
+	if c.expired(resp) {
+		delete(k.responses, mediaType)
+		return CachedResponse{}, false
+	}
+	return resp.CachedResponse, true
+}
+
+func (c *MemoryResponseCache) Generation(context.Context, string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+func (c *MemoryResponseCache) Put(_ context.Context, key, mediaType string, gen uint64, resp CachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweep()
+	k, ok := c.keys[key]
+	switch {
+	case ok && k.invalidated > gen, !ok && c.forgotten > gen:
+		return
+	case !ok:
+		k = &memoryKey{invalidated: c.forgotten}
+		c.keys[key] = k
+	}
+	if k.responses == nil {
+		k.responses = make(map[string]memoryResponse)
+	}
+	k.responses[mediaType] = memoryResponse{CachedResponse: resp, storedAt: c.now()}
+}
+
+func (c *MemoryResponseCache) Invalidate(_ context.Context, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweep()
+	c.generation++
+	c.keys[key] = &memoryKey{invalidated: c.generation}
+}
+
+// Len returns the number of responses stored, expired ones included until
+// they are dropped.
+func (c *MemoryResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, k := range c.keys {
+		n += len(k.responses)
+	}
+	return n
+}
+
+func (c *MemoryResponseCache) expired(resp memoryResponse) bool {
+	return c.now().Sub(resp.storedAt) >= c.ttl
+}
+
+// sweep drops expired responses and the keys left without any, at most once
+// per ttl. c.mu must be held.
+func (c *MemoryResponseCache) sweep() {
+	now := c.now()
+	if now.Sub(c.swept) < c.ttl {
+		return
+	}
+	c.swept = now
+	for key, k := range c.keys {
+		for mediaType, resp := range k.responses {
+			if c.expired(resp) {
+				delete(k.responses, mediaType)
+			}
+		}
+		if len(k.responses) == 0 {
+			c.forgotten = max(c.forgotten, k.invalidated)
+			delete(c.keys, key)
+		}
+	}
+}
+
+// WithResponseCache replaces the in-memory response cache, e.g. with one
+// shared by every API instance.
+func WithResponseCache(c ResponseCache) Option {
+	return func(s *Service) {
+		s.responses = c
+	}
+}
+
+// workflowCacheKey is the key responses of GET /workflows/{id} are cached
+// under.
+func workflowCacheKey(r *http.Request) string {
+	return workflowCachePrefix + mux.Vars(r)["id"]
+}
+
+const workflowCachePrefix = "workflow:"
+
+// forgetWorkflow drops everything cached about a workflow whose definition
+// changed.
+func (s *Service) forgetWorkflow(ctx context.Context, id string) {
+	s.graphs.forget(id)
+	s.definitions.forget(id)
+	s.responses.Invalidate(context.WithoutCancel(ctx), workflowCachePrefix+id)
+}
+
+// cacheResponses serves GET requests from the response cache under the key
+// returned by key, and answers If-None-Match with 304 when the client's copy
+// is current. Only 200 responses are cached, and only if the key wasn't
+// invalidated while they were rendered; it must run inside
+// negotiateMiddleware.
+func (s *Service) cacheResponses(key func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nw, ok := w.(*negotiatedWriter)
+		if !ok || r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		k := key(r)
+		if cached, ok := s.responses.Get(r.Context(), k, nw.mediaType); ok {
+			writeCached(w, r, cached)
+			return
+		}
+		gen := s.responses.Generation(r.Context(), k)
+
+		rec := &recordingWriter{ResponseWriter: nw.ResponseWriter, status: http.StatusOK}
+		next.ServeHTTP(&negotiatedWriter{ResponseWriter: rec, mediaType: nw.mediaType}, r)
+		if rec.status != http.StatusOK {
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes())
+			return
+		}
+
+		sum := sha256.Sum256(rec.body.Bytes())
+		cached := CachedResponse{ETag: `"` + hex.EncodeToString(sum[:16]) + `"`, Body: rec.body.Bytes()}
+		s.responses.Put(r.Context(), k, nw.mediaType, gen, cached)
+		writeCached(w, r, cached)
+	})
+}
+
+// writeCached writes a cached response, or 304 if the request's If-None-Match
+// lists its ETag.
+func writeCached(w http.ResponseWriter, r *http.Request, cached CachedResponse) {
+	w.Header().Set("ETag", cached.ETag)
+	if etagMatches(r.Header.Get("If-None-Match"), cached.ETag) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(cached.Body)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing
+// weakly as RFC 9110 requires.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// recordingWriter buffers a response so it can be cached before it is
+// written.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
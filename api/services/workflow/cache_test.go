@@ -0,0 +1,66 @@
+package workflow_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"workflow-code-test/api/services/workflow"
+)
+
+func TestResponseCacheDropsResponsesRenderedBeforeInvalidation(t *testing.T) {
+	ctx := context.Background()
+	c := workflow.NewMemoryResponseCache(time.Minute)
+	stale := workflow.CachedResponse{ETag: `"old"`, Body: []byte(`{"name":"old"}`)}
+	fresh := workflow.CachedResponse{ETag: `"new"`, Body: []byte(`{"name":"new"}`)}
+
+	// A GET loads the workflow, a write invalidates it, then the GET
+	// finishes rendering the old definition.
+	gen := c.Generation(ctx, "workflow:1")
+	c.Invalidate(ctx, "workflow:1")
+	c.Put(ctx, "workflow:1", "application/json", gen, stale)
+	if _, ok := c.Get(ctx, "workflow:1", "application/json"); ok {
+		t.Fatal("response rendered before the invalidation was cached")
+	}
+
+	gen = c.Generation(ctx, "workflow:1")
+	c.Invalidate(ctx, "workflow:2")
+	c.Put(ctx, "workflow:1", "application/json", gen, fresh)
+	if got, ok := c.Get(ctx, "workflow:1", "application/json"); !ok || got.ETag != fresh.ETag {
+		t.Fatalf("Get = %v, %t, want the response rendered after the invalidation", got.ETag, ok)
+	}
+}
+
+func TestResponseCacheEvictsExpiredResponses(t *testing.T) {
+	ctx := context.Background()
+	ttl := 20 * time.Millisecond
+	c := workflow.NewMemoryResponseCache(ttl)
+	resp := workflow.CachedResponse{ETag: `"1"`, Body: []byte(`{}`)}
+
+	gen := c.Generation(ctx, "workflow:1")
+	c.Put(ctx, "workflow:1", "application/json", gen, resp)
+	c.Put(ctx, "workflow:2", "application/json", gen, resp)
+	c.Put(ctx, "workflow:2", "application/x-yaml", gen, resp)
+	c.Invalidate(ctx, "workflow:3")
+	time.Sleep(2 * ttl)
+
+	// Reading an expired response drops it.
+	if _, ok := c.Get(ctx, "workflow:1", "application/json"); ok {
+		t.Fatal("expired response served")
+	}
+	if n := c.Len(); n != 2 {
+		t.Fatalf("Len after reading an expired response = %d, want 2", n)
+	}
+
+	// The next write sweeps the expired responses nobody read.
+	c.Put(ctx, "workflow:4", "application/json", c.Generation(ctx, "workflow:4"), resp)
+	if n := c.Len(); n != 1 {
+		t.Fatalf("Len after the sweep = %d, want 1", n)
+	}
+
+	// Sweeping workflow:3 doesn't forget it was invalidated after gen.
+	c.Put(ctx, "workflow:3", "application/json", gen, resp)
+	if _, ok := c.Get(ctx, "workflow:3", "application/json"); ok {
+		t.Fatal("response rendered before the swept invalidation was cached")
+	}
+}
@@ -0,0 +1,275 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/weather"
+)
+
+// CityRequest is the body of POST /cities and PUT /cities/{name}. On create
+// name is required and, when a geocoder is configured, lat and lon are looked
+// up if left out; enabled defaults to true. On update omitted fields keep
+// their current value, and name and country can only change case.
+type CityRequest struct {
+	Name     string   `json:"name"`
+	Country  string   `json:"country"`
+	Lat      *float64 `json:"lat"`
+	Lon      *float64 `json:"lon"`
+	Timezone *string  `json:"timezone"`
+	PlaceID  *string  `json:"placeId"`
+	Enabled  *bool    `json:"enabled"`
+}
+
+// apply copies the request onto city.
+func (req *CityRequest) apply(city *weather.City) {
+	if req.Name != "" {
+		city.Name = strings.TrimSpace(req.Name)
+	}
+	if req.Country != "" {
+		city.Country = strings.ToUpper(strings.TrimSpace(req.Country))
+	}
+	if req.Lat != nil {
+		city.Lat = *req.Lat
+	}
+	if req.Lon != nil {
+		city.Lon = *req.Lon
+	}
+	if req.Timezone != nil {
+		city.Timezone = *req.Timezone
+	}
+	if req.PlaceID != nil {
+		city.PlaceID = *req.PlaceID
+	}
+	if req.Enabled != nil {
+		city.Enabled = *req.Enabled
+	}
+}
+
+// WithCities manages the cities form and integration nodes accept through
+// the /cities routes. It should be the catalog the handlers were registered
+// with. Without it the routes answer 501.
+func WithCities(cities weather.Catalog) Option {
+	return func(s *Service) {
+		s.cities = cities
+	}
+}
+
+// WithGeocoder looks up the coordinates of cities added without them, and
+// serves GET /cities/search.
+func WithGeocoder(g weather.Geocoder) Option {
+	return func(s *Service) {
+		s.geocoder = g
+	}
+}
+
+// cityCatalog returns the city catalog, writing a 501 if there is none.
+func (s *Service) cityCatalog(w http.ResponseWriter) (weather.Catalog, bool) {
+	if s.cities == nil {
+		writeError(w, http.StatusNotImplemented, "not_supported", "cities are not configurable")
+		return nil, false
+	}
+	return s.cities, true
+}
+
+// findCity returns the city named by the path and the optional "country"
+// query parameter, enabled or not. It writes a 404 if there is none and a 409
+// if the name is ambiguous.
+func (s *Service) findCity(w http.ResponseWriter, r *http.Request, catalog weather.Catalog) (weather.City, bool) {
+	cities, err := catalog.ListCities(r.Context())
+	if err != nil {
+		writeStoreError(w, err, "load city")
+		return weather.City{}, false
+	}
+	name := mux.Vars(r)["name"]
+	matches := weather.MatchCities(cities, name, r.URL.Query().Get("country"))
+	switch len(matches) {
+	case 0:
+		writeError(w, http.StatusNotFound, "not_found", fmt.Sprintf("city %q not found", name))
+		return weather.City{}, false
+	case 1:
+		return matches[0], true
+	}
+	countries := make([]string, len(matches))
+	for i, c := range matches {
+		countries[i] = c.Country
+	}
+	writeError(w, http.StatusConflict, "ambiguous_city",
+		fmt.Sprintf("there are cities called %q in %s; pick one with ?country=", name, strings.Join(countries, ", ")))
+	return weather.City{}, false
+}
+
+func decodeCityRequest(w http.ResponseWriter, r *http.Request) (*CityRequest, bool) {
+	var req CityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return nil, false
+	}
+	return &req, true
+}
+
+func (s *Service) HandleListCities(w http.ResponseWriter, r *http.Request) {
+	catalog, ok := s.cityCatalog(w)
+	if !ok {
+		return
+	}
+	cities, err := catalog.ListCities(r.Context())
+	if err != nil {
+		writeStoreError(w, err, "list cities")
+		return
+	}
+	respond(w, http.StatusOK, cities)
+}
+
+// HandleSearchCities looks places up with the geocoder, so operators can
+// pick the one to add.
+func (s *Service) HandleSearchCities(w http.ResponseWriter, r *http.Request) {
+	if s.geocoder == nil {
+		writeError(w, http.StatusNotImplemented, "not_supported", "no geocoder is configured")
+		return
+	}
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "invalid_city", "name is required")
+		return
+	}
+	cities, err := s.geocoder.Search(r.Context(), name, r.URL.Query().Get("country"))
+	if err != nil {
+		writeGeocoderError(w, err)
+		return
+	}
+	respond(w, http.StatusOK, cities)
+}
+
+func writeGeocoderError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, "timeout", "geocoding exceeded the request deadline")
+		return
+	}
+	writeError(w, http.StatusBadGateway, "geocoder_failed", err.Error())
+}
+
+// geocode fills in the coordinates, time zone and place ID of a city added
+// without coordinates from the geocoder's best match, or the match with the
+// requested place ID. It writes an error if there is none.
+func (s *Service) geocode(w http.ResponseWriter, r *http.Request, city *weather.City) bool {
+	if s.geocoder == nil {
+		writeError(w, http.StatusBadRequest, "invalid_city", "lat and lon are required")
+		return false
+	}
+	found, err := s.geocoder.Search(r.Context(), city.Name, city.Country)
+	if err != nil {
+		writeGeocoderError(w, err)
+		return false
+	}
+	if city.PlaceID != "" {
+		found = slices.DeleteFunc(found, func(c weather.City) bool { return !strings.EqualFold(c.PlaceID, city.PlaceID) })
+	}
+	if len(found) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_city",
+			fmt.Sprintf("no place called %q found; give lat and lon", city.String()))
+		return false
+	}
+	city.Country, city.Lat, city.Lon, city.PlaceID = found[0].Country, found[0].Lat, found[0].Lon, found[0].PlaceID
+	if city.Timezone == "" {
+		city.Timezone = found[0].Timezone
+	}
+	return true
+}
+
+func (s *Service) HandleCreateCity(w http.ResponseWriter, r *http.Request) {
+	catalog, ok := s.cityCatalog(w)
+	if !ok {
+		return
+	}
+	req, ok := decodeCityRequest(w, r)
+	if !ok {
+		return
+	}
+
+	city := weather.City{Enabled: true}
+	req.apply(&city)
+	if req.Lat == nil || req.Lon == nil {
+		if strings.TrimSpace(city.Name) == "" {
+			writeError(w, http.StatusBadRequest, "invalid_city", "name is required")
+			return
+		}
+		if !s.geocode(w, r, &city) {
+			return
+		}
+	}
+	if err := city.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_city", err.Error())
+		return
+	}
+	if err := catalog.CreateCity(r.Context(), city); err != nil {
+		writeStoreError(w, err, "create city")
+		return
+	}
+	respond(w, http.StatusCreated, city)
+}
+
+func (s *Service) HandleGetCity(w http.ResponseWriter, r *http.Request) {
+	catalog, ok := s.cityCatalog(w)
+	if !ok {
+		return
+	}
+	if city, ok := s.findCity(w, r, catalog); ok {
+		respond(w, http.StatusOK, city)
+	}
+}
+
+func (s *Service) HandleUpdateCity(w http.ResponseWriter, r *http.Request) {
+	catalog, ok := s.cityCatalog(w)
+	if !ok {
+		return
+	}
+	req, ok := decodeCityRequest(w, r)
+	if !ok {
+		return
+	}
+	city, ok := s.findCity(w, r, catalog)
+	if !ok {
+		return
+	}
+	if req.Name != "" && !strings.EqualFold(strings.TrimSpace(req.Name), city.Name) ||
+		req.Country != "" && !strings.EqualFold(strings.TrimSpace(req.Country), city.Country) {
+		writeError(w, http.StatusBadRequest, "invalid_city",
+			fmt.Sprintf("name and country can't change from %q; create a new city instead", city.String()))
+		return
+	}
+
+	req.apply(&city)
+	if err := city.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_city", err.Error())
+		return
+	}
+	if err := catalog.UpdateCity(r.Context(), city); err != nil {
+		writeStoreError(w, err, "update city")
+		return
+	}
+	respond(w, http.StatusOK, city)
+}
+
+func (s *Service) HandleDeleteCity(w http.ResponseWriter, r *http.Request) {
+	catalog, ok := s.cityCatalog(w)
+	if !ok {
+		return
+	}
+	city, ok := s.findCity(w, r, catalog)
+	if !ok {
+		return
+	}
+	if err := catalog.DeleteCity(r.Context(), city.Name, city.Country); err != nil {
+		writeStoreError(w, err, "delete city")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,222 @@
+package workflow
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// DefinitionTTL is how long executions and GET /workflows/{id} use a cached
+// workflow definition before loading it again. Writes through this process
+// forget it at once; the ttl bounds how stale it gets after writes made by
+// other API instances.
+const DefinitionTTL = time.Minute
+
+// definitionCache holds the definitions of workflows, layout laid over, so
+// executions and GETs don't load them from the repository every time. Each
+// process keeps its own.
+type definitionCache struct {
+	mu          sync.Mutex
+	definitions map[string]cachedDefinition
+	// generation counts the definitions forgotten, so one loaded before a
+	// write isn't cached after the write forgot it.
+	generation uint64
+	swept      time.Time
+}
+
+type cachedDefinition struct {
+	wf       *Workflow
+	loadedAt time.Time
+}
+
+func (c *definitionCache) get(id string) (*Workflow, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.definitions[id]
+	if !ok || time.Since(cached.loadedAt) >= DefinitionTTL {
+		return nil, false
+	}
+	return cached.wf, true
+}
+
+// gen returns the generation to pass to put for a definition about to be
+// loaded.
+func (c *definitionCache) gen() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put caches wf, loaded at generation gen, unless a definition was forgotten
+// since. Expired definitions are dropped at most once per DefinitionTTL.
+func (c *definitionCache) put(wf *Workflow, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.generation {
+		return
+	}
+	now := time.Now()
+	if now.Sub(c.swept) >= DefinitionTTL {
+		c.swept = now
+		for id, cached := range c.definitions {
+			if now.Sub(cached.loadedAt) >= DefinitionTTL {
+				delete(c.definitions, id)
+			}
+		}
+	}
+	if c.definitions == nil {
+		c.definitions = make(map[string]cachedDefinition)
+	}
+	c.definitions[wf.ID] = cachedDefinition{wf: wf, loadedAt: now}
+}
+
+func (c *definitionCache) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	delete(c.definitions, id)
+}
+
+// definition returns the stored workflow id with its layout, from the
+// definition cache if it was loaded in the last DefinitionTTL. Callers must
+// not modify it.
+func (s *Service) definition(ctx context.Context, id string) (*Workflow, error) {
+	if wf, ok := s.definitions.get(id); ok {
+		return wf, nil
+	}
+	gen := s.definitions.gen()
+	wf, err := s.loadWorkflow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.definitions.put(wf, gen)
+	return wf, nil
+}
+
+// graphCache holds the compiled graphs of workflows, so executions run them
+// without rebuilding the graph and parsing the node expressions and templates
+// each time. Each process keeps its own.
+type graphCache struct {
+	mu     sync.Mutex
+	graphs map[string]cachedGraph
+}
+
+type cachedGraph struct {
+	key   string
+	graph *engine.Graph
+}
+
+// graphKey identifies the definition a graph is compiled from: the workflow
+// version, and the order of its nodes and edges and the labels of its nodes,
+// which reordering and saving the layout change without a new version.
+// Labels are shown in the steps of execution traces.
+func graphKey(wf *Workflow) string {
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(wf.Version))
+	for _, n := range wf.Nodes {
+		b.WriteString("/" + n.ID + "=" + strconv.Quote(n.Data.Label))
+	}
+	b.WriteString("/")
+	for _, e := range wf.Edges {
+		b.WriteString("/" + e.ID)
+	}
+	return b.String()
+}
+
+func (c *graphCache) get(wf *Workflow) (*engine.Graph, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.graphs[wf.ID]
+	return cached.graph, ok && cached.key == graphKey(wf)
+}
+
+func (c *graphCache) put(wf *Workflow, g *engine.Graph) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.graphs == nil {
+		c.graphs = make(map[string]cachedGraph)
+	}
+	c.graphs[wf.ID] = cachedGraph{key: graphKey(wf), graph: g}
+}
+
+func (c *graphCache) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.graphs, id)
+}
+
+// compileGraph builds and compiles the graph of wf.
+func (s *Service) compileGraph(wf *Workflow) (*engine.Graph, error) {
+	g, err := buildGraph(wf)
+	if err != nil {
+		return nil, err
+	}
+	return s.executor.Compile(g)
+}
+
+// graph returns the compiled graph of wf, compiling it on first use.
+func (s *Service) graph(wf *Workflow) (*engine.Graph, error) {
+	if g, ok := s.graphs.get(wf); ok {
+		return g, nil
+	}
+	g, err := s.compileGraph(wf)
+	if err != nil {
+		return nil, err
+	}
+	s.graphs.put(wf, g)
+	return g, nil
+}
+
+// warmGraph compiles a workflow that was just stored, so its first execution
+// doesn't pay for it.
+func (s *Service) warmGraph(wf *Workflow) {
+	if _, err := s.graph(wf); err != nil {
+		slog.Warn("Failed to compile workflow", "workflowId", wf.ID, "error", err)
+	}
+}
+
+// DefaultWarmGraphs is how many workflows WarmGraphs compiles by default.
+const DefaultWarmGraphs = 100
+
+// WarmGraphs loads and compiles the limit workflows, not archived, executed
+// most recently, e.g. at startup, so the first executions after a deploy
+// don't all load and compile their workflows at once. Their definitions are
+// cached too, so neither those executions nor GETs of the workflows query
+// the repository for them. It returns how many were compiled; workflows
+// that don't compile are logged and left to fail when executed.
+func (s *Service) WarmGraphs(ctx context.Context, limit int) (int, error) {
+	if limit <= 0 {
+		return 0, nil
+	}
+	ids, err := s.repo.ListRecentlyExecutedWorkflowIDs(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+	gen := s.definitions.gen()
+	workflows, err := s.repo.GetWorkflows(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	compiled := 0
+	for _, wf := range workflows {
+		if s.layouts != nil {
+			l, err := s.layouts.GetLayout(ctx, wf.ID)
+			if err != nil {
+				return compiled, err
+			}
+			applyLayout(wf, l)
+		}
+		s.definitions.put(wf, gen)
+		if _, err := s.graph(wf); err != nil {
+			slog.Warn("Failed to compile workflow", "workflowId", wf.ID, "error", err)
+			continue
+		}
+		compiled++
+	}
+	return compiled, nil
+}
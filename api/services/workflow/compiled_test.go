@@ -0,0 +1,61 @@
+package workflow_test
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"workflow-code-test/api/services/workflow"
+)
+
+// countingRepository counts the workflow definitions loaded from the
+// repository it wraps.
+type countingRepository struct {
+	workflow.Repository
+	loads atomic.Int64
+}
+
+func (r *countingRepository) GetWorkflow(ctx context.Context, id string) (*workflow.Workflow, error) {
+	r.loads.Add(1)
+	return r.Repository.GetWorkflow(ctx, id)
+}
+
+func (r *countingRepository) GetWorkflows(ctx context.Context, ids []string) ([]*workflow.Workflow, error) {
+	r.loads.Add(1)
+	return r.Repository.GetWorkflows(ctx, ids)
+}
+
+func TestWarmGraphsCachesDefinitions(t *testing.T) {
+	repo := &countingRepository{Repository: workflow.NewMemoryRepository()}
+	api := newTestAPIWith(t, nil, workflow.WithRepository(repo))
+	api.importYAML("weather_alert.yaml")
+	api.execute(25)
+
+	// Another process over the same repository warms up at startup.
+	restarted := newTestAPIWith(t, nil, workflow.WithRepository(repo))
+	if n, err := restarted.svc.WarmGraphs(context.Background(), 10); err != nil || n != 1 {
+		t.Fatalf("WarmGraphs = %d, %v, want 1 workflow compiled", n, err)
+	}
+	repo.loads.Store(0)
+
+	restarted.execute(25)
+	restarted.execute(15)
+	var wf workflow.Workflow
+	if code := restarted.do(http.MethodGet, "/workflows/"+sampleID, nil, &wf); code != http.StatusOK {
+		t.Fatalf("get workflow: got %d, want 200", code)
+	}
+	if n := repo.loads.Load(); n != 0 {
+		t.Errorf("loaded the workflow %d times after warm-up, want 0", n)
+	}
+
+	// A write through the process forgets the cached definition.
+	layout := map[string]any{"nodes": map[string]any{"start": map[string]any{"label": "Begin"}}}
+	if code := restarted.do(http.MethodPut, "/workflows/"+sampleID+"/layout", layout, nil); code != http.StatusOK {
+		t.Fatalf("save layout: got %d, want 200", code)
+	}
+	restarted.do(http.MethodGet, "/workflows/"+sampleID, nil, &wf)
+	if label := wf.Nodes[0].Data.Label; label != "Begin" {
+		t.Errorf("start node label after saving the layout = %q, want Begin", label)
+	}
+}
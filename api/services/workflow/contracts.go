@@ -0,0 +1,407 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/sandbox"
+)
+
+// maxContractTestNameLength bounds the name of a contract test.
+const maxContractTestNameLength = 100
+
+// Kinds of ContractDeviation.
+const (
+	DeviationStatus = "status"
+	DeviationPath   = "path"
+	DeviationBranch = "branch"
+	DeviationOutput = "output"
+)
+
+// ContractTest is the trace a workflow is expected to produce for some input,
+// so changes to the workflow can be checked against it like code against
+// its tests.
+type ContractTest struct {
+	ID         string         `json:"id"`
+	WorkflowID string         `json:"workflowId"`
+	Name       string         `json:"name"`
+	FormData   map[string]any `json:"formData"`
+	Condition  map[string]any `json:"condition,omitempty"`
+	// Temperature is what weather lookups report while the test runs,
+	// sandbox.DefaultTemperature if not set.
+	Temperature *float64            `json:"temperature,omitempty"`
+	Expect      ContractExpectation `json:"expect"`
+	CreatedAt   time.Time           `json:"createdAt"`
+	UpdatedAt   time.Time           `json:"updatedAt"`
+}
+
+// ContractExpectation is what a contract test checks; parts left out aren't
+// checked. Path lists the nodes run, in order. Branches maps branching nodes
+// to the branch they must take, and Outputs nodes to output values they must
+// produce, e.g. {"weather-api": {"location": "Sydney"}}; the other output
+// keys may hold anything.
+type ContractExpectation struct {
+	Status   string                    `json:"status,omitempty"`
+	Path     []string                  `json:"path,omitempty"`
+	Branches map[string]string         `json:"branches,omitempty"`
+	Outputs  map[string]map[string]any `json:"outputs,omitempty"`
+}
+
+func (e *ContractExpectation) empty() bool {
+	return e.Status == "" && len(e.Path) == 0 && len(e.Branches) == 0 && len(e.Outputs) == 0
+}
+
+// ContractTestRequest is the body of POST and PUT
+// /workflows/{id}/contract-tests. Creating a test without Expect records the
+// status, path and branches of a run of the current workflow as expected.
+type ContractTestRequest struct {
+	Name        string               `json:"name"`
+	FormData    map[string]any       `json:"formData"`
+	Condition   map[string]any       `json:"condition"`
+	Temperature *float64             `json:"temperature"`
+	Expect      *ContractExpectation `json:"expect"`
+}
+
+func (req *ContractTestRequest) validate(update bool) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("name must not be empty")
+	}
+	if len(req.Name) > maxContractTestNameLength {
+		return fmt.Errorf("name must be at most %d characters", maxContractTestNameLength)
+	}
+	if req.FormData == nil {
+		return errors.New("formData must be an object")
+	}
+	if req.Expect == nil {
+		if update {
+			return errors.New("expect must be an object")
+		}
+		return nil
+	}
+	switch engine.ExecutionStatus(req.Expect.Status) {
+	case "", engine.ExecutionStatusCompleted, engine.ExecutionStatusFailed, engine.ExecutionStatusPaused:
+	default:
+		return fmt.Errorf("expect.status must be %q, %q or %q",
+			engine.ExecutionStatusCompleted, engine.ExecutionStatusFailed, engine.ExecutionStatusPaused)
+	}
+	if req.Expect.empty() {
+		return errors.New("expect must check at least one of status, path, branches and outputs")
+	}
+	return nil
+}
+
+// apply copies the request onto t.
+func (req *ContractTestRequest) apply(t *ContractTest) {
+	t.Name = req.Name
+	t.FormData = req.FormData
+	t.Condition = req.Condition
+	t.Temperature = req.Temperature
+	if req.Expect != nil {
+		t.Expect = *req.Expect
+	}
+}
+
+func decodeContractTestRequest(w http.ResponseWriter, r *http.Request, update bool) (*ContractTestRequest, bool) {
+	var req ContractTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return nil, false
+	}
+	if err := req.validate(update); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_contract_test", err.Error())
+		return nil, false
+	}
+	return &req, true
+}
+
+func (s *Service) HandleListContractTests(w http.ResponseWriter, r *http.Request) {
+	workflowID := mux.Vars(r)["id"]
+
+	tests, err := s.repo.ListContractTests(r.Context(), workflowID)
+	if err != nil {
+		writeStoreError(w, err, "list contract tests")
+		return
+	}
+	respond(w, http.StatusOK, tests)
+}
+
+// HandleCreateContractTest stores a contract test. One created without an
+// expectation runs the workflow first to record it.
+func (s *Service) HandleCreateContractTest(w http.ResponseWriter, r *http.Request) {
+	workflowID := mux.Vars(r)["id"]
+	req, ok := decodeContractTestRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	test := &ContractTest{WorkflowID: workflowID}
+	req.apply(test)
+	if req.Expect == nil {
+		wf, err := s.repo.GetWorkflow(r.Context(), workflowID)
+		if err != nil {
+			writeStoreError(w, err, "load workflow")
+			return
+		}
+		sc, _, apiErr := s.runContract(r.Context(), wf, test)
+		if apiErr != nil {
+			apiErr.write(w)
+			return
+		}
+		test.Expect = ContractExpectation{Status: sc.Status, Path: sc.Path, Branches: sc.Branches}
+	}
+	if err := s.repo.CreateContractTest(r.Context(), test); err != nil {
+		writeStoreError(w, err, "create contract test")
+		return
+	}
+	respond(w, http.StatusCreated, test)
+}
+
+func (s *Service) HandleGetContractTest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workflowID, testID := vars["id"], vars["testId"]
+
+	test, err := s.repo.GetContractTest(r.Context(), workflowID, testID)
+	if err != nil {
+		writeStoreError(w, err, "load contract test")
+		return
+	}
+	respond(w, http.StatusOK, test)
+}
+
+func (s *Service) HandleUpdateContractTest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workflowID, testID := vars["id"], vars["testId"]
+	req, ok := decodeContractTestRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	test, err := s.repo.GetContractTest(r.Context(), workflowID, testID)
+	if err != nil {
+		writeStoreError(w, err, "load contract test")
+		return
+	}
+	req.apply(test)
+	if err := s.repo.UpdateContractTest(r.Context(), test); err != nil {
+		writeStoreError(w, err, "update contract test")
+		return
+	}
+	respond(w, http.StatusOK, test)
+}
+
+func (s *Service) HandleDeleteContractTest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workflowID, testID := vars["id"], vars["testId"]
+
+	if err := s.repo.DeleteContractTest(r.Context(), workflowID, testID); err != nil {
+		writeStoreError(w, err, "delete contract test")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ContractRunResponse reports a run of a workflow's contract tests.
+type ContractRunResponse struct {
+	WorkflowID      string               `json:"workflowId"`
+	WorkflowVersion int                  `json:"workflowVersion"`
+	Passed          int                  `json:"passed"`
+	Failed          int                  `json:"failed"`
+	Results         []ContractTestResult `json:"results"`
+}
+
+// ContractTestResult is the outcome of one contract test: the trace the
+// workflow produced and how it deviates from the expected one.
+type ContractTestResult struct {
+	TestID     string              `json:"testId"`
+	Name       string              `json:"name"`
+	Passed     bool                `json:"passed"`
+	Status     string              `json:"status"`
+	Path       []string            `json:"path"`
+	Branches   map[string]string   `json:"branches"`
+	Error      string              `json:"error,omitempty"`
+	Deviations []ContractDeviation `json:"deviations"`
+}
+
+// ContractDeviation is one way a run differs from its expected trace.
+type ContractDeviation struct {
+	Kind     string `json:"kind"`
+	NodeID   string `json:"nodeId,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Expected any    `json:"expected"`
+	Actual   any    `json:"actual"`
+	Message  string `json:"message"`
+}
+
+// HandleRunContractTests runs every contract test of the workflow against its
+// current definition and reports the deviations from the expected traces.
+// Runs use the sandbox handlers like simulations, and aren't recorded.
+func (s *Service) HandleRunContractTests(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	wf, err := s.loadWorkflow(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+	tests, err := s.repo.ListContractTests(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "list contract tests")
+		return
+	}
+
+	resp := ContractRunResponse{WorkflowID: id, WorkflowVersion: wf.Version, Results: make([]ContractTestResult, 0, len(tests))}
+	for _, test := range tests {
+		sc, outputs, apiErr := s.runContract(r.Context(), wf, test)
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			return
+		}
+		if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			writeError(w, http.StatusGatewayTimeout, "timeout",
+				fmt.Sprintf("contract tests exceeded the request deadline after %d of %d tests", len(resp.Results), len(tests)))
+			return
+		}
+		if apiErr != nil {
+			apiErr.write(w)
+			return
+		}
+
+		result := ContractTestResult{
+			TestID:     test.ID,
+			Name:       test.Name,
+			Status:     sc.Status,
+			Path:       sc.Path,
+			Branches:   sc.Branches,
+			Error:      sc.Error,
+			Deviations: test.Expect.deviations(sc, outputs),
+		}
+		result.Passed = len(result.Deviations) == 0
+		if result.Passed {
+			resp.Passed++
+		} else {
+			resp.Failed++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	respond(w, http.StatusOK, resp)
+}
+
+// runContract runs wf with the input of test in the sandbox. It returns the
+// run's scenario and the last output of every node run, or an error if the
+// workflow can't run at all.
+func (s *Service) runContract(ctx context.Context, wf *Workflow, test *ContractTest) (Scenario, map[string]map[string]any, *apiError) {
+	graph, err := s.graph(wf)
+	if err != nil {
+		return Scenario{}, nil, engineError(err)
+	}
+	run := executionRun{
+		WorkflowID:      wf.ID,
+		WorkflowVersion: wf.Version,
+		TriggeredBy:     TriggerAPI,
+		Bindings:        s.sandboxBindings(),
+		Pins:            wf.HandlerVersions,
+		Budget:          wf.Budget,
+	}
+	ctx = engine.WithLabels(s.withClock(ctx), run.labels())
+	if test.Temperature != nil {
+		ctx = sandbox.WithTemperature(ctx, *test.Temperature)
+	}
+	input := map[string]any{"formData": test.FormData, "condition": test.Condition}
+
+	exec, err := s.executor.Execute(ctx, graph, input)
+	if err != nil && (exec == nil || engine.IsGraphError(err)) {
+		return Scenario{}, nil, engineError(err)
+	}
+
+	var t float64
+	if test.Temperature != nil {
+		t = *test.Temperature
+	}
+	outputs := make(map[string]map[string]any)
+	for _, step := range exec.Steps {
+		if !step.Compensation && step.Output != nil {
+			outputs[step.NodeID] = step.Output
+		}
+	}
+	// Compare outputs in the shapes they are stored and expected in.
+	return simulatedScenario(wf, t, exec, err), clone(outputs), nil
+}
+
+// deviations compares a run against e.
+func (e *ContractExpectation) deviations(sc Scenario, outputs map[string]map[string]any) []ContractDeviation {
+	out := []ContractDeviation{}
+	if e.Status != "" && e.Status != sc.Status {
+		out = append(out, ContractDeviation{
+			Kind: DeviationStatus, Expected: e.Status, Actual: sc.Status,
+			Message: fmt.Sprintf("execution %s instead of %s", sc.Status, e.Status),
+		})
+	}
+
+	if len(e.Path) > 0 && !slices.Equal(e.Path, sc.Path) {
+		i := 0
+		for i < len(e.Path) && i < len(sc.Path) && e.Path[i] == sc.Path[i] {
+			i++
+		}
+		msg := fmt.Sprintf("path differs at step %d", i)
+		switch {
+		case i == len(sc.Path):
+			msg = fmt.Sprintf("path ends after %d steps, before %s", i, e.Path[i])
+		case i == len(e.Path):
+			msg = fmt.Sprintf("path continues after %d steps with %s", i, sc.Path[i])
+		default:
+			msg += fmt.Sprintf(": %s ran instead of %s", sc.Path[i], e.Path[i])
+		}
+		out = append(out, ContractDeviation{Kind: DeviationPath, Expected: e.Path, Actual: sc.Path, Message: msg})
+	}
+
+	for _, nodeID := range slices.Sorted(maps.Keys(e.Branches)) {
+		want, got := e.Branches[nodeID], sc.Branches[nodeID]
+		if want == got {
+			continue
+		}
+		msg := fmt.Sprintf("%s took branch %q instead of %q", nodeID, got, want)
+		var actual any = got
+		if got == "" {
+			msg, actual = fmt.Sprintf("%s took no branch, expected %q", nodeID, want), nil
+		}
+		out = append(out, ContractDeviation{Kind: DeviationBranch, NodeID: nodeID, Expected: want, Actual: actual, Message: msg})
+	}
+
+	for _, nodeID := range slices.Sorted(maps.Keys(e.Outputs)) {
+		output, ran := outputs[nodeID]
+		for _, key := range slices.Sorted(maps.Keys(e.Outputs[nodeID])) {
+			want := e.Outputs[nodeID][key]
+			got, ok := output[key]
+			if ok && reflect.DeepEqual(want, got) {
+				continue
+			}
+			msg := fmt.Sprintf("%s output %s is %s instead of %s", nodeID, key, jsonText(got), jsonText(want))
+			switch {
+			case !ran:
+				msg = fmt.Sprintf("%s didn't output anything", nodeID)
+			case !ok:
+				msg = fmt.Sprintf("%s didn't output %s", nodeID, key)
+			}
+			out = append(out, ContractDeviation{Kind: DeviationOutput, NodeID: nodeID, Key: key, Expected: want, Actual: got, Message: msg})
+		}
+	}
+	return out
+}
+
+func jsonText(v any) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(raw)
+}
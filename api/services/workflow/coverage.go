@@ -0,0 +1,144 @@
+package workflow
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// StepCoverage counts, among the stored executions of a workflow, those that
+// ran each node and those in which a step of one node was directly followed
+// by a step of another.
+type StepCoverage struct {
+	Executions  int
+	Nodes       map[string]Exercised
+	Transitions map[Transition]Exercised
+}
+
+// Transition is a step of node From followed by a step of node To.
+type Transition struct {
+	From, To string
+}
+
+// Exercised counts the executions that exercised a node or transition and
+// when the latest of them started.
+type Exercised struct {
+	Executions int
+	LastAt     time.Time
+}
+
+// add counts an execution started at startedAt.
+func (e Exercised) add(startedAt time.Time) Exercised {
+	e.Executions++
+	if startedAt.After(e.LastAt) {
+		e.LastAt = startedAt
+	}
+	return e
+}
+
+// CoverageResponse reports which nodes and edges of a workflow its stored
+// executions exercised.
+type CoverageResponse struct {
+	WorkflowID string     `json:"workflowId"`
+	Since      *time.Time `json:"since,omitempty"`
+	Executions int        `json:"executions"`
+	// NodeCoverage and EdgeCoverage are the fractions of nodes and edges
+	// exercised at least once, 0 for workflows without executions.
+	NodeCoverage float64        `json:"nodeCoverage"`
+	EdgeCoverage float64        `json:"edgeCoverage"`
+	Nodes        []NodeCoverage `json:"nodes"`
+	Edges        []EdgeCoverage `json:"edges"`
+}
+
+type NodeCoverage struct {
+	NodeID     string     `json:"nodeId"`
+	Type       string     `json:"type"`
+	Executions int        `json:"executions"`
+	LastRunAt  *time.Time `json:"lastRunAt"`
+}
+
+type EdgeCoverage struct {
+	EdgeID       string     `json:"edgeId"`
+	Source       string     `json:"source"`
+	Target       string     `json:"target"`
+	SourceHandle string     `json:"sourceHandle,omitempty"`
+	Executions   int        `json:"executions"`
+	LastTakenAt  *time.Time `json:"lastTakenAt"`
+}
+
+// HandleWorkflowCoverage reports the branch coverage of a workflow: how many
+// executions ran each node and followed each edge, and when last. It covers
+// every stored execution, or those started within ?window=.
+func (s *Service) HandleWorkflowCoverage(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var since time.Time
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid_window", "window must be a positive duration such as 24h")
+			return
+		}
+		since = s.clock.Now().Add(-d)
+	}
+
+	wf, err := s.repo.GetWorkflow(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+	coverage, err := s.repo.GetStepCoverage(r.Context(), id, since)
+	if err != nil {
+		writeStoreError(w, err, "load step coverage")
+		return
+	}
+
+	resp := workflowCoverage(wf, coverage)
+	if !since.IsZero() {
+		resp.Since = &since
+	}
+	respond(w, http.StatusOK, resp)
+}
+
+// workflowCoverage maps coverage onto the nodes and edges of wf. An edge
+// counts as followed when steps of its source and target ran in a row; the
+// per-step table doesn't tell which of several edges between the same two
+// nodes was taken, so each of them counts.
+func workflowCoverage(wf *Workflow, coverage *StepCoverage) CoverageResponse {
+	resp := CoverageResponse{
+		WorkflowID: wf.ID,
+		Executions: coverage.Executions,
+		Nodes:      []NodeCoverage{},
+		Edges:      make([]EdgeCoverage, 0, len(wf.Edges)),
+	}
+
+	var covered int
+	for _, n := range wf.Nodes {
+		if IsAnnotation(n.Type) {
+			continue
+		}
+		nc := NodeCoverage{NodeID: n.ID, Type: n.Type}
+		if ex, ok := coverage.Nodes[n.ID]; ok {
+			nc.Executions, nc.LastRunAt = ex.Executions, &ex.LastAt
+			covered++
+		}
+		resp.Nodes = append(resp.Nodes, nc)
+	}
+	if len(resp.Nodes) > 0 {
+		resp.NodeCoverage = float64(covered) / float64(len(resp.Nodes))
+	}
+
+	covered = 0
+	for _, e := range wf.Edges {
+		ec := EdgeCoverage{EdgeID: e.ID, Source: e.Source, Target: e.Target, SourceHandle: e.SourceHandle}
+		if ex, ok := coverage.Transitions[Transition{From: e.Source, To: e.Target}]; ok {
+			ec.Executions, ec.LastTakenAt = ex.Executions, &ex.LastAt
+			covered++
+		}
+		resp.Edges = append(resp.Edges, ec)
+	}
+	if len(resp.Edges) > 0 {
+		resp.EdgeCoverage = float64(covered) / float64(len(resp.Edges))
+	}
+	return resp
+}
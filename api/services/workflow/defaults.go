@@ -0,0 +1,49 @@
+package workflow
+
+import "maps"
+
+// defaultsForAllNodes is the Defaults key applying to every node type.
+const defaultsForAllNodes = "*"
+
+// nodeMetadata returns the metadata of n with the workflow defaults filled in.
+// Node metadata wins over type defaults, which win over defaults for all
+// nodes. Nested objects such as emailTemplate are merged key by key.
+func (wf *Workflow) nodeMetadata(n Node) map[string]any {
+	all, typed := wf.Defaults[defaultsForAllNodes], wf.Defaults[n.Type]
+	if len(all) == 0 && len(typed) == 0 {
+		return n.Data.Metadata
+	}
+	return mergeMetadata(mergeMetadata(all, typed), n.Data.Metadata)
+}
+
+// withDefaults returns a copy of wf whose nodes carry their effective
+// metadata.
+func (wf *Workflow) withDefaults() *Workflow {
+	if len(wf.Defaults) == 0 {
+		return wf
+	}
+	resolved := *wf
+	resolved.Nodes = make([]Node, len(wf.Nodes))
+	for i, n := range wf.Nodes {
+		n.Data.Metadata = wf.nodeMetadata(n)
+		resolved.Nodes[i] = n
+	}
+	return &resolved
+}
+
+// mergeMetadata returns base overlaid with override, merging nested objects.
+func mergeMetadata(base, override map[string]any) map[string]any {
+	out := maps.Clone(base)
+	if out == nil {
+		out = make(map[string]any, len(override))
+	}
+	for k, v := range override {
+		sub, ok := v.(map[string]any)
+		if baseSub, baseOK := out[k].(map[string]any); ok && baseOK {
+			out[k] = mergeMetadata(baseSub, sub)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
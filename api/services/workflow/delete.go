@@ -0,0 +1,49 @@
+package workflow
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// WorkflowDeletion selects how DeleteWorkflow removes a workflow.
+type WorkflowDeletion struct {
+	// Hard removes the workflow and everything attached to it instead of
+	// marking it deleted.
+	Hard bool
+	// Executions lets a hard delete remove the workflow's executions.
+	Executions bool
+}
+
+// HandleDeleteWorkflow soft-deletes a workflow: it is hidden from every read
+// but its rows, executions included, are kept. With ?hard=true it is removed
+// for good along with its nodes, edges, hooks, receivers and presets, and
+// with ?executions=true its executions too.
+func (s *Service) HandleDeleteWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var opts WorkflowDeletion
+	for name, flag := range map[string]*bool{"hard": &opts.Hard, "executions": &opts.Executions} {
+		raw := r.URL.Query().Get(name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_deletion", name+" must be true or false")
+			return
+		}
+		*flag = v
+	}
+	if opts.Executions && !opts.Hard {
+		writeError(w, http.StatusBadRequest, "invalid_deletion", "executions=true requires hard=true")
+		return
+	}
+
+	if err := s.repo.DeleteWorkflow(r.Context(), id, opts); err != nil {
+		writeStoreError(w, err, "delete workflow")
+		return
+	}
+	s.forgetWorkflow(r.Context(), id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,417 @@
+package workflow
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/engine/handlers"
+)
+
+// unmetDependency is a state variable a node reads that the nodes before it
+// don't set on every path from the start node.
+type unmetDependency struct {
+	NodeID   string
+	Variable string
+	// Partial is set when some paths to the node set the variable; otherwise
+	// none do and the node can't get it.
+	Partial bool
+}
+
+func (d unmetDependency) message() string {
+	if d.Partial {
+		return fmt.Sprintf("Node %q reads %q, which is only set on some paths leading to it.", d.NodeID, d.Variable)
+	}
+	return fmt.Sprintf("Node %q reads %q, but no node before it sets it.", d.NodeID, d.Variable)
+}
+
+// requiredVariables returns the state variables a node's handler reads: its
+// inputVariables, the implicit inputs of its type, the items of loops, the
+// paths of conditions, classify nodes, transforms and query params and the placeholders of email,
+// dedupe, counter, kvstore, issue, incident, MQTT, saga and sheet column
+// templates and of rate limit keys.
+func requiredVariables(n Node) []string {
+	if disabled, _ := n.Data.Metadata["disabled"].(bool); disabled || IsAnnotation(n.Type) {
+		return nil
+	}
+	vars := metadataStrings(n.Data.Metadata, "inputVariables")
+	vars = append(vars, rateLimitKeyVariables(n)...)
+	_, pinned := n.Data.Metadata["location"]
+	variable, _ := n.Data.Metadata["variable"].(string)
+	switch n.Type {
+	case "integration":
+		if !pinned {
+			vars = append(vars, "city")
+		}
+	case "wait_until":
+		if !pinned {
+			vars = append(vars, "city")
+		}
+		// Each poll sets the temperature before comparing.
+		for _, v := range pathHeads(variable) {
+			if v != "temperature" {
+				vars = append(vars, v)
+			}
+		}
+	case "condition":
+		// Conditions given as execution input still compare the temperature.
+		if variable != "" {
+			vars = append(vars, pathHeads(variable)...)
+		} else {
+			vars = append(vars, "temperature")
+		}
+	case "loop":
+		if items, _ := n.Data.Metadata["items"].(string); items != "" {
+			vars = append(vars, items)
+		}
+	case "email":
+		if recipients := handlers.EmailRecipientsVariable(n.Data.Metadata); recipients != "" {
+			vars = append(vars, recipients)
+		}
+		if tmpl, ok := n.Data.Metadata["emailTemplate"].(map[string]any); ok {
+			for _, key := range []string{"subject", "body"} {
+				s, _ := tmpl[key].(string)
+				vars = append(vars, engine.TemplateVariables(s)...)
+			}
+		}
+	case "transform":
+		if source, _ := n.Data.Metadata["source"].(string); source != "" {
+			vars = append(vars, source)
+		} else if mappings, ok := n.Data.Metadata["mappings"].(map[string]any); ok {
+			for _, expr := range mappings {
+				if s, ok := expr.(string); ok {
+					vars = append(vars, pathHeads(s)...)
+				}
+			}
+		}
+	case "counter":
+		name, _ := n.Data.Metadata["name"].(string)
+		vars = append(vars, engine.TemplateVariables(name)...)
+	case "kvstore":
+		key, _ := n.Data.Metadata["key"].(string)
+		vars = append(vars, engine.TemplateVariables(key)...)
+		if operation, _ := n.Data.Metadata["operation"].(string); operation == "set" {
+			vars = append(vars, pathHeads(variable)...)
+		}
+	case "query":
+		vars = append(vars, queryParamHeads(n)...)
+	case "classify":
+		vars = append(vars, pathHeads(variable)...)
+	case "jira_issue", "github_issue":
+		vars = append(vars, issueTemplateVariables(n)...)
+	case "pagerduty_incident", "opsgenie_incident":
+		vars = append(vars, incidentTemplateVariables(n)...)
+	case "sheets_append":
+		vars = append(vars, columnVariables(n)...)
+	case "mqtt_publish":
+		vars = append(vars, metadataTemplateVariables(n, "topic", "payload")...)
+	case "saga_reserve", "saga_confirm", "saga_cancel":
+		vars = append(vars, metadataTemplateVariables(n, "url", "body")...)
+	case "dedupe":
+		// The date defaults to today.
+		key, _ := n.Data.Metadata["key"].(string)
+		for _, v := range engine.TemplateVariables(key) {
+			if v != "date" {
+				vars = append(vars, v)
+			}
+		}
+	}
+	slices.Sort(vars)
+	return slices.Compact(vars)
+}
+
+// producedVariables returns the state variables a node's handler sets.
+func producedVariables(n Node) []string {
+	if disabled, _ := n.Data.Metadata["disabled"].(bool); disabled || IsAnnotation(n.Type) {
+		return nil
+	}
+	outputs := metadataStrings(n.Data.Metadata, "outputVariables")
+	switch n.Type {
+	case "form":
+		if mode, _ := n.Data.Metadata["mode"].(string); mode == "wizard" {
+			var names []string
+			fields, _ := n.Data.Metadata["fields"].([]any)
+			for _, f := range fields {
+				if field, ok := f.(map[string]any); ok {
+					if name, _ := field["name"].(string); name != "" {
+						names = append(names, name)
+					}
+					if kind, _ := field["type"].(string); kind == "city" {
+						names = append(names, handlers.LocationVariable)
+					}
+				}
+			}
+			return names
+		}
+		// Only submitted fields are copied into the state, a city with its
+		// resolved location.
+		inputs := metadataStrings(n.Data.Metadata, "inputFields")
+		outputs = slices.DeleteFunc(outputs, func(v string) bool { return !slices.Contains(inputs, v) })
+		if slices.Contains(outputs, "city") {
+			outputs = append(outputs, handlers.LocationVariable)
+		}
+		return outputs
+	case "integration":
+		return append(outputs, "temperature")
+	case "wait_until":
+		return append(outputs, "temperature", "conditionMet")
+	case "condition":
+		return []string{"conditionMet", "operator", "threshold"}
+	case "loop":
+		if collect, _ := n.Data.Metadata["collect"].(string); collect != "" {
+			return append([]string{engine.LoopVariable}, stateOutput(outputs, "results")...)
+		}
+		return []string{engine.LoopVariable}
+	case "email":
+		return []string{"emailSent"}
+	case "validate":
+		return []string{"validationErrors"}
+	case "counter":
+		return stateOutput(outputs, "count")
+	case "kvstore":
+		if operation, _ := n.Data.Metadata["operation"].(string); operation == "set" {
+			return nil
+		}
+		return stateOutput(outputs, "value")
+	case "classify":
+		return stateOutput(outputs, "category")
+	case "jira_issue", "github_issue":
+		return []string{"issueKey", "issueUrl"}
+	case "pagerduty_incident", "opsgenie_incident":
+		return []string{"incidentKey"}
+	case "saga_reserve":
+		return stateOutput(outputs, "reservationId")
+	case "query":
+		mappings, _ := n.Data.Metadata["mappings"].(map[string]any)
+		return append(stateOutput(outputs, "rows"), slices.Collect(maps.Keys(mappings))...)
+	case "transform":
+		mappings, _ := n.Data.Metadata["mappings"].(map[string]any)
+		names := make([]string, 0, len(mappings))
+		for name := range mappings {
+			names = append(names, name)
+		}
+		return names
+	}
+	return outputs
+}
+
+// rateLimitKeyVariables returns the variables the key of a node's rate limit
+// reads.
+func rateLimitKeyVariables(n Node) []string {
+	limit, _ := n.Data.Metadata["rateLimit"].(map[string]any)
+	key, _ := limit["key"].(string)
+	return engine.TemplateVariables(key)
+}
+
+// queryParamHeads returns the variables the params of a query node read.
+// Parameters the node doesn't map read the variable of the same name, which
+// is only known to the query catalog.
+func queryParamHeads(n Node) []string {
+	var vars []string
+	params, _ := n.Data.Metadata["params"].(map[string]any)
+	for _, expr := range params {
+		if s, ok := expr.(string); ok {
+			vars = append(vars, pathHeads(s)...)
+		}
+	}
+	return vars
+}
+
+func isIssueNode(nodeType string) bool {
+	return nodeType == "jira_issue" || nodeType == "github_issue"
+}
+
+// issueTemplateVariables returns the placeholders of an issue node's title and
+// body.
+func issueTemplateVariables(n Node) []string {
+	return metadataTemplateVariables(n, "title", "body")
+}
+
+func isSagaNode(nodeType string) bool {
+	return nodeType == "saga_reserve" || nodeType == "saga_confirm" || nodeType == "saga_cancel"
+}
+
+func isIncidentNode(nodeType string) bool {
+	return nodeType == "pagerduty_incident" || nodeType == "opsgenie_incident"
+}
+
+// incidentTemplateVariables returns the placeholders of an incident node's
+// summary, dedup key and source.
+func incidentTemplateVariables(n Node) []string {
+	return metadataTemplateVariables(n, "summary", "dedupKey", "source")
+}
+
+// metadataTemplateVariables returns the placeholders of the node's metadata
+// templates at keys.
+func metadataTemplateVariables(n Node, keys ...string) []string {
+	var vars []string
+	for _, key := range keys {
+		s, _ := n.Data.Metadata[key].(string)
+		vars = append(vars, engine.TemplateVariables(s)...)
+	}
+	return vars
+}
+
+// columnVariables returns the placeholders of a sheets_append node's columns.
+func columnVariables(n Node) []string {
+	var vars []string
+	for _, c := range metadataStrings(n.Data.Metadata, "columns") {
+		vars = append(vars, engine.TemplateVariables(c)...)
+	}
+	return vars
+}
+
+// stateOutput returns the variable counter and kvstore nodes set: the first
+// of their outputVariables, or fallback.
+func stateOutput(outputs []string, fallback string) []string {
+	if len(outputs) > 0 {
+		return outputs[:1]
+	}
+	return []string{fallback}
+}
+
+// unmetDependencies checks that every variable a node reachable from the start
+// node reads is set by the nodes before it, on every path. Definitions the
+// engine can't run are not analysed.
+func unmetDependencies(wf *Workflow) []unmetDependency {
+	wf = wf.withDefaults()
+	graph, err := buildGraph(wf)
+	if err != nil {
+		return nil
+	}
+	byID := make(map[string]Node, len(wf.Nodes))
+	for _, n := range wf.Nodes {
+		byID[n.ID] = n
+	}
+
+	// Visit nodes in topological order, so a node's predecessors are
+	// done before it. may holds the variables set on some path to a node,
+	// must those set on all paths.
+	order := topologicalOrder(graph)
+	may := map[string]map[string]bool{graph.Start().ID: {}}
+	must := map[string]map[string]bool{graph.Start().ID: {}}
+	var unmet []unmetDependency
+	for _, id := range order {
+		in, ok := may[id]
+		if !ok {
+			continue // unreachable
+		}
+		n := byID[id]
+		for _, v := range requiredVariables(n) {
+			if !must[id][v] {
+				unmet = append(unmet, unmetDependency{NodeID: id, Variable: v, Partial: in[v]})
+			}
+		}
+
+		mayOut, mustOut := maps.Clone(in), maps.Clone(must[id])
+		for _, v := range producedVariables(n) {
+			mayOut[v], mustOut[v] = true, true
+		}
+		for _, e := range graph.Outgoing(id) {
+			if _, seen := may[e.Target]; !seen {
+				may[e.Target], must[e.Target] = maps.Clone(mayOut), maps.Clone(mustOut)
+				continue
+			}
+			for v := range mayOut {
+				may[e.Target][v] = true
+			}
+			for v := range must[e.Target] {
+				if !mustOut[v] {
+					delete(must[e.Target], v)
+				}
+			}
+		}
+	}
+	return unmet
+}
+
+// topologicalOrder returns the node ids of a graph so that every edge points
+// forward, except those leading back to a loop node from its body, so nodes
+// are ordered as in the first iteration.
+func topologicalOrder(g *engine.Graph) []string {
+	back := loopBackEdges(g)
+	indegree := make(map[string]int)
+	for _, e := range g.Edges() {
+		if !back[e.ID] {
+			indegree[e.Target]++
+		}
+	}
+	var queue, order []string
+	for _, n := range g.Nodes() {
+		if indegree[n.ID] == 0 {
+			queue = append(queue, n.ID)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		order = append(order, id)
+		for _, e := range g.Outgoing(id) {
+			if back[e.ID] {
+				continue
+			}
+			if indegree[e.Target]--; indegree[e.Target] == 0 {
+				queue = append(queue, e.Target)
+			}
+		}
+	}
+	return order
+}
+
+// loopBackEdges returns the ids of the edges into loop nodes from nodes
+// reachable from them. Every cycle the engine accepts has one.
+func loopBackEdges(g *engine.Graph) map[string]bool {
+	outgoing := make(map[string][]Edge)
+	for _, e := range g.Edges() {
+		outgoing[e.Source] = append(outgoing[e.Source], Edge{ID: e.ID, Source: e.Source, Target: e.Target})
+	}
+	back := make(map[string]bool)
+	for _, n := range g.Nodes() {
+		if n.Type != engine.NodeTypeLoop {
+			continue
+		}
+		body := reachableFrom(outgoing, n.ID)
+		for _, e := range g.Edges() {
+			if e.Target == n.ID && body[e.Source] {
+				back[e.ID] = true
+			}
+		}
+	}
+	return back
+}
+
+// checkDependencies returns a field error for every variable a node reads
+// that no node before it sets.
+func checkDependencies(wf *Workflow) []FieldError {
+	var errs []FieldError
+	for _, d := range unmetDependencies(wf) {
+		if d.Partial {
+			continue
+		}
+		errs = append(errs, FieldError{
+			Field:   fmt.Sprintf("nodes[%s]", d.NodeID),
+			Message: fmt.Sprintf("reads %q, which no node before it sets", d.Variable),
+		})
+	}
+	return errs
+}
+
+func lintDependencies(wf *Workflow) []LintWarning {
+	var warnings []LintWarning
+	for _, d := range unmetDependencies(wf) {
+		severity, suggestion := SeverityError, fmt.Sprintf("Add a node that sets %q before %q, e.g. in its outputVariables.", d.Variable, d.NodeID)
+		if d.Partial {
+			severity = SeverityWarning
+			suggestion = fmt.Sprintf("Set %q on every path to %q, or move the node after the paths join.", d.Variable, d.NodeID)
+		}
+		warnings = append(warnings, LintWarning{
+			Rule:       "unmet_dependency",
+			Severity:   severity,
+			NodeID:     d.NodeID,
+			Message:    d.message(),
+			Suggestion: suggestion,
+		})
+	}
+	return warnings
+}
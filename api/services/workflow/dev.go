@@ -0,0 +1,25 @@
+package workflow
+
+import (
+	"net/http"
+
+	"workflow-code-test/api/pkg/email"
+)
+
+// WithOutbox serves the emails recorded in outbox at GET /dev/outbox. It is
+// meant for local development; without it the route answers 501.
+func WithOutbox(outbox *email.Outbox) Option {
+	return func(s *Service) {
+		s.outbox = outbox
+	}
+}
+
+// HandleListOutbox lists the emails mock clients "sent", newest first, so
+// frontend developers can check them without a mail server.
+func (s *Service) HandleListOutbox(w http.ResponseWriter, r *http.Request) {
+	if s.outbox == nil {
+		writeError(w, http.StatusNotImplemented, "not_supported", "the outbox is only kept in dev mode (DEV_MODE=true)")
+		return
+	}
+	respond(w, http.StatusOK, s.outbox.List())
+}
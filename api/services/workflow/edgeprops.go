@@ -0,0 +1,160 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// EdgeTypes are the edge renderers built into the editor.
+var EdgeTypes = []string{"default", "straight", "step", "smoothstep", "simplebezier"}
+
+// EdgeProps are the presentation fields the editor sets on an edge. Fields the
+// backend doesn't model (markerEnd, ...) are kept in Extra and written back
+// unchanged.
+type EdgeProps struct {
+	Type       string         `json:"type,omitempty"`
+	Animated   bool           `json:"animated,omitempty"`
+	Label      string         `json:"label,omitempty"`
+	Style      map[string]any `json:"style,omitempty"`
+	LabelStyle map[string]any `json:"labelStyle,omitempty"`
+	Extra      map[string]any `json:"-"`
+}
+
+// FieldError describes one invalid field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// fields returns the props as a flat JSON object.
+func (p EdgeProps) fields() map[string]any {
+	out := maps.Clone(p.Extra)
+	if out == nil {
+		out = make(map[string]any)
+	}
+	if p.Type != "" {
+		out["type"] = p.Type
+	}
+	if p.Animated {
+		out["animated"] = true
+	}
+	if p.Label != "" {
+		out["label"] = p.Label
+	}
+	if len(p.Style) > 0 {
+		out["style"] = p.Style
+	}
+	if len(p.LabelStyle) > 0 {
+		out["labelStyle"] = p.LabelStyle
+	}
+	return out
+}
+
+// MarshalJSON encodes the props flat, as they appear on an edge.
+func (p EdgeProps) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.fields())
+}
+
+// UnmarshalJSON decodes flat props, failing on the first malformed field.
+func (p *EdgeProps) UnmarshalJSON(data []byte) error {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	props, errs := decodeEdgeProps("edge", raw)
+	if len(errs) > 0 {
+		return fmt.Errorf("%s: %s", errs[0].Field, errs[0].Message)
+	}
+	*p = props
+	return nil
+}
+
+// decodeEdgeProps converts the non-core fields of an edge into EdgeProps. Each
+// malformed field is reported, prefixed with the edge's path, and left out.
+func decodeEdgeProps(path string, raw map[string]any) (EdgeProps, []FieldError) {
+	var (
+		p    EdgeProps
+		errs []FieldError
+	)
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, FieldError{Field: path + "." + field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(raw)) {
+		v := raw[k]
+		switch k {
+		case "type":
+			s, ok := v.(string)
+			if !ok || !slices.Contains(EdgeTypes, s) {
+				fail(k, "must be one of %s", strings.Join(EdgeTypes, ", "))
+				continue
+			}
+			p.Type = s
+		case "animated":
+			b, ok := v.(bool)
+			if !ok {
+				fail(k, "must be a boolean")
+				continue
+			}
+			p.Animated = b
+		case "label":
+			s, ok := v.(string)
+			if !ok {
+				fail(k, "must be a string")
+				continue
+			}
+			p.Label = s
+		case "style", "labelStyle":
+			style, msg := decodeStyle(v)
+			if msg != "" {
+				fail(k, "%s", msg)
+				continue
+			}
+			if k == "style" {
+				p.Style = style
+			} else {
+				p.LabelStyle = style
+			}
+		default:
+			if p.Extra == nil {
+				p.Extra = make(map[string]any)
+			}
+			p.Extra[k] = v
+		}
+	}
+	return p, errs
+}
+
+// decodeStyle checks a CSS style object: property names mapped to strings or
+// numbers.
+func decodeStyle(v any) (map[string]any, string) {
+	style, ok := v.(map[string]any)
+	if !ok {
+		return nil, "must be an object"
+	}
+	for _, k := range slices.Sorted(maps.Keys(style)) {
+		switch style[k].(type) {
+		case string, float64, int, int64:
+		default:
+			return nil, fmt.Sprintf("property %q must be a string or number", k)
+		}
+	}
+	return style, ""
+}
+
+// edgePropsFromJSON decodes stored edge props, failing on malformed data
+// instead of dropping it.
+func edgePropsFromJSON(edgeID string, data []byte) (EdgeProps, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return EdgeProps{}, fmt.Errorf("edge %s: invalid edge props: %w", edgeID, err)
+	}
+	p, errs := decodeEdgeProps("edge_props", raw)
+	if len(errs) > 0 {
+		return EdgeProps{}, fmt.Errorf("edge %s: invalid edge props: %s: %s", edgeID, errs[0].Field, errs[0].Message)
+	}
+	return p, nil
+}
@@ -0,0 +1,158 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/fieldcrypt"
+)
+
+// Encrypted columns hold the run state and traces, which contain what users
+// entered in forms: names, email addresses, phone numbers.
+const (
+	aadFinalContext = "executions.final_context/"
+	aadTrace        = "executions.execution_trace/"
+	aadStep         = "execution_steps.step/"
+)
+
+// WithKeyring encrypts the final context, trace and steps of executions
+// written from now on with keys. Values written before are still read.
+func (r *PostgresRepository) WithKeyring(keys *fieldcrypt.Keyring) *PostgresRepository {
+	r.keys = keys
+	return r
+}
+
+// sealJSON encodes v for an encrypted column. aad names the column and row
+// so a value can't be moved to another one.
+func (r *PostgresRepository) sealJSON(v any, aad string) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return r.keys.Seal(raw, []byte(aad))
+}
+
+// openJSON decodes a value read from an encrypted column into v. NULL leaves
+// v unchanged.
+func (r *PostgresRepository) openJSON(raw []byte, aad string, v any) error {
+	if raw == nil {
+		return nil
+	}
+	plain, err := r.keys.Open(raw, []byte(aad))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plain, v)
+}
+
+func stepAAD(executionID string, seq int) string {
+	return aadStep + executionID + "/" + strconv.Itoa(seq)
+}
+
+// RotateKeys re-encrypts up to batch executions whose final context, trace or
+// steps are in plaintext or encrypted with another key than the current one.
+// It returns the number of executions rewritten; call it until that is 0.
+func (r *PostgresRepository) RotateKeys(ctx context.Context, batch int) (int, error) {
+	if r.keys == nil {
+		return 0, fmt.Errorf("no encryption keys configured")
+	}
+	current := r.keys.Current()
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT id FROM executions e
+		WHERE `+stale("final_context")+` OR `+stale("execution_trace")+`
+			OR EXISTS (SELECT 1 FROM execution_steps s WHERE s.execution_id = e.id AND `+stale("s.step")+`)
+		ORDER BY executed_at
+		LIMIT $2`, current, batch)
+	if err != nil {
+		return 0, db.Classify(err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, db.Classify(err)
+	}
+
+	for _, id := range ids {
+		if err := r.reencrypt(ctx, id); err != nil {
+			return 0, fmt.Errorf("execution %s: %w", id, err)
+		}
+	}
+	return len(ids), nil
+}
+
+// stale is the SQL condition matching values of column that are in plaintext
+// or sealed with another key than $1.
+func stale(column string) string {
+	return fmt.Sprintf("(%[1]s IS NOT NULL AND (%[1]s->>'$enc' IS NULL OR %[1]s->>'kid' <> $1))", column)
+}
+
+// reencrypt rewrites the encrypted columns of one execution with the current
+// key.
+func (r *PostgresRepository) reencrypt(ctx context.Context, id string) error {
+	return db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		var finalContext, trace []byte
+		err := tx.QueryRow(ctx,
+			"SELECT final_context, execution_trace FROM executions WHERE id = $1 FOR UPDATE", id,
+		).Scan(&finalContext, &trace)
+		if err != nil {
+			return err
+		}
+		if finalContext, err = r.reseal(finalContext, aadFinalContext+id); err != nil {
+			return err
+		}
+		if trace, err = r.reseal(trace, aadTrace+id); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			"UPDATE executions SET final_context = $2, execution_trace = $3 WHERE id = $1",
+			id, finalContext, trace)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, "SELECT seq, step FROM execution_steps WHERE execution_id = $1", id)
+		if err != nil {
+			return err
+		}
+		type stepRow struct {
+			Seq  int
+			Step []byte
+		}
+		steps, err := pgx.CollectRows(rows, pgx.RowToStructByPos[stepRow])
+		if err != nil {
+			return err
+		}
+		for _, s := range steps {
+			sealed, err := r.reseal(s.Step, stepAAD(id, s.Seq))
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx,
+				"UPDATE execution_steps SET step = $3 WHERE execution_id = $1 AND seq = $2", id, s.Seq, sealed)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// reseal decrypts raw if needed and encrypts it with the current key.
+func (r *PostgresRepository) reseal(raw []byte, aad string) ([]byte, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	if kid, ok := fieldcrypt.KeyID(raw); ok && kid == r.keys.Current() {
+		return raw, nil
+	}
+	plain, err := r.keys.Open(raw, []byte(aad))
+	if err != nil {
+		return nil, err
+	}
+	return r.keys.Seal(plain, []byte(aad))
+}
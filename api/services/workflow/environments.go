@@ -0,0 +1,58 @@
+package workflow
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// EnvironmentsResponse lists the environments executions can run in.
+type EnvironmentsResponse struct {
+	Environments []string `json:"environments"`
+}
+
+// WithEnvironments sets the named environments executions can run in. Each
+// one's handlers must be registered as variants of the same name, see
+// handlers.RegisterEnvironment.
+func WithEnvironments(names []string) Option {
+	return func(s *Service) {
+		s.environments = names
+	}
+}
+
+func (s *Service) HandleListEnvironments(w http.ResponseWriter, r *http.Request) {
+	names := s.environments
+	if names == nil {
+		names = []string{}
+	}
+	respond(w, http.StatusOK, EnvironmentsResponse{Environments: names})
+}
+
+// checkEnvironment returns an error message if env is set but not configured.
+func (s *Service) checkEnvironment(env string) string {
+	if env == "" || slices.Contains(s.environments, env) {
+		return ""
+	}
+	if len(s.environments) == 0 {
+		return fmt.Sprintf("unknown environment %q; none are configured", env)
+	}
+	return fmt.Sprintf("unknown environment %q; one of %v", env, s.environments)
+}
+
+// runBindings returns the handler bindings of a run in env: the environment's
+// handlers for every node type it has them for, overridden by the workflow's
+// own bindings.
+func (s *Service) runBindings(env string, bindings map[string]string) map[string]string {
+	if env == "" {
+		return bindings
+	}
+	out := make(map[string]string, len(s.variants))
+	for nodeType, variants := range s.variants {
+		if slices.Contains(variants, env) {
+			out[nodeType] = env
+		}
+	}
+	maps.Copy(out, bindings)
+	return out
+}
@@ -0,0 +1,128 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/engine"
+)
+
+// ErrorResponse is the body returned for every failed request.
+type ErrorResponse struct {
+	Code        string `json:"code"`
+	Message     string `json:"message"`
+	NodeID      string `json:"nodeId,omitempty"`
+	ExecutionID string `json:"executionId,omitempty"`
+	// Details lists the individual invalid fields, if any.
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// respond writes v with the encoding picked by negotiateMiddleware, falling
+// back to JSON.
+func respond(w http.ResponseWriter, status int, v any) {
+	if nw, ok := w.(*negotiatedWriter); ok && nw.mediaType == mediaTypeMsgpack {
+		body, err := encodeMsgpack(v)
+		if err != nil {
+			slog.Error("Failed to encode response", "error", err)
+			w.Header().Set("Content-Type", mediaTypeJSON)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ErrorResponse{Code: "internal_error", Message: "failed to encode response"})
+			return
+		}
+		w.WriteHeader(status)
+		w.Write(body)
+		return
+	}
+
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	respond(w, status, ErrorResponse{Code: code, Message: message})
+}
+
+// apiError is a failure described by the error response it gets.
+type apiError struct {
+	status int
+	body   ErrorResponse
+}
+
+func (e *apiError) Error() string {
+	return e.body.Message
+}
+
+func (e *apiError) write(w http.ResponseWriter) {
+	respond(w, e.status, e.body)
+}
+
+// writeEngineError maps errors returned by the engine to an HTTP status and a
+// structured error body.
+func writeEngineError(w http.ResponseWriter, err error) {
+	engineError(err).write(w)
+}
+
+func engineError(err error) *apiError {
+	resp := ErrorResponse{Message: err.Error()}
+
+	var nodeErr *engine.NodeExecutionError
+	if errors.As(err, &nodeErr) {
+		resp.NodeID = nodeErr.NodeID
+	}
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, engine.ErrInvalidInput):
+		status, resp.Code = http.StatusBadRequest, "invalid_input"
+	case errors.Is(err, engine.ErrUnknownNodeType):
+		status, resp.Code = http.StatusUnprocessableEntity, "unknown_node_type"
+	case errors.Is(err, engine.ErrUnknownVariant):
+		status, resp.Code = http.StatusUnprocessableEntity, "unknown_handler_variant"
+	case errors.Is(err, engine.ErrHandlerVersion):
+		status, resp.Code = http.StatusUnprocessableEntity, "handler_version_mismatch"
+	case errors.Is(err, engine.ErrCycle):
+		status, resp.Code = http.StatusUnprocessableEntity, "cycle_detected"
+	case engine.IsGraphError(err):
+		status, resp.Code = http.StatusUnprocessableEntity, "invalid_workflow"
+	case nodeErr != nil:
+		resp.Code = "node_execution_failed"
+	default:
+		resp.Code = "internal_error"
+	}
+
+	if status == http.StatusInternalServerError {
+		slog.Error("Workflow execution error", "error", err)
+	}
+	return &apiError{status: status, body: resp}
+}
+
+// writeStoreError maps classified repository errors to an HTTP status.
+func writeStoreError(w http.ResponseWriter, err error, action string) {
+	storeError(err, action).write(w)
+}
+
+func storeError(err error, action string) *apiError {
+	fail := func(status int, code, message string) *apiError {
+		return &apiError{status: status, body: ErrorResponse{Code: code, Message: message}}
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return fail(http.StatusGatewayTimeout, "timeout", fmt.Sprintf("failed to %s: request deadline exceeded", action))
+	case errors.Is(err, db.ErrNotFound):
+		return fail(http.StatusNotFound, "not_found", fmt.Sprintf("failed to %s: not found", action))
+	case errors.Is(err, db.ErrConflict):
+		return fail(http.StatusConflict, "conflict", fmt.Sprintf("failed to %s: %v", action, err))
+	case errors.Is(err, db.ErrConstraint):
+		return fail(http.StatusUnprocessableEntity, "constraint_violation", fmt.Sprintf("failed to %s: %v", action, err))
+	default:
+		slog.Error("Repository error", "action", action, "error", err)
+		return fail(http.StatusInternalServerError, "internal_error", "failed to "+action)
+	}
+}
@@ -0,0 +1,404 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/engine/handlers"
+	"workflow-code-test/api/pkg/sharelink"
+)
+
+const (
+	defaultShareTTL = 7 * 24 * time.Hour
+	maxShareTTL     = 30 * 24 * time.Hour
+
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+
+	defaultStatsWindow = 7 * 24 * time.Hour
+
+	defaultStepPageSize = 100
+	maxStepPageSize     = 1000
+
+	// maxInlineSteps caps the steps returned with an execution; longer
+	// traces are paged from GET /executions/{id}/steps.
+	maxInlineSteps = 200
+)
+
+// stepStatuses are the values accepted by the status filter of
+// GET /executions/{id}/steps.
+var stepStatuses = []string{
+	string(engine.StepStatusCompleted),
+	string(engine.StepStatusFailed),
+	string(engine.StepStatusWaiting),
+	string(engine.StepStatusSkipped),
+	string(engine.StepStatusTimeout),
+}
+
+// ShareRequest is the optional body of POST /executions/{id}/share.
+type ShareRequest struct {
+	TTLSeconds int64 `json:"ttlSeconds"`
+}
+
+// ShareResponse describes a signed link granting read-only access to one
+// execution.
+type ShareResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func executionResponseFromRecord(rec *ExecutionRecord) ExecutionResponse {
+	return ExecutionResponse{
+		ExecutionID: rec.ID,
+		WorkflowID:  rec.WorkflowID,
+		ExecutedAt:  TimestampOf(rec.ExecutedAt),
+		Status:      rec.Status,
+		Environment: rec.Environment,
+		Steps:       rec.Steps,
+		TraceLevel:  rec.TraceLevel,
+
+		PendingInput: rec.PendingInput,
+	}
+}
+
+// HandleListExecutions returns the execution history of a workflow, newest
+// first, limited by the optional limit query parameter.
+func (s *Service) HandleListExecutions(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	limit := defaultHistoryLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			writeError(w, http.StatusBadRequest, "invalid_limit",
+				fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit))
+			return
+		}
+		limit = n
+	}
+
+	if _, err := s.repo.GetWorkflow(r.Context(), id); err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+	summaries, err := s.repo.ListExecutions(r.Context(), id, limit)
+	if err != nil {
+		writeStoreError(w, err, "list executions")
+		return
+	}
+	if summaries == nil {
+		summaries = []ExecutionSummary{}
+	}
+	respond(w, http.StatusOK, summaries)
+}
+
+// HandleExecutionStats returns latency percentiles and outcome counts for a
+// workflow's executions. The optional window query parameter is a Go duration
+// (default 168h).
+func (s *Service) HandleExecutionStats(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	window := defaultStatsWindow
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid_window", "window must be a positive duration such as 24h")
+			return
+		}
+		window = d
+	}
+
+	if _, err := s.repo.GetWorkflow(r.Context(), id); err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+	stats, err := s.repo.GetExecutionStats(r.Context(), id, s.clock.Now().Add(-window))
+	if err != nil {
+		writeStoreError(w, err, "load execution stats")
+		return
+	}
+	respond(w, http.StatusOK, stats)
+}
+
+func (s *Service) HandleShareExecution(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req ShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return
+	}
+
+	ttl := defaultShareTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl <= 0 || ttl > maxShareTTL {
+		writeError(w, http.StatusBadRequest, "invalid_ttl",
+			fmt.Sprintf("ttlSeconds must be between 1 and %d", int64(maxShareTTL/time.Second)))
+		return
+	}
+
+	if _, err := s.repo.GetExecution(r.Context(), id); err != nil {
+		writeStoreError(w, err, "load execution")
+		return
+	}
+
+	expires := s.clock.Now().Add(ttl).Truncate(time.Second)
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("signature", s.shareSigner.Sign(id, expires))
+
+	respond(w, http.StatusCreated, ShareResponse{
+		URL:       s.publicURL + "/api/v1/shared/executions/" + id + "?" + q.Encode(),
+		ExpiresAt: expires,
+	})
+}
+
+// HandleGetSharedExecution serves an execution to holders of a link created by
+// HandleShareExecution. It is the only execution route that needs no access
+// to the API beyond the link itself.
+func (s *Service) HandleGetSharedExecution(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusForbidden, "invalid_share_link", sharelink.ErrInvalidSignature.Error())
+		return
+	}
+
+	if err := s.shareSigner.Verify(id, expires, r.URL.Query().Get("signature"), s.clock.Now()); err != nil {
+		writeError(w, http.StatusForbidden, "invalid_share_link", err.Error())
+		return
+	}
+
+	rec, err := s.repo.GetExecution(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load execution")
+		return
+	}
+
+	resp := executionResponseFromRecord(rec)
+	s.capSteps(&resp)
+	w.Header().Set("Cache-Control", "private, no-store")
+	respond(w, http.StatusOK, resp)
+}
+
+// HandleListExecutionSteps pages through the steps of an execution in trace
+// order. The optional type and status query parameters filter the steps by
+// node type and step status; offset and limit select the page.
+func (s *Service) HandleListExecutionSteps(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	q := r.URL.Query()
+	filter := StepFilter{NodeType: q.Get("type"), Status: q.Get("status"), Limit: defaultStepPageSize}
+	if filter.Status != "" && !slices.Contains(stepStatuses, filter.Status) {
+		writeError(w, http.StatusBadRequest, "invalid_status", fmt.Sprintf("status must be one of %v", stepStatuses))
+		return
+	}
+	if raw := q.Get("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid_offset", "offset must be a non-negative integer")
+			return
+		}
+		filter.Offset = n
+	}
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxStepPageSize {
+			writeError(w, http.StatusBadRequest, "invalid_limit",
+				fmt.Sprintf("limit must be between 1 and %d", maxStepPageSize))
+			return
+		}
+		filter.Limit = n
+	}
+
+	steps, total, err := s.repo.ListExecutionSteps(r.Context(), id, filter)
+	if err != nil {
+		writeStoreError(w, err, "load execution steps")
+		return
+	}
+	if steps == nil {
+		steps = []IndexedStep{}
+	}
+
+	page := StepPage{ExecutionID: id, Total: total, Offset: filter.Offset, Limit: filter.Limit, Steps: steps}
+	if next := filter.Offset + len(steps); next < total {
+		page.Next = s.stepsURL(id, filter, next)
+	}
+	respond(w, http.StatusOK, page)
+}
+
+// stepsURL links to the page of an execution's steps starting at offset.
+func (s *Service) stepsURL(executionID string, filter StepFilter, offset int) string {
+	q := url.Values{}
+	if filter.NodeType != "" {
+		q.Set("type", filter.NodeType)
+	}
+	if filter.Status != "" {
+		q.Set("status", filter.Status)
+	}
+	q.Set("offset", strconv.Itoa(offset))
+	if filter.Limit != 0 && filter.Limit != defaultStepPageSize {
+		q.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	return s.publicURL + "/api/v1/executions/" + executionID + "/steps?" + q.Encode()
+}
+
+// capSteps trims the steps of a long execution to maxInlineSteps and links to
+// the paged endpoint for the rest.
+func (s *Service) capSteps(resp *ExecutionResponse) {
+	if len(resp.Steps) <= maxInlineSteps {
+		return
+	}
+	resp.StepsTotal = len(resp.Steps)
+	resp.StepsURL = s.stepsURL(resp.ExecutionID, StepFilter{}, maxInlineSteps)
+	resp.Steps = resp.Steps[:maxInlineSteps]
+}
+
+// HandleGetPendingInput describes the input a paused execution is waiting for.
+func (s *Service) HandleGetPendingInput(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	rec, err := s.repo.GetExecution(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load execution")
+		return
+	}
+	if rec.PendingInput == nil {
+		writeError(w, http.StatusConflict, "not_paused", "execution is not waiting for input")
+		return
+	}
+	respond(w, http.StatusOK, rec.PendingInput)
+}
+
+// resumeRun continues a paused execution from its checkpoint with data, in
+// the environment and with the handlers it was started with. Streams of the
+// execution follow the resumed run.
+func (s *Service) resumeRun(ctx context.Context, rec *ExecutionRecord, wf *Workflow, graph *engine.Graph, bindings map[string]string, data map[string]any) (executionRun, *engine.Execution, error) {
+	cp := *rec.Checkpoint
+	cp.Resume = data
+	run := executionRun{
+		ID:              rec.ID,
+		WorkflowID:      rec.WorkflowID,
+		WorkflowVersion: rec.WorkflowVersion,
+		TriggeredBy:     rec.TriggeredBy,
+		Environment:     rec.Environment,
+		TraceLevel:      wf.TraceLevel,
+		Input:           rec.Input,
+		Bindings:        s.runBindings(rec.Environment, bindings),
+		Pins:            wf.HandlerVersions,
+		Budget:          wf.Budget,
+		Resumed:         true,
+		PriorSteps:      len(cp.Steps),
+	}
+	feed := s.feeds.open(run, ExecutionStatusRunning, cp.Steps)
+	exec, err := s.executor.Resume(s.runContext(feed.observe(ctx), run), graph, rec.Input, cp)
+	if exec == nil {
+		// Nothing ran, so the execution is still paused.
+		s.feeds.finish(run.ID, rec.Status)
+	}
+	return run, exec, err
+}
+
+// HandleSubmitInput resumes a paused execution with the submitted data. The
+// node that paused the run executes again with the data and may pause once
+// more, e.g. when a wizard step fails validation.
+func (s *Service) HandleSubmitInput(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req InputRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return
+	}
+	if req.Data == nil {
+		req.Data = map[string]any{}
+	}
+
+	rec, err := s.repo.GetExecution(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load execution")
+		return
+	}
+	if rec.Checkpoint == nil {
+		writeError(w, http.StatusConflict, "not_paused", "execution is not waiting for input")
+		return
+	}
+	if rec.PendingInput != nil && rec.PendingInput.Kind == handlers.AwaitTimer {
+		writeError(w, http.StatusConflict, "not_awaiting_input",
+			fmt.Sprintf("execution is waiting on a timer until %v, not for input", rec.PendingInput.Details["resumeAt"]))
+		return
+	}
+
+	wf, err := s.loadWorkflow(r.Context(), rec.WorkflowID)
+	if err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+	if wf.Version != rec.WorkflowVersion {
+		writeError(w, http.StatusConflict, "workflow_changed",
+			fmt.Sprintf("workflow changed from version %d to %d while the execution was paused", rec.WorkflowVersion, wf.Version))
+		return
+	}
+
+	graph, err := s.graph(wf)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+
+	if msg := s.checkEnvironment(rec.Environment); msg != "" {
+		writeError(w, http.StatusUnprocessableEntity, "unknown_environment", msg)
+		return
+	}
+	bindings, err := s.repo.GetHandlerBindings(r.Context(), rec.WorkflowID)
+	if err != nil {
+		writeStoreError(w, err, "load handler bindings")
+		return
+	}
+
+	// Claim the execution first, so that of two submissions racing for it
+	// only one runs the nodes after the pause.
+	if err := s.repo.MarkExecutionResumed(r.Context(), rec.ID); err != nil {
+		if errors.Is(err, db.ErrConflict) {
+			writeError(w, http.StatusConflict, "not_paused", "execution is already being resumed")
+			return
+		}
+		writeStoreError(w, err, "resume execution")
+		return
+	}
+
+	run, exec, err := s.resumeRun(r.Context(), rec, wf, graph, bindings, req.Data)
+
+	ctx := context.WithoutCancel(r.Context())
+	if exec == nil {
+		// Nothing ran, so the execution goes back to waiting for input.
+		if err := s.repo.UpdateExecution(ctx, rec); err != nil {
+			slog.Error("Failed to release resumed execution", "executionId", rec.ID, "error", err)
+		}
+		s.notifyFailed(ctx, run, err)
+		writeEngineError(w, err)
+		return
+	}
+
+	resp, saveErr := s.recordExecution(ctx, run, exec, err)
+	if saveErr != nil {
+		writeStoreError(w, saveErr, "save execution")
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		timeoutError(rec.ID).write(w)
+		return
+	}
+	resp.WorkflowID = rec.WorkflowID
+	s.capSteps(&resp)
+	respond(w, http.StatusOK, resp)
+}
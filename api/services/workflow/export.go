@@ -0,0 +1,160 @@
+package workflow
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Export formats supported by GET /workflows/{id}/export.
+const (
+	ExportFormatMermaid = "mermaid"
+	ExportFormatDOT     = "dot"
+	ExportFormatYAML    = "yaml"
+)
+
+var exportContentTypes = map[string]string{
+	ExportFormatMermaid: "text/vnd.mermaid; charset=utf-8",
+	ExportFormatDOT:     "text/vnd.graphviz; charset=utf-8",
+	ExportFormatYAML:    "application/yaml; charset=utf-8",
+}
+
+func (s *Service) HandleExportWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = ExportFormatMermaid
+	}
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_format",
+			fmt.Sprintf("format must be one of %q, %q or %q", ExportFormatMermaid, ExportFormatDOT, ExportFormatYAML))
+		return
+	}
+
+	wf, err := s.repo.GetWorkflow(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+
+	var out []byte
+	switch format {
+	case ExportFormatMermaid:
+		out = []byte(renderMermaid(wf))
+	case ExportFormatDOT:
+		out = []byte(renderDOT(wf))
+	case ExportFormatYAML:
+		if out, err = MarshalYAMLWorkflow(wf); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal_error", "failed to encode workflow")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+// nodeCaption is the text shown for a node: its label and type.
+func nodeCaption(n Node) string {
+	label := n.Data.Label
+	if label == "" {
+		label = n.ID
+	}
+	return fmt.Sprintf("%s (%s)", label, n.Type)
+}
+
+// edgeCaption is the text shown on an edge. Condition branches are always
+// labelled true/false so the routing is visible without the editor styling.
+func edgeCaption(e Edge) string {
+	if e.SourceHandle != "" {
+		return e.SourceHandle
+	}
+	label := e.Props.Label
+	return label
+}
+
+// mermaidShapes wraps node captions in the Mermaid shape used for a type.
+var mermaidShapes = map[string][2]string{
+	"start":     {"([", "])"},
+	"end":       {"([", "])"},
+	"condition": {"{", "}"},
+	"form":      {"[/", "/]"},
+	"merge":     {"((", "))"},
+	"loop":      {"{{", "}}"},
+}
+
+func renderMermaid(wf *Workflow) string {
+	ids := make(map[string]string, len(wf.Nodes))
+	for i, n := range wf.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, n := range wf.Nodes {
+		if IsAnnotation(n.Type) {
+			continue
+		}
+		shape, ok := mermaidShapes[n.Type]
+		if !ok {
+			shape = [2]string{"[", "]"}
+		}
+		fmt.Fprintf(&b, "    %s%s\"%s\"%s\n", ids[n.ID], shape[0], mermaidEscape(nodeCaption(n)), shape[1])
+	}
+	for _, e := range wf.Edges {
+		if caption := edgeCaption(e); caption != "" {
+			fmt.Fprintf(&b, "    %s -->|\"%s\"| %s\n", ids[e.Source], mermaidEscape(caption), ids[e.Target])
+		} else {
+			fmt.Fprintf(&b, "    %s --> %s\n", ids[e.Source], ids[e.Target])
+		}
+	}
+	return b.String()
+}
+
+// mermaidEscape replaces characters that end a quoted Mermaid string.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "\n", " ").Replace(s)
+}
+
+var dotShapes = map[string]string{
+	"start":     "ellipse",
+	"end":       "ellipse",
+	"condition": "diamond",
+	"form":      "parallelogram",
+	"merge":     "circle",
+	"loop":      "hexagon",
+}
+
+func renderDOT(wf *Workflow) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(wf.ID))
+	b.WriteString("    rankdir=LR;\n")
+	b.WriteString("    node [shape=box];\n")
+	for _, n := range wf.Nodes {
+		if IsAnnotation(n.Type) {
+			continue
+		}
+		attrs := "label=" + dotQuote(nodeCaption(n))
+		if shape, ok := dotShapes[n.Type]; ok {
+			attrs += ", shape=" + shape
+		}
+		fmt.Fprintf(&b, "    %s [%s];\n", dotQuote(n.ID), attrs)
+	}
+	for _, e := range wf.Edges {
+		fmt.Fprintf(&b, "    %s -> %s", dotQuote(e.Source), dotQuote(e.Target))
+		if caption := edgeCaption(e); caption != "" {
+			fmt.Fprintf(&b, " [label=%s]", dotQuote(caption))
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
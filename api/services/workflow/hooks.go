@@ -0,0 +1,174 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/callback"
+)
+
+// Hook delivers execution lifecycle events of a workflow to a URL.
+type Hook struct {
+	ID         string    `json:"id"`
+	WorkflowID string    `json:"workflowId"`
+	URL        string    `json:"url"`
+	Events     []string  `json:"events"`
+	Enabled    bool      `json:"enabled"`
+	HasSecret  bool      `json:"hasSecret"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+
+	// Secret is write-only and never returned by the API.
+	Secret string `json:"-"`
+}
+
+// HookRequest is the body of POST and PUT /workflows/{id}/hooks. On update,
+// an omitted secret keeps the current one.
+type HookRequest struct {
+	URL     string   `json:"url"`
+	Secret  *string  `json:"secret"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+func (req *HookRequest) validate() error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	if len(req.Events) == 0 {
+		return fmt.Errorf("events must not be empty")
+	}
+	for _, e := range req.Events {
+		if !slices.Contains(callback.Events, e) {
+			return fmt.Errorf("unknown event %q, expected one of %v", e, callback.Events)
+		}
+	}
+	return nil
+}
+
+// apply copies the request onto h.
+func (req *HookRequest) apply(h *Hook) {
+	h.URL = req.URL
+	h.Events = req.Events
+	if req.Secret != nil {
+		h.Secret = *req.Secret
+	}
+	if req.Enabled != nil {
+		h.Enabled = *req.Enabled
+	}
+}
+
+func decodeHookRequest(w http.ResponseWriter, r *http.Request) (*HookRequest, bool) {
+	var req HookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return nil, false
+	}
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_hook", err.Error())
+		return nil, false
+	}
+	return &req, true
+}
+
+func (s *Service) HandleListHooks(w http.ResponseWriter, r *http.Request) {
+	workflowID := mux.Vars(r)["id"]
+
+	hooks, err := s.repo.ListHooks(r.Context(), workflowID)
+	if err != nil {
+		writeStoreError(w, err, "list hooks")
+		return
+	}
+	respond(w, http.StatusOK, hooks)
+}
+
+func (s *Service) HandleCreateHook(w http.ResponseWriter, r *http.Request) {
+	workflowID := mux.Vars(r)["id"]
+	req, ok := decodeHookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	hook := &Hook{WorkflowID: workflowID, Enabled: true}
+	req.apply(hook)
+	if err := s.repo.CreateHook(r.Context(), hook); err != nil {
+		writeStoreError(w, err, "create hook")
+		return
+	}
+	respond(w, http.StatusCreated, hook)
+}
+
+func (s *Service) HandleGetHook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workflowID, hookID := vars["id"], vars["hookId"]
+
+	hook, err := s.repo.GetHook(r.Context(), workflowID, hookID)
+	if err != nil {
+		writeStoreError(w, err, "load hook")
+		return
+	}
+	respond(w, http.StatusOK, hook)
+}
+
+func (s *Service) HandleUpdateHook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workflowID, hookID := vars["id"], vars["hookId"]
+	req, ok := decodeHookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	hook, err := s.repo.GetHook(r.Context(), workflowID, hookID)
+	if err != nil {
+		writeStoreError(w, err, "load hook")
+		return
+	}
+	req.apply(hook)
+	if err := s.repo.UpdateHook(r.Context(), hook); err != nil {
+		writeStoreError(w, err, "update hook")
+		return
+	}
+	respond(w, http.StatusOK, hook)
+}
+
+func (s *Service) HandleDeleteHook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workflowID, hookID := vars["id"], vars["hookId"]
+
+	if err := s.repo.DeleteHook(r.Context(), workflowID, hookID); err != nil {
+		writeStoreError(w, err, "delete hook")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notifyHooks delivers a lifecycle event to the enabled hooks of the workflow
+// subscribed to it. Failing to look the hooks up never fails the execution.
+func (s *Service) notifyHooks(ctx context.Context, event callback.Event) {
+	if s.dispatcher == nil {
+		return
+	}
+
+	hooks, err := s.repo.ListHooks(ctx, event.WorkflowID)
+	if err != nil {
+		slog.Error("Failed to load workflow hooks", "workflowId", event.WorkflowID, "error", err)
+		return
+	}
+
+	var targets []callback.Target
+	for _, h := range hooks {
+		if h.Enabled && slices.Contains(h.Events, event.Event) {
+			targets = append(targets, callback.Target{URL: h.URL, Secret: h.Secret})
+		}
+	}
+	s.dispatcher.Dispatch(event, targets)
+}
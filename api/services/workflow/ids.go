@@ -0,0 +1,36 @@
+package workflow
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// idVar is a path variable holding the id of a kind of resource.
+type idVar struct {
+	name, kind string
+}
+
+// uuidVars checks the path variables of a subrouter's routes that hold ids
+// before their handlers run, in the order given, answering 400 invalid_id
+// naming the kind of the first that isn't a UUID. Handlers can then use the
+// ids as they are.
+func uuidVars(vars ...idVar) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			values := mux.Vars(r)
+			for _, v := range vars {
+				value, ok := values[v.name]
+				if !ok {
+					continue
+				}
+				if _, err := uuid.Parse(value); err != nil {
+					writeError(w, http.StatusBadRequest, "invalid_id", v.kind+" id must be a UUID")
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
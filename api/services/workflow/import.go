@@ -0,0 +1,285 @@
+package workflow
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// maxImportSize limits the size of imported definitions.
+const maxImportSize = 1 << 20
+
+// yamlMediaTypes are the Content-Types accepted for YAML definitions.
+var yamlMediaTypes = map[string]bool{
+	"application/yaml":   true,
+	"application/x-yaml": true,
+	"text/yaml":          true,
+	"text/x-yaml":        true,
+}
+
+// HandleImportWorkflow creates a workflow from a definition in the canvas JSON
+// format or, with a YAML Content-Type, in the YAML format.
+func (s *Service) HandleImportWorkflow(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "too_large",
+			fmt.Sprintf("definitions are limited to %d bytes", maxImportSize))
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var wf *Workflow
+	if yamlMediaTypes[mediaType] {
+		if wf, err = ParseYAMLWorkflow(body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_yaml", err.Error())
+			return
+		}
+	} else {
+		wf = &Workflow{}
+		if err := json.Unmarshal(body, wf); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+			return
+		}
+	}
+
+	s.createWorkflow(w, r, wf)
+}
+
+// HandleCreateWorkflow creates a workflow from a graph in the canvas JSON
+// format returned by HandleGetWorkflow. The workflow, its nodes and its edges
+// are stored in one transaction; an id may be given, otherwise one is
+// generated.
+func (s *Service) HandleCreateWorkflow(w http.ResponseWriter, r *http.Request) {
+	if wf, ok := decodeDefinition(w, r); ok {
+		s.createWorkflow(w, r, wf)
+	}
+}
+
+// decodeDefinition reads a workflow in the canvas JSON format from the
+// request body.
+func decodeDefinition(w http.ResponseWriter, r *http.Request) (*Workflow, bool) {
+	var wf Workflow
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize)).Decode(&wf); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "too_large",
+				fmt.Sprintf("definitions are limited to %d bytes", maxImportSize))
+			return nil, false
+		}
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return nil, false
+	}
+	return &wf, true
+}
+
+// HandleUpdateWorkflow replaces a workflow's definition with a graph in the
+// canvas JSON format, as the editor saves it. The nodes and edges are
+// replaced in one transaction and the version is bumped. A version in the
+// body must be the stored one, so saves based on a stale copy are refused.
+// Saves that only move, relabel or restyle nodes and edges store the layout
+// and keep the version.
+func (s *Service) HandleUpdateWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	wf, ok := decodeDefinition(w, r)
+	if !ok {
+		return
+	}
+	if wf.ID != "" && wf.ID != id {
+		writeError(w, http.StatusBadRequest, "invalid_id", "workflow id in the body doesn't match the path")
+		return
+	}
+	wf.ID = id
+
+	if !s.validateDefinition(w, wf) {
+		return
+	}
+	if msg := checkReachableEnd(wf); msg != "" {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_workflow", msg)
+		return
+	}
+
+	stored, err := s.repo.GetWorkflow(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+	if stored.ArchivedAt == nil && (wf.Version == 0 || wf.Version == stored.Version) &&
+		sameLogic(stored, wf) && sameOrder(stored, wf) {
+		l := layoutOf(wf)
+		if err := s.layoutStore().SaveLayout(r.Context(), id, l); err != nil {
+			writeStoreError(w, err, "save layout")
+			return
+		}
+		s.forgetLayout(r.Context(), id)
+		wf.Version, wf.ProjectID = stored.Version, stored.ProjectID
+		respond(w, http.StatusOK, wf)
+		return
+	}
+
+	if err := s.repo.UpdateWorkflow(r.Context(), wf, wf.Version); err != nil {
+		writeStoreError(w, err, "update workflow")
+		return
+	}
+	if err := s.saveLayout(r.Context(), wf); err != nil {
+		writeStoreError(w, err, "save layout")
+		return
+	}
+	s.forgetWorkflow(r.Context(), wf.ID)
+	s.warmGraph(wf)
+	respond(w, http.StatusOK, wf)
+}
+
+// createWorkflow validates and stores a new workflow, answering 201 with it.
+func (s *Service) createWorkflow(w http.ResponseWriter, r *http.Request, wf *Workflow) {
+	if !s.validateDefinition(w, wf) {
+		return
+	}
+	if wf.ProjectID != "" {
+		if _, err := uuid.Parse(wf.ProjectID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_project", "projectId must be a UUID")
+			return
+		}
+	}
+
+	if err := s.repo.CreateWorkflow(r.Context(), wf); err != nil {
+		writeStoreError(w, err, "create workflow")
+		return
+	}
+	if err := s.saveLayout(r.Context(), wf); err != nil {
+		writeStoreError(w, err, "save layout")
+		return
+	}
+	s.forgetWorkflow(r.Context(), wf.ID)
+	s.warmGraph(wf)
+	respond(w, http.StatusCreated, wf)
+}
+
+// validateDefinition checks a workflow submitted by a client and writes a 4xx
+// response when it can't be stored.
+func (s *Service) validateDefinition(w http.ResponseWriter, wf *Workflow) bool {
+	if wf.ID != "" {
+		if _, err := uuid.Parse(wf.ID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_id", "workflow id must be a UUID")
+			return false
+		}
+	}
+	if wf.Name == "" {
+		writeError(w, http.StatusBadRequest, "invalid_workflow", "name is required")
+		return false
+	}
+
+	if msg := s.checkEnvironment(wf.Environment); msg != "" {
+		writeError(w, http.StatusUnprocessableEntity, "unknown_environment", msg)
+		return false
+	}
+
+	if msg := checkTraceLevel(wf.TraceLevel); msg != "" {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_workflow", msg)
+		return false
+	}
+	if wf.TraceLevel == TraceLevelFull {
+		wf.TraceLevel = ""
+	}
+
+	if msg := checkBudget(wf.Budget); msg != "" {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_workflow", msg)
+		return false
+	}
+	wf.Budget = normalizeBudget(wf.Budget)
+
+	var propErrors []FieldError
+	for _, e := range wf.Edges {
+		propErrors = append(propErrors, e.propErrors...)
+	}
+	if len(propErrors) > 0 {
+		respond(w, http.StatusUnprocessableEntity, ErrorResponse{
+			Code:    "invalid_edge_props",
+			Message: "edges have malformed props",
+			Details: propErrors,
+		})
+		return false
+	}
+
+	if msg := cmp.Or(checkAnnotations(wf), checkNodeStyles(wf)); msg != "" {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_workflow", msg)
+		return false
+	}
+
+	if errs := s.checkHandlerVersions(wf); len(errs) > 0 {
+		respond(w, http.StatusUnprocessableEntity, ErrorResponse{
+			Code:    "handler_version_mismatch",
+			Message: "handler version pins can't be satisfied",
+			Details: errs,
+		})
+		return false
+	}
+
+	if _, err := s.compileGraph(wf); err != nil {
+		writeEngineError(w, err)
+		return false
+	}
+
+	if errs := checkDependencies(wf); len(errs) > 0 {
+		respond(w, http.StatusUnprocessableEntity, ErrorResponse{
+			Code:    "unmet_dependencies",
+			Message: "nodes read variables that no node before them sets",
+			Details: errs,
+		})
+		return false
+	}
+	return true
+}
+
+// checkReachableEnd returns a problem if no end node can be reached from the
+// start node of wf.
+func checkReachableEnd(wf *Workflow) string {
+	outgoing := make(map[string][]Edge)
+	for _, e := range wf.Edges {
+		outgoing[e.Source] = append(outgoing[e.Source], e)
+	}
+	var start string
+	types := make(map[string]string, len(wf.Nodes))
+	for _, n := range wf.Nodes {
+		types[n.ID] = n.Type
+		if n.Type == engine.NodeTypeStart {
+			start = n.ID
+		}
+	}
+	for id := range reachableFrom(outgoing, start) {
+		if types[id] == engine.NodeTypeEnd {
+			return ""
+		}
+	}
+	return "no end node is reachable from the start node"
+}
+
+// checkAnnotations returns a problem with the canvas annotations of wf: a
+// parentId that isn't a group node of the workflow, or an edge touching a note
+// or group, which the engine can't follow.
+func checkAnnotations(wf *Workflow) string {
+	types := make(map[string]string, len(wf.Nodes))
+	for _, n := range wf.Nodes {
+		types[n.ID] = n.Type
+	}
+	for _, n := range wf.Nodes {
+		if n.ParentID != "" && types[n.ParentID] != NodeTypeGroup {
+			return fmt.Sprintf("node %s: parent %s is not a group node", n.ID, n.ParentID)
+		}
+	}
+	for _, e := range wf.Edges {
+		if IsAnnotation(types[e.Source]) || IsAnnotation(types[e.Target]) {
+			return fmt.Sprintf("edge %s: annotation nodes cannot be connected", e.ID)
+		}
+	}
+	return ""
+}
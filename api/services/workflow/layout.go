@@ -0,0 +1,250 @@
+package workflow
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+)
+
+// Layout is the presentation of a workflow on the canvas: where its nodes
+// are, how they are labelled and styled and how its edges are drawn. It is
+// kept apart from the logic, so saving it doesn't bump the workflow version,
+// and workflows built programmatically can leave it out.
+type Layout struct {
+	Nodes map[string]NodeLayout `json:"nodes"`
+	Edges map[string]EdgeProps  `json:"edges"`
+}
+
+// NodeLayout is the presentation of one node.
+type NodeLayout struct {
+	Position Position       `json:"position"`
+	Label    string         `json:"label"`
+	ParentID string         `json:"parentId,omitempty"`
+	Style    map[string]any `json:"style,omitempty"`
+}
+
+// layoutRequest is the body of PUT /workflows/{id}/layout. Edge props are
+// decoded like the flat presentation fields of an edge.
+type layoutRequest struct {
+	Nodes map[string]NodeLayout     `json:"nodes"`
+	Edges map[string]map[string]any `json:"edges"`
+}
+
+// LayoutStore keeps the layouts of workflows. Both repositories store them
+// with the nodes and edges; WithLayoutStore keeps them elsewhere, e.g. with
+// the editor's own documents.
+type LayoutStore interface {
+	// GetLayout returns the layout of every node and edge of a workflow.
+	GetLayout(ctx context.Context, workflowID string) (*Layout, error)
+	// SaveLayout replaces the layout of the nodes and edges in layout and
+	// leaves the others alone. It fails with db.ErrNotFound if the workflow
+	// doesn't exist.
+	SaveLayout(ctx context.Context, workflowID string, layout *Layout) error
+}
+
+// WithLayoutStore keeps the layouts of workflows in store instead of the
+// repository. The layouts saved there are laid over the definitions the
+// repository returns.
+func WithLayoutStore(store LayoutStore) Option {
+	return func(s *Service) {
+		s.layouts = store
+	}
+}
+
+// layoutStore returns where layouts are kept.
+func (s *Service) layoutStore() LayoutStore {
+	if s.layouts != nil {
+		return s.layouts
+	}
+	return s.repo
+}
+
+// layoutOf returns the layout of every node and edge of wf.
+func layoutOf(wf *Workflow) *Layout {
+	l := &Layout{
+		Nodes: make(map[string]NodeLayout, len(wf.Nodes)),
+		Edges: make(map[string]EdgeProps, len(wf.Edges)),
+	}
+	for _, n := range wf.Nodes {
+		l.Nodes[n.ID] = NodeLayout{Position: n.Position, Label: n.Data.Label, ParentID: n.ParentID, Style: n.Style}
+	}
+	for _, e := range wf.Edges {
+		l.Edges[e.ID] = e.Props
+	}
+	return l
+}
+
+// applyLayout sets the presentation of the nodes and edges of wf that l has
+// a layout for.
+func applyLayout(wf *Workflow, l *Layout) {
+	for i := range wf.Nodes {
+		n := &wf.Nodes[i]
+		if nl, ok := l.Nodes[n.ID]; ok {
+			n.Position, n.Data.Label, n.ParentID, n.Style = nl.Position, nl.Label, nl.ParentID, nl.Style
+		}
+	}
+	for i := range wf.Edges {
+		if p, ok := l.Edges[wf.Edges[i].ID]; ok {
+			wf.Edges[i].Props = p
+		}
+	}
+}
+
+// withoutLayout returns a copy of wf stripped of its presentation.
+func withoutLayout(wf *Workflow) *Workflow {
+	c := *wf
+	c.Nodes = slices.Clone(wf.Nodes)
+	for i := range c.Nodes {
+		c.Nodes[i].Position, c.Nodes[i].Data.Label, c.Nodes[i].ParentID, c.Nodes[i].Style = Position{}, "", "", nil
+	}
+	c.Edges = slices.Clone(wf.Edges)
+	for i := range c.Edges {
+		c.Edges[i].Props = EdgeProps{}
+	}
+	return &c
+}
+
+// sameLogic reports whether two workflows differ in their layout at most,
+// ignoring the order of nodes and edges like sameDefinition.
+func sameLogic(a, b *Workflow) bool {
+	return sameDefinition(withoutLayout(a), withoutLayout(b))
+}
+
+// sameOrder reports whether two workflows list their nodes and edges in the
+// same order.
+func sameOrder(a, b *Workflow) bool {
+	return slices.EqualFunc(a.Nodes, b.Nodes, func(x, y Node) bool { return x.ID == y.ID }) &&
+		slices.EqualFunc(a.Edges, b.Edges, func(x, y Edge) bool { return x.ID == y.ID })
+}
+
+// checkNodeStyles reports the first node of wf whose style isn't a CSS style
+// object.
+func checkNodeStyles(wf *Workflow) string {
+	for _, n := range wf.Nodes {
+		if n.Style == nil {
+			continue
+		}
+		if _, msg := decodeStyle(n.Style); msg != "" {
+			return fmt.Sprintf("node %s: style %s", n.ID, msg)
+		}
+	}
+	return ""
+}
+
+// loadWorkflow returns a stored workflow with its layout laid over it when
+// layouts are kept apart. Everything that runs a workflow loads it this way,
+// so steps are labelled as the editor shows the nodes.
+func (s *Service) loadWorkflow(ctx context.Context, id string) (*Workflow, error) {
+	wf, err := s.repo.GetWorkflow(ctx, id)
+	if err != nil || s.layouts == nil {
+		return wf, err
+	}
+	l, err := s.layouts.GetLayout(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	applyLayout(wf, l)
+	return wf, nil
+}
+
+// saveLayout stores the layout of a workflow the repository just stored
+// when layouts are kept apart.
+func (s *Service) saveLayout(ctx context.Context, wf *Workflow) error {
+	if s.layouts == nil {
+		return nil
+	}
+	return s.layouts.SaveLayout(ctx, wf.ID, layoutOf(wf))
+}
+
+// forgetLayout drops the cached definition and responses of a workflow
+// whose layout changed. Its compiled graph stays cached: a graph compiled
+// with other labels is keyed apart, see graphKey.
+func (s *Service) forgetLayout(ctx context.Context, id string) {
+	s.definitions.forget(id)
+	s.responses.Invalidate(context.WithoutCancel(ctx), workflowCachePrefix+id)
+}
+
+// HandleGetLayout returns the layout of a workflow.
+func (s *Service) HandleGetLayout(w http.ResponseWriter, r *http.Request) {
+	l, err := s.layoutStore().GetLayout(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err, "load layout")
+		return
+	}
+	respond(w, http.StatusOK, l)
+}
+
+// HandleSaveLayout replaces the layout of the nodes and edges in the body,
+// leaving the others alone. The workflow version is not bumped and its
+// executions are unaffected.
+func (s *Service) HandleSaveLayout(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req layoutRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return
+	}
+	if req.Nodes == nil && req.Edges == nil {
+		writeError(w, http.StatusBadRequest, "invalid_layout", "nodes or edges must be set")
+		return
+	}
+
+	wf, err := s.loadWorkflow(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+
+	l := &Layout{Nodes: req.Nodes, Edges: make(map[string]EdgeProps, len(req.Edges))}
+	nodeIDs := make(map[string]bool, len(wf.Nodes))
+	for _, n := range wf.Nodes {
+		nodeIDs[n.ID] = true
+	}
+	for _, nodeID := range slices.Sorted(maps.Keys(l.Nodes)) {
+		if !nodeIDs[nodeID] {
+			writeError(w, http.StatusUnprocessableEntity, "invalid_layout", fmt.Sprintf("workflow has no node %s", nodeID))
+			return
+		}
+	}
+	edgeIDs := make(map[string]bool, len(wf.Edges))
+	for _, e := range wf.Edges {
+		edgeIDs[e.ID] = true
+	}
+	var propErrors []FieldError
+	for _, edgeID := range slices.Sorted(maps.Keys(req.Edges)) {
+		if !edgeIDs[edgeID] {
+			writeError(w, http.StatusUnprocessableEntity, "invalid_layout", fmt.Sprintf("workflow has no edge %s", edgeID))
+			return
+		}
+		p, errs := decodeEdgeProps("edges["+edgeID+"]", req.Edges[edgeID])
+		propErrors = append(propErrors, errs...)
+		l.Edges[edgeID] = p
+	}
+	if len(propErrors) > 0 {
+		respond(w, http.StatusUnprocessableEntity, ErrorResponse{
+			Code:    "invalid_edge_props",
+			Message: "edges have malformed props",
+			Details: propErrors,
+		})
+		return
+	}
+
+	applyLayout(wf, l)
+	if msg := cmp.Or(checkNodeStyles(wf), checkAnnotations(wf)); msg != "" {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_layout", msg)
+		return
+	}
+
+	if err := s.layoutStore().SaveLayout(r.Context(), id, l); err != nil {
+		writeStoreError(w, err, "save layout")
+		return
+	}
+	s.forgetLayout(r.Context(), id)
+	respond(w, http.StatusOK, layoutOf(wf))
+}
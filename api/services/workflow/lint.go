@@ -0,0 +1,425 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/engine/handlers"
+	"workflow-code-test/api/pkg/jsonpath"
+	"workflow-code-test/api/pkg/weather"
+)
+
+// Lint severities, from most to least serious.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// LintWarning is a problem found in a workflow definition that structural
+// validation doesn't reject.
+type LintWarning struct {
+	Rule       string `json:"rule"`
+	Severity   string `json:"severity"`
+	NodeID     string `json:"nodeId,omitempty"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+type LintResponse struct {
+	WorkflowID string        `json:"workflowId"`
+	Warnings   []LintWarning `json:"warnings"`
+}
+
+func (s *Service) HandleLintWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	wf, err := s.repo.GetWorkflow(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+
+	respond(w, http.StatusOK, LintResponse{WorkflowID: id, Warnings: lintWorkflow(wf, s.outputSchemas)})
+}
+
+// implicitInputs lists state variables node handlers read without declaring
+// them in inputVariables. Email nodes read their recipients variable.
+var implicitInputs = map[string][]string{
+	"integration": {"city"},
+	"condition":   {"temperature"},
+	"wait_until":  {"city"},
+}
+
+// lintWorkflow runs every lint rule against wf. outputSchemas are the output
+// schemas of the node types, see WithOutputSchemas.
+func lintWorkflow(wf *Workflow, outputSchemas map[string]map[string]any) []LintWarning {
+	warnings := []LintWarning{}
+	wf = wf.withDefaults()
+
+	if _, err := buildGraph(wf); err != nil {
+		suggestion := "Fix the graph structure; the workflow cannot be executed as is."
+		if errors.Is(err, engine.ErrBranchesMeet) {
+			suggestion = "Join the parallel branches at a merge node, or give each branch its own nodes."
+		}
+		warnings = append(warnings, LintWarning{
+			Rule:       "invalid_graph",
+			Severity:   SeverityError,
+			Message:    err.Error(),
+			Suggestion: suggestion,
+		})
+	}
+
+	outgoing := make(map[string][]Edge)
+	for _, e := range wf.Edges {
+		outgoing[e.Source] = append(outgoing[e.Source], e)
+	}
+
+	warnings = append(warnings, lintUnreachableNodes(wf, outgoing)...)
+	for _, n := range wf.Nodes {
+		if disabled, _ := n.Data.Metadata["disabled"].(bool); disabled {
+			warnings = append(warnings, LintWarning{
+				Rule:       "disabled_node",
+				Severity:   SeverityInfo,
+				NodeID:     n.ID,
+				Message:    fmt.Sprintf("Node %q is disabled; executions skip it and follow its first outgoing edge.", n.ID),
+				Suggestion: `Remove "disabled": true from the node metadata to run it again.`,
+			})
+			continue
+		}
+		switch n.Type {
+		case "condition":
+			warnings = append(warnings, lintCondition(n, outgoing[n.ID])...)
+		case "email":
+			warnings = append(warnings, lintEmail(n)...)
+		case "integration":
+			warnings = append(warnings, lintIntegration(n)...)
+		case "validate":
+			warnings = append(warnings, lintBranchMode(n, outgoing[n.ID], "Validate", "onInvalid", "valid", "invalid")...)
+		case "dedupe":
+			warnings = append(warnings, lintBranchMode(n, outgoing[n.ID], "Dedupe", "onDuplicate", "unique", "duplicate")...)
+		case "classify":
+			warnings = append(warnings, lintClassify(n, outgoing[n.ID])...)
+		case "query":
+			warnings = append(warnings, lintBranchMode(n, outgoing[n.ID], "Query", "onEmpty", "found", "empty")...)
+		case "wait_until":
+			warnings = append(warnings, lintBranches(n, outgoing[n.ID], "Wait", "success", "timeout")...)
+		case "loop":
+			warnings = append(warnings, lintBranches(n, outgoing[n.ID], "Loop", handlers.LoopBody, handlers.LoopDone)...)
+		}
+	}
+	warnings = append(warnings, lintUnusedOutputs(wf, outgoing)...)
+	warnings = append(warnings, lintDependencies(wf)...)
+	warnings = append(warnings, lintOutputFields(wf, outgoing, outputSchemas)...)
+
+	return warnings
+}
+
+// reachableFrom returns the ids of the nodes reachable from the given nodes,
+// not including the nodes themselves unless they are on a cycle.
+func reachableFrom(outgoing map[string][]Edge, from ...string) map[string]bool {
+	seen := make(map[string]bool)
+	queue := append([]string(nil), from...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range outgoing[id] {
+			if !seen[e.Target] {
+				seen[e.Target] = true
+				queue = append(queue, e.Target)
+			}
+		}
+	}
+	return seen
+}
+
+func lintUnreachableNodes(wf *Workflow, outgoing map[string][]Edge) []LintWarning {
+	var starts []string
+	// Compensation nodes run without an edge leading to them.
+	compensations := make(map[string]bool)
+	for _, n := range wf.Nodes {
+		if n.Type == engine.NodeTypeStart {
+			starts = append(starts, n.ID)
+		}
+		if c, _ := n.Data.Metadata["compensateWith"].(string); c != "" {
+			compensations[c] = true
+		}
+	}
+	reachable := reachableFrom(outgoing, starts...)
+
+	var warnings []LintWarning
+	for _, n := range wf.Nodes {
+		if n.Type == engine.NodeTypeStart || IsAnnotation(n.Type) || reachable[n.ID] || compensations[n.ID] {
+			continue
+		}
+		warnings = append(warnings, LintWarning{
+			Rule:       "unreachable_node",
+			Severity:   SeverityWarning,
+			NodeID:     n.ID,
+			Message:    fmt.Sprintf("Node %q can never run: no path leads to it from the start node.", n.ID),
+			Suggestion: "Connect the node to the flow or remove it.",
+		})
+	}
+	return warnings
+}
+
+func lintCondition(n Node, edges []Edge) []LintWarning {
+	var warnings []LintWarning
+
+	branches := make(map[string]bool)
+	for _, e := range edges {
+		if e.SourceHandle != "true" && e.SourceHandle != "false" {
+			warnings = append(warnings, LintWarning{
+				Rule:     "unreachable_branch",
+				Severity: SeverityWarning,
+				NodeID:   n.ID,
+				Message: fmt.Sprintf("Edge %q leaves condition %q from handle %q and is never followed.",
+					e.ID, n.ID, e.SourceHandle),
+				Suggestion: `Connect the edge to the "true" or "false" handle.`,
+			})
+			continue
+		}
+		branches[e.SourceHandle] = true
+	}
+	for _, branch := range []string{"true", "false"} {
+		if !branches[branch] {
+			warnings = append(warnings, LintWarning{
+				Rule:       "missing_branch",
+				Severity:   SeverityWarning,
+				NodeID:     n.ID,
+				Message:    fmt.Sprintf("Condition %q has no %q branch; executions taking it will fail.", n.ID, branch),
+				Suggestion: fmt.Sprintf("Add an edge from the %q handle, e.g. to the end node.", branch),
+			})
+		}
+	}
+
+	// The plausible range only applies to conditions on the temperature.
+	if variable, _ := n.Data.Metadata["variable"].(string); variable != "" {
+		return warnings
+	}
+	operator, _ := n.Data.Metadata["operator"].(string)
+	threshold, err := engine.ToFloat(n.Data.Metadata["threshold"])
+	if !handlers.IsOperator(operator) || err != nil {
+		return warnings
+	}
+
+	lo, hi := weather.MinPlausibleTemperature, weather.MaxPlausibleTemperature
+	canBeTrue := handlers.Compare(lo, operator, threshold) || handlers.Compare(hi, operator, threshold) ||
+		(operator == "equals" && lo <= threshold && threshold <= hi)
+	canBeFalse := !handlers.Compare(lo, operator, threshold) || !handlers.Compare(hi, operator, threshold)
+
+	if !canBeTrue || !canBeFalse {
+		dead := "true"
+		if !canBeFalse {
+			dead = "false"
+		}
+		warnings = append(warnings, LintWarning{
+			Rule:     "constant_condition",
+			Severity: SeverityWarning,
+			NodeID:   n.ID,
+			Message: fmt.Sprintf("Condition %q (temperature %s %v) is always %t for temperatures between %v°C and %v°C; its %q branch is dead.",
+				n.ID, operator, threshold, canBeTrue, lo, hi, dead),
+			Suggestion: "Check the operator and threshold.",
+		})
+	}
+	return warnings
+}
+
+// lintBranchMode warns about missing edges of a node whose metadata sets
+// modeKey to "branch" and which then follows one of the given branches.
+func lintBranchMode(n Node, edges []Edge, kind, modeKey string, branches ...string) []LintWarning {
+	if mode, _ := n.Data.Metadata[modeKey].(string); mode != "branch" {
+		return nil
+	}
+	return lintBranches(n, edges, kind, branches...)
+}
+
+// lintBranches flags the branches of a node that have no edge.
+func lintBranches(n Node, edges []Edge, kind string, branches ...string) []LintWarning {
+	present := make(map[string]bool)
+	for _, e := range edges {
+		present[e.SourceHandle] = true
+	}
+	var warnings []LintWarning
+	for _, branch := range branches {
+		if !present[branch] {
+			warnings = append(warnings, LintWarning{
+				Rule:       "missing_branch",
+				Severity:   SeverityWarning,
+				NodeID:     n.ID,
+				Message:    fmt.Sprintf("%s node %q has no %q branch; executions taking it will fail.", kind, n.ID, branch),
+				Suggestion: fmt.Sprintf("Add an edge from the %q handle.", branch),
+			})
+		}
+	}
+	return warnings
+}
+
+// lintClassify checks that a classify node in branch mode has an edge for
+// every label it can give.
+func lintClassify(n Node, edges []Edge) []LintWarning {
+	labels, err := handlers.ClassifyLabels(&engine.Node{ID: n.ID, Type: n.Type, Metadata: n.Data.Metadata})
+	if err != nil {
+		return nil
+	}
+	return lintBranchMode(n, edges, "Classify", "onClassified", labels...)
+}
+
+func lintEmail(n Node) []LintWarning {
+	tmpl, _ := n.Data.Metadata["emailTemplate"].(map[string]any)
+	subject, _ := tmpl["subject"].(string)
+	body, _ := tmpl["body"].(string)
+	if subject != "" && body != "" {
+		return nil
+	}
+
+	return []LintWarning{{
+		Rule:       "missing_email_template",
+		Severity:   SeverityWarning,
+		NodeID:     n.ID,
+		Message:    fmt.Sprintf("Email node %q has no emailTemplate subject and body; it would send an empty email.", n.ID),
+		Suggestion: `Add "emailTemplate": {"subject": "...", "body": "..."} to the node metadata.`,
+	}}
+}
+
+func lintIntegration(n Node) []LintWarning {
+	if _, ok := n.Data.Metadata["timeoutMs"]; ok {
+		return nil
+	}
+
+	return []LintWarning{{
+		Rule:       "missing_timeout",
+		Severity:   SeverityWarning,
+		NodeID:     n.ID,
+		Message:    fmt.Sprintf("Integration node %q has no timeout; a slow external API can stall the execution.", n.ID),
+		Suggestion: `Add "timeoutMs": 10000 to the node metadata.`,
+	}}
+}
+
+var expressionIdent = regexp.MustCompile(`[A-Za-z_][\w.]*`)
+
+// consumedVariables returns the state variables a node reads.
+func consumedVariables(n Node) []string {
+	if disabled, _ := n.Data.Metadata["disabled"].(bool); disabled || IsAnnotation(n.Type) {
+		return nil
+	}
+	var vars []string
+	// An integration or wait pinned to a fixed location does not read the
+	// city, and a condition on a variable path does not read the temperature.
+	_, pinned := n.Data.Metadata["location"]
+	variable, _ := n.Data.Metadata["variable"].(string)
+	switch {
+	case (n.Type == "integration" || n.Type == "wait_until") && pinned:
+	case n.Type == "condition" && variable != "":
+		vars = append(vars, pathHeads(variable)...)
+	case n.Type == "email":
+		if recipients := handlers.EmailRecipientsVariable(n.Data.Metadata); recipients != "" {
+			vars = append(vars, recipients)
+		}
+	default:
+		vars = append(vars, implicitInputs[n.Type]...)
+	}
+	if n.Type == "transform" {
+		if source, _ := n.Data.Metadata["source"].(string); source != "" {
+			vars = append(vars, source)
+		} else if mappings, ok := n.Data.Metadata["mappings"].(map[string]any); ok {
+			for _, expr := range mappings {
+				if s, ok := expr.(string); ok {
+					vars = append(vars, pathHeads(s)...)
+				}
+			}
+		}
+	}
+	vars = append(vars, metadataStrings(n.Data.Metadata, "inputVariables")...)
+	vars = append(vars, engine.TemplateVariables(n.Data.Description)...)
+	vars = append(vars, rateLimitKeyVariables(n)...)
+
+	if tmpl, ok := n.Data.Metadata["emailTemplate"].(map[string]any); ok {
+		for _, v := range tmpl {
+			if s, ok := v.(string); ok {
+				vars = append(vars, engine.TemplateVariables(s)...)
+			}
+		}
+	}
+	if key, ok := n.Data.Metadata["key"].(string); ok && (n.Type == "dedupe" || n.Type == "kvstore") {
+		vars = append(vars, engine.TemplateVariables(key)...)
+	}
+	if name, ok := n.Data.Metadata["name"].(string); ok && n.Type == "counter" {
+		vars = append(vars, engine.TemplateVariables(name)...)
+	}
+	if n.Type == "kvstore" || n.Type == "wait_until" || n.Type == "classify" {
+		vars = append(vars, pathHeads(variable)...)
+	}
+	if n.Type == "query" {
+		vars = append(vars, queryParamHeads(n)...)
+	}
+	if isIssueNode(n.Type) {
+		vars = append(vars, issueTemplateVariables(n)...)
+	}
+	if isIncidentNode(n.Type) {
+		vars = append(vars, incidentTemplateVariables(n)...)
+	}
+	if n.Type == "mqtt_publish" {
+		vars = append(vars, metadataTemplateVariables(n, "topic", "payload")...)
+	}
+	if isSagaNode(n.Type) {
+		vars = append(vars, metadataTemplateVariables(n, "url", "body")...)
+	}
+	if n.Type == "sheets_append" {
+		vars = append(vars, columnVariables(n)...)
+	}
+	if expr, ok := n.Data.Metadata["conditionExpression"].(string); ok {
+		vars = append(vars, expressionIdent.FindAllString(expr, -1)...)
+	}
+	return vars
+}
+
+// pathHeads returns the state variable a JSONPath expression reads, if any.
+func pathHeads(expr string) []string {
+	p, err := jsonpath.Parse(expr)
+	if err != nil || p.Head() == "" {
+		return nil
+	}
+	return []string{p.Head()}
+}
+
+func lintUnusedOutputs(wf *Workflow, outgoing map[string][]Edge) []LintWarning {
+	byID := make(map[string]Node, len(wf.Nodes))
+	for _, n := range wf.Nodes {
+		byID[n.ID] = n
+	}
+
+	var warnings []LintWarning
+	for _, n := range wf.Nodes {
+		used := make(map[string]bool)
+		for id := range reachableFrom(outgoing, n.ID) {
+			for _, v := range consumedVariables(byID[id]) {
+				used[v] = true
+			}
+		}
+
+		for _, v := range metadataStrings(n.Data.Metadata, "outputVariables") {
+			if used[v] {
+				continue
+			}
+			warnings = append(warnings, LintWarning{
+				Rule:       "unused_output",
+				Severity:   SeverityInfo,
+				NodeID:     n.ID,
+				Message:    fmt.Sprintf("Output variable %q of node %q is not used by any later node.", v, n.ID),
+				Suggestion: "Remove it from outputVariables or reference it downstream.",
+			})
+		}
+	}
+	return warnings
+}
+
+// metadataStrings returns a metadata key holding a list of strings.
+func metadataStrings(metadata map[string]any, key string) []string {
+	n := engine.Node{Metadata: metadata}
+	return n.Strings(key)
+}
@@ -0,0 +1,131 @@
+package workflow
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/email"
+)
+
+// DistributionListRequest is the body of POST /distribution-lists and PUT
+// /distribution-lists/{name}. An update replaces the description and the
+// addresses; name is only needed on create.
+type DistributionListRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Addresses   []string `json:"addresses"`
+}
+
+// WithDistributionLists manages the distribution lists email nodes send to
+// through the /distribution-lists routes. It should be the store the handlers
+// were registered with. Without it the routes answer 501.
+func WithDistributionLists(lists email.Lists) Option {
+	return func(s *Service) {
+		s.lists = lists
+	}
+}
+
+// distributionLists returns the list store, writing a 501 if there is none.
+func (s *Service) distributionLists(w http.ResponseWriter) (email.Lists, bool) {
+	if s.lists == nil {
+		writeError(w, http.StatusNotImplemented, "not_supported", "distribution lists are not configurable")
+		return nil, false
+	}
+	return s.lists, true
+}
+
+func decodeDistributionListRequest(w http.ResponseWriter, r *http.Request) (*DistributionListRequest, bool) {
+	var req DistributionListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return nil, false
+	}
+	return &req, true
+}
+
+func (s *Service) HandleListDistributionLists(w http.ResponseWriter, r *http.Request) {
+	lists, ok := s.distributionLists(w)
+	if !ok {
+		return
+	}
+	all, err := lists.ListLists(r.Context())
+	if err != nil {
+		writeStoreError(w, err, "list distribution lists")
+		return
+	}
+	respond(w, http.StatusOK, all)
+}
+
+func (s *Service) HandleCreateDistributionList(w http.ResponseWriter, r *http.Request) {
+	lists, ok := s.distributionLists(w)
+	if !ok {
+		return
+	}
+	req, ok := decodeDistributionListRequest(w, r)
+	if !ok {
+		return
+	}
+	list := email.DistributionList{Name: req.Name, Description: req.Description, Addresses: req.Addresses}
+	if err := list.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_distribution_list", err.Error())
+		return
+	}
+	if err := lists.CreateList(r.Context(), &list); err != nil {
+		writeStoreError(w, err, "create distribution list")
+		return
+	}
+	respond(w, http.StatusCreated, list)
+}
+
+func (s *Service) HandleGetDistributionList(w http.ResponseWriter, r *http.Request) {
+	lists, ok := s.distributionLists(w)
+	if !ok {
+		return
+	}
+	list, err := lists.GetList(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		writeStoreError(w, err, "load distribution list")
+		return
+	}
+	respond(w, http.StatusOK, list)
+}
+
+func (s *Service) HandleUpdateDistributionList(w http.ResponseWriter, r *http.Request) {
+	lists, ok := s.distributionLists(w)
+	if !ok {
+		return
+	}
+	req, ok := decodeDistributionListRequest(w, r)
+	if !ok {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if req.Name != "" && req.Name != name {
+		writeError(w, http.StatusBadRequest, "invalid_distribution_list", "name can't change; create a new list instead")
+		return
+	}
+	list := email.DistributionList{Name: name, Description: req.Description, Addresses: req.Addresses}
+	if err := list.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_distribution_list", err.Error())
+		return
+	}
+	if err := lists.UpdateList(r.Context(), &list); err != nil {
+		writeStoreError(w, err, "update distribution list")
+		return
+	}
+	respond(w, http.StatusOK, list)
+}
+
+func (s *Service) HandleDeleteDistributionList(w http.ResponseWriter, r *http.Request) {
+	lists, ok := s.distributionLists(w)
+	if !ok {
+		return
+	}
+	if err := lists.DeleteList(r.Context(), mux.Vars(r)["name"]); err != nil {
+		writeStoreError(w, err, "delete distribution list")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
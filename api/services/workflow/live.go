@@ -0,0 +1,225 @@
+package workflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/websocket"
+)
+
+// Types of the messages of the /ws protocol.
+const (
+	// Sent by clients.
+	liveSubscribe   = "subscribe"
+	liveUnsubscribe = "unsubscribe"
+	livePing        = "ping"
+
+	// Sent by the server.
+	liveSubscribed   = "subscribed"
+	liveUnsubscribed = "unsubscribed"
+	livePong         = "pong"
+	liveNode         = "node"
+	liveDropped      = "dropped"
+	liveError        = "error"
+)
+
+const (
+	// maxLiveSubscriptions caps the subscriptions of one connection.
+	maxLiveSubscriptions = 50
+	// liveBuffer is how many node events a connection may fall behind by
+	// before it misses some.
+	liveBuffer = 256
+	// livePingInterval is how often idle connections are pinged, so proxies
+	// don't close them.
+	livePingInterval = 30 * time.Second
+)
+
+// LiveMessage is a message of the /ws protocol, in either direction. Clients
+// subscribe to the node events of a workflow or of an execution, naming the
+// subscription with ID or letting the server number it; node messages list
+// the subscriptions the event matched.
+type LiveMessage struct {
+	Type          string            `json:"type"`
+	ID            string            `json:"id,omitempty"`
+	WorkflowID    string            `json:"workflowId,omitempty"`
+	ExecutionID   string            `json:"executionId,omitempty"`
+	Subscriptions []string          `json:"subscriptions,omitempty"`
+	Event         *engine.NodeEvent `json:"event,omitempty"`
+	// Dropped counts the events the connection missed since the last
+	// dropped message, because it fell behind.
+	Dropped int64  `json:"dropped,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// WithEventBus serves the node events the executor publishes on bus to
+// WebSocket clients at /ws.
+func WithEventBus(bus *engine.EventBus) Option {
+	return func(s *Service) {
+		s.events = bus
+	}
+}
+
+// liveSession is a WebSocket connection and its subscriptions.
+type liveSession struct {
+	conn *websocket.Conn
+
+	mu     sync.Mutex
+	subs   map[string]LiveMessage
+	nextID int
+}
+
+// HandleWebSocket upgrades the request to a WebSocket connection streaming
+// node events: every node of a subscribed workflow or execution that starts,
+// completes, fails, times out, is skipped or starts waiting for input. Only
+// runs recorded as executions are reported, not simulations.
+func (s *Service) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if s.events == nil {
+		writeError(w, http.StatusNotImplemented, "not_supported", "live updates are not enabled")
+		return
+	}
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		slog.Debug("WebSocket handshake failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	events := s.events.Subscribe(liveBuffer)
+	defer events.Close()
+	session := &liveSession{conn: conn, subs: make(map[string]LiveMessage)}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			data, err := conn.ReadMessage()
+			if err != nil {
+				if !errors.Is(err, websocket.ErrClosed) {
+					slog.Debug("WebSocket read failed", "error", err)
+				}
+				return
+			}
+			if err := session.send(session.handle(data)); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(livePingInterval)
+	defer ping.Stop()
+	var dropped int64
+	for {
+		select {
+		case e := <-events.C:
+			if err := session.deliver(e); err != nil {
+				return
+			}
+			if n := events.Dropped(); n > dropped {
+				if err := session.send(LiveMessage{Type: liveDropped, Dropped: n - dropped}); err != nil {
+					return
+				}
+				dropped = n
+			}
+		case <-ping.C:
+			if err := conn.Ping(); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// handle answers a message from the client.
+func (ls *liveSession) handle(data []byte) LiveMessage {
+	var msg LiveMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return liveErrorMessage("", "invalid_json", "messages must be JSON objects")
+	}
+	switch msg.Type {
+	case livePing:
+		return LiveMessage{Type: livePong, ID: msg.ID}
+	case liveSubscribe:
+		return ls.subscribe(msg)
+	case liveUnsubscribe:
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		if _, ok := ls.subs[msg.ID]; !ok {
+			return liveErrorMessage(msg.ID, "not_found", "no subscription "+strconv.Quote(msg.ID))
+		}
+		delete(ls.subs, msg.ID)
+		return LiveMessage{Type: liveUnsubscribed, ID: msg.ID}
+	}
+	return liveErrorMessage(msg.ID, "invalid_message",
+		fmt.Sprintf("type must be %q, %q or %q", liveSubscribe, liveUnsubscribe, livePing))
+}
+
+func (ls *liveSession) subscribe(msg LiveMessage) LiveMessage {
+	if (msg.WorkflowID == "") == (msg.ExecutionID == "") {
+		return liveErrorMessage(msg.ID, "invalid_subscription", "subscribe to either a workflowId or an executionId")
+	}
+	for _, id := range []string{msg.WorkflowID, msg.ExecutionID} {
+		if _, err := uuid.Parse(id); id != "" && err != nil {
+			return liveErrorMessage(msg.ID, "invalid_subscription", strconv.Quote(id)+" is not a UUID")
+		}
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if len(ls.subs) >= maxLiveSubscriptions {
+		return liveErrorMessage(msg.ID, "too_many_subscriptions",
+			fmt.Sprintf("a connection can have at most %d subscriptions", maxLiveSubscriptions))
+	}
+	if msg.ID == "" {
+		ls.nextID++
+		msg.ID = strconv.Itoa(ls.nextID)
+	}
+	if _, ok := ls.subs[msg.ID]; ok {
+		return liveErrorMessage(msg.ID, "invalid_subscription", "subscription "+strconv.Quote(msg.ID)+" exists")
+	}
+	ls.subs[msg.ID] = LiveMessage{WorkflowID: msg.WorkflowID, ExecutionID: msg.ExecutionID}
+	return LiveMessage{Type: liveSubscribed, ID: msg.ID, WorkflowID: msg.WorkflowID, ExecutionID: msg.ExecutionID}
+}
+
+// deliver sends e to the client if it matches any of its subscriptions.
+func (ls *liveSession) deliver(e engine.NodeEvent) error {
+	if e.ExecutionID == "" {
+		return nil
+	}
+	var matched []string
+	ls.mu.Lock()
+	for id, sub := range ls.subs {
+		if sub.WorkflowID != "" && sub.WorkflowID == e.WorkflowID || sub.ExecutionID == e.ExecutionID {
+			matched = append(matched, id)
+		}
+	}
+	ls.mu.Unlock()
+	if len(matched) == 0 {
+		return nil
+	}
+	slices.Sort(matched)
+	return ls.send(LiveMessage{Type: liveNode, Subscriptions: matched, Event: &e})
+}
+
+func (ls *liveSession) send(msg LiveMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return ls.conn.WriteMessage(data)
+}
+
+func liveErrorMessage(id, code, message string) LiveMessage {
+	return LiveMessage{Type: liveError, ID: id, Code: code, Message: message}
+}
@@ -0,0 +1,1153 @@
+package workflow
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/engine/handlers"
+)
+
+// MemoryRepository keeps everything in process memory. It backs end-to-end
+// runs of the full router without PostgreSQL (STORAGE=memory) and mirrors the
+// error categories of PostgresRepository. Stored values are copied on the way
+// in and out so callers can't mutate them.
+type MemoryRepository struct {
+	mu        sync.RWMutex
+	workflows map[string]*memoryWorkflow
+	// deleted holds soft-deleted workflows, which keep their id taken.
+	deleted    map[string]*memoryWorkflow
+	executions map[string]*ExecutionRecord
+	notes      map[string][]ExecutionNote
+	hooks      map[string]*Hook
+	receivers  map[string]*Receiver
+	presets    map[string]*InputPreset
+	contracts  map[string]*ContractTest
+	baselines  map[string]map[string]*StepBaseline
+	bindings   map[string]map[string]string
+	projects   map[string]*Project
+	transfers  []WorkflowTransfer
+}
+
+type memoryWorkflow struct {
+	wf        *Workflow
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		workflows:  make(map[string]*memoryWorkflow),
+		deleted:    make(map[string]*memoryWorkflow),
+		executions: make(map[string]*ExecutionRecord),
+		notes:      make(map[string][]ExecutionNote),
+		hooks:      make(map[string]*Hook),
+		receivers:  make(map[string]*Receiver),
+		presets:    make(map[string]*InputPreset),
+		contracts:  make(map[string]*ContractTest),
+		baselines:  make(map[string]map[string]*StepBaseline),
+		bindings:   make(map[string]map[string]string),
+		projects:   make(map[string]*Project),
+	}
+}
+
+// clone deep-copies v through its JSON form, which also gives metadata the
+// same shapes a round trip through jsonb columns would.
+func clone[T any](v T) T {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("memory repository: failed to copy %T: %v", v, err))
+	}
+	var out T
+	if err := json.Unmarshal(raw, &out); err != nil {
+		panic(fmt.Sprintf("memory repository: failed to copy %T: %v", v, err))
+	}
+	return out
+}
+
+func notFound(what string) error {
+	return fmt.Errorf("%w: %s", db.ErrNotFound, what)
+}
+
+func (r *MemoryRepository) GetWorkflow(ctx context.Context, id string) (*Workflow, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stored, ok := r.workflows[id]
+	if !ok {
+		return nil, notFound("workflow " + id)
+	}
+	return clone(stored.wf), nil
+}
+
+func (r *MemoryRepository) GetWorkflows(ctx context.Context, ids []string) ([]*Workflow, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []*Workflow
+	for _, id := range ids {
+		if stored, ok := r.workflows[id]; ok {
+			out = append(out, clone(stored.wf))
+		}
+	}
+	return out, nil
+}
+
+func (r *MemoryRepository) CreateWorkflow(ctx context.Context, wf *Workflow) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.createLocked(wf)
+}
+
+func (r *MemoryRepository) createLocked(wf *Workflow) error {
+	if wf.ID == "" {
+		wf.ID = uuid.NewString()
+	}
+	if err := r.checkWorkflowLocked(wf); err != nil {
+		return err
+	}
+	wf.Version = 1
+	wf.ArchivedAt = nil
+	now := time.Now().UTC()
+	r.workflows[wf.ID] = &memoryWorkflow{wf: clone(wf), createdAt: now, updatedAt: now}
+	return nil
+}
+
+func (r *MemoryRepository) UpdateWorkflow(ctx context.Context, wf *Workflow, expectedVersion int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.workflows[wf.ID]
+	if !ok {
+		return notFound("workflow " + wf.ID)
+	}
+	if expectedVersion != 0 && stored.wf.Version != expectedVersion {
+		return fmt.Errorf("%w: workflow %s is at version %d, not %d", db.ErrConflict, wf.ID, stored.wf.Version, expectedVersion)
+	}
+	wf.Version = stored.wf.Version + 1
+	wf.ArchivedAt = nil
+	wf.ProjectID = stored.wf.ProjectID
+	stored.wf = clone(wf)
+	stored.updatedAt = time.Now().UTC()
+	return nil
+}
+
+// checkWorkflowLocked enforces the primary key and the project foreign key of
+// a new workflow.
+func (r *MemoryRepository) checkWorkflowLocked(wf *Workflow) error {
+	if r.takenLocked(wf.ID) {
+		return fmt.Errorf("%w: workflow %s already exists", db.ErrConflict, wf.ID)
+	}
+	if _, ok := r.projects[wf.ProjectID]; wf.ProjectID != "" && !ok {
+		return fmt.Errorf("%w: project %s does not exist", db.ErrConstraint, wf.ProjectID)
+	}
+	return nil
+}
+
+// takenLocked reports whether a workflow, deleted or not, has id.
+func (r *MemoryRepository) takenLocked(id string) bool {
+	_, live := r.workflows[id]
+	_, deleted := r.deleted[id]
+	return live || deleted
+}
+
+func (r *MemoryRepository) DeleteWorkflow(ctx context.Context, id string, opts WorkflowDeletion) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.workflows[id]
+	if !opts.Hard {
+		if !ok {
+			return notFound("workflow " + id)
+		}
+		delete(r.workflows, id)
+		r.deleted[id] = stored
+		return nil
+	}
+
+	if !r.takenLocked(id) {
+		return notFound("workflow " + id)
+	}
+	executions := r.executionsOf(id)
+	if len(executions) > 0 && !opts.Executions {
+		return fmt.Errorf("%w: workflow %s has %d executions, delete them too with executions=true",
+			db.ErrConflict, id, len(executions))
+	}
+	for _, exec := range executions {
+		delete(r.executions, exec.ID)
+		delete(r.notes, exec.ID)
+	}
+	delete(r.workflows, id)
+	delete(r.deleted, id)
+	delete(r.baselines, id)
+	delete(r.bindings, id)
+	maps.DeleteFunc(r.hooks, func(_ string, h *Hook) bool { return h.WorkflowID == id })
+	maps.DeleteFunc(r.receivers, func(_ string, rec *Receiver) bool { return rec.WorkflowID == id })
+	maps.DeleteFunc(r.presets, func(_ string, p *InputPreset) bool { return p.WorkflowID == id })
+	maps.DeleteFunc(r.contracts, func(_ string, t *ContractTest) bool { return t.WorkflowID == id })
+	r.transfers = slices.DeleteFunc(r.transfers, func(t WorkflowTransfer) bool { return t.WorkflowID == id })
+	return nil
+}
+
+func (r *MemoryRepository) ReorderGraph(ctx context.Context, workflowID string, nodeIDs, edgeIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.workflows[workflowID]
+	if !ok {
+		return notFound("workflow " + workflowID)
+	}
+	if nodeIDs != nil {
+		slices.SortStableFunc(stored.wf.Nodes, func(a, b Node) int {
+			return slices.Index(nodeIDs, a.ID) - slices.Index(nodeIDs, b.ID)
+		})
+	}
+	if edgeIDs != nil {
+		slices.SortStableFunc(stored.wf.Edges, func(a, b Edge) int {
+			return slices.Index(edgeIDs, a.ID) - slices.Index(edgeIDs, b.ID)
+		})
+	}
+	stored.updatedAt = time.Now().UTC()
+	return nil
+}
+
+func (r *MemoryRepository) GetLayout(ctx context.Context, workflowID string) (*Layout, error) {
+	wf, err := r.GetWorkflow(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	return layoutOf(wf), nil
+}
+
+func (r *MemoryRepository) SaveLayout(ctx context.Context, workflowID string, layout *Layout) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.workflows[workflowID]
+	if !ok {
+		return notFound("workflow " + workflowID)
+	}
+	applyLayout(stored.wf, clone(layout))
+	stored.updatedAt = time.Now().UTC()
+	return nil
+}
+
+// listLocked returns the workflows matching filter in the order they were
+// created. Its paging fields are ignored.
+func (r *MemoryRepository) listLocked(filter WorkflowFilter) []*memoryWorkflow {
+	stored := make([]*memoryWorkflow, 0, len(r.workflows))
+	for _, s := range r.workflows {
+		if (filter.IncludeArchived || s.wf.ArchivedAt == nil) && (filter.ProjectID == "" || s.wf.ProjectID == filter.ProjectID) {
+			stored = append(stored, s)
+		}
+	}
+	slices.SortFunc(stored, func(a, b *memoryWorkflow) int {
+		return cmp.Or(a.createdAt.Compare(b.createdAt), strings.Compare(a.wf.ID, b.wf.ID))
+	})
+	return stored
+}
+
+func (r *MemoryRepository) ListWorkflowIDs(ctx context.Context, includeArchived bool) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stored := r.listLocked(WorkflowFilter{IncludeArchived: includeArchived})
+	ids := make([]string, len(stored))
+	for i, s := range stored {
+		ids[i] = s.wf.ID
+	}
+	return ids, nil
+}
+
+func (r *MemoryRepository) ListRecentlyExecutedWorkflowIDs(ctx context.Context, limit int) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	last := make(map[string]time.Time)
+	for _, exec := range r.executions {
+		if s, ok := r.workflows[exec.WorkflowID]; ok && s.wf.ArchivedAt == nil && exec.ExecutedAt.After(last[exec.WorkflowID]) {
+			last[exec.WorkflowID] = exec.ExecutedAt
+		}
+	}
+	ids := slices.SortedFunc(maps.Keys(last), func(a, b string) int {
+		return cmp.Or(last[b].Compare(last[a]), strings.Compare(a, b))
+	})
+	return ids[:min(limit, len(ids))], nil
+}
+
+func (r *MemoryRepository) ListWorkflows(ctx context.Context, filter WorkflowFilter) ([]WorkflowSummary, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stored := r.listLocked(filter)
+	page := stored[min(filter.Offset, len(stored)):]
+	page = page[:min(filter.Limit, len(page))]
+
+	summaries := make([]WorkflowSummary, len(page))
+	for i, s := range page {
+		summaries[i] = WorkflowSummary{
+			ID:         s.wf.ID,
+			Name:       s.wf.Name,
+			Version:    s.wf.Version,
+			ProjectID:  s.wf.ProjectID,
+			UpdatedAt:  s.updatedAt,
+			NodeCount:  len(s.wf.Nodes),
+			ArchivedAt: s.wf.ArchivedAt,
+		}
+	}
+	return clone(summaries), len(stored), nil
+}
+
+func (r *MemoryRepository) ApplySyncPlan(ctx context.Context, plan *SyncPlan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Check everything first so the plan is applied completely or not at all.
+	for _, wf := range plan.Create {
+		if err := r.checkWorkflowLocked(wf); err != nil {
+			return err
+		}
+	}
+	for _, wf := range slices.Concat(plan.Update, plan.Layout) {
+		if _, ok := r.workflows[wf.ID]; !ok {
+			return notFound("workflow " + wf.ID)
+		}
+	}
+
+	for _, wf := range plan.Create {
+		if err := r.createLocked(wf); err != nil {
+			return err
+		}
+	}
+	for _, wf := range plan.Update {
+		stored := r.workflows[wf.ID]
+		wf.Version = stored.wf.Version + 1
+		wf.ArchivedAt = nil
+		wf.ProjectID = stored.wf.ProjectID
+		stored.wf = clone(wf)
+		stored.updatedAt = time.Now().UTC()
+	}
+	now := time.Now().UTC()
+	for _, wf := range plan.Layout {
+		stored := r.workflows[wf.ID]
+		applyLayout(stored.wf, layoutOf(clone(wf)))
+		stored.updatedAt = now
+	}
+	for _, id := range plan.Archive {
+		if stored, ok := r.workflows[id]; ok {
+			stored.wf.ArchivedAt = &now
+			stored.updatedAt = now
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) CreateExecution(ctx context.Context, exec *ExecutionRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.workflows[exec.WorkflowID]; !ok {
+		return fmt.Errorf("%w: workflow %s does not exist", db.ErrConstraint, exec.WorkflowID)
+	}
+	if _, ok := r.executions[exec.ID]; ok {
+		return fmt.Errorf("%w: execution %s already exists", db.ErrConflict, exec.ID)
+	}
+	r.executions[exec.ID] = clone(exec)
+	return nil
+}
+
+func (r *MemoryRepository) UpdateExecution(ctx context.Context, exec *ExecutionRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.executions[exec.ID]
+	if !ok {
+		return notFound("execution " + exec.ID)
+	}
+	if !unfinished(stored.Status) {
+		return fmt.Errorf("%w: execution %s has finished", db.ErrConflict, exec.ID)
+	}
+	updated := clone(exec)
+	updated.WorkflowID = stored.WorkflowID
+	updated.ExecutedAt = stored.ExecutedAt
+	updated.Input = stored.Input
+	updated.TriggeredBy = stored.TriggeredBy
+	updated.WorkflowVersion = stored.WorkflowVersion
+	updated.StartedAt = stored.StartedAt
+	updated.Resolution = stored.Resolution
+	r.executions[exec.ID] = updated
+	return nil
+}
+
+func (r *MemoryRepository) MarkExecutionRunning(ctx context.Context, id string, startedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.executions[id]
+	if !ok {
+		return notFound("execution " + id)
+	}
+	if stored.Status != ExecutionStatusQueued {
+		return fmt.Errorf("%w: execution %s is not queued", db.ErrConflict, id)
+	}
+	stored.Status = ExecutionStatusRunning
+	stored.StartedAt = startedAt
+	return nil
+}
+
+func (r *MemoryRepository) MarkExecutionResumed(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.executions[id]
+	if !ok {
+		return notFound("execution " + id)
+	}
+	if stored.Status != string(engine.ExecutionStatusPaused) {
+		return fmt.Errorf("%w: execution %s is not paused", db.ErrConflict, id)
+	}
+	stored.Status = ExecutionStatusRunning
+	return nil
+}
+
+func (r *MemoryRepository) ClaimDueTimers(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	type due struct {
+		id string
+		at time.Time
+	}
+	var timers []due
+	for id, exec := range r.executions {
+		pending := exec.PendingInput
+		if exec.Status != string(engine.ExecutionStatusPaused) || pending == nil || pending.Kind != handlers.AwaitTimer {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339Nano, fmt.Sprint(pending.Details["resumeAt"]))
+		if err == nil && !at.After(now) {
+			timers = append(timers, due{id, at})
+		}
+	}
+	slices.SortFunc(timers, func(a, b due) int { return a.at.Compare(b.at) })
+
+	ids := make([]string, 0, min(len(timers), limit))
+	for _, t := range timers[:min(len(timers), limit)] {
+		r.executions[t.id].PendingInput.Details["resumeAt"] = now.Add(lease).UTC().Format(time.RFC3339Nano)
+		ids = append(ids, t.id)
+	}
+	return ids, nil
+}
+
+func (r *MemoryRepository) GetExecution(ctx context.Context, id string) (*ExecutionRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	exec, ok := r.executions[id]
+	if !ok {
+		return nil, notFound("execution " + id)
+	}
+	return clone(exec), nil
+}
+
+func (r *MemoryRepository) ListExecutionSteps(ctx context.Context, executionID string, filter StepFilter) ([]IndexedStep, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	exec, ok := r.executions[executionID]
+	if !ok {
+		return nil, 0, notFound("execution " + executionID)
+	}
+
+	var matched []IndexedStep
+	for i, step := range exec.Steps {
+		if (filter.NodeType == "" || step.Type == filter.NodeType) && (filter.Status == "" || step.Status == filter.Status) {
+			matched = append(matched, IndexedStep{Index: i, ExecutionStep: step})
+		}
+	}
+	page := matched[min(filter.Offset, len(matched)):]
+	page = page[:min(filter.Limit, len(page))]
+	return clone(page), len(matched), nil
+}
+
+func (r *MemoryRepository) EraseSubject(ctx context.Context, subject *Subject) (*EraseReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := &EraseReport{ExecutionIDs: []string{}}
+	for _, id := range slices.Sorted(maps.Keys(r.executions)) {
+		if _, err := subject.erase(r.executions[id], report); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(r.presets)) {
+		p := r.presets[id]
+		changed, err := subject.erasePreset(p, report)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			p.UpdatedAt = time.Now().UTC()
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(r.contracts)) {
+		t := r.contracts[id]
+		changed, err := subject.eraseContractTest(t, report)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			t.UpdatedAt = time.Now().UTC()
+		}
+	}
+	return report, nil
+}
+
+// executionsOf returns the executions of a workflow, newest first.
+func (r *MemoryRepository) executionsOf(workflowID string) []*ExecutionRecord {
+	var out []*ExecutionRecord
+	for _, exec := range r.executions {
+		if exec.WorkflowID == workflowID {
+			out = append(out, exec)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].ExecutedAt.Equal(out[j].ExecutedAt) {
+			return out[i].ExecutedAt.After(out[j].ExecutedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func (r *MemoryRepository) ListExecutions(ctx context.Context, workflowID string, limit int) ([]ExecutionSummary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []ExecutionSummary
+	for _, exec := range r.executionsOf(workflowID) {
+		if len(out) == limit {
+			break
+		}
+		out = append(out, ExecutionSummary{
+			ID:              exec.ID,
+			WorkflowID:      exec.WorkflowID,
+			Status:          exec.Status,
+			ExecutedAt:      TimestampOf(exec.ExecutedAt),
+			DurationMs:      Millis(exec.DurationMs),
+			TriggeredBy:     exec.TriggeredBy,
+			WorkflowVersion: exec.WorkflowVersion,
+			FailedNodeType:  exec.FailedNodeType,
+			Resolution:      clone(exec.Resolution),
+			Notes:           len(r.notes[exec.ID]),
+		})
+	}
+	return out, nil
+}
+
+func (r *MemoryRepository) ListExecutionNotes(ctx context.Context, executionID string) ([]ExecutionNote, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.executions[executionID]; !ok {
+		return nil, notFound("execution " + executionID)
+	}
+	return append([]ExecutionNote{}, r.notes[executionID]...), nil
+}
+
+func (r *MemoryRepository) AddExecutionNote(ctx context.Context, note *ExecutionNote) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	exec, ok := r.executions[note.ExecutionID]
+	if !ok {
+		return notFound("execution " + note.ExecutionID)
+	}
+	if note.Resolution != "" {
+		exec.Resolution = note.resolution()
+	}
+	r.notes[note.ExecutionID] = append(r.notes[note.ExecutionID], *note)
+	return nil
+}
+
+func (r *MemoryRepository) GetExecutionStats(ctx context.Context, workflowID string, since time.Time) (*ExecutionStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stats := ExecutionStats{WorkflowID: workflowID, Since: TimestampOf(since)}
+	var durations []float64
+	for _, exec := range r.executionsOf(workflowID) {
+		if exec.StartedAt.Before(since) {
+			continue
+		}
+		stats.Total++
+		switch exec.Status {
+		case "completed":
+			stats.Completed++
+		case "failed", "interrupted":
+			stats.Failed++
+		}
+		durations = append(durations, float64(exec.DurationMs))
+		stats.MaxDurationMs = max(stats.MaxDurationMs, Millis(exec.DurationMs))
+	}
+	if len(durations) == 0 {
+		return &stats, nil
+	}
+
+	slices.Sort(durations)
+	var sum float64
+	for _, d := range durations {
+		sum += d
+	}
+	stats.AvgDurationMs = sum / float64(len(durations))
+	stats.P50DurationMs = percentile(durations, 0.5)
+	stats.P95DurationMs = percentile(durations, 0.95)
+	return &stats, nil
+}
+
+func (r *MemoryRepository) CountExecutionsBySource(ctx context.Context, workflowID string, since time.Time, bucket time.Duration) ([]SourceCount, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	type key struct {
+		start  time.Time
+		source string
+	}
+	byKey := make(map[key]*SourceCount)
+	for _, exec := range r.executions {
+		if (workflowID != "" && exec.WorkflowID != workflowID) || exec.StartedAt.Before(since) {
+			continue
+		}
+		k := key{since.Add(exec.StartedAt.Sub(since) / bucket * bucket), exec.TriggeredBy}
+		c, ok := byKey[k]
+		if !ok {
+			c = &SourceCount{BucketStart: k.start, Source: k.source}
+			byKey[k] = c
+		}
+		c.Total++
+		switch exec.Status {
+		case "completed":
+			c.Completed++
+		case "failed", "interrupted":
+			c.Failed++
+		}
+	}
+	counts := make([]SourceCount, 0, len(byKey))
+	for _, c := range byKey {
+		counts = append(counts, *c)
+	}
+	slices.SortFunc(counts, func(a, b SourceCount) int {
+		return cmp.Or(a.BucketStart.Compare(b.BucketStart), strings.Compare(a.Source, b.Source))
+	})
+	return counts, nil
+}
+
+func (r *MemoryRepository) GetStepCoverage(ctx context.Context, workflowID string, since time.Time) (*StepCoverage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	coverage := StepCoverage{Nodes: make(map[string]Exercised), Transitions: make(map[Transition]Exercised)}
+	for _, exec := range r.executionsOf(workflowID) {
+		if exec.StartedAt.Before(since) {
+			continue
+		}
+		coverage.Executions++
+		nodes := make(map[string]bool)
+		transitions := make(map[Transition]bool)
+		for i, step := range exec.Steps {
+			nodes[step.NodeID] = true
+			if i+1 < len(exec.Steps) && exec.Steps[i+1].NodeID != step.NodeID {
+				transitions[Transition{From: step.NodeID, To: exec.Steps[i+1].NodeID}] = true
+			}
+		}
+		for id := range nodes {
+			coverage.Nodes[id] = coverage.Nodes[id].add(exec.StartedAt)
+		}
+		for t := range transitions {
+			coverage.Transitions[t] = coverage.Transitions[t].add(exec.StartedAt)
+		}
+	}
+	return &coverage, nil
+}
+
+// percentile interpolates like PostgreSQL's percentile_cont over sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	pos := p * float64(len(sorted)-1)
+	lo, hi := int(math.Floor(pos)), int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
+
+func (r *MemoryRepository) ListHooks(ctx context.Context, workflowID string) ([]*Hook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	hooks := []*Hook{}
+	for _, h := range r.hooks {
+		if h.WorkflowID == workflowID {
+			hooks = append(hooks, clone(h))
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].CreatedAt.Before(hooks[j].CreatedAt) })
+	return hooks, nil
+}
+
+func (r *MemoryRepository) GetHandlerBindings(ctx context.Context, workflowID string) (map[string]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	bindings := maps.Clone(r.bindings[workflowID])
+	if bindings == nil {
+		bindings = make(map[string]string)
+	}
+	return bindings, nil
+}
+
+func (r *MemoryRepository) SetHandlerBindings(ctx context.Context, workflowID string, bindings map[string]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.workflows[workflowID]; !ok {
+		return fmt.Errorf("%w: workflow %s does not exist", db.ErrConstraint, workflowID)
+	}
+	r.bindings[workflowID] = maps.Clone(bindings)
+	return nil
+}
+
+func (r *MemoryRepository) GetHook(ctx context.Context, workflowID, hookID string) (*Hook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.hooks[hookID]
+	if !ok || h.WorkflowID != workflowID {
+		return nil, notFound("hook " + hookID)
+	}
+	return clone(h), nil
+}
+
+// checkHookLocked enforces the foreign key and unique constraints of
+// workflow_hooks.
+func (r *MemoryRepository) checkHookLocked(hook *Hook) error {
+	if _, ok := r.workflows[hook.WorkflowID]; !ok {
+		return fmt.Errorf("%w: workflow %s does not exist", db.ErrConstraint, hook.WorkflowID)
+	}
+	for _, h := range r.hooks {
+		if h.ID != hook.ID && h.WorkflowID == hook.WorkflowID && h.URL == hook.URL {
+			return fmt.Errorf("%w: hook for %s already exists", db.ErrConflict, hook.URL)
+		}
+	}
+	return nil
+}
+
+// storeHookLocked saves hook, keeping the secret that JSON copies drop.
+func (r *MemoryRepository) storeHookLocked(hook *Hook) {
+	stored := clone(hook)
+	stored.Secret = hook.Secret
+	r.hooks[hook.ID] = stored
+}
+
+func (r *MemoryRepository) CreateHook(ctx context.Context, hook *Hook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkHookLocked(hook); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	hook.ID = uuid.NewString()
+	hook.CreatedAt, hook.UpdatedAt = now, now
+	hook.HasSecret = hook.Secret != ""
+	r.storeHookLocked(hook)
+	return nil
+}
+
+func (r *MemoryRepository) UpdateHook(ctx context.Context, hook *Hook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.hooks[hook.ID]
+	if !ok || existing.WorkflowID != hook.WorkflowID {
+		return notFound("hook " + hook.ID)
+	}
+	if err := r.checkHookLocked(hook); err != nil {
+		return err
+	}
+	hook.CreatedAt = existing.CreatedAt
+	hook.UpdatedAt = time.Now().UTC()
+	hook.HasSecret = hook.Secret != ""
+	r.storeHookLocked(hook)
+	return nil
+}
+
+func (r *MemoryRepository) DeleteHook(ctx context.Context, workflowID, hookID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.hooks[hookID]
+	if !ok || h.WorkflowID != workflowID {
+		return notFound("hook " + hookID)
+	}
+	delete(r.hooks, hookID)
+	return nil
+}
+
+func (r *MemoryRepository) GetStepBaselines(ctx context.Context, workflowID string) (map[string]*StepBaseline, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]*StepBaseline, len(r.baselines[workflowID]))
+	for id, b := range r.baselines[workflowID] {
+		copied := *b
+		out[id] = &copied
+	}
+	return out, nil
+}
+
+func (r *MemoryRepository) RecordStepDurations(ctx context.Context, workflowID string, durations map[string]int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byNode, ok := r.baselines[workflowID]
+	if !ok {
+		byNode = make(map[string]*StepBaseline)
+		r.baselines[workflowID] = byNode
+	}
+	for nodeID, ms := range durations {
+		b, ok := byNode[nodeID]
+		if !ok {
+			b = &StepBaseline{NodeID: nodeID}
+			byNode[nodeID] = b
+		}
+		b.Add(ms)
+	}
+	return nil
+}
+
+func (r *MemoryRepository) ListReceivers(ctx context.Context, workflowID string) ([]*Receiver, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	receivers := []*Receiver{}
+	for _, rec := range r.receivers {
+		if rec.WorkflowID == workflowID {
+			receivers = append(receivers, clone(rec))
+		}
+	}
+	sort.Slice(receivers, func(i, j int) bool { return receivers[i].CreatedAt.Before(receivers[j].CreatedAt) })
+	return receivers, nil
+}
+
+func (r *MemoryRepository) GetReceiver(ctx context.Context, receiverID string) (*Receiver, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rec, ok := r.receivers[receiverID]
+	if !ok {
+		return nil, notFound("receiver " + receiverID)
+	}
+	out := clone(rec)
+	out.Secret = rec.Secret
+	return out, nil
+}
+
+// storeReceiverLocked saves rec, keeping the secret that JSON copies drop.
+func (r *MemoryRepository) storeReceiverLocked(rec *Receiver) {
+	stored := clone(rec)
+	stored.Secret = rec.Secret
+	r.receivers[rec.ID] = stored
+}
+
+func (r *MemoryRepository) CreateReceiver(ctx context.Context, rec *Receiver) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.workflows[rec.WorkflowID]; !ok {
+		return fmt.Errorf("%w: workflow %s does not exist", db.ErrConstraint, rec.WorkflowID)
+	}
+	now := time.Now().UTC()
+	rec.ID = uuid.NewString()
+	rec.CreatedAt, rec.UpdatedAt = now, now
+	rec.HasSecret = rec.Secret != ""
+	r.storeReceiverLocked(rec)
+	return nil
+}
+
+func (r *MemoryRepository) UpdateReceiver(ctx context.Context, rec *Receiver) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.receivers[rec.ID]
+	if !ok || existing.WorkflowID != rec.WorkflowID {
+		return notFound("receiver " + rec.ID)
+	}
+	rec.CreatedAt = existing.CreatedAt
+	rec.UpdatedAt = time.Now().UTC()
+	rec.HasSecret = rec.Secret != ""
+	r.storeReceiverLocked(rec)
+	return nil
+}
+
+func (r *MemoryRepository) DeleteReceiver(ctx context.Context, workflowID, receiverID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.receivers[receiverID]
+	if !ok || rec.WorkflowID != workflowID {
+		return notFound("receiver " + receiverID)
+	}
+	delete(r.receivers, receiverID)
+	return nil
+}
+
+func (r *MemoryRepository) ListInputPresets(ctx context.Context, workflowID string) ([]*InputPreset, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	presets := []*InputPreset{}
+	for _, p := range r.presets {
+		if p.WorkflowID == workflowID {
+			presets = append(presets, clone(p))
+		}
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets, nil
+}
+
+func (r *MemoryRepository) GetInputPreset(ctx context.Context, workflowID, presetID string) (*InputPreset, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.presets[presetID]
+	if !ok || p.WorkflowID != workflowID {
+		return nil, notFound("input preset " + presetID)
+	}
+	return clone(p), nil
+}
+
+// checkInputPresetLocked enforces the foreign key and unique constraints of
+// input_presets.
+func (r *MemoryRepository) checkInputPresetLocked(preset *InputPreset) error {
+	if _, ok := r.workflows[preset.WorkflowID]; !ok {
+		return fmt.Errorf("%w: workflow %s does not exist", db.ErrConstraint, preset.WorkflowID)
+	}
+	for _, p := range r.presets {
+		if p.ID != preset.ID && p.WorkflowID == preset.WorkflowID && p.Name == preset.Name {
+			return fmt.Errorf("%w: input preset %q already exists", db.ErrConflict, preset.Name)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) CreateInputPreset(ctx context.Context, preset *InputPreset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkInputPresetLocked(preset); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	preset.ID = uuid.NewString()
+	preset.CreatedAt, preset.UpdatedAt = now, now
+	r.presets[preset.ID] = clone(preset)
+	return nil
+}
+
+func (r *MemoryRepository) UpdateInputPreset(ctx context.Context, preset *InputPreset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.presets[preset.ID]
+	if !ok || existing.WorkflowID != preset.WorkflowID {
+		return notFound("input preset " + preset.ID)
+	}
+	if err := r.checkInputPresetLocked(preset); err != nil {
+		return err
+	}
+	preset.CreatedAt = existing.CreatedAt
+	preset.UpdatedAt = time.Now().UTC()
+	r.presets[preset.ID] = clone(preset)
+	return nil
+}
+
+func (r *MemoryRepository) DeleteInputPreset(ctx context.Context, workflowID, presetID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.presets[presetID]
+	if !ok || p.WorkflowID != workflowID {
+		return notFound("input preset " + presetID)
+	}
+	delete(r.presets, presetID)
+	return nil
+}
+
+func (r *MemoryRepository) ListContractTests(ctx context.Context, workflowID string) ([]*ContractTest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tests := []*ContractTest{}
+	for _, t := range r.contracts {
+		if t.WorkflowID == workflowID {
+			tests = append(tests, clone(t))
+		}
+	}
+	sort.Slice(tests, func(i, j int) bool { return tests[i].Name < tests[j].Name })
+	return tests, nil
+}
+
+func (r *MemoryRepository) GetContractTest(ctx context.Context, workflowID, testID string) (*ContractTest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.contracts[testID]
+	if !ok || t.WorkflowID != workflowID {
+		return nil, notFound("contract test " + testID)
+	}
+	return clone(t), nil
+}
+
+// checkContractTestLocked enforces the foreign key and unique constraints of
+// contract_tests.
+func (r *MemoryRepository) checkContractTestLocked(test *ContractTest) error {
+	if _, ok := r.workflows[test.WorkflowID]; !ok {
+		return fmt.Errorf("%w: workflow %s does not exist", db.ErrConstraint, test.WorkflowID)
+	}
+	for _, t := range r.contracts {
+		if t.ID != test.ID && t.WorkflowID == test.WorkflowID && t.Name == test.Name {
+			return fmt.Errorf("%w: contract test %q already exists", db.ErrConflict, test.Name)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) CreateContractTest(ctx context.Context, test *ContractTest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkContractTestLocked(test); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	test.ID = uuid.NewString()
+	test.CreatedAt, test.UpdatedAt = now, now
+	r.contracts[test.ID] = clone(test)
+	return nil
+}
+
+func (r *MemoryRepository) UpdateContractTest(ctx context.Context, test *ContractTest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.contracts[test.ID]
+	if !ok || existing.WorkflowID != test.WorkflowID {
+		return notFound("contract test " + test.ID)
+	}
+	if err := r.checkContractTestLocked(test); err != nil {
+		return err
+	}
+	test.CreatedAt = existing.CreatedAt
+	test.UpdatedAt = time.Now().UTC()
+	r.contracts[test.ID] = clone(test)
+	return nil
+}
+
+func (r *MemoryRepository) DeleteContractTest(ctx context.Context, workflowID, testID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.contracts[testID]
+	if !ok || t.WorkflowID != workflowID {
+		return notFound("contract test " + testID)
+	}
+	delete(r.contracts, testID)
+	return nil
+}
+
+func (r *MemoryRepository) ListProjects(ctx context.Context) ([]*Project, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	projects := []*Project{}
+	for _, p := range r.projects {
+		projects = append(projects, clone(p))
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+	return projects, nil
+}
+
+func (r *MemoryRepository) GetProject(ctx context.Context, id string) (*Project, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.projects[id]
+	if !ok {
+		return nil, notFound("project " + id)
+	}
+	return clone(p), nil
+}
+
+// checkProjectLocked enforces the unique constraint on project names.
+func (r *MemoryRepository) checkProjectLocked(project *Project) error {
+	for _, p := range r.projects {
+		if p.ID != project.ID && p.Name == project.Name {
+			return fmt.Errorf("%w: project %q already exists", db.ErrConflict, project.Name)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) CreateProject(ctx context.Context, project *Project) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkProjectLocked(project); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	project.ID = uuid.NewString()
+	project.CreatedAt, project.UpdatedAt = now, now
+	r.projects[project.ID] = clone(project)
+	return nil
+}
+
+func (r *MemoryRepository) UpdateProject(ctx context.Context, project *Project) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.projects[project.ID]
+	if !ok {
+		return notFound("project " + project.ID)
+	}
+	if err := r.checkProjectLocked(project); err != nil {
+		return err
+	}
+	project.CreatedAt = existing.CreatedAt
+	project.UpdatedAt = time.Now().UTC()
+	r.projects[project.ID] = clone(project)
+	return nil
+}
+
+func (r *MemoryRepository) DeleteProject(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.projects[id]; !ok {
+		return notFound("project " + id)
+	}
+	if n := len(r.listLocked(WorkflowFilter{IncludeArchived: true, ProjectID: id})); n > 0 {
+		return fmt.Errorf("%w: project %s still has %d workflows, transfer them first", db.ErrConflict, id, n)
+	}
+	for _, stored := range r.deleted {
+		if stored.wf.ProjectID == id {
+			stored.wf.ProjectID = ""
+		}
+	}
+	delete(r.projects, id)
+	return nil
+}
+
+func (r *MemoryRepository) TransferWorkflows(ctx context.Context, projectID string, workflowIDs []string, author, reason string) ([]WorkflowTransfer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.projects[projectID]; !ok {
+		return nil, notFound("project " + projectID)
+	}
+	for _, id := range workflowIDs {
+		if _, ok := r.workflows[id]; !ok {
+			return nil, notFound("workflow " + id)
+		}
+	}
+
+	now := time.Now().UTC()
+	transfers := []WorkflowTransfer{}
+	for _, id := range workflowIDs {
+		stored := r.workflows[id]
+		if stored.wf.ProjectID == projectID {
+			continue
+		}
+		transfers = append(transfers, WorkflowTransfer{
+			ID:            uuid.NewString(),
+			WorkflowID:    id,
+			FromProjectID: stored.wf.ProjectID,
+			ToProjectID:   projectID,
+			Author:        author,
+			Reason:        reason,
+			TransferredAt: now,
+		})
+		stored.wf.ProjectID = projectID
+		stored.updatedAt = now
+	}
+	r.transfers = append(r.transfers, transfers...)
+	return clone(transfers), nil
+}
+
+func (r *MemoryRepository) ListTransfers(ctx context.Context, projectID string) ([]WorkflowTransfer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	transfers := []WorkflowTransfer{}
+	for _, t := range slices.Backward(r.transfers) {
+		if t.FromProjectID == projectID || t.ToProjectID == projectID {
+			transfers = append(transfers, t)
+		}
+	}
+	return clone(transfers), nil
+}
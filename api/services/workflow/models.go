@@ -0,0 +1,386 @@
+package workflow
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Workflow is a workflow definition in the React Flow format used by the editor.
+type Workflow struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name,omitempty"`
+	Version    int        `json:"version,omitempty"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	// ProjectID is the project the workflow belongs to, if any. It is set
+	// when the workflow is created and changed by transfers only.
+	ProjectID string `json:"projectId,omitempty"`
+	Nodes     []Node `json:"nodes"`
+	Edges     []Edge `json:"edges"`
+
+	// Defaults holds metadata nodes inherit when they don't set a key
+	// themselves, keyed by node type; "*" applies to every node.
+	Defaults map[string]map[string]any `json:"defaults,omitempty"`
+
+	// Environment is the environment executions run in unless they pick
+	// another one.
+	Environment string `json:"environment,omitempty"`
+
+	// TraceLevel is how much of the trace of executions is stored; see
+	// TraceLevels.
+	TraceLevel string `json:"traceLevel,omitempty"`
+
+	// HandlerVersions pins node types to a major version of their handler,
+	// e.g. {"email": 1}, so the workflow keeps running it after an
+	// incompatible new version is deployed.
+	HandlerVersions map[string]int `json:"handlerVersions,omitempty"`
+
+	// Budget caps what each execution may consume.
+	Budget *Budget `json:"budget,omitempty"`
+}
+
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type Node struct {
+	ID       string   `json:"id"`
+	Type     string   `json:"type"`
+	Position Position `json:"position"`
+	Data     NodeData `json:"data"`
+
+	// ParentID places the node inside a group frame; its position is then
+	// relative to the frame.
+	ParentID string `json:"parentId,omitempty"`
+	// Style is the CSS style the editor draws the node with.
+	Style map[string]any `json:"style,omitempty"`
+}
+
+// Annotation node types document the canvas. They are stored and returned
+// like other nodes but never executed.
+const (
+	NodeTypeNote  = "note"
+	NodeTypeGroup = "group"
+)
+
+// IsAnnotation reports whether nodes of the given type are canvas annotations.
+func IsAnnotation(nodeType string) bool {
+	return nodeType == NodeTypeNote || nodeType == NodeTypeGroup
+}
+
+type NodeData struct {
+	Label       string         `json:"label"`
+	Description string         `json:"description"`
+	Metadata    map[string]any `json:"metadata,omitempty"`
+}
+
+// Edge connects two nodes. The fields the engine needs are top-level; the
+// presentation fields the editor sends (type, animated, style, label, ...) are
+// in Props and serialised flat next to them.
+type Edge struct {
+	ID           string    `json:"id"`
+	Source       string    `json:"source"`
+	Target       string    `json:"target"`
+	SourceHandle string    `json:"sourceHandle,omitempty"`
+	Props        EdgeProps `json:"-"`
+
+	// propErrors holds the malformed props found while decoding the edge.
+	// Definitions with such edges are rejected before they are stored.
+	propErrors []FieldError
+}
+
+var edgeCoreFields = []string{"id", "source", "target", "sourceHandle"}
+
+func (e Edge) MarshalJSON() ([]byte, error) {
+	out := e.Props.fields()
+	out["id"] = e.ID
+	out["source"] = e.Source
+	out["target"] = e.Target
+	if e.SourceHandle != "" {
+		out["sourceHandle"] = e.SourceHandle
+	}
+	return json.Marshal(out)
+}
+
+func (e *Edge) UnmarshalJSON(data []byte) error {
+	type core Edge
+	var c core
+	if err := json.Unmarshal(data, &c); err != nil {
+		return err
+	}
+
+	var props map[string]any
+	if err := json.Unmarshal(data, &props); err != nil {
+		return err
+	}
+	for _, k := range edgeCoreFields {
+		delete(props, k)
+	}
+
+	*e = Edge(c)
+	e.Props, e.propErrors = decodeEdgeProps("edges["+e.ID+"]", props)
+	return nil
+}
+
+// Sources an execution can be triggered from.
+const (
+	TriggerAPI      = "api"
+	TriggerSchedule = "schedule"
+	TriggerWebhook  = "webhook"
+	TriggerUser     = "user"
+	TriggerEmail    = "email"
+	TriggerMQTT     = "mqtt"
+	// TriggerBatch marks runs a client starts in bulk, e.g. a backfill.
+	TriggerBatch = "batch"
+)
+
+// Triggers lists the valid values of ExecuteRequest.TriggeredBy.
+var Triggers = []string{TriggerAPI, TriggerSchedule, TriggerWebhook, TriggerUser, TriggerEmail, TriggerMQTT, TriggerBatch}
+
+// ExecuteRequest is the body of POST /workflows/{id}/execute. TriggeredBy
+// defaults to "api"; the editor sends "user" for manual runs.
+type ExecuteRequest struct {
+	FormData    map[string]any `json:"formData"`
+	Condition   map[string]any `json:"condition"`
+	TriggeredBy string         `json:"triggeredBy,omitempty"`
+
+	// Environment overrides the workflow's environment for this run.
+	Environment string `json:"environment,omitempty"`
+
+	// Preset names an input preset of the workflow to take the form data and
+	// condition from; values set in the request override the preset's.
+	Preset string `json:"preset,omitempty"`
+}
+
+// ExecutionResponse is the trace of a workflow run returned to the client.
+type ExecutionResponse struct {
+	ExecutionID string          `json:"executionId"`
+	WorkflowID  string          `json:"workflowId,omitempty"`
+	ExecutedAt  Timestamp       `json:"executedAt"`
+	Status      string          `json:"status"`
+	Environment string          `json:"environment,omitempty"`
+	Steps       []ExecutionStep `json:"steps"`
+
+	// TraceLevel is set when the stored trace was reduced.
+	TraceLevel string `json:"traceLevel,omitempty"`
+
+	// PendingInput is set while the execution is paused waiting for input.
+	PendingInput *PendingInput `json:"pendingInput,omitempty"`
+
+	// StepsTotal and StepsURL are set when Steps only holds the first steps
+	// of a long trace; the rest are paged from StepsURL.
+	StepsTotal int    `json:"stepsTotal,omitempty"`
+	StepsURL   string `json:"stepsUrl,omitempty"`
+
+	// GraphOverlay is set on request by GET /executions/{id}.
+	GraphOverlay *GraphOverlay `json:"graphOverlay,omitempty"`
+
+	// Resolution and Notes are the manual status and notes operators
+	// attached, returned by GET /executions/{id}.
+	Resolution *Resolution     `json:"resolution,omitempty"`
+	Notes      []ExecutionNote `json:"notes,omitempty"`
+}
+
+// StepFilter selects a page of an execution's steps. Empty NodeType and
+// Status match every step.
+type StepFilter struct {
+	NodeType string
+	Status   string
+	Offset   int
+	Limit    int
+}
+
+// WorkflowFilter selects a page of the workflows, oldest first. Archived
+// workflows are left out unless IncludeArchived is set.
+type WorkflowFilter struct {
+	IncludeArchived bool
+	// ProjectID, when set, keeps the workflows of that project only.
+	ProjectID string
+	Offset    int
+	Limit     int
+}
+
+// WorkflowSummary is one entry of the workflow list. NodeCount counts the
+// nodes on the canvas, annotations included.
+type WorkflowSummary struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Version    int        `json:"version"`
+	ProjectID  string     `json:"projectId,omitempty"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	NodeCount  int        `json:"nodeCount"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+}
+
+// WorkflowPage is the response of GET /workflows without ids. Total counts
+// the workflows matching the filter; Next links to the following page, if
+// any.
+type WorkflowPage struct {
+	Total     int               `json:"total"`
+	Offset    int               `json:"offset"`
+	Limit     int               `json:"limit"`
+	Workflows []WorkflowSummary `json:"workflows"`
+	Next      string            `json:"next,omitempty"`
+}
+
+// IndexedStep is a step with its position in the execution trace.
+type IndexedStep struct {
+	Index int `json:"index"`
+	ExecutionStep
+}
+
+// StepPage is the response of GET /executions/{id}/steps. Total counts the
+// steps matching the filter; Next links to the following page, if any.
+type StepPage struct {
+	ExecutionID string        `json:"executionId"`
+	Total       int           `json:"total"`
+	Offset      int           `json:"offset"`
+	Limit       int           `json:"limit"`
+	Steps       []IndexedStep `json:"steps"`
+	Next        string        `json:"next,omitempty"`
+}
+
+// PendingInput describes what a paused execution is waiting for. Submitting
+// the requested data to POST /executions/{id}/input resumes it.
+type PendingInput struct {
+	NodeID      string         `json:"nodeId"`
+	Kind        string         `json:"kind"`
+	Details     map[string]any `json:"details,omitempty"`
+	RequestedAt Timestamp      `json:"requestedAt"`
+}
+
+// InputRequest is the body of POST /executions/{id}/input.
+type InputRequest struct {
+	Data map[string]any `json:"data"`
+}
+
+// ExecutionSummary is one entry of a workflow's execution history.
+type ExecutionSummary struct {
+	ID              string    `json:"id"`
+	WorkflowID      string    `json:"workflowId"`
+	Status          string    `json:"status"`
+	ExecutedAt      Timestamp `json:"executedAt"`
+	DurationMs      Millis    `json:"durationMs"`
+	TriggeredBy     string    `json:"triggeredBy"`
+	WorkflowVersion int       `json:"workflowVersion,omitempty"`
+	FailedNodeType  string    `json:"failedNodeType,omitempty"`
+
+	// Resolution is the manual status operators set, and Notes the number of
+	// notes they attached.
+	Resolution *Resolution `json:"resolution,omitempty"`
+	Notes      int         `json:"notes"`
+}
+
+// ExecutionStats summarises the latency and outcome of a workflow's recent
+// executions.
+type ExecutionStats struct {
+	WorkflowID    string    `json:"workflowId"`
+	Since         Timestamp `json:"since"`
+	Total         int64     `json:"total"`
+	Completed     int64     `json:"completed"`
+	Failed        int64     `json:"failed"`
+	AvgDurationMs float64   `json:"avgDurationMs"`
+	P50DurationMs float64   `json:"p50DurationMs"`
+	P95DurationMs float64   `json:"p95DurationMs"`
+	MaxDurationMs Millis    `json:"maxDurationMs"`
+}
+
+type ExecutionStep struct {
+	NodeID      string `json:"nodeId"`
+	Type        string `json:"type"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	// Output is everything the node's handler output, whatever its type;
+	// the type's output schema describes its shape and DecodeOutput reads
+	// it into a typed view such as ConditionOutput. Failed steps output the
+	// errorClass of their error instead, if it has one.
+	Output map[string]any `json:"output,omitempty"`
+	// OutputOmitted is set when the output wasn't stored because of the
+	// workflow's trace level.
+	OutputOmitted bool         `json:"outputOmitted,omitempty"`
+	Error         string       `json:"error,omitempty"`
+	StartedAt     *Timestamp   `json:"startedAt,omitempty"`
+	FinishedAt    *Timestamp   `json:"finishedAt,omitempty"`
+	DurationMs    Millis       `json:"durationMs"`
+	Memoized      bool         `json:"memoized,omitempty"`
+	Anomaly       *StepAnomaly `json:"anomaly,omitempty"`
+	// Compensation is set on the steps run to undo completed nodes after
+	// the execution failed.
+	Compensation bool `json:"compensation,omitempty"`
+	// Attempts is set when the node's retry policy called its handler more
+	// than once.
+	Attempts int `json:"attempts,omitempty"`
+	// ParallelBranch names the parallel branch the step ran on by the ids
+	// of the edges that started it and the branches it is nested in, e.g.
+	// "e2/e4".
+	ParallelBranch string `json:"parallelBranch,omitempty"`
+	// RateLimitedMs is how long the node waited for its rate limit.
+	RateLimitedMs Millis `json:"rateLimitedMs,omitempty"`
+	// Iteration is the iteration of the innermost loop the step ran in,
+	// grouping the steps of a loop's body by iteration.
+	Iteration *StepIteration `json:"iteration,omitempty"`
+}
+
+// StepIteration identifies an iteration of a loop node.
+type StepIteration struct {
+	NodeID string `json:"nodeId"`
+	Index  int    `json:"index"`
+}
+
+// DecodeOutput decodes the output of the step into v, a pointer to one of
+// the typed views below or to any struct of the output's shape. Keys v has no
+// field for are skipped; Output keeps them all.
+func (s ExecutionStep) DecodeOutput(v any) error {
+	raw, err := json.Marshal(s.Output)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// IntegrationOutput is the output of integration steps.
+type IntegrationOutput struct {
+	Temperature float64 `json:"temperature"`
+	Location    string  `json:"location"`
+	Country     string  `json:"country,omitempty"`
+	Sandbox     bool    `json:"sandbox,omitempty"`
+}
+
+// ConditionOutput is the output of condition steps.
+type ConditionOutput struct {
+	ConditionMet bool    `json:"conditionMet"`
+	Threshold    float64 `json:"threshold"`
+	Operator     string  `json:"operator"`
+	ActualValue  float64 `json:"actualValue"`
+	Message      string  `json:"message"`
+}
+
+// EmailOutput is the output of email steps. Deliveries has an entry per
+// recipient.
+type EmailOutput struct {
+	EmailSent      bool            `json:"emailSent"`
+	DeliveryStatus string          `json:"deliveryStatus"`
+	MessageID      string          `json:"messageId"`
+	Recipients     []string        `json:"recipients"`
+	Deliveries     []EmailDelivery `json:"deliveries"`
+	Sandbox        bool            `json:"sandbox,omitempty"`
+}
+
+// EmailDelivery is the delivery of an email to one recipient.
+type EmailDelivery struct {
+	To        string `json:"to"`
+	Status    string `json:"status"`
+	MessageID string `json:"messageId,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// LoopOutput is the output of loop steps: the index of the iteration
+// starting, or the number of iterations once done, with the values
+// collected from them.
+type LoopOutput struct {
+	Index      int   `json:"index,omitempty"`
+	Iterations int   `json:"iterations,omitempty"`
+	Done       bool  `json:"done"`
+	Results    []any `json:"results,omitempty"`
+}
@@ -0,0 +1,136 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"workflow-code-test/api/pkg/mqtt"
+	"workflow-code-test/api/pkg/payload"
+)
+
+// MQTTTrigger runs a workflow for every message published to the topics
+// matching Topic, e.g. "weather/+/readings". Its mappings copy values into
+// state variables from the message document: {"topic": …, "topicLevels":
+// […], "payload": …}, e.g. {"station": "$.topicLevels[1]", "temperature":
+// "$.payload.temp"}.
+type MQTTTrigger struct {
+	Topic      string `yaml:"topic"`
+	QoS        byte   `yaml:"qos"`
+	WorkflowID string `yaml:"workflowId"`
+	// ContentType is json, form, xml or text; empty decodes payloads that are
+	// valid JSON and keeps others as text.
+	ContentType string            `yaml:"contentType"`
+	Mappings    map[string]string `yaml:"mappings"`
+}
+
+// mqttText is the content type of payloads kept as text.
+const mqttText = "text"
+
+// LoadMQTTTriggers reads the triggers listed in the file at path:
+//
+//	triggers:
+//	  - topic: weather/+/readings
+//	    workflowId: 550e8400-e29b-41d4-a716-446655440000
+//	    mappings: {station: "$.topicLevels[1]", temperature: "$.payload.temp"}
+func LoadMQTTTriggers(path string) ([]MQTTTrigger, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Triggers []MQTTTrigger `yaml:"triggers"`
+	}
+	if err := yaml.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, t := range file.Triggers {
+		if err := t.validate(); err != nil {
+			return nil, fmt.Errorf("%s: triggers[%d]: %w", path, i, err)
+		}
+	}
+	return file.Triggers, nil
+}
+
+func (t MQTTTrigger) validate() error {
+	if t.Topic == "" {
+		return fmt.Errorf("topic is required")
+	}
+	if _, err := uuid.Parse(t.WorkflowID); err != nil {
+		return fmt.Errorf("workflowId must be a UUID")
+	}
+	if t.QoS > 1 {
+		return fmt.Errorf("qos must be 0 or 1")
+	}
+	if t.ContentType != "" && t.ContentType != mqttText && !slices.Contains(payload.ContentTypes, t.ContentType) {
+		return fmt.Errorf("unknown contentType %q, expected one of %v or %s", t.ContentType, payload.ContentTypes, mqttText)
+	}
+	return validateMappings(t.Mappings)
+}
+
+// SubscribeMQTT subscribes client to the topics of triggers. Each message
+// runs the trigger's workflow with triggeredBy "mqtt"; messages are handled
+// one at a time, each with the execution deadline.
+func (s *Service) SubscribeMQTT(client *mqtt.Client, triggers []MQTTTrigger) error {
+	for _, t := range triggers {
+		err := client.Subscribe(t.Topic, t.QoS, func(m mqtt.Message) {
+			ctx, cancel := context.WithTimeout(context.Background(), s.timeouts.Execute)
+			defer cancel()
+			s.runMQTTTrigger(ctx, t, m)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) runMQTTTrigger(ctx context.Context, t MQTTTrigger, m mqtt.Message) {
+	log := slog.With("topic", m.Topic, "workflowId", t.WorkflowID)
+	doc, err := mqttDocument(t.ContentType, m)
+	if err != nil {
+		log.Warn("Dropped undecodable MQTT message", "error", err)
+		return
+	}
+	variables, err := mapPayload(t.Mappings, doc)
+	if err != nil {
+		log.Warn("Dropped MQTT message the trigger's mappings don't match", "error", err)
+		return
+	}
+
+	resp, apiErr := s.runWorkflow(ctx, t.WorkflowID, &ExecuteRequest{TriggeredBy: TriggerMQTT}, variables)
+	if apiErr != nil {
+		log.Error("MQTT triggered execution failed", "code", apiErr.body.Code, "error", apiErr)
+		return
+	}
+	log.Info("MQTT triggered execution", "executionId", resp.ExecutionID, "status", resp.Status)
+}
+
+// mqttDocument returns the document trigger mappings address for m.
+func mqttDocument(contentType string, m mqtt.Message) (map[string]any, error) {
+	var body any = string(m.Payload)
+	switch contentType {
+	case mqttText:
+	case "":
+		if decoded, err := payload.Decode(payload.JSON, "", m.Payload); err == nil {
+			body = decoded
+		}
+	default:
+		var err error
+		if body, err = payload.Decode(contentType, "", m.Payload); err != nil {
+			return nil, err
+		}
+	}
+	levels := strings.Split(m.Topic, "/")
+	topicLevels := make([]any, len(levels))
+	for i, l := range levels {
+		topicLevels[i] = l
+	}
+	return map[string]any{"topic": m.Topic, "topicLevels": topicLevels, "payload": body}, nil
+}
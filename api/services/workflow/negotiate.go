@@ -0,0 +1,117 @@
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Response media types the API can produce.
+const (
+	mediaTypeJSON    = "application/json"
+	mediaTypeMsgpack = "application/x-msgpack"
+)
+
+// msgpackAliases are Accept values treated as a request for MessagePack.
+var msgpackAliases = map[string]bool{
+	mediaTypeMsgpack:          true,
+	"application/msgpack":     true,
+	"application/vnd.msgpack": true,
+}
+
+// negotiatedWriter remembers the media type chosen for a response so that
+// respond can encode the body accordingly.
+type negotiatedWriter struct {
+	http.ResponseWriter
+	mediaType string
+}
+
+// Unwrap lets http.ResponseController reach the server's writer, e.g. to
+// flush event streams.
+func (w *negotiatedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// negotiateMiddleware picks the response encoding from the Accept header,
+// defaulting to JSON, and sets the Content-Type header.
+func negotiateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType := negotiateMediaType(r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", mediaType)
+		w.Header().Add("Vary", "Accept")
+		next.ServeHTTP(&negotiatedWriter{ResponseWriter: w, mediaType: mediaType}, r)
+	})
+}
+
+// negotiateMediaType returns mediaTypeMsgpack if the Accept header prefers it
+// over JSON and mediaTypeJSON otherwise.
+func negotiateMediaType(accept string) string {
+	var jsonQ, msgpackQ float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		switch {
+		case msgpackAliases[mediaType]:
+			msgpackQ = max(msgpackQ, q)
+		case mediaType == mediaTypeJSON, mediaType == "application/*", mediaType == "*/*":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+
+	if msgpackQ > 0 && msgpackQ > jsonQ {
+		return mediaTypeMsgpack
+	}
+	return mediaTypeJSON
+}
+
+// encodeMsgpack encodes v as MessagePack using its JSON representation, so
+// both encodings share field names, omitempty rules and custom marshalers.
+// Integral numbers are kept as integers to benefit from compact encodings.
+func encodeMsgpack(v any) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(compactNumbers(generic))
+}
+
+func compactNumbers(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			t[k] = compactNumbers(e)
+		}
+	case []any:
+		for i, e := range t {
+			t[i] = compactNumbers(e)
+		}
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	}
+	return v
+}
@@ -0,0 +1,168 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Resolution statuses operators mark executions with, e.g. while following
+// up a failed run. ResolutionOpen clears the resolution.
+const (
+	ResolutionOpen          = "open"
+	ResolutionInvestigating = "investigating"
+	ResolutionResolved      = "resolved"
+	ResolutionIgnored       = "ignored"
+)
+
+var Resolutions = []string{ResolutionOpen, ResolutionInvestigating, ResolutionResolved, ResolutionIgnored}
+
+// Limits on the text of notes.
+const (
+	maxAuthorLength   = 200
+	maxNoteBodyLength = 10000
+)
+
+// ExecutionNote is a note an operator attached to an execution, e.g.
+// "customer contacted manually". Notes setting the execution's resolution
+// record the status they set.
+type ExecutionNote struct {
+	ID          string    `json:"id"`
+	ExecutionID string    `json:"executionId"`
+	Author      string    `json:"author"`
+	Body        string    `json:"body"`
+	Resolution  string    `json:"resolution,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Resolution is the manual status an operator last set on an execution.
+type Resolution struct {
+	Status    string    `json:"status"`
+	Author    string    `json:"author"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// NoteRequest is the body of POST /executions/{id}/notes.
+type NoteRequest struct {
+	Author string `json:"author"`
+	Body   string `json:"body"`
+}
+
+// ResolutionRequest is the body of PUT /executions/{id}/resolution. Note,
+// when set, is the body of the note recording the change.
+type ResolutionRequest struct {
+	Status string `json:"status"`
+	Author string `json:"author"`
+	Note   string `json:"note,omitempty"`
+}
+
+// ResolutionResponse is the execution's resolution after a change, null once
+// reopened, and the note recording the change.
+type ResolutionResponse struct {
+	Resolution *Resolution    `json:"resolution"`
+	Note       *ExecutionNote `json:"note"`
+}
+
+// newNote checks the author and body of a note about the execution.
+func (s *Service) newNote(executionID, author, body string) (*ExecutionNote, error) {
+	author, body = strings.TrimSpace(author), strings.TrimSpace(body)
+	switch {
+	case author == "":
+		return nil, fmt.Errorf("author is required")
+	case len(author) > maxAuthorLength:
+		return nil, fmt.Errorf("author is limited to %d bytes", maxAuthorLength)
+	case body == "":
+		return nil, fmt.Errorf("body is required")
+	case len(body) > maxNoteBodyLength:
+		return nil, fmt.Errorf("body is limited to %d bytes", maxNoteBodyLength)
+	}
+	return &ExecutionNote{
+		ID:          s.ids.NewID(),
+		ExecutionID: executionID,
+		Author:      author,
+		Body:        body,
+		CreatedAt:   s.clock.Now(),
+	}, nil
+}
+
+// resolution returns the resolution the note sets, nil if it reopens the
+// execution.
+func (n *ExecutionNote) resolution() *Resolution {
+	if n.Resolution == "" || n.Resolution == ResolutionOpen {
+		return nil
+	}
+	return &Resolution{Status: n.Resolution, Author: n.Author, UpdatedAt: n.CreatedAt}
+}
+
+func (s *Service) HandleListExecutionNotes(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	notes, err := s.repo.ListExecutionNotes(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "list execution notes")
+		return
+	}
+	if notes == nil {
+		notes = []ExecutionNote{}
+	}
+	respond(w, http.StatusOK, notes)
+}
+
+func (s *Service) HandleAddExecutionNote(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req NoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return
+	}
+	note, err := s.newNote(id, req.Author, req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_note", err.Error())
+		return
+	}
+
+	if err := s.repo.AddExecutionNote(r.Context(), note); err != nil {
+		writeStoreError(w, err, "add execution note")
+		return
+	}
+	respond(w, http.StatusCreated, note)
+}
+
+// HandleSetResolution sets the manual resolution status of an execution,
+// recording the change as a note.
+func (s *Service) HandleSetResolution(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req ResolutionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return
+	}
+	if !slices.Contains(Resolutions, req.Status) {
+		writeError(w, http.StatusBadRequest, "invalid_note", fmt.Sprintf("status must be one of %v", Resolutions))
+		return
+	}
+	body := req.Note
+	if strings.TrimSpace(body) == "" {
+		body = "Marked " + req.Status
+		if req.Status == ResolutionOpen {
+			body = "Reopened"
+		}
+	}
+	note, err := s.newNote(id, req.Author, body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_note", err.Error())
+		return
+	}
+	note.Resolution = req.Status
+
+	if err := s.repo.AddExecutionNote(r.Context(), note); err != nil {
+		writeStoreError(w, err, "set execution resolution")
+		return
+	}
+	respond(w, http.StatusOK, ResolutionResponse{Resolution: note.resolution(), Note: note})
+}
@@ -0,0 +1,20 @@
+package workflow
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3 document describing the routes registered by
+// LoadRoutes. TestOpenAPISpec keeps the two in step.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// HandleOpenAPI serves the OpenAPI document, with the output schemas of the
+// node types.
+func (s *Service) HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(s.spec)
+}
@@ -0,0 +1,128 @@
+package workflow_test
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/engine"
+	nodehandlers "workflow-code-test/api/pkg/engine/handlers"
+	"workflow-code-test/api/services/workflow"
+)
+
+type openAPIDocument struct {
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components map[string]map[string]json.RawMessage `json:"components"`
+}
+
+// TestOpenAPISpec checks that the OpenAPI document served at
+// /api/v1/openapi.json documents exactly the routes LoadRoutes registers, and
+// that its $refs, those of the node output schemas included, resolve. Update
+// openapi.json together with any route change.
+func TestOpenAPISpec(t *testing.T) {
+	registry := engine.NewRegistry()
+	nodehandlers.RegisterDefaults(registry, nodehandlers.Dependencies{Sandbox: true})
+	svc, err := workflow.NewService(nil, engine.NewExecutor(registry),
+		workflow.WithRepository(workflow.NewMemoryRepository()),
+		workflow.WithOutputSchemas(registry.OutputSchemas()))
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	router := mux.NewRouter()
+	svc.LoadRoutes(router.PathPrefix("/api/v1").Subrouter())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: got %d", rec.Code)
+	}
+	spec := rec.Body.Bytes()
+	var doc openAPIDocument
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	if len(doc.Servers) == 0 {
+		t.Fatal("openapi.json: no server URL")
+	}
+	base := strings.TrimSuffix(doc.Servers[0].URL, "/")
+
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	registered := make(map[string]bool)
+	err = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouter prefixes match every method and serve nothing.
+			return nil
+		}
+		for _, m := range methods {
+			registered[m+" "+strings.TrimPrefix(path, base)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range slices.Sorted(maps.Keys(registered)) {
+		if !documented[op] {
+			t.Errorf("%s is not documented", op)
+		}
+	}
+	for _, op := range slices.Sorted(maps.Keys(documented)) {
+		if !registered[op] {
+			t.Errorf("%s is documented but not registered", op)
+		}
+	}
+	for _, ref := range specRefs(spec) {
+		parts := strings.Split(strings.TrimPrefix(ref, "#/components/"), "/")
+		if len(parts) != 2 || doc.Components[parts[0]][parts[1]] == nil {
+			t.Errorf("unresolved $ref %s", ref)
+		}
+	}
+}
+
+// specRefs returns every distinct $ref in a JSON document.
+func specRefs(data []byte) []string {
+	var v any
+	if json.Unmarshal(data, &v) != nil {
+		return nil
+	}
+	var refs []string
+	var walk func(any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok && !slices.Contains(refs, ref) {
+				refs = append(refs, ref)
+			}
+			for _, c := range v {
+				walk(c)
+			}
+		case []any:
+			for _, c := range v {
+				walk(c)
+			}
+		}
+	}
+	walk(v)
+	return refs
+}
@@ -0,0 +1,92 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+)
+
+// OrderRequest is the body of PUT /workflows/{id}/order. Each list, when
+// present, must name every node (or edge) of the workflow exactly once.
+type OrderRequest struct {
+	Nodes []string `json:"nodes"`
+	Edges []string `json:"edges"`
+}
+
+// HandleReorderWorkflow sets the order in which a workflow's nodes and edges
+// are returned. The order is presentational only and does not bump the
+// workflow version.
+func (s *Service) HandleReorderWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req OrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return
+	}
+	if req.Nodes == nil && req.Edges == nil {
+		writeError(w, http.StatusBadRequest, "invalid_order", "nodes or edges must be set")
+		return
+	}
+
+	wf, err := s.repo.GetWorkflow(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+
+	nodeIDs := make([]string, len(wf.Nodes))
+	for i, n := range wf.Nodes {
+		nodeIDs[i] = n.ID
+	}
+	edgeIDs := make([]string, len(wf.Edges))
+	for i, e := range wf.Edges {
+		edgeIDs[i] = e.ID
+	}
+	if req.Nodes != nil {
+		if err := checkPermutation("nodes", req.Nodes, nodeIDs); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, "invalid_order", err.Error())
+			return
+		}
+	}
+	if req.Edges != nil {
+		if err := checkPermutation("edges", req.Edges, edgeIDs); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, "invalid_order", err.Error())
+			return
+		}
+	}
+
+	if err := s.repo.ReorderGraph(r.Context(), id, req.Nodes, req.Edges); err != nil {
+		writeStoreError(w, err, "reorder workflow")
+		return
+	}
+	s.forgetWorkflow(r.Context(), id)
+
+	wf, err = s.repo.GetWorkflow(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+	respond(w, http.StatusOK, wf)
+}
+
+// checkPermutation reports an error unless order lists every id of existing
+// exactly once.
+func checkPermutation(kind string, order, existing []string) error {
+	if len(order) != len(existing) {
+		return fmt.Errorf("%s must list all %d ids, got %d", kind, len(existing), len(order))
+	}
+	seen := make(map[string]bool, len(order))
+	for _, id := range order {
+		if !slices.Contains(existing, id) {
+			return fmt.Errorf("%s: unknown id %q", kind, id)
+		}
+		if seen[id] {
+			return fmt.Errorf("%s: duplicate id %q", kind, id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
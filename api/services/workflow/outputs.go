@@ -0,0 +1,145 @@
+package workflow
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"workflow-code-test/api/pkg/jsonpath"
+)
+
+// WithOutputSchemas sets the output schema of each node type, as returned by
+// engine.Registry.OutputSchemas. The served OpenAPI document lists them, and
+// lint checks the paths nodes read against them.
+func WithOutputSchemas(schemas map[string]map[string]any) Option {
+	return func(s *Service) {
+		s.outputSchemas = schemas
+	}
+}
+
+// specWithOutputSchemas returns spec with the NodeOutputs schema listing the
+// output schema of each node type.
+func specWithOutputSchemas(spec []byte, schemas map[string]map[string]any) ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+	components, _ := doc["components"].(map[string]any)
+	all, _ := components["schemas"].(map[string]any)
+	nodeOutputs, ok := all["NodeOutputs"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("openapi.json has no NodeOutputs schema")
+	}
+	properties := make(map[string]any, len(schemas))
+	for nodeType, schema := range schemas {
+		properties[nodeType] = schema
+	}
+	nodeOutputs["properties"] = properties
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// readPaths returns the JSONPath expressions a node reads state variables
+// with.
+func readPaths(n Node) []string {
+	var paths []string
+	variable, _ := n.Data.Metadata["variable"].(string)
+	switch n.Type {
+	case "condition", "wait_until", "classify", "kvstore":
+		paths = append(paths, variable)
+	case "transform":
+		if source, _ := n.Data.Metadata["source"].(string); source != "" {
+			paths = append(paths, source)
+		} else if mappings, ok := n.Data.Metadata["mappings"].(map[string]any); ok {
+			for _, expr := range mappings {
+				if s, ok := expr.(string); ok {
+					paths = append(paths, s)
+				}
+			}
+		}
+	case "query":
+		params, _ := n.Data.Metadata["params"].(map[string]any)
+		for _, expr := range params {
+			if s, ok := expr.(string); ok {
+				paths = append(paths, s)
+			}
+		}
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths)
+}
+
+// lintOutputFields checks the paths nodes read into state variables set from
+// the output of the nodes before them against the output schemas of those
+// nodes, e.g. "$.location.latitude" after a form node, whose location has no
+// such field.
+func lintOutputFields(wf *Workflow, outgoing map[string][]Edge, schemas map[string]map[string]any) []LintWarning {
+	if len(schemas) == 0 {
+		return nil
+	}
+	byID := make(map[string]Node, len(wf.Nodes))
+	for _, n := range wf.Nodes {
+		byID[n.ID] = n
+	}
+
+	var warnings []LintWarning
+	for _, producer := range wf.Nodes {
+		schema := schemas[producer.Type]
+		if schema == nil {
+			continue
+		}
+		produced := producedVariables(producer)
+		for id := range reachableFrom(outgoing, producer.ID) {
+			n := byID[id]
+			if disabled, _ := n.Data.Metadata["disabled"].(bool); disabled {
+				continue
+			}
+			for _, expr := range readPaths(n) {
+				p, err := jsonpath.Parse(expr)
+				if err != nil {
+					continue
+				}
+				members := p.Members()
+				if len(members) < 2 || !slices.Contains(produced, members[0]) {
+					continue
+				}
+				field, known := schemaField(schema, members)
+				if known == nil {
+					continue
+				}
+				warnings = append(warnings, LintWarning{
+					Rule:     "unknown_output_field",
+					Severity: SeverityWarning,
+					NodeID:   n.ID,
+					Message: fmt.Sprintf("Node %q reads %q, but %s nodes such as %q output no %q field there.",
+						n.ID, expr, producer.Type, producer.ID, field),
+					Suggestion: fmt.Sprintf("Use one of %s.", strings.Join(known, ", ")),
+				})
+			}
+		}
+	}
+	slices.SortFunc(warnings, func(a, b LintWarning) int {
+		return cmp.Or(strings.Compare(a.NodeID, b.NodeID), strings.Compare(a.Message, b.Message))
+	})
+	return slices.CompactFunc(warnings, func(a, b LintWarning) bool { return a == b })
+}
+
+// schemaField walks members through the properties of an object schema. When
+// a member isn't a property of an object that allows no others, it returns
+// that member and the properties the object has, sorted; otherwise nil.
+func schemaField(schema map[string]any, members []string) (string, []string) {
+	for _, name := range members {
+		properties, _ := schema["properties"].(map[string]any)
+		if next, ok := properties[name].(map[string]any); ok {
+			schema = next
+			continue
+		}
+		if open, ok := schema["additionalProperties"].(bool); !ok || open || len(properties) == 0 {
+			return "", nil
+		}
+		return name, slices.Sorted(maps.Keys(properties))
+	}
+	return "", nil
+}
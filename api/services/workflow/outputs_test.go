@@ -0,0 +1,177 @@
+package workflow_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/services/workflow"
+)
+
+// floodOutput is what the flood_sms handler outputs: keys no built-in node
+// type has, holding scalars, lists and nested objects.
+var floodOutput = map[string]any{
+	"smsContent": "Flood warning for Lismore: Wilsons River at 11.2 m and rising",
+	"flood": map[string]any{
+		"river":  "Wilsons",
+		"levels": []any{9.5, 10.4, 11.2},
+		"gauges": map[string]any{
+			"lismore": map[string]any{"level": 11.2, "rising": true, "alerts": []any{"minor", "moderate"}},
+		},
+		"evacuation": nil,
+	},
+	"x-custom": true,
+}
+
+func registerFloodSMS(r *engine.Registry) {
+	r.Register("flood_sms", engine.HandlerFunc(func(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+		return &engine.NodeResult{Output: floodOutput}, nil
+	}))
+}
+
+// floodWorkflow creates start -> flood_sms -> end with traceLevel.
+func floodWorkflow(api *testAPI, traceLevel string) string {
+	api.t.Helper()
+	var wf workflow.Workflow
+	body := map[string]any{
+		"name":       api.t.Name(),
+		"traceLevel": traceLevel,
+		"nodes":      []map[string]any{node("start", "start"), node("sms", "flood_sms"), node("end", "end")},
+		"edges":      []map[string]any{edge("e1", "start", "sms"), edge("e2", "sms", "end")},
+	}
+	if code := api.do(http.MethodPost, "/workflows", body, &wf); code != http.StatusCreated {
+		api.t.Fatalf("create workflow: got %d, want 201", code)
+	}
+	return wf.ID
+}
+
+// checkFloodOutput verifies that step carries floodOutput key for key.
+func checkFloodOutput(t *testing.T, where string, step workflow.ExecutionStep) {
+	t.Helper()
+	if step.NodeID != "sms" {
+		t.Fatalf("%s: step is %s, want sms", where, step.NodeID)
+	}
+	if !reflect.DeepEqual(step.Output, floodOutput) {
+		t.Errorf("%s: output = %#v, want %#v", where, step.Output, floodOutput)
+	}
+}
+
+func TestCustomOutputSurvives(t *testing.T) {
+	api := newTestAPIWith(t, registerFloodSMS)
+	id := floodWorkflow(api, workflow.TraceLevelFull)
+
+	var exec workflow.ExecutionResponse
+	if code := api.do(http.MethodPost, "/workflows/"+id+"/execute", `{}`, &exec); code != http.StatusOK {
+		t.Fatalf("execute: got %d, want 200", code)
+	}
+	checkFloodOutput(t, "execute response", exec.Steps[1])
+
+	var stored workflow.ExecutionResponse
+	if code := api.do(http.MethodGet, "/executions/"+exec.ExecutionID, nil, &stored); code != http.StatusOK {
+		t.Fatalf("get execution: got %d, want 200", code)
+	}
+	checkFloodOutput(t, "stored execution", stored.Steps[1])
+
+	var page struct {
+		Steps []workflow.ExecutionStep `json:"steps"`
+	}
+	if code := api.do(http.MethodGet, "/executions/"+exec.ExecutionID+"/steps?type=flood_sms", nil, &page); code != http.StatusOK {
+		t.Fatalf("get steps: got %d, want 200", code)
+	}
+	if len(page.Steps) != 1 {
+		t.Fatalf("step page has %d steps, want 1", len(page.Steps))
+	}
+	checkFloodOutput(t, "step page", page.Steps[0])
+
+	req, err := http.NewRequest(http.MethodGet, api.url+"/executions/"+exec.ExecutionID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/msgpack")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// MessagePack responses use the JSON field names, so the decoded document
+	// is read back through JSON.
+	var generic any
+	if err := msgpack.Unmarshal(raw, &generic); err != nil {
+		t.Fatalf("decode MessagePack execution: %v", err)
+	}
+	doc, err := json.Marshal(generic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packed workflow.ExecutionResponse
+	if err := json.Unmarshal(doc, &packed); err != nil {
+		t.Fatal(err)
+	}
+	checkFloodOutput(t, "MessagePack execution", packed.Steps[1])
+}
+
+func TestCustomOutputTraceLevels(t *testing.T) {
+	api := newTestAPIWith(t, registerFloodSMS)
+	id := floodWorkflow(api, workflow.TraceLevelSummary)
+
+	// The response carries the full trace; the stored one leaves outputs out
+	// and says so.
+	var exec workflow.ExecutionResponse
+	if code := api.do(http.MethodPost, "/workflows/"+id+"/execute", `{}`, &exec); code != http.StatusOK {
+		t.Fatalf("execute: got %d, want 200", code)
+	}
+	checkFloodOutput(t, "execute response", exec.Steps[1])
+
+	var stored workflow.ExecutionResponse
+	api.do(http.MethodGet, "/executions/"+exec.ExecutionID, nil, &stored)
+	if step := stored.Steps[1]; step.Output != nil || !step.OutputOmitted {
+		t.Errorf("summary step output = %v, omitted %v; want no output, omitted", step.Output, step.OutputOmitted)
+	}
+	if stored.TraceLevel != workflow.TraceLevelSummary {
+		t.Errorf("trace level = %q, want %q", stored.TraceLevel, workflow.TraceLevelSummary)
+	}
+}
+
+func TestDecodeOutput(t *testing.T) {
+	api := newTestAPI(t)
+	api.importYAML("weather_alert.yaml")
+	exec := api.execute(25)
+
+	var weather workflow.IntegrationOutput
+	if err := exec.Steps[2].DecodeOutput(&weather); err != nil {
+		t.Fatal(err)
+	}
+	if want := (workflow.IntegrationOutput{Temperature: sandboxTemperature, Location: "Sydney", Country: "AU", Sandbox: true}); weather != want {
+		t.Errorf("integration output = %+v, want %+v", weather, want)
+	}
+
+	var condition workflow.ConditionOutput
+	if err := exec.Steps[3].DecodeOutput(&condition); err != nil {
+		t.Fatal(err)
+	}
+	if !condition.ConditionMet || condition.Threshold != 25 || condition.ActualValue != sandboxTemperature || condition.Operator != "greater_than" {
+		t.Errorf("condition output = %+v", condition)
+	}
+
+	var sent workflow.EmailOutput
+	if err := exec.Steps[4].DecodeOutput(&sent); err != nil {
+		t.Fatal(err)
+	}
+	if !sent.EmailSent || len(sent.Deliveries) != 1 || sent.Deliveries[0].To != "jo@example.com" || sent.Deliveries[0].Status != "sent" {
+		t.Errorf("email output = %+v", sent)
+	}
+
+	// The views leave keys they don't know in Output.
+	if _, ok := exec.Steps[4].Output["emailDraft"]; !ok {
+		t.Error("email output lost its draft")
+	}
+}
@@ -0,0 +1,166 @@
+package workflow
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/engine/handlers"
+)
+
+// NodeStatusNotReached marks the nodes of a graph overlay the run never got to.
+const NodeStatusNotReached = "not-reached"
+
+// includeGraphOverlay is the include value of GET /executions/{id} adding a
+// GraphOverlay.
+const includeGraphOverlay = "graphOverlay"
+
+// GraphOverlay maps one execution onto its workflow's canvas: the status of
+// every node and the edges the run followed. It is derived from the stored
+// trace, so executions with a reduced trace level show fewer steps.
+type GraphOverlay struct {
+	WorkflowVersion int `json:"workflowVersion"`
+	// DefinitionChanged is set when the workflow changed since the execution
+	// ran; nodes and edges that no longer exist are left out.
+	DefinitionChanged bool `json:"definitionChanged,omitempty"`
+	// Nodes holds the status of every node by id: that of its last step, or
+	// not-reached.
+	Nodes map[string]string `json:"nodes"`
+	// Edges lists the ids of the edges followed, in the order first taken.
+	Edges []string `json:"edges"`
+}
+
+// HandleGetExecution returns a stored execution. With ?include=graphOverlay
+// it also maps the run onto the workflow's nodes and edges.
+func (s *Service) HandleGetExecution(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var overlay bool
+	if raw := r.URL.Query().Get("include"); raw != "" {
+		for _, item := range strings.Split(raw, ",") {
+			if item != includeGraphOverlay {
+				writeError(w, http.StatusBadRequest, "invalid_include",
+					fmt.Sprintf("include must be %s", includeGraphOverlay))
+				return
+			}
+			overlay = true
+		}
+	}
+
+	rec, err := s.repo.GetExecution(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load execution")
+		return
+	}
+
+	resp := executionResponseFromRecord(rec)
+	resp.Resolution = rec.Resolution
+	if resp.Notes, err = s.repo.ListExecutionNotes(r.Context(), id); err != nil {
+		writeStoreError(w, err, "list execution notes")
+		return
+	}
+	if overlay {
+		wf, err := s.repo.GetWorkflow(r.Context(), rec.WorkflowID)
+		if err != nil {
+			writeStoreError(w, err, "load workflow")
+			return
+		}
+		resp.GraphOverlay = graphOverlay(wf, rec)
+	}
+	s.capSteps(&resp)
+	respond(w, http.StatusOK, resp)
+}
+
+// graphOverlay replays the steps of rec on wf. An edge counts as followed when
+// the latest earlier step with an edge to a step's node ran its source, on
+// the branch the source took. Merge nodes count an edge from each parallel
+// branch that joined them.
+func graphOverlay(wf *Workflow, rec *ExecutionRecord) *GraphOverlay {
+	overlay := &GraphOverlay{
+		WorkflowVersion:   wf.Version,
+		DefinitionChanged: rec.WorkflowVersion != 0 && rec.WorkflowVersion != wf.Version,
+		Nodes:             make(map[string]string, len(wf.Nodes)),
+		Edges:             []string{},
+	}
+	for _, n := range wf.Nodes {
+		if !IsAnnotation(n.Type) {
+			overlay.Nodes[n.ID] = NodeStatusNotReached
+		}
+	}
+
+	outgoing := make(map[string][]Edge)
+	for _, e := range wf.Edges {
+		outgoing[e.Source] = append(outgoing[e.Source], e)
+	}
+
+	for i, step := range rec.Steps {
+		if _, ok := overlay.Nodes[step.NodeID]; ok {
+			overlay.Nodes[step.NodeID] = step.Status
+		}
+		if i == 0 || rec.Steps[i-1].NodeID == step.NodeID || step.Compensation {
+			continue
+		}
+		for _, prev := range slices.Backward(rec.Steps[:i]) {
+			if prev.NodeID == step.NodeID {
+				break
+			}
+			if prev.Compensation {
+				continue
+			}
+			followed := followedEdge(outgoing[prev.NodeID], prev, step.NodeID)
+			if followed == nil {
+				continue
+			}
+			if !slices.Contains(overlay.Edges, followed.ID) {
+				overlay.Edges = append(overlay.Edges, followed.ID)
+			}
+			if step.Type != engine.NodeTypeMerge {
+				break
+			}
+		}
+	}
+	return overlay
+}
+
+// followedEdge returns the edge of edges from the node of prev to target, on
+// the branch prev took if its output tells.
+func followedEdge(edges []Edge, prev ExecutionStep, target string) *Edge {
+	branch := stepBranch(prev)
+	for _, e := range edges {
+		if e.Target == target && (branch == "" || e.SourceHandle == branch) {
+			return &e
+		}
+	}
+	return nil
+}
+
+// stepBranch returns the branch a step of a branching node took, as far as
+// its output tells.
+func stepBranch(step ExecutionStep) string {
+	if step.Type == engine.NodeTypeLoop {
+		var out LoopOutput
+		if step.DecodeOutput(&out) == nil && out.Done {
+			return handlers.LoopDone
+		}
+		return handlers.LoopBody
+	}
+	if met, ok := step.Output["conditionMet"].(bool); ok {
+		return fmt.Sprint(met)
+	}
+	if valid, ok := step.Output["valid"].(bool); ok {
+		if valid {
+			return "valid"
+		}
+		return "invalid"
+	}
+	if dup, ok := step.Output["duplicate"].(bool); ok {
+		if dup {
+			return "duplicate"
+		}
+		return "unique"
+	}
+	return ""
+}
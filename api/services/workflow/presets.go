@@ -0,0 +1,170 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxPresetNameLength bounds the name of an input preset.
+const maxPresetNameLength = 100
+
+// InputPreset is named execution input saved for a workflow, so a run can be
+// repeated without retyping its form data.
+type InputPreset struct {
+	ID         string         `json:"id"`
+	WorkflowID string         `json:"workflowId"`
+	Name       string         `json:"name"`
+	FormData   map[string]any `json:"formData"`
+	Condition  map[string]any `json:"condition,omitempty"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	UpdatedAt  time.Time      `json:"updatedAt"`
+}
+
+// InputPresetRequest is the body of POST and PUT
+// /workflows/{id}/input-presets.
+type InputPresetRequest struct {
+	Name      string         `json:"name"`
+	FormData  map[string]any `json:"formData"`
+	Condition map[string]any `json:"condition"`
+}
+
+func (req *InputPresetRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+	if len(req.Name) > maxPresetNameLength {
+		return fmt.Errorf("name must be at most %d characters", maxPresetNameLength)
+	}
+	if req.FormData == nil {
+		return fmt.Errorf("formData must be an object")
+	}
+	return nil
+}
+
+// apply copies the request onto p.
+func (req *InputPresetRequest) apply(p *InputPreset) {
+	p.Name = req.Name
+	p.FormData = req.FormData
+	p.Condition = req.Condition
+}
+
+func decodeInputPresetRequest(w http.ResponseWriter, r *http.Request) (*InputPresetRequest, bool) {
+	var req InputPresetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return nil, false
+	}
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_preset", err.Error())
+		return nil, false
+	}
+	return &req, true
+}
+
+func (s *Service) HandleListInputPresets(w http.ResponseWriter, r *http.Request) {
+	workflowID := mux.Vars(r)["id"]
+
+	presets, err := s.repo.ListInputPresets(r.Context(), workflowID)
+	if err != nil {
+		writeStoreError(w, err, "list input presets")
+		return
+	}
+	respond(w, http.StatusOK, presets)
+}
+
+func (s *Service) HandleCreateInputPreset(w http.ResponseWriter, r *http.Request) {
+	workflowID := mux.Vars(r)["id"]
+	req, ok := decodeInputPresetRequest(w, r)
+	if !ok {
+		return
+	}
+
+	preset := &InputPreset{WorkflowID: workflowID}
+	req.apply(preset)
+	if err := s.repo.CreateInputPreset(r.Context(), preset); err != nil {
+		writeStoreError(w, err, "create input preset")
+		return
+	}
+	respond(w, http.StatusCreated, preset)
+}
+
+func (s *Service) HandleGetInputPreset(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workflowID, presetID := vars["id"], vars["presetId"]
+
+	preset, err := s.repo.GetInputPreset(r.Context(), workflowID, presetID)
+	if err != nil {
+		writeStoreError(w, err, "load input preset")
+		return
+	}
+	respond(w, http.StatusOK, preset)
+}
+
+func (s *Service) HandleUpdateInputPreset(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workflowID, presetID := vars["id"], vars["presetId"]
+	req, ok := decodeInputPresetRequest(w, r)
+	if !ok {
+		return
+	}
+
+	preset, err := s.repo.GetInputPreset(r.Context(), workflowID, presetID)
+	if err != nil {
+		writeStoreError(w, err, "load input preset")
+		return
+	}
+	req.apply(preset)
+	if err := s.repo.UpdateInputPreset(r.Context(), preset); err != nil {
+		writeStoreError(w, err, "update input preset")
+		return
+	}
+	respond(w, http.StatusOK, preset)
+}
+
+func (s *Service) HandleDeleteInputPreset(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workflowID, presetID := vars["id"], vars["presetId"]
+
+	if err := s.repo.DeleteInputPreset(r.Context(), workflowID, presetID); err != nil {
+		writeStoreError(w, err, "delete input preset")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyPreset fills the request's input from the workflow's preset it names.
+// Form data and condition values in the request override the preset's.
+func (s *Service) applyPreset(ctx context.Context, workflowID string, req *ExecuteRequest) *apiError {
+	presets, err := s.repo.ListInputPresets(ctx, workflowID)
+	if err != nil {
+		return storeError(err, "list input presets")
+	}
+	for _, p := range presets {
+		if p.Name != req.Preset {
+			continue
+		}
+		req.FormData = mergeInput(p.FormData, req.FormData)
+		req.Condition = mergeInput(p.Condition, req.Condition)
+		return nil
+	}
+	return &apiError{status: http.StatusUnprocessableEntity,
+		body: ErrorResponse{Code: "unknown_preset", Message: fmt.Sprintf("workflow has no input preset named %q", req.Preset)}}
+}
+
+// mergeInput returns base with the values of override set over it.
+func mergeInput(base, override map[string]any) map[string]any {
+	if base == nil {
+		return override
+	}
+	merged := maps.Clone(base)
+	maps.Copy(merged, override)
+	return merged
+}
@@ -0,0 +1,286 @@
+package workflow
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+
+	"workflow-code-test/api/pkg/email"
+)
+
+// redactedValue replaces erased personal data.
+const redactedValue = "[redacted]"
+
+// EraseRequest is the body of POST /privacy/erase. At least one of Email and
+// Phone is required.
+type EraseRequest struct {
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+}
+
+// EraseReport counts the records a data subject was erased from. The subject
+// itself is not echoed back.
+type EraseReport struct {
+	ExecutionsScanned int `json:"executionsScanned"`
+	// Executions is the number of executions that mentioned the subject, and
+	// ExecutionIDs lists them.
+	Executions    int      `json:"executions"`
+	Inputs        int      `json:"inputs"`
+	FinalContexts int      `json:"finalContexts"`
+	Traces        int      `json:"traces"`
+	Checkpoints   int      `json:"checkpoints"`
+	ExecutionIDs  []string `json:"executionIds"`
+	// Presets is the number of input presets whose form data or condition
+	// mentioned the subject.
+	Presets int `json:"presets"`
+	// ContractTests is the number of contract tests whose form data,
+	// condition or expectations mentioned the subject.
+	ContractTests int `json:"contractTests"`
+	// OutboxMessages is the number of emails in the dev outbox that
+	// mentioned the subject; it is always 0 outside dev mode.
+	OutboxMessages int `json:"outboxMessages"`
+	// DistributionLists is the number of distribution lists the subject's
+	// email address was removed from.
+	DistributionLists int `json:"distributionLists"`
+}
+
+// Subject matches the personal data of one person in stored values: their
+// email address in any case, anywhere in a string, and their phone number as
+// written or as a string with the same digits, e.g. "+61 400 000 000" and
+// "61400000000".
+type Subject struct {
+	email       string
+	pattern     *regexp.Regexp
+	phoneDigits string
+}
+
+// minPhoneDigits keeps short numbers from matching unrelated values.
+const minPhoneDigits = 6
+
+var phoneChars = regexp.MustCompile(`^[0-9+()\-. ]+$`)
+
+func newSubject(email, phone string) *Subject {
+	var alts []string
+	s := &Subject{email: email}
+	if email != "" {
+		alts = append(alts, regexp.QuoteMeta(email))
+	}
+	if phone != "" {
+		alts = append(alts, regexp.QuoteMeta(phone))
+		s.phoneDigits = digits(phone)
+	}
+	s.pattern = regexp.MustCompile("(?i)" + strings.Join(alts, "|"))
+	return s
+}
+
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func (s *Subject) redactString(v string) string {
+	if s.phoneDigits != "" && phoneChars.MatchString(v) && digits(v) == s.phoneDigits {
+		return redactedValue
+	}
+	return s.pattern.ReplaceAllLiteralString(v, redactedValue)
+}
+
+// redact replaces the subject in every string of a decoded JSON value and
+// reports whether anything changed. Object keys are left alone.
+func (s *Subject) redact(v any) (any, bool) {
+	switch v := v.(type) {
+	case string:
+		out := s.redactString(v)
+		return out, out != v
+	case map[string]any:
+		changed := false
+		for k, child := range v {
+			if out, ok := s.redact(child); ok {
+				v[k], changed = out, true
+			}
+		}
+		return v, changed
+	case []any:
+		changed := false
+		for i, child := range v {
+			if out, ok := s.redact(child); ok {
+				v[i], changed = out, true
+			}
+		}
+		return v, changed
+	}
+	return v, false
+}
+
+// redactJSON redacts the value ptr points to through its JSON form.
+func (s *Subject) redactJSON(ptr any) (bool, error) {
+	raw, err := json.Marshal(ptr)
+	if err != nil {
+		return false, err
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return false, err
+	}
+	v, changed := s.redact(v)
+	if !changed {
+		return false, nil
+	}
+	if raw, err = json.Marshal(v); err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(raw, ptr)
+}
+
+// erase redacts the subject from rec and adds what changed to report. It
+// reports whether rec changed.
+func (s *Subject) erase(rec *ExecutionRecord, report *EraseReport) (bool, error) {
+	report.ExecutionsScanned++
+	parts := []struct {
+		ptr   any
+		count *int
+	}{
+		{&rec.Input, &report.Inputs},
+		{&rec.FinalContext, &report.FinalContexts},
+		{&rec.Steps, &report.Traces},
+		{&rec.Checkpoint, &report.Checkpoints},
+	}
+	changed := false
+	for _, p := range parts {
+		ok, err := s.redactJSON(p.ptr)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			*p.count++
+			changed = true
+		}
+	}
+	if changed {
+		report.Executions++
+		report.ExecutionIDs = append(report.ExecutionIDs, rec.ID)
+	}
+	return changed, nil
+}
+
+// erasePreset redacts the subject from the form data and condition of p and
+// counts it in report. It reports whether p changed. Preset names are left
+// alone, like object keys.
+func (s *Subject) erasePreset(p *InputPreset, report *EraseReport) (bool, error) {
+	changed := false
+	for _, ptr := range []*map[string]any{&p.FormData, &p.Condition} {
+		ok, err := s.redactJSON(ptr)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || ok
+	}
+	if changed {
+		report.Presets++
+	}
+	return changed, nil
+}
+
+// eraseContractTest redacts the subject from the form data, condition and
+// expectations of t and counts it in report. It reports whether t changed.
+// Test names are left alone, like preset names.
+func (s *Subject) eraseContractTest(t *ContractTest, report *EraseReport) (bool, error) {
+	changed := false
+	for _, ptr := range []any{&t.FormData, &t.Condition, &t.Expect} {
+		ok, err := s.redactJSON(ptr)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || ok
+	}
+	if changed {
+		report.ContractTests++
+	}
+	return changed, nil
+}
+
+// eraseMessage redacts the subject from the addresses, subject and body of
+// msg. Attachments are left alone: their content is binary and only their
+// size is ever shown.
+func (s *Subject) eraseMessage(msg *email.Message) bool {
+	changed := false
+	for _, field := range []*string{&msg.To, &msg.From, &msg.Subject, &msg.Body} {
+		if out := s.redactString(*field); out != *field {
+			*field, changed = out, true
+		}
+	}
+	return changed
+}
+
+// eraseList removes the subject's email address from list, matching it
+// exactly but for case rather than anywhere in an address like elsewhere,
+// so addresses that merely contain it stay, and redacts the subject from the
+// description. A list left without addresses is kept, adding no recipients
+// to email nodes until addresses are added again.
+func (s *Subject) eraseList(list *email.DistributionList) bool {
+	changed := false
+	if s.email != "" {
+		kept := slices.DeleteFunc(slices.Clone(list.Addresses), func(a string) bool { return strings.EqualFold(a, s.email) })
+		if len(kept) != len(list.Addresses) {
+			list.Addresses, changed = kept, true
+		}
+	}
+	if out := s.redactString(list.Description); out != list.Description {
+		list.Description, changed = out, true
+	}
+	return changed
+}
+
+// HandleErase redacts a person's email address and phone number from every
+// stored execution, input preset and contract test, from the dev outbox and
+// from the distribution lists.
+func (s *Service) HandleErase(w http.ResponseWriter, r *http.Request) {
+	var req EraseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return
+	}
+	req.Email, req.Phone = strings.TrimSpace(req.Email), strings.TrimSpace(req.Phone)
+	if req.Email == "" && req.Phone == "" {
+		writeError(w, http.StatusBadRequest, "invalid_subject", "email or phone is required")
+		return
+	}
+	if req.Email != "" {
+		if _, err := mail.ParseAddress(req.Email); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_subject", "email is not a valid email address")
+			return
+		}
+	}
+	if req.Phone != "" && (!phoneChars.MatchString(req.Phone) || len(digits(req.Phone)) < minPhoneDigits) {
+		writeError(w, http.StatusBadRequest, "invalid_subject",
+			"phone must be a phone number with at least 6 digits")
+		return
+	}
+
+	subject := newSubject(req.Email, req.Phone)
+	report, err := s.repo.EraseSubject(r.Context(), subject)
+	if err != nil {
+		writeStoreError(w, err, "erase personal data")
+		return
+	}
+	if s.outbox != nil {
+		report.OutboxMessages = s.outbox.Redact(subject.eraseMessage)
+	}
+	if s.lists != nil {
+		if report.DistributionLists, err = s.lists.Redact(r.Context(), subject.eraseList); err != nil {
+			writeStoreError(w, err, "erase personal data from distribution lists")
+			return
+		}
+	}
+	slog.Info("Erased data subject", "executionsScanned", report.ExecutionsScanned, "executions", report.Executions,
+		"presets", report.Presets, "contractTests", report.ContractTests, "outboxMessages", report.OutboxMessages, "distributionLists", report.DistributionLists)
+	respond(w, http.StatusOK, report)
+}
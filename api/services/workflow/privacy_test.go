@@ -0,0 +1,156 @@
+package workflow_test
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"workflow-code-test/api/pkg/email"
+	"workflow-code-test/api/services/workflow"
+)
+
+// createPreset stores an input preset of the sample workflow.
+func (api *testAPI) createPreset(name string, formData map[string]any) workflow.InputPreset {
+	api.t.Helper()
+	var p workflow.InputPreset
+	body := workflow.InputPresetRequest{Name: name, FormData: formData}
+	if code := api.do(http.MethodPost, "/workflows/"+sampleID+"/input-presets", body, &p); code != http.StatusCreated {
+		api.t.Fatalf("create preset %s: got %d, want 201", name, code)
+	}
+	return p
+}
+
+func TestEraseSubject(t *testing.T) {
+	api := newTestAPI(t)
+	api.importYAML("weather_alert.yaml")
+	exec := api.execute(25)
+	jo := api.createPreset("Jo", map[string]any{"name": "Jo", "email": "jo@example.com", "phone": "+61 400 000 000", "city": "Sydney"})
+	sam := api.createPreset("Sam", map[string]any{"name": "Sam", "email": "sam@example.com", "city": "Hobart"})
+
+	var report workflow.EraseReport
+	code := api.do(http.MethodPost, "/privacy/erase", workflow.EraseRequest{Email: "JO@example.com", Phone: "61400000000"}, &report)
+	if code != http.StatusOK {
+		t.Fatalf("erase: got %d, want 200", code)
+	}
+	if report.Executions != 1 || report.Presets != 1 || report.OutboxMessages != 1 {
+		t.Errorf("report = %+v, want 1 execution, 1 preset and 1 outbox message", report)
+	}
+
+	var stored workflow.ExecutionResponse
+	api.do(http.MethodGet, "/executions/"+exec.ExecutionID, nil, &stored)
+	if got := stored.Steps[1].Output["email"]; got != "[redacted]" {
+		t.Errorf("form step email = %v, want it redacted", got)
+	}
+
+	var got workflow.InputPreset
+	api.do(http.MethodGet, "/workflows/"+sampleID+"/input-presets/"+jo.ID, nil, &got)
+	if got.FormData["email"] != "[redacted]" || got.FormData["phone"] != "[redacted]" {
+		t.Errorf("Jo's preset form data = %v, want the email and phone redacted", got.FormData)
+	}
+	if got.FormData["name"] != "Jo" || got.Name != "Jo" {
+		t.Errorf("Jo's preset = %+v, want the name kept", got)
+	}
+	api.do(http.MethodGet, "/workflows/"+sampleID+"/input-presets/"+sam.ID, nil, &got)
+	if got.FormData["email"] != "sam@example.com" || !got.UpdatedAt.Equal(sam.UpdatedAt) {
+		t.Errorf("Sam's preset = %+v, want it untouched", got)
+	}
+
+	var outbox []email.SentMessage
+	if code := api.do(http.MethodGet, "/dev/outbox", nil, &outbox); code != http.StatusOK {
+		t.Fatalf("outbox: got %d, want 200", code)
+	}
+	if len(outbox) != 1 || outbox[0].To != "[redacted]" {
+		t.Errorf("outbox = %+v, want the recipient redacted", outbox)
+	}
+
+	// Erasing again finds nothing left.
+	api.do(http.MethodPost, "/privacy/erase", workflow.EraseRequest{Email: "jo@example.com"}, &report)
+	if report.Executions != 0 || report.Presets != 0 || report.OutboxMessages != 0 {
+		t.Errorf("second report = %+v, want nothing erased", report)
+	}
+}
+
+func TestEraseSubjectFromDistributionLists(t *testing.T) {
+	api := newTestAPIWith(t, nil, workflow.WithDistributionLists(email.NewMemoryLists()))
+	lists := []workflow.DistributionListRequest{
+		{Name: "oncall", Description: "Escalations, ask Jo@example.com", Addresses: []string{"Jo@Example.com", "bojo@example.com", "sam@example.com"}},
+		{Name: "weekly", Addresses: []string{"sam@example.com"}},
+	}
+	for _, l := range lists {
+		if code := api.do(http.MethodPost, "/distribution-lists", l, nil); code != http.StatusCreated {
+			t.Fatalf("create list %s: got %d, want 201", l.Name, code)
+		}
+	}
+
+	var report workflow.EraseReport
+	if code := api.do(http.MethodPost, "/privacy/erase", workflow.EraseRequest{Email: "jo@example.com"}, &report); code != http.StatusOK {
+		t.Fatalf("erase: got %d, want 200", code)
+	}
+	if report.DistributionLists != 1 {
+		t.Errorf("report = %+v, want 1 distribution list", report)
+	}
+
+	// Only the subject's own address goes, not ones merely containing it.
+	var got email.DistributionList
+	api.do(http.MethodGet, "/distribution-lists/oncall", nil, &got)
+	if want := []string{"bojo@example.com", "sam@example.com"}; !slices.Equal(got.Addresses, want) {
+		t.Errorf("oncall addresses = %v, want %v", got.Addresses, want)
+	}
+	if got.Description != "Escalations, ask [redacted]" {
+		t.Errorf("oncall description = %q, want the address redacted", got.Description)
+	}
+	api.do(http.MethodGet, "/distribution-lists/weekly", nil, &got)
+	if !slices.Equal(got.Addresses, []string{"sam@example.com"}) {
+		t.Errorf("weekly addresses = %v, want them untouched", got.Addresses)
+	}
+
+	api.do(http.MethodPost, "/privacy/erase", workflow.EraseRequest{Email: "jo@example.com"}, &report)
+	if report.DistributionLists != 0 {
+		t.Errorf("second report = %+v, want no distribution list", report)
+	}
+}
+
+func TestEraseSubjectFromContractTests(t *testing.T) {
+	api := newTestAPI(t)
+	api.importYAML("weather_alert.yaml")
+	create := func(name string, formData map[string]any, expect *workflow.ContractExpectation) workflow.ContractTest {
+		t.Helper()
+		var ct workflow.ContractTest
+		body := workflow.ContractTestRequest{Name: name, FormData: formData, Expect: expect}
+		if code := api.do(http.MethodPost, "/workflows/"+sampleID+"/contract-tests", body, &ct); code != http.StatusCreated {
+			t.Fatalf("create contract test %s: got %d, want 201", name, code)
+		}
+		return ct
+	}
+	jo := create("Jo in Sydney",
+		map[string]any{"name": "Jo", "email": "jo@example.com", "phone": "+61 400 000 000", "city": "Sydney"},
+		&workflow.ContractExpectation{Outputs: map[string]map[string]any{"form": {"email": "jo@example.com"}}})
+	sam := create("Sam in Hobart",
+		map[string]any{"name": "Sam", "email": "sam@example.com", "city": "Hobart"},
+		&workflow.ContractExpectation{Status: "completed"})
+
+	var report workflow.EraseReport
+	code := api.do(http.MethodPost, "/privacy/erase", workflow.EraseRequest{Email: "jo@example.com", Phone: "+61400000000"}, &report)
+	if code != http.StatusOK {
+		t.Fatalf("erase: got %d, want 200", code)
+	}
+	if report.ContractTests != 1 {
+		t.Errorf("report = %+v, want 1 contract test", report)
+	}
+
+	var got workflow.ContractTest
+	api.do(http.MethodGet, "/workflows/"+sampleID+"/contract-tests/"+jo.ID, nil, &got)
+	if got.FormData["email"] != "[redacted]" || got.FormData["phone"] != "[redacted]" {
+		t.Errorf("Jo's test form data = %v, want the email and phone redacted", got.FormData)
+	}
+	if out := got.Expect.Outputs["form"]["email"]; out != "[redacted]" {
+		t.Errorf("Jo's test expects email %v, want it redacted", out)
+	}
+	if got.FormData["name"] != "Jo" || got.Name != "Jo in Sydney" {
+		t.Errorf("Jo's test = %+v, want the name kept", got)
+	}
+	api.do(http.MethodGet, "/workflows/"+sampleID+"/contract-tests/"+sam.ID, nil, &got)
+	if got.FormData["email"] != "sam@example.com" || !got.UpdatedAt.Equal(sam.UpdatedAt) {
+		t.Errorf("Sam's test = %+v, want it untouched", got)
+	}
+}
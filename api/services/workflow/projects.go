@@ -0,0 +1,204 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Limits on projects and transfers.
+const (
+	maxProjectNameLength    = 100
+	maxTransferReasonLength = 1000
+	// maxTransferSize caps the workflows moved by one transfer.
+	maxTransferSize = 100
+)
+
+// Project groups workflows, e.g. those a team owns. The API has no accounts,
+// so Team is just the name of the owning team.
+type Project struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Team      string    `json:"team"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ProjectRequest is the body of POST /projects and PUT /projects/{id}.
+type ProjectRequest struct {
+	Name string `json:"name"`
+	Team string `json:"team"`
+}
+
+func (req *ProjectRequest) validate() error {
+	req.Name, req.Team = strings.TrimSpace(req.Name), strings.TrimSpace(req.Team)
+	if req.Name == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+	if len(req.Name) > maxProjectNameLength || len(req.Team) > maxProjectNameLength {
+		return fmt.Errorf("name and team must be at most %d characters", maxProjectNameLength)
+	}
+	return nil
+}
+
+// WorkflowTransfer is the audit entry of a workflow moved between projects.
+// FromProjectID is empty for workflows that were in no project.
+type WorkflowTransfer struct {
+	ID            string    `json:"id"`
+	WorkflowID    string    `json:"workflowId"`
+	FromProjectID string    `json:"fromProjectId,omitempty"`
+	ToProjectID   string    `json:"toProjectId"`
+	Author        string    `json:"author"`
+	Reason        string    `json:"reason,omitempty"`
+	TransferredAt time.Time `json:"transferredAt"`
+}
+
+// TransferRequest is the body of POST /projects/{id}/transfers.
+type TransferRequest struct {
+	WorkflowIDs []string `json:"workflowIds"`
+	Author      string   `json:"author"`
+	Reason      string   `json:"reason"`
+}
+
+func (req *TransferRequest) validate() error {
+	req.Author, req.Reason = strings.TrimSpace(req.Author), strings.TrimSpace(req.Reason)
+	switch {
+	case len(req.WorkflowIDs) == 0:
+		return fmt.Errorf("workflowIds must not be empty")
+	case len(req.WorkflowIDs) > maxTransferSize:
+		return fmt.Errorf("at most %d workflows can be transferred at once", maxTransferSize)
+	case req.Author == "":
+		return fmt.Errorf("author is required")
+	case len(req.Author) > maxAuthorLength:
+		return fmt.Errorf("author must be at most %d characters", maxAuthorLength)
+	case len(req.Reason) > maxTransferReasonLength:
+		return fmt.Errorf("reason must be at most %d characters", maxTransferReasonLength)
+	}
+	seen := make(map[string]bool, len(req.WorkflowIDs))
+	for _, id := range req.WorkflowIDs {
+		if _, err := uuid.Parse(id); err != nil {
+			return fmt.Errorf("%q is not a UUID", id)
+		}
+		if seen[id] {
+			return fmt.Errorf("workflow %s is listed twice", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+func decodeProjectRequest(w http.ResponseWriter, r *http.Request) (*ProjectRequest, bool) {
+	var req ProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return nil, false
+	}
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_project", err.Error())
+		return nil, false
+	}
+	return &req, true
+}
+
+func (s *Service) HandleListProjects(w http.ResponseWriter, r *http.Request) {
+	projects, err := s.repo.ListProjects(r.Context())
+	if err != nil {
+		writeStoreError(w, err, "list projects")
+		return
+	}
+	respond(w, http.StatusOK, projects)
+}
+
+func (s *Service) HandleCreateProject(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeProjectRequest(w, r)
+	if !ok {
+		return
+	}
+
+	project := &Project{Name: req.Name, Team: req.Team}
+	if err := s.repo.CreateProject(r.Context(), project); err != nil {
+		writeStoreError(w, err, "create project")
+		return
+	}
+	respond(w, http.StatusCreated, project)
+}
+
+func (s *Service) HandleGetProject(w http.ResponseWriter, r *http.Request) {
+	project, err := s.repo.GetProject(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err, "load project")
+		return
+	}
+	respond(w, http.StatusOK, project)
+}
+
+func (s *Service) HandleUpdateProject(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeProjectRequest(w, r)
+	if !ok {
+		return
+	}
+
+	project := &Project{ID: mux.Vars(r)["id"], Name: req.Name, Team: req.Team}
+	if err := s.repo.UpdateProject(r.Context(), project); err != nil {
+		writeStoreError(w, err, "update project")
+		return
+	}
+	respond(w, http.StatusOK, project)
+}
+
+// HandleDeleteProject removes a project once its workflows have been
+// transferred out; until then it answers 409.
+func (s *Service) HandleDeleteProject(w http.ResponseWriter, r *http.Request) {
+	if err := s.repo.DeleteProject(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeStoreError(w, err, "delete project")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleTransferWorkflows moves workflows into the project all at once,
+// recording an audit entry for each. Hooks, receivers, input presets and
+// bindings belong to their workflow and move with it.
+func (s *Service) HandleTransferWorkflows(w http.ResponseWriter, r *http.Request) {
+	projectID := mux.Vars(r)["id"]
+	var req TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_transfer", err.Error())
+		return
+	}
+
+	transfers, err := s.repo.TransferWorkflows(r.Context(), projectID, req.WorkflowIDs, req.Author, req.Reason)
+	if err != nil {
+		writeStoreError(w, err, "transfer workflows")
+		return
+	}
+	for _, id := range req.WorkflowIDs {
+		s.forgetWorkflow(r.Context(), id)
+	}
+	respond(w, http.StatusOK, transfers)
+}
+
+// HandleListTransfers returns the transfers into and out of the project,
+// newest first.
+func (s *Service) HandleListTransfers(w http.ResponseWriter, r *http.Request) {
+	projectID := mux.Vars(r)["id"]
+	if _, err := s.repo.GetProject(r.Context(), projectID); err != nil {
+		writeStoreError(w, err, "load project")
+		return
+	}
+	transfers, err := s.repo.ListTransfers(r.Context(), projectID)
+	if err != nil {
+		writeStoreError(w, err, "list transfers")
+		return
+	}
+	respond(w, http.StatusOK, transfers)
+}
@@ -0,0 +1,125 @@
+package workflow
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// QueueStatus describes the async execution queue and workers of this
+// process, as returned by GET /admin/queue. Autoscalers such as KEDA's
+// metrics-api scaler read queueDepth or load from it.
+type QueueStatus struct {
+	WorkerID    string `json:"workerId,omitempty"`
+	MinWorkers  int    `json:"minWorkers"`
+	MaxWorkers  int    `json:"maxWorkers"`
+	Workers     int    `json:"workers"`
+	BusyWorkers int    `json:"busyWorkers"`
+	QueueDepth  int    `json:"queueDepth"`
+	// OldestPendingSeconds is how long the run first in the queue has been
+	// waiting for a worker, 0 when the queue is empty.
+	OldestPendingSeconds float64 `json:"oldestPendingSeconds"`
+	// Load is the busy workers plus the queued runs relative to MaxWorkers:
+	// above 1 runs are waiting. Unbounded pools report the busy workers.
+	Load float64 `json:"load"`
+	// Completed counts the runs finished since the process started and
+	// ThroughputPerMinute those finished within the last minute.
+	Completed           uint64         `json:"completed"`
+	ThroughputPerMinute int            `json:"throughputPerMinute"`
+	PerWorker           []WorkerStatus `json:"perWorker"`
+}
+
+// WorkerStatus describes one worker of the execution pool.
+type WorkerStatus struct {
+	ID                  int       `json:"id"`
+	Busy                bool      `json:"busy"`
+	Completed           uint64    `json:"completed"`
+	ThroughputPerMinute int       `json:"throughputPerMinute"`
+	StartedAt           time.Time `json:"startedAt"`
+}
+
+// queueStatus returns the status of the executor's queue, writing a 501 if
+// the executor doesn't queue runs.
+func (s *Service) queueStatus(w http.ResponseWriter) (*QueueStatus, bool) {
+	queued, ok := s.executor.(engine.Queued)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "not_supported", "the execution backend does not queue async runs")
+		return nil, false
+	}
+	stats := queued.QueueStats()
+
+	status := &QueueStatus{
+		MinWorkers:           stats.MinWorkers,
+		MaxWorkers:           stats.MaxWorkers,
+		Workers:              stats.Workers,
+		BusyWorkers:          stats.BusyWorkers,
+		QueueDepth:           stats.Pending,
+		OldestPendingSeconds: stats.OldestPendingAge.Seconds(),
+		Load:                 float64(stats.BusyWorkers),
+		Completed:            stats.Completed,
+		PerWorker:            make([]WorkerStatus, 0, len(stats.WorkerStats)),
+	}
+	if stats.MaxWorkers > 0 {
+		status.Load = float64(stats.BusyWorkers+stats.Pending) / float64(stats.MaxWorkers)
+	}
+	if worker, ok := s.executor.(interface{ WorkerID() string }); ok {
+		status.WorkerID = worker.WorkerID()
+	}
+	for _, ws := range stats.WorkerStats {
+		status.ThroughputPerMinute += ws.RecentCompleted
+		status.PerWorker = append(status.PerWorker, WorkerStatus{
+			ID:                  ws.ID,
+			Busy:                ws.Busy,
+			Completed:           ws.Completed,
+			ThroughputPerMinute: ws.RecentCompleted,
+			StartedAt:           ws.StartedAt,
+		})
+	}
+	return status, true
+}
+
+// HandleQueueStatus reports the async execution queue and workers of this
+// process.
+func (s *Service) HandleQueueStatus(w http.ResponseWriter, r *http.Request) {
+	if status, ok := s.queueStatus(w); ok {
+		respond(w, http.StatusOK, status)
+	}
+}
+
+// HandleMetrics exposes the queue status in the Prometheus text format, for
+// scraping and for autoscalers reading Prometheus.
+func (s *Service) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	status, ok := s.queueStatus(w)
+	if !ok {
+		return
+	}
+
+	var b strings.Builder
+	metric := func(name, kind, help string, value any) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+	metric("workflow_queue_depth", "gauge", "Async runs waiting for a worker.", status.QueueDepth)
+	metric("workflow_queue_oldest_pending_seconds", "gauge", "Time the oldest queued run has been waiting.", status.OldestPendingSeconds)
+	metric("workflow_queue_load", "gauge", "Busy workers plus queued runs relative to the maximum workers.", status.Load)
+	metric("workflow_workers", "gauge", "Workers running.", status.Workers)
+	metric("workflow_workers_busy", "gauge", "Workers executing a run.", status.BusyWorkers)
+	metric("workflow_workers_min", "gauge", "Workers kept while idle.", status.MinWorkers)
+	metric("workflow_workers_max", "gauge", "Maximum workers, 0 when unbounded.", status.MaxWorkers)
+	metric("workflow_runs_completed_total", "counter", "Async runs finished.", status.Completed)
+
+	fmt.Fprintf(&b, "# HELP workflow_worker_runs_completed_total Async runs finished by a worker.\n# TYPE workflow_worker_runs_completed_total counter\n")
+	for _, ws := range status.PerWorker {
+		fmt.Fprintf(&b, "workflow_worker_runs_completed_total{worker=\"%d\"} %d\n", ws.ID, ws.Completed)
+	}
+	fmt.Fprintf(&b, "# HELP workflow_worker_throughput_per_minute Async runs a worker finished within the last minute.\n# TYPE workflow_worker_throughput_per_minute gauge\n")
+	for _, ws := range status.PerWorker {
+		fmt.Fprintf(&b, "workflow_worker_throughput_per_minute{worker=\"%d\"} %d\n", ws.ID, ws.ThroughputPerMinute)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(b.String()))
+}
@@ -0,0 +1,179 @@
+package workflow
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultRatesWindow = 24 * time.Hour
+	defaultRatesBucket = time.Hour
+	minRatesBucket     = time.Minute
+	maxRatesBuckets    = 1000
+)
+
+// SourceCount is the number of executions of one trigger source started in
+// one time bucket, as counted by the repository.
+type SourceCount struct {
+	BucketStart time.Time
+	Source      string
+	Total       int64
+	Completed   int64
+	Failed      int64
+}
+
+// ExecutionRates counts executions by trigger source over time, as returned by
+// GET /admin/execution-rates.
+type ExecutionRates struct {
+	WorkflowID    string    `json:"workflowId,omitempty"`
+	Since         time.Time `json:"since"`
+	Until         time.Time `json:"until"`
+	BucketSeconds int64     `json:"bucketSeconds"`
+	// Sources lists the trigger sources seen in the window, in the order of
+	// Triggers and then by name.
+	Sources []string     `json:"sources"`
+	Totals  []SourceRate `json:"totals"`
+	// Buckets cover the window without gaps, oldest first, each with every
+	// source of Sources.
+	Buckets []RateBucket `json:"buckets"`
+}
+
+// RateBucket is one time bucket of ExecutionRates.
+type RateBucket struct {
+	Start   time.Time    `json:"start"`
+	Total   int64        `json:"total"`
+	Failed  int64        `json:"failed"`
+	Sources []SourceRate `json:"sources"`
+}
+
+// SourceRate counts the executions of one trigger source. FailureRate is the
+// share of them that failed, 0 without executions.
+type SourceRate struct {
+	Source      string  `json:"source"`
+	Total       int64   `json:"total"`
+	Completed   int64   `json:"completed"`
+	Failed      int64   `json:"failed"`
+	FailureRate float64 `json:"failureRate"`
+}
+
+func (r *SourceRate) add(c SourceCount) {
+	r.Total += c.Total
+	r.Completed += c.Completed
+	r.Failed += c.Failed
+	if r.Total > 0 {
+		r.FailureRate = float64(r.Failed) / float64(r.Total)
+	}
+}
+
+// HandleExecutionRates counts executions by trigger source in time buckets,
+// so load spikes can be attributed to their origin. The window and bucket
+// query parameters are Go durations (default 24h and 1h); workflowId limits
+// the counts to one workflow.
+func (s *Service) HandleExecutionRates(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	window, ok := durationParam(w, q.Get("window"), defaultRatesWindow, "invalid_window", "window must be a positive duration such as 24h")
+	if !ok {
+		return
+	}
+	bucket, ok := durationParam(w, q.Get("bucket"), defaultRatesBucket, "invalid_bucket", "bucket must be a duration of at least 1m such as 1h")
+	if !ok {
+		return
+	}
+	if bucket < minRatesBucket {
+		writeError(w, http.StatusBadRequest, "invalid_bucket", "bucket must be a duration of at least 1m such as 1h")
+		return
+	}
+	if window/bucket >= maxRatesBuckets {
+		writeError(w, http.StatusBadRequest, "invalid_bucket", "window must span fewer than 1000 buckets")
+		return
+	}
+	workflowID := q.Get("workflowId")
+	if workflowID != "" {
+		if _, err := uuid.Parse(workflowID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_id", "workflow id must be a UUID")
+			return
+		}
+	}
+
+	// Buckets are aligned to multiples of their width, so that e.g. hourly
+	// buckets start on the hour.
+	until := s.clock.Now()
+	since := until.Add(-window).Truncate(bucket)
+	counts, err := s.repo.CountExecutionsBySource(r.Context(), workflowID, since, bucket)
+	if err != nil {
+		writeStoreError(w, err, "count executions")
+		return
+	}
+	respond(w, http.StatusOK, executionRates(workflowID, since, until, bucket, counts))
+}
+
+// durationParam parses a positive duration query parameter, writing a 400
+// with code if it is invalid.
+func durationParam(w http.ResponseWriter, raw string, def time.Duration, code, msg string) (time.Duration, bool) {
+	if raw == "" {
+		return def, true
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		writeError(w, http.StatusBadRequest, code, msg)
+		return 0, false
+	}
+	return d, true
+}
+
+// executionRates lays counts out in buckets covering since to until.
+func executionRates(workflowID string, since, until time.Time, bucket time.Duration, counts []SourceCount) ExecutionRates {
+	rates := ExecutionRates{
+		WorkflowID:    workflowID,
+		Since:         since,
+		Until:         until,
+		BucketSeconds: int64(bucket / time.Second),
+		Sources:       []string{},
+		Totals:        []SourceRate{},
+	}
+
+	for _, c := range counts {
+		if !slices.Contains(rates.Sources, c.Source) {
+			rates.Sources = append(rates.Sources, c.Source)
+		}
+	}
+	slices.SortFunc(rates.Sources, func(a, b string) int {
+		ia, ib := slices.Index(Triggers, a), slices.Index(Triggers, b)
+		if ia < 0 {
+			ia = len(Triggers)
+		}
+		if ib < 0 {
+			ib = len(Triggers)
+		}
+		return cmp.Or(cmp.Compare(ia, ib), cmp.Compare(a, b))
+	})
+	newRates := func() []SourceRate {
+		out := make([]SourceRate, len(rates.Sources))
+		for i, source := range rates.Sources {
+			out[i].Source = source
+		}
+		return out
+	}
+
+	rates.Totals = newRates()
+	for start := since; start.Before(until); start = start.Add(bucket) {
+		rates.Buckets = append(rates.Buckets, RateBucket{Start: start, Sources: newRates()})
+	}
+	for _, c := range counts {
+		i := int(c.BucketStart.Sub(since) / bucket)
+		if i < 0 || i >= len(rates.Buckets) {
+			continue
+		}
+		j := slices.Index(rates.Sources, c.Source)
+		b := &rates.Buckets[i]
+		b.Sources[j].add(c)
+		b.Total += c.Total
+		b.Failed += c.Failed
+		rates.Totals[j].add(c)
+	}
+	return rates
+}
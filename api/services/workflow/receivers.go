@@ -0,0 +1,291 @@
+package workflow
+
+import (
+	"crypto/hmac"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/callback"
+	"workflow-code-test/api/pkg/inboundmail"
+	"workflow-code-test/api/pkg/jsonpath"
+	"workflow-code-test/api/pkg/payload"
+)
+
+// Receiver is a URL providers post webhooks to, each delivery running the
+// workflow. Its mappings copy values of the payload, addressed by JSONPath,
+// into state variables, so that the workflow doesn't need a transform node to
+// make sense of the provider's format.
+type Receiver struct {
+	ID         string `json:"id"`
+	WorkflowID string `json:"workflowId"`
+	// ContentType is json, form or xml; empty takes it from the Content-Type
+	// header of each delivery. "email" receives the emails an inbound parse
+	// webhook posts, read into an inboundmail.Message.
+	ContentType string `json:"contentType"`
+	// Mappings maps state variables to the JSONPath of their value in the
+	// decoded payload, e.g. {"orderId": "$.data.object.id"}.
+	Mappings  map[string]string `json:"mappings"`
+	Enabled   bool              `json:"enabled"`
+	HasSecret bool              `json:"hasSecret"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+
+	// Secret is write-only and never returned by the API.
+	Secret string `json:"-"`
+}
+
+// ReceiverRequest is the body of POST and PUT /workflows/{id}/receivers. On
+// update, an omitted secret keeps the current one.
+type ReceiverRequest struct {
+	ContentType string            `json:"contentType"`
+	Mappings    map[string]string `json:"mappings"`
+	Secret      *string           `json:"secret"`
+	Enabled     *bool             `json:"enabled"`
+}
+
+// ReceiverEmail is the content type of receivers of inbound emails.
+const ReceiverEmail = "email"
+
+// defaultEmailMappings are the mappings of email receivers created without
+// any.
+var defaultEmailMappings = map[string]string{"sender": "$.from", "subject": "$.subject", "body": "$.text"}
+
+// variableName matches the state variables mappings may set.
+var variableName = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+func (req *ReceiverRequest) validate() error {
+	if req.ContentType != "" && req.ContentType != ReceiverEmail && !slices.Contains(payload.ContentTypes, req.ContentType) {
+		return fmt.Errorf("unknown contentType %q, expected one of %v or %s",
+			req.ContentType, payload.ContentTypes, ReceiverEmail)
+	}
+	return validateMappings(req.Mappings)
+}
+
+// validateMappings checks that mappings map valid variable names to JSONPath
+// expressions.
+func validateMappings(mappings map[string]string) error {
+	for _, v := range slices.Sorted(maps.Keys(mappings)) {
+		if !variableName.MatchString(v) {
+			return fmt.Errorf("mappings: %q is not a valid variable name", v)
+		}
+		if _, err := jsonpath.Parse(mappings[v]); err != nil {
+			return fmt.Errorf("mappings.%s: %v", v, err)
+		}
+	}
+	return nil
+}
+
+// apply copies the request onto rec.
+func (req *ReceiverRequest) apply(rec *Receiver) {
+	rec.ContentType = req.ContentType
+	rec.Mappings = req.Mappings
+	switch {
+	case len(rec.Mappings) == 0 && rec.ContentType == ReceiverEmail:
+		rec.Mappings = maps.Clone(defaultEmailMappings)
+	case rec.Mappings == nil:
+		rec.Mappings = map[string]string{}
+	}
+	if req.Secret != nil {
+		rec.Secret = *req.Secret
+	}
+	if req.Enabled != nil {
+		rec.Enabled = *req.Enabled
+	}
+}
+
+// mapPayload returns the state variables mappings select from doc. A mapping
+// that matches nothing fails the delivery.
+func mapPayload(mappings map[string]string, doc any) (map[string]any, error) {
+	variables := make(map[string]any, len(mappings))
+	for _, v := range slices.Sorted(maps.Keys(mappings)) {
+		value, err := jsonpath.Get(doc, mappings[v])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", v, mappings[v], err)
+		}
+		variables[v] = value
+	}
+	return variables, nil
+}
+
+func decodeReceiverRequest(w http.ResponseWriter, r *http.Request) (*ReceiverRequest, bool) {
+	var req ReceiverRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return nil, false
+	}
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_receiver", err.Error())
+		return nil, false
+	}
+	return &req, true
+}
+
+func (s *Service) HandleListReceivers(w http.ResponseWriter, r *http.Request) {
+	workflowID := mux.Vars(r)["id"]
+
+	receivers, err := s.repo.ListReceivers(r.Context(), workflowID)
+	if err != nil {
+		writeStoreError(w, err, "list receivers")
+		return
+	}
+	respond(w, http.StatusOK, receivers)
+}
+
+func (s *Service) HandleCreateReceiver(w http.ResponseWriter, r *http.Request) {
+	workflowID := mux.Vars(r)["id"]
+	req, ok := decodeReceiverRequest(w, r)
+	if !ok {
+		return
+	}
+
+	rec := &Receiver{WorkflowID: workflowID, Enabled: true}
+	req.apply(rec)
+	if err := s.repo.CreateReceiver(r.Context(), rec); err != nil {
+		writeStoreError(w, err, "create receiver")
+		return
+	}
+	respond(w, http.StatusCreated, rec)
+}
+
+// loadReceiver returns the receiver of the workflow, writing a 404 if it
+// belongs to another one.
+func (s *Service) loadReceiver(w http.ResponseWriter, r *http.Request, workflowID, receiverID string) (*Receiver, bool) {
+	rec, err := s.repo.GetReceiver(r.Context(), receiverID)
+	if err == nil && rec.WorkflowID != workflowID {
+		err = notFound("receiver " + receiverID)
+	}
+	if err != nil {
+		writeStoreError(w, err, "load receiver")
+		return nil, false
+	}
+	return rec, true
+}
+
+func (s *Service) HandleGetReceiver(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workflowID, receiverID := vars["id"], vars["receiverId"]
+
+	if rec, ok := s.loadReceiver(w, r, workflowID, receiverID); ok {
+		respond(w, http.StatusOK, rec)
+	}
+}
+
+func (s *Service) HandleUpdateReceiver(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workflowID, receiverID := vars["id"], vars["receiverId"]
+	req, ok := decodeReceiverRequest(w, r)
+	if !ok {
+		return
+	}
+
+	rec, ok := s.loadReceiver(w, r, workflowID, receiverID)
+	if !ok {
+		return
+	}
+	req.apply(rec)
+	if err := s.repo.UpdateReceiver(r.Context(), rec); err != nil {
+		writeStoreError(w, err, "update receiver")
+		return
+	}
+	respond(w, http.StatusOK, rec)
+}
+
+func (s *Service) HandleDeleteReceiver(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workflowID, receiverID := vars["id"], vars["receiverId"]
+
+	if err := s.repo.DeleteReceiver(r.Context(), workflowID, receiverID); err != nil {
+		writeStoreError(w, err, "delete receiver")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxDeliverySize limits the size of webhook payloads.
+const maxDeliverySize = 1 << 20
+
+// HandleDeliver runs the receiver's workflow with a webhook payload. Receivers
+// with a secret only accept payloads signed like the callbacks hooks send:
+// the hex HMAC-SHA256 of the body in X-Workflow-Signature, optionally
+// prefixed "sha256=". Email providers can't sign, so email receivers also
+// accept the secret as the "token" query parameter of the URL they are given.
+func (s *Service) HandleDeliver(w http.ResponseWriter, r *http.Request) {
+	receiverID := mux.Vars(r)["id"]
+	rec, err := s.repo.GetReceiver(r.Context(), receiverID)
+	if err != nil {
+		writeStoreError(w, err, "load receiver")
+		return
+	}
+	if !rec.Enabled {
+		writeError(w, http.StatusConflict, "receiver_disabled", "the receiver is disabled")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDeliverySize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "too_large",
+			fmt.Sprintf("payloads are limited to %d bytes", maxDeliverySize))
+		return
+	}
+	if !rec.authorized(r, body) {
+		writeError(w, http.StatusUnauthorized, "invalid_signature", "the payload signature does not match")
+		return
+	}
+
+	kind := rec.ContentType
+	if kind == "" || kind == ReceiverEmail {
+		if kind, err = payload.Kind(r.Header.Get("Content-Type")); err != nil {
+			writeError(w, http.StatusUnsupportedMediaType, "unsupported_media_type",
+				fmt.Sprintf("%v, expected JSON, form-encoded or XML", err))
+			return
+		}
+	}
+	doc, err := payload.Decode(kind, r.Header.Get("Content-Type"), body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_payload", err.Error())
+		return
+	}
+	triggeredBy := TriggerWebhook
+	if rec.ContentType == ReceiverEmail {
+		msg, err := inboundmail.Parse(doc)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_payload", err.Error())
+			return
+		}
+		doc, triggeredBy = msg.Document(), TriggerEmail
+	}
+	variables, err := mapPayload(rec.Mappings, doc)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "unmapped_payload", err.Error())
+		return
+	}
+
+	// Payloads that are objects also serve as form data, so that form nodes
+	// can read form-encoded deliveries.
+	req := &ExecuteRequest{TriggeredBy: triggeredBy}
+	req.FormData, _ = doc.(map[string]any)
+	s.executeWorkflow(w, r, rec.WorkflowID, req, variables)
+}
+
+// authorized reports whether a delivery to the receiver is signed with its
+// secret, if it has one.
+func (rec *Receiver) authorized(r *http.Request, body []byte) bool {
+	if rec.Secret == "" {
+		return true
+	}
+	if token := r.URL.Query().Get("token"); token != "" && rec.ContentType == ReceiverEmail {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(rec.Secret)) == 1
+	}
+	got := "sha256=" + strings.TrimPrefix(r.Header.Get(callback.SignatureHeader), "sha256=")
+	return hmac.Equal([]byte(got), []byte(callback.Sign(rec.Secret, body)))
+}
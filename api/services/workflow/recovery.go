@@ -0,0 +1,104 @@
+package workflow
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"strconv"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/vcr"
+)
+
+// Labels attached to runs. Handlers read the workflow id from them, and a
+// durable engine hands them back after a restart.
+const (
+	labelWorkflowID      = engine.LabelWorkflowID
+	labelExecutionID     = engine.LabelExecutionID
+	labelWorkflowVersion = "workflowVersion"
+	labelTriggeredBy     = "triggeredBy"
+	labelEnvironment     = "environment"
+	labelTraceLevel      = "traceLevel"
+)
+
+// labels returns the labels identifying run to the engine.
+func (run executionRun) labels() map[string]string {
+	labels := map[string]string{
+		labelWorkflowID:      run.WorkflowID,
+		labelExecutionID:     run.ID,
+		labelWorkflowVersion: strconv.Itoa(run.WorkflowVersion),
+		labelTriggeredBy:     run.TriggeredBy,
+		labelEnvironment:     run.Environment,
+		labelTraceLevel:      run.TraceLevel,
+	}
+	for nodeType, variant := range run.Bindings {
+		labels[engine.BindingLabel(nodeType)] = variant
+	}
+	for nodeType, major := range run.Pins {
+		labels[engine.PinLabel(nodeType)] = strconv.Itoa(major)
+	}
+	maps.Copy(labels, engine.BudgetLabels(run.Budget.engineBudget()))
+	return labels
+}
+
+// withClock attaches the service's clock and id generator to ctx for the
+// engine.
+func (s *Service) withClock(ctx context.Context) context.Context {
+	return engine.WithIDGenerator(engine.WithClock(ctx, s.clock), s.ids)
+}
+
+// runContext prepares ctx for running run: it attaches the run's labels, the
+// cassette its outbound responses are recorded to and the service's clock.
+func (s *Service) runContext(ctx context.Context, run executionRun) context.Context {
+	return engine.WithLabels(vcr.WithCassette(s.withClock(ctx), run.ID), run.labels())
+}
+
+func runFromLabels(executionID string, labels map[string]string, input map[string]any) executionRun {
+	version, _ := strconv.Atoi(labels[labelWorkflowVersion])
+	return executionRun{
+		ID:              executionID,
+		WorkflowID:      labels[labelWorkflowID],
+		WorkflowVersion: version,
+		TriggeredBy:     labels[labelTriggeredBy],
+		Environment:     labels[labelEnvironment],
+		TraceLevel:      labels[labelTraceLevel],
+		Input:           input,
+		Bindings:        engine.BindingsFromLabels(labels),
+		Pins:            engine.PinsFromLabels(labels),
+		Queued:          true,
+	}
+}
+
+// ResumeExecutions continues the async runs that were in progress when the
+// process last stopped, if the engine supports it, and records them once they
+// finish. It returns the number of resumed runs.
+func (s *Service) ResumeExecutions(ctx context.Context) (int, error) {
+	recoverer, ok := s.executor.(engine.Recoverer)
+	if !ok {
+		return 0, nil
+	}
+
+	runs, err := recoverer.Recover(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range runs {
+		go s.awaitRun(context.WithoutCancel(ctx), runFromLabels(r.ExecutionID, r.Labels, r.Input), r.Results)
+	}
+	return len(runs), nil
+}
+
+// awaitRun waits for an async run and records its outcome.
+func (s *Service) awaitRun(ctx context.Context, run executionRun, results <-chan engine.AsyncResult) {
+	res, ok := <-results
+	if !ok {
+		return
+	}
+	if res.Execution == nil {
+		s.failExecution(ctx, run, res.Err)
+		return
+	}
+	if _, err := s.recordExecution(ctx, run, res.Execution, res.Err); err != nil {
+		slog.Error("Failed to save async execution", "id", run.WorkflowID, "executionId", run.ID, "error", err)
+	}
+}
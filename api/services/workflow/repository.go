@@ -0,0 +1,1757 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/fieldcrypt"
+)
+
+// Repository persists workflow definitions and their executions. Errors are
+// classified with db.Classify so callers can match db.ErrNotFound,
+// db.ErrConflict and db.ErrConstraint.
+type Repository interface {
+	GetWorkflow(ctx context.Context, id string) (*Workflow, error)
+	GetWorkflows(ctx context.Context, ids []string) ([]*Workflow, error)
+	CreateWorkflow(ctx context.Context, wf *Workflow) error
+	// UpdateWorkflow replaces the definition of a workflow, its nodes and
+	// edges included, all at once and bumps its version. With a non-zero
+	// expectedVersion it fails with db.ErrConflict unless that is the stored
+	// version.
+	UpdateWorkflow(ctx context.Context, wf *Workflow, expectedVersion int) error
+	// DeleteWorkflow hides a workflow from every read, or with opts.Hard
+	// removes it along with its graph, hooks, receivers and presets. A hard
+	// delete fails with db.ErrConflict while the workflow has executions,
+	// unless opts.Executions removes them too.
+	DeleteWorkflow(ctx context.Context, id string, opts WorkflowDeletion) error
+	ReorderGraph(ctx context.Context, workflowID string, nodeIDs, edgeIDs []string) error
+	// LayoutStore stores the layout of a workflow with its nodes and edges;
+	// saving it doesn't bump the version.
+	LayoutStore
+	ListWorkflowIDs(ctx context.Context, includeArchived bool) ([]string, error)
+	// ListRecentlyExecutedWorkflowIDs returns the ids of the up to limit
+	// workflows, not archived, executed most recently, most recent first.
+	ListRecentlyExecutedWorkflowIDs(ctx context.Context, limit int) ([]string, error)
+	// ListWorkflows returns a page of workflow summaries and the number of
+	// workflows matching the filter.
+	ListWorkflows(ctx context.Context, filter WorkflowFilter) ([]WorkflowSummary, int, error)
+	ApplySyncPlan(ctx context.Context, plan *SyncPlan) error
+	CreateExecution(ctx context.Context, exec *ExecutionRecord) error
+	GetExecution(ctx context.Context, id string) (*ExecutionRecord, error)
+	UpdateExecution(ctx context.Context, exec *ExecutionRecord) error
+	// MarkExecutionRunning moves a queued execution to running once a worker
+	// starts it. It fails with db.ErrConflict unless the execution is queued.
+	MarkExecutionRunning(ctx context.Context, id string, startedAt time.Time) error
+	// MarkExecutionResumed moves a paused execution to running before it is
+	// resumed. It fails with db.ErrConflict unless the execution is paused,
+	// so only one of several concurrent resumes goes ahead.
+	MarkExecutionResumed(ctx context.Context, id string) error
+	// ClaimDueTimers returns the ids of up to limit executions paused on a
+	// timer due at now and moves their timers lease later, so that only one
+	// caller resumes each of them.
+	ClaimDueTimers(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]string, error)
+	ListExecutions(ctx context.Context, workflowID string, limit int) ([]ExecutionSummary, error)
+	// ListExecutionSteps returns a page of an execution's steps in trace
+	// order and the number of steps matching the filter.
+	ListExecutionSteps(ctx context.Context, executionID string, filter StepFilter) ([]IndexedStep, int, error)
+	// ListExecutionNotes returns the notes of an execution, oldest first.
+	// AddExecutionNote stores a note and, when it has a resolution, sets the
+	// execution's resolution from it.
+	ListExecutionNotes(ctx context.Context, executionID string) ([]ExecutionNote, error)
+	AddExecutionNote(ctx context.Context, note *ExecutionNote) error
+	// EraseSubject redacts a person's data from the input, final context,
+	// trace and checkpoint of every execution, from the form data and
+	// condition of every input preset and from the form data, condition and
+	// expectations of every contract test.
+	EraseSubject(ctx context.Context, subject *Subject) (*EraseReport, error)
+
+	ListHooks(ctx context.Context, workflowID string) ([]*Hook, error)
+	GetHook(ctx context.Context, workflowID, hookID string) (*Hook, error)
+	CreateHook(ctx context.Context, hook *Hook) error
+	UpdateHook(ctx context.Context, hook *Hook) error
+	DeleteHook(ctx context.Context, workflowID, hookID string) error
+
+	ListReceivers(ctx context.Context, workflowID string) ([]*Receiver, error)
+	// GetReceiver looks a receiver up by id alone, as webhook deliveries
+	// only know that.
+	GetReceiver(ctx context.Context, receiverID string) (*Receiver, error)
+	CreateReceiver(ctx context.Context, rec *Receiver) error
+	UpdateReceiver(ctx context.Context, rec *Receiver) error
+	DeleteReceiver(ctx context.Context, workflowID, receiverID string) error
+
+	ListProjects(ctx context.Context) ([]*Project, error)
+	GetProject(ctx context.Context, id string) (*Project, error)
+	CreateProject(ctx context.Context, project *Project) error
+	UpdateProject(ctx context.Context, project *Project) error
+	// DeleteProject fails with db.ErrConflict while workflows belong to the
+	// project.
+	DeleteProject(ctx context.Context, id string) error
+	// TransferWorkflows moves workflows into a project in one transaction and
+	// records a transfer for each that wasn't in it already. It fails with
+	// db.ErrNotFound, moving nothing, if the project or a workflow doesn't
+	// exist.
+	TransferWorkflows(ctx context.Context, projectID string, workflowIDs []string, author, reason string) ([]WorkflowTransfer, error)
+	// ListTransfers returns the transfers into and out of a project, newest
+	// first.
+	ListTransfers(ctx context.Context, projectID string) ([]WorkflowTransfer, error)
+
+	ListInputPresets(ctx context.Context, workflowID string) ([]*InputPreset, error)
+	GetInputPreset(ctx context.Context, workflowID, presetID string) (*InputPreset, error)
+	CreateInputPreset(ctx context.Context, preset *InputPreset) error
+	UpdateInputPreset(ctx context.Context, preset *InputPreset) error
+	DeleteInputPreset(ctx context.Context, workflowID, presetID string) error
+
+	ListContractTests(ctx context.Context, workflowID string) ([]*ContractTest, error)
+	GetContractTest(ctx context.Context, workflowID, testID string) (*ContractTest, error)
+	CreateContractTest(ctx context.Context, test *ContractTest) error
+	UpdateContractTest(ctx context.Context, test *ContractTest) error
+	DeleteContractTest(ctx context.Context, workflowID, testID string) error
+
+	// GetHandlerBindings returns the handler variant bound to each node type
+	// of a workflow; SetHandlerBindings replaces them.
+	GetHandlerBindings(ctx context.Context, workflowID string) (map[string]string, error)
+	SetHandlerBindings(ctx context.Context, workflowID string, bindings map[string]string) error
+
+	GetExecutionStats(ctx context.Context, workflowID string, since time.Time) (*ExecutionStats, error)
+	// GetStepCoverage counts the nodes and transitions exercised by the
+	// executions of a workflow started at or after since.
+	GetStepCoverage(ctx context.Context, workflowID string, since time.Time) (*StepCoverage, error)
+	// CountExecutionsBySource counts the executions started at or after
+	// since, of one workflow or of all when workflowID is empty, by trigger
+	// source and bucket of the given width starting at since.
+	CountExecutionsBySource(ctx context.Context, workflowID string, since time.Time, bucket time.Duration) ([]SourceCount, error)
+	GetStepBaselines(ctx context.Context, workflowID string) (map[string]*StepBaseline, error)
+	RecordStepDurations(ctx context.Context, workflowID string, durations map[string]int64) error
+}
+
+// ExecutionRecord is a finished execution as stored in the executions table.
+type ExecutionRecord struct {
+	ID           string
+	WorkflowID   string
+	Status       string
+	ExecutedAt   time.Time
+	Input        map[string]any
+	FinalContext map[string]any
+	Steps        []ExecutionStep
+
+	TriggeredBy     string
+	WorkflowVersion int
+	FailedNodeType  string
+	Environment     string
+	TraceLevel      string
+	Resolution      *Resolution
+
+	StartedAt  time.Time
+	FinishedAt time.Time
+	DurationMs int64
+
+	// Checkpoint and PendingInput are set while the execution is paused.
+	Checkpoint   *engine.Checkpoint
+	PendingInput *PendingInput
+}
+
+type PostgresRepository struct {
+	pool *pgxpool.Pool
+	// keys encrypts execution state and traces; nil stores them in plaintext.
+	keys *fieldcrypt.Keyring
+}
+
+func NewPostgresRepository(pool *pgxpool.Pool) *PostgresRepository {
+	return &PostgresRepository{pool: pool}
+}
+
+func (r *PostgresRepository) GetWorkflow(ctx context.Context, id string) (*Workflow, error) {
+	wf := Workflow{ID: id}
+	err := r.pool.QueryRow(ctx,
+		`SELECT name, version, archived_at, COALESCE(project_id::text, ''), defaults, COALESCE(environment, ''),
+			COALESCE(trace_level, ''), handler_versions, budget
+		FROM workflows WHERE id = $1 AND deleted_at IS NULL`, id,
+	).Scan(&wf.Name, &wf.Version, &wf.ArchivedAt, &wf.ProjectID, &wf.Defaults, &wf.Environment, &wf.TraceLevel,
+		&wf.HandlerVersions, &wf.Budget)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	if wf.Nodes, err = r.GetNodesByWorkflowID(ctx, id); err != nil {
+		return nil, err
+	}
+	if wf.Edges, err = r.GetEdgesByWorkflowID(ctx, id); err != nil {
+		return nil, err
+	}
+	return &wf, nil
+}
+
+func (r *PostgresRepository) GetNodesByWorkflowID(ctx context.Context, workflowID string) ([]Node, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT node_id, type, label, description, x_pos, y_pos, metadata, COALESCE(parent_id, ''), style
+		FROM nodes
+		WHERE workflow_id = $1
+		ORDER BY sort_index, node_id`, workflowID)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	nodes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Node, error) {
+		var n Node
+		err := row.Scan(&n.ID, &n.Type, &n.Data.Label, &n.Data.Description,
+			&n.Position.X, &n.Position.Y, &n.Data.Metadata, &n.ParentID, &n.Style)
+		return n, err
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return nodes, nil
+}
+
+func (r *PostgresRepository) GetEdgesByWorkflowID(ctx context.Context, workflowID string) ([]Edge, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT edge_id, source, target, COALESCE(source_handle, ''), edge_props
+		FROM edges
+		WHERE workflow_id = $1
+		ORDER BY sort_index, edge_id`, workflowID)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	edges, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Edge, error) {
+		var (
+			e     Edge
+			props []byte
+		)
+		if err := row.Scan(&e.ID, &e.Source, &e.Target, &e.SourceHandle, &props); err != nil {
+			return e, err
+		}
+		var err error
+		e.Props, err = edgePropsFromJSON(e.ID, props)
+		return e, err
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return edges, nil
+}
+
+func (r *PostgresRepository) CreateExecution(ctx context.Context, exec *ExecutionRecord) error {
+	finalContext, trace, err := r.sealExecution(exec)
+	if err != nil {
+		return err
+	}
+
+	return db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO executions (id, workflow_id, status, executed_at, input, final_context, execution_trace,
+				triggered_by, workflow_version, failed_node_type, started_at, finished_at, duration_ms,
+				checkpoint, pending_input, environment, trace_level)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12, $13, $14, $15, NULLIF($16, ''),
+				NULLIF($17, ''))`,
+			exec.ID, exec.WorkflowID, exec.Status, exec.ExecutedAt, exec.Input, finalContext, trace,
+			exec.TriggeredBy, exec.WorkflowVersion, exec.FailedNodeType,
+			exec.StartedAt, exec.FinishedAt, exec.DurationMs,
+			exec.Checkpoint, exec.PendingInput, exec.Environment, exec.TraceLevel,
+		)
+		if err != nil {
+			return err
+		}
+		return r.insertSteps(ctx, tx, exec)
+	})
+}
+
+func (r *PostgresRepository) ClaimDueTimers(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]string, error) {
+	rows, err := r.pool.Query(ctx, `
+		UPDATE executions
+		SET pending_input = jsonb_set(pending_input, '{details,resumeAt}', to_jsonb($2::timestamptz))
+		WHERE id IN (
+			SELECT id FROM executions
+			WHERE status = 'paused' AND pending_input->>'kind' = 'timer'
+				AND (pending_input->'details'->>'resumeAt')::timestamptz <= $1
+			ORDER BY (pending_input->'details'->>'resumeAt')::timestamptz
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id`, now, now.Add(lease).UTC(), limit)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return ids, nil
+}
+
+// UpdateExecution stores the outcome of a resumed or async execution. Only
+// unfinished (paused, queued or running) executions can be updated, so two
+// concurrent resumes cannot both succeed.
+func (r *PostgresRepository) UpdateExecution(ctx context.Context, exec *ExecutionRecord) error {
+	finalContext, trace, err := r.sealExecution(exec)
+	if err != nil {
+		return err
+	}
+
+	return db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			UPDATE executions
+			SET status = $2, final_context = $3, execution_trace = $4, failed_node_type = NULLIF($5, ''),
+				finished_at = $6, duration_ms = $7, checkpoint = $8, pending_input = $9
+			WHERE id = $1 AND status IN ('paused', 'queued', 'running')`,
+			exec.ID, exec.Status, finalContext, trace, exec.FailedNodeType,
+			exec.FinishedAt, exec.DurationMs, exec.Checkpoint, exec.PendingInput,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("%w: execution %s has finished", db.ErrConflict, exec.ID)
+		}
+
+		// The resumed trace starts with the steps stored when pausing.
+		if _, err := tx.Exec(ctx, `DELETE FROM execution_steps WHERE execution_id = $1`, exec.ID); err != nil {
+			return err
+		}
+		return r.insertSteps(ctx, tx, exec)
+	})
+}
+
+func (r *PostgresRepository) MarkExecutionRunning(ctx context.Context, id string, startedAt time.Time) error {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE executions SET status = 'running', started_at = $2 WHERE id = $1 AND status = 'queued'`, id, startedAt)
+	if err != nil {
+		return db.Classify(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: execution %s is not queued", db.ErrConflict, id)
+	}
+	return nil
+}
+
+func (r *PostgresRepository) MarkExecutionResumed(ctx context.Context, id string) error {
+	tag, err := r.pool.Exec(ctx, `UPDATE executions SET status = 'running' WHERE id = $1 AND status = 'paused'`, id)
+	if err != nil {
+		return db.Classify(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: execution %s is not paused", db.ErrConflict, id)
+	}
+	return nil
+}
+
+// sealExecution encodes the final context and trace of exec for storage.
+func (r *PostgresRepository) sealExecution(exec *ExecutionRecord) (finalContext, trace []byte, err error) {
+	if finalContext, err = r.sealJSON(exec.FinalContext, aadFinalContext+exec.ID); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode final context: %w", err)
+	}
+	if trace, err = r.sealJSON(exec.Steps, aadTrace+exec.ID); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode execution trace: %w", err)
+	}
+	return finalContext, trace, nil
+}
+
+// insertSteps writes one execution_steps row per step of exec.
+func (r *PostgresRepository) insertSteps(ctx context.Context, tx pgx.Tx, exec *ExecutionRecord) error {
+	rows := make([][]any, len(exec.Steps))
+	for i, step := range exec.Steps {
+		sealed, err := r.sealJSON(step, stepAAD(exec.ID, i))
+		if err != nil {
+			return fmt.Errorf("failed to encode execution step: %w", err)
+		}
+		rows[i] = []any{exec.ID, i, step.NodeID, step.Type, step.Status, sealed}
+	}
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{"execution_steps"},
+		[]string{"execution_id", "seq", "node_id", "node_type", "status", "step"},
+		pgx.CopyFromRows(rows))
+	return err
+}
+
+func (r *PostgresRepository) ListExecutionSteps(ctx context.Context, executionID string, filter StepFilter) ([]IndexedStep, int, error) {
+	var (
+		exists bool
+		total  int
+	)
+	err := r.pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM executions WHERE id = $1),
+			(SELECT count(*) FROM execution_steps
+			 WHERE execution_id = $1 AND ($2::text = '' OR node_type = $2) AND ($3::text = '' OR status = $3))`,
+		executionID, filter.NodeType, filter.Status,
+	).Scan(&exists, &total)
+	if err != nil {
+		return nil, 0, db.Classify(err)
+	}
+	if !exists {
+		return nil, 0, db.Classify(pgx.ErrNoRows)
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT seq, step
+		FROM execution_steps
+		WHERE execution_id = $1 AND ($2::text = '' OR node_type = $2) AND ($3::text = '' OR status = $3)
+		ORDER BY seq
+		OFFSET $4 LIMIT $5`,
+		executionID, filter.NodeType, filter.Status, filter.Offset, filter.Limit)
+	if err != nil {
+		return nil, 0, db.Classify(err)
+	}
+	steps, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (IndexedStep, error) {
+		var (
+			s   IndexedStep
+			raw []byte
+		)
+		if err := row.Scan(&s.Index, &raw); err != nil {
+			return s, err
+		}
+		if err := r.openJSON(raw, stepAAD(executionID, s.Index), &s.ExecutionStep); err != nil {
+			return s, fmt.Errorf("failed to decode execution step: %w", err)
+		}
+		return s, nil
+	})
+	if err != nil {
+		return nil, 0, db.Classify(err)
+	}
+	return steps, total, nil
+}
+
+func (r *PostgresRepository) EraseSubject(ctx context.Context, subject *Subject) (*EraseReport, error) {
+	rows, err := r.pool.Query(ctx, "SELECT id FROM executions ORDER BY executed_at")
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	// The columns may be encrypted, so every execution is decoded and
+	// checked here rather than searched in SQL.
+	report := &EraseReport{ExecutionIDs: []string{}}
+	for _, id := range ids {
+		err := db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+			rec := ExecutionRecord{ID: id}
+			var finalContext, trace []byte
+			err := tx.QueryRow(ctx, `
+				SELECT input, final_context, execution_trace, checkpoint
+				FROM executions WHERE id = $1 FOR UPDATE`, id,
+			).Scan(&rec.Input, &finalContext, &trace, &rec.Checkpoint)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := r.openJSON(finalContext, aadFinalContext+id, &rec.FinalContext); err != nil {
+				return err
+			}
+			if err := r.openJSON(trace, aadTrace+id, &rec.Steps); err != nil {
+				return err
+			}
+
+			changed, err := subject.erase(&rec, report)
+			if err != nil || !changed {
+				return err
+			}
+			if finalContext, trace, err = r.sealExecution(&rec); err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, `
+				UPDATE executions SET input = $2, final_context = $3, execution_trace = $4, checkpoint = $5
+				WHERE id = $1`, id, rec.Input, finalContext, trace, rec.Checkpoint)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, "DELETE FROM execution_steps WHERE execution_id = $1", id); err != nil {
+				return err
+			}
+			return r.insertSteps(ctx, tx, &rec)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("execution %s: %w", id, db.Classify(err))
+		}
+	}
+
+	err = db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, "SELECT "+presetColumns+" FROM input_presets ORDER BY id FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		presets, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*InputPreset, error) {
+			return scanInputPreset(row)
+		})
+		if err != nil {
+			return err
+		}
+		for _, p := range presets {
+			changed, err := subject.erasePreset(p, report)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+			_, err = tx.Exec(ctx, `
+				UPDATE input_presets SET form_data = $2, condition = $3, updated_at = now()
+				WHERE id = $1`, p.ID, p.FormData, p.Condition)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("input presets: %w", db.Classify(err))
+	}
+
+	err = db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, "SELECT "+contractTestColumns+" FROM contract_tests ORDER BY id FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		tests, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*ContractTest, error) {
+			return scanContractTest(row)
+		})
+		if err != nil {
+			return err
+		}
+		for _, t := range tests {
+			changed, err := subject.eraseContractTest(t, report)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+			_, err = tx.Exec(ctx, `
+				UPDATE contract_tests SET form_data = $2, condition = $3, expect = $4, updated_at = now()
+				WHERE id = $1`, t.ID, t.FormData, t.Condition, t.Expect)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("contract tests: %w", db.Classify(err))
+	}
+	return report, nil
+}
+
+const hookColumns = "id, workflow_id, url, secret, events, enabled, created_at, updated_at"
+
+func scanHook(row pgx.Row) (*Hook, error) {
+	var h Hook
+	err := row.Scan(&h.ID, &h.WorkflowID, &h.URL, &h.Secret, &h.Events, &h.Enabled, &h.CreatedAt, &h.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	h.HasSecret = h.Secret != ""
+	return &h, nil
+}
+
+func (r *PostgresRepository) ListHooks(ctx context.Context, workflowID string) ([]*Hook, error) {
+	rows, err := r.pool.Query(ctx,
+		"SELECT "+hookColumns+" FROM workflow_hooks WHERE workflow_id = $1 ORDER BY created_at", workflowID)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	hooks, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Hook, error) {
+		return scanHook(row)
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return hooks, nil
+}
+
+func (r *PostgresRepository) GetHook(ctx context.Context, workflowID, hookID string) (*Hook, error) {
+	hook, err := scanHook(r.pool.QueryRow(ctx,
+		"SELECT "+hookColumns+" FROM workflow_hooks WHERE workflow_id = $1 AND id = $2", workflowID, hookID))
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return hook, nil
+}
+
+func (r *PostgresRepository) CreateHook(ctx context.Context, hook *Hook) error {
+	created, err := scanHook(r.pool.QueryRow(ctx, `
+		INSERT INTO workflow_hooks (workflow_id, url, secret, events, enabled)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+hookColumns,
+		hook.WorkflowID, hook.URL, hook.Secret, hook.Events, hook.Enabled))
+	if err != nil {
+		return db.Classify(err)
+	}
+	*hook = *created
+	return nil
+}
+
+func (r *PostgresRepository) UpdateHook(ctx context.Context, hook *Hook) error {
+	updated, err := scanHook(r.pool.QueryRow(ctx, `
+		UPDATE workflow_hooks
+		SET url = $3, secret = $4, events = $5, enabled = $6, updated_at = now()
+		WHERE workflow_id = $1 AND id = $2
+		RETURNING `+hookColumns,
+		hook.WorkflowID, hook.ID, hook.URL, hook.Secret, hook.Events, hook.Enabled))
+	if err != nil {
+		return db.Classify(err)
+	}
+	*hook = *updated
+	return nil
+}
+
+const receiverColumns = "id, workflow_id, content_type, mappings, secret, enabled, created_at, updated_at"
+
+func scanReceiver(row pgx.Row) (*Receiver, error) {
+	var rec Receiver
+	err := row.Scan(&rec.ID, &rec.WorkflowID, &rec.ContentType, &rec.Mappings, &rec.Secret, &rec.Enabled,
+		&rec.CreatedAt, &rec.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	rec.HasSecret = rec.Secret != ""
+	return &rec, nil
+}
+
+func (r *PostgresRepository) ListReceivers(ctx context.Context, workflowID string) ([]*Receiver, error) {
+	rows, err := r.pool.Query(ctx,
+		"SELECT "+receiverColumns+" FROM webhook_receivers WHERE workflow_id = $1 ORDER BY created_at", workflowID)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	receivers, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Receiver, error) {
+		return scanReceiver(row)
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return receivers, nil
+}
+
+func (r *PostgresRepository) GetReceiver(ctx context.Context, receiverID string) (*Receiver, error) {
+	rec, err := scanReceiver(r.pool.QueryRow(ctx,
+		"SELECT "+receiverColumns+" FROM webhook_receivers WHERE id = $1", receiverID))
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return rec, nil
+}
+
+func (r *PostgresRepository) CreateReceiver(ctx context.Context, rec *Receiver) error {
+	created, err := scanReceiver(r.pool.QueryRow(ctx, `
+		INSERT INTO webhook_receivers (workflow_id, content_type, mappings, secret, enabled)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+receiverColumns,
+		rec.WorkflowID, rec.ContentType, rec.Mappings, rec.Secret, rec.Enabled))
+	if err != nil {
+		return db.Classify(err)
+	}
+	*rec = *created
+	return nil
+}
+
+func (r *PostgresRepository) UpdateReceiver(ctx context.Context, rec *Receiver) error {
+	updated, err := scanReceiver(r.pool.QueryRow(ctx, `
+		UPDATE webhook_receivers
+		SET content_type = $3, mappings = $4, secret = $5, enabled = $6, updated_at = now()
+		WHERE workflow_id = $1 AND id = $2
+		RETURNING `+receiverColumns,
+		rec.WorkflowID, rec.ID, rec.ContentType, rec.Mappings, rec.Secret, rec.Enabled))
+	if err != nil {
+		return db.Classify(err)
+	}
+	*rec = *updated
+	return nil
+}
+
+func (r *PostgresRepository) DeleteReceiver(ctx context.Context, workflowID, receiverID string) error {
+	tag, err := r.pool.Exec(ctx,
+		"DELETE FROM webhook_receivers WHERE workflow_id = $1 AND id = $2", workflowID, receiverID)
+	if err != nil {
+		return db.Classify(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return db.Classify(pgx.ErrNoRows)
+	}
+	return nil
+}
+
+const projectColumns = "id, name, team, created_at, updated_at"
+
+func scanProject(row pgx.Row) (*Project, error) {
+	var p Project
+	if err := row.Scan(&p.ID, &p.Name, &p.Team, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *PostgresRepository) ListProjects(ctx context.Context) ([]*Project, error) {
+	rows, err := r.pool.Query(ctx, "SELECT "+projectColumns+" FROM projects ORDER BY name")
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	projects, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Project, error) {
+		return scanProject(row)
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return projects, nil
+}
+
+func (r *PostgresRepository) GetProject(ctx context.Context, id string) (*Project, error) {
+	project, err := scanProject(r.pool.QueryRow(ctx, "SELECT "+projectColumns+" FROM projects WHERE id = $1", id))
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return project, nil
+}
+
+func (r *PostgresRepository) CreateProject(ctx context.Context, project *Project) error {
+	created, err := scanProject(r.pool.QueryRow(ctx,
+		"INSERT INTO projects (name, team) VALUES ($1, $2) RETURNING "+projectColumns, project.Name, project.Team))
+	if err != nil {
+		return db.Classify(err)
+	}
+	*project = *created
+	return nil
+}
+
+func (r *PostgresRepository) UpdateProject(ctx context.Context, project *Project) error {
+	updated, err := scanProject(r.pool.QueryRow(ctx, `
+		UPDATE projects SET name = $2, team = $3, updated_at = now()
+		WHERE id = $1
+		RETURNING `+projectColumns, project.ID, project.Name, project.Team))
+	if err != nil {
+		return db.Classify(err)
+	}
+	*project = *updated
+	return nil
+}
+
+func (r *PostgresRepository) DeleteProject(ctx context.Context, id string) error {
+	return db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT true FROM projects WHERE id = $1 FOR UPDATE", id).Scan(&exists); err != nil {
+			return err
+		}
+		var workflows int
+		err := tx.QueryRow(ctx,
+			"SELECT count(*) FROM workflows WHERE project_id = $1 AND deleted_at IS NULL", id).Scan(&workflows)
+		if err != nil {
+			return err
+		}
+		if workflows > 0 {
+			return fmt.Errorf("%w: project %s still has %d workflows, transfer them first", db.ErrConflict, id, workflows)
+		}
+		// Soft-deleted workflows leave the project with it.
+		if _, err := tx.Exec(ctx, "UPDATE workflows SET project_id = NULL WHERE project_id = $1", id); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM projects WHERE id = $1", id)
+		return err
+	})
+}
+
+const transferColumns = "id, workflow_id, COALESCE(from_project_id::text, ''), to_project_id, author, reason, transferred_at"
+
+func scanTransfer(row pgx.Row) (WorkflowTransfer, error) {
+	var t WorkflowTransfer
+	err := row.Scan(&t.ID, &t.WorkflowID, &t.FromProjectID, &t.ToProjectID, &t.Author, &t.Reason, &t.TransferredAt)
+	return t, err
+}
+
+func (r *PostgresRepository) TransferWorkflows(ctx context.Context, projectID string, workflowIDs []string, author, reason string) ([]WorkflowTransfer, error) {
+	var transfers []WorkflowTransfer
+	err := db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		transfers = []WorkflowTransfer{}
+		// Keeps the project from being deleted until the transfer commits.
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT true FROM projects WHERE id = $1 FOR SHARE", projectID).Scan(&exists); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, `
+			SELECT id, COALESCE(project_id::text, '') FROM workflows
+			WHERE id = ANY($1) AND deleted_at IS NULL
+			ORDER BY id
+			FOR UPDATE`, workflowIDs)
+		if err != nil {
+			return err
+		}
+		from := make(map[string]string, len(workflowIDs))
+		var id, project string
+		_, err = pgx.ForEachRow(rows, []any{&id, &project}, func() error {
+			from[id] = project
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range workflowIDs {
+			project, ok := from[id]
+			if !ok {
+				return fmt.Errorf("%w: workflow %s", db.ErrNotFound, id)
+			}
+			if project == projectID {
+				continue
+			}
+			_, err := tx.Exec(ctx, "UPDATE workflows SET project_id = $2, updated_at = now() WHERE id = $1", id, projectID)
+			if err != nil {
+				return err
+			}
+			t, err := scanTransfer(tx.QueryRow(ctx, `
+				INSERT INTO workflow_transfers (workflow_id, from_project_id, to_project_id, author, reason)
+				VALUES ($1, NULLIF($2, '')::uuid, $3, $4, $5)
+				RETURNING `+transferColumns, id, project, projectID, author, reason))
+			if err != nil {
+				return err
+			}
+			transfers = append(transfers, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+func (r *PostgresRepository) ListTransfers(ctx context.Context, projectID string) ([]WorkflowTransfer, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+transferColumns+` FROM workflow_transfers
+		WHERE from_project_id = $1 OR to_project_id = $1
+		ORDER BY transferred_at DESC, id`, projectID)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	transfers, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (WorkflowTransfer, error) {
+		return scanTransfer(row)
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return transfers, nil
+}
+
+const presetColumns = "id, workflow_id, name, form_data, condition, created_at, updated_at"
+
+func scanInputPreset(row pgx.Row) (*InputPreset, error) {
+	var p InputPreset
+	err := row.Scan(&p.ID, &p.WorkflowID, &p.Name, &p.FormData, &p.Condition, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *PostgresRepository) ListInputPresets(ctx context.Context, workflowID string) ([]*InputPreset, error) {
+	rows, err := r.pool.Query(ctx,
+		"SELECT "+presetColumns+" FROM input_presets WHERE workflow_id = $1 ORDER BY name", workflowID)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	presets, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*InputPreset, error) {
+		return scanInputPreset(row)
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return presets, nil
+}
+
+func (r *PostgresRepository) GetInputPreset(ctx context.Context, workflowID, presetID string) (*InputPreset, error) {
+	preset, err := scanInputPreset(r.pool.QueryRow(ctx,
+		"SELECT "+presetColumns+" FROM input_presets WHERE workflow_id = $1 AND id = $2", workflowID, presetID))
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return preset, nil
+}
+
+func (r *PostgresRepository) CreateInputPreset(ctx context.Context, preset *InputPreset) error {
+	created, err := scanInputPreset(r.pool.QueryRow(ctx, `
+		INSERT INTO input_presets (workflow_id, name, form_data, condition)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+presetColumns,
+		preset.WorkflowID, preset.Name, preset.FormData, preset.Condition))
+	if err != nil {
+		return db.Classify(err)
+	}
+	*preset = *created
+	return nil
+}
+
+func (r *PostgresRepository) UpdateInputPreset(ctx context.Context, preset *InputPreset) error {
+	updated, err := scanInputPreset(r.pool.QueryRow(ctx, `
+		UPDATE input_presets
+		SET name = $3, form_data = $4, condition = $5, updated_at = now()
+		WHERE workflow_id = $1 AND id = $2
+		RETURNING `+presetColumns,
+		preset.WorkflowID, preset.ID, preset.Name, preset.FormData, preset.Condition))
+	if err != nil {
+		return db.Classify(err)
+	}
+	*preset = *updated
+	return nil
+}
+
+func (r *PostgresRepository) DeleteInputPreset(ctx context.Context, workflowID, presetID string) error {
+	tag, err := r.pool.Exec(ctx,
+		"DELETE FROM input_presets WHERE workflow_id = $1 AND id = $2", workflowID, presetID)
+	if err != nil {
+		return db.Classify(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return db.Classify(pgx.ErrNoRows)
+	}
+	return nil
+}
+
+const contractTestColumns = "id, workflow_id, name, form_data, condition, temperature, expect, created_at, updated_at"
+
+func scanContractTest(row pgx.Row) (*ContractTest, error) {
+	var t ContractTest
+	err := row.Scan(&t.ID, &t.WorkflowID, &t.Name, &t.FormData, &t.Condition, &t.Temperature, &t.Expect,
+		&t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *PostgresRepository) ListContractTests(ctx context.Context, workflowID string) ([]*ContractTest, error) {
+	rows, err := r.pool.Query(ctx,
+		"SELECT "+contractTestColumns+" FROM contract_tests WHERE workflow_id = $1 ORDER BY name", workflowID)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	tests, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*ContractTest, error) {
+		return scanContractTest(row)
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return tests, nil
+}
+
+func (r *PostgresRepository) GetContractTest(ctx context.Context, workflowID, testID string) (*ContractTest, error) {
+	test, err := scanContractTest(r.pool.QueryRow(ctx,
+		"SELECT "+contractTestColumns+" FROM contract_tests WHERE workflow_id = $1 AND id = $2", workflowID, testID))
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return test, nil
+}
+
+func (r *PostgresRepository) CreateContractTest(ctx context.Context, test *ContractTest) error {
+	created, err := scanContractTest(r.pool.QueryRow(ctx, `
+		INSERT INTO contract_tests (workflow_id, name, form_data, condition, temperature, expect)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+contractTestColumns,
+		test.WorkflowID, test.Name, test.FormData, test.Condition, test.Temperature, test.Expect))
+	if err != nil {
+		return db.Classify(err)
+	}
+	*test = *created
+	return nil
+}
+
+func (r *PostgresRepository) UpdateContractTest(ctx context.Context, test *ContractTest) error {
+	updated, err := scanContractTest(r.pool.QueryRow(ctx, `
+		UPDATE contract_tests
+		SET name = $3, form_data = $4, condition = $5, temperature = $6, expect = $7, updated_at = now()
+		WHERE workflow_id = $1 AND id = $2
+		RETURNING `+contractTestColumns,
+		test.WorkflowID, test.ID, test.Name, test.FormData, test.Condition, test.Temperature, test.Expect))
+	if err != nil {
+		return db.Classify(err)
+	}
+	*test = *updated
+	return nil
+}
+
+func (r *PostgresRepository) DeleteContractTest(ctx context.Context, workflowID, testID string) error {
+	tag, err := r.pool.Exec(ctx,
+		"DELETE FROM contract_tests WHERE workflow_id = $1 AND id = $2", workflowID, testID)
+	if err != nil {
+		return db.Classify(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return db.Classify(pgx.ErrNoRows)
+	}
+	return nil
+}
+
+func (r *PostgresRepository) GetHandlerBindings(ctx context.Context, workflowID string) (map[string]string, error) {
+	rows, err := r.pool.Query(ctx,
+		"SELECT node_type, variant FROM workflow_handler_bindings WHERE workflow_id = $1", workflowID)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	bindings := make(map[string]string)
+	var nodeType, variant string
+	_, err = pgx.ForEachRow(rows, []any{&nodeType, &variant}, func() error {
+		bindings[nodeType] = variant
+		return nil
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return bindings, nil
+}
+
+func (r *PostgresRepository) SetHandlerBindings(ctx context.Context, workflowID string, bindings map[string]string) error {
+	return db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "DELETE FROM workflow_handler_bindings WHERE workflow_id = $1", workflowID); err != nil {
+			return err
+		}
+		for nodeType, variant := range bindings {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO workflow_handler_bindings (workflow_id, node_type, variant)
+				VALUES ($1, $2, $3)`, workflowID, nodeType, variant)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *PostgresRepository) DeleteHook(ctx context.Context, workflowID, hookID string) error {
+	tag, err := r.pool.Exec(ctx,
+		"DELETE FROM workflow_hooks WHERE workflow_id = $1 AND id = $2", workflowID, hookID)
+	if err != nil {
+		return db.Classify(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return db.Classify(pgx.ErrNoRows)
+	}
+	return nil
+}
+
+func (r *PostgresRepository) GetExecution(ctx context.Context, id string) (*ExecutionRecord, error) {
+	var (
+		rec                 ExecutionRecord
+		finalContext, trace []byte
+		resolution          resolutionColumns
+	)
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, workflow_id, status, executed_at, input, final_context, execution_trace,
+			triggered_by, COALESCE(workflow_version, 0), COALESCE(failed_node_type, ''),
+			started_at, finished_at, duration_ms, checkpoint, pending_input, COALESCE(environment, ''),
+			COALESCE(trace_level, ''), resolution, resolved_by, resolved_at
+		FROM executions
+		WHERE id = $1`, id,
+	).Scan(&rec.ID, &rec.WorkflowID, &rec.Status, &rec.ExecutedAt, &rec.Input, &finalContext, &trace,
+		&rec.TriggeredBy, &rec.WorkflowVersion, &rec.FailedNodeType,
+		&rec.StartedAt, &rec.FinishedAt, &rec.DurationMs, &rec.Checkpoint, &rec.PendingInput, &rec.Environment,
+		&rec.TraceLevel, &resolution.status, &resolution.author, &resolution.at)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	rec.Resolution = resolution.resolution()
+
+	if err := r.openJSON(finalContext, aadFinalContext+rec.ID, &rec.FinalContext); err != nil {
+		return nil, fmt.Errorf("failed to decode final context: %w", err)
+	}
+	if err := r.openJSON(trace, aadTrace+rec.ID, &rec.Steps); err != nil {
+		return nil, fmt.Errorf("failed to decode execution trace: %w", err)
+	}
+	return &rec, nil
+}
+
+// ListExecutions returns the most recent executions of a workflow, newest
+// first.
+func (r *PostgresRepository) ListExecutions(ctx context.Context, workflowID string, limit int) ([]ExecutionSummary, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, workflow_id, status, executed_at, duration_ms, triggered_by, COALESCE(workflow_version, 0), COALESCE(failed_node_type, ''),
+			resolution, resolved_by, resolved_at,
+			(SELECT count(*) FROM execution_notes n WHERE n.execution_id = executions.id)
+		FROM executions
+		WHERE workflow_id = $1
+		ORDER BY executed_at DESC, id
+		LIMIT $2`, workflowID, limit)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	summaries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ExecutionSummary, error) {
+		var (
+			s          ExecutionSummary
+			resolution resolutionColumns
+		)
+		err := row.Scan(&s.ID, &s.WorkflowID, &s.Status, &s.ExecutedAt, &s.DurationMs,
+			&s.TriggeredBy, &s.WorkflowVersion, &s.FailedNodeType,
+			&resolution.status, &resolution.author, &resolution.at, &s.Notes)
+		s.Resolution = resolution.resolution()
+		return s, err
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return summaries, nil
+}
+
+// resolutionColumns scans the nullable resolution columns of executions.
+type resolutionColumns struct {
+	status, author *string
+	at             *time.Time
+}
+
+func (c resolutionColumns) resolution() *Resolution {
+	if c.status == nil {
+		return nil
+	}
+	res := &Resolution{Status: *c.status}
+	if c.author != nil {
+		res.Author = *c.author
+	}
+	if c.at != nil {
+		res.UpdatedAt = *c.at
+	}
+	return res
+}
+
+func (r *PostgresRepository) ListExecutionNotes(ctx context.Context, executionID string) ([]ExecutionNote, error) {
+	var exists bool
+	if err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM executions WHERE id = $1)`, executionID).Scan(&exists); err != nil {
+		return nil, db.Classify(err)
+	}
+	if !exists {
+		return nil, db.Classify(pgx.ErrNoRows)
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, execution_id, author, body, COALESCE(resolution, ''), created_at
+		FROM execution_notes
+		WHERE execution_id = $1
+		ORDER BY created_at, id`, executionID)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	notes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ExecutionNote, error) {
+		var n ExecutionNote
+		err := row.Scan(&n.ID, &n.ExecutionID, &n.Author, &n.Body, &n.Resolution, &n.CreatedAt)
+		return n, err
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return notes, nil
+}
+
+func (r *PostgresRepository) AddExecutionNote(ctx context.Context, note *ExecutionNote) error {
+	return db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		// Lock the execution so that concurrent resolutions apply in the
+		// order of their notes.
+		var status, author *string
+		var at *time.Time
+		if res := note.resolution(); res != nil {
+			status, author, at = &res.Status, &res.Author, &res.UpdatedAt
+		}
+		tag, err := tx.Exec(ctx, `
+			UPDATE executions
+			SET resolution = CASE WHEN $2 THEN $3 ELSE resolution END,
+				resolved_by = CASE WHEN $2 THEN $4 ELSE resolved_by END,
+				resolved_at = CASE WHEN $2 THEN $5 ELSE resolved_at END
+			WHERE id = $1`, note.ExecutionID, note.Resolution != "", status, author, at)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO execution_notes (id, execution_id, author, body, resolution, created_at)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)`,
+			note.ID, note.ExecutionID, note.Author, note.Body, note.Resolution, note.CreatedAt)
+		return err
+	})
+}
+
+// GetExecutionStats aggregates the executions of a workflow that started at or
+// after since.
+func (r *PostgresRepository) GetExecutionStats(ctx context.Context, workflowID string, since time.Time) (*ExecutionStats, error) {
+	stats := ExecutionStats{WorkflowID: workflowID, Since: TimestampOf(since)}
+	err := r.pool.QueryRow(ctx, `
+		SELECT count(*),
+			count(*) FILTER (WHERE status = 'completed'),
+			count(*) FILTER (WHERE status IN ('failed', 'interrupted')),
+			COALESCE(avg(duration_ms), 0),
+			COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY duration_ms), 0),
+			COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY duration_ms), 0),
+			COALESCE(max(duration_ms), 0)
+		FROM executions
+		WHERE workflow_id = $1 AND started_at >= $2`, workflowID, since,
+	).Scan(&stats.Total, &stats.Completed, &stats.Failed,
+		&stats.AvgDurationMs, &stats.P50DurationMs, &stats.P95DurationMs, &stats.MaxDurationMs)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return &stats, nil
+}
+
+func (r *PostgresRepository) CountExecutionsBySource(ctx context.Context, workflowID string, since time.Time, bucket time.Duration) ([]SourceCount, error) {
+	var workflow *string
+	if workflowID != "" {
+		workflow = &workflowID
+	}
+	rows, err := r.pool.Query(ctx, `
+		SELECT date_bin(make_interval(secs => $3), started_at, $2), triggered_by,
+			count(*),
+			count(*) FILTER (WHERE status = 'completed'),
+			count(*) FILTER (WHERE status IN ('failed', 'interrupted'))
+		FROM executions
+		WHERE started_at >= $2 AND ($1::uuid IS NULL OR workflow_id = $1::uuid)
+		GROUP BY 1, 2
+		ORDER BY 1, 2`, workflow, since, bucket.Seconds())
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	counts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (SourceCount, error) {
+		var c SourceCount
+		err := row.Scan(&c.BucketStart, &c.Source, &c.Total, &c.Completed, &c.Failed)
+		return c, err
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return counts, nil
+}
+
+// GetStepCoverage reads the per-step table, pairing every step with the next
+// one of its execution.
+func (r *PostgresRepository) GetStepCoverage(ctx context.Context, workflowID string, since time.Time) (*StepCoverage, error) {
+	coverage := StepCoverage{Nodes: make(map[string]Exercised), Transitions: make(map[Transition]Exercised)}
+	err := r.pool.QueryRow(ctx, `
+		SELECT count(*) FROM executions WHERE workflow_id = $1 AND started_at >= $2`, workflowID, since,
+	).Scan(&coverage.Executions)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		WITH steps AS (
+			SELECT s.execution_id, e.started_at, s.node_id,
+				LEAD(s.node_id) OVER (PARTITION BY s.execution_id ORDER BY s.seq) AS next_node_id
+			FROM execution_steps s
+			JOIN executions e ON e.id = s.execution_id
+			WHERE e.workflow_id = $1 AND e.started_at >= $2
+		)
+		SELECT node_id, COALESCE(next_node_id, ''), GROUPING(next_node_id) = 1,
+			count(DISTINCT execution_id), max(started_at)
+		FROM steps
+		GROUP BY GROUPING SETS ((node_id), (node_id, next_node_id))`, workflowID, since)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			t       Transition
+			perNode bool
+			ex      Exercised
+		)
+		if err := rows.Scan(&t.From, &t.To, &perNode, &ex.Executions, &ex.LastAt); err != nil {
+			return nil, db.Classify(err)
+		}
+		switch {
+		case perNode:
+			coverage.Nodes[t.From] = ex
+		case t.To != "" && t.To != t.From:
+			coverage.Transitions[t] = ex
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, db.Classify(err)
+	}
+	return &coverage, nil
+}
+
+func (r *PostgresRepository) GetStepBaselines(ctx context.Context, workflowID string) (map[string]*StepBaseline, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT node_id, samples, mean_ms, m2, min_ms, max_ms
+		FROM step_duration_stats
+		WHERE workflow_id = $1`, workflowID)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	baselines, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*StepBaseline, error) {
+		var b StepBaseline
+		err := row.Scan(&b.NodeID, &b.Samples, &b.MeanMs, &b.M2, &b.MinMs, &b.MaxMs)
+		return &b, err
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	out := make(map[string]*StepBaseline, len(baselines))
+	for _, b := range baselines {
+		out[b.NodeID] = b
+	}
+	return out, nil
+}
+
+// RecordStepDurations folds the durations (by node id) of one execution into
+// the stored baselines. Rows are locked while they are updated so concurrent
+// executions don't lose samples.
+func (r *PostgresRepository) RecordStepDurations(ctx context.Context, workflowID string, durations map[string]int64) error {
+	if len(durations) == 0 {
+		return nil
+	}
+
+	return db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		for nodeID, ms := range durations {
+			b := StepBaseline{NodeID: nodeID}
+			err := tx.QueryRow(ctx, `
+				SELECT samples, mean_ms, m2, min_ms, max_ms
+				FROM step_duration_stats
+				WHERE workflow_id = $1 AND node_id = $2
+				FOR UPDATE`, workflowID, nodeID,
+			).Scan(&b.Samples, &b.MeanMs, &b.M2, &b.MinMs, &b.MaxMs)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return err
+			}
+
+			b.Add(ms)
+
+			_, err = tx.Exec(ctx, `
+				INSERT INTO step_duration_stats (workflow_id, node_id, samples, mean_ms, m2, min_ms, max_ms)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				ON CONFLICT (workflow_id, node_id) DO UPDATE
+				SET samples = EXCLUDED.samples, mean_ms = EXCLUDED.mean_ms, m2 = EXCLUDED.m2,
+				    min_ms = EXCLUDED.min_ms, max_ms = EXCLUDED.max_ms, updated_at = now()`,
+				workflowID, nodeID, b.Samples, b.MeanMs, b.M2, b.MinMs, b.MaxMs)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CreateWorkflow inserts a workflow with its nodes and edges in a single
+// transaction. An empty wf.ID is replaced by a new UUID.
+func (r *PostgresRepository) CreateWorkflow(ctx context.Context, wf *Workflow) error {
+	if wf.ID == "" {
+		wf.ID = uuid.NewString()
+	}
+
+	return db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx,
+			`INSERT INTO workflows (id, name, defaults, environment, trace_level, handler_versions, project_id, budget)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, NULLIF($7, '')::uuid, $8) RETURNING version`,
+			wf.ID, wf.Name, defaultsOf(wf), wf.Environment, wf.TraceLevel, wf.HandlerVersions, wf.ProjectID, wf.Budget,
+		).Scan(&wf.Version)
+		if err != nil {
+			return err
+		}
+		return insertGraph(ctx, tx, wf)
+	})
+}
+
+func (r *PostgresRepository) UpdateWorkflow(ctx context.Context, wf *Workflow, expectedVersion int) error {
+	return db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		var version int
+		err := tx.QueryRow(ctx, "SELECT version FROM workflows WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", wf.ID).Scan(&version)
+		if err != nil {
+			return err
+		}
+		if expectedVersion != 0 && version != expectedVersion {
+			return fmt.Errorf("%w: workflow %s is at version %d, not %d", db.ErrConflict, wf.ID, version, expectedVersion)
+		}
+		return replaceGraph(ctx, tx, wf)
+	})
+}
+
+func (r *PostgresRepository) DeleteWorkflow(ctx context.Context, id string, opts WorkflowDeletion) error {
+	if !opts.Hard {
+		tag, err := r.pool.Exec(ctx,
+			"UPDATE workflows SET deleted_at = now(), updated_at = now() WHERE id = $1 AND deleted_at IS NULL", id)
+		if err != nil {
+			return db.Classify(err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("%w: workflow %s", db.ErrNotFound, id)
+		}
+		return nil
+	}
+
+	return db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		// Soft-deleted workflows can be hard deleted too, to free their id.
+		var exists bool
+		err := tx.QueryRow(ctx, "SELECT true FROM workflows WHERE id = $1 FOR UPDATE", id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		var executions int
+		err = tx.QueryRow(ctx, "SELECT count(*) FROM executions WHERE workflow_id = $1", id).Scan(&executions)
+		if err != nil {
+			return err
+		}
+		if executions > 0 {
+			if !opts.Executions {
+				return fmt.Errorf("%w: workflow %s has %d executions, delete them too with executions=true",
+					db.ErrConflict, id, executions)
+			}
+			// Steps and notes cascade from their execution.
+			if _, err := tx.Exec(ctx, "DELETE FROM executions WHERE workflow_id = $1", id); err != nil {
+				return err
+			}
+		}
+		// Nodes, edges, hooks, receivers, presets and bindings cascade.
+		_, err = tx.Exec(ctx, "DELETE FROM workflows WHERE id = $1", id)
+		return err
+	})
+}
+
+// insertGraph writes the nodes and edges of wf. Their position in wf becomes
+// their sort_index.
+func insertGraph(ctx context.Context, tx pgx.Tx, wf *Workflow) error {
+	for i, n := range wf.Nodes {
+		metadata := n.Data.Metadata
+		if metadata == nil {
+			metadata = map[string]any{}
+		}
+		_, err := tx.Exec(ctx, `
+			INSERT INTO nodes (workflow_id, node_id, type, label, description, x_pos, y_pos, metadata, sort_index, parent_id,
+				style)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11)`,
+			wf.ID, n.ID, n.Type, n.Data.Label, n.Data.Description, n.Position.X, n.Position.Y, metadata, i, n.ParentID,
+			styleOf(n.Style))
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, e := range wf.Edges {
+		props := e.Props.fields()
+		var sourceHandle *string
+		if e.SourceHandle != "" {
+			sourceHandle = &e.SourceHandle
+		}
+		_, err := tx.Exec(ctx, `
+			INSERT INTO edges (workflow_id, edge_id, source, target, source_handle, edge_props, sort_index)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			wf.ID, e.ID, e.Source, e.Target, sourceHandle, props, i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *PostgresRepository) ListWorkflowIDs(ctx context.Context, includeArchived bool) ([]string, error) {
+	rows, err := r.pool.Query(ctx,
+		"SELECT id FROM workflows WHERE deleted_at IS NULL AND ($1 OR archived_at IS NULL) ORDER BY created_at", includeArchived)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return ids, nil
+}
+
+func (r *PostgresRepository) ListRecentlyExecutedWorkflowIDs(ctx context.Context, limit int) ([]string, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT w.id FROM workflows w
+		CROSS JOIN LATERAL (SELECT max(executed_at) AS last FROM executions WHERE workflow_id = w.id) e
+		WHERE w.deleted_at IS NULL AND w.archived_at IS NULL AND e.last IS NOT NULL
+		ORDER BY e.last DESC, w.id
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	return ids, nil
+}
+
+func (r *PostgresRepository) ListWorkflows(ctx context.Context, filter WorkflowFilter) ([]WorkflowSummary, int, error) {
+	var project *string
+	if filter.ProjectID != "" {
+		project = &filter.ProjectID
+	}
+	var total int
+	err := r.pool.QueryRow(ctx, `
+		SELECT count(*) FROM workflows
+		WHERE deleted_at IS NULL AND ($1 OR archived_at IS NULL) AND ($2::uuid IS NULL OR project_id = $2)`,
+		filter.IncludeArchived, project).Scan(&total)
+	if err != nil {
+		return nil, 0, db.Classify(err)
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT w.id, w.name, w.version, COALESCE(w.project_id::text, ''), w.updated_at, w.archived_at,
+			(SELECT count(*) FROM nodes n WHERE n.workflow_id = w.id)
+		FROM workflows w
+		WHERE w.deleted_at IS NULL AND ($1 OR w.archived_at IS NULL) AND ($2::uuid IS NULL OR w.project_id = $2)
+		ORDER BY w.created_at, w.id
+		OFFSET $3 LIMIT $4`, filter.IncludeArchived, project, filter.Offset, filter.Limit)
+	if err != nil {
+		return nil, 0, db.Classify(err)
+	}
+	summaries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (WorkflowSummary, error) {
+		var s WorkflowSummary
+		err := row.Scan(&s.ID, &s.Name, &s.Version, &s.ProjectID, &s.UpdatedAt, &s.ArchivedAt, &s.NodeCount)
+		return s, err
+	})
+	if err != nil {
+		return nil, 0, db.Classify(err)
+	}
+	return summaries, total, nil
+}
+
+// ApplySyncPlan creates, updates and archives workflows in one transaction so
+// a sync is applied completely or not at all. Updated workflows have their
+// graph replaced, their version bumped and are unarchived.
+func (r *PostgresRepository) ApplySyncPlan(ctx context.Context, plan *SyncPlan) error {
+	return db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		for _, wf := range plan.Create {
+			err := tx.QueryRow(ctx,
+				`INSERT INTO workflows (id, name, defaults, environment, trace_level, handler_versions, project_id, budget)
+				VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, NULLIF($7, '')::uuid, $8) RETURNING version`,
+				wf.ID, wf.Name, defaultsOf(wf), wf.Environment, wf.TraceLevel, wf.HandlerVersions, wf.ProjectID, wf.Budget,
+			).Scan(&wf.Version)
+			if err != nil {
+				return err
+			}
+			if err := insertGraph(ctx, tx, wf); err != nil {
+				return err
+			}
+		}
+
+		for _, wf := range plan.Update {
+			if err := replaceGraph(ctx, tx, wf); err != nil {
+				return err
+			}
+		}
+
+		for _, wf := range plan.Layout {
+			if err := saveLayout(ctx, tx, wf.ID, layoutOf(wf)); err != nil {
+				return err
+			}
+		}
+
+		for _, id := range plan.Archive {
+			_, err := tx.Exec(ctx,
+				"UPDATE workflows SET archived_at = now(), updated_at = now() WHERE id = $1", id)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// styleOf returns the style of a node for the NOT NULL style column.
+func styleOf(style map[string]any) map[string]any {
+	if style == nil {
+		return map[string]any{}
+	}
+	return style
+}
+
+// defaultsOf returns the defaults of wf for the NOT NULL defaults column.
+func defaultsOf(wf *Workflow) map[string]map[string]any {
+	if wf.Defaults == nil {
+		return map[string]map[string]any{}
+	}
+	return wf.Defaults
+}
+
+// replaceGraph overwrites the name, defaults, environment, trace level,
+// handler versions, budget, nodes and edges of an existing workflow and bumps
+// its version. Its project is kept; transfers move workflows between
+// projects.
+func replaceGraph(ctx context.Context, tx pgx.Tx, wf *Workflow) error {
+	err := tx.QueryRow(ctx, `
+		UPDATE workflows
+		SET name = $2, defaults = $3, environment = NULLIF($4, ''), trace_level = NULLIF($5, ''),
+			handler_versions = $6, budget = $7, version = version + 1, archived_at = NULL, updated_at = now()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING version, COALESCE(project_id::text, '')`,
+		wf.ID, wf.Name, defaultsOf(wf), wf.Environment, wf.TraceLevel, wf.HandlerVersions, wf.Budget,
+	).Scan(&wf.Version, &wf.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	// Edges reference nodes and are removed with them.
+	if _, err := tx.Exec(ctx, "DELETE FROM nodes WHERE workflow_id = $1", wf.ID); err != nil {
+		return err
+	}
+	return insertGraph(ctx, tx, wf)
+}
+
+// GetWorkflows loads several workflows with one query per table. Unknown ids
+// are skipped; the result is in no particular order.
+func (r *PostgresRepository) GetWorkflows(ctx context.Context, ids []string) ([]*Workflow, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, name, version, archived_at, COALESCE(project_id::text, ''), defaults, COALESCE(environment, ''),
+			COALESCE(trace_level, ''), handler_versions, budget
+		FROM workflows WHERE id = ANY($1) AND deleted_at IS NULL`, ids)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	workflows, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Workflow, error) {
+		wf := &Workflow{Nodes: []Node{}, Edges: []Edge{}}
+		err := row.Scan(&wf.ID, &wf.Name, &wf.Version, &wf.ArchivedAt, &wf.ProjectID, &wf.Defaults, &wf.Environment,
+			&wf.TraceLevel, &wf.HandlerVersions, &wf.Budget)
+		return wf, err
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	byID := make(map[string]*Workflow, len(workflows))
+	for _, wf := range workflows {
+		byID[wf.ID] = wf
+	}
+
+	rows, err = r.pool.Query(ctx, `
+		SELECT workflow_id, node_id, type, label, description, x_pos, y_pos, metadata, COALESCE(parent_id, ''), style
+		FROM nodes
+		WHERE workflow_id = ANY($1)
+		ORDER BY workflow_id, sort_index, node_id`, ids)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	var (
+		workflowID string
+		n          Node
+	)
+	_, err = pgx.ForEachRow(rows, []any{&workflowID, &n.ID, &n.Type, &n.Data.Label, &n.Data.Description,
+		&n.Position.X, &n.Position.Y, &n.Data.Metadata, &n.ParentID, &n.Style}, func() error {
+		if wf, ok := byID[workflowID]; ok {
+			wf.Nodes = append(wf.Nodes, n)
+		}
+		n = Node{}
+		return nil
+	})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	rows, err = r.pool.Query(ctx, `
+		SELECT workflow_id, edge_id, source, target, COALESCE(source_handle, ''), edge_props
+		FROM edges
+		WHERE workflow_id = ANY($1)
+		ORDER BY workflow_id, sort_index, edge_id`, ids)
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+	var (
+		e     Edge
+		props []byte
+	)
+	_, err = pgx.ForEachRow(rows, []any{&workflowID, &e.ID, &e.Source, &e.Target, &e.SourceHandle, &props},
+		func() error {
+			var err error
+			if e.Props, err = edgePropsFromJSON(e.ID, props); err != nil {
+				return err
+			}
+			if wf, ok := byID[workflowID]; ok {
+				wf.Edges = append(wf.Edges, e)
+			}
+			e = Edge{}
+			return nil
+		})
+	if err != nil {
+		return nil, db.Classify(err)
+	}
+
+	return workflows, nil
+}
+
+func (r *PostgresRepository) GetLayout(ctx context.Context, workflowID string) (*Layout, error) {
+	wf, err := r.GetWorkflow(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	return layoutOf(wf), nil
+}
+
+func (r *PostgresRepository) SaveLayout(ctx context.Context, workflowID string, layout *Layout) error {
+	return db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		return saveLayout(ctx, tx, workflowID, layout)
+	})
+}
+
+// saveLayout updates the presentation columns of the nodes and edges in
+// layout. The version is left alone.
+func saveLayout(ctx context.Context, tx pgx.Tx, workflowID string, layout *Layout) error {
+	tag, err := tx.Exec(ctx, "UPDATE workflows SET updated_at = now() WHERE id = $1 AND deleted_at IS NULL", workflowID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: workflow %s", db.ErrNotFound, workflowID)
+	}
+	for _, nodeID := range slices.Sorted(maps.Keys(layout.Nodes)) {
+		n := layout.Nodes[nodeID]
+		_, err := tx.Exec(ctx, `
+			UPDATE nodes SET x_pos = $3, y_pos = $4, label = $5, parent_id = NULLIF($6, ''), style = $7
+			WHERE workflow_id = $1 AND node_id = $2`,
+			workflowID, nodeID, n.Position.X, n.Position.Y, n.Label, n.ParentID, styleOf(n.Style))
+		if err != nil {
+			return err
+		}
+	}
+	for _, edgeID := range slices.Sorted(maps.Keys(layout.Edges)) {
+		_, err := tx.Exec(ctx, "UPDATE edges SET edge_props = $3 WHERE workflow_id = $1 AND edge_id = $2",
+			workflowID, edgeID, layout.Edges[edgeID].fields())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReorderGraph sets the sort_index of the workflow's nodes and edges to their
+// position in nodeIDs and edgeIDs. A nil slice leaves that order unchanged.
+func (r *PostgresRepository) ReorderGraph(ctx context.Context, workflowID string, nodeIDs, edgeIDs []string) error {
+	return db.InTx(ctx, r.pool, func(tx pgx.Tx) error {
+		if nodeIDs != nil {
+			_, err := tx.Exec(ctx, `
+				UPDATE nodes n
+				SET sort_index = o.idx - 1
+				FROM unnest($2::text[]) WITH ORDINALITY AS o(node_id, idx)
+				WHERE n.workflow_id = $1 AND n.node_id = o.node_id`, workflowID, nodeIDs)
+			if err != nil {
+				return err
+			}
+		}
+		if edgeIDs != nil {
+			_, err := tx.Exec(ctx, `
+				UPDATE edges e
+				SET sort_index = o.idx - 1
+				FROM unnest($2::text[]) WITH ORDINALITY AS o(edge_id, idx)
+				WHERE e.workflow_id = $1 AND e.edge_id = o.edge_id`, workflowID, edgeIDs)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(ctx, "UPDATE workflows SET updated_at = now() WHERE id = $1", workflowID)
+		return err
+	})
+}
@@ -0,0 +1,121 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"workflow-code-test/api/pkg/engine"
+	nodehandlers "workflow-code-test/api/pkg/engine/handlers"
+	"workflow-code-test/api/pkg/saga"
+	"workflow-code-test/api/services/workflow"
+)
+
+// sagaID is the id of the booking saga in testdata/booking_saga.yaml.
+const sagaID = "7a3e9c1d-5b2f-4e8a-9d6c-1f0b2e4a8c37"
+
+// sagaClient is a saga.Client answering every call with the function.
+type sagaClient func(req saga.Request) (saga.Response, error)
+
+func (c sagaClient) Do(ctx context.Context, req saga.Request) (saga.Response, error) {
+	return c(req)
+}
+
+// failingConfirm answers like a participant that can't confirm bookings and,
+// if cancelFails, can't cancel them either.
+func failingConfirm(cancelFails bool) func(*engine.Registry) {
+	client := sagaClient(func(req saga.Request) (saga.Response, error) {
+		switch {
+		case strings.HasSuffix(req.URL, "/confirm"):
+			return saga.Response{}, errors.New("service returned status 409: room taken")
+		case req.Method == http.MethodDelete && cancelFails:
+			return saga.Response{}, errors.New("service returned status 503: unavailable")
+		}
+		return saga.Response{Status: http.StatusOK, Body: map[string]any{"id": "rsv-1"}}, nil
+	})
+	return func(r *engine.Registry) {
+		for _, kind := range []string{nodehandlers.SagaReserve, nodehandlers.SagaConfirm, nodehandlers.SagaCancel} {
+			r.Register(kind, nodehandlers.NewSagaStep(kind, client))
+		}
+	}
+}
+
+// book runs the booking saga for Jo.
+func (api *testAPI) book() workflow.ExecutionResponse {
+	api.t.Helper()
+	var exec workflow.ExecutionResponse
+	req := workflow.ExecuteRequest{FormData: map[string]any{"name": "Jo", "email": "jo@example.com", "room": "12"}}
+	if code := api.do(http.MethodPost, "/workflows/"+sagaID+"/execute", req, &exec); code != http.StatusOK {
+		api.t.Fatalf("execute: got %d, want 200", code)
+	}
+	return exec
+}
+
+// compensations returns "node:status" for the compensation steps.
+func compensations(steps []workflow.ExecutionStep) []string {
+	var out []string
+	for _, s := range steps {
+		if s.Compensation {
+			out = append(out, s.NodeID+":"+s.Status)
+		}
+	}
+	return out
+}
+
+func TestSagaCompensation(t *testing.T) {
+	api := newTestAPIWith(t, failingConfirm(false))
+	api.importYAML("booking_saga.yaml")
+
+	resp := api.book()
+	var stored workflow.ExecutionResponse
+	if code := api.do(http.MethodGet, "/executions/"+resp.ExecutionID, nil, &stored); code != http.StatusOK {
+		t.Fatalf("get execution: got %d, want 200", code)
+	}
+
+	for name, exec := range map[string]workflow.ExecutionResponse{"response": resp, "stored execution": stored} {
+		if exec.Status != "failed" {
+			t.Errorf("%s status = %q, want failed", name, exec.Status)
+		}
+		want := []string{"start", "form", "reserve", "notify", "confirm", "cancel"}
+		if got := path(exec.Steps); !slices.Equal(got, want) {
+			t.Fatalf("%s path = %v, want %v", name, got, want)
+		}
+		if got := compensations(exec.Steps); !slices.Equal(got, []string{"cancel:completed"}) {
+			t.Errorf("%s compensations = %v, want the completed cancel", name, got)
+		}
+		if got := exec.Steps[5].Output["url"]; got != "https://bookings.example.com/reservations/rsv-1" {
+			t.Errorf("%s cancel url = %v, want the reservation's", name, got)
+		}
+	}
+	if !strings.Contains(resp.Steps[4].Error, "room taken") {
+		t.Errorf("confirm error = %q, want the participant's", resp.Steps[4].Error)
+	}
+	if got := len(api.outbox.List()); got != 1 {
+		t.Errorf("outbox holds %d emails, want the notification", got)
+	}
+}
+
+func TestSagaFailedCompensation(t *testing.T) {
+	api := newTestAPIWith(t, failingConfirm(true))
+	api.importYAML("booking_saga.yaml")
+
+	exec := api.book()
+
+	// The run reports the confirm failure it compensated for, and the
+	// compensation's own failure in its step.
+	if exec.Status != "failed" {
+		t.Errorf("status = %q, want failed", exec.Status)
+	}
+	if !strings.Contains(exec.Steps[4].Error, "room taken") {
+		t.Errorf("confirm error = %q, want the participant's", exec.Steps[4].Error)
+	}
+	if got := compensations(exec.Steps); !slices.Equal(got, []string{"cancel:failed"}) {
+		t.Fatalf("compensations = %v, want the failed cancel", got)
+	}
+	if got := exec.Steps[5].Error; !strings.Contains(got, "status 503") {
+		t.Errorf("compensation error = %q, want the participant's", got)
+	}
+}
@@ -1,34 +1,370 @@
 package workflow
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"workflow-code-test/api/pkg/callback"
+	"workflow-code-test/api/pkg/email"
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/sharelink"
+	"workflow-code-test/api/pkg/vcr"
+	"workflow-code-test/api/pkg/weather"
 )
 
 type Service struct {
-	db *pgxpool.Pool
+	repo Repository
+	// layouts keeps the layouts of workflows when they aren't stored in
+	// repo.
+	layouts    LayoutStore
+	executor   engine.Engine
+	dispatcher *callback.Dispatcher
+
+	shareSigner *sharelink.Signer
+	publicURL   string
+
+	timeouts Timeouts
+
+	// clock and ids give executions their timestamps and ids, and are
+	// passed on to the engine.
+	clock engine.Clock
+	ids   engine.IDGenerator
+
+	// variants are the handler variants workflows may bind node types to.
+	variants map[string][]string
+
+	// handlerVersions are the registered versions of each node type's
+	// handler, which workflows may pin.
+	handlerVersions map[string][]string
+
+	// outputSchemas are the output schemas of each node type; spec is the
+	// OpenAPI document listing them.
+	outputSchemas map[string]map[string]any
+	spec          []byte
+
+	// environments are the named environments executions can run in.
+	environments []string
+
+	// cities are the cities form and integration nodes accept; geocoder
+	// finds the coordinates of new ones.
+	cities   weather.Catalog
+	geocoder weather.Geocoder
+
+	// weatherUsage counts the calls made with weather API keys.
+	weatherUsage weather.UsageStore
+
+	// lists are the distribution lists email nodes send to.
+	lists email.Lists
+
+	// outbox holds the emails mock clients sent, in dev mode.
+	outbox *email.Outbox
+
+	// fixtures records the outbound responses of executions, with VCR_MODE
+	// set; devMode serves the routes meant for local development.
+	fixtures *vcr.Transport
+	devMode  bool
+
+	graphs      graphCache
+	definitions definitionCache
+
+	// feeds pass the steps of runs in progress to the clients streaming
+	// them.
+	feeds stepFeeds
+
+	// events are the node events the executor publishes, served at /ws.
+	events *engine.EventBus
+
+	// responses caches the GET responses of workflow definitions.
+	responses ResponseCache
+}
+
+// Timeouts bound how long a request may run before its context is cancelled.
+type Timeouts struct {
+	// Default applies to every route except synchronous executions.
+	Default time.Duration
+	// Execute applies to POST /workflows/{id}/execute.
+	Execute time.Duration
+}
+
+// DefaultTimeouts are used unless WithTimeouts overrides them.
+var DefaultTimeouts = Timeouts{
+	Default: 5 * time.Second,
+	Execute: 30 * time.Second,
+}
+
+// Option configures optional dependencies of the Service.
+type Option func(*Service)
+
+// WithRepository replaces the PostgreSQL repository, e.g. with a
+// MemoryRepository.
+func WithRepository(repo Repository) Option {
+	return func(s *Service) {
+		s.repo = repo
+	}
+}
+
+// WithDispatcher delivers execution lifecycle events to the workflow's hooks.
+func WithDispatcher(d *callback.Dispatcher) Option {
+	return func(s *Service) {
+		s.dispatcher = d
+	}
+}
+
+// WithShareLinks signs execution share links with signer. publicURL is the
+// externally reachable base URL of the API (e.g. https://api.example.com) and
+// is prefixed to the links; leave it empty to return relative links.
+func WithShareLinks(signer *sharelink.Signer, publicURL string) Option {
+	return func(s *Service) {
+		s.shareSigner = signer
+		s.publicURL = strings.TrimSuffix(publicURL, "/")
+	}
+}
+
+// WithTimeouts sets the per-request deadlines. Zero values keep the defaults.
+func WithTimeouts(t Timeouts) Option {
+	return func(s *Service) {
+		if t.Default > 0 {
+			s.timeouts.Default = t.Default
+		}
+		if t.Execute > 0 {
+			s.timeouts.Execute = t.Execute
+		}
+	}
+}
+
+// WithClock makes the service and the runs it starts read the time from c,
+// e.g. a ManualClock in tests and replays. Defaults to engine.SystemClock.
+func WithClock(c engine.Clock) Option {
+	return func(s *Service) {
+		s.clock = c
+	}
 }
 
-func NewService(pool *pgxpool.Pool) (*Service, error) {
-	return &Service{db: pool}, nil
+// WithIDGenerator makes the service and the runs it starts generate ids with
+// g, e.g. SequentialIDs in tests and replays. Defaults to engine.RandomIDs.
+func WithIDGenerator(g engine.IDGenerator) Option {
+	return func(s *Service) {
+		s.ids = g
+	}
 }
 
-// jsonMiddleware sets the Content-Type header to application/json
-func jsonMiddleware(next http.Handler) http.Handler {
+func NewService(pool *pgxpool.Pool, executor engine.Engine, opts ...Option) (*Service, error) {
+	s := &Service{
+		repo:      NewPostgresRepository(pool),
+		executor:  executor,
+		timeouts:  DefaultTimeouts,
+		clock:     engine.SystemClock,
+		ids:       engine.RandomIDs,
+		responses: NewMemoryResponseCache(DefaultResponseTTL),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.spec = openAPISpec
+	if len(s.outputSchemas) > 0 {
+		spec, err := specWithOutputSchemas(openAPISpec, s.outputSchemas)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add output schemas to the OpenAPI document: %w", err)
+		}
+		s.spec = spec
+	}
+
+	if s.shareSigner == nil {
+		signer, err := sharelink.NewRandomSigner()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create share link signer: %w", err)
+		}
+		s.shareSigner = signer
+	}
+	return s, nil
+}
+
+// deadlineMiddleware cancels the request context after d. Routes that need a
+// different deadline are wrapped with withDeadline instead.
+func deadlineMiddleware(d time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return withDeadline(d, next)
+	}
+}
+
+func withDeadline(d time.Duration, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		next.ServeHTTP(w, r)
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
 func (s *Service) LoadRoutes(parentRouter *mux.Router) {
+	// Path variables holding ids are checked before any handler runs.
+	workflowIDs := uuidVars(idVar{"id", "workflow"}, idVar{"hookId", "hook"}, idVar{"receiverId", "receiver"},
+		idVar{"presetId", "input preset"}, idVar{"testId", "contract test"})
+	executionIDs := uuidVars(idVar{"id", "execution"})
+
 	router := parentRouter.PathPrefix("/workflows").Subrouter()
 	router.StrictSlash(false)
-	router.Use(jsonMiddleware)
+	router.Use(negotiateMiddleware)
+	router.Use(workflowIDs)
+
+	// Executions get their own, longer deadline so they are registered on a
+	// separate subrouter without the default one.
+	execute := parentRouter.PathPrefix("/workflows").Subrouter()
+	execute.Use(negotiateMiddleware)
+	execute.Use(workflowIDs)
+	execute.Handle("/{id}/execute", withDeadline(s.timeouts.Execute, http.HandlerFunc(s.HandleExecuteWorkflow))).Methods("POST")
+	execute.Handle("/{id}/simulate", withDeadline(s.timeouts.Execute, http.HandlerFunc(s.HandleSimulateWorkflow))).Methods("POST")
+	execute.Handle("/{id}/contract-tests/run", withDeadline(s.timeouts.Execute, http.HandlerFunc(s.HandleRunContractTests))).Methods("POST")
+
+	// Submitting input resumes a run, so it shares the execution deadline.
+	resume := parentRouter.PathPrefix("/executions").Subrouter()
+	resume.Use(negotiateMiddleware)
+	resume.Use(executionIDs)
+	resume.Handle("/{id}/input", withDeadline(s.timeouts.Execute, http.HandlerFunc(s.HandleSubmitInput))).Methods("POST")
+	// Streams last as long as the run they follow, up to the same deadline;
+	// clients reconnect with Last-Event-ID for longer ones.
+	resume.Handle("/{id}/stream", withDeadline(s.timeouts.Execute, http.HandlerFunc(s.HandleStreamExecution))).Methods("GET")
+
+	// Webhook deliveries run the receiver's workflow.
+	receivers := parentRouter.PathPrefix("/receivers").Subrouter()
+	receivers.Use(negotiateMiddleware)
+	receivers.Use(uuidVars(idVar{"id", "receiver"}))
+	receivers.Handle("/{id}", withDeadline(s.timeouts.Execute, http.HandlerFunc(s.HandleDeliver))).Methods("POST")
+
+	router.Use(deadlineMiddleware(s.timeouts.Default))
+
+	router.HandleFunc("", s.HandleGetWorkflows).Methods("GET")
+	router.HandleFunc("", s.HandleCreateWorkflow).Methods("POST")
+	router.HandleFunc("/import", s.HandleImportWorkflow).Methods("POST")
+	router.HandleFunc("/sync", s.HandleSyncWorkflows).Methods("POST")
+	router.Handle("/{id}", s.cacheResponses(workflowCacheKey, http.HandlerFunc(s.HandleGetWorkflow))).Methods("GET")
+	router.HandleFunc("/{id}", s.HandleUpdateWorkflow).Methods("PUT")
+	router.HandleFunc("/{id}", s.HandleDeleteWorkflow).Methods("DELETE")
+	router.HandleFunc("/{id}/order", s.HandleReorderWorkflow).Methods("PUT")
+	router.HandleFunc("/{id}/layout", s.HandleGetLayout).Methods("GET")
+	router.HandleFunc("/{id}/layout", s.HandleSaveLayout).Methods("PUT")
+	router.HandleFunc("/{id}/executions", s.HandleListExecutions).Methods("GET")
+	router.HandleFunc("/{id}/stats", s.HandleExecutionStats).Methods("GET")
+	router.HandleFunc("/{id}/coverage", s.HandleWorkflowCoverage).Methods("GET")
+	router.HandleFunc("/{id}/lint", s.HandleLintWorkflow).Methods("GET")
+	router.HandleFunc("/{id}/export", s.HandleExportWorkflow).Methods("GET")
+
+	router.HandleFunc("/{id}/bindings", s.HandleGetBindings).Methods("GET")
+	router.HandleFunc("/{id}/bindings", s.HandlePutBindings).Methods("PUT")
+
+	router.HandleFunc("/{id}/hooks", s.HandleListHooks).Methods("GET")
+	router.HandleFunc("/{id}/hooks", s.HandleCreateHook).Methods("POST")
+	router.HandleFunc("/{id}/hooks/{hookId}", s.HandleGetHook).Methods("GET")
+	router.HandleFunc("/{id}/hooks/{hookId}", s.HandleUpdateHook).Methods("PUT")
+	router.HandleFunc("/{id}/hooks/{hookId}", s.HandleDeleteHook).Methods("DELETE")
+
+	router.HandleFunc("/{id}/receivers", s.HandleListReceivers).Methods("GET")
+	router.HandleFunc("/{id}/receivers", s.HandleCreateReceiver).Methods("POST")
+	router.HandleFunc("/{id}/receivers/{receiverId}", s.HandleGetReceiver).Methods("GET")
+	router.HandleFunc("/{id}/receivers/{receiverId}", s.HandleUpdateReceiver).Methods("PUT")
+	router.HandleFunc("/{id}/receivers/{receiverId}", s.HandleDeleteReceiver).Methods("DELETE")
+
+	router.HandleFunc("/{id}/input-presets", s.HandleListInputPresets).Methods("GET")
+	router.HandleFunc("/{id}/input-presets", s.HandleCreateInputPreset).Methods("POST")
+	router.HandleFunc("/{id}/input-presets/{presetId}", s.HandleGetInputPreset).Methods("GET")
+	router.HandleFunc("/{id}/input-presets/{presetId}", s.HandleUpdateInputPreset).Methods("PUT")
+	router.HandleFunc("/{id}/input-presets/{presetId}", s.HandleDeleteInputPreset).Methods("DELETE")
+
+	router.HandleFunc("/{id}/contract-tests", s.HandleListContractTests).Methods("GET")
+	router.HandleFunc("/{id}/contract-tests", s.HandleCreateContractTest).Methods("POST")
+	router.HandleFunc("/{id}/contract-tests/{testId}", s.HandleGetContractTest).Methods("GET")
+	router.HandleFunc("/{id}/contract-tests/{testId}", s.HandleUpdateContractTest).Methods("PUT")
+	router.HandleFunc("/{id}/contract-tests/{testId}", s.HandleDeleteContractTest).Methods("DELETE")
+
+	executions := parentRouter.PathPrefix("/executions").Subrouter()
+	executions.StrictSlash(false)
+	executions.Use(negotiateMiddleware)
+	executions.Use(executionIDs)
+	executions.Use(deadlineMiddleware(s.timeouts.Default))
+
+	executions.HandleFunc("/{id}", s.HandleGetExecution).Methods("GET")
+	executions.HandleFunc("/{id}/share", s.HandleShareExecution).Methods("POST")
+	executions.HandleFunc("/{id}/steps", s.HandleListExecutionSteps).Methods("GET")
+	executions.HandleFunc("/{id}/timeline", s.HandleGetTimeline).Methods("GET")
+	executions.HandleFunc("/{id}/snapshot", s.HandleGetSnapshot).Methods("GET")
+	executions.HandleFunc("/{id}/pending-input", s.HandleGetPendingInput).Methods("GET")
+	executions.HandleFunc("/{id}/notes", s.HandleListExecutionNotes).Methods("GET")
+	executions.HandleFunc("/{id}/notes", s.HandleAddExecutionNote).Methods("POST")
+	executions.HandleFunc("/{id}/resolution", s.HandleSetResolution).Methods("PUT")
+
+	shared := parentRouter.PathPrefix("/shared").Subrouter()
+	shared.Use(negotiateMiddleware)
+	shared.Use(deadlineMiddleware(s.timeouts.Default))
+
+	shared.HandleFunc("/executions/{id}", s.HandleGetSharedExecution).Methods("GET")
+
+	admin := parentRouter.PathPrefix("/admin").Subrouter()
+	admin.Use(negotiateMiddleware)
+	admin.Use(executionIDs)
+	admin.Use(deadlineMiddleware(s.timeouts.Default))
+
+	admin.HandleFunc("/runs", s.HandleListRuns).Methods("GET")
+	admin.HandleFunc("/runs/{id}/requeue", s.HandleRequeueRun).Methods("POST")
+	admin.HandleFunc("/queue", s.HandleQueueStatus).Methods("GET")
+	admin.HandleFunc("/execution-rates", s.HandleExecutionRates).Methods("GET")
+	admin.HandleFunc("/weather-usage", s.HandleWeatherUsage).Methods("GET")
+
+	cities := parentRouter.PathPrefix("/cities").Subrouter()
+	cities.Use(negotiateMiddleware)
+	cities.Use(deadlineMiddleware(s.timeouts.Default))
+
+	cities.HandleFunc("", s.HandleListCities).Methods("GET")
+	cities.HandleFunc("", s.HandleCreateCity).Methods("POST")
+	cities.HandleFunc("/search", s.HandleSearchCities).Methods("GET")
+	cities.HandleFunc("/{name}", s.HandleGetCity).Methods("GET")
+	cities.HandleFunc("/{name}", s.HandleUpdateCity).Methods("PUT")
+	cities.HandleFunc("/{name}", s.HandleDeleteCity).Methods("DELETE")
+
+	lists := parentRouter.PathPrefix("/distribution-lists").Subrouter()
+	lists.Use(negotiateMiddleware)
+	lists.Use(deadlineMiddleware(s.timeouts.Default))
+
+	lists.HandleFunc("", s.HandleListDistributionLists).Methods("GET")
+	lists.HandleFunc("", s.HandleCreateDistributionList).Methods("POST")
+	lists.HandleFunc("/{name}", s.HandleGetDistributionList).Methods("GET")
+	lists.HandleFunc("/{name}", s.HandleUpdateDistributionList).Methods("PUT")
+	lists.HandleFunc("/{name}", s.HandleDeleteDistributionList).Methods("DELETE")
+
+	projects := parentRouter.PathPrefix("/projects").Subrouter()
+	projects.Use(negotiateMiddleware)
+	projects.Use(uuidVars(idVar{"id", "project"}))
+	projects.Use(deadlineMiddleware(s.timeouts.Default))
+
+	projects.HandleFunc("", s.HandleListProjects).Methods("GET")
+	projects.HandleFunc("", s.HandleCreateProject).Methods("POST")
+	projects.HandleFunc("/{id}", s.HandleGetProject).Methods("GET")
+	projects.HandleFunc("/{id}", s.HandleUpdateProject).Methods("PUT")
+	projects.HandleFunc("/{id}", s.HandleDeleteProject).Methods("DELETE")
+	projects.HandleFunc("/{id}/transfers", s.HandleListTransfers).Methods("GET")
+	projects.HandleFunc("/{id}/transfers", s.HandleTransferWorkflows).Methods("POST")
+
+	// Erasure decodes every stored execution, so it gets the execution
+	// deadline.
+	privacy := parentRouter.PathPrefix("/privacy").Subrouter()
+	privacy.Use(negotiateMiddleware)
+	privacy.Handle("/erase", withDeadline(s.timeouts.Execute, http.HandlerFunc(s.HandleErase))).Methods("POST")
+
+	dev := parentRouter.PathPrefix("/dev").Subrouter()
+	dev.Use(negotiateMiddleware)
+	dev.Use(deadlineMiddleware(s.timeouts.Default))
 
-	router.HandleFunc("/{id}", s.HandleGetWorkflow).Methods("GET")
-	router.HandleFunc("/{id}/execute", s.HandleExecuteWorkflow).Methods("POST")
+	dev.HandleFunc("/outbox", s.HandleListOutbox).Methods("GET")
+	dev.HandleFunc("/snapshots", s.HandleLoadSnapshot).Methods("POST")
 
+	// WebSocket connections outlive any deadline.
+	parentRouter.HandleFunc("/ws", s.HandleWebSocket).Methods("GET")
+	parentRouter.HandleFunc("/environments", s.HandleListEnvironments).Methods("GET")
+	parentRouter.HandleFunc("/openapi.json", s.HandleOpenAPI).Methods("GET")
+	parentRouter.HandleFunc("/metrics", s.HandleMetrics).Methods("GET")
 }
@@ -0,0 +1,418 @@
+package workflow_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/email"
+	"workflow-code-test/api/pkg/engine"
+	nodehandlers "workflow-code-test/api/pkg/engine/handlers"
+	"workflow-code-test/api/pkg/sandbox"
+	"workflow-code-test/api/services/workflow"
+)
+
+// sampleID is the id of the sample workflow in testdata/weather_alert.yaml.
+const sampleID = "550e8400-e29b-41d4-a716-446655440000"
+
+// sandboxTemperature is what the weather API reports in tests.
+const sandboxTemperature = 30.0
+
+// testAPI is the API router over an in-memory repository, with every
+// integration served by the sandbox fakes.
+type testAPI struct {
+	t      *testing.T
+	url    string
+	outbox *email.Outbox
+	svc    *workflow.Service
+}
+
+// newTestAPI serves the routes of a service built like main builds it with
+// STORAGE=memory and INTEGRATION_SANDBOX=true.
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	return newTestAPIWith(t, nil)
+}
+
+// newTestAPIWith is newTestAPI with the options in opts. register, if not
+// nil, adds handlers to the registry after the built-in ones.
+func newTestAPIWith(t *testing.T, register func(*engine.Registry), opts ...workflow.Option) *testAPI {
+	t.Helper()
+	outbox := email.NewOutbox(email.DefaultOutboxSize)
+	registry := engine.NewRegistry()
+	nodehandlers.RegisterDefaults(registry, nodehandlers.Dependencies{
+		Weather: sandbox.NewWeatherClient(sandboxTemperature),
+		Email:   email.NewRecordingClient(outbox),
+		Outbox:  outbox,
+		Sandbox: true,
+	})
+	if register != nil {
+		register(registry)
+	}
+	svc, err := workflow.NewService(nil, engine.NewExecutor(registry), append([]workflow.Option{
+		workflow.WithRepository(workflow.NewMemoryRepository()),
+		workflow.WithHandlerVersions(registry.HandlerVersions()),
+		workflow.WithOutputSchemas(registry.OutputSchemas()),
+		workflow.WithOutbox(outbox),
+		workflow.WithDevMode(true),
+	}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	router := mux.NewRouter()
+	svc.LoadRoutes(router.PathPrefix("/api/v1").Subrouter())
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return &testAPI{t: t, url: srv.URL + "/api/v1", outbox: outbox, svc: svc}
+}
+
+// do sends body, JSON-encoded unless it is a string, and decodes the
+// response into out when out is not nil. It returns the status code.
+func (api *testAPI) do(method, path string, body, out any) int {
+	api.t.Helper()
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		r = bytes.NewReader([]byte(b))
+	default:
+		raw, err := json.Marshal(b)
+		if err != nil {
+			api.t.Fatalf("encode %s %s body: %v", method, path, err)
+		}
+		r = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, api.url+path, r)
+	if err != nil {
+		api.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		api.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		api.t.Fatalf("%s %s: read body: %v", method, path, err)
+	}
+	if out != nil {
+		if err := json.Unmarshal(raw, out); err != nil {
+			api.t.Fatalf("%s %s: decode %d response %s: %v", method, path, resp.StatusCode, raw, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// importYAML imports the YAML definition in testdata/name.
+func (api *testAPI) importYAML(name string) {
+	api.t.Helper()
+	def, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, api.url+"/workflows/import", bytes.NewReader(def))
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/yaml")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		raw, _ := io.ReadAll(resp.Body)
+		api.t.Fatalf("import %s: got %d %s", name, resp.StatusCode, raw)
+	}
+}
+
+// create stores a workflow of nodes and edges, given as canvas JSON objects,
+// and returns its id.
+func (api *testAPI) create(nodes, edges []map[string]any) string {
+	api.t.Helper()
+	var wf workflow.Workflow
+	if code := api.do(http.MethodPost, "/workflows", map[string]any{"name": api.t.Name(), "nodes": nodes, "edges": edges}, &wf); code != http.StatusCreated {
+		api.t.Fatalf("create workflow: got %d, want 201", code)
+	}
+	return wf.ID
+}
+
+// node and edge are canvas JSON objects for create.
+func node(id, typ string) map[string]any {
+	return map[string]any{"id": id, "type": typ, "data": map[string]any{"label": id}}
+}
+
+func edge(id, source, target string) map[string]any {
+	return map[string]any{"id": id, "source": source, "target": target}
+}
+
+// execute runs the sample workflow for Jo in Sydney against threshold.
+func (api *testAPI) execute(threshold float64) workflow.ExecutionResponse {
+	api.t.Helper()
+	var exec workflow.ExecutionResponse
+	if code := api.do(http.MethodPost, "/workflows/"+sampleID+"/execute", sampleRequest(threshold), &exec); code != http.StatusOK {
+		api.t.Fatalf("execute: got %d, want 200", code)
+	}
+	return exec
+}
+
+func sampleRequest(threshold float64) workflow.ExecuteRequest {
+	return workflow.ExecuteRequest{
+		FormData:  map[string]any{"name": "Jo", "email": "jo@example.com", "city": "Sydney"},
+		Condition: map[string]any{"operator": "greater_than", "threshold": threshold},
+	}
+}
+
+// path returns the nodes the steps ran, in order.
+func path(steps []workflow.ExecutionStep) []string {
+	ids := make([]string, len(steps))
+	for i, step := range steps {
+		ids[i] = step.NodeID
+	}
+	return ids
+}
+
+func TestExecuteWorkflow(t *testing.T) {
+	api := newTestAPI(t)
+	api.importYAML("weather_alert.yaml")
+
+	exec := api.execute(25)
+
+	if exec.Status != "completed" {
+		t.Fatalf("status = %q, want completed", exec.Status)
+	}
+	want := []string{"start", "form", "weather-api", "condition", "email", "end"}
+	if got := path(exec.Steps); !slices.Equal(got, want) {
+		t.Fatalf("path = %v, want %v", got, want)
+	}
+	for _, step := range exec.Steps {
+		if step.Status != "completed" {
+			t.Errorf("step %s status = %q, want completed", step.NodeID, step.Status)
+		}
+	}
+	if got := exec.Steps[2].Output["temperature"]; got != sandboxTemperature {
+		t.Errorf("temperature = %v, want %v", got, sandboxTemperature)
+	}
+	if got := exec.Steps[2].Output["sandbox"]; got != true {
+		t.Errorf("weather step sandbox = %v, want true", got)
+	}
+
+	sent := api.outbox.List()
+	if len(sent) != 1 {
+		t.Fatalf("outbox holds %d emails, want 1", len(sent))
+	}
+	if sent[0].To != "jo@example.com" || sent[0].Body != "Weather alert for Sydney! Temperature is 30°C!" {
+		t.Errorf("sent %+v", sent[0])
+	}
+}
+
+func TestExecuteWorkflowBranches(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold float64
+		met       bool
+		path      []string
+	}{
+		{"above threshold", 25, true, []string{"start", "form", "weather-api", "condition", "email", "end"}},
+		{"below threshold", 35, false, []string{"start", "form", "weather-api", "condition", "end"}},
+		{"at threshold", 30, false, []string{"start", "form", "weather-api", "condition", "end"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t)
+			api.importYAML("weather_alert.yaml")
+
+			exec := api.execute(tt.threshold)
+
+			if got := path(exec.Steps); !slices.Equal(got, tt.path) {
+				t.Fatalf("path = %v, want %v", got, tt.path)
+			}
+			if got := exec.Steps[3].Output["conditionMet"]; got != tt.met {
+				t.Errorf("conditionMet = %v, want %v", got, tt.met)
+			}
+			if got, want := len(api.outbox.List()), len(tt.path)-5; got != want {
+				t.Errorf("outbox holds %d emails, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestExecuteWorkflowRejectsInvalidRequests(t *testing.T) {
+	api := newTestAPI(t)
+	api.importYAML("weather_alert.yaml")
+
+	tests := []struct {
+		name string
+		path string
+		body any
+		code int
+		want string
+	}{
+		{"malformed JSON", "/workflows/" + sampleID + "/execute", `{"formData":`, http.StatusBadRequest, "invalid_json"},
+		{"workflow id not a UUID", "/workflows/sample/execute", sampleRequest(25), http.StatusBadRequest, "invalid_id"},
+		{"unknown workflow", "/workflows/7c9e6679-7425-40de-944b-e07fc1f90ae7/execute", sampleRequest(25), http.StatusNotFound, "not_found"},
+		{"invalid email", "/workflows/" + sampleID + "/execute", workflow.ExecuteRequest{
+			FormData:  map[string]any{"name": "Jo", "email": "nope", "city": "Sydney"},
+			Condition: map[string]any{"operator": "greater_than", "threshold": 25},
+		}, http.StatusBadRequest, "invalid_input"},
+		{"unknown preset", "/workflows/" + sampleID + "/execute", workflow.ExecuteRequest{Preset: "Hobart"},
+			http.StatusUnprocessableEntity, "unknown_preset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body workflow.ErrorResponse
+			if code := api.do(http.MethodPost, tt.path, tt.body, &body); code != tt.code {
+				t.Fatalf("got %d %+v, want %d", code, body, tt.code)
+			}
+			if body.Code != tt.want || body.Message == "" {
+				t.Errorf("body = %+v, want code %q with a message", body, tt.want)
+			}
+		})
+	}
+
+	var history []workflow.ExecutionSummary
+	api.do(http.MethodGet, "/workflows/"+sampleID+"/executions", nil, &history)
+	for _, run := range history {
+		if run.Status != "failed" {
+			t.Errorf("rejected request stored a %s execution", run.Status)
+		}
+	}
+}
+
+func TestCreateWorkflowRejectsInvalidGraphs(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []map[string]any
+		edges []map[string]any
+		want  string
+	}{
+		{"dangling edge", []map[string]any{node("a", "start"), node("b", "end")},
+			[]map[string]any{edge("e1", "a", "c")}, "invalid_workflow"},
+		{"no start node", []map[string]any{node("a", "form"), node("b", "end")},
+			[]map[string]any{edge("e1", "a", "b")}, "invalid_workflow"},
+		{"cycle", []map[string]any{node("a", "start"), node("b", "form"), node("c", "form"), node("d", "end")},
+			[]map[string]any{edge("e1", "a", "b"), edge("e2", "b", "c"), edge("e3", "c", "b"), edge("e4", "c", "d")}, "cycle_detected"},
+		{"parallel branches meet outside a merge node",
+			[]map[string]any{node("a", "start"), node("b1", "form"), node("b2", "form"), node("c", "form"), node("d", "end")},
+			[]map[string]any{edge("e1", "a", "b1"), edge("e2", "a", "b2"), edge("e3", "b1", "c"), edge("e4", "b2", "c"), edge("e5", "c", "d")},
+			"invalid_workflow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t)
+
+			var body workflow.ErrorResponse
+			code := api.do(http.MethodPost, "/workflows", map[string]any{"name": tt.name, "nodes": tt.nodes, "edges": tt.edges}, &body)
+			if code != http.StatusUnprocessableEntity {
+				t.Fatalf("got %d %+v, want 422", code, body)
+			}
+			if body.Code != tt.want || body.Message == "" {
+				t.Errorf("body = %+v, want code %q with a message", body, tt.want)
+			}
+
+			var list struct {
+				Total int `json:"total"`
+			}
+			api.do(http.MethodGet, "/workflows", nil, &list)
+			if list.Total != 0 {
+				t.Errorf("rejected workflow was stored")
+			}
+		})
+	}
+}
+
+func TestExecutionHistory(t *testing.T) {
+	api := newTestAPI(t)
+	api.importYAML("weather_alert.yaml")
+
+	first := api.execute(25)
+	second := api.execute(35)
+
+	var history []workflow.ExecutionSummary
+	if code := api.do(http.MethodGet, "/workflows/"+sampleID+"/executions", nil, &history); code != http.StatusOK {
+		t.Fatalf("list executions: got %d, want 200", code)
+	}
+	if len(history) != 2 {
+		t.Fatalf("history lists %d executions, want 2", len(history))
+	}
+	if history[0].ID != second.ExecutionID || history[1].ID != first.ExecutionID {
+		t.Errorf("history = %s, %s, want newest first %s, %s", history[0].ID, history[1].ID, second.ExecutionID, first.ExecutionID)
+	}
+	for _, run := range history {
+		if run.Status != "completed" || run.TriggeredBy != "api" || run.WorkflowVersion != 1 {
+			t.Errorf("summary %+v", run)
+		}
+	}
+
+	for _, want := range []workflow.ExecutionResponse{first, second} {
+		var got workflow.ExecutionResponse
+		if code := api.do(http.MethodGet, "/executions/"+want.ExecutionID, nil, &got); code != http.StatusOK {
+			t.Fatalf("get execution: got %d, want 200", code)
+		}
+		if got.Status != want.Status || !slices.Equal(path(got.Steps), path(want.Steps)) {
+			t.Errorf("stored execution %s ran %v (%s), want %v (%s)",
+				want.ExecutionID, path(got.Steps), got.Status, path(want.Steps), want.Status)
+		}
+	}
+
+	var missing workflow.ErrorResponse
+	if code := api.do(http.MethodGet, "/executions/7c9e6679-7425-40de-944b-e07fc1f90ae7", nil, &missing); code != http.StatusNotFound {
+		t.Errorf("unknown execution: got %d, want 404", code)
+	}
+}
+
+func TestExecuteInterruptedByDeadline(t *testing.T) {
+	var after atomic.Int64
+	api := newTestAPIWith(t, func(r *engine.Registry) {
+		r.Register("block", engine.HandlerFunc(func(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+			<-ec.Ctx.Done()
+			return nil, ec.Ctx.Err()
+		}))
+		r.Register("count", engine.HandlerFunc(func(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+			after.Add(1)
+			return &engine.NodeResult{}, nil
+		}))
+	}, workflow.WithTimeouts(workflow.Timeouts{Execute: 50 * time.Millisecond}))
+	id := api.create(
+		[]map[string]any{node("start", "start"), node("block", "block"), node("after", "count"), node("end", "end")},
+		[]map[string]any{edge("e1", "start", "block"), edge("e2", "block", "after"), edge("e3", "after", "end")},
+	)
+
+	began := time.Now()
+	var body workflow.ErrorResponse
+	if code := api.do(http.MethodPost, "/workflows/"+id+"/execute", `{}`, &body); code != http.StatusGatewayTimeout {
+		t.Fatalf("got %d %+v, want 504", code, body)
+	}
+	if elapsed := time.Since(began); elapsed > time.Second {
+		t.Errorf("interrupted run answered after %s", elapsed)
+	}
+	if body.Code != "timeout" || body.ExecutionID == "" {
+		t.Fatalf("body = %+v, want code timeout with the execution id", body)
+	}
+	if n := after.Load(); n != 0 {
+		t.Errorf("node after the interruption ran %d times", n)
+	}
+
+	var exec workflow.ExecutionResponse
+	if code := api.do(http.MethodGet, "/executions/"+body.ExecutionID, nil, &exec); code != http.StatusOK {
+		t.Fatalf("get execution: got %d, want 200", code)
+	}
+	if exec.Status != "interrupted" {
+		t.Errorf("stored status = %q, want interrupted", exec.Status)
+	}
+	if got, want := path(exec.Steps), []string{"start", "block"}; !slices.Equal(got, want) {
+		t.Errorf("stored path = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,215 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/engine/handlers"
+	"workflow-code-test/api/pkg/sandbox"
+)
+
+// maxScenarios bounds the runs of one simulation.
+const maxScenarios = 200
+
+// SimulateRequest is the body of POST /workflows/{id}/simulate. The workflow
+// runs once per temperature, with the same form data and condition.
+type SimulateRequest struct {
+	Temperatures TemperatureGrid `json:"temperatures"`
+	FormData     map[string]any  `json:"formData"`
+	Condition    map[string]any  `json:"condition"`
+}
+
+// TemperatureGrid lists the temperatures to simulate: Values, or From to To
+// inclusive in increments of Step (default 1).
+type TemperatureGrid struct {
+	Values []float64 `json:"values,omitempty"`
+	From   *float64  `json:"from,omitempty"`
+	To     *float64  `json:"to,omitempty"`
+	Step   float64   `json:"step,omitempty"`
+}
+
+// values returns the temperatures of the grid.
+func (g TemperatureGrid) values() ([]float64, error) {
+	if len(g.Values) > 0 {
+		if g.From != nil || g.To != nil {
+			return nil, errors.New("temperatures take either values or from and to")
+		}
+		if len(g.Values) > maxScenarios {
+			return nil, fmt.Errorf("at most %d temperatures can be simulated", maxScenarios)
+		}
+		return g.Values, nil
+	}
+	if g.From == nil || g.To == nil {
+		return nil, errors.New("temperatures need values or from and to")
+	}
+	step := g.Step
+	if step == 0 {
+		step = 1
+	}
+	if step < 0 || *g.To < *g.From {
+		return nil, errors.New("temperatures must go up from from to to by a positive step")
+	}
+	n := int(math.Floor((*g.To-*g.From)/step+1e-9)) + 1
+	if n > maxScenarios {
+		return nil, fmt.Errorf("at most %d temperatures can be simulated, use a larger step", maxScenarios)
+	}
+	out := make([]float64, n)
+	for i := range out {
+		// Round away the error accumulated by fractional steps.
+		out[i] = math.Round((*g.From+float64(i)*step)*1e6) / 1e6
+	}
+	return out, nil
+}
+
+// SimulationResponse reports the runs of a simulation.
+type SimulationResponse struct {
+	WorkflowID string     `json:"workflowId"`
+	Scenarios  []Scenario `json:"scenarios"`
+	// Branches lists every branch of the workflow with the temperatures it
+	// was taken at, empty for branches no scenario took.
+	Branches []BranchFiring `json:"branches"`
+}
+
+// Scenario is the outcome of the run at one temperature.
+type Scenario struct {
+	Temperature float64 `json:"temperature"`
+	Status      string  `json:"status"`
+	// Path lists the nodes run, in order.
+	Path []string `json:"path"`
+	// Branches maps the branching nodes run to the branch they took, e.g.
+	// {"condition": "true"}.
+	Branches map[string]string `json:"branches"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// BranchFiring lists the temperatures a node took one of its branches at.
+type BranchFiring struct {
+	NodeID       string    `json:"nodeId"`
+	Branch       string    `json:"branch"`
+	Temperatures []float64 `json:"temperatures"`
+}
+
+// HandleSimulateWorkflow runs the workflow across a grid of temperatures to
+// show which branches fire at which values. Every outbound node runs with its
+// sandbox handler and weather lookups report the simulated temperature. Runs
+// are not recorded and don't notify hooks.
+func (s *Service) HandleSimulateWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req SimulateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return
+	}
+	temperatures, err := req.Temperatures.values()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_simulation", err.Error())
+		return
+	}
+
+	wf, err := s.loadWorkflow(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+	graph, err := s.graph(wf)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+
+	run := executionRun{
+		WorkflowID:      id,
+		WorkflowVersion: wf.Version,
+		TriggeredBy:     TriggerAPI,
+		Bindings:        s.sandboxBindings(),
+		Pins:            wf.HandlerVersions,
+		Budget:          wf.Budget,
+	}
+	ctx := engine.WithLabels(s.withClock(r.Context()), run.labels())
+	input := map[string]any{"formData": req.FormData, "condition": req.Condition}
+
+	resp := SimulationResponse{WorkflowID: id, Scenarios: make([]Scenario, 0, len(temperatures))}
+	for _, t := range temperatures {
+		exec, err := s.executor.Execute(sandbox.WithTemperature(ctx, t), graph, input)
+		if errors.Is(err, context.Canceled) {
+			// The client went away; nobody is waiting for the other scenarios.
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			writeError(w, http.StatusGatewayTimeout, "timeout",
+				fmt.Sprintf("simulation exceeded the request deadline after %d of %d scenarios", len(resp.Scenarios), len(temperatures)))
+			return
+		}
+		if err != nil && (exec == nil || errors.Is(err, engine.ErrInvalidInput) || engine.IsGraphError(err)) {
+			writeEngineError(w, err)
+			return
+		}
+		resp.Scenarios = append(resp.Scenarios, simulatedScenario(wf, t, exec, err))
+	}
+	resp.Branches = branchFirings(wf, resp.Scenarios)
+	respond(w, http.StatusOK, resp)
+}
+
+// sandboxBindings binds every node type that has a sandbox handler to it.
+func (s *Service) sandboxBindings() map[string]string {
+	bindings := make(map[string]string)
+	for nodeType, variants := range s.variants {
+		if slices.Contains(variants, handlers.VariantSandbox) {
+			bindings[nodeType] = handlers.VariantSandbox
+		}
+	}
+	return bindings
+}
+
+// simulatedScenario summarizes the run at temperature t, replaying its steps
+// on wf like a graph overlay to tell the branches taken.
+func simulatedScenario(wf *Workflow, t float64, exec *engine.Execution, runErr error) Scenario {
+	trace := toExecutionResponse(exec)
+	sc := Scenario{Temperature: t, Status: trace.Status, Path: []string{}, Branches: map[string]string{}}
+	if runErr != nil {
+		sc.Error = runErr.Error()
+	}
+	for _, step := range trace.Steps {
+		sc.Path = append(sc.Path, step.NodeID)
+	}
+
+	edges := make(map[string]Edge, len(wf.Edges))
+	for _, e := range wf.Edges {
+		edges[e.ID] = e
+	}
+	for _, id := range graphOverlay(wf, &ExecutionRecord{Steps: trace.Steps}).Edges {
+		if e := edges[id]; e.SourceHandle != "" {
+			sc.Branches[e.Source] = e.SourceHandle
+		}
+	}
+	return sc
+}
+
+// branchFirings lists the branches of wf, in edge order, with the
+// temperatures of the scenarios that took them.
+func branchFirings(wf *Workflow, scenarios []Scenario) []BranchFiring {
+	firings := []BranchFiring{}
+	for _, e := range wf.Edges {
+		if e.SourceHandle == "" || slices.ContainsFunc(firings, func(f BranchFiring) bool {
+			return f.NodeID == e.Source && f.Branch == e.SourceHandle
+		}) {
+			continue
+		}
+		f := BranchFiring{NodeID: e.Source, Branch: e.SourceHandle, Temperatures: []float64{}}
+		for _, sc := range scenarios {
+			if sc.Branches[e.Source] == e.SourceHandle {
+				f.Temperatures = append(f.Temperatures, sc.Temperature)
+			}
+		}
+		firings = append(firings, f)
+	}
+	return firings
+}
@@ -0,0 +1,399 @@
+package workflow
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/vcr"
+)
+
+// snapshotFormat is the version of the snapshot archive layout.
+const snapshotFormat = 1
+
+// maxSnapshotSize limits the size of loaded snapshots, compressed and
+// uncompressed.
+const maxSnapshotSize = 32 << 20
+
+// Files of a snapshot archive. Fixtures go under snapshotFixtures, named as
+// in the VCR directory.
+const (
+	snapshotManifest  = "manifest.json"
+	snapshotWorkflow  = "workflow.json"
+	snapshotExecution = "execution.json"
+	snapshotFixtures  = "fixtures/"
+)
+
+// WithFixtures adds the outbound responses transport recorded or replayed
+// during an execution to its snapshot, and stores the responses of loaded
+// snapshots there.
+func WithFixtures(transport *vcr.Transport) Option {
+	return func(s *Service) {
+		s.fixtures = transport
+	}
+}
+
+// WithDevMode enables the routes meant for local development only, such as
+// loading snapshots.
+func WithDevMode(enabled bool) Option {
+	return func(s *Service) {
+		s.devMode = enabled
+	}
+}
+
+// SnapshotManifest describes a snapshot archive. WorkflowVersion is the
+// version the execution ran and DefinitionVersion that of the definition in
+// the archive, the workflow's version when it was downloaded.
+type SnapshotManifest struct {
+	Format            int       `json:"format"`
+	ExportedAt        time.Time `json:"exportedAt"`
+	ExecutionID       string    `json:"executionId"`
+	WorkflowID        string    `json:"workflowId"`
+	WorkflowVersion   int       `json:"workflowVersion"`
+	DefinitionVersion int       `json:"definitionVersion"`
+	Fixtures          int       `json:"fixtures"`
+}
+
+// snapshotRecord is the execution of a snapshot, as stored.
+type snapshotRecord struct {
+	ID              string             `json:"id"`
+	WorkflowID      string             `json:"workflowId"`
+	Status          string             `json:"status"`
+	ExecutedAt      time.Time          `json:"executedAt"`
+	Input           map[string]any     `json:"input"`
+	FinalContext    map[string]any     `json:"finalContext"`
+	Steps           []ExecutionStep    `json:"steps"`
+	TriggeredBy     string             `json:"triggeredBy"`
+	WorkflowVersion int                `json:"workflowVersion"`
+	FailedNodeType  string             `json:"failedNodeType,omitempty"`
+	Environment     string             `json:"environment,omitempty"`
+	TraceLevel      string             `json:"traceLevel,omitempty"`
+	StartedAt       time.Time          `json:"startedAt"`
+	FinishedAt      time.Time          `json:"finishedAt"`
+	DurationMs      int64              `json:"durationMs"`
+	Checkpoint      *engine.Checkpoint `json:"checkpoint,omitempty"`
+	PendingInput    *PendingInput      `json:"pendingInput,omitempty"`
+}
+
+func snapshotRecordOf(rec *ExecutionRecord) snapshotRecord {
+	return snapshotRecord{
+		ID:              rec.ID,
+		WorkflowID:      rec.WorkflowID,
+		Status:          rec.Status,
+		ExecutedAt:      rec.ExecutedAt,
+		Input:           rec.Input,
+		FinalContext:    rec.FinalContext,
+		Steps:           rec.Steps,
+		TriggeredBy:     rec.TriggeredBy,
+		WorkflowVersion: rec.WorkflowVersion,
+		FailedNodeType:  rec.FailedNodeType,
+		Environment:     rec.Environment,
+		TraceLevel:      rec.TraceLevel,
+		StartedAt:       rec.StartedAt,
+		FinishedAt:      rec.FinishedAt,
+		DurationMs:      rec.DurationMs,
+		Checkpoint:      rec.Checkpoint,
+		PendingInput:    rec.PendingInput,
+	}
+}
+
+func (s snapshotRecord) record() *ExecutionRecord {
+	return &ExecutionRecord{
+		ID:              s.ID,
+		WorkflowID:      s.WorkflowID,
+		Status:          s.Status,
+		ExecutedAt:      s.ExecutedAt,
+		Input:           s.Input,
+		FinalContext:    s.FinalContext,
+		Steps:           s.Steps,
+		TriggeredBy:     s.TriggeredBy,
+		WorkflowVersion: s.WorkflowVersion,
+		FailedNodeType:  s.FailedNodeType,
+		Environment:     s.Environment,
+		TraceLevel:      s.TraceLevel,
+		StartedAt:       s.StartedAt,
+		FinishedAt:      s.FinishedAt,
+		DurationMs:      s.DurationMs,
+		Checkpoint:      s.Checkpoint,
+		PendingInput:    s.PendingInput,
+	}
+}
+
+// snapshot is the content of a snapshot archive.
+type snapshot struct {
+	Manifest  SnapshotManifest
+	Workflow  *Workflow
+	Execution snapshotRecord
+	// Fixtures are the recorded outbound responses, keyed by file name.
+	Fixtures map[string][]byte
+}
+
+// writeArchive encodes the snapshot as a gzipped tar archive.
+func (snap *snapshot) writeArchive(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, content []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), ModTime: snap.Manifest.ExportedAt}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+	addJSON := func(name string, v any) error {
+		raw, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		return add(name, raw)
+	}
+
+	if err := addJSON(snapshotManifest, snap.Manifest); err != nil {
+		return err
+	}
+	if err := addJSON(snapshotWorkflow, snap.Workflow); err != nil {
+		return err
+	}
+	if err := addJSON(snapshotExecution, snap.Execution); err != nil {
+		return err
+	}
+	for name, raw := range snap.Fixtures {
+		if err := add(snapshotFixtures+name, raw); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// readSnapshot decodes a snapshot archive, checking that it has a manifest of
+// a known format, a workflow and an execution of that workflow.
+func readSnapshot(r io.Reader) (*snapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a gzipped archive: %w", err)
+	}
+	snap := &snapshot{Fixtures: map[string][]byte{}}
+	var found []string
+	remaining := int64(maxSnapshotSize)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if hdr.Size > remaining {
+			return nil, fmt.Errorf("archive content is limited to %d bytes", maxSnapshotSize)
+		}
+		remaining -= hdr.Size
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive: %w", err)
+		}
+
+		name := path.Clean(hdr.Name)
+		switch {
+		case name == snapshotManifest:
+			err = json.Unmarshal(content, &snap.Manifest)
+		case name == snapshotWorkflow:
+			err = json.Unmarshal(content, &snap.Workflow)
+		case name == snapshotExecution:
+			err = json.Unmarshal(content, &snap.Execution)
+		case strings.HasPrefix(name, snapshotFixtures):
+			fixture := strings.TrimPrefix(name, snapshotFixtures)
+			if path.Base(fixture) != fixture || path.Ext(fixture) != ".json" {
+				return nil, fmt.Errorf("invalid fixture name %q", hdr.Name)
+			}
+			var f vcr.Fixture
+			if err := json.Unmarshal(content, &f); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", hdr.Name, err)
+			}
+			snap.Fixtures[fixture] = content
+			continue
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", hdr.Name, err)
+		}
+		found = append(found, name)
+	}
+
+	for _, name := range []string{snapshotManifest, snapshotWorkflow, snapshotExecution} {
+		if !slices.Contains(found, name) {
+			return nil, fmt.Errorf("archive has no %s", name)
+		}
+	}
+	switch {
+	case snap.Manifest.Format != snapshotFormat:
+		return nil, fmt.Errorf("unsupported snapshot format %d, expected %d", snap.Manifest.Format, snapshotFormat)
+	case snap.Workflow == nil || snap.Workflow.ID == "":
+		return nil, fmt.Errorf("%s has no workflow id", snapshotWorkflow)
+	case snap.Execution.ID == "":
+		return nil, fmt.Errorf("%s has no execution id", snapshotExecution)
+	case snap.Execution.WorkflowID != snap.Workflow.ID:
+		return nil, fmt.Errorf("the execution belongs to workflow %s, not %s", snap.Execution.WorkflowID, snap.Workflow.ID)
+	}
+	return snap, nil
+}
+
+// HandleGetSnapshot downloads an execution as a snapshot archive: its
+// workflow's definition, its input, trace and final state, and the outbound
+// responses recorded while it ran, for POST /dev/snapshots to load into
+// another instance.
+func (s *Service) HandleGetSnapshot(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	rec, err := s.repo.GetExecution(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load execution")
+		return
+	}
+	wf, err := s.repo.GetWorkflow(r.Context(), rec.WorkflowID)
+	if err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+	var fixtures map[string][]byte
+	if s.fixtures != nil {
+		if fixtures, err = s.fixtures.Cassette(id); err != nil {
+			slog.Error("Failed to read recorded fixtures", "executionId", id, "error", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "failed to read recorded fixtures")
+			return
+		}
+	}
+
+	snap := &snapshot{
+		Manifest: SnapshotManifest{
+			Format:            snapshotFormat,
+			ExportedAt:        s.clock.Now(),
+			ExecutionID:       rec.ID,
+			WorkflowID:        wf.ID,
+			WorkflowVersion:   rec.WorkflowVersion,
+			DefinitionVersion: wf.Version,
+			Fixtures:          len(fixtures),
+		},
+		Workflow:  wf,
+		Execution: snapshotRecordOf(rec),
+		Fixtures:  fixtures,
+	}
+	var b bytes.Buffer
+	if err := snap.writeArchive(&b); err != nil {
+		slog.Error("Failed to write snapshot", "executionId", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to write snapshot")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "execution-"+id+".tar.gz"))
+	w.WriteHeader(http.StatusOK)
+	w.Write(b.Bytes())
+}
+
+// SnapshotLoad reports what loading a snapshot did. Workflow is "created",
+// "replaced" or "kept" when a workflow with its id already existed.
+// FixturesSkipped counts the recorded responses that weren't stored because
+// outbound HTTP isn't recorded or replayed (VCR_MODE).
+type SnapshotLoad struct {
+	ExecutionID     string `json:"executionId"`
+	WorkflowID      string `json:"workflowId"`
+	Workflow        string `json:"workflow"`
+	Fixtures        int    `json:"fixtures"`
+	FixturesSkipped int    `json:"fixturesSkipped"`
+}
+
+// HandleLoadSnapshot loads a snapshot archive downloaded from
+// GET /executions/{id}/snapshot: the execution is stored under its id, its
+// workflow created unless it exists, or replaced with ?replace=true, and the
+// recorded responses added to the VCR fixtures so that VCR_MODE=replay serves
+// them. It is meant for local debugging and only served in dev mode.
+func (s *Service) HandleLoadSnapshot(w http.ResponseWriter, r *http.Request) {
+	if !s.devMode {
+		writeError(w, http.StatusNotImplemented, "not_supported", "snapshots are only loaded in dev mode (DEV_MODE=true)")
+		return
+	}
+	replace, _ := strconv.ParseBool(r.URL.Query().Get("replace"))
+
+	snap, err := readSnapshot(http.MaxBytesReader(w, r.Body, maxSnapshotSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "too_large",
+				fmt.Sprintf("snapshots are limited to %d bytes", maxSnapshotSize))
+			return
+		}
+		writeError(w, http.StatusBadRequest, "invalid_snapshot", err.Error())
+		return
+	}
+	wf := snap.Workflow
+	if !s.validateDefinition(w, wf) {
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := s.repo.GetExecution(ctx, snap.Execution.ID); err == nil {
+		writeError(w, http.StatusConflict, "conflict", fmt.Sprintf("execution %s is already loaded", snap.Execution.ID))
+		return
+	} else if !errors.Is(err, db.ErrNotFound) {
+		writeStoreError(w, err, "load execution")
+		return
+	}
+
+	load := SnapshotLoad{ExecutionID: snap.Execution.ID, WorkflowID: wf.ID, Workflow: "kept"}
+	_, err = s.repo.GetWorkflow(ctx, wf.ID)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		err = s.repo.CreateWorkflow(ctx, wf)
+		load.Workflow = "created"
+	case err == nil && replace:
+		err = s.repo.UpdateWorkflow(ctx, wf, 0)
+		load.Workflow = "replaced"
+	}
+	if err != nil {
+		writeStoreError(w, err, "store workflow")
+		return
+	}
+	if load.Workflow != "kept" {
+		s.forgetWorkflow(ctx, wf.ID)
+		s.warmGraph(wf)
+	}
+
+	if err := s.repo.CreateExecution(ctx, snap.Execution.record()); err != nil {
+		writeStoreError(w, err, "store execution")
+		return
+	}
+
+	if s.fixtures == nil {
+		load.FixturesSkipped = len(snap.Fixtures)
+	} else if len(snap.Fixtures) > 0 {
+		if err := s.fixtures.AddCassette(snap.Execution.ID, snap.Fixtures); err != nil {
+			slog.Error("Failed to store recorded fixtures", "executionId", snap.Execution.ID, "error", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "failed to store recorded fixtures")
+			return
+		}
+		load.Fixtures = len(snap.Fixtures)
+	}
+	respond(w, http.StatusCreated, load)
+}
@@ -0,0 +1,286 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// Events of GET /executions/{id}/stream.
+const (
+	streamEventStatus = "status"
+	streamEventStep   = "step"
+	streamEventEnd    = "end"
+)
+
+const (
+	// streamKeepAlive is how often an idle stream sends a comment, so
+	// proxies don't close it.
+	streamKeepAlive = 15 * time.Second
+	// streamPollInterval is how often a stream checks the store for runs
+	// it has no feed for, e.g. those on another API instance.
+	streamPollInterval = time.Second
+)
+
+// StreamStatus is the data of status and end events.
+type StreamStatus struct {
+	ExecutionID string `json:"executionId"`
+	Status      string `json:"status"`
+}
+
+// stepFeeds holds the feeds of the runs in progress on this API instance.
+type stepFeeds struct {
+	mu    sync.Mutex
+	feeds map[string]*stepFeed
+}
+
+// stepFeed collects the steps of a run as the engine adds them, for the
+// streams following it.
+type stepFeed struct {
+	traceLevel string
+
+	mu     sync.Mutex
+	steps  []IndexedStep
+	status string
+	done   bool
+	// changed is closed and replaced whenever the feed changes.
+	changed chan struct{}
+}
+
+// open starts the feed of a run with its status and the steps it already
+// has, e.g. those of a checkpoint.
+func (f *stepFeeds) open(run executionRun, status string, steps []engine.ExecutionStep) *stepFeed {
+	feed := &stepFeed{traceLevel: run.TraceLevel, status: status, changed: make(chan struct{})}
+	for i, step := range steps {
+		feed.add(i, step)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.feeds == nil {
+		f.feeds = make(map[string]*stepFeed)
+	}
+	f.feeds[run.ID] = feed
+	return feed
+}
+
+// get returns the feed of a run in progress, or nil.
+func (f *stepFeeds) get(id string) *stepFeed {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.feeds[id]
+}
+
+// finish ends the feed of a run with its final status, once its record is
+// saved. Runs without a feed are ignored.
+func (f *stepFeeds) finish(id, status string) {
+	f.mu.Lock()
+	feed := f.feeds[id]
+	delete(f.feeds, id)
+	f.mu.Unlock()
+	if feed != nil {
+		feed.update(func() { feed.status, feed.done = status, true })
+	}
+}
+
+// observe attaches feed to ctx so the engine passes it the run's steps.
+func (feed *stepFeed) observe(ctx context.Context) context.Context {
+	return engine.WithStepObserver(ctx, feed.add)
+}
+
+// add appends a step as the run's trace level would store it.
+func (feed *stepFeed) add(index int, step engine.ExecutionStep) {
+	kept := traceSteps([]ExecutionStep{convertStep(step)}, feed.traceLevel)
+	if len(kept) == 0 {
+		return
+	}
+	feed.update(func() { feed.steps = append(feed.steps, IndexedStep{Index: index, ExecutionStep: kept[0]}) })
+}
+
+func (feed *stepFeed) setStatus(status string) {
+	feed.update(func() { feed.status = status })
+}
+
+// update changes the feed under its lock and wakes its streams.
+func (feed *stepFeed) update(change func()) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	change()
+	close(feed.changed)
+	feed.changed = make(chan struct{})
+}
+
+// since returns the steps after index and the state of the feed, along with
+// a channel closed on its next change.
+func (feed *stepFeed) since(index int) (steps []IndexedStep, status string, done bool, changed <-chan struct{}) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	for _, step := range feed.steps {
+		if step.Index > index {
+			steps = append(steps, step)
+		}
+	}
+	return steps, feed.status, feed.done, feed.changed
+}
+
+// eventStream writes Server-Sent Events, flushing each one.
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func newEventStream(w http.ResponseWriter) (*eventStream, error) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keeps reverse proxies like nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	es := &eventStream{w: w, rc: http.NewResponseController(w)}
+	return es, es.rc.Flush()
+}
+
+// send writes an event with data encoded as JSON; id is left out when
+// negative.
+func (es *eventStream) send(event string, id int, data any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id >= 0 {
+		fmt.Fprintf(es.w, "id: %d\n", id)
+	}
+	if _, err := fmt.Fprintf(es.w, "event: %s\ndata: %s\n\n", event, body); err != nil {
+		return err
+	}
+	return es.rc.Flush()
+}
+
+func (es *eventStream) keepAlive() error {
+	if _, err := fmt.Fprint(es.w, ": keep-alive\n\n"); err != nil {
+		return err
+	}
+	return es.rc.Flush()
+}
+
+// HandleStreamExecution streams the steps of an execution as Server-Sent
+// Events while it runs: a status event whenever it is queued or starts
+// running, a step event per step with its index as the event id, and an end
+// event with the final status once it finishes or pauses. Clients that
+// reconnect with Last-Event-ID get the steps after it. Runs on another API
+// instance are followed by polling the store, so their steps arrive once
+// they finish.
+func (s *Service) HandleStreamExecution(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	after := -1
+	if n, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil && n >= 0 {
+		after = n
+	}
+
+	// Runs save their record before closing their feed, so without a feed
+	// the record is current or the run is elsewhere.
+	feed := s.feeds.get(id)
+	rec, err := s.repo.GetExecution(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load execution")
+		return
+	}
+
+	stream, err := newEventStream(w)
+	if err == nil {
+		if feed != nil {
+			err = followFeed(r.Context(), stream, id, feed, after)
+		} else {
+			err = s.followRecord(r.Context(), stream, rec, after)
+		}
+	}
+	if err != nil && r.Context().Err() == nil {
+		slog.Warn("Execution stream ended", "executionId", id, "error", err)
+	}
+}
+
+// followFeed streams a run in progress on this instance.
+func followFeed(ctx context.Context, stream *eventStream, id string, feed *stepFeed, after int) error {
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	sent := ""
+	for {
+		steps, status, done, changed := feed.since(after)
+		if status != sent && !done {
+			if err := stream.send(streamEventStatus, -1, StreamStatus{ExecutionID: id, Status: status}); err != nil {
+				return err
+			}
+			sent = status
+		}
+		for _, step := range steps {
+			if err := stream.send(streamEventStep, step.Index, step); err != nil {
+				return err
+			}
+			after = step.Index
+		}
+		if done {
+			return stream.send(streamEventEnd, -1, StreamStatus{ExecutionID: id, Status: status})
+		}
+
+		select {
+		case <-changed:
+		case <-keepAlive.C:
+			if err := stream.keepAlive(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// followRecord streams an execution from the store, polling it while it is
+// queued or running.
+func (s *Service) followRecord(ctx context.Context, stream *eventStream, rec *ExecutionRecord, after int) error {
+	poll := time.NewTicker(streamPollInterval)
+	defer poll.Stop()
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	sent := ""
+	for rec.Status == ExecutionStatusQueued || rec.Status == ExecutionStatusRunning {
+		if rec.Status != sent {
+			if err := stream.send(streamEventStatus, -1, StreamStatus{ExecutionID: rec.ID, Status: rec.Status}); err != nil {
+				return err
+			}
+			sent = rec.Status
+		}
+
+		select {
+		case <-poll.C:
+		case <-keepAlive.C:
+			if err := stream.keepAlive(); err != nil {
+				return err
+			}
+			continue
+		case <-ctx.Done():
+			return nil
+		}
+		var err error
+		if rec, err = s.repo.GetExecution(ctx, rec.ID); err != nil {
+			return err
+		}
+	}
+
+	for i, step := range rec.Steps {
+		if i > after {
+			if err := stream.send(streamEventStep, i, IndexedStep{Index: i, ExecutionStep: step}); err != nil {
+				return err
+			}
+		}
+	}
+	return stream.send(streamEventEnd, -1, StreamStatus{ExecutionID: rec.ID, Status: rec.Status})
+}
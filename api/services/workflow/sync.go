@@ -0,0 +1,252 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sync actions reported in the change plan.
+const (
+	SyncActionCreate    = "create"
+	SyncActionUpdate    = "update"
+	SyncActionLayout    = "layout"
+	SyncActionArchive   = "archive"
+	SyncActionUnchanged = "unchanged"
+)
+
+// SyncRequest is the JSON body of POST /workflows/sync. Every workflow must
+// carry the id it is managed under.
+type SyncRequest struct {
+	Workflows []*Workflow `json:"workflows"`
+}
+
+// yamlSyncRequest is the YAML form of SyncRequest.
+type yamlSyncRequest struct {
+	Workflows []yaml.Node `yaml:"workflows"`
+}
+
+// SyncChange describes what a sync does, or did, to one workflow.
+type SyncChange struct {
+	Action      string `json:"action"`
+	WorkflowID  string `json:"workflowId"`
+	Name        string `json:"name"`
+	FromVersion int    `json:"fromVersion,omitempty"`
+	ToVersion   int    `json:"toVersion,omitempty"`
+}
+
+type SyncResponse struct {
+	DryRun  bool           `json:"dryRun"`
+	Summary map[string]int `json:"summary"`
+	Changes []SyncChange   `json:"changes"`
+}
+
+// SyncPlan is the set of writes needed to make the database match a bundle.
+type SyncPlan struct {
+	Create []*Workflow
+	Update []*Workflow
+	// Layout holds the workflows whose layout changed, and nothing else.
+	// Their layout is stored without bumping the version.
+	Layout  []*Workflow
+	Archive []string
+}
+
+// HandleSyncWorkflows reconciles the stored workflows with a bundle of
+// definitions: missing ones are created, changed ones updated and workflows
+// absent from the bundle archived. With ?dryRun=true only the plan is
+// returned.
+func (s *Service) HandleSyncWorkflows(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 10*maxImportSize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "too_large",
+			fmt.Sprintf("bundles are limited to %d bytes", 10*maxImportSize))
+		return
+	}
+
+	desired, err := decodeSyncBundle(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_bundle", err.Error())
+		return
+	}
+
+	seen := make(map[string]bool, len(desired))
+	for _, wf := range desired {
+		if wf.ID == "" {
+			writeError(w, http.StatusBadRequest, "invalid_bundle", fmt.Sprintf("workflow %q has no id", wf.Name))
+			return
+		}
+		if seen[wf.ID] {
+			writeError(w, http.StatusBadRequest, "invalid_bundle", fmt.Sprintf("workflow %s appears twice", wf.ID))
+			return
+		}
+		seen[wf.ID] = true
+		if !s.validateDefinition(w, wf) {
+			return
+		}
+	}
+
+	ids, err := s.repo.ListWorkflowIDs(r.Context(), true)
+	if err != nil {
+		writeStoreError(w, err, "list workflows")
+		return
+	}
+	current := make(map[string]*Workflow, len(ids))
+	for _, id := range ids {
+		wf, err := s.repo.GetWorkflow(r.Context(), id)
+		if err != nil {
+			writeStoreError(w, err, "load workflow")
+			return
+		}
+		current[id] = wf
+	}
+
+	plan, changes := planSync(current, desired)
+	if !dryRun {
+		if err := s.repo.ApplySyncPlan(r.Context(), plan); err != nil {
+			writeStoreError(w, err, "sync workflows")
+			return
+		}
+		for _, wf := range slices.Concat(plan.Create, plan.Update, plan.Layout) {
+			if err := s.saveLayout(r.Context(), wf); err != nil {
+				writeStoreError(w, err, "save layout")
+				return
+			}
+		}
+		for _, wf := range slices.Concat(plan.Create, plan.Update) {
+			s.forgetWorkflow(r.Context(), wf.ID)
+			s.warmGraph(wf)
+		}
+		for _, id := range plan.Archive {
+			s.forgetWorkflow(r.Context(), id)
+		}
+		for _, wf := range plan.Layout {
+			s.forgetWorkflow(r.Context(), wf.ID)
+		}
+		for i := range changes {
+			for _, wf := range slices.Concat(plan.Create, plan.Update) {
+				if wf.ID == changes[i].WorkflowID {
+					changes[i].ToVersion = wf.Version
+				}
+			}
+		}
+	}
+
+	resp := SyncResponse{DryRun: dryRun, Summary: map[string]int{}, Changes: changes}
+	for _, c := range changes {
+		resp.Summary[c.Action]++
+	}
+	respond(w, http.StatusOK, resp)
+}
+
+func decodeSyncBundle(contentType string, body []byte) ([]*Workflow, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !yamlMediaTypes[mediaType] {
+		var req SyncRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, fmt.Errorf("request body must be valid JSON")
+		}
+		return req.Workflows, nil
+	}
+
+	var req yamlSyncRequest
+	if err := yaml.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	workflows := make([]*Workflow, 0, len(req.Workflows))
+	for _, doc := range req.Workflows {
+		raw, err := yaml.Marshal(&doc)
+		if err != nil {
+			return nil, err
+		}
+		wf, err := ParseYAMLWorkflow(raw)
+		if err != nil {
+			return nil, err
+		}
+		workflows = append(workflows, wf)
+	}
+	return workflows, nil
+}
+
+// planSync compares the stored workflows with the desired ones. Workflows
+// that are already archived and absent from the bundle are left alone.
+func planSync(current map[string]*Workflow, desired []*Workflow) (*SyncPlan, []SyncChange) {
+	plan := &SyncPlan{}
+	changes := []SyncChange{}
+
+	inBundle := make(map[string]bool, len(desired))
+	for _, wf := range desired {
+		inBundle[wf.ID] = true
+
+		existing, ok := current[wf.ID]
+		switch {
+		case !ok:
+			plan.Create = append(plan.Create, wf)
+			changes = append(changes, SyncChange{Action: SyncActionCreate, WorkflowID: wf.ID, Name: wf.Name, ToVersion: 1})
+		case existing.ArchivedAt == nil && !sameDefinition(existing, wf) && sameLogic(existing, wf):
+			plan.Layout = append(plan.Layout, wf)
+			changes = append(changes, SyncChange{Action: SyncActionLayout, WorkflowID: wf.ID, Name: wf.Name,
+				FromVersion: existing.Version, ToVersion: existing.Version})
+		case existing.ArchivedAt != nil || !sameDefinition(existing, wf):
+			plan.Update = append(plan.Update, wf)
+			changes = append(changes, SyncChange{Action: SyncActionUpdate, WorkflowID: wf.ID, Name: wf.Name,
+				FromVersion: existing.Version, ToVersion: existing.Version + 1})
+		default:
+			changes = append(changes, SyncChange{Action: SyncActionUnchanged, WorkflowID: wf.ID, Name: wf.Name,
+				FromVersion: existing.Version, ToVersion: existing.Version})
+		}
+	}
+
+	var archive []*Workflow
+	for id, wf := range current {
+		if !inBundle[id] && wf.ArchivedAt == nil {
+			archive = append(archive, wf)
+		}
+	}
+	slices.SortFunc(archive, func(a, b *Workflow) int { return strings.Compare(a.ID, b.ID) })
+	for _, wf := range archive {
+		plan.Archive = append(plan.Archive, wf.ID)
+		changes = append(changes, SyncChange{Action: SyncActionArchive, WorkflowID: wf.ID, Name: wf.Name,
+			FromVersion: wf.Version})
+	}
+
+	return plan, changes
+}
+
+// sameDefinition reports whether two workflows have the same name,
+// environment, trace level, handler versions, budget, defaults, nodes and
+// edges, ignoring the order of nodes and edges.
+func sameDefinition(a, b *Workflow) bool {
+	return a.Name == b.Name && a.Environment == b.Environment && a.TraceLevel == b.TraceLevel &&
+		maps.Equal(a.HandlerVersions, b.HandlerVersions) && reflect.DeepEqual(a.Budget, b.Budget) &&
+		reflect.DeepEqual(canonicalGraph(a), canonicalGraph(b))
+}
+
+// canonicalGraph returns the nodes and edges of wf sorted by id, together with
+// its defaults, normalised through JSON so values decoded from different
+// sources compare equal.
+func canonicalGraph(wf *Workflow) any {
+	nodes := slices.Clone(wf.Nodes)
+	slices.SortFunc(nodes, func(a, b Node) int { return strings.Compare(a.ID, b.ID) })
+	edges := slices.Clone(wf.Edges)
+	slices.SortFunc(edges, func(a, b Edge) int { return strings.Compare(a.ID, b.ID) })
+
+	defaults := wf.Defaults
+	if len(defaults) == 0 {
+		defaults = nil
+	}
+	raw, _ := json.Marshal(map[string]any{"nodes": nodes, "edges": edges, "defaults": defaults})
+	var out any
+	json.Unmarshal(raw, &out)
+	return out
+}
@@ -0,0 +1,113 @@
+package workflow
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// Timeline lays the steps of an execution out as intervals relative to its
+// start, ready for a Gantt chart. Steps that overlap, e.g. on parallel
+// branches, are put on separate lanes.
+type Timeline struct {
+	ExecutionID string    `json:"executionId"`
+	Status      string    `json:"status"`
+	StartedAt   Timestamp `json:"startedAt"`
+	// DurationMs is the span from the start of the execution to the end of
+	// its last interval.
+	DurationMs Millis             `json:"durationMs"`
+	Lanes      int                `json:"lanes"`
+	Intervals  []TimelineInterval `json:"intervals"`
+}
+
+// TimelineInterval is the time one step took. StartMs and EndMs are
+// milliseconds since the execution started.
+type TimelineInterval struct {
+	Step       int    `json:"step"`
+	NodeID     string `json:"nodeId"`
+	Type       string `json:"type"`
+	Label      string `json:"label"`
+	Status     string `json:"status"`
+	StartMs    Millis `json:"startMs"`
+	EndMs      Millis `json:"endMs"`
+	DurationMs Millis `json:"durationMs"`
+	Lane       int    `json:"lane"`
+	// Ongoing is set on the step a paused execution waits in; its interval
+	// ends now.
+	Ongoing      bool `json:"ongoing,omitempty"`
+	Compensation bool `json:"compensation,omitempty"`
+}
+
+// HandleGetTimeline returns the timeline of an execution. A paused
+// execution's timeline grows while it waits, so it can be polled.
+func (s *Service) HandleGetTimeline(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	rec, err := s.repo.GetExecution(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load execution")
+		return
+	}
+	respond(w, http.StatusOK, executionTimeline(rec, s.clock.Now()))
+}
+
+// executionTimeline computes the timeline of rec as of now. Steps stored
+// before their start times were recorded are assumed to have run back to
+// back.
+func executionTimeline(rec *ExecutionRecord, now time.Time) Timeline {
+	start := rec.StartedAt
+	if start.IsZero() {
+		start = rec.ExecutedAt
+	}
+	tl := Timeline{
+		ExecutionID: rec.ID,
+		Status:      rec.Status,
+		StartedAt:   TimestampOf(start),
+		Intervals:   make([]TimelineInterval, 0, len(rec.Steps)),
+	}
+
+	var cursor Millis
+	var laneEnds []Millis
+	for i, step := range rec.Steps {
+		iv := TimelineInterval{
+			Step:         i,
+			NodeID:       step.NodeID,
+			Type:         step.Type,
+			Label:        step.Label,
+			Status:       step.Status,
+			StartMs:      cursor,
+			DurationMs:   step.DurationMs,
+			Compensation: step.Compensation,
+		}
+		if step.StartedAt != nil {
+			iv.StartMs = max(MillisOf(step.StartedAt.Sub(start)), 0)
+		}
+		if step.Status == string(engine.StepStatusWaiting) && rec.Status == string(engine.ExecutionStatusPaused) {
+			iv.Ongoing = true
+			iv.DurationMs = max(MillisOf(now.Sub(start))-iv.StartMs, iv.DurationMs)
+		}
+		iv.EndMs = iv.StartMs + iv.DurationMs
+		cursor = iv.EndMs
+
+		// Put the interval on the first lane free by its start.
+		iv.Lane = len(laneEnds)
+		for lane, end := range laneEnds {
+			if end <= iv.StartMs {
+				iv.Lane = lane
+				break
+			}
+		}
+		if iv.Lane == len(laneEnds) {
+			laneEnds = append(laneEnds, iv.EndMs)
+		} else {
+			laneEnds[iv.Lane] = iv.EndMs
+		}
+
+		tl.DurationMs = max(tl.DurationMs, iv.EndMs)
+		tl.Intervals = append(tl.Intervals, iv)
+	}
+	tl.Lanes = len(laneEnds)
+	return tl
+}
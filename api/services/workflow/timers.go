@@ -0,0 +1,122 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/pkg/engine/handlers"
+)
+
+// TimerOptions configure how executions paused on a timer, e.g. by a
+// wait_until node between polls, are resumed.
+type TimerOptions struct {
+	// Interval is how often due timers are looked for.
+	Interval time.Duration
+	// Lease is how long a claimed timer is left alone before it is claimed
+	// again, in case the process resuming it stopped.
+	Lease time.Duration
+	// Batch is the most timers claimed at once.
+	Batch int
+}
+
+var DefaultTimerOptions = TimerOptions{
+	Interval: 5 * time.Second,
+	Lease:    time.Minute,
+	Batch:    50,
+}
+
+// RunTimers resumes executions whose timer is due until ctx is done. Every
+// API process can run it; each due timer is claimed by one of them.
+func (s *Service) RunTimers(ctx context.Context, opts TimerOptions) {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ids, err := s.repo.ClaimDueTimers(ctx, s.clock.Now(), opts.Lease, opts.Batch)
+		if err != nil {
+			slog.Error("Failed to claim due timers", "error", err)
+			continue
+		}
+		for _, id := range ids {
+			// Resumed runs outlive a shutdown of the loop, but still get the
+			// execution deadline.
+			runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeouts.Execute)
+			if err := s.resumeTimer(runCtx, id); err != nil {
+				slog.Error("Failed to resume execution on timer", "executionId", id, "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// resumeTimer resumes a paused execution whose timer is due, handing the
+// node that paused it the details of its wait.
+func (s *Service) resumeTimer(ctx context.Context, id string) error {
+	rec, err := s.repo.GetExecution(ctx, id)
+	if err != nil {
+		return err
+	}
+	if rec.Checkpoint == nil || rec.PendingInput == nil || rec.PendingInput.Kind != handlers.AwaitTimer {
+		return nil
+	}
+
+	wf, err := s.loadWorkflow(ctx, rec.WorkflowID)
+	if err != nil {
+		return err
+	}
+	if wf.Version != rec.WorkflowVersion {
+		return s.failTimer(ctx, rec, fmt.Errorf("workflow changed from version %d to %d while the execution was paused",
+			rec.WorkflowVersion, wf.Version))
+	}
+	graph, err := s.graph(wf)
+	if err != nil {
+		return s.failTimer(ctx, rec, err)
+	}
+	if msg := s.checkEnvironment(rec.Environment); msg != "" {
+		return s.failTimer(ctx, rec, fmt.Errorf("%s", msg))
+	}
+	bindings, err := s.repo.GetHandlerBindings(ctx, rec.WorkflowID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.MarkExecutionResumed(ctx, rec.ID); err != nil {
+		if errors.Is(err, db.ErrConflict) {
+			// Another resume got there first.
+			return nil
+		}
+		return err
+	}
+	run, exec, err := s.resumeRun(ctx, rec, wf, graph, bindings, rec.PendingInput.Details)
+
+	// The run may have hit its deadline; it must still be recorded.
+	ctx = context.WithoutCancel(ctx)
+	if exec == nil {
+		s.notifyFailed(ctx, run, err)
+		return s.failTimer(ctx, rec, err)
+	}
+	_, err = s.recordExecution(ctx, run, exec, err)
+	return err
+}
+
+// failTimer ends a paused execution whose timer can't be resumed, keeping the
+// steps it ran before pausing.
+func (s *Service) failTimer(ctx context.Context, rec *ExecutionRecord, reason error) error {
+	slog.Warn("Failing execution paused on a timer", "id", rec.WorkflowID, "executionId", rec.ID, "error", reason)
+	now := s.clock.Now()
+	rec.Status = string(engine.ExecutionStatusFailed)
+	rec.FinishedAt = now
+	rec.DurationMs = now.Sub(rec.StartedAt).Milliseconds()
+	rec.Checkpoint, rec.PendingInput = nil, nil
+	return s.repo.UpdateExecution(ctx, rec)
+}
@@ -0,0 +1,119 @@
+package workflow
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Timestamp is a point in time in the API. It is always written in UTC as
+// RFC 3339 with nanoseconds, e.g. "2026-10-15T08:42:58.81Z", and read from
+// RFC 3339 in any offset, so timestamps stored or sent by older versions
+// still parse.
+type Timestamp struct {
+	time.Time
+}
+
+// TimestampOf returns t as a Timestamp.
+func TimestampOf(t time.Time) Timestamp {
+	return Timestamp{t.UTC()}
+}
+
+// TimestampPtr returns t as a *Timestamp, or nil if t is zero.
+func TimestampPtr(t time.Time) *Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	ts := TimestampOf(t)
+	return &ts
+}
+
+func (t Timestamp) MarshalText() ([]byte, error) {
+	return []byte(t.UTC().Format(time.RFC3339Nano)), nil
+}
+
+func (t *Timestamp) UnmarshalText(text []byte) error {
+	parsed, err := time.Parse(time.RFC3339Nano, string(text))
+	if err != nil {
+		return fmt.Errorf("timestamp %q is not RFC 3339", text)
+	}
+	t.Time = parsed.UTC()
+	return nil
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	text, _ := t.MarshalText()
+	return json.Marshal(string(text))
+}
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("timestamp must be a string: %w", err)
+	}
+	return t.UnmarshalText([]byte(s))
+}
+
+// Scan reads a timestamptz column.
+func (t *Timestamp) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		t.Time = time.Time{}
+	case time.Time:
+		t.Time = v.UTC()
+	default:
+		return fmt.Errorf("cannot scan %T into a timestamp", src)
+	}
+	return nil
+}
+
+func (t Timestamp) Value() (driver.Value, error) {
+	return t.Time, nil
+}
+
+// Millis is a duration in the API, in whole milliseconds. Fields holding
+// one end in "Ms".
+type Millis int64
+
+// MillisOf returns d in milliseconds, truncated.
+func MillisOf(d time.Duration) Millis {
+	return Millis(d.Milliseconds())
+}
+
+// Duration returns m as a time.Duration.
+func (m Millis) Duration() time.Duration {
+	return time.Duration(m) * time.Millisecond
+}
+
+// UnmarshalJSON also accepts fractional milliseconds, rounding them.
+func (m *Millis) UnmarshalJSON(data []byte) error {
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("duration must be a number of milliseconds: %w", err)
+	}
+	*m = Millis(math.Round(f))
+	return nil
+}
+
+// Scan reads an integer column of milliseconds.
+func (m *Millis) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Millis(v)
+	case int32:
+		*m = Millis(v)
+	case float64:
+		*m = Millis(math.Round(v))
+	default:
+		return fmt.Errorf("cannot scan %T into milliseconds", src)
+	}
+	return nil
+}
+
+func (m Millis) Value() (driver.Value, error) {
+	return int64(m), nil
+}
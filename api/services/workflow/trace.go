@@ -0,0 +1,51 @@
+package workflow
+
+import (
+	"fmt"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// Trace levels decide how much of an execution's trace is stored. Responses
+// to the request that ran the workflow always carry the full trace.
+const (
+	// TraceLevelFull stores every step with its output. It is the default.
+	TraceLevelFull = "full"
+	// TraceLevelSummary stores every step but drops the output of the ones
+	// that didn't fail.
+	TraceLevelSummary = "summary"
+	// TraceLevelErrors stores only failed steps and the step a paused run
+	// waits at.
+	TraceLevelErrors = "errors-only"
+)
+
+var TraceLevels = []string{TraceLevelFull, TraceLevelSummary, TraceLevelErrors}
+
+func checkTraceLevel(level string) string {
+	switch level {
+	case "", TraceLevelFull, TraceLevelSummary, TraceLevelErrors:
+		return ""
+	}
+	return fmt.Sprintf("traceLevel must be one of %v", TraceLevels)
+}
+
+// traceSteps returns the steps of a trace to store at level.
+func traceSteps(steps []ExecutionStep, level string) []ExecutionStep {
+	if level == "" || level == TraceLevelFull {
+		return steps
+	}
+	out := make([]ExecutionStep, 0, len(steps))
+	for _, step := range steps {
+		kept := engine.StepStatus(step.Status).Failed() || step.Status == string(engine.StepStatusWaiting)
+		switch {
+		case kept:
+		case level == TraceLevelErrors:
+			continue
+		case step.Output != nil:
+			step.Output = nil
+			step.OutputOmitted = true
+		}
+		out = append(out, step)
+	}
+	return out
+}
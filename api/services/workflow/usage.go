@@ -0,0 +1,48 @@
+package workflow
+
+import (
+	"net/http"
+	"time"
+
+	"workflow-code-test/api/pkg/weather"
+)
+
+// defaultUsageWindow is how far back GET /admin/weather-usage reports by
+// default.
+const defaultUsageWindow = 7 * 24 * time.Hour
+
+// WeatherUsage is the response of GET /admin/weather-usage.
+type WeatherUsage struct {
+	// Since is the first UTC day reported.
+	Since string             `json:"since"`
+	Usage []weather.KeyUsage `json:"usage"`
+}
+
+// WithWeatherUsage reports the weather API key usage counted in usage.
+// Without it GET /admin/weather-usage answers 501.
+func WithWeatherUsage(usage weather.UsageStore) Option {
+	return func(s *Service) {
+		s.weatherUsage = usage
+	}
+}
+
+// HandleWeatherUsage lists the calls made with each weather API key per UTC
+// day, newest first, over the window query parameter (default 168h).
+func (s *Service) HandleWeatherUsage(w http.ResponseWriter, r *http.Request) {
+	if s.weatherUsage == nil {
+		writeError(w, http.StatusNotImplemented, "not_supported", "no weather API key is configured")
+		return
+	}
+	window, ok := durationParam(w, r.URL.Query().Get("window"), defaultUsageWindow, "invalid_window", "window must be a positive duration such as 168h")
+	if !ok {
+		return
+	}
+
+	since := s.clock.Now().Add(-window).Format(time.DateOnly)
+	usage, err := s.weatherUsage.Usage(r.Context(), since)
+	if err != nil {
+		writeStoreError(w, err, "load weather API usage")
+		return
+	}
+	respond(w, http.StatusOK, WeatherUsage{Since: since, Usage: usage})
+}
@@ -0,0 +1,43 @@
+package workflow
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"workflow-code-test/api/pkg/engine"
+)
+
+// WithHandlerVersions sets the handler versions registered for each node
+// type, as returned by engine.Registry.HandlerVersions. Workflows can only pin
+// node types to the major versions listed.
+func WithHandlerVersions(versions map[string][]string) Option {
+	return func(s *Service) {
+		s.handlerVersions = versions
+	}
+}
+
+// checkHandlerVersions returns a field error for every handler version pin of
+// wf that no registered handler satisfies.
+func (s *Service) checkHandlerVersions(wf *Workflow) []FieldError {
+	var errs []FieldError
+	for _, nodeType := range slices.Sorted(maps.Keys(wf.HandlerVersions)) {
+		field := "handlerVersions." + nodeType
+		major := wf.HandlerVersions[nodeType]
+		versions, ok := s.handlerVersions[nodeType]
+		switch {
+		case major < 0:
+			errs = append(errs, FieldError{Field: field, Message: "must be a major version such as 1"})
+		case !ok:
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("no handler for node type %q", nodeType)})
+		case !slices.ContainsFunc(versions, func(v string) bool {
+			m, err := engine.MajorVersion(v)
+			return err == nil && m == major
+		}):
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(
+				"pinned to version %d but the registered versions are %s", major, strings.Join(versions, ", "))})
+		}
+	}
+	return errs
+}
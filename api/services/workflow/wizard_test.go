@@ -0,0 +1,201 @@
+package workflow_test
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"workflow-code-test/api/pkg/engine"
+	"workflow-code-test/api/services/workflow"
+)
+
+// startWizard creates start -> wizard form asking for an email -> middle ->
+// email to it -> end, runs it and returns the id of the paused execution.
+func (api *testAPI) startWizard(middle string) string {
+	api.t.Helper()
+	wizard := node("wizard", "form")
+	wizard["data"].(map[string]any)["metadata"] = map[string]any{
+		"mode":   "wizard",
+		"fields": []any{map[string]any{"name": "email", "label": "Email", "type": "email", "required": true}},
+	}
+	notify := node("notify", "email")
+	notify["data"].(map[string]any)["metadata"] = map[string]any{
+		"inputVariables": []any{"email"},
+		"emailTemplate":  map[string]any{"subject": "Welcome", "body": "You are signed up as {{email}}."},
+	}
+	id := api.create(
+		[]map[string]any{node("start", "start"), wizard, node("middle", middle), notify, node("end", "end")},
+		[]map[string]any{
+			edge("e1", "start", "wizard"), edge("e2", "wizard", "middle"),
+			edge("e3", "middle", "notify"), edge("e4", "notify", "end"),
+		},
+	)
+
+	var exec workflow.ExecutionResponse
+	if code := api.do(http.MethodPost, "/workflows/"+id+"/execute", `{}`, &exec); code != http.StatusOK {
+		api.t.Fatalf("execute: got %d, want 200", code)
+	}
+	if exec.Status != "paused" {
+		api.t.Fatalf("status = %s, want paused", exec.Status)
+	}
+	return exec.ExecutionID
+}
+
+func TestSubmitInput(t *testing.T) {
+	api := newTestAPI(t)
+	id := api.startWizard("merge")
+
+	var exec workflow.ExecutionResponse
+	if code := api.do(http.MethodPost, "/executions/"+id+"/input", `{"data": {"email": "jo@example.com"}}`, &exec); code != http.StatusOK {
+		t.Fatalf("submit: got %d, want 200", code)
+	}
+	if exec.Status != "completed" {
+		t.Errorf("status = %s, want completed", exec.Status)
+	}
+	if sent := api.outbox.List(); len(sent) != 1 || sent[0].To != "jo@example.com" {
+		t.Errorf("outbox = %+v, want one email to jo@example.com", sent)
+	}
+
+	var resp workflow.ErrorResponse
+	if code := api.do(http.MethodPost, "/executions/"+id+"/input", `{"data": {"email": "jo@example.com"}}`, &resp); code != http.StatusConflict || resp.Code != "not_paused" {
+		t.Errorf("second submit: got %d %s, want 409 not_paused", code, resp.Code)
+	}
+}
+
+func TestSubmitInputConcurrently(t *testing.T) {
+	// The gate holds the resumed run until the other submissions are
+	// answered, so they all find the execution paused or being resumed.
+	var gateCalls atomic.Int64
+	release := make(chan struct{})
+	api := newTestAPIWith(t, func(r *engine.Registry) {
+		r.Register("gate", engine.HandlerFunc(func(ec *engine.ExecutionContext, node *engine.Node) (*engine.NodeResult, error) {
+			gateCalls.Add(1)
+			select {
+			case <-release:
+			case <-ec.Ctx.Done():
+			}
+			return &engine.NodeResult{}, nil
+		}))
+	})
+	id := api.startWizard("gate")
+
+	const submissions = 8
+	codes := make(chan int, submissions)
+	var wg sync.WaitGroup
+	for i := range submissions {
+		wg.Go(func() {
+			var resp workflow.ErrorResponse
+			code := api.do(http.MethodPost, "/executions/"+id+"/input", `{"data": {"email": "jo@example.com"}}`, &resp)
+			if code == http.StatusConflict && resp.Code != "not_paused" {
+				t.Errorf("submission %d: got 409 %s, want not_paused", i, resp.Code)
+			}
+			codes <- code
+		})
+	}
+
+	conflicts := 0
+	timeout := time.After(2 * time.Second)
+wait:
+	for conflicts < submissions-1 {
+		select {
+		case code := <-codes:
+			if code != http.StatusConflict {
+				t.Errorf("submission answered %d while the run was held, want 409", code)
+			}
+			conflicts++
+		case <-timeout:
+			break wait
+		}
+	}
+	close(release)
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("last submission: got %d, want 200", code)
+		}
+	}
+	if conflicts != submissions-1 {
+		t.Errorf("%d submissions were rejected, want %d", conflicts, submissions-1)
+	}
+	// The nodes after the pause ran once.
+	if n := gateCalls.Load(); n != 1 {
+		t.Errorf("gate ran %d times, want 1", n)
+	}
+	if sent := api.outbox.List(); len(sent) != 1 {
+		t.Errorf("outbox has %d emails, want 1", len(sent))
+	}
+}
+
+// memoryLayouts is a LayoutStore kept apart from the repository.
+type memoryLayouts struct {
+	mu      sync.Mutex
+	layouts map[string]*workflow.Layout
+}
+
+func (m *memoryLayouts) GetLayout(ctx context.Context, workflowID string) (*workflow.Layout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := &workflow.Layout{Nodes: map[string]workflow.NodeLayout{}, Edges: map[string]workflow.EdgeProps{}}
+	if stored, ok := m.layouts[workflowID]; ok {
+		maps.Copy(l.Nodes, stored.Nodes)
+		maps.Copy(l.Edges, stored.Edges)
+	}
+	return l, nil
+}
+
+func (m *memoryLayouts) SaveLayout(ctx context.Context, workflowID string, layout *workflow.Layout) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.layouts == nil {
+		m.layouts = make(map[string]*workflow.Layout)
+	}
+	stored, ok := m.layouts[workflowID]
+	if !ok {
+		stored = &workflow.Layout{Nodes: map[string]workflow.NodeLayout{}, Edges: map[string]workflow.EdgeProps{}}
+		m.layouts[workflowID] = stored
+	}
+	maps.Copy(stored.Nodes, layout.Nodes)
+	maps.Copy(stored.Edges, layout.Edges)
+	return nil
+}
+
+func TestSubmitInputShowsRelabelledNodes(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []workflow.Option
+	}{
+		{"layout in repository", nil},
+		{"layout store", []workflow.Option{workflow.WithLayoutStore(&memoryLayouts{})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPIWith(t, nil, tt.opts...)
+			id := api.startWizard("merge")
+			var exec workflow.ExecutionResponse
+			api.do(http.MethodGet, "/executions/"+id, nil, &exec)
+
+			// Relabelling a node while the run is paused keeps the version,
+			// and the resumed steps show the new label.
+			layout := map[string]any{"nodes": map[string]any{"notify": map[string]any{"label": "Send welcome"}}}
+			if code := api.do(http.MethodPut, "/workflows/"+exec.WorkflowID+"/layout", layout, nil); code != http.StatusOK {
+				t.Fatalf("save layout: got %d, want 200", code)
+			}
+			if code := api.do(http.MethodPost, "/executions/"+id+"/input", `{"data": {"email": "jo@example.com"}}`, &exec); code != http.StatusOK {
+				t.Fatalf("submit: got %d, want 200", code)
+			}
+			labels := map[string]string{}
+			for _, step := range exec.Steps {
+				labels[step.NodeID] = step.Label
+			}
+			if labels["notify"] != "Send welcome" {
+				t.Errorf("notify step label = %q, want Send welcome", labels["notify"])
+			}
+		})
+	}
+}
@@ -1,350 +1,500 @@
 package workflow
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"time"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/callback"
+	"workflow-code-test/api/pkg/engine"
 )
 
-// TODO: Update this
 func (s *Service) HandleGetWorkflow(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 	slog.Debug("Returning workflow definition for id", "id", id)
 
-	workflowJSON := `{
-		"id": "550e8400-e29b-41d4-a716-446655440000",
-		"nodes": [
-			{
-				"id": "start",
-				"type": "start",
-				"position": {
-					"x": -160,
-					"y": 300
-				},
-				"data": {
-					"label": "Start",
-					"description": "Begin weather check workflow",
-					"metadata": {
-						"hasHandles": {
-							"source": true,
-							"target": false
-						}
-					}
-				}
-			},
-			{
-				"id": "form",
-				"type": "form",
-				"position": {
-					"x": 152,
-					"y": 304
-				},
-				"data": {
-					"label": "User Input",
-					"description": "Process collected data - name, email, location",
-					"metadata": {
-						"hasHandles": {
-							"source": true,
-							"target": true
-						},
-						"inputFields": ["name", "email", "city"],
-						"outputVariables": ["name", "email", "city"]
-					}
-				}
-			},
-			{
-				"id": "weather-api",
-				"type": "integration",
-				"position": {
-					"x": 460,
-					"y": 304
-				},
-				"data": {
-					"label": "Weather API",
-					"description": "Fetch current temperature for {{city}}",
-					"metadata": {
-						"hasHandles": {
-							"source": true,
-							"target": true
-						},
-						"inputVariables": ["city"],
-						"apiEndpoint": "https://api.open-meteo.com/v1/forecast?latitude={lat}&longitude={lon}&current_weather=true",
-						"options": [
-							{
-								"city": "Sydney",
-								"lat": -33.8688,
-								"lon": 151.2093
-							},
-							{
-								"city": "Melbourne",
-								"lat": -37.8136,
-								"lon": 144.9631
-							},
-							{
-								"city": "Brisbane",
-								"lat": -27.4698,
-								"lon": 153.0251
-							},
-							{
-								"city": "Perth",
-								"lat": -31.9505,
-								"lon": 115.8605
-							},
-							{
-								"city": "Adelaide",
-								"lat": -34.9285,
-								"lon": 138.6007
-							}
-						],
-						"outputVariables": ["temperature"]
-					}
-				}
-			},
-			{
-				"id": "condition",
-				"type": "condition",
-				"position": {
-					"x": 794,
-					"y": 304
-				},
-				"data": {
-					"label": "Check Condition",
-					"description": "Evaluate temperature threshold",
-					"metadata": {
-						"hasHandles": {
-							"source": ["true", "false"],
-							"target": true
-						},
-						"conditionExpression": "temperature {{operator}} {{threshold}}",
-						"outputVariables": ["conditionMet"]
-					}
-				}
-			},
-			{
-				"id": "email",
-				"type": "email",
-				"position": {
-					"x": 1096,
-					"y": 88
-				},
-				"data": {
-					"label": "Send Alert",
-					"description": "Email weather alert notification",
-					"metadata": {
-						"hasHandles": {
-							"source": true,
-							"target": true
-						},
-						"inputVariables": ["name", "city", "temperature"],
-						"emailTemplate": {
-							"subject": "Weather Alert",
-							"body": "Weather alert for {{city}}! Temperature is {{temperature}}°C!"
-						},
-						"outputVariables": ["emailSent"]
-					}
-				}
-			},
-			{
-				"id": "end",
-				"type": "end",
-				"position": {
-					"x": 1360,
-					"y": 302
-				},
-				"data": {
-					"label": "Complete",
-					"description": "Workflow execution finished",
-					"metadata": {
-						"hasHandles": {
-							"source": false,
-							"target": true
-						}
-					}
-				}
-			}
-		],
-		"edges": [
-			{
-				"id": "e1",
-				"source": "start",
-				"target": "form",
-				"type": "smoothstep",
-				"animated": true,
-				"style": {
-					"stroke": "#10b981",
-					"strokeWidth": 3
-				},
-				"label": "Initialize"
-			},
-			{
-				"id": "e2",
-				"source": "form",
-				"target": "weather-api",
-				"type": "smoothstep",
-				"animated": true,
-				"style": {
-					"stroke": "#3b82f6",
-					"strokeWidth": 3
-				},
-				"label": "Submit Data"
-			},
-			{
-				"id": "e3",
-				"source": "weather-api",
-				"target": "condition",
-				"type": "smoothstep",
-				"animated": true,
-				"style": {
-					"stroke": "#f97316",
-					"strokeWidth": 3
-				},
-				"label": "Temperature Data"
-			},
-			{
-				"id": "e4",
-				"source": "condition",
-				"target": "email",
-				"type": "smoothstep",
-				"sourceHandle": "true",
-				"animated": true,
-				"style": {
-					"stroke": "#10b981",
-					"strokeWidth": 3
-				},
-				"label": "✓ Condition Met",
-				"labelStyle": {
-					"fill": "#10b981",
-					"fontWeight": "bold"
-				}
-			},
-			{
-				"id": "e5",
-				"source": "condition",
-				"target": "end",
-				"type": "smoothstep",
-				"sourceHandle": "false",
-				"animated": true,
-				"style": {
-					"stroke": "#6b7280",
-					"strokeWidth": 3
-				},
-				"label": "✗ No Alert Needed",
-				"labelStyle": {
-					"fill": "#6b7280",
-					"fontWeight": "bold"
-				}
-			},
-			{
-				"id": "e6",
-				"source": "email",
-				"target": "end",
-				"type": "smoothstep",
-				"animated": true,
-				"style": {
-					"stroke": "#ef4444",
-					"strokeWidth": 2
-				},
-				"label": "Alert Sent",
-				"labelStyle": {
-					"fill": "#ef4444",
-					"fontWeight": "bold"
-				}
-			}
-		]
-	}`
-
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(workflowJSON))
+	wf, err := s.definition(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err, "load workflow")
+		return
+	}
+
+	respond(w, http.StatusOK, wf)
+}
+
+// maxBatchSize caps the number of workflows returned by one batch GET.
+const maxBatchSize = 50
+
+const (
+	defaultWorkflowPageSize = 50
+	maxWorkflowPageSize     = 200
+)
+
+// BatchWorkflowsResponse is returned by GET /workflows?ids=... . Ids that don't
+// exist are listed in Missing instead of failing the whole request.
+type BatchWorkflowsResponse struct {
+	Workflows []*Workflow `json:"workflows"`
+	Missing   []string    `json:"missing"`
+}
+
+// HandleGetWorkflows returns the full definitions of the workflows listed in
+// the comma separated ids query parameter, in the requested order. Without
+// ids it lists the workflows instead, see listWorkflows.
+func (s *Service) HandleGetWorkflows(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.Query().Has("ids") {
+		s.listWorkflows(w, r)
+		return
+	}
+	param := r.URL.Query().Get("ids")
+	if param == "" {
+		writeError(w, http.StatusBadRequest, "invalid_ids", "ids must not be empty")
+		return
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(param, ",") {
+		id = strings.TrimSpace(id)
+		if _, err := uuid.Parse(id); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_ids", fmt.Sprintf("%q is not a UUID", id))
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxBatchSize {
+		writeError(w, http.StatusBadRequest, "batch_too_large",
+			fmt.Sprintf("at most %d ids can be requested at once", maxBatchSize))
+		return
+	}
+
+	workflows, err := s.repo.GetWorkflows(r.Context(), ids)
+	if err != nil {
+		writeStoreError(w, err, "load workflows")
+		return
+	}
+
+	byID := make(map[string]*Workflow, len(workflows))
+	for _, wf := range workflows {
+		byID[wf.ID] = wf
+	}
+	resp := BatchWorkflowsResponse{Workflows: []*Workflow{}, Missing: []string{}}
+	for _, id := range ids {
+		if wf, ok := byID[id]; ok {
+			resp.Workflows = append(resp.Workflows, wf)
+		} else {
+			resp.Missing = append(resp.Missing, id)
+		}
+	}
+	respond(w, http.StatusOK, resp)
+}
+
+// listWorkflows pages through the summaries of the workflows, oldest first.
+// offset and limit select the page; archived=true includes archived
+// workflows and project keeps those of one project.
+func (s *Service) listWorkflows(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := WorkflowFilter{Limit: defaultWorkflowPageSize}
+	if raw := q.Get("archived"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_archived", "archived must be true or false")
+			return
+		}
+		filter.IncludeArchived = v
+	}
+	if raw := q.Get("project"); raw != "" {
+		if _, err := uuid.Parse(raw); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_project", fmt.Sprintf("%q is not a UUID", raw))
+			return
+		}
+		filter.ProjectID = raw
+	}
+	if raw := q.Get("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid_offset", "offset must be a non-negative integer")
+			return
+		}
+		filter.Offset = n
+	}
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxWorkflowPageSize {
+			writeError(w, http.StatusBadRequest, "invalid_limit",
+				fmt.Sprintf("limit must be between 1 and %d", maxWorkflowPageSize))
+			return
+		}
+		filter.Limit = n
+	}
+
+	summaries, total, err := s.repo.ListWorkflows(r.Context(), filter)
+	if err != nil {
+		writeStoreError(w, err, "list workflows")
+		return
+	}
+	if summaries == nil {
+		summaries = []WorkflowSummary{}
+	}
+
+	page := WorkflowPage{Total: total, Offset: filter.Offset, Limit: filter.Limit, Workflows: summaries}
+	if next := filter.Offset + len(summaries); next < total {
+		page.Next = s.workflowsURL(filter, next)
+	}
+	respond(w, http.StatusOK, page)
+}
+
+// workflowsURL links to the page of the workflow list starting at offset.
+func (s *Service) workflowsURL(filter WorkflowFilter, offset int) string {
+	q := url.Values{}
+	if filter.IncludeArchived {
+		q.Set("archived", "true")
+	}
+	if filter.ProjectID != "" {
+		q.Set("project", filter.ProjectID)
+	}
+	q.Set("offset", strconv.Itoa(offset))
+	if filter.Limit != defaultWorkflowPageSize {
+		q.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	return s.publicURL + "/api/v1/workflows?" + q.Encode()
 }
 
-// TODO: Update this
 func (s *Service) HandleExecuteWorkflow(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 	slog.Debug("Handling workflow execution for id", "id", id)
 
-	// Generate current timestamp
-	currentTime := time.Now().Format(time.RFC3339)
-
-	executionJSON := fmt.Sprintf(`{
-		"executedAt": "%s",
-		"status": "completed",
-		"steps": [
-			{
-				"nodeId": "start",
-				"type": "start",
-				"label": "Start",
-				"description": "Begin weather check workflow",
-				"status": "completed"
-			},
-			{
-				"nodeId": "form",
-				"type": "form",
-				"label": "User Input",
-				"description": "Process collected data - name, email, location",
-				"status": "completed",
-				"output": {
-					"name": "Alice",
-					"email": "alice@example.com",
-					"city": "Sydney"
-				}
-			},
-			{
-				"nodeId": "weather-api",
-				"type": "integration",
-				"label": "Weather API",
-				"description": "Fetch current temperature for Sydney",
-				"status": "completed",
-				"output": {
-					"temperature": 28.5,
-					"location": "Sydney"
-				}
-			},
-			{
-				"nodeId": "condition",
-				"type": "condition",
-				"label": "Check Condition",
-				"description": "Evaluate temperature threshold",
-				"status": "completed",
-				"output": {
-					"conditionMet": true,
-					"threshold": 25,
-					"operator": "greater_than",
-					"actualValue": 28.5,
-					"message": "Temperature 28.5°C is greater than 25°C - condition met"
-				}
-			},
-			{
-				"nodeId": "email",
-				"type": "email",
-				"label": "Send Alert",
-				"description": "Email weather alert notification",
-				"status": "completed",
-				"output": {
-					"emailDraft": {
-						"to": "alice@example.com",
-						"from": "weather-alerts@example.com",
-						"subject": "Weather Alert",
-						"body": "Weather alert for Sydney! Temperature is 28.5°C!",
-						"timestamp": "2024-01-15T14:30:24.856Z"
-					},
-					"deliveryStatus": "sent",
-					"messageId": "msg_abc123def456",
-					"emailSent": true
-				}
-			},
-			{
-				"nodeId": "end",
-				"type": "end",
-				"label": "Complete",
-				"description": "Workflow execution finished",
-				"status": "completed"
-			}
-		]
-	}`, currentTime)
-
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(executionJSON))
+	var req ExecuteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return
+	}
+	if req.TriggeredBy == "" {
+		req.TriggeredBy = TriggerAPI
+	}
+	if !slices.Contains(Triggers, req.TriggeredBy) {
+		writeError(w, http.StatusBadRequest, "invalid_trigger",
+			fmt.Sprintf("triggeredBy must be one of %v", Triggers))
+		return
+	}
+	if req.Preset != "" {
+		if apiErr := s.applyPreset(r.Context(), id, &req); apiErr != nil {
+			apiErr.write(w)
+			return
+		}
+	}
+
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", ExecutionModeSync:
+		s.executeWorkflow(w, r, id, &req, nil)
+	case ExecutionModeAsync:
+		s.enqueueWorkflow(w, r, id, &req)
+	default:
+		writeError(w, http.StatusBadRequest, "invalid_mode",
+			fmt.Sprintf("mode must be %s or %s", ExecutionModeSync, ExecutionModeAsync))
+	}
+}
+
+// executeWorkflow runs the workflow with the request's input and writes the
+// execution.
+func (s *Service) executeWorkflow(w http.ResponseWriter, r *http.Request, id string, req *ExecuteRequest, variables map[string]any) {
+	resp, apiErr := s.runWorkflow(r.Context(), id, req, variables)
+	if apiErr != nil {
+		apiErr.write(w)
+		return
+	}
+	s.capSteps(&resp)
+	respond(w, http.StatusOK, resp)
+}
+
+// runWorkflow runs the workflow with the request's input and records the
+// execution. variables, when set, seed the run state through the start node.
+// Failures that keep the run from starting or being recorded, and runs out of
+// time, are returned as the error response they get.
+func (s *Service) runWorkflow(ctx context.Context, id string, req *ExecuteRequest, variables map[string]any) (ExecutionResponse, *apiError) {
+	run, graph, apiErr := s.prepareRun(ctx, id, req, variables)
+	if apiErr != nil {
+		return ExecutionResponse{}, apiErr
+	}
+
+	s.notifyHooks(ctx, callback.Event{
+		Event:       callback.EventStarted,
+		WorkflowID:  id,
+		ExecutionID: run.ID,
+		Timestamp:   s.clock.Now(),
+	})
+	exec, err := s.executor.Execute(s.runContext(ctx, run), graph, run.Input)
+
+	// The context may have hit its deadline during the run; the bookkeeping
+	// below must still happen.
+	ctx = context.WithoutCancel(ctx)
+
+	if err != nil && (exec == nil || errors.Is(err, engine.ErrInvalidInput) || engine.IsGraphError(err)) {
+		s.notifyFailed(ctx, run, err)
+		return ExecutionResponse{}, engineError(err)
+	}
+
+	resp, saveErr := s.recordExecution(ctx, run, exec, err)
+	if saveErr != nil {
+		return resp, storeError(saveErr, "save execution")
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return resp, timeoutError(run.ID)
+	}
+	return resp, nil
+}
+
+// prepareRun loads the workflow and its graph and resolves the environment,
+// handler bindings and input of a new run of it.
+func (s *Service) prepareRun(ctx context.Context, id string, req *ExecuteRequest, variables map[string]any) (executionRun, *engine.Graph, *apiError) {
+	wf, err := s.definition(ctx, id)
+	if err != nil {
+		return executionRun{}, nil, storeError(err, "load workflow")
+	}
+	if wf.ArchivedAt != nil {
+		return executionRun{}, nil, &apiError{status: http.StatusConflict,
+			body: ErrorResponse{Code: "workflow_archived", Message: "archived workflows cannot be executed"}}
+	}
+
+	graph, err := s.graph(wf)
+	if err != nil {
+		return executionRun{}, nil, engineError(err)
+	}
+
+	env := req.Environment
+	if env == "" {
+		env = wf.Environment
+	}
+	if msg := s.checkEnvironment(env); msg != "" {
+		return executionRun{}, nil, &apiError{status: http.StatusUnprocessableEntity,
+			body: ErrorResponse{Code: "unknown_environment", Message: msg}}
+	}
+	bindings, err := s.repo.GetHandlerBindings(ctx, id)
+	if err != nil {
+		return executionRun{}, nil, storeError(err, "load handler bindings")
+	}
+
+	input := map[string]any{
+		"formData":  req.FormData,
+		"condition": req.Condition,
+	}
+	if variables != nil {
+		input["variables"] = variables
+	}
+
+	run := executionRun{
+		ID:              s.ids.NewID(),
+		WorkflowID:      id,
+		WorkflowVersion: wf.Version,
+		TriggeredBy:     req.TriggeredBy,
+		Environment:     env,
+		TraceLevel:      wf.TraceLevel,
+		Input:           input,
+		Bindings:        s.runBindings(env, bindings),
+		Pins:            wf.HandlerVersions,
+		Budget:          wf.Budget,
+	}
+	return run, graph, nil
+}
+
+// timeoutError is returned for a run interrupted by the request deadline; the
+// run was recorded under executionID.
+func timeoutError(executionID string) *apiError {
+	return &apiError{status: http.StatusGatewayTimeout, body: ErrorResponse{
+		Code:        "timeout",
+		Message:     "workflow execution exceeded the request deadline",
+		ExecutionID: executionID,
+	}}
+}
+
+// executionRun identifies a run and how it was triggered.
+type executionRun struct {
+	ID              string
+	WorkflowID      string
+	WorkflowVersion int
+	TriggeredBy     string
+	Environment     string
+	TraceLevel      string
+	Input           map[string]any
+
+	// Bindings maps node types to the handler variants they run with, and
+	// Pins to the major versions of their handlers.
+	Bindings map[string]string
+	Pins     map[string]int
+
+	// Budget caps what the run may consume.
+	Budget *Budget
+
+	// Resumed is set when the run continues a paused execution, whose record
+	// is then updated instead of created. PriorSteps is the number of steps
+	// that ran before the pause and were already checked for anomalies.
+	Resumed    bool
+	PriorSteps int
+
+	// Queued is set for async runs, whose record is created when they are
+	// queued and updated once they finish.
+	Queued bool
+}
+
+func (s *Service) notifyFailed(ctx context.Context, run executionRun, err error) {
+	s.notifyHooks(ctx, callback.Event{
+		Event:       callback.EventFailed,
+		WorkflowID:  run.WorkflowID,
+		ExecutionID: run.ID,
+		Status:      string(engine.ExecutionStatusFailed),
+		Error:       err.Error(),
+		Timestamp:   s.clock.Now(),
+	})
+}
+
+// recordExecution does the bookkeeping after a run: it notifies hooks, flags
+// step duration anomalies and stores the execution. runErr is the error the
+// engine returned for exec.
+func (s *Service) recordExecution(ctx context.Context, run executionRun, exec *engine.Execution, runErr error) (ExecutionResponse, error) {
+	switch {
+	case runErr != nil:
+		slog.Warn("Workflow execution failed", "id", run.WorkflowID, "executionId", run.ID, "error", runErr)
+		s.notifyFailed(ctx, run, runErr)
+	case exec.Status == engine.ExecutionStatusCompleted:
+		s.notifyHooks(ctx, callback.Event{
+			Event:       callback.EventCompleted,
+			WorkflowID:  run.WorkflowID,
+			ExecutionID: run.ID,
+			Status:      string(exec.Status),
+			Timestamp:   exec.FinishedAt,
+		})
+	}
+
+	resp := toExecutionResponse(exec)
+	resp.Environment = run.Environment
+	resp.TraceLevel = run.TraceLevel
+	s.flagAnomalies(ctx, run.WorkflowID, run.ID, resp.Steps[min(run.PriorSteps, len(resp.Steps)):])
+
+	record := &ExecutionRecord{
+		ID:           run.ID,
+		WorkflowID:   run.WorkflowID,
+		Status:       resp.Status,
+		ExecutedAt:   resp.ExecutedAt.Time,
+		Input:        run.Input,
+		FinalContext: exec.State,
+		Steps:        traceSteps(resp.Steps, run.TraceLevel),
+
+		TriggeredBy:     run.TriggeredBy,
+		WorkflowVersion: run.WorkflowVersion,
+		Environment:     run.Environment,
+		TraceLevel:      run.TraceLevel,
+
+		StartedAt:  exec.StartedAt,
+		FinishedAt: exec.FinishedAt,
+		DurationMs: exec.FinishedAt.Sub(exec.StartedAt).Milliseconds(),
+
+		Checkpoint:   exec.Checkpoint,
+		PendingInput: resp.PendingInput,
+	}
+	var nodeErr *engine.NodeExecutionError
+	if errors.As(runErr, &nodeErr) {
+		record.FailedNodeType = nodeErr.NodeType
+	}
+	save := s.repo.CreateExecution
+	if run.Resumed || run.Queued {
+		save = s.repo.UpdateExecution
+	}
+	err := save(ctx, record)
+	s.feeds.finish(run.ID, record.Status)
+	if err != nil {
+		return resp, err
+	}
+	resp.ExecutionID = record.ID
+	return resp, nil
+}
+
+// buildGraph converts the editor representation into an engine graph. Nodes
+// get the workflow defaults merged into their metadata; annotation nodes are
+// left out.
+func buildGraph(wf *Workflow) (*engine.Graph, error) {
+	nodes := make([]engine.Node, 0, len(wf.Nodes))
+	for _, n := range wf.Nodes {
+		if IsAnnotation(n.Type) {
+			continue
+		}
+		nodes = append(nodes, engine.Node{
+			ID:          n.ID,
+			Type:        n.Type,
+			Label:       n.Data.Label,
+			Description: n.Data.Description,
+			Metadata:    wf.nodeMetadata(n),
+		})
+	}
+
+	edges := make([]engine.Edge, 0, len(wf.Edges))
+	for _, e := range wf.Edges {
+		edges = append(edges, engine.Edge{
+			ID:           e.ID,
+			Source:       e.Source,
+			Target:       e.Target,
+			SourceHandle: e.SourceHandle,
+		})
+	}
+
+	return engine.NewGraph(nodes, edges)
+}
+
+func toExecutionResponse(exec *engine.Execution) ExecutionResponse {
+	resp := ExecutionResponse{
+		ExecutedAt: TimestampOf(exec.StartedAt),
+		Status:     string(exec.Status),
+		Steps:      make([]ExecutionStep, 0, len(exec.Steps)),
+	}
+	for _, step := range exec.Steps {
+		resp.Steps = append(resp.Steps, convertStep(step))
+	}
+	if exec.Await != nil {
+		resp.PendingInput = &PendingInput{
+			NodeID:      exec.Checkpoint.NextNodeID,
+			Kind:        exec.Await.Kind,
+			Details:     exec.Await.Details,
+			RequestedAt: TimestampOf(exec.FinishedAt),
+		}
+	}
+	return resp
+}
+
+func convertStep(step engine.ExecutionStep) ExecutionStep {
+	out := ExecutionStep{
+		NodeID:       step.NodeID,
+		Type:         step.NodeType,
+		Label:        step.Label,
+		Description:  step.Description,
+		Status:       string(step.Status),
+		Output:       step.Output,
+		Error:        step.Error,
+		StartedAt:    TimestampPtr(step.StartedAt),
+		FinishedAt:   TimestampPtr(step.FinishedAt),
+		DurationMs:   MillisOf(step.FinishedAt.Sub(step.StartedAt)),
+		Memoized:     step.Memoized,
+		Compensation: step.Compensation,
+
+		ParallelBranch: step.ParallelBranch,
+		RateLimitedMs:  MillisOf(step.RateLimited),
+	}
+	if step.Attempts > 1 {
+		out.Attempts = step.Attempts
+	}
+	if step.Iteration != nil {
+		out.Iteration = &StepIteration{NodeID: step.Iteration.NodeID, Index: step.Iteration.Index}
+	}
+	return out
 }
@@ -0,0 +1,147 @@
+package workflow
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLWorkflow is the human-friendly definition format: nodes are a flat list
+// and edges are written as from → to with an optional branch. Layout fields
+// are optional so hand-written definitions stay short.
+type YAMLWorkflow struct {
+	ID    string     `yaml:"id,omitempty"`
+	Name  string     `yaml:"name"`
+	Nodes []YAMLNode `yaml:"nodes"`
+	Edges []YAMLEdge `yaml:"edges"`
+
+	Defaults    map[string]map[string]any `yaml:"defaults,omitempty"`
+	Environment string                    `yaml:"environment,omitempty"`
+	TraceLevel  string                    `yaml:"traceLevel,omitempty"`
+
+	HandlerVersions map[string]int `yaml:"handlerVersions,omitempty"`
+	Budget          *Budget        `yaml:"budget,omitempty"`
+}
+
+type YAMLNode struct {
+	ID          string         `yaml:"id"`
+	Type        string         `yaml:"type"`
+	Label       string         `yaml:"label,omitempty"`
+	Description string         `yaml:"description,omitempty"`
+	Position    *Position      `yaml:"position,omitempty"`
+	Parent      string         `yaml:"parent,omitempty"`
+	Style       map[string]any `yaml:"style,omitempty"`
+	Metadata    map[string]any `yaml:"metadata,omitempty"`
+}
+
+type YAMLEdge struct {
+	ID     string         `yaml:"id,omitempty"`
+	From   string         `yaml:"from"`
+	To     string         `yaml:"to"`
+	Branch string         `yaml:"branch,omitempty"`
+	Label  string         `yaml:"label,omitempty"`
+	Props  map[string]any `yaml:"props,omitempty"`
+}
+
+// Horizontal spacing used to lay out nodes imported without a position.
+const yamlLayoutSpacing = 300
+
+// ParseYAMLWorkflow decodes a YAML definition into the canvas format.
+func ParseYAMLWorkflow(data []byte) (*Workflow, error) {
+	var y YAMLWorkflow
+	if err := yaml.Unmarshal(data, &y); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+
+	wf := &Workflow{ID: y.ID, Name: y.Name, Defaults: y.Defaults, Environment: y.Environment, TraceLevel: y.TraceLevel,
+		HandlerVersions: y.HandlerVersions, Budget: y.Budget}
+	for i, n := range y.Nodes {
+		node := Node{
+			ID:       n.ID,
+			Type:     n.Type,
+			ParentID: n.Parent,
+			Style:    n.Style,
+			Data: NodeData{
+				Label:       n.Label,
+				Description: n.Description,
+				Metadata:    n.Metadata,
+			},
+		}
+		if n.Position != nil {
+			node.Position = *n.Position
+		} else {
+			node.Position = Position{X: float64(i * yamlLayoutSpacing)}
+		}
+		wf.Nodes = append(wf.Nodes, node)
+	}
+
+	for i, e := range y.Edges {
+		edge := Edge{
+			ID:           e.ID,
+			Source:       e.From,
+			Target:       e.To,
+			SourceHandle: e.Branch,
+		}
+		if edge.ID == "" {
+			edge.ID = fmt.Sprintf("e%d", i+1)
+		}
+		props := maps.Clone(e.Props)
+		if e.Label != "" {
+			if props == nil {
+				props = make(map[string]any, 1)
+			}
+			props["label"] = e.Label
+		}
+		edge.Props, edge.propErrors = decodeEdgeProps("edges["+edge.ID+"]", props)
+		wf.Edges = append(wf.Edges, edge)
+	}
+	return wf, nil
+}
+
+// MarshalYAMLWorkflow encodes a workflow in the YAML definition format.
+func MarshalYAMLWorkflow(wf *Workflow) ([]byte, error) {
+	y := YAMLWorkflow{ID: wf.ID, Name: wf.Name, Defaults: wf.Defaults, Environment: wf.Environment, TraceLevel: wf.TraceLevel,
+		HandlerVersions: wf.HandlerVersions, Budget: wf.Budget}
+	for _, n := range wf.Nodes {
+		pos := n.Position
+		y.Nodes = append(y.Nodes, YAMLNode{
+			ID:          n.ID,
+			Type:        n.Type,
+			Label:       n.Data.Label,
+			Description: n.Data.Description,
+			Position:    &pos,
+			Parent:      n.ParentID,
+			Style:       n.Style,
+			Metadata:    n.Data.Metadata,
+		})
+	}
+
+	for _, e := range wf.Edges {
+		edge := YAMLEdge{
+			ID:     e.ID,
+			From:   e.Source,
+			To:     e.Target,
+			Branch: e.SourceHandle,
+		}
+		edge.Label = e.Props.Label
+		props := e.Props
+		props.Label = ""
+		if fields := props.fields(); len(fields) > 0 {
+			edge.Props = fields
+		}
+		y.Edges = append(y.Edges, edge)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(y); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}